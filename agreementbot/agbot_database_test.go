@@ -0,0 +1,438 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/persistence/bolt"
+	"github.com/open-horizon/anax/agreementbot/persistence/postgresql"
+	"github.com/open-horizon/anax/agreementbot/persistence/sqlite"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// The agbot database tests run against each of the database providers. The bolt and sqlite databases are created in a
+// temporary directory. The postgresql tests run only when ANAX_TEST_POSTGRESQL_HOST is set, in which case the other
+// ANAX_TEST_POSTGRESQL_* variables describe an empty database that the tests can use.
+type testDatabaseProvider struct {
+	name        string
+	partitioned bool // The database can be shared by several agbots, each owning a partition
+	cfg         *config.HorizonConfig
+	open        func() persistence.AgbotDatabase
+}
+
+func getTestDatabaseProviders(t *testing.T, dir string) []testDatabaseProvider {
+
+	providers := []testDatabaseProvider{
+		{
+			name: "bolt",
+			cfg:  &config.HorizonConfig{AgreementBot: config.AGConfig{DBPath: path.Join(dir, "bolt")}},
+			open: func() persistence.AgbotDatabase { return new(bolt.AgbotBoltDB) },
+		},
+		{
+			name:        "sqlite",
+			partitioned: true,
+			cfg:         &config.HorizonConfig{AgreementBot: config.AGConfig{Sqlite: config.SqliteConfig{File: path.Join(dir, "sqlite", "agbot.db")}}},
+			open:        func() persistence.AgbotDatabase { return new(sqlite.AgbotSqliteDB) },
+		},
+	}
+
+	if host := os.Getenv("ANAX_TEST_POSTGRESQL_HOST"); host != "" {
+		providers = append(providers, testDatabaseProvider{
+			name:        "postgresql",
+			partitioned: true,
+			cfg: &config.HorizonConfig{AgreementBot: config.AGConfig{Postgresql: config.PostgresqlConfig{
+				Host:               host,
+				Port:               os.Getenv("ANAX_TEST_POSTGRESQL_PORT"),
+				User:               os.Getenv("ANAX_TEST_POSTGRESQL_USER"),
+				Password:           os.Getenv("ANAX_TEST_POSTGRESQL_PASSWORD"),
+				DBName:             os.Getenv("ANAX_TEST_POSTGRESQL_DBNAME"),
+				SSLMode:            "disable",
+				MaxOpenConnections: 5,
+			}}},
+			open: func() persistence.AgbotDatabase { return new(postgresql.AgbotPostgresqlDB) },
+		})
+	} else {
+		t.Logf("ANAX_TEST_POSTGRESQL_HOST is not set, skipping the postgresql database tests")
+	}
+
+	return providers
+}
+
+// Run the input test against a freshly initialized database for each provider.
+func runDatabaseTest(t *testing.T, test func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase)) {
+	dir, err := ioutil.TempDir("", "agbotdb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, p := range getTestDatabaseProviders(t, dir) {
+		t.Run(p.name, func(t *testing.T) {
+			db := p.open()
+			if err := db.Initialize(p.cfg); err != nil {
+				t.Fatalf("unable to initialize database, error: %v", err)
+			}
+			defer db.Close()
+			test(t, p, db)
+		})
+	}
+}
+
+func Test_InitDatabase_select_provider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agbotdb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{Sqlite: config.SqliteConfig{File: path.Join(dir, "agbot.db")}}}
+	if db, err := persistence.InitDatabase(cfg); err != nil {
+		t.Errorf("unable to initialize database, error: %v", err)
+	} else if _, ok := db.(*sqlite.AgbotSqliteDB); !ok {
+		t.Errorf("expected the sqlite database, got %T", db)
+	} else {
+		db.Close()
+	}
+
+	if _, err := persistence.InitDatabase(&config.HorizonConfig{}); err == nil {
+		t.Errorf("expected an error when no database is configured")
+	}
+}
+
+func Test_AgbotDatabase_agreements(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase) {
+		agId := fmt.Sprintf("agreement%v", time.Now().UnixNano())
+		protocol := policy.BasicProtocol
+
+		if err := db.AgreementAttempt(agId, "myorg", "myorg/device1", "device", "myorg/pol1", "", "", "", protocol, "", []string{"myorg/svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement, error: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementId(agId, protocol, []persistence.AFilter{}); err != nil {
+			t.Errorf("unable to find agreement, error: %v", err)
+		} else if ag == nil || ag.CurrentAgreementId != agId || ag.DeviceId != "myorg/device1" {
+			t.Errorf("unexpected agreement %v", ag)
+		}
+
+		if ag, err := db.AgreementFinalized(agId, protocol); err != nil {
+			t.Errorf("unable to finalize agreement, error: %v", err)
+		} else if ag.AgreementFinalizedTime == 0 {
+			t.Errorf("agreement should be finalized: %v", ag)
+		} else if ags, err := db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), persistence.IdAFilter(agId)}, protocol); err != nil {
+			t.Errorf("unable to find agreements, error: %v", err)
+		} else if len(ags) != 1 || ags[0].AgreementFinalizedTime == 0 {
+			t.Errorf("expected 1 finalized agreement, got %v", ags)
+		}
+
+		if ag, err := db.AgreementUpgradePending(agId, protocol, "policy changed"); err != nil {
+			t.Errorf("unable to mark agreement pending upgrade, error: %v", err)
+		} else if ag.UpgradePendingTime == 0 || ag.UpgradePendingReason != "policy changed" {
+			t.Errorf("agreement upgrade should be pending: %v", ag)
+		} else if ag, err := db.AgreementUpgradeCleared(agId, protocol); err != nil {
+			t.Errorf("unable to clear pending upgrade, error: %v", err)
+		} else if ag.UpgradePendingTime != 0 || ag.UpgradePendingReason != "" {
+			t.Errorf("agreement upgrade should be cleared: %v", ag)
+		}
+
+		if _, err := db.ArchiveAgreement(agId, protocol, 1, "test"); err != nil {
+			t.Errorf("unable to archive agreement, error: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementIdAllProtocols(agId, policy.AllAgreementProtocols(), []persistence.AFilter{persistence.ArchivedAFilter()}); err != nil {
+			t.Errorf("unable to find agreement, error: %v", err)
+		} else if ag == nil || !ag.Archived {
+			t.Errorf("agreement should be archived: %v", ag)
+		}
+
+		if !p.partitioned {
+			if active, archived, err := db.GetAgreementCount(""); err != nil {
+				t.Errorf("unable to count agreements, error: %v", err)
+			} else if active != 0 || archived != 1 {
+				t.Errorf("expected 0 active and 1 archived agreement, got %v and %v", active, archived)
+			}
+		}
+
+		if err := db.DeleteAgreement(agId, protocol); err != nil {
+			t.Errorf("unable to delete agreement, error: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementId(agId, protocol, []persistence.AFilter{}); err != nil {
+			t.Errorf("unable to find agreement, error: %v", err)
+		} else if ag != nil {
+			t.Errorf("agreement should be deleted: %v", ag)
+		}
+	})
+}
+
+func Test_AgbotDatabase_workload_usages(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase) {
+		deviceId := fmt.Sprintf("myorg/device%v", time.Now().UnixNano())
+
+		if err := db.NewWorkloadUsage(deviceId, []string{}, "", "myorg/pol1", 1, 60, 60, false, "ag1"); err != nil {
+			t.Fatalf("unable to create workload usage, error: %v", err)
+		} else if err := db.NewWorkloadUsage(deviceId, []string{}, "", "myorg/pol1", 1, 60, 60, false, "ag1"); err == nil {
+			t.Errorf("creating a duplicate workload usage should fail")
+		}
+
+		if wu, err := db.UpdatePriority(deviceId, "myorg/pol1", 2, 120, 30, "ag2"); err != nil {
+			t.Errorf("unable to update workload usage, error: %v", err)
+		} else if wu.Priority != 2 || wu.CurrentAgreementId != "ag2" {
+			t.Errorf("unexpected workload usage %v", wu)
+		} else if wus, err := db.FindWorkloadUsages([]persistence.WUFilter{persistence.DaPWUFilter(deviceId, "myorg/pol1")}); err != nil {
+			t.Errorf("unable to find workload usages, error: %v", err)
+		} else if len(wus) != 1 || wus[0].Priority != 2 || wus[0].RetryDurationS != 120 {
+			t.Errorf("expected 1 updated workload usage, got %v", wus)
+		}
+
+		if err := db.DeleteWorkloadUsage(deviceId, "myorg/pol1"); err != nil {
+			t.Errorf("unable to delete workload usage, error: %v", err)
+		} else if wu, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceId, "myorg/pol1"); err != nil {
+			t.Errorf("unable to find workload usage, error: %v", err)
+		} else if wu != nil {
+			t.Errorf("workload usage should be deleted: %v", wu)
+		}
+	})
+}
+
+func Test_AgbotDatabase_bad_versions(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase) {
+		polName := fmt.Sprintf("myorg/pol%v", time.Now().UnixNano())
+		deviceId := "myorg/device1"
+
+		// Execution failures are counted per version, a change of the priority of the node does not reset them.
+		now := uint64(time.Now().Unix())
+		if err := db.NewWorkloadUsage(deviceId, []string{}, "", polName, 1, 60, 60, false, "ag1"); err != nil {
+			t.Fatalf("unable to create workload usage, error: %v", err)
+		} else if vf, err := db.RecordVersionFailure(polName, "2.0.0", deviceId, now-60); err != nil {
+			t.Errorf("unable to record version failure, error: %v", err)
+		} else if len(vf.Failures) != 1 {
+			t.Errorf("expected 1 failure, got %v", vf)
+		} else if _, err := db.UpdatePriority(deviceId, polName, 2, 60, 60, "ag2"); err != nil {
+			t.Errorf("unable to update workload usage, error: %v", err)
+		} else if vf, err := db.RecordVersionFailure(polName, "2.0.0", "myorg/device2", now-60); err != nil {
+			t.Errorf("unable to record version failure, error: %v", err)
+		} else if len(vf.FailedDevices(now-60)) != 2 {
+			t.Errorf("expected 2 failed nodes, got %v", vf)
+		} else if vf, err := db.RecordVersionFailure(polName, "2.0.0", "myorg/device3", now+60); err != nil {
+			t.Errorf("unable to record version failure, error: %v", err)
+		} else if len(vf.Failures) != 1 {
+			t.Errorf("the failures before the window should be dropped, got %v", vf)
+		}
+
+		if vfs, err := db.FindVersionFailures([]persistence.VFFilter{persistence.PolicyVFFilter(polName)}); err != nil {
+			t.Errorf("unable to find version failures, error: %v", err)
+		} else if len(vfs) != 1 || vfs[0].Version != "2.0.0" {
+			t.Errorf("expected 1 version failures record, got %v", vfs)
+		} else if err := db.DeleteVersionFailures(polName, "2.0.0"); err != nil {
+			t.Errorf("unable to delete version failures, error: %v", err)
+		} else if vfs, err := db.FindVersionFailures([]persistence.VFFilter{persistence.PolicyVFFilter(polName)}); err != nil {
+			t.Errorf("unable to find version failures, error: %v", err)
+		} else if len(vfs) != 0 {
+			t.Errorf("version failures should be deleted, got %v", vfs)
+		}
+
+		if bv, err := db.NewBadVersion(polName, "2.0.0", 1, "1.0.0", 4, []string{deviceId}); err != nil {
+			t.Fatalf("unable to create bad version, error: %v", err)
+		} else if bv.FailureRatio() != 0.25 {
+			t.Errorf("unexpected bad version %v", bv)
+		} else if bv, err := db.NewBadVersion(polName, "2.0.0", 1, "1.0.0", 10, []string{}); err != nil {
+			t.Errorf("unable to mark bad version again, error: %v", err)
+		} else if bv.Devices != 4 {
+			t.Errorf("the first bad version record should be kept, got %v", bv)
+		} else if _, err := db.NewBadVersion("myorg/other", "2.0.0", 1, "1.0.0", 4, []string{}); err != nil {
+			t.Errorf("unable to create bad version, error: %v", err)
+		}
+
+		if bvs, err := db.FindBadVersions([]persistence.BVFilter{persistence.PolicyBVFilter(polName)}); err != nil {
+			t.Errorf("unable to find bad versions, error: %v", err)
+		} else if len(bvs) != 1 || bvs[0].Version != "2.0.0" {
+			t.Errorf("expected 1 bad version, got %v", bvs)
+		}
+
+		if err := db.DeleteBadVersion(polName, "2.0.0"); err != nil {
+			t.Errorf("unable to delete bad version, error: %v", err)
+		} else if bvs, err := db.FindBadVersions([]persistence.BVFilter{persistence.PolicyBVFilter(polName)}); err != nil {
+			t.Errorf("unable to find bad versions, error: %v", err)
+		} else if len(bvs) != 0 {
+			t.Errorf("bad version should be deleted, got %v", bvs)
+		}
+
+		db.DeleteBadVersion("myorg/other", "2.0.0")
+		db.DeleteWorkloadUsage(deviceId, polName)
+	})
+}
+
+func Test_AgbotDatabase_rollouts(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase) {
+		polName := fmt.Sprintf("myorg/pol%v", time.Now().UnixNano())
+		strategy := policy.RolloutStrategy{CanaryCount: 1, BatchSize: 2}
+
+		if r, err := db.NewRollout(polName, "1.0.0", strategy); err != nil {
+			t.Fatalf("unable to create rollout, error: %v", err)
+		} else if r.State != persistence.ROLLOUT_STATE_CANARY || r.Batch != 0 {
+			t.Errorf("unexpected rollout %v", r)
+		}
+
+		if r, err := db.StartRolloutBatch(polName, []string{"myorg/device1"}, 3); err != nil {
+			t.Errorf("unable to start batch, error: %v", err)
+		} else if r.Batch != 1 || r.TotalDevices != 3 || !r.InBatch("myorg/device1") {
+			t.Errorf("unexpected rollout %v", r)
+		} else if r, err := db.UpdateRolloutBatch(polName, []string{"myorg/device1"}, []string{}, true); err != nil {
+			t.Errorf("unable to update batch, error: %v", err)
+		} else if r.BatchEndTime == 0 || len(r.UpgradedDevices) != 1 {
+			t.Errorf("batch should be ended: %v", r)
+		} else if r, err := db.StartRolloutBatch(polName, []string{"myorg/device2", "myorg/device3"}, 0); err != nil {
+			t.Errorf("unable to start batch, error: %v", err)
+		} else if r.Batch != 2 || r.State != persistence.ROLLOUT_STATE_ROLLING || r.TotalDevices != 3 {
+			t.Errorf("unexpected rollout %v", r)
+		}
+
+		if r, err := db.HaltRollout(polName, "test"); err != nil {
+			t.Errorf("unable to halt rollout, error: %v", err)
+		} else if r.State != persistence.ROLLOUT_STATE_HALTED || r.StateReason != "test" {
+			t.Errorf("rollout should be halted: %v", r)
+		} else if rs, err := db.FindRollouts([]persistence.RFilter{persistence.ActiveRFilter()}); err != nil {
+			t.Errorf("unable to find rollouts, error: %v", err)
+		} else if len(rs) != 0 {
+			t.Errorf("expected no active rollouts, got %v", rs)
+		} else if r, err := db.ResumeRollout(polName); err != nil {
+			t.Errorf("unable to resume rollout, error: %v", err)
+		} else if r.State != persistence.ROLLOUT_STATE_ROLLING || r.StateReason != "" {
+			t.Errorf("rollout should be rolling: %v", r)
+		}
+
+		if r, err := db.FailRollout(polName, []string{"myorg/device2"}, "test"); err != nil {
+			t.Errorf("unable to fail rollout, error: %v", err)
+		} else if r.State != persistence.ROLLOUT_STATE_FAILED || len(r.FailedDevices) != 1 {
+			t.Errorf("rollout should be failed: %v", r)
+		} else if r, err := db.ResumeRollout(polName); err != nil {
+			t.Errorf("unable to resume rollout, error: %v", err)
+		} else if r.State != persistence.ROLLOUT_STATE_ROLLING || r.BatchEndTime == 0 {
+			t.Errorf("resumed rollout should have ended the failed batch: %v", r)
+		}
+
+		if err := db.DeleteRollout(polName); err != nil {
+			t.Errorf("unable to delete rollout, error: %v", err)
+		} else if r, err := db.FindSingleRolloutByPolicyName(polName); err != nil {
+			t.Errorf("unable to find rollout, error: %v", err)
+		} else if r != nil {
+			t.Errorf("rollout should be deleted: %v", r)
+		}
+	})
+}
+
+func Test_AgbotDatabase_search_sessions(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase) {
+		polName := fmt.Sprintf("myorg/pol%v", time.Now().UnixNano())
+
+		// The bolt database is used by a single agbot, so every search gets a new session.
+		if !p.partitioned {
+			if token1, _, err := db.ObtainSearchSession(polName); err != nil {
+				t.Errorf("unable to obtain search session, error: %v", err)
+			} else if token2, _, err := db.ObtainSearchSession(polName); err != nil {
+				t.Errorf("unable to obtain search session, error: %v", err)
+			} else if token1 == token2 {
+				t.Errorf("expected a new session, got %v twice", token1)
+			}
+			return
+		}
+
+		token1, cs, err := db.ObtainSearchSession(polName)
+		if err != nil {
+			t.Fatalf("unable to obtain search session, error: %v", err)
+		} else if cs != 0 {
+			t.Errorf("expected changedSince 0 for a new session, got %v", cs)
+		}
+
+		// The session is not ended, so the same session is returned.
+		if token, _, err := db.ObtainSearchSession(polName); err != nil {
+			t.Errorf("unable to obtain search session, error: %v", err)
+		} else if token != token1 {
+			t.Errorf("expected the same session %v, got %v", token1, token)
+		}
+
+		if ended, err := db.UpdateSearchSessionChangedSince(0, 100, polName); err != nil {
+			t.Errorf("unable to end search session, error: %v", err)
+		} else if ended {
+			t.Errorf("search session should not have been ended already")
+		}
+
+		if token, cs, err := db.ObtainSearchSession(polName); err != nil {
+			t.Errorf("unable to obtain search session, error: %v", err)
+		} else if token == token1 || cs != 100 {
+			t.Errorf("expected a new session with changedSince 100, got %v and %v", token, cs)
+		}
+
+		if err := db.ResetPolicyChangedSince(polName, 50); err != nil {
+			t.Errorf("unable to reset changedSince, error: %v", err)
+		} else if err := db.ResetAllChangedSince(50); err != nil {
+			t.Errorf("unable to reset changedSince, error: %v", err)
+		} else if err := db.DumpSearchSessions(); err != nil {
+			t.Errorf("unable to dump search sessions, error: %v", err)
+		}
+	})
+}
+
+func Test_AgbotDatabase_partitions(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db1 persistence.AgbotDatabase) {
+		if !p.partitioned {
+			if moved, err := db1.MovePartition(60); err != nil || moved {
+				t.Errorf("a database with a single partition should not move partitions, moved: %v, error: %v", moved, err)
+			}
+			return
+		}
+
+		// A second agbot working with the same database gets its own partition.
+		db2 := p.open()
+		if err := db2.Initialize(p.cfg); err != nil {
+			t.Fatalf("unable to initialize second database, error: %v", err)
+		}
+		defer db2.Close()
+
+		parts1, err1 := db1.FindPartitions()
+		parts2, err2 := db2.FindPartitions()
+		if err1 != nil || err2 != nil {
+			t.Fatalf("unable to find partitions, errors: %v %v", err1, err2)
+		}
+		part1, part2 := parts1[len(parts1)-1], parts2[len(parts2)-1]
+		if part1 == part2 {
+			t.Errorf("both agbots are using partition %v", part1)
+		} else if owner, err := db1.GetPartitionOwner(part1); err != nil || owner == persistence.NO_PARTITION_OWNER {
+			t.Errorf("partition %v should be owned, owner: %v, error: %v", part1, owner, err)
+		}
+
+		if err := db2.HeartbeatPartition(); err != nil {
+			t.Errorf("unable to heartbeat partition, error: %v", err)
+		} else if hb, err := db2.GetHeartbeat(); err != nil || hb == 0 {
+			t.Errorf("expected a heartbeat, got %v, error: %v", hb, err)
+		}
+
+		// Agreements and workload usages created by the first agbot are not visible to the second.
+		agId := fmt.Sprintf("agreement%v", time.Now().UnixNano())
+		deviceId := fmt.Sprintf("myorg/device%v", time.Now().UnixNano())
+		protocol := policy.BasicProtocol
+		if err := db1.AgreementAttempt(agId, "myorg", deviceId, "device", "myorg/pol1", "", "", "", protocol, "", []string{"myorg/svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement, error: %v", err)
+		} else if err := db1.NewWorkloadUsage(deviceId, []string{}, "", "myorg/pol1", 1, 60, 60, false, agId); err != nil {
+			t.Fatalf("unable to create workload usage, error: %v", err)
+		} else if ag, err := db2.FindSingleAgreementByAgreementId(agId, protocol, []persistence.AFilter{}); err != nil || ag != nil {
+			t.Errorf("agreement should not be visible in another partition, agreement: %v, error: %v", ag, err)
+		}
+
+		// When the first agbot quiesces, the second one takes over its partition and the records in it.
+		if err := db1.QuiescePartition(); err != nil {
+			t.Fatalf("unable to quiesce partition, error: %v", err)
+		} else if moved, err := db2.MovePartition(60); err != nil || !moved {
+			t.Fatalf("partition should have been moved, moved: %v, error: %v", moved, err)
+		}
+
+		if ag, err := db2.FindSingleAgreementByAgreementId(agId, protocol, []persistence.AFilter{}); err != nil || ag == nil {
+			t.Errorf("agreement should be in the second partition, agreement: %v, error: %v", ag, err)
+		} else if wu, err := db2.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceId, "myorg/pol1"); err != nil || wu == nil {
+			t.Errorf("workload usage should be in the second partition, workload usage: %v, error: %v", wu, err)
+		} else if moved, err := db2.MovePartition(60); err != nil || moved {
+			t.Errorf("there should be no partition left to move, moved: %v, error: %v", moved, err)
+		}
+	})
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/version"
 	"github.com/open-horizon/anax/worker"
+	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
 	"os"
 	"strconv"
@@ -293,6 +294,11 @@ func (w *AgreementBotWorker) Initialize() bool {
 		return w.fail()
 	}
 
+	// Make the agreement, work queue and partition metrics available on the /metrics API.
+	if err := prometheus.Register(NewAgbotCollector(w.db, w.consumerPH)); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to register agbot metrics, error: %v", err)))
+	}
+
 	// Start the go thread that heartbeats to the database.
 	w.DispatchSubworker(DATABASE_HEARTBEAT, w.databaseHeartBeat, int(w.BaseWorker.Manager.Config.GetPartitionStale()/3), false)
 
@@ -20,6 +20,7 @@ import (
 	"math/rand"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // These structs are the event bodies that flow from the processor to the agreement workers
@@ -388,6 +389,9 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 			workload = wi.ConsumerPolicy.NextHighestPriorityWorkload(wlUsage.Priority, wlUsage.RetryCount+1, wlUsage.FirstTryTime)
 		}
 
+		// Never choose a workload version that has been marked bad for the policy, when there is one to fall back to.
+		workload = avoidBadVersion(b.db, &wi.ConsumerPolicy, workload)
+
 		// If we chose the same workload 2 times in a row through this loop, then we need to exit out of here
 		// Added second comparison in case the workload pointer got changed by the policy merger
 		if (lastWorkload == workload) || (lastWorkload != nil && workload != nil && lastWorkload.IsSame(*workload)) {
@@ -473,6 +477,7 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 		}
 
 		policy_match := false
+		var depSvcDefs map[string]exchange.ServiceDefinition
 
 		// Check if the depended services are suspended. If any of them are suspended, then abort the agreement initialization process.
 		for _, apiSpec := range *asl {
@@ -557,7 +562,7 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 			getResolvedServiceDef := exchange.GetHTTPServiceDefResolverHandler(b)
 			getService := exchange.GetHTTPServiceHandler(b)
 			mergedServicePol := compcheck.AddDefaultPropertiesToServicePolicy(servicePol, builtInSvcPol, nil)
-			if mergedServicePol, _, _, err = compcheck.SetServicePolicyPrivilege(getResolvedServiceDef, getService, *workload, mergedServicePol, nil, msgPrinter); err != nil {
+			if mergedServicePol, _, _, depSvcDefs, err = compcheck.SetServicePolicyPrivilege(getResolvedServiceDef, getService, *workload, mergedServicePol, nil, msgPrinter); err != nil {
 				return
 			}
 
@@ -577,6 +582,22 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 			}
 		}
 
+		// Make sure the node has enough cpus and memory for the resource limits in the deployment config of the service
+		// and the services it depends on.
+		if policy_match && depSvcDefs == nil && len(*asl) != 0 {
+			if depSvcDefs, _, _, err = exchange.GetHTTPServiceDefResolverHandler(b)(workload.WorkloadURL, workload.Org, workload.Version, workload.Arch); err != nil {
+				glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error retrieving the dependent services of %v, error: %v", workload, err)))
+				return
+			}
+		}
+		if policy_match {
+			svcDef := compcheck.ServiceDefinition{Org: workload.Org, ServiceDefinition: *workloadDetails}
+			if compatible, reason := compcheck.CheckResourceCompatibility(&wi.ProducerPolicy, &svcDef, depSvcDefs, msgPrinter); !compatible {
+				glog.Warningf(BAWlogstring(workerId, fmt.Sprintf("Node %v does not have the resources required by service %v/%v %v %v: %v", wi.Device.Id, workload.Org, workloadDetails.URL, workloadDetails.Version, workloadDetails.Arch, reason)))
+				policy_match = false
+			}
+		}
+
 		// Make sure the user inputs are all there
 		userInput_match := true
 		if policy_match {
@@ -604,6 +625,17 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 			}
 		}
 
+		// Make sure each of the secrets used by the service and the services it depends on is bound to a secret provider key.
+		if policy_match && userInput_match {
+			if _, err := policy.ResolveSecretBindings(workloadDetails.GetSecretNames(), workload.WorkloadURL, workload.Org, workload.Version, workload.Arch, wi.ConsumerPolicy.SecretBinding); err != nil {
+				glog.Warningf(BAWlogstring(workerId, fmt.Sprintf("Secret binding does not meet the requirement for service %v/%v %v %v: %v", workload.Org, workloadDetails.URL, workloadDetails.Version, workloadDetails.Arch, err)))
+				userInput_match = false
+			} else if _, err := exchange.ResolveDependencySecretBindings(depSvcDefs, wi.ConsumerPolicy.SecretBinding); err != nil {
+				glog.Warningf(BAWlogstring(workerId, fmt.Sprintf("Secret binding does not meet the requirement for a dependent service of %v/%v %v %v: %v", workload.Org, workloadDetails.URL, workloadDetails.Version, workloadDetails.Arch, err)))
+				userInput_match = false
+			}
+		}
+
 		if !policy_match || !userInput_match {
 			if !workload.HasEmptyPriority() {
 				// If this is not the first time through the loop, update the workload usage record, otherwise create it.
@@ -803,6 +835,7 @@ func (b *BaseAgreementWorker) HandleAgreementReply(cph ConsumerProtocolHandler,
 		} else {
 			// Done handling the response successfully
 			ackReplyAsValid = true
+			observeProposalAccepted(agreement)
 
 			// If we dont have a workload usage record for this device, then we need to create one. If there is already a
 			// workload usage record and workload rollback retry counting is enabled, then check to see if the workload priority
@@ -814,7 +847,7 @@ func (b *BaseAgreementWorker) HandleAgreementReply(cph ConsumerProtocolHandler,
 				// There could have been a change in the system such that the chosen workload is no longer the right choice. If this
 				// is the case, then we need to reject the agreement and start over.
 
-				workload := consumerPolicy.NextHighestPriorityWorkload(0, 0, 0)
+				workload := avoidBadVersion(b.db, consumerPolicy, consumerPolicy.NextHighestPriorityWorkload(0, 0, 0))
 				if !workload.Priority.IsSame(pol.Workloads[0].Priority) {
 					// Need a new workload usage record but not the same as the highest priority. That can't be right.
 					ackReplyAsValid = false
@@ -925,6 +958,12 @@ func (b *BaseAgreementWorker) HandleAgreementReply(cph ConsumerProtocolHandler,
 	} else {
 		glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("received rejection from producer %v", reply)))
 
+		if agreement, err := b.db.FindSingleAgreementByAgreementId(reply.AgreementId(), cph.Name(), []persistence.AFilter{persistence.UnarchivedAFilter()}); err != nil {
+			glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error querying agreement %v, error: %v", reply.AgreementId(), err)))
+		} else if agreement != nil {
+			observeProposalRejected(agreement)
+		}
+
 		// Returns true if the protocol msg can be deleted.
 		ok := b.CancelAgreement(cph, reply.AgreementId(), cph.GetTerminationCode(TERM_REASON_NEGATIVE_REPLY), workerId)
 		deletedMessage = !ok
@@ -1002,6 +1041,12 @@ func (b *BaseAgreementWorker) HandleWorkloadUpgrade(cph ConsumerProtocolHandler,
 	// If there is no agreement id specified then find one for the current device and policy name. If we find one,
 	// grab the agreement id lock, cancel the agreement and delete the workload usage record.
 
+	// The upgrade is deferred while the rollout of the policy holds back the device, or the maintenance window for the
+	// device is closed. Governance will queue the upgrade again when the rollout releases the device and the window opens.
+	if b.deferWorkloadUpgrade(cph, wi, workerId) {
+		return
+	}
+
 	if wi.AgreementId == "" {
 		if ags, err := b.db.FindAgreements([]persistence.AFilter{persistence.DevPolAFilter(wi.Device, wi.PolicyName)}, cph.Name()); err != nil {
 			glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error finding agreement for device %v and policyName %v, error: %v", wi.Device, wi.PolicyName, err)))
@@ -1031,6 +1076,35 @@ func (b *BaseAgreementWorker) HandleWorkloadUpgrade(cph ConsumerProtocolHandler,
 
 }
 
+// Returns true if the agreements affected by the workload upgrade have been marked to wait for the rollout of the policy
+// or for the maintenance window.
+func (b *BaseAgreementWorker) deferWorkloadUpgrade(cph ConsumerProtocolHandler, wi *HandleWorkloadUpgrade, workerId string) bool {
+
+	var ags []persistence.Agreement
+	if wi.AgreementId == "" {
+		if found, err := b.db.FindAgreements([]persistence.AFilter{persistence.DevPolAFilter(wi.Device, wi.PolicyName), persistence.UnarchivedAFilter()}, cph.Name()); err != nil {
+			glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error finding agreement for device %v and policyName %v, error: %v", wi.Device, wi.PolicyName, err)))
+		} else {
+			ags = found
+		}
+	} else if ag, err := b.db.FindSingleAgreementByAgreementId(wi.AgreementId, cph.Name(), []persistence.AFilter{persistence.UnarchivedAFilter()}); err != nil {
+		glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error finding agreement %v, error: %v", wi.AgreementId, err)))
+	} else if ag != nil {
+		ags = append(ags, *ag)
+	}
+
+	if len(ags) == 0 {
+		return false
+	} else if !rolloutHolds(policyRollout(b.db, wi.PolicyName), &ags[0]) && upgradeWindowOpen(newNodeWindows(exchange.GetHTTPNodePolicyHandler(b)), upgradePolicy(b.pm, &ags[0]), wi.Device, time.Now()) {
+		return false
+	}
+
+	for _, ag := range ags {
+		deferUpgrade(b.db, &ag, TERM_REASON_CANCEL_FORCED_UPGRADE)
+	}
+	return true
+}
+
 func (b *BaseAgreementWorker) CancelAgreementWithLock(cph ConsumerProtocolHandler, agreementId string, reason uint, workerId string) bool {
 	// Get the agreement id lock to prevent any other thread from processing this same agreement.
 	lock := b.AgreementLockManager().getAgreementLock(agreementId)
@@ -1092,6 +1166,12 @@ func (b *BaseAgreementWorker) CancelAgreement(cph ConsumerProtocolHandler, agree
 		if err := b.db.DeleteWorkloadUsage(ag.DeviceId, ag.PolicyName); err != nil {
 			glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error deleting workload usage record for device %v and policyName %v, error: %v", ag.DeviceId, ag.PolicyName, err)))
 		}
+
+	} else if wlUsage != nil && cph.IsTerminationReasonExecutionFailure(reason) {
+		// Count the execution failure so that the circuit breaker can tell when the workload version is failing on many nodes.
+		if err := recordVersionFailure(b.db, b.config, ag); err != nil {
+			glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error recording workload failure for device %v and policyName %v, error: %v", ag.DeviceId, ag.PolicyName, err)))
+		}
 	}
 
 	// Remove the long blockchain cancel from the worker thread. It is important to give the protocol handler a chance to
@@ -12,6 +12,7 @@ import (
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"io/ioutil"
 	"net/http"
 	"sort"
@@ -330,8 +331,15 @@ func (a *API) listen(apiListen string) {
 		router.HandleFunc("/policy/{org}/{name}", a.policy).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{name}/upgrade", a.policy).Methods("POST", "OPTIONS")
 		router.HandleFunc("/workloadusage", a.workloadusage).Methods("GET", "OPTIONS")
+		router.HandleFunc("/rollout", a.rollout).Methods("GET", "OPTIONS")
+		router.HandleFunc("/rollout/{org}/{name}", a.rollout).Methods("GET", "OPTIONS")
+		router.HandleFunc("/rollout/{org}/{name}/{action}", a.rollout).Methods("POST", "OPTIONS")
+		router.HandleFunc("/badversion", a.badversion).Methods("GET", "OPTIONS")
+		router.HandleFunc("/badversion/{org}/{name}", a.badversion).Methods("GET", "OPTIONS")
+		router.HandleFunc("/badversion/{org}/{name}/{version}", a.badversion).Methods("DELETE", "OPTIONS")
 		router.HandleFunc("/status", a.status).Methods("GET", "OPTIONS")
 		router.HandleFunc("/status/workers", a.workerstatus).Methods("GET", "OPTIONS")
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
 		router.HandleFunc("/node", a.node).Methods("GET", "DELETE", "OPTIONS")
 		router.HandleFunc("/config", a.config).Methods("GET", "OPTIONS")
 		router.HandleFunc("/cache/servedorg", a.ListServedOrgs).Methods("GET", "OPTIONS")
@@ -610,6 +618,148 @@ func (a *API) workloadusage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) rollout(w http.ResponseWriter, r *http.Request) {
+
+	pathVars := mux.Vars(r)
+	org := pathVars["org"]
+	name := pathVars["name"]
+	policyName := fmt.Sprintf("%v/%v", org, name)
+
+	switch r.Method {
+	case "GET":
+		if org == "" {
+			if rollouts, err := a.db.FindRollouts([]persistence.RFilter{}); err != nil {
+				glog.Error(APIlogString(fmt.Sprintf("error finding all rollouts, error: %v", err)))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			} else {
+				sort.Sort(RolloutsByPolicyName(rollouts))
+				writeResponse(w, rollouts, http.StatusOK)
+			}
+		} else if rollout, err := a.db.FindSingleRolloutByPolicyName(policyName); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding rollout for policy %v, error: %v", policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else if rollout == nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "name", Error: "rollout not found"})
+		} else {
+			writeResponse(w, rollout, http.StatusOK)
+		}
+
+	case "POST":
+		action := pathVars["action"]
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling POST of rollout %v for policy: %v", action, policyName)))
+
+		var rollout *persistence.Rollout
+		var err error
+		if existing, ferr := a.db.FindSingleRolloutByPolicyName(policyName); ferr != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding rollout for policy %v, error: %v", policyName, ferr)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		} else if existing == nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "name", Error: "rollout not found"})
+			return
+		} else if action == "halt" {
+			if !existing.IsActive() {
+				writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "name", Error: fmt.Sprintf("rollout cannot be halted, it is %v", existing.State)})
+				return
+			}
+
+			// The reason is optional.
+			var halt RolloutHalt
+			if body, _ := ioutil.ReadAll(r.Body); len(body) != 0 {
+				if err := json.Unmarshal(body, &halt); err != nil {
+					writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: fmt.Sprintf("user submitted data couldn't be deserialized to struct: %v. Error: %v", string(body), err)})
+					return
+				}
+			}
+			if halt.Reason == "" {
+				halt.Reason = "halted by user"
+			}
+			rollout, err = a.db.HaltRollout(policyName, halt.Reason)
+		} else if action == "resume" {
+			if existing.State != persistence.ROLLOUT_STATE_HALTED && existing.State != persistence.ROLLOUT_STATE_FAILED {
+				writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "name", Error: fmt.Sprintf("rollout cannot be resumed, it is %v", existing.State)})
+				return
+			}
+			rollout, err = a.db.ResumeRollout(policyName)
+		} else {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "action", Error: fmt.Sprintf("action %v is not supported, use halt or resume", action)})
+			return
+		}
+
+		if err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error handling rollout %v for policy %v, error: %v", action, policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, rollout, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		if _, ok := pathVars["action"]; ok {
+			w.Header().Set("Allow", "POST, OPTIONS")
+		} else {
+			w.Header().Set("Allow", "GET, OPTIONS")
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) badversion(w http.ResponseWriter, r *http.Request) {
+
+	pathVars := mux.Vars(r)
+	org := pathVars["org"]
+	name := pathVars["name"]
+	policyName := fmt.Sprintf("%v/%v", org, name)
+
+	switch r.Method {
+	case "GET":
+		filters := []persistence.BVFilter{}
+		if org != "" {
+			filters = append(filters, persistence.PolicyBVFilter(policyName))
+		}
+
+		if bvs, err := a.db.FindBadVersions(filters); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding bad versions, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			sort.Sort(BadVersionsByPolicyName(bvs))
+			writeResponse(w, bvs, http.StatusOK)
+		}
+
+	case "DELETE":
+		// Clearing a bad version allows the agbot to deploy it again, the nodes that were rolled back stay where they are.
+		// The earlier failures of the version are cleared too, so that the version is judged again from scratch.
+		version := pathVars["version"]
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling DELETE of bad version %v for policy: %v", version, policyName)))
+
+		if bvs, err := a.db.FindBadVersions([]persistence.BVFilter{persistence.PolicyBVFilter(policyName)}); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding bad versions for policy %v, error: %v", policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else if !isBadVersion(bvs, version) {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "version", Error: "bad version not found"})
+		} else if err := a.db.DeleteBadVersion(policyName, version); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error deleting bad version %v for policy %v, error: %v", version, policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else if err := a.db.DeleteVersionFailures(policyName, version); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error deleting failures of version %v for policy %v, error: %v", version, policyName, err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+
+	case "OPTIONS":
+		if _, ok := pathVars["version"]; ok {
+			w.Header().Set("Allow", "DELETE, OPTIONS")
+		} else {
+			w.Header().Set("Allow", "GET, OPTIONS")
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) status(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
@@ -897,6 +1047,38 @@ func (s WorkloadUsagesByDeviceId) Less(i, j int) bool {
 	return s[i].DeviceId < s[j].DeviceId
 }
 
+// Helper functions for sorting rollouts
+type RolloutsByPolicyName []persistence.Rollout
+
+func (s RolloutsByPolicyName) Len() int {
+	return len(s)
+}
+
+func (s RolloutsByPolicyName) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s RolloutsByPolicyName) Less(i, j int) bool {
+	return s[i].PolicyName < s[j].PolicyName
+}
+
+type BadVersionsByPolicyName []persistence.BadVersion
+
+func (s BadVersionsByPolicyName) Len() int {
+	return len(s)
+}
+
+func (s BadVersionsByPolicyName) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s BadVersionsByPolicyName) Less(i, j int) bool {
+	if s[i].PolicyName == s[j].PolicyName {
+		return s[i].Version < s[j].Version
+	}
+	return s[i].PolicyName < s[j].PolicyName
+}
+
 // Log string prefix api
 var APIlogString = func(v interface{}) string {
 	return fmt.Sprintf("AgreementBotWorker API %v", v)
@@ -908,6 +1090,10 @@ type UpgradeDevice struct {
 	Org         string `json:"org"`
 }
 
+type RolloutHalt struct {
+	Reason string `json:"reason"`
+}
+
 func (b *UpgradeDevice) IsValid() (bool, string) {
 	if b.Device == "" && b.AgreementId == "" {
 		return false, "must specify either device or agreementId"
@@ -176,6 +176,19 @@ func (c *BasicProtocolHandler) IsTerminationReasonNodeShutdown(code uint) bool {
 	return uint(code) == basicprotocol.CANCEL_NODE_SHUTDOWN
 }
 
+// Returns true if the node cancelled the agreement because the service failed to start or run.
+func (c *BasicProtocolHandler) IsTerminationReasonExecutionFailure(code uint) bool {
+	switch code {
+	case basicprotocol.CANCEL_CONTAINER_FAILURE, basicprotocol.CANCEL_NOT_EXECUTED_TIMEOUT, basicprotocol.CANCEL_MICROSERVICE_FAILURE,
+		basicprotocol.CANCEL_WL_IMAGE_LOAD_FAILURE, basicprotocol.CANCEL_MS_IMAGE_LOAD_FAILURE, basicprotocol.CANCEL_IMAGE_DATA_ERROR,
+		basicprotocol.CANCEL_IMAGE_FETCH_FAILURE, basicprotocol.CANCEL_IMAGE_FETCH_AUTH_FAILURE, basicprotocol.CANCEL_IMAGE_SIG_VERIF_FAILURE,
+		basicprotocol.CANCEL_MS_IMAGE_FETCH_FAILURE:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *BasicProtocolHandler) SetBlockchainWritable(ev *events.AccountFundedMessage) {
 	return
 }
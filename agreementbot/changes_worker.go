@@ -122,7 +122,9 @@ func (w *ChangesWorker) findAndProcessChanges() {
 	glog.V(3).Infof(chglog(fmt.Sprintf("looking for changes starting from ID %v", w.changeID)))
 
 	// Call the exchange to retrieve any changes since our last known change id.
+	callStart := time.Now()
 	changes, err := exchange.GetHTTPExchangeChangeHandler(w)(w.changeID, w.Config.AgreementBot.MaxExchangeChanges, w.orgList)
+	observeExchangeChanges(time.Since(callStart), err)
 
 	// Handle heartbeat state changes and errors. Returns true if there was an error to be handled.
 	if w.handleHeartbeatStateAndError(changes, err) {
@@ -167,6 +169,7 @@ func (w *ChangesWorker) findAndProcessChanges() {
 			batchedEvents[events.CHANGE_NODE_TYPE] = true
 
 		} else if change.IsNodePolicy("") {
+			forgetNodeWindow(fmt.Sprintf("%v/%v", change.OrgID, change.ID))
 			batchedEvents[events.CHANGE_NODE_POLICY_TYPE] = true
 
 		} else if change.IsNodeAgreement("") {
@@ -0,0 +1,280 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/policy"
+	"time"
+)
+
+// Workload rollback through the workload priorities in a policy is judged one node at a time, each node uses up its
+// own retries before it moves to the next priority. The circuit breaker judges a workload version across all of the
+// nodes running it. The execution failures of a version are recorded per policy and version, apart from the workload
+// usage records, so that a node that was rolled back on its own still counts as failed. Only the failures within the
+// failure window are counted. When the ratio of failed nodes reaches the configured threshold, the version is marked bad
+// for the policy and all of the nodes running it are moved back to the next lower priority workload. New agreements
+// skip the bad version.
+
+// Returns true when the failures of a workload version across its nodes should trip the circuit breaker.
+func breakerTripped(devices int, failed int, ratio float64, minNodes int) bool {
+	if ratio <= 0 || devices == 0 || devices < minNodes {
+		return false
+	}
+	return float64(failed)/float64(devices) >= ratio
+}
+
+// Returns true if the version is one of the bad versions.
+func isBadVersion(bvs []persistence.BadVersion, version string) bool {
+	for _, bv := range bvs {
+		if bv.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the highest priority workload below the input priority whose version is not bad, or nil if there is none.
+func fallbackWorkload(pol *policy.Policy, priority int, bvs []persistence.BadVersion) *policy.Workload {
+	for wl := pol.NextLowerPriorityWorkload(priority); wl != nil; wl = pol.NextLowerPriorityWorkload(wl.Priority.PriorityValue) {
+		if !isBadVersion(bvs, wl.Version) {
+			return wl
+		}
+	}
+	return nil
+}
+
+// Returns the workload with the given priority, or nil if there is none.
+func workloadAtPriority(pol *policy.Policy, priority int) *policy.Workload {
+	for ix, wl := range pol.Workloads {
+		if wl.Priority.PriorityValue == priority {
+			return &pol.Workloads[ix]
+		}
+	}
+	return nil
+}
+
+// Returns the workload to deploy in place of the chosen workload. When the version of the chosen workload is bad for
+// the policy, the next lower priority workload that is not bad is used instead. The chosen workload is returned when
+// there is nothing to fall back to.
+func avoidBadVersion(db persistence.AgbotDatabase, pol *policy.Policy, workload *policy.Workload) *policy.Workload {
+	if workload == nil || len(pol.Workloads) < 2 {
+		return workload
+	}
+
+	bvs, err := db.FindBadVersions([]persistence.BVFilter{persistence.PolicyBVFilter(pol.Header.Name)})
+	if err != nil {
+		glog.Errorf(cbLogString(fmt.Sprintf("unable to read bad versions for policy %v, error: %v", pol.Header.Name, err)))
+		return workload
+	} else if !isBadVersion(bvs, workload.Version) {
+		return workload
+	} else if fallback := fallbackWorkload(pol, workload.Priority.PriorityValue, bvs); fallback != nil {
+		glog.V(5).Infof(cbLogString(fmt.Sprintf("using version %v instead of bad version %v for policy %v", fallback.Version, workload.Version, pol.Header.Name)))
+		return fallback
+	}
+	return workload
+}
+
+// Returns the time from which the execution failures of the workload versions are counted.
+func failureWindowStart(cfg *config.HorizonConfig) uint64 {
+	return uint64(time.Now().Unix()) - cfg.GetAgbotRollbackFailureWindowS()
+}
+
+// Record an execution failure of the workload version of the agreement, so that the circuit breaker can tell when the
+// version is failing on many nodes.
+func recordVersionFailure(db persistence.AgbotDatabase, cfg *config.HorizonConfig, ag *persistence.Agreement) error {
+	if cfg.GetAgbotRollbackFailureRatio() <= 0 {
+		return nil
+	}
+
+	// The workload of the agreement is the only workload in the policy of the agreement.
+	if pol, err := policy.DemarshalPolicy(ag.Policy); err != nil {
+		return err
+	} else if len(pol.Workloads) == 0 || pol.Workloads[0].Version == "" {
+		return nil
+	} else if _, err := db.RecordVersionFailure(ag.PolicyName, pol.Workloads[0].Version, ag.DeviceId, failureWindowStart(cfg)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the current definition of the policy with the given name.
+func (w *AgreementBotWorker) breakerPolicy(policyName string) *policy.Policy {
+	for _, org := range w.pm.GetAllPolicyOrgs() {
+		if pol := w.pm.GetPolicy(org, policyName); pol != nil {
+			return pol
+		}
+	}
+	return nil
+}
+
+// Judge each workload version across the nodes running it, mark the versions that fail on too many nodes as bad and
+// roll their nodes back to the previous priority.
+func (w *AgreementBotWorker) governBadVersions() {
+
+	ratio := w.Config.GetAgbotRollbackFailureRatio()
+	if ratio <= 0 {
+		return
+	}
+
+	wus, err := w.db.FindWorkloadUsages([]persistence.WUFilter{})
+	if err != nil {
+		glog.Errorf(cbLogString(fmt.Sprintf("unable to read workload usages, error: %v", err)))
+		return
+	}
+
+	vfs, err := w.db.FindVersionFailures([]persistence.VFFilter{})
+	if err != nil {
+		glog.Errorf(cbLogString(fmt.Sprintf("unable to read version failures, error: %v", err)))
+		return
+	}
+
+	// Group the nodes by policy and workload priority.
+	type priorityKey struct {
+		policyName string
+		priority   int
+	}
+	devices := make(map[priorityKey][]string)
+	for _, wu := range wus {
+		k := priorityKey{policyName: wu.PolicyName, priority: wu.Priority}
+		devices[k] = append(devices[k], wu.DeviceId)
+	}
+
+	since := failureWindowStart(w.Config)
+	for _, vf := range vfs {
+		failed := vf.FailedDevices(since)
+		if len(failed) == 0 {
+			// The version has not failed within the failure window, so its older failures no longer count.
+			if err := w.db.DeleteVersionFailures(vf.PolicyName, vf.Version); err != nil {
+				glog.Errorf(cbLogString(fmt.Sprintf("unable to delete failures of version %v of policy %v, error: %v", vf.Version, vf.PolicyName, err)))
+			}
+			continue
+		}
+
+		pol := w.breakerPolicy(vf.PolicyName)
+		if pol == nil {
+			continue
+		}
+		wl := workloadWithVersion(pol, vf.Version)
+		if wl == nil {
+			continue
+		}
+
+		bvs, err := w.db.FindBadVersions([]persistence.BVFilter{persistence.PolicyBVFilter(vf.PolicyName)})
+		if err != nil {
+			glog.Errorf(cbLogString(fmt.Sprintf("unable to read bad versions for policy %v, error: %v", vf.PolicyName, err)))
+			continue
+		} else if isBadVersion(bvs, wl.Version) {
+			continue
+		}
+
+		// Without a lower priority workload there is nowhere to roll the nodes back to.
+		fallback := fallbackWorkload(pol, wl.Priority.PriorityValue, bvs)
+		if fallback == nil {
+			continue
+		}
+
+		// The nodes running the version now, and the nodes that failed with it and have been rolled back since.
+		devs := unionDevices(devices[priorityKey{policyName: vf.PolicyName, priority: wl.Priority.PriorityValue}], failed)
+		if breakerTripped(len(devs), len(failed), ratio, w.Config.GetAgbotRollbackMinNodes()) {
+			w.markBadVersion(vf.PolicyName, wl, fallback, len(devs), failed)
+		}
+	}
+
+	// Roll the nodes still running a bad version back to the fallback workload.
+	for k, devs := range devices {
+		pol := w.breakerPolicy(k.policyName)
+		if pol == nil {
+			continue
+		}
+
+		bvs, err := w.db.FindBadVersions([]persistence.BVFilter{persistence.PolicyBVFilter(k.policyName)})
+		if err != nil {
+			glog.Errorf(cbLogString(fmt.Sprintf("unable to read bad versions for policy %v, error: %v", k.policyName, err)))
+			continue
+		}
+
+		if wl := workloadAtPriority(pol, k.priority); wl == nil || !isBadVersion(bvs, wl.Version) {
+			continue
+		} else if fallback := fallbackWorkload(pol, k.priority, bvs); fallback != nil {
+			w.rollbackDevices(k.policyName, devs, fallback)
+		}
+	}
+}
+
+// Returns the highest priority workload with the given version, or nil if there is none.
+func workloadWithVersion(pol *policy.Policy, version string) *policy.Workload {
+	var found *policy.Workload
+	for ix, wl := range pol.Workloads {
+		if wl.Version == version && (found == nil || wl.Priority.PriorityValue < found.Priority.PriorityValue) {
+			found = &pol.Workloads[ix]
+		}
+	}
+	return found
+}
+
+// Returns the devices in either list, each device once.
+func unionDevices(a []string, b []string) []string {
+	devices := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]bool)
+	for _, d := range append(append([]string{}, a...), b...) {
+		if !seen[d] {
+			seen[d] = true
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// Record that the workload version is bad for the policy, fail any rollout of the version and tell the rest of the
+// agbot about it.
+func (w *AgreementBotWorker) markBadVersion(policyName string, wl *policy.Workload, fallback *policy.Workload, devices int, failed []string) {
+
+	glog.Warningf(cbLogString(fmt.Sprintf("version %v of policy %v failed on %v of %v nodes, rolling back to version %v", wl.Version, policyName, len(failed), devices, fallback.Version)))
+
+	if _, err := w.db.NewBadVersion(policyName, wl.Version, wl.Priority.PriorityValue, fallback.Version, devices, failed); err != nil {
+		glog.Errorf(cbLogString(fmt.Sprintf("unable to mark version %v of policy %v bad, error: %v", wl.Version, policyName, err)))
+		return
+	}
+
+	if r, err := w.db.FindSingleRolloutByPolicyName(policyName); err != nil {
+		glog.Errorf(cbLogString(fmt.Sprintf("unable to read rollout for policy %v, error: %v", policyName, err)))
+	} else if r != nil && r.IsActive() && r.Version == wl.Version {
+		reason := fmt.Sprintf("version %v failed on %v of %v nodes and was rolled back", wl.Version, len(failed), devices)
+		if _, err := w.db.FailRollout(policyName, []string{}, reason); err != nil {
+			glog.Errorf(cbLogString(fmt.Sprintf("unable to fail rollout for policy %v, error: %v", policyName, err)))
+		}
+	}
+
+	w.Messages() <- events.NewBadWorkloadVersionMessage(events.WORKLOAD_VERSION_BAD, policyName, wl.Version, fallback.Version, devices, failed)
+}
+
+// Move the nodes to the fallback workload and cancel their agreements so that new agreements are made with it.
+func (w *AgreementBotWorker) rollbackDevices(policyName string, devices []string, fallback *policy.Workload) {
+
+	for _, deviceId := range devices {
+		if _, err := w.db.UpdatePriority(deviceId, policyName, fallback.Priority.PriorityValue, fallback.Priority.RetryDurationS, fallback.Priority.VerifiedDurationS, ""); err != nil {
+			glog.Errorf(cbLogString(fmt.Sprintf("unable to roll back workload usage for %v with policy %v, error: %v", deviceId, policyName, err)))
+			continue
+		}
+
+		for _, agp := range policy.AllAgreementProtocols() {
+			if ags, err := w.db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), persistence.DevPolAFilter(deviceId, policyName)}, agp); err != nil {
+				glog.Errorf(cbLogString(fmt.Sprintf("unable to read agreements for %v with policy %v, error: %v", deviceId, policyName, err)))
+			} else {
+				for _, ag := range ags {
+					if ag.AgreementTimedout == 0 {
+						glog.V(3).Infof(cbLogString(fmt.Sprintf("rolling back agreement %v with %v to version %v", ag.CurrentAgreementId, deviceId, fallback.Version)))
+						w.TerminateAgreement(&ag, w.consumerPH.Get(agp).GetTerminationCode(TERM_REASON_CANCEL_FORCED_UPGRADE))
+					}
+				}
+			}
+		}
+	}
+}
+
+var cbLogString = func(v interface{}) string {
+	return fmt.Sprintf("AgreementBot Circuit Breaker: %v", v)
+}
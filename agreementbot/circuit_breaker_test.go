@@ -0,0 +1,73 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+func Test_breakerTripped(t *testing.T) {
+	if breakerTripped(10, 5, 0, 3) {
+		t.Errorf("breaker should be off without a ratio")
+	} else if breakerTripped(2, 2, 0.3, 3) {
+		t.Errorf("breaker should not trip with fewer nodes than the minimum")
+	} else if breakerTripped(10, 2, 0.3, 3) {
+		t.Errorf("breaker should not trip below the ratio")
+	} else if !breakerTripped(10, 3, 0.3, 3) {
+		t.Errorf("breaker should trip at the ratio")
+	} else if breakerTripped(0, 0, 0.3, 0) {
+		t.Errorf("breaker should not trip without nodes")
+	}
+}
+
+func Test_fallbackWorkload(t *testing.T) {
+	pol := policy.Policy_Factory("myorg/pol1")
+	pol.Workloads = []policy.Workload{
+		{Version: "3.0.0", Priority: *policy.Workload_Priority_Factory(1, 3, 600, 0)},
+		{Version: "2.0.0", Priority: *policy.Workload_Priority_Factory(2, 3, 600, 0)},
+		{Version: "1.0.0", Priority: *policy.Workload_Priority_Factory(3, 3, 600, 0)},
+	}
+
+	if wl := fallbackWorkload(pol, 1, []persistence.BadVersion{}); wl == nil || wl.Version != "2.0.0" {
+		t.Errorf("expected fallback to version 2.0.0, got %v", wl)
+	} else if wl := fallbackWorkload(pol, 1, []persistence.BadVersion{{Version: "3.0.0"}, {Version: "2.0.0"}}); wl == nil || wl.Version != "1.0.0" {
+		t.Errorf("expected fallback to version 1.0.0, got %v", wl)
+	} else if wl := fallbackWorkload(pol, 3, []persistence.BadVersion{}); wl != nil {
+		t.Errorf("expected no fallback from the lowest priority, got %v", wl)
+	}
+
+	if wl := workloadAtPriority(pol, 2); wl == nil || wl.Version != "2.0.0" {
+		t.Errorf("expected version 2.0.0 at priority 2, got %v", wl)
+	} else if wl := workloadAtPriority(pol, 4); wl != nil {
+		t.Errorf("expected no workload at priority 4, got %v", wl)
+	}
+
+	if wl := workloadWithVersion(pol, "1.0.0"); wl == nil || wl.Priority.PriorityValue != 3 {
+		t.Errorf("expected version 1.0.0 at priority 3, got %v", wl)
+	} else if wl := workloadWithVersion(pol, "4.0.0"); wl != nil {
+		t.Errorf("expected no workload with version 4.0.0, got %v", wl)
+	}
+}
+
+func Test_VersionFailures(t *testing.T) {
+	vf, _ := persistence.NewVersionFailures("myorg/pol1", "2.0.0")
+	vf.Failures = []persistence.DeviceFailure{{DeviceId: "d1", Time: 100}, {DeviceId: "d2", Time: 200}, {DeviceId: "d2", Time: 300}}
+
+	if failed := vf.FailedDevices(0); len(failed) != 2 {
+		t.Errorf("each failed node should be counted once, got %v", failed)
+	} else if failed := vf.FailedDevices(150); len(failed) != 1 || failed[0] != "d2" {
+		t.Errorf("only the failures within the window should be counted, got %v", failed)
+	}
+
+	vf.AddFailure("d3", 250)
+	if len(vf.Failures) != 2 || vf.Failures[0].Time != 300 || vf.Failures[1].DeviceId != "d3" {
+		t.Errorf("the failures before the window should be dropped, got %v", vf.Failures)
+	}
+
+	// A node that failed and was rolled back on its own still counts among the nodes running the version.
+	if devs := unionDevices([]string{"d1", "d2"}, []string{"d2", "d3"}); len(devs) != 3 {
+		t.Errorf("expected 3 nodes, got %v", devs)
+	}
+}
@@ -48,6 +48,7 @@ type ConsumerProtocolHandler interface {
 	GetTerminationCode(reason string) uint
 	GetTerminationReason(code uint) string
 	IsTerminationReasonNodeShutdown(code uint) bool
+	IsTerminationReasonExecutionFailure(code uint) bool
 	GetSendMessage() func(mt interface{}, pay []byte) error
 	RecordConsumerAgreementState(agreementId string, pol *policy.Policy, org string, state string, workerID string) error
 	DeleteMessage(msgId int) error
@@ -76,6 +77,7 @@ type ConsumerProtocolHandler interface {
 	GetServiceBased() bool
 	GetHTTPFactory() *config.HTTPClientFactory
 	SendEventMessage(event events.Message)
+	CancelAgreement(ag persistence.Agreement, reason string, cph ConsumerProtocolHandler)
 }
 
 type BaseConsumerProtocolHandler struct {
@@ -240,6 +242,12 @@ func (b *BaseConsumerProtocolHandler) HandlePolicyChanged(cmd *PolicyChangedComm
 			return func(e persistence.Agreement) bool { return e.AgreementCreationTime != 0 && e.AgreementTimedout == 0 }
 		}
 
+		// The rollout that stages a workload upgrade is worked out once per policy, for the first agreement that needs the upgrade.
+		// The node maintenance windows are read at most once per device.
+		newPol := b.pm.GetPolicy(cmd.Msg.Org(), eventPol.Header.Name)
+		rollouts := make(map[string]*persistence.Rollout)
+		nodes := newNodeWindows(exchange.GetHTTPNodePolicyHandler(cph))
+
 		if agreements, err := b.db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), InProgress()}, cph.Name()); err == nil {
 			for _, ag := range agreements {
 
@@ -252,9 +260,26 @@ func (b *BaseConsumerProtocolHandler) HandlePolicyChanged(cmd *PolicyChangedComm
 					continue
 				} else if err := b.pm.MatchesMine(cmd.Msg.Org(), pol); err != nil {
 					glog.Warningf(BCPHlogstring(b.Name(), fmt.Sprintf("agreement %v has a policy %v that has changed: %v", ag.CurrentAgreementId, pol.Header.Name, err)))
+
+					// A change of the workload versions is a workload upgrade, which has to wait until the rollout releases the
+					// node and the maintenance window opens.
+					if newPol != nil && !newPol.IsSameWorkload(pol) {
+						r, found := rollouts[ag.PolicyName]
+						if !found {
+							r = rolloutUpgrade(b.db, newPol, ag.PolicyName)
+							rollouts[ag.PolicyName] = r
+						}
+						if rolloutHolds(r, &ag) || !upgradeWindowOpen(nodes, newPol, ag.DeviceId, time.Now()) {
+							deferUpgrade(b.db, &ag, TERM_REASON_POLICY_CHANGED)
+							continue
+						}
+					}
 					b.CancelAgreement(ag, TERM_REASON_POLICY_CHANGED, cph)
 				} else {
 					glog.V(5).Infof(BCPHlogstring(b.Name(), fmt.Sprintf("for agreement %v, no policy content differences detected", ag.CurrentAgreementId)))
+
+					// The policy has changed back, so an upgrade that was waiting for the maintenance window is no longer needed.
+					clearUpgrade(b.db, &ag)
 				}
 
 			}
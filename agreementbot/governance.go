@@ -41,6 +41,13 @@ func (w *AgreementBotWorker) GovernAgreements() int {
 	// info from the exchange. The exchange might return no updates, but at least the agbot asked for updates.
 	w.NHManager.ResetUpdateStatus()
 
+	// Roll back workload versions that are failing on too many nodes, then move the staged rollouts of workload upgrades forward.
+	w.governBadVersions()
+	rollouts := w.governRollouts()
+
+	// The node maintenance windows are read at most once per device in each pass.
+	nodes := newNodeWindows(exchange.GetHTTPNodePolicyHandler(w))
+
 	// Look at all agreements across all protocols
 	for _, agp := range policy.AllAgreementProtocols() {
 
@@ -57,6 +64,11 @@ func (w *AgreementBotWorker) GovernAgreements() int {
 
 			for _, ag := range agreements {
 
+				// Start the workload upgrades that have been waiting for a rollout batch or for the maintenance window to open.
+				if ag.UpgradePendingTime != 0 && rolloutReleases(rollouts, &ag) && w.startPendingUpgrade(ag, protocolHandler, nodes) {
+					continue
+				}
+
 				// Govern agreements that have seen a reply from the device
 				if protocolHandler.AlreadyReceivedReply(&ag) {
 
@@ -259,6 +271,8 @@ func (w *AgreementBotWorker) GovernAgreements() int {
 				glog.V(3).Infof(logString(fmt.Sprintf("beginning upgrade of HA member %v in group %v.", wlu.DeviceId, wlu.HAPartners)))
 				if ag, err := w.db.FindSingleAgreementByAgreementIdAllProtocols(wlu.CurrentAgreementId, policy.AllAgreementProtocols(), unarchived); err != nil {
 					glog.Errorf(logString(fmt.Sprintf("unable to read agreement %v from database, error: %v", wlu.CurrentAgreementId, err)))
+				} else if ag != nil && !upgradeWindowOpen(nodes, upgradePolicy(w.pm, ag), ag.DeviceId, time.Now()) {
+					glog.V(3).Infof(logString(fmt.Sprintf("waiting for the maintenance window to upgrade HA member %v in group %v.", wlu.DeviceId, wlu.HAPartners)))
 				} else {
 					// Make sure the workload usage record is gone,this will allow the device to pick up the newest workload.
 					if err := w.db.DeleteWorkloadUsage(wlu.DeviceId, wlu.PolicyName); err != nil {
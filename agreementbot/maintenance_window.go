@@ -0,0 +1,198 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"sync"
+	"time"
+)
+
+// Workload upgrades are deployed to a node only when both the maintenance window in the upgrade policy time of the
+// service version being upgraded to and the maintenance window the node sets in its node policy are open. Until then,
+// the agreement that needs to be cancelled for the upgrade is marked as pending and governance starts the upgrade once
+// the windows open. If the policy changes back before that, the pending upgrade is cleared.
+
+// The devices whose node policy is known to set no maintenance window. Their node policy is not read again for an
+// upgrade until the exchange reports that it has changed, so that most upgrades do not have to call the exchange.
+var windowlessNodes = struct {
+	sync.Mutex
+	devices map[string]bool
+}{devices: make(map[string]bool)}
+
+// Forget that the device sets no maintenance window, because its node policy has changed.
+func forgetNodeWindow(deviceId string) {
+	windowlessNodes.Lock()
+	defer windowlessNodes.Unlock()
+	delete(windowlessNodes.devices, deviceId)
+}
+
+func isWindowlessNode(deviceId string) bool {
+	windowlessNodes.Lock()
+	defer windowlessNodes.Unlock()
+	return windowlessNodes.devices[deviceId]
+}
+
+func setWindowlessNode(deviceId string) {
+	windowlessNodes.Lock()
+	defer windowlessNodes.Unlock()
+	windowlessNodes.devices[deviceId] = true
+}
+
+// The maintenance windows that the nodes set in their node policy. A governance pass or a batch of agreements uses one
+// of these so that the node policy of each device is read at most once, no matter how many agreements the device has.
+// It is only used by one thread at a time so it does not need to be locked.
+type nodeWindows struct {
+	nodePolicyHandler exchange.NodePolicyHandler
+	windows           map[string]*nodeWindow
+}
+
+type nodeWindow struct {
+	window *policy.MaintenanceWindow
+	err    error
+}
+
+func newNodeWindows(nodePolicyHandler exchange.NodePolicyHandler) *nodeWindows {
+	return &nodeWindows{
+		nodePolicyHandler: nodePolicyHandler,
+		windows:           make(map[string]*nodeWindow),
+	}
+}
+
+// Returns the maintenance window that the device sets in its node policy, or nil if it does not set one. An error is
+// returned if the node policy cannot be read. A window that cannot be interpreted is logged and ignored.
+func (n *nodeWindows) get(deviceId string) (*policy.MaintenanceWindow, error) {
+	if nw, ok := n.windows[deviceId]; ok {
+		return nw.window, nw.err
+	} else if isWindowlessNode(deviceId) {
+		return nil, nil
+	}
+
+	nw := new(nodeWindow)
+	if nodePolicy, err := n.nodePolicyHandler(deviceId); err != nil {
+		nw.err = err
+	} else if nodePolicy != nil {
+		if nw.window, err = policy.NodeMaintenanceWindow(nodePolicy.Properties); err != nil {
+			glog.Errorf(mwLogString(fmt.Sprintf("unable to evaluate maintenance window in node policy for %v, error: %v", deviceId, err)))
+			nw.window = nil
+		}
+	}
+
+	if nw.err == nil && nw.window == nil {
+		setWindowlessNode(deviceId)
+	}
+	n.windows[deviceId] = nw
+	return nw.window, nw.err
+}
+
+// Returns true if a workload upgrade using the input consumer policy can be deployed to the device at the given time.
+// The upgrade deploys the highest priority workload of the policy, so the window of that workload applies. The node
+// policy is only read when the window of the policy is open. If the node policy cannot be read, the upgrade is
+// deferred so that it will be tried again later. Windows that cannot be interpreted are logged and ignored so that they
+// never block an upgrade forever.
+func upgradeWindowOpen(nodes *nodeWindows, pol *policy.Policy, deviceId string, now time.Time) bool {
+
+	if pol != nil && len(pol.Workloads) != 0 {
+		wl := pol.NextHighestPriorityWorkload(0, 0, 0)
+		if window, err := wl.UpgradeWindow(); err != nil {
+			glog.Errorf(mwLogString(fmt.Sprintf("unable to parse upgrade time %v of version %v in policy %v, error: %v", wl.UpgradeTime, wl.Version, pol.Header.Name, err)))
+		} else if open, err := window.IsOpen(now); err != nil {
+			glog.Errorf(mwLogString(fmt.Sprintf("unable to evaluate maintenance window %v of version %v in policy %v, error: %v", window, wl.Version, pol.Header.Name, err)))
+		} else if !open {
+			glog.V(5).Infof(mwLogString(fmt.Sprintf("maintenance window of version %v in policy %v is closed", wl.Version, pol.Header.Name)))
+			return false
+		}
+	}
+
+	if nodeWindow, err := nodes.get(deviceId); err != nil {
+		glog.Errorf(mwLogString(fmt.Sprintf("unable to read node policy for %v, deferring upgrade, error: %v", deviceId, err)))
+		return false
+	} else if nodeWindow == nil {
+		return true
+	} else if open, err := nodeWindow.IsOpen(now); err != nil {
+		glog.Errorf(mwLogString(fmt.Sprintf("unable to evaluate maintenance window %v in node policy for %v, error: %v", nodeWindow, deviceId, err)))
+	} else if !open {
+		glog.V(5).Infof(mwLogString(fmt.Sprintf("maintenance window in node policy for %v is closed", deviceId)))
+		return false
+	}
+
+	return true
+}
+
+// Returns the consumer policy that an upgrade of the agreement would use, which is the current version of the policy the
+// agreement was made with. If that policy is no longer known, the policy recorded in the agreement is returned.
+func upgradePolicy(pm *policy.PolicyManager, ag *persistence.Agreement) *policy.Policy {
+	if pol, err := policy.DemarshalPolicy(ag.Policy); err != nil {
+		glog.Errorf(mwLogString(fmt.Sprintf("unable to demarshal policy for agreement %v, error %v", ag.CurrentAgreementId, err)))
+		return nil
+	} else if current := pm.GetPolicy(ag.Org, pol.Header.Name); current != nil {
+		return current
+	} else {
+		return pol
+	}
+}
+
+// Record that the workload upgrade for this agreement is waiting for the maintenance window or for a rollout. The reason is the termination
+// reason that will be used to cancel the agreement once the window opens.
+func deferUpgrade(db persistence.AgbotDatabase, ag *persistence.Agreement, reason string) {
+	if ag.UpgradePendingTime != 0 {
+		return
+	} else if _, err := db.AgreementUpgradePending(ag.CurrentAgreementId, ag.AgreementProtocol, reason); err != nil {
+		glog.Errorf(mwLogString(fmt.Sprintf("unable to mark agreement %v pending upgrade, error: %v", ag.CurrentAgreementId, err)))
+	} else {
+		glog.V(3).Infof(mwLogString(fmt.Sprintf("deferred upgrade of agreement %v with %v", ag.CurrentAgreementId, ag.DeviceId)))
+	}
+}
+
+// Clear the pending workload upgrade of this agreement because the upgrade is no longer needed.
+func clearUpgrade(db persistence.AgbotDatabase, ag *persistence.Agreement) {
+	if ag.UpgradePendingTime == 0 {
+		return
+	} else if _, err := db.AgreementUpgradeCleared(ag.CurrentAgreementId, ag.AgreementProtocol); err != nil {
+		glog.Errorf(mwLogString(fmt.Sprintf("unable to clear pending upgrade of agreement %v, error: %v", ag.CurrentAgreementId, err)))
+	} else {
+		glog.V(3).Infof(mwLogString(fmt.Sprintf("cleared pending upgrade of agreement %v with %v", ag.CurrentAgreementId, ag.DeviceId)))
+	}
+}
+
+// Start the workload upgrade that was deferred for this agreement if the maintenance window is now open. Returns true
+// if the upgrade was started. An upgrade that was deferred because the policy changed is checked against the current
+// policy first. If the policy has changed back, the upgrade is cleared. If the workload has changed back but the
+// policy still differs in other ways, the agreement is cancelled right away, as it would have been without the
+// workload change.
+func (w *AgreementBotWorker) startPendingUpgrade(ag persistence.Agreement, cph ConsumerProtocolHandler, nodes *nodeWindows) bool {
+	if ag.UpgradePendingReason == TERM_REASON_POLICY_CHANGED {
+		if pol, err := policy.DemarshalPolicy(ag.Policy); err != nil {
+			glog.Errorf(mwLogString(fmt.Sprintf("unable to demarshal policy for agreement %v, error %v", ag.CurrentAgreementId, err)))
+		} else if current := w.pm.GetPolicy(ag.Org, pol.Header.Name); current != nil {
+			if err := w.pm.MatchesMine(ag.Org, pol); err == nil {
+				glog.V(3).Infof(mwLogString(fmt.Sprintf("policy %v has changed back, upgrade of agreement %v is no longer needed", pol.Header.Name, ag.CurrentAgreementId)))
+				clearUpgrade(w.db, &ag)
+				return false
+			} else if current.IsSameWorkload(pol) {
+				glog.V(3).Infof(mwLogString(fmt.Sprintf("workload of policy %v has changed back, cancelling agreement %v for the other policy changes", pol.Header.Name, ag.CurrentAgreementId)))
+				cph.CancelAgreement(ag, ag.UpgradePendingReason, cph)
+				return true
+			}
+		}
+	}
+
+	if !upgradeWindowOpen(nodes, upgradePolicy(w.pm, &ag), ag.DeviceId, time.Now()) {
+		return false
+	}
+
+	glog.V(3).Infof(mwLogString(fmt.Sprintf("maintenance window is open, starting deferred upgrade of agreement %v with %v", ag.CurrentAgreementId, ag.DeviceId)))
+	if ag.UpgradePendingReason == TERM_REASON_CANCEL_FORCED_UPGRADE {
+		upgradeWork := NewHandleWorkloadUpgrade(ag.CurrentAgreementId, ag.AgreementProtocol, ag.DeviceId, ag.PolicyName)
+		cph.WorkQueue().InboundHigh() <- &upgradeWork
+	} else {
+		cph.CancelAgreement(ag, ag.UpgradePendingReason, cph)
+	}
+	return true
+}
+
+var mwLogString = func(v interface{}) string {
+	return fmt.Sprintf("AgreementBot Maintenance Window: %v", v)
+}
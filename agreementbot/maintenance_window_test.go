@@ -0,0 +1,123 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+	"time"
+)
+
+func Test_upgradeWindowOpen(t *testing.T) {
+	// Saturday 2021-06-05 at 03:00 UTC, and a day later.
+	saturday := time.Date(2021, 6, 5, 3, 0, 0, 0, time.UTC)
+	sunday := saturday.Add(24 * time.Hour)
+
+	// Upgrades to version 2.0.0 can only be deployed on Saturday mornings, the rollback version has no window.
+	pol := policy.Policy_Factory("mypolicy")
+	wl1 := policy.Workload_Factory("mysvc", "myorg", "2.0.0", "amd64")
+	wl1.Priority = *policy.Workload_Priority_Factory(1, 3, 600, 0)
+	wl1.UpgradeTime = "schedule=0 2 * * 6; duration=4h"
+	pol.Add_Workload(wl1)
+	wl2 := policy.Workload_Factory("mysvc", "myorg", "1.0.0", "amd64")
+	wl2.Priority = *policy.Workload_Priority_Factory(2, 3, 600, 0)
+	pol.Add_Workload(wl2)
+
+	// Only the window of the highest priority version applies.
+	rollbackPol := policy.Policy_Factory("mypolicy")
+	wl1.UpgradeTime = ""
+	rollbackPol.Add_Workload(wl1)
+	wl2.UpgradeTime = "schedule=0 2 * * 6; duration=4h"
+	rollbackPol.Add_Workload(wl2)
+
+	noNodePolicy := newNodeWindows(func(deviceId string) (*exchange.ExchangePolicy, error) {
+		return nil, nil
+	})
+	defer forgetNodeWindow("myorg/device1")
+
+	if !upgradeWindowOpen(noNodePolicy, nil, "myorg/device1", sunday) {
+		t.Errorf("upgrades should not be restricted without any windows")
+	} else if !upgradeWindowOpen(noNodePolicy, pol, "myorg/device1", saturday) {
+		t.Errorf("policy window should be open")
+	} else if upgradeWindowOpen(noNodePolicy, pol, "myorg/device1", sunday) {
+		t.Errorf("policy window should be closed")
+	} else if !upgradeWindowOpen(noNodePolicy, rollbackPol, "myorg/device1", sunday) {
+		t.Errorf("window of a lower priority version should not apply")
+	}
+
+	// The node only allows upgrades on Sundays.
+	forgetNodeWindow("myorg/device1")
+	nodePolicy := newNodeWindows(func(deviceId string) (*exchange.ExchangePolicy, error) {
+		ep := new(exchange.ExchangePolicy)
+		ep.Properties.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_MAINT_WINDOW, "schedule=0 0 * * 0; duration=24h"), false)
+		return ep, nil
+	})
+
+	if upgradeWindowOpen(nodePolicy, pol, "myorg/device1", saturday) {
+		t.Errorf("node window should be closed")
+	} else if !upgradeWindowOpen(nodePolicy, nil, "myorg/device1", sunday) {
+		t.Errorf("node window should be open")
+	}
+
+	// Upgrades are deferred when the node policy cannot be read.
+	forgetNodeWindow("myorg/device1")
+	failedNodePolicy := newNodeWindows(func(deviceId string) (*exchange.ExchangePolicy, error) {
+		return nil, errors.New("exchange unavailable")
+	})
+
+	if upgradeWindowOpen(failedNodePolicy, nil, "myorg/device1", sunday) {
+		t.Errorf("upgrade should be deferred when the node policy is not available")
+	}
+}
+
+func Test_nodeWindows(t *testing.T) {
+	reads := make(map[string]int)
+	window := "schedule=0 0 * * 0; duration=24h"
+	handler := func(deviceId string) (*exchange.ExchangePolicy, error) {
+		reads[deviceId] += 1
+		if deviceId == "myorg/failed" {
+			return nil, errors.New("exchange unavailable")
+		}
+		ep := new(exchange.ExchangePolicy)
+		if deviceId == "myorg/window" {
+			ep.Properties.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_MAINT_WINDOW, window), false)
+		}
+		return ep, nil
+	}
+	defer forgetNodeWindow("myorg/windowless")
+
+	// The node policy of each device is read once in a pass.
+	nodes := newNodeWindows(handler)
+	for i := 0; i < 3; i++ {
+		if w, err := nodes.get("myorg/window"); err != nil || w == nil {
+			t.Errorf("expected a window for myorg/window, got %v, error %v", w, err)
+		} else if w, err := nodes.get("myorg/windowless"); err != nil || w != nil {
+			t.Errorf("expected no window for myorg/windowless, got %v, error %v", w, err)
+		} else if _, err := nodes.get("myorg/failed"); err == nil {
+			t.Errorf("expected an error for myorg/failed")
+		}
+	}
+	if reads["myorg/window"] != 1 || reads["myorg/windowless"] != 1 || reads["myorg/failed"] != 1 {
+		t.Errorf("expected each node policy to be read once, read %v", reads)
+	}
+
+	// The next pass reads the node policies again, except for the device that is known to set no window.
+	nodes = newNodeWindows(handler)
+	nodes.get("myorg/window")
+	nodes.get("myorg/windowless")
+	nodes.get("myorg/failed")
+	if reads["myorg/window"] != 2 || reads["myorg/windowless"] != 1 || reads["myorg/failed"] != 2 {
+		t.Errorf("expected the node policy of myorg/windowless to be skipped, read %v", reads)
+	}
+
+	// Once the node policy changes, it is read again.
+	forgetNodeWindow("myorg/windowless")
+	nodes = newNodeWindows(handler)
+	nodes.get("myorg/windowless")
+	if reads["myorg/windowless"] != 2 {
+		t.Errorf("expected the changed node policy of myorg/windowless to be read, read %v", reads)
+	}
+}
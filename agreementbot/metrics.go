@@ -0,0 +1,223 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Prometheus metrics exposed by the agbot on its /metrics API. Counters and histograms are updated by the workers as
+// events happen. The gauges (agreement counts, work queue depth and partition ownership) are read from the database
+// and the consumer protocol handlers by the AgbotCollector when the metrics are scraped. Counting the agreements reads
+// all of them, so the gauges read from the database are reused for DB_METRICS_TTL_S.
+
+const (
+	METRIC_LABEL_POLICY    = "policy"
+	METRIC_LABEL_PROTOCOL  = "protocol"
+	METRIC_LABEL_STATE     = "state"
+	METRIC_LABEL_PARTITION = "partition"
+	METRIC_LABEL_OWNER     = "owner"
+	METRIC_LABEL_PRIORITY  = "priority"
+)
+
+// How long the metrics read from the database are reused before they are read again.
+const DB_METRICS_TTL_S = 60
+
+var (
+	proposalLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "agbot_proposal_latency_seconds",
+		Help:    "Time from sending an agreement proposal to receiving the node's acceptance.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{METRIC_LABEL_POLICY})
+
+	proposalRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "agbot_proposal_rejections_total",
+		Help: "Number of agreement proposals rejected by nodes.",
+	}, []string{METRIC_LABEL_POLICY})
+
+	nodeSearchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "agbot_node_search_scan_duration_seconds",
+		Help:    "Time taken by a complete node search scan across all served policies and patterns.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+
+	exchangeChangesLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "agbot_exchange_changes_latency_seconds",
+		Help:    "Latency of calls to the exchange /changes API.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	exchangeChangesErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agbot_exchange_changes_errors_total",
+		Help: "Number of failed calls to the exchange /changes API.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(proposalLatency, proposalRejections, nodeSearchDuration, exchangeChangesLatency, exchangeChangesErrors)
+}
+
+// Record the time between the proposal being made and the node accepting it.
+func observeProposalAccepted(ag *persistence.Agreement) {
+	if ag.AgreementInceptionTime != 0 {
+		latency := time.Since(time.Unix(int64(ag.AgreementInceptionTime), 0))
+		proposalLatency.WithLabelValues(ag.PolicyName).Observe(latency.Seconds())
+	}
+}
+
+// Count a proposal that was rejected by the node.
+func observeProposalRejected(ag *persistence.Agreement) {
+	proposalRejections.WithLabelValues(ag.PolicyName).Inc()
+}
+
+// Record the outcome of a call to the exchange /changes API.
+func observeExchangeChanges(d time.Duration, err error) {
+	exchangeChangesLatency.Observe(d.Seconds())
+	if err != nil {
+		exchangeChangesErrors.Inc()
+	}
+}
+
+// The collector for the metrics that are computed from the agbot's state at scrape time.
+type AgbotCollector struct {
+	db              persistence.AgbotDatabase
+	consumerPH      *ConsumerPHMgr
+	dbLock          sync.Mutex
+	dbMetrics       []prometheus.Metric // the metrics read from the database
+	dbTime          time.Time           // when they were read, zero when they have to be read again
+	agreementsDesc  *prometheus.Desc
+	byProtocolDesc  *prometheus.Desc
+	workQueueDesc   *prometheus.Desc
+	partitionDesc   *prometheus.Desc
+	partitionHBDesc *prometheus.Desc
+}
+
+func NewAgbotCollector(db persistence.AgbotDatabase, consumerPH *ConsumerPHMgr) *AgbotCollector {
+	return &AgbotCollector{
+		db:         db,
+		consumerPH: consumerPH,
+		agreementsDesc: prometheus.NewDesc(
+			"agbot_agreements",
+			"Number of agreements in each database partition, by state (active or archived).",
+			[]string{METRIC_LABEL_PARTITION, METRIC_LABEL_STATE}, nil),
+		byProtocolDesc: prometheus.NewDesc(
+			"agbot_active_agreements",
+			"Number of active agreements in the partitions owned by this agbot, by agreement protocol and state (pending or finalized).",
+			[]string{METRIC_LABEL_PROTOCOL, METRIC_LABEL_STATE}, nil),
+		workQueueDesc: prometheus.NewDesc(
+			"agbot_work_queue_depth",
+			"Number of work items waiting in the agreement protocol work queue, by priority.",
+			[]string{METRIC_LABEL_PROTOCOL, METRIC_LABEL_PRIORITY}, nil),
+		partitionDesc: prometheus.NewDesc(
+			"agbot_partition_owner",
+			"Database partition ownership, always 1. The owner label is empty when the partition is not owned.",
+			[]string{METRIC_LABEL_PARTITION, METRIC_LABEL_OWNER}, nil),
+		partitionHBDesc: prometheus.NewDesc(
+			"agbot_partition_heartbeat_timestamp_seconds",
+			"Time of the last heartbeat on the partitions owned by this agbot.",
+			nil, nil),
+	}
+}
+
+func (c *AgbotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.agreementsDesc
+	ch <- c.byProtocolDesc
+	ch <- c.workQueueDesc
+	ch <- c.partitionDesc
+	ch <- c.partitionHBDesc
+}
+
+func (c *AgbotCollector) Collect(ch chan<- prometheus.Metric) {
+
+	for _, m := range c.databaseMetrics(time.Now()) {
+		ch <- m
+	}
+
+	if hb, err := c.db.GetHeartbeat(); err != nil {
+		glog.Errorf(metricsLogString(fmt.Sprintf("error getting partition heartbeat, error: %v", err)))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.partitionHBDesc, prometheus.GaugeValue, float64(hb))
+	}
+
+	// Work queue depth for each agreement protocol in use.
+	for _, protocol := range c.consumerPH.GetAll() {
+		if cph := c.consumerPH.Get(protocol); cph != nil && cph.WorkQueue() != nil {
+			wq := cph.WorkQueue()
+			ch <- prometheus.MustNewConstMetric(c.workQueueDesc, prometheus.GaugeValue, float64(wq.HighPriorityDepth()), protocol, "high")
+			ch <- prometheus.MustNewConstMetric(c.workQueueDesc, prometheus.GaugeValue, float64(wq.LowPriorityDepth()), protocol, "low")
+		}
+	}
+}
+
+// Returns the agreement counts and the partition owners. They are read from the database when the ones read before
+// are older than DB_METRICS_TTL_S, or when reading them failed.
+func (c *AgbotCollector) databaseMetrics(now time.Time) []prometheus.Metric {
+	c.dbLock.Lock()
+	defer c.dbLock.Unlock()
+
+	if !c.dbTime.IsZero() && now.Sub(c.dbTime) < DB_METRICS_TTL_S*time.Second {
+		return c.dbMetrics
+	}
+
+	metrics := make([]prometheus.Metric, 0)
+	complete := true
+
+	// Agreement counts and ownership for every partition in the database.
+	if partitions, err := c.db.FindPartitions(); err != nil {
+		glog.Errorf(metricsLogString(fmt.Sprintf("error finding all partitions, error: %v", err)))
+		complete = false
+	} else {
+		for _, p := range partitions {
+			if owner, err := c.db.GetPartitionOwner(p); err != nil {
+				glog.Errorf(metricsLogString(fmt.Sprintf("error finding partition %v owner, error: %v", p, err)))
+				complete = false
+			} else {
+				if owner == persistence.NO_PARTITION_OWNER {
+					owner = ""
+				}
+				metrics = append(metrics, prometheus.MustNewConstMetric(c.partitionDesc, prometheus.GaugeValue, 1, p, owner))
+			}
+
+			if active, archived, err := c.db.GetAgreementCount(p); err != nil {
+				glog.Errorf(metricsLogString(fmt.Sprintf("error finding agreement count in partition %v, error: %v", p, err)))
+				complete = false
+			} else {
+				metrics = append(metrics, prometheus.MustNewConstMetric(c.agreementsDesc, prometheus.GaugeValue, float64(active), p, "active"))
+				metrics = append(metrics, prometheus.MustNewConstMetric(c.agreementsDesc, prometheus.GaugeValue, float64(archived), p, "archived"))
+			}
+		}
+	}
+
+	// Active agreements for each agreement protocol in use.
+	for _, protocol := range c.consumerPH.GetAll() {
+		if agreements, err := c.db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter()}, protocol); err != nil {
+			glog.Errorf(metricsLogString(fmt.Sprintf("error finding active %v agreements, error: %v", protocol, err)))
+			complete = false
+		} else {
+			pending, finalized := 0, 0
+			for _, ag := range agreements {
+				if ag.AgreementFinalizedTime != 0 {
+					finalized += 1
+				} else {
+					pending += 1
+				}
+			}
+			metrics = append(metrics, prometheus.MustNewConstMetric(c.byProtocolDesc, prometheus.GaugeValue, float64(pending), protocol, "pending"))
+			metrics = append(metrics, prometheus.MustNewConstMetric(c.byProtocolDesc, prometheus.GaugeValue, float64(finalized), protocol, "finalized"))
+		}
+	}
+
+	c.dbMetrics = metrics
+	c.dbTime = time.Time{}
+	if complete {
+		c.dbTime = now
+	}
+	return metrics
+}
+
+var metricsLogString = func(v interface{}) string {
+	return fmt.Sprintf("AgreementBot Metrics: %v", v)
+}
@@ -0,0 +1,112 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AgbotCollector_agreements_and_partitions(t *testing.T) {
+	runDatabaseTest(t, func(t *testing.T, p testDatabaseProvider, db persistence.AgbotDatabase) {
+		agId := fmt.Sprintf("agreement%v", time.Now().UnixNano())
+		if err := db.AgreementAttempt(agId, "myorg", "myorg/device1", "device", "myorg/pol1", "", "", "", policy.BasicProtocol, "", []string{"myorg/svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement, error: %v", err)
+		}
+
+		c := NewAgbotCollector(db, NewConsumerPHMgr())
+
+		partitions, err := db.FindPartitions()
+		if err != nil {
+			t.Fatalf("unable to find partitions, error: %v", err)
+		}
+
+		// One ownership and two agreement count metrics for each partition, plus the heartbeat.
+		if n := testutil.CollectAndCount(c); n != len(partitions)*3+1 {
+			t.Errorf("expected %v metrics, got %v", len(partitions)*3+1, n)
+		}
+
+		var active int64
+		for _, part := range partitions {
+			if a, _, err := db.GetAgreementCount(part); err != nil {
+				t.Fatalf("unable to get agreement count, error: %v", err)
+			} else {
+				active += a
+			}
+		}
+		if active == 0 {
+			t.Errorf("expected the agreement to be counted as active")
+		}
+
+		// The metrics read from the database are reused until they are too old.
+		now := time.Now()
+		first := c.databaseMetrics(now)
+		if err := db.AgreementAttempt(agId+"b", "myorg", "myorg/device2", "device", "myorg/pol1", "", "", "", policy.BasicProtocol, "", []string{"myorg/svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement, error: %v", err)
+		}
+		if again := c.databaseMetrics(now.Add(time.Second)); len(again) != len(first) || again[0] != first[0] {
+			t.Errorf("expected the metrics to be reused")
+		} else if later := c.databaseMetrics(now.Add((DB_METRICS_TTL_S + 1) * time.Second)); len(later) != len(first) || later[0] == first[0] {
+			t.Errorf("expected the metrics to be read again")
+		}
+
+		if !p.partitioned {
+			return
+		}
+
+		// The partition of an agbot that quiesced is not owned until another agbot takes it over.
+		db2 := p.open()
+		if err := db2.Initialize(p.cfg); err != nil {
+			t.Fatalf("unable to initialize second database, error: %v", err)
+		}
+		defer db2.Close()
+		if err := db.QuiescePartition(); err != nil {
+			t.Fatalf("unable to quiesce partition, error: %v", err)
+		}
+
+		expected := `
+# HELP agbot_partition_owner Database partition ownership, always 1. The owner label is empty when the partition is not owned.
+# TYPE agbot_partition_owner gauge
+`
+		parts, err := db2.FindPartitions()
+		if err != nil {
+			t.Fatalf("unable to find partitions, error: %v", err)
+		}
+		for _, part := range parts {
+			owner := ""
+			if part != partitions[len(partitions)-1] {
+				if owner, err = db2.GetPartitionOwner(part); err != nil {
+					t.Fatalf("unable to find partition owner, error: %v", err)
+				}
+			}
+			expected += fmt.Sprintf("agbot_partition_owner{owner=%q,partition=%q} 1\n", owner, part)
+		}
+		if err := testutil.CollectAndCompare(NewAgbotCollector(db2, NewConsumerPHMgr()), strings.NewReader(expected), "agbot_partition_owner"); err != nil {
+			t.Errorf("unexpected partition owner metrics, error: %v", err)
+		}
+	})
+}
+
+func Test_observeProposal(t *testing.T) {
+	ag := &persistence.Agreement{PolicyName: "myorg/metricspol", AgreementInceptionTime: uint64(time.Now().Unix() - 5)}
+
+	observeProposalAccepted(ag)
+	observeProposalRejected(ag)
+	observeProposalRejected(ag)
+
+	if n := testutil.ToFloat64(proposalRejections.WithLabelValues("myorg/metricspol")); n != 2 {
+		t.Errorf("expected 2 rejections, got %v", n)
+	}
+
+	before := testutil.ToFloat64(exchangeChangesErrors)
+	observeExchangeChanges(time.Millisecond, nil)
+	observeExchangeChanges(time.Millisecond, fmt.Errorf("exchange unavailable"))
+	if n := testutil.ToFloat64(exchangeChangesErrors) - before; n != 1 {
+		t.Errorf("expected 1 exchange changes error, got %v", n)
+	}
+}
@@ -146,6 +146,8 @@ func (n *NodeSearch) Scan() {
 // main thread so that the main thread can continue handling inflight agreements and changes.
 func (n *NodeSearch) findAndMakeAgreements() {
 
+	scanStart := time.Now()
+
 	if err := n.db.DumpSearchSessions(); err != nil {
 		glog.Errorf(AWlogString(fmt.Sprintf("unable to dump search session records, error: %v", err)))
 	}
@@ -203,6 +205,8 @@ func (n *NodeSearch) findAndMakeAgreements() {
 		glog.Errorf(AWlogString(fmt.Sprintf("unable to dump search session records, error: %v", err)))
 	}
 
+	nodeSearchDuration.Observe(time.Since(scanStart).Seconds())
+
 	n.searchThread <- true
 
 }
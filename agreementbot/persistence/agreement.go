@@ -56,6 +56,8 @@ type Agreement struct {
 	NHCheckAgreementStatus         int      `json:"check_agreement_status"`            // How often to check that the node agreement entry still exists in the exchange (in seconds)
 	Pattern                        string   `json:"pattern"`                           // The pattern used to make the agreement, used for pattern case only
 	ServiceId                      []string `json:"service_id"`                        // All the service ids whose policy is used to make the agreement, used for policy case only
+	UpgradePendingTime             uint64   `json:"upgrade_pending_time"`              // The time when a workload upgrade was deferred until the maintenance window opens
+	UpgradePendingReason           string   `json:"upgrade_pending_reason"`            // The termination reason to use when the deferred upgrade is started
 }
 
 func (a Agreement) String() string {
@@ -98,7 +100,9 @@ func (a Agreement) String() string {
 		"NHMissingHBInterval: %v, "+
 		"NHCheckAgreementStatus: %v, "+
 		"Pattern: %v, "+
-		"ServiceId: %v",
+		"ServiceId: %v, "+
+		"UpgradePendingTime: %v, "+
+		"UpgradePendingReason: %v",
 		a.Archived, a.CurrentAgreementId, a.Org, a.AgreementProtocol, a.AgreementProtocolVersion, a.DeviceId, a.DeviceType, a.HAPartners,
 		a.AgreementInceptionTime, a.AgreementCreationTime, a.AgreementFinalizedTime,
 		a.AgreementTimedout, a.ProposalSig, a.ProposalHash, a.ConsumerProposalSig, a.PolicyName, a.CounterPartyAddress,
@@ -106,7 +110,7 @@ func (a Agreement) String() string {
 		a.DisableDataVerificationChecks, a.DataVerifiedTime, a.DataNotificationSent,
 		a.MeteringTokens, a.MeteringPerTimeUnit, a.MeteringNotificationInterval, a.MeteringNotificationSent, a.MeteringNotificationMsgs,
 		a.TerminatedReason, a.TerminatedDescription, a.BlockchainType, a.BlockchainName, a.BlockchainOrg, a.BCUpdateAckTime,
-		a.NHMissingHBInterval, a.NHCheckAgreementStatus, a.Pattern, a.ServiceId)
+		a.NHMissingHBInterval, a.NHCheckAgreementStatus, a.Pattern, a.ServiceId, a.UpgradePendingTime, a.UpgradePendingReason)
 }
 
 // Factory method for agreement w/out persistence safety.
@@ -270,6 +274,30 @@ func AgreementTimedout(db AgbotDatabase, agreementid string, protocol string) (*
 	}
 }
 
+func AgreementUpgradePending(db AgbotDatabase, agreementid string, protocol string, reason string) (*Agreement, error) {
+	if agreement, err := db.SingleAgreementUpdate(agreementid, protocol, func(a Agreement) *Agreement {
+		a.UpgradePendingTime = uint64(time.Now().Unix())
+		a.UpgradePendingReason = reason
+		return &a
+	}); err != nil {
+		return nil, err
+	} else {
+		return agreement, nil
+	}
+}
+
+func AgreementUpgradeCleared(db AgbotDatabase, agreementid string, protocol string) (*Agreement, error) {
+	if agreement, err := db.SingleAgreementUpdate(agreementid, protocol, func(a Agreement) *Agreement {
+		a.UpgradePendingTime = 0
+		a.UpgradePendingReason = ""
+		return &a
+	}); err != nil {
+		return nil, err
+	} else {
+		return agreement, nil
+	}
+}
+
 func DataVerified(db AgbotDatabase, agreementid string, protocol string) (*Agreement, error) {
 	if agreement, err := db.SingleAgreementUpdate(agreementid, protocol, func(a Agreement) *Agreement {
 		a.DataVerifiedTime = uint64(time.Now().Unix())
@@ -432,6 +460,10 @@ func ValidateStateTransition(mod *Agreement, update *Agreement) {
 	if mod.BCUpdateAckTime == 0 { // 1 transition from zero to non-zero
 		mod.BCUpdateAckTime = update.BCUpdateAckTime
 	}
+	if mod.UpgradePendingTime == 0 || update.UpgradePendingTime == 0 { // set when an upgrade is deferred, reset when it is no longer needed
+		mod.UpgradePendingTime = update.UpgradePendingTime
+		mod.UpgradePendingReason = update.UpgradePendingReason
+	}
 }
 
 // Filters used by the caller to control what comes back from the database.
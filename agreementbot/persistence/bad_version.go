@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A bad version is a workload version of a policy that failed on too many of the nodes running it. The agbot rolls
+// the nodes back to the previous priority workload in the policy and does not deploy the bad version again. Bad
+// versions apply to all of the agbots sharing the database, so they are not partitioned.
+
+type BadVersion struct {
+	PolicyName      string   `json:"policy_name"`      // the name of the policy containing the workload
+	Version         string   `json:"version"`          // the bad workload version
+	Priority        int      `json:"priority"`         // the priority of the bad workload version in the policy
+	FallbackVersion string   `json:"fallback_version"` // the workload version that the nodes were rolled back to
+	Devices         int      `json:"devices"`          // the number of nodes running the version when it was marked bad
+	FailedDevices   []string `json:"failed_devices"`   // the nodes on which the version failed
+	MarkedTime      uint64   `json:"marked_time"`      // time when the version was marked bad
+}
+
+func (b BadVersion) String() string {
+	return fmt.Sprintf("PolicyName: %v, "+
+		"Version: %v, "+
+		"Priority: %v, "+
+		"FallbackVersion: %v, "+
+		"Devices: %v, "+
+		"FailedDevices: %v, "+
+		"MarkedTime: %v",
+		b.PolicyName, b.Version, b.Priority, b.FallbackVersion, b.Devices, b.FailedDevices, b.MarkedTime)
+}
+
+// Returns the ratio of nodes on which the version failed.
+func (b BadVersion) FailureRatio() float64 {
+	if b.Devices == 0 {
+		return 0
+	}
+	return float64(len(b.FailedDevices)) / float64(b.Devices)
+}
+
+// factory method for bad versions w/out persistence safety:
+func NewBadVersion(policyName string, version string, priority int, fallbackVersion string, devices int, failedDevices []string) (*BadVersion, error) {
+	if policyName == "" || version == "" {
+		return nil, errors.New("Illegal input: one of policyName or version is empty")
+	} else {
+		return &BadVersion{
+			PolicyName:      policyName,
+			Version:         version,
+			Priority:        priority,
+			FallbackVersion: fallbackVersion,
+			Devices:         devices,
+			FailedDevices:   failedDevices,
+			MarkedTime:      uint64(time.Now().Unix()),
+		}, nil
+	}
+}
+
+// Filters
+func PolicyBVFilter(policyName string) BVFilter {
+	return func(b BadVersion) bool { return b.PolicyName == policyName }
+}
+
+type BVFilter func(BadVersion) bool
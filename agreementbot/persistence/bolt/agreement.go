@@ -117,6 +117,14 @@ func (db *AgbotBoltDB) AgreementTimedout(agreementid string, protocol string) (*
 	return persistence.AgreementTimedout(db, agreementid, protocol)
 }
 
+func (db *AgbotBoltDB) AgreementUpgradePending(agreementid string, protocol string, reason string) (*persistence.Agreement, error) {
+	return persistence.AgreementUpgradePending(db, agreementid, protocol, reason)
+}
+
+func (db *AgbotBoltDB) AgreementUpgradeCleared(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementUpgradeCleared(db, agreementid, protocol)
+}
+
 func (db *AgbotBoltDB) DataVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
 	return persistence.DataVerified(db, agreementid, protocol)
 }
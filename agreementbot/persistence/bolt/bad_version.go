@@ -0,0 +1,91 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+const BAD_VERSION = "bad_version" // The bolt DB bucket name for bad workload versions, keyed by policy name and version.
+
+// Mark a workload version of a policy as bad. The first record for the version is kept if it is marked more than once.
+func (db *AgbotBoltDB) NewBadVersion(policyName string, version string, priority int, fallbackVersion string, devices int, failedDevices []string) (*persistence.BadVersion, error) {
+	bv, err := persistence.NewBadVersion(policyName, version, priority, fallbackVersion, devices, failedDevices)
+	if err != nil {
+		return nil, err
+	}
+
+	writeErr := db.db.Update(func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(badVersionBucketName())); err != nil {
+			return err
+		} else if current := b.Get([]byte(badVersionKey(policyName, version))); current != nil {
+			if err := json.Unmarshal(current, bv); err != nil {
+				return fmt.Errorf("Failed to unmarshal bad version DB data: %v", string(current))
+			}
+			return nil
+		} else if serialized, err := json.Marshal(bv); err != nil {
+			return fmt.Errorf("Failed to serialize bad version: %v. Error: %v", *bv, err)
+		} else {
+			return b.Put([]byte(badVersionKey(policyName, version)), serialized)
+		}
+	})
+
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	glog.V(2).Infof("Succeeded creating bad version record %v", bv)
+	return bv, nil
+}
+
+func (db *AgbotBoltDB) FindBadVersions(filters []persistence.BVFilter) ([]persistence.BadVersion, error) {
+	bvs := make([]persistence.BadVersion, 0)
+
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(badVersionBucketName())); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				var bv persistence.BadVersion
+
+				if err := json.Unmarshal(v, &bv); err != nil {
+					glog.Errorf("Unable to deserialize db record: %v", v)
+				} else {
+					exclude := false
+					for _, filterFn := range filters {
+						if !filterFn(bv) {
+							exclude = true
+						}
+					}
+					if !exclude {
+						bvs = append(bvs, bv)
+					}
+				}
+				return nil
+			})
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return bvs, nil
+}
+
+func (db *AgbotBoltDB) DeleteBadVersion(policyName string, version string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(badVersionBucketName())); b == nil {
+			return nil
+		} else {
+			return b.Delete([]byte(badVersionKey(policyName, version)))
+		}
+	})
+}
+
+func badVersionKey(policyName string, version string) string {
+	return fmt.Sprintf("%v|%v", policyName, version)
+}
+
+func badVersionBucketName() string {
+	return BAD_VERSION
+}
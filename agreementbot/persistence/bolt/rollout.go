@@ -0,0 +1,178 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+const ROLLOUT = "rollout" // The bolt DB bucket name for rollouts, keyed by policy name.
+
+// Create a new rollout for the policy, replacing any rollout that already exists for the policy.
+func (db *AgbotBoltDB) NewRollout(policyName string, version string, strategy policy.RolloutStrategy) (*persistence.Rollout, error) {
+	if r, err := persistence.NewRollout(policyName, version, strategy); err != nil {
+		return nil, err
+	} else if err := db.saveRollout(r); err != nil {
+		return nil, err
+	} else {
+		glog.V(2).Infof("Succeeded creating rollout record %v", r)
+		return r, nil
+	}
+}
+
+func (db *AgbotBoltDB) FindSingleRolloutByPolicyName(policyName string) (*persistence.Rollout, error) {
+	var r *persistence.Rollout
+
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(rolloutBucketName())); b != nil {
+			if v := b.Get([]byte(policyName)); v != nil {
+				r = new(persistence.Rollout)
+				if err := json.Unmarshal(v, r); err != nil {
+					return fmt.Errorf("Unable to deserialize rollout record: %v", string(v))
+				}
+			}
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return r, nil
+}
+
+func (db *AgbotBoltDB) FindRollouts(filters []persistence.RFilter) ([]persistence.Rollout, error) {
+	rollouts := make([]persistence.Rollout, 0)
+
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(rolloutBucketName())); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				var r persistence.Rollout
+
+				if err := json.Unmarshal(v, &r); err != nil {
+					glog.Errorf("Unable to deserialize db record: %v", v)
+				} else {
+					exclude := false
+					for _, filterFn := range filters {
+						if !filterFn(r) {
+							exclude = true
+						}
+					}
+					if !exclude {
+						rollouts = append(rollouts, r)
+					}
+				}
+				return nil
+			})
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return rollouts, nil
+}
+
+func (db *AgbotBoltDB) UpdateRolloutStrategy(policyName string, strategy policy.RolloutStrategy) (*persistence.Rollout, error) {
+	return persistence.UpdateRolloutStrategy(db, policyName, strategy)
+}
+
+func (db *AgbotBoltDB) StartRolloutBatch(policyName string, devices []string, total int) (*persistence.Rollout, error) {
+	return persistence.StartRolloutBatch(db, policyName, devices, total)
+}
+
+func (db *AgbotBoltDB) UpdateRolloutBatch(policyName string, upgraded []string, skipped []string, ended bool) (*persistence.Rollout, error) {
+	return persistence.UpdateRolloutBatch(db, policyName, upgraded, skipped, ended)
+}
+
+func (db *AgbotBoltDB) FailRollout(policyName string, failed []string, reason string) (*persistence.Rollout, error) {
+	return persistence.FailRollout(db, policyName, failed, reason)
+}
+
+func (db *AgbotBoltDB) CompleteRollout(policyName string) (*persistence.Rollout, error) {
+	return persistence.CompleteRollout(db, policyName)
+}
+
+func (db *AgbotBoltDB) HaltRollout(policyName string, reason string) (*persistence.Rollout, error) {
+	return persistence.HaltRollout(db, policyName, reason)
+}
+
+func (db *AgbotBoltDB) ResumeRollout(policyName string) (*persistence.Rollout, error) {
+	return persistence.ResumeRollout(db, policyName)
+}
+
+func (db *AgbotBoltDB) SingleRolloutUpdate(policyName string, fn func(persistence.Rollout) *persistence.Rollout) (*persistence.Rollout, error) {
+	if r, err := db.FindSingleRolloutByPolicyName(policyName); err != nil {
+		return nil, err
+	} else if r == nil {
+		return nil, fmt.Errorf("Unable to locate rollout for policy: %v", policyName)
+	} else {
+		updated := fn(*r)
+		return db.persistUpdatedRollout(policyName, updated)
+	}
+}
+
+// does whole-member replacements of values that are legal to change during the course of a rollout
+func (db *AgbotBoltDB) persistUpdatedRollout(policyName string, update *persistence.Rollout) (*persistence.Rollout, error) {
+	var mod persistence.Rollout
+
+	writeErr := db.db.Update(func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(rolloutBucketName())); err != nil {
+			return err
+		} else if current := b.Get([]byte(policyName)); current == nil {
+			return fmt.Errorf("No rollout for policy %v available to update", policyName)
+		} else if err := json.Unmarshal(current, &mod); err != nil {
+			return fmt.Errorf("Failed to unmarshal rollout DB data: %v", string(current))
+		} else {
+
+			// This code is running in a database transaction. Within the tx, the current record (mod) is
+			// read and then updated according to the updates within the input update record. It is critical
+			// to check for correct data transitions within the tx.
+			persistence.ValidateRolloutStateTransition(&mod, update)
+
+			if serialized, err := json.Marshal(mod); err != nil {
+				return fmt.Errorf("Failed to serialize rollout record: %v", mod)
+			} else if err := b.Put([]byte(policyName), serialized); err != nil {
+				return fmt.Errorf("Failed to write rollout record with key: %v", policyName)
+			} else {
+				glog.V(2).Infof("Succeeded updating rollout record to %v", mod)
+			}
+		}
+		return nil
+	})
+
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return &mod, nil
+}
+
+func (db *AgbotBoltDB) DeleteRollout(policyName string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(rolloutBucketName())); b == nil {
+			return nil
+		} else {
+			return b.Delete([]byte(policyName))
+		}
+	})
+}
+
+func (db *AgbotBoltDB) saveRollout(r *persistence.Rollout) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(rolloutBucketName())); err != nil {
+			return err
+		} else if serialized, err := json.Marshal(r); err != nil {
+			return fmt.Errorf("Failed to serialize rollout: %v. Error: %v", *r, err)
+		} else {
+			return b.Put([]byte(r.PolicyName), serialized)
+		}
+	})
+}
+
+func rolloutBucketName() string {
+	return ROLLOUT
+}
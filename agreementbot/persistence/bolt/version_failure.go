@@ -0,0 +1,90 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+const VERSION_FAILURE = "version_failure" // The bolt DB bucket name for workload version failures, keyed by policy name and version.
+
+// Record an execution failure of a workload version of a policy on a node, dropping the failures before the given time.
+func (db *AgbotBoltDB) RecordVersionFailure(policyName string, version string, deviceId string, since uint64) (*persistence.VersionFailures, error) {
+	vf, err := persistence.NewVersionFailures(policyName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	writeErr := db.db.Update(func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(versionFailureBucketName())); err != nil {
+			return err
+		} else {
+			if current := b.Get([]byte(badVersionKey(policyName, version))); current != nil {
+				if err := json.Unmarshal(current, vf); err != nil {
+					return fmt.Errorf("Failed to unmarshal version failures DB data: %v", string(current))
+				}
+			}
+			vf.AddFailure(deviceId, since)
+			if serialized, err := json.Marshal(vf); err != nil {
+				return fmt.Errorf("Failed to serialize version failures: %v. Error: %v", *vf, err)
+			} else {
+				return b.Put([]byte(badVersionKey(policyName, version)), serialized)
+			}
+		}
+	})
+
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	glog.V(5).Infof("Succeeded recording version failure %v", vf)
+	return vf, nil
+}
+
+func (db *AgbotBoltDB) FindVersionFailures(filters []persistence.VFFilter) ([]persistence.VersionFailures, error) {
+	vfs := make([]persistence.VersionFailures, 0)
+
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(versionFailureBucketName())); b != nil {
+			b.ForEach(func(k, v []byte) error {
+				var vf persistence.VersionFailures
+
+				if err := json.Unmarshal(v, &vf); err != nil {
+					glog.Errorf("Unable to deserialize db record: %v", v)
+				} else {
+					exclude := false
+					for _, filterFn := range filters {
+						if !filterFn(vf) {
+							exclude = true
+						}
+					}
+					if !exclude {
+						vfs = append(vfs, vf)
+					}
+				}
+				return nil
+			})
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return vfs, nil
+}
+
+func (db *AgbotBoltDB) DeleteVersionFailures(policyName string, version string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(versionFailureBucketName())); b == nil {
+			return nil
+		} else {
+			return b.Delete([]byte(badVersionKey(policyName, version)))
+		}
+	})
+}
+
+func versionFailureBucketName() string {
+	return VERSION_FAILURE
+}
@@ -7,8 +7,12 @@ import (
 
 // An agbot can be configured to run with several different databases. When running in a node agent, then the
 // bolt DB is used. When running standalone in a cloud deployment, it will use postgresql so that there can
-// be multiple instances of the agbot working together. This file contains the abstract interface representing
-// the database handle used by the runtime to access the real database.
+// be multiple instances of the agbot working together. A small standalone agbot can use sqlite, which stores
+// everything in a single file but otherwise behaves like postgresql. This file contains the abstract interface
+// representing the database handle used by the runtime to access the real database.
+
+// The owner returned by GetPartitionOwner for a partition that is not owned by any agbot.
+const NO_PARTITION_OWNER = "NO OWNER"
 
 type AgbotDatabase interface {
 
@@ -41,6 +45,8 @@ type AgbotDatabase interface {
 	AgreementBlockchainUpdate(agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*Agreement, error)
 	AgreementBlockchainUpdateAck(agreementId string, protocol string) (*Agreement, error)
 	AgreementTimedout(agreementid string, protocol string) (*Agreement, error)
+	AgreementUpgradePending(agreementid string, protocol string, reason string) (*Agreement, error)
+	AgreementUpgradeCleared(agreementid string, protocol string) (*Agreement, error)
 
 	DataNotification(agreementid string, protocol string) (*Agreement, error)
 	DataVerified(agreementid string, protocol string) (*Agreement, error)
@@ -68,6 +74,33 @@ type AgbotDatabase interface {
 
 	DeleteWorkloadUsage(deviceid string, policyName string) error
 
+	// Rollout related functions
+	NewRollout(policyName string, version string, strategy policy.RolloutStrategy) (*Rollout, error)
+	FindSingleRolloutByPolicyName(policyName string) (*Rollout, error)
+	FindRollouts(filters []RFilter) ([]Rollout, error)
+
+	SingleRolloutUpdate(policyName string, fn func(Rollout) *Rollout) (*Rollout, error)
+
+	UpdateRolloutStrategy(policyName string, strategy policy.RolloutStrategy) (*Rollout, error)
+	StartRolloutBatch(policyName string, devices []string, total int) (*Rollout, error)
+	UpdateRolloutBatch(policyName string, upgraded []string, skipped []string, ended bool) (*Rollout, error)
+	FailRollout(policyName string, failed []string, reason string) (*Rollout, error)
+	CompleteRollout(policyName string) (*Rollout, error)
+	HaltRollout(policyName string, reason string) (*Rollout, error)
+	ResumeRollout(policyName string) (*Rollout, error)
+
+	DeleteRollout(policyName string) error
+
+	// Bad workload version related functions
+	NewBadVersion(policyName string, version string, priority int, fallbackVersion string, devices int, failedDevices []string) (*BadVersion, error)
+	FindBadVersions(filters []BVFilter) ([]BadVersion, error)
+	DeleteBadVersion(policyName string, version string) error
+
+	// Workload version failure related functions
+	RecordVersionFailure(policyName string, version string, deviceId string, since uint64) (*VersionFailures, error)
+	FindVersionFailures(filters []VFFilter) ([]VersionFailures, error)
+	DeleteVersionFailures(policyName string, version string) error
+
 	// Function related to persistence of search sessions with the Exchange.
 	ObtainSearchSession(policyName string) (string, uint64, error)
 	UpdateSearchSessionChangedSince(currentChangedSince uint64, newChangedSince uint64, policyName string) (bool, error)
@@ -380,6 +380,14 @@ func (db *AgbotPostgresqlDB) AgreementTimedout(agreementid string, protocol stri
 	return persistence.AgreementTimedout(db, agreementid, protocol)
 }
 
+func (db *AgbotPostgresqlDB) AgreementUpgradePending(agreementid string, protocol string, reason string) (*persistence.Agreement, error) {
+	return persistence.AgreementUpgradePending(db, agreementid, protocol, reason)
+}
+
+func (db *AgbotPostgresqlDB) AgreementUpgradeCleared(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementUpgradeCleared(db, agreementid, protocol)
+}
+
 func (db *AgbotPostgresqlDB) AgreementBlockchainUpdate(agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*persistence.Agreement, error) {
 	return persistence.AgreementBlockchainUpdate(db, agreementId, consumerSig, hash, counterParty, signature, protocol)
 }
@@ -82,6 +82,15 @@ func (db *AgbotPostgresqlDB) Initialize(cfg *config.HorizonConfig) error {
 			return errors.New(fmt.Sprintf("unable to create workload usage partition table index, error: %v", err))
 		}
 
+		// Create the rollout, bad version and version failure tables if necessary.
+		if _, err := db.db.Exec(ROLLOUT_CREATE_MAIN_TABLE); err != nil {
+			return errors.New(fmt.Sprintf("unable to create rollouts table, error: %v", err))
+		} else if _, err := db.db.Exec(BAD_VERSION_CREATE_MAIN_TABLE); err != nil {
+			return errors.New(fmt.Sprintf("unable to create bad versions table, error: %v", err))
+		} else if _, err := db.db.Exec(VERSION_FAILURE_CREATE_MAIN_TABLE); err != nil {
+			return errors.New(fmt.Sprintf("unable to create version failures table, error: %v", err))
+		}
+
 		// Create the agreement table, partition and index if necessary.
 		if _, err := db.db.Exec(AGREEMENT_CREATE_MAIN_TABLE); err != nil {
 			return errors.New(fmt.Sprintf("unable to create agreements table, error: %v", err))
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
 )
 
 // Constants for the SQL statements that are used to work with partitions. Each agbot owns a single partition. Each agbot has
@@ -167,7 +168,7 @@ func (db *AgbotPostgresqlDB) GetPartitionOwner(id string) (string, error) {
 	if err := db.db.QueryRow(PARTITION_OWNER, id).Scan(&owner); err != nil {
 		return "", errors.New(fmt.Sprintf("error scanning partition %v owner result, error: %v", id, err))
 	} else if !owner.Valid {
-		return "NO OWNER", nil
+		return persistence.NO_PARTITION_OWNER, nil
 	} else {
 		return owner.String, nil
 	}
@@ -262,6 +263,10 @@ func (db *AgbotPostgresqlDB) MovePartition(timeout uint64) (bool, error) {
 			return false, err
 		} else if _, err := tx.Exec(db.GetWorkloadUsagePartitionMove(fromPartition, db.PrimaryPartition())); err != nil {
 			return false, err
+		} else if _, err := tx.Exec(ROLLOUT_PARTITION_MOVE, fromPartition, db.PrimaryPartition()); err != nil {
+			return false, err
+		} else if _, err := tx.Exec(ROLLOUT_PARTITION_DELETE, fromPartition); err != nil {
+			return false, err
 		} else if _, err := tx.Exec(db.GetAgreementPartitionTableDrop(fromPartition)); err != nil {
 			return false, err
 		} else if _, err := tx.Exec(db.GetWorkloadUsagePartitionTableDrop(fromPartition)); err != nil {
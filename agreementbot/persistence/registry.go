@@ -21,18 +21,23 @@ func Register(name string, db AgbotDatabase) {
 }
 
 // Initialize the underlying Agbot database depending on what is configured. If the bolt DB is configured, it is used. Next,
-// the postgresql config is checked and used if configured. If nothing is configured, an error is returned.
+// the sqlite config is checked and then the postgresql config, each is used if configured. If nothing is configured, an
+// error is returned.
 func InitDatabase(cfg *config.HorizonConfig) (AgbotDatabase, error) {
 
 	if cfg.IsBoltDBConfigured() {
 		dbObj := DatabaseProviders["bolt"]
 		return dbObj, dbObj.Initialize(cfg)
 
+	} else if cfg.IsSqliteConfigured() {
+		dbObj := DatabaseProviders["sqlite"]
+		return dbObj, dbObj.Initialize(cfg)
+
 	} else if cfg.IsPostgresqlConfigured() {
 		dbObj := DatabaseProviders["postgresql"]
 		return dbObj, dbObj.Initialize(cfg)
 
 	}
-	return nil, errors.New(fmt.Sprintf("neither bolt DB nor Postgresql DB is configured correctly."))
+	return nil, errors.New(fmt.Sprintf("none of bolt DB, SQLite DB or Postgresql DB is configured correctly."))
 
 }
@@ -0,0 +1,206 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/policy"
+	"time"
+)
+
+// A rollout tracks the staged upgrade of the nodes using a policy to a new service version. The nodes waiting to be
+// upgraded are the agreements for the policy that are marked pending upgrade. Governance moves the rollout through
+// its batches, each of which releases some of the pending agreements for upgrade.
+
+const ROLLOUT_STATE_CANARY = "canary"       // the first batch of nodes is being upgraded
+const ROLLOUT_STATE_ROLLING = "rolling"     // the canary succeeded, the remaining nodes are being upgraded in batches
+const ROLLOUT_STATE_HALTED = "halted"       // the rollout was halted by a user
+const ROLLOUT_STATE_FAILED = "failed"       // a node in the current batch failed to run the new version
+const ROLLOUT_STATE_COMPLETED = "completed" // all nodes have been upgraded
+
+type Rollout struct {
+	PolicyName      string                 `json:"policy_name"`      // the name of the policy being rolled out, immutable after construction
+	Version         string                 `json:"version"`          // the service version being rolled out, immutable after construction
+	Strategy        policy.RolloutStrategy `json:"strategy"`         // the strategy from the policy
+	State           string                 `json:"state"`            // one of the ROLLOUT_STATE_* values
+	StateReason     string                 `json:"state_reason"`     // why the rollout was halted or failed
+	StartTime       uint64                 `json:"start_time"`       // time when the rollout was created
+	Batch           int                    `json:"batch"`            // the current batch, 1 is the canary batch and 0 means no batch has started
+	BatchStartTime  uint64                 `json:"batch_start_time"` // time when the current batch started
+	BatchEndTime    uint64                 `json:"batch_end_time"`   // time when all nodes in the current batch were upgraded
+	TotalDevices    int                    `json:"total_devices"`    // the number of nodes waiting for the upgrade when the first batch started
+	BatchDevices    []string               `json:"batch_devices"`    // the nodes in the current batch
+	UpgradedDevices []string               `json:"upgraded_devices"` // the nodes that have run the new version for the success window
+	FailedDevices   []string               `json:"failed_devices"`   // the nodes that failed to run the new version
+	SkippedDevices  []string               `json:"skipped_devices"`  // the nodes that did not make a new agreement in time
+	UpdateTime      uint64                 `json:"update_time"`      // time when the rollout was last updated
+}
+
+func (r Rollout) String() string {
+	return fmt.Sprintf("PolicyName: %v, "+
+		"Version: %v, "+
+		"Strategy: %v, "+
+		"State: %v, "+
+		"StateReason: %v, "+
+		"StartTime: %v, "+
+		"Batch: %v, "+
+		"BatchStartTime: %v, "+
+		"BatchEndTime: %v, "+
+		"TotalDevices: %v, "+
+		"BatchDevices: %v, "+
+		"UpgradedDevices: %v, "+
+		"FailedDevices: %v, "+
+		"SkippedDevices: %v, "+
+		"UpdateTime: %v",
+		r.PolicyName, r.Version, r.Strategy.String(), r.State, r.StateReason, r.StartTime, r.Batch, r.BatchStartTime,
+		r.BatchEndTime, r.TotalDevices, r.BatchDevices, r.UpgradedDevices, r.FailedDevices, r.SkippedDevices, r.UpdateTime)
+}
+
+// Returns true when the rollout is moving nodes to the new version.
+func (r Rollout) IsActive() bool {
+	return r.State == ROLLOUT_STATE_CANARY || r.State == ROLLOUT_STATE_ROLLING
+}
+
+// Returns true if the device is in the current batch.
+func (r Rollout) InBatch(deviceId string) bool {
+	for _, d := range r.BatchDevices {
+		if d == deviceId {
+			return true
+		}
+	}
+	return false
+}
+
+// factory method for rollouts w/out persistence safety:
+func NewRollout(policyName string, version string, strategy policy.RolloutStrategy) (*Rollout, error) {
+	if policyName == "" || version == "" {
+		return nil, errors.New("Illegal input: one of policyName or version is empty")
+	} else {
+		now := uint64(time.Now().Unix())
+		return &Rollout{
+			PolicyName:      policyName,
+			Version:         version,
+			Strategy:        strategy,
+			State:           ROLLOUT_STATE_CANARY,
+			StartTime:       now,
+			BatchDevices:    []string{},
+			UpgradedDevices: []string{},
+			FailedDevices:   []string{},
+			SkippedDevices:  []string{},
+			UpdateTime:      now,
+		}, nil
+	}
+}
+
+func UpdateRolloutStrategy(db AgbotDatabase, policyName string, strategy policy.RolloutStrategy) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		r.Strategy = strategy
+		return &r
+	})
+}
+
+// Start the next batch of the rollout with the given devices. The total is the number of devices waiting for the
+// upgrade, which is recorded when the first batch starts.
+func StartRolloutBatch(db AgbotDatabase, policyName string, devices []string, total int) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		if r.Batch == 0 {
+			r.TotalDevices = total
+		}
+		r.Batch += 1
+		if r.Batch > 1 {
+			r.State = ROLLOUT_STATE_ROLLING
+		}
+		r.BatchStartTime = uint64(time.Now().Unix())
+		r.BatchEndTime = 0
+		r.BatchDevices = devices
+		return &r
+	})
+}
+
+// Record the outcome of the devices in the current batch. The batch ends when all of its devices have an outcome.
+func UpdateRolloutBatch(db AgbotDatabase, policyName string, upgraded []string, skipped []string, ended bool) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		r.UpgradedDevices = append(r.UpgradedDevices, upgraded...)
+		r.SkippedDevices = append(r.SkippedDevices, skipped...)
+		if ended {
+			r.BatchEndTime = uint64(time.Now().Unix())
+		}
+		return &r
+	})
+}
+
+func FailRollout(db AgbotDatabase, policyName string, failed []string, reason string) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		r.FailedDevices = append(r.FailedDevices, failed...)
+		r.State = ROLLOUT_STATE_FAILED
+		r.StateReason = reason
+		return &r
+	})
+}
+
+func CompleteRollout(db AgbotDatabase, policyName string) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		r.State = ROLLOUT_STATE_COMPLETED
+		r.BatchDevices = []string{}
+		return &r
+	})
+}
+
+// Stop releasing nodes for upgrade. Only an active rollout can be halted.
+func HaltRollout(db AgbotDatabase, policyName string, reason string) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		if r.IsActive() {
+			r.State = ROLLOUT_STATE_HALTED
+			r.StateReason = reason
+		}
+		return &r
+	})
+}
+
+// Continue a halted or failed rollout. A failed batch is ended so that the rollout moves on to the next batch, the
+// failed devices remain recorded in the rollout.
+func ResumeRollout(db AgbotDatabase, policyName string) (*Rollout, error) {
+	return db.SingleRolloutUpdate(policyName, func(r Rollout) *Rollout {
+		if r.IsActive() || r.State == ROLLOUT_STATE_COMPLETED {
+			return &r
+		} else if r.State == ROLLOUT_STATE_FAILED && r.BatchEndTime == 0 {
+			r.BatchEndTime = uint64(time.Now().Unix())
+		}
+
+		if r.Batch > 1 || (r.Batch == 1 && r.BatchEndTime != 0) {
+			r.State = ROLLOUT_STATE_ROLLING
+		} else {
+			r.State = ROLLOUT_STATE_CANARY
+		}
+		r.StateReason = ""
+		return &r
+	})
+}
+
+// This code is running in a database transaction. Within the tx, the current record is read and then updated
+// according to the updates within the input update record. The policy name, version and start time of a rollout
+// never change.
+func ValidateRolloutStateTransition(mod *Rollout, update *Rollout) {
+	mod.Strategy = update.Strategy
+	mod.State = update.State
+	mod.StateReason = update.StateReason
+	if mod.Batch <= update.Batch { // Always moves forward
+		mod.Batch = update.Batch
+		mod.BatchStartTime = update.BatchStartTime
+		mod.BatchEndTime = update.BatchEndTime
+		mod.BatchDevices = update.BatchDevices
+	}
+	if mod.TotalDevices == 0 { // 1 transition from zero to non-zero
+		mod.TotalDevices = update.TotalDevices
+	}
+	mod.UpgradedDevices = update.UpgradedDevices
+	mod.FailedDevices = update.FailedDevices
+	mod.SkippedDevices = update.SkippedDevices
+	mod.UpdateTime = uint64(time.Now().Unix())
+}
+
+// Filters
+func ActiveRFilter() RFilter {
+	return func(r Rollout) bool { return r.IsActive() }
+}
+
+type RFilter func(Rollout) bool
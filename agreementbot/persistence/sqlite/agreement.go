@@ -0,0 +1,378 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// This function registers an uninitialized agbot DB instance with the DB plugin registry. The plugin's Initialize
+// method is used to configure the object.
+func init() {
+	persistence.Register("sqlite", new(AgbotSqliteDB))
+}
+
+// Constants for the SQL statements that are used to work with agreements. Agreements are partitioned by agbot instances in
+// the same way as they are in the postgresql implementation, but all partitions share a single table. The partition column
+// is part of every query so that an agbot only works with the agreements in the partitions that it owns.
+//
+// The lifecycle of the workload usage records is tied loosely to the agreements. See the IMPORTANT NOTE in the postgresql
+// implementation for a description of how these records move from one partition to another.
+//
+// agreements schema:
+// agreement_id: The stringified agreement id for the agreement object in the record.
+// protocol:     The agreement protocol in use. It is a way of partitioning the database so that an agbot can focus on handling
+//               all agreements for a given protocol on at a time.
+// partition:    The agbot partition that this agreement lives in. This is used to divide up ownership of agreements to specific agbot instances.
+// agreement:    The agreement object which is a JSON blob. The blob schema is defined by the Agreement struct in the
+//               persistence package.
+// updated:      The unix time of the last update.
+//
+
+const AGREEMENT_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS agreements (
+	agreement_id TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	partition TEXT NOT NULL,
+	agreement TEXT NOT NULL,
+	updated INTEGER DEFAULT (strftime('%s','now')),
+	PRIMARY KEY (agreement_id, protocol)
+);`
+const AGREEMENT_CREATE_PARTITION_INDEX = `CREATE INDEX IF NOT EXISTS partition_index_on_agreements ON agreements (partition, protocol);`
+
+const AGREEMENT_QUERY = `SELECT agreement, partition FROM agreements WHERE agreement_id = ?1 AND protocol = ?2;`
+const ALL_AGREEMENTS_QUERY = `SELECT agreement FROM agreements WHERE protocol = ?1 AND partition = ?2;`
+
+const AGREEMENT_COUNT = `SELECT agreement FROM agreements WHERE partition = ?1;`
+
+const AGREEMENT_INSERT = `INSERT INTO agreements (agreement_id, protocol, partition, agreement) VALUES (?1, ?2, ?3, ?4);`
+const AGREEMENT_UPDATE = `UPDATE agreements SET agreement = ?3, updated = strftime('%s','now') WHERE agreement_id = ?1 AND protocol = ?2;`
+const AGREEMENT_DELETE = `DELETE FROM agreements WHERE agreement_id = ?1 AND protocol = ?2;`
+
+const AGREEMENT_PARTITION_MOVE = `UPDATE agreements SET partition = ?2, updated = strftime('%s','now') WHERE partition = ?1;`
+
+// The fields in this object are initialized in the Initialize method in this package.
+type AgbotSqliteDB struct {
+	identity         string   // The identity of this agbot in the partitions table.
+	db               *sql.DB  // A handle to the underlying database.
+	primaryPartition string   // The partition to use when creating new agreements.
+	partitions       []string // The list of partitions this agbot is responsible to maintain.
+}
+
+func (db *AgbotSqliteDB) String() string {
+	return fmt.Sprintf("Instance: %v, PrimaryPartition: %v, All Partitions: %v, DB Handle: %v", db.identity, db.primaryPartition, db.partitions, db.db)
+}
+
+func (db *AgbotSqliteDB) PrimaryPartition() string {
+	return db.primaryPartition
+}
+
+func (db *AgbotSqliteDB) AllPartitions() []string {
+	return db.partitions
+}
+
+// Return true if the input partition is one of the partitions owned by this agbot.
+func (db *AgbotSqliteDB) ownsPartition(partition string) bool {
+	for _, p := range db.AllPartitions() {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *AgbotSqliteDB) GetAgreementCount(partition string) (int64, int64, error) {
+
+	var activeNum, archivedNum int64
+
+	rows, err := db.db.Query(AGREEMENT_COUNT, partition)
+	if err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("error getting rows for agreement counts, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var agBytes []byte
+		ag := new(persistence.Agreement)
+		if err := rows.Scan(&agBytes); err != nil {
+			return 0, 0, errors.New(fmt.Sprintf("error scanning row for agreement counts: %v", err))
+		} else if err := json.Unmarshal(agBytes, ag); err != nil {
+			return 0, 0, errors.New(fmt.Sprintf("error demarshalling row for agreement count: %v, error: %v", string(agBytes), err))
+		} else if ag.Archived {
+			archivedNum += 1
+		} else {
+			activeNum += 1
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("error iterating rows for agreement counts: %v", err))
+	}
+
+	return activeNum, archivedNum, nil
+}
+
+// Retrieve all agreements from the database and filter them out based on the input filters.
+func (db *AgbotSqliteDB) FindAgreements(filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+
+	ags := make([]persistence.Agreement, 0, 100)
+
+	for _, currentPartition := range db.AllPartitions() {
+		if partitionAgs, err := db.findPartitionAgreements(filters, protocol, currentPartition); err != nil {
+			return nil, err
+		} else {
+			ags = append(ags, partitionAgs...)
+		}
+	}
+
+	return ags, nil
+
+}
+
+// Find all the agreement objects in a partition, read them in and run them through the filters (after unmarshalling the
+// blob into an in memory agreement object).
+func (db *AgbotSqliteDB) findPartitionAgreements(filters []persistence.AFilter, protocol string, partition string) ([]persistence.Agreement, error) {
+
+	ags := make([]persistence.Agreement, 0, 100)
+
+	rows, err := db.db.Query(ALL_AGREEMENTS_QUERY, protocol, partition)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for agreements error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var agBytes []byte
+		ag := new(persistence.Agreement)
+		if err := rows.Scan(&agBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(agBytes, ag); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(agBytes), err))
+		} else {
+			if !ag.Archived {
+				glog.V(5).Infof("Demarshalled agreement in partition %v from DB: %v", partition, ag)
+			}
+			if agPassed := persistence.RunFilters(ag, filters); agPassed != nil {
+				ags = append(ags, *ag)
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	return ags, nil
+}
+
+// Find a specific agreement in the partitions owned by this agbot.
+func (db *AgbotSqliteDB) internalFindSingleAgreementByAgreementId(tx *sql.Tx, agreementId string, protocol string, filters []persistence.AFilter) (*persistence.Agreement, string, error) {
+
+	var agBytes []byte
+	var partition string
+	ag := new(persistence.Agreement)
+
+	var qerr error
+	if tx == nil {
+		qerr = db.db.QueryRow(AGREEMENT_QUERY, agreementId, protocol).Scan(&agBytes, &partition)
+	} else {
+		qerr = tx.QueryRow(AGREEMENT_QUERY, agreementId, protocol).Scan(&agBytes, &partition)
+	}
+
+	if qerr == sql.ErrNoRows || (qerr == nil && !db.ownsPartition(partition)) {
+		return nil, "", nil
+	} else if qerr != nil {
+		return nil, "", errors.New(fmt.Sprintf("error scanning row for agreement %v error: %v", agreementId, qerr))
+	} else if err := json.Unmarshal(agBytes, ag); err != nil {
+		return nil, "", errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(agBytes), err))
+	} else if agPassed := persistence.RunFilters(ag, filters); agPassed == nil {
+		return nil, "", nil
+	} else {
+		return ag, partition, nil
+	}
+
+}
+
+func (db *AgbotSqliteDB) FindSingleAgreementByAgreementId(agreementId string, protocol string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	ag, _, err := db.internalFindSingleAgreementByAgreementId(nil, agreementId, protocol, filters)
+	return ag, err
+}
+
+func (db *AgbotSqliteDB) FindSingleAgreementByAgreementIdAllProtocols(agreementid string, protocols []string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	for _, protocol := range protocols {
+		if ag, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, filters); err != nil {
+			return nil, err
+		} else if ag != nil {
+			return ag, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *AgbotSqliteDB) AgreementAttempt(agreementid string, org string, deviceid string, deviceType string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, serviceId []string, nhPolicy policy.NodeHealth) error {
+	if agreement, err := persistence.NewAgreement(agreementid, org, deviceid, deviceType, policyName, bcType, bcName, bcOrg, agreementProto, pattern, serviceId, nhPolicy); err != nil {
+		return err
+	} else if err := db.insertAgreement(agreement, agreementProto); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (db *AgbotSqliteDB) AgreementFinalized(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementFinalized(db, agreementId, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementUpdate(agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*persistence.Agreement, error) {
+	return persistence.AgreementUpdate(db, agreementid, proposal, policy, dvPolicy, defaultCheckRate, hash, sig, protocol, agreementProtoVersion)
+}
+
+func (db *AgbotSqliteDB) AgreementMade(agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*persistence.Agreement, error) {
+	return persistence.AgreementMade(db, agreementId, counterParty, signature, protocol, hapartners, bcType, bcName, bcOrg)
+}
+
+func (db *AgbotSqliteDB) AgreementTimedout(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementTimedout(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementUpgradePending(agreementid string, protocol string, reason string) (*persistence.Agreement, error) {
+	return persistence.AgreementUpgradePending(db, agreementid, protocol, reason)
+}
+
+func (db *AgbotSqliteDB) AgreementUpgradeCleared(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementUpgradeCleared(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementBlockchainUpdate(agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdate(db, agreementId, consumerSig, hash, counterParty, signature, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementBlockchainUpdateAck(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdateAck(db, agreementId, protocol)
+}
+
+func (db *AgbotSqliteDB) DataVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) DataNotVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) DataNotification(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotification(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) MeteringNotification(agreementid string, protocol string, mn string) (*persistence.Agreement, error) {
+	return persistence.MeteringNotification(db, agreementid, protocol, mn)
+}
+
+func (db *AgbotSqliteDB) ArchiveAgreement(agreementid string, protocol string, reason uint, desc string) (*persistence.Agreement, error) {
+	return persistence.ArchiveAgreement(db, agreementid, protocol, reason, desc)
+}
+
+// Only agreements in a partition owned by this agbot are deleted.
+func (db *AgbotSqliteDB) DeleteAgreement(agreementid string, protocol string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if ag, _, err := db.internalFindSingleAgreementByAgreementId(tx, agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return err
+	} else if ag == nil {
+		return nil
+	} else if _, err := tx.Exec(AGREEMENT_DELETE, agreementid, protocol); err != nil {
+		return err
+	}
+
+	glog.V(5).Infof("Agreement %v deleted from database.", agreementid)
+	return tx.Commit()
+}
+
+func (db *AgbotSqliteDB) Close() {
+	glog.V(2).Infof("Closing SQLite database")
+	db.db.Close()
+	glog.V(2).Infof("Closed SQLite database")
+}
+
+// Utility functions used by the public functions in this package.
+
+// This function is used by all functions that want to change something in the database. It first locates the agreement
+// to be updated, then calls the input function to update the agreement in memory, and finally calls wrapTransaction
+// to start a transaction that will actually perform the update.
+func (db *AgbotSqliteDB) SingleAgreementUpdate(agreementid string, protocol string, fn func(persistence.Agreement) *persistence.Agreement) (*persistence.Agreement, error) {
+	if agreement, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return nil, err
+	} else if agreement == nil {
+		return nil, errors.New(fmt.Sprintf("unable to locate agreement id: %v", agreementid))
+	} else {
+		updated := fn(*agreement)
+		return updated, db.wrapTransaction(agreementid, protocol, updated)
+	}
+}
+
+// This function is used to wrap a database transaction around an update to an agreement object.
+func (db *AgbotSqliteDB) wrapTransaction(agreementid string, protocol string, updated *persistence.Agreement) error {
+
+	if tx, err := db.db.Begin(); err != nil {
+		return err
+	} else if err := db.persistUpdatedAgreement(tx, agreementid, protocol, updated); err != nil {
+		tx.Rollback()
+		return err
+	} else {
+		return tx.Commit()
+	}
+
+}
+
+// This function runs inside a transaction. It will atomicly read the agreement from the DB, verify that the updated
+// agreement object contains valid state transitions, and then write the updated agreement back to the database.
+func (db *AgbotSqliteDB) persistUpdatedAgreement(tx *sql.Tx, agreementid string, protocol string, update *persistence.Agreement) error {
+
+	if mod, _, err := db.internalFindSingleAgreementByAgreementId(tx, agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return err
+	} else if mod == nil {
+		return errors.New(fmt.Sprintf("No agreement with given id available to update: %v", agreementid))
+	} else {
+		// This code is running in a database transaction. Within the tx, the current record (mod) is
+		// read and then updated according to the updates within the input update record. It is critical
+		// to check for correct data transitions within the tx.
+		persistence.ValidateStateTransition(mod, update)
+		return db.updateAgreement(tx, mod, protocol)
+	}
+}
+
+func (db *AgbotSqliteDB) insertAgreement(ag *persistence.Agreement, protocol string) error {
+
+	if agm, err := json.Marshal(ag); err != nil {
+		return err
+	} else if _, err = db.db.Exec(AGREEMENT_INSERT, ag.CurrentAgreementId, protocol, db.PrimaryPartition(), string(agm)); err != nil {
+		return err
+	} else {
+		glog.V(2).Infof("Succeeded creating agreement record %v", *ag)
+	}
+
+	return nil
+}
+
+func (db *AgbotSqliteDB) updateAgreement(tx *sql.Tx, ag *persistence.Agreement, protocol string) error {
+
+	if agm, err := json.Marshal(ag); err != nil {
+		return err
+	} else if _, err = tx.Exec(AGREEMENT_UPDATE, ag.CurrentAgreementId, protocol, string(agm)); err != nil {
+		return err
+	} else {
+		glog.V(2).Infof("Succeeded writing agreement record %v", *ag)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// Constants for the SQL statements that are used to work with bad workload versions. A bad version applies to all of
+// the nodes using the policy, so bad versions are not partitioned.
+//
+// bad_versions schema:
+// policy_name: The name of the policy containing the workload.
+// version:     The bad workload version.
+// bad_version: The bad version object which is a JSON blob. The blob schema is defined by the BadVersion struct in the persistence package.
+// updated:     The unix time of the last update.
+//
+
+const BAD_VERSION_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS bad_versions (
+	policy_name TEXT NOT NULL,
+	version TEXT NOT NULL,
+	bad_version TEXT NOT NULL,
+	updated INTEGER DEFAULT (strftime('%s','now')),
+	PRIMARY KEY (policy_name, version)
+);`
+
+const ALL_BAD_VERSION_QUERY = `SELECT bad_version FROM bad_versions;`
+const BAD_VERSION_QUERY = `SELECT bad_version FROM bad_versions WHERE policy_name = ?1 AND version = ?2;`
+
+// The first record for a version is kept if it is marked more than once.
+const BAD_VERSION_INSERT = `INSERT OR IGNORE INTO bad_versions (policy_name, version, bad_version) VALUES (?1, ?2, ?3);`
+const BAD_VERSION_DELETE = `DELETE FROM bad_versions WHERE policy_name = ?1 AND version = ?2;`
+
+// Mark a workload version of a policy as bad.
+func (db *AgbotSqliteDB) NewBadVersion(policyName string, version string, priority int, fallbackVersion string, devices int, failedDevices []string) (*persistence.BadVersion, error) {
+	var bvBytes []byte
+	if bv, err := persistence.NewBadVersion(policyName, version, priority, fallbackVersion, devices, failedDevices); err != nil {
+		return nil, err
+	} else if bvm, err := json.Marshal(bv); err != nil {
+		return nil, err
+	} else if _, err := db.db.Exec(BAD_VERSION_INSERT, policyName, version, string(bvm)); err != nil {
+		return nil, errors.New(fmt.Sprintf("error inserting bad version %v for policy %v, error: %v", version, policyName, err))
+	} else if err := db.db.QueryRow(BAD_VERSION_QUERY, policyName, version).Scan(&bvBytes); err != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for bad version %v of policy %v, error: %v", version, policyName, err))
+	} else if err := json.Unmarshal(bvBytes, bv); err != nil {
+		return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(bvBytes), err))
+	} else {
+		glog.V(2).Infof("Succeeded creating bad version record %v", bv)
+		return bv, nil
+	}
+}
+
+func (db *AgbotSqliteDB) FindBadVersions(filters []persistence.BVFilter) ([]persistence.BadVersion, error) {
+	bvs := make([]persistence.BadVersion, 0)
+
+	rows, err := db.db.Query(ALL_BAD_VERSION_QUERY)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for bad versions, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var bvBytes []byte
+		bv := new(persistence.BadVersion)
+		if err := rows.Scan(&bvBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(bvBytes, bv); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(bvBytes), err))
+		} else {
+			exclude := false
+			for _, filterFn := range filters {
+				if !filterFn(*bv) {
+					exclude = true
+				}
+			}
+			if !exclude {
+				bvs = append(bvs, *bv)
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	return bvs, nil
+}
+
+func (db *AgbotSqliteDB) DeleteBadVersion(policyName string, version string) error {
+	if _, err := db.db.Exec(BAD_VERSION_DELETE, policyName, version); err != nil {
+		return errors.New(fmt.Sprintf("error deleting bad version %v for policy %v, error: %v", version, policyName, err))
+	}
+	glog.V(5).Infof("Succeeded deleting bad version %v for policy %v from database.", version, policyName)
+	return nil
+}
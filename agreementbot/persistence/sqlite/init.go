@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/satori/go.uuid"
+	_ "modernc.org/sqlite"
+	"os"
+	"path"
+)
+
+// This function is called by the anax main to allow the configured database a chance to initialize itself.
+// This function is called every time the agbot starts, so it has to handle the following cases:
+// - Nothing exists in the database
+// - The database contains structures with schema that are not at the latest version
+// - The database is completely up to date WRT the schemas
+//
+// The sqlite driver is a pure Go translation of SQLite, so this database works in agbots built with cgo disabled.
+func (db *AgbotSqliteDB) Initialize(cfg *config.HorizonConfig) error {
+
+	dbFile := cfg.AgreementBot.Sqlite.File
+	if err := os.MkdirAll(path.Dir(dbFile), 0700); err != nil {
+		return errors.New(fmt.Sprintf("unable to create directory %v for SQLite database, error: %v", path.Dir(dbFile), err))
+	}
+
+	glog.V(1).Infof("Opening SQLite database: %v", dbFile)
+
+	if sdb, err := sql.Open("sqlite", cfg.AgreementBot.Sqlite.MakeConnectionString()); err != nil {
+		return errors.New(fmt.Sprintf("unable to open SQLite database %v, error: %v", dbFile, err))
+	} else if err := sdb.Ping(); err != nil {
+		return errors.New(fmt.Sprintf("unable to ping SQLite database %v, error: %v", dbFile, err))
+	} else {
+		db.db = sdb
+
+		// The write ahead log allows readers to proceed while another connection holds the write lock.
+		if _, err := db.db.Exec(`PRAGMA journal_mode=WAL;`); err != nil {
+			return errors.New(fmt.Sprintf("unable to set SQLite journal mode, error: %v", err))
+		}
+
+		// Initialize the DB instance fields.
+		if id, err := uuid.NewV4(); err != nil {
+			return errors.New(fmt.Sprintf("unable to get UUID identity for this agbot, error: %v", err))
+		} else {
+			db.identity = id.String()
+		}
+		glog.V(1).Infof("Agreementbot %v initializing partitions", db.identity)
+
+		// Now create the tables and initialize them as necessary.
+		glog.V(3).Infof("SQLite database tables initializing.")
+
+		// Create the version table if necessary, and insert the current version row if necessary.
+		if _, err := db.db.Exec(VERSION_CREATE_TABLE); err != nil {
+			return errors.New(fmt.Sprintf("unable to create version table, error: %v", err))
+		} else if _, err := db.db.Exec(VERSION_INSERT); err != nil {
+			return errors.New(fmt.Sprintf("unable to insert singleton version row, error: %v", err))
+		}
+
+		// Create the search session, partition, workload usage, rollout, bad version, version failure and agreement tables if necessary.
+		for _, stmt := range []string{SEARCH_SESSIONS_CREATE_MAIN_TABLE, PARTITION_CREATE_MAIN_TABLE,
+			WORKLOAD_USAGE_CREATE_MAIN_TABLE, WORKLOAD_USAGE_CREATE_PARTITION_INDEX, ROLLOUT_CREATE_MAIN_TABLE,
+			BAD_VERSION_CREATE_MAIN_TABLE, VERSION_FAILURE_CREATE_MAIN_TABLE, AGREEMENT_CREATE_MAIN_TABLE, AGREEMENT_CREATE_PARTITION_INDEX} {
+			if _, err := db.db.Exec(stmt); err != nil {
+				return errors.New(fmt.Sprintf("unable to create table or index %v, error: %v", stmt, err))
+			}
+		}
+
+		// Claim a partition for ourselves.
+		if partition, err := db.ClaimPartition(cfg.GetPartitionStale()); err != nil {
+			return errors.New(fmt.Sprintf("unable to claim a partition, error: %v", err))
+		} else {
+			db.primaryPartition = partition
+			db.partitions = append(db.partitions, partition)
+		}
+
+		glog.V(3).Infof("SQLite primary partition database tables exist.")
+
+		// Migrate the database tables if necessary. Extract the current schema version from the version table,
+		// and then run each version's migration SQL to bring the database up to the current version supported
+		// by this code.
+		var dbVersion int
+		var description string
+		var timestamp int64
+		if err := db.db.QueryRow(VERSION_QUERY).Scan(&dbVersion, &description, &timestamp); err != nil {
+			return errors.New(fmt.Sprintf("error scanning row for current version, error: %v", err))
+		} else {
+			glog.V(3).Infof("SQLite database tables are at version %v, %v, as of %v.", dbVersion, description, timestamp)
+		}
+
+		if dbVersion < HIGHEST_DATABASE_VERSION {
+			glog.V(3).Infof("SQLite database tables upgrading from version %v to %v.", dbVersion, HIGHEST_DATABASE_VERSION)
+
+			// Each new database version has it's own key in the migration SQL map.
+			for v := dbVersion + 1; v <= HIGHEST_DATABASE_VERSION; v++ {
+
+				// Run each SQL statement in the array of SQL statements for the current verion.
+				for si := 0; si < len(migrationSQL[v].sql); si++ {
+					if _, err := db.db.Exec(migrationSQL[v].sql[si]); err != nil {
+						return errors.New(fmt.Sprintf("unable to run SQL migration statement version %v, index %v, statement %v, error: %v", v, si, migrationSQL[v].sql[si], err))
+					}
+				}
+				if _, err := db.db.Exec(VERSION_UPDATE, v, migrationSQL[v].description); err != nil {
+					return errors.New(fmt.Sprintf("unable to update version table, error: %v", err))
+				}
+				glog.V(3).Infof("SQLite database tables upgraded to version %v, %v", v, migrationSQL[v].description)
+			}
+
+			glog.V(3).Infof("SQLite database tables upgraded to version %v", HIGHEST_DATABASE_VERSION)
+		}
+
+		glog.V(3).Infof("SQLite database tables initialized.")
+
+	}
+	return nil
+
+}
@@ -0,0 +1,242 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"strconv"
+)
+
+// Constants for the SQL statements that are used to work with partitions. Partitions work the same way as they do in the
+// postgresql implementation. Each agbot owns a single partition, identified by an instance id (uuid) that the agbot creates
+// each time it starts. Agbots periodically heartbeat their partition and look for partitions that are no longer being used
+// by an agbot, either because the owner quiesced or because it stopped heartbeating within the "stale" timeout. Those
+// partitions are taken over and their agreement related records are moved into the primary partition of the agbot that
+// claimed it. Since SQLite has no table inheritance, all partitions live in the same tables and the partition column
+// identifies the partition that a record belongs to. Moving records between partitions is then a simple update.
+//
+// Every transaction in this package takes the database write lock when it begins (see config.SqliteConfig), so the read
+// and the write in the claim logic below cannot be interleaved with another agbot's claim.
+//
+// partitions schema:
+// id:        The partition id, serially incremented by the database when a new partition is created.
+// owner:     The UUID of the agbot that owns this partition. NULL means that the previous owner quiesced so the partition is
+//            available to be taken over immediately.
+// heartbeat: The unix time of the last heartbeat. If the owning agbot stops heartbeating, the partition becomes eligible to
+//            be taken over by another agbot.
+//
+
+const PARTITION_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS partitions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner TEXT,
+	heartbeat INTEGER
+);`
+
+const PARTITION_OWNER = `SELECT owner FROM partitions WHERE id = ?1;`
+
+const PARTITION_INSERT = `INSERT INTO partitions (owner, heartbeat) VALUES (?1, strftime('%s','now'));`
+
+const PARTITION_HEARTBEAT = `UPDATE partitions SET heartbeat = strftime('%s','now') WHERE id = ?1 AND owner = ?2;`
+
+const PARTITION_GET_HEARTBEAT = `SELECT heartbeat FROM partitions WHERE id = ?1;`
+
+const PARTITION_QUIESCE = `UPDATE partitions SET owner = NULL, heartbeat = NULL WHERE owner = ?1;`
+
+const PARTITION_DELETE = `DELETE FROM partitions WHERE id = ?1;`
+
+// Find a partition that was quiesced or whose owner has stopped heartbeating. The partition owned by the caller is never
+// returned, even if the caller is late with its heartbeat.
+const PARTITION_FIND_UNOWNED = `SELECT id FROM partitions
+	WHERE
+		((owner IS NULL AND heartbeat IS NULL)
+		OR
+		(owner IS NOT NULL AND strftime('%s','now') - heartbeat > ?1))
+		AND id != ?2
+	LIMIT 1;`
+
+const PARTITION_CLAIM = `UPDATE partitions SET owner = ?1, heartbeat = strftime('%s','now') WHERE id = ?2;`
+
+const PARTITION_EXISTING = `SELECT DISTINCT partition FROM agreements;`
+
+// Functions related to partitions in the sqlite database. The workload usages should always be using the same partitions
+// as the agreements, or fewer partitions if an agreement partition contains only archived records.
+
+// Look for an ownerless or stale partition. If none exist, create a new partition.
+func (db *AgbotSqliteDB) ClaimPartition(timeout uint64) (string, error) {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to start transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	if unownedPartition, err := db.claimUnownedPartition(tx, timeout); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to claim an unowned partition, error: %v", err))
+	} else if unownedPartition != "" {
+		if err := tx.Commit(); err != nil {
+			return "", errors.New(fmt.Sprintf("unable to commit claim on unowned partition, error: %v", err))
+		}
+		return unownedPartition, nil
+	}
+
+	// There were no claimable partitions, so create a new partition.
+	if res, err := tx.Exec(PARTITION_INSERT, db.identity); err != nil {
+		return "", errors.New(fmt.Sprintf("AgreementBot %v unable to insert new partition, error: %v", db.identity, err))
+	} else if id, err := res.LastInsertId(); err != nil {
+		return "", errors.New(fmt.Sprintf("AgreementBot %v unable to get id of new partition, error: %v", db.identity, err))
+	} else if err := tx.Commit(); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to commit new partition, error: %v", err))
+	} else {
+		glog.V(5).Infof("AgreementBot %v creating new partition %v", db.identity, id)
+		return strconv.FormatInt(id, 10), nil
+	}
+}
+
+// This function runs inside a transaction. It finds a claimable partition and makes this agbot the owner of it. An empty
+// string is returned when there is nothing to claim.
+func (db *AgbotSqliteDB) claimUnownedPartition(tx *sql.Tx, timeout uint64) (string, error) {
+
+	var id int64
+	if err := tx.QueryRow(PARTITION_FIND_UNOWNED, timeout, db.PrimaryPartition()).Scan(&id); err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to find stale partition, error: %v", err))
+	} else if _, err := tx.Exec(PARTITION_CLAIM, db.identity, id); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to claim partition %v, error: %v", id, err))
+	}
+
+	glog.Infof("AgreementBot %v claimed partition %v", db.identity, id)
+	return strconv.FormatInt(id, 10), nil
+}
+
+// Locate all the partitions currently found in the database, for all agbots.
+func (db *AgbotSqliteDB) FindPartitions() ([]string, error) {
+
+	// Find all the agreement partitions.
+	partitions := make([]string, 0, 10)
+	foundPrimary := false
+
+	rows, err := db.db.Query(PARTITION_EXISTING)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for agreement partitions: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else {
+			partitions = append(partitions, partition)
+			if partition == db.PrimaryPartition() {
+				foundPrimary = true
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	// Make sure the primary partition appears (even if it doesnt have any agreements yet), if it has not already been added
+	if !foundPrimary {
+		partitions = append(partitions, db.PrimaryPartition())
+	}
+
+	return partitions, nil
+}
+
+// Retrieve the partition owner for a given partition.
+func (db *AgbotSqliteDB) GetPartitionOwner(id string) (string, error) {
+
+	var owner sql.NullString
+	if err := db.db.QueryRow(PARTITION_OWNER, id).Scan(&owner); err != nil {
+		return "", errors.New(fmt.Sprintf("error scanning partition %v owner result, error: %v", id, err))
+	} else if !owner.Valid {
+		return persistence.NO_PARTITION_OWNER, nil
+	} else {
+		return owner.String, nil
+	}
+
+}
+
+// Update the hearbeat for our partition.
+func (db *AgbotSqliteDB) HeartbeatPartition() error {
+
+	if res, err := db.db.Exec(PARTITION_HEARTBEAT, db.PrimaryPartition(), db.identity); err != nil {
+		return errors.New(fmt.Sprintf("AgreementBot %v unable to heartbeat, error: %v", db.identity, err))
+	} else if num, err := res.RowsAffected(); err != nil {
+		return errors.New(fmt.Sprintf("AgreementBot %v error getting rows affected, error: %v", db.identity, err))
+	} else if num == 0 {
+		msg := fmt.Sprintf("AgreementBot %v heartbeat to partition %v failed to update any rows, assuming the partition has been stolen due to previously missing heartbeats.", db.identity, db.PrimaryPartition())
+		glog.Errorf(msg)
+		panic(msg)
+	} else if num != 1 {
+		return errors.New(fmt.Sprintf("AgreementBot %v, heartbeat update should have changed 1 row, but changed %v", db.identity, num))
+	} else {
+		glog.V(3).Infof("AgreementBot %v heartbeat", db.identity)
+	}
+	return nil
+}
+
+// Retrieve the heartbeat timestamp for a given partition.
+func (db *AgbotSqliteDB) GetHeartbeat() (uint64, error) {
+
+	var hb sql.NullInt64
+	if err := db.db.QueryRow(PARTITION_GET_HEARTBEAT, db.PrimaryPartition()).Scan(&hb); err != nil {
+		return 0, errors.New(fmt.Sprintf("error scanning partition %v heartbeat result, error: %v", db.PrimaryPartition(), err))
+	} else {
+		return uint64(hb.Int64), nil
+	}
+}
+
+// Quiesce our partition.
+func (db *AgbotSqliteDB) QuiescePartition() error {
+
+	if _, err := db.db.Exec(PARTITION_QUIESCE, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("Agbot %v unable to quiesce partition, error: %v", db.identity, err))
+	} else {
+		glog.V(3).Infof("AgreementBot %v quiesced partition", db.identity)
+	}
+	return nil
+}
+
+// Move all records from one partition to another if there is a stale or unowned partition in the database. The claim, the
+// move and the removal of the old partition are done in a single transaction so that if the agbot were to terminate during
+// this time, another agbot will eventually claim this partition and attempt this same cleanup again.
+func (db *AgbotSqliteDB) MovePartition(timeout uint64) (bool, error) {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("unable to start transaction for moving agreements, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	if fromPartition, err := db.claimUnownedPartition(tx, timeout); err != nil {
+		return false, err
+	} else if fromPartition == "" {
+		glog.V(3).Infof("AgreementBot %v did not find an unowned database partition.", db.identity)
+		return false, nil
+	} else if _, err := tx.Exec(AGREEMENT_PARTITION_MOVE, fromPartition, db.PrimaryPartition()); err != nil {
+		return false, err
+	} else if _, err := tx.Exec(WORKLOAD_USAGE_PARTITION_MOVE, fromPartition, db.PrimaryPartition()); err != nil {
+		return false, err
+	} else if _, err := tx.Exec(ROLLOUT_PARTITION_MOVE, fromPartition, db.PrimaryPartition()); err != nil {
+		return false, err
+	} else if _, err := tx.Exec(ROLLOUT_PARTITION_DELETE, fromPartition); err != nil {
+		return false, err
+	} else if _, err := tx.Exec(PARTITION_DELETE, fromPartition); err != nil {
+		return false, err
+	} else if err := tx.Commit(); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to commit transaction for moving agreements, error: %v", err))
+	} else {
+		glog.V(3).Infof("AgreementBot %v moved agreements from partition %v to %v", db.identity, fromPartition, db.PrimaryPartition())
+	}
+
+	// We found a partition and moved all the records.
+	return true, nil
+}
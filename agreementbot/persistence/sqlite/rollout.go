@@ -0,0 +1,203 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// Constants for the SQL statements that are used to work with rollouts. A rollout tracks the staged upgrade of the nodes
+// using a policy to a new service version. Each agbot rolls out the upgrade to the nodes whose agreements are in its
+// primary partition, so rollouts are partitioned like agreements and workload usages.
+//
+// rollouts schema:
+// policy_name: The name of the policy being rolled out.
+// partition:   The agbot partition that this rollout lives in.
+// rollout:     The rollout object which is a JSON blob. The blob schema is defined by the Rollout struct in the persistence package.
+// updated:     The unix time of the last update.
+//
+
+const ROLLOUT_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS rollouts (
+	policy_name TEXT NOT NULL,
+	partition TEXT NOT NULL,
+	rollout TEXT NOT NULL,
+	updated INTEGER DEFAULT (strftime('%s','now')),
+	PRIMARY KEY (policy_name, partition)
+);`
+
+const ROLLOUT_QUERY = `SELECT rollout FROM rollouts WHERE policy_name = ?1 AND partition = ?2;`
+const ALL_ROLLOUT_QUERY = `SELECT rollout FROM rollouts WHERE partition = ?1;`
+
+const ROLLOUT_INSERT = `INSERT OR REPLACE INTO rollouts (policy_name, partition, rollout) VALUES (?1, ?2, ?3);`
+const ROLLOUT_UPDATE = `UPDATE rollouts SET rollout = ?3, updated = strftime('%s','now') WHERE policy_name = ?1 AND partition = ?2;`
+const ROLLOUT_DELETE = `DELETE FROM rollouts WHERE policy_name = ?1 AND partition = ?2;`
+
+// When a partition is moved, its rollouts are moved too unless the primary partition already has a rollout for the same
+// policy. The agreements waiting for an upgrade are moved with their partition, so they join the rollout in the primary
+// partition.
+const ROLLOUT_PARTITION_MOVE = `UPDATE rollouts SET partition = ?2, updated = strftime('%s','now')
+	WHERE partition = ?1 AND policy_name NOT IN (SELECT policy_name FROM rollouts WHERE partition = ?2);`
+const ROLLOUT_PARTITION_DELETE = `DELETE FROM rollouts WHERE partition = ?1;`
+
+// Create a new rollout for the policy, replacing any rollout that already exists for the policy.
+func (db *AgbotSqliteDB) NewRollout(policyName string, version string, strategy policy.RolloutStrategy) (*persistence.Rollout, error) {
+	if r, err := persistence.NewRollout(policyName, version, strategy); err != nil {
+		return nil, err
+	} else if rm, err := json.Marshal(r); err != nil {
+		return nil, err
+	} else if _, err := db.db.Exec(ROLLOUT_INSERT, policyName, db.PrimaryPartition(), string(rm)); err != nil {
+		return nil, errors.New(fmt.Sprintf("error inserting rollout for policy %v, error: %v", policyName, err))
+	} else {
+		glog.V(2).Infof("Succeeded creating rollout record %v", r)
+		return r, nil
+	}
+}
+
+func (db *AgbotSqliteDB) internalFindSingleRolloutByPolicyName(tx *sql.Tx, policyName string) (*persistence.Rollout, error) {
+
+	var rBytes []byte
+	r := new(persistence.Rollout)
+
+	var qerr error
+	if tx == nil {
+		qerr = db.db.QueryRow(ROLLOUT_QUERY, policyName, db.PrimaryPartition()).Scan(&rBytes)
+	} else {
+		qerr = tx.QueryRow(ROLLOUT_QUERY, policyName, db.PrimaryPartition()).Scan(&rBytes)
+	}
+
+	if qerr == sql.ErrNoRows {
+		return nil, nil
+	} else if qerr != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for rollout of policy %v, error: %v", policyName, qerr))
+	} else if err := json.Unmarshal(rBytes, r); err != nil {
+		return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(rBytes), err))
+	} else {
+		return r, nil
+	}
+}
+
+func (db *AgbotSqliteDB) FindSingleRolloutByPolicyName(policyName string) (*persistence.Rollout, error) {
+	return db.internalFindSingleRolloutByPolicyName(nil, policyName)
+}
+
+func (db *AgbotSqliteDB) FindRollouts(filters []persistence.RFilter) ([]persistence.Rollout, error) {
+	rollouts := make([]persistence.Rollout, 0)
+
+	rows, err := db.db.Query(ALL_ROLLOUT_QUERY, db.PrimaryPartition())
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for rollouts, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var rBytes []byte
+		r := new(persistence.Rollout)
+		if err := rows.Scan(&rBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(rBytes, r); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(rBytes), err))
+		} else {
+			exclude := false
+			for _, filterFn := range filters {
+				if !filterFn(*r) {
+					exclude = true
+				}
+			}
+			if !exclude {
+				rollouts = append(rollouts, *r)
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	return rollouts, nil
+}
+
+func (db *AgbotSqliteDB) UpdateRolloutStrategy(policyName string, strategy policy.RolloutStrategy) (*persistence.Rollout, error) {
+	return persistence.UpdateRolloutStrategy(db, policyName, strategy)
+}
+
+func (db *AgbotSqliteDB) StartRolloutBatch(policyName string, devices []string, total int) (*persistence.Rollout, error) {
+	return persistence.StartRolloutBatch(db, policyName, devices, total)
+}
+
+func (db *AgbotSqliteDB) UpdateRolloutBatch(policyName string, upgraded []string, skipped []string, ended bool) (*persistence.Rollout, error) {
+	return persistence.UpdateRolloutBatch(db, policyName, upgraded, skipped, ended)
+}
+
+func (db *AgbotSqliteDB) FailRollout(policyName string, failed []string, reason string) (*persistence.Rollout, error) {
+	return persistence.FailRollout(db, policyName, failed, reason)
+}
+
+func (db *AgbotSqliteDB) CompleteRollout(policyName string) (*persistence.Rollout, error) {
+	return persistence.CompleteRollout(db, policyName)
+}
+
+func (db *AgbotSqliteDB) HaltRollout(policyName string, reason string) (*persistence.Rollout, error) {
+	return persistence.HaltRollout(db, policyName, reason)
+}
+
+func (db *AgbotSqliteDB) ResumeRollout(policyName string) (*persistence.Rollout, error) {
+	return persistence.ResumeRollout(db, policyName)
+}
+
+func (db *AgbotSqliteDB) DeleteRollout(policyName string) error {
+	if _, err := db.db.Exec(ROLLOUT_DELETE, policyName, db.PrimaryPartition()); err != nil {
+		return errors.New(fmt.Sprintf("error deleting rollout for policy %v, error: %v", policyName, err))
+	}
+	glog.V(5).Infof("Succeeded deleting rollout for policy %v from database.", policyName)
+	return nil
+}
+
+func (db *AgbotSqliteDB) SingleRolloutUpdate(policyName string, fn func(persistence.Rollout) *persistence.Rollout) (*persistence.Rollout, error) {
+	if r, err := db.FindSingleRolloutByPolicyName(policyName); err != nil {
+		return nil, err
+	} else if r == nil {
+		return nil, fmt.Errorf("Unable to locate rollout for policy: %v", policyName)
+	} else {
+		updated := fn(*r)
+		return db.wrapRolloutTransaction(policyName, updated)
+	}
+}
+
+func (db *AgbotSqliteDB) wrapRolloutTransaction(policyName string, updated *persistence.Rollout) (*persistence.Rollout, error) {
+
+	if tx, err := db.db.Begin(); err != nil {
+		return nil, err
+	} else if mod, err := db.persistUpdatedRollout(tx, policyName, updated); err != nil {
+		tx.Rollback()
+		return nil, err
+	} else {
+		return mod, tx.Commit()
+	}
+
+}
+
+// This function runs inside a transaction. It will atomicly read the rollout from the DB, verify that the updated
+// rollout object contains valid state transitions, and then write the updated rollout back to the database.
+func (db *AgbotSqliteDB) persistUpdatedRollout(tx *sql.Tx, policyName string, update *persistence.Rollout) (*persistence.Rollout, error) {
+
+	if mod, err := db.internalFindSingleRolloutByPolicyName(tx, policyName); err != nil {
+		return nil, err
+	} else if mod == nil {
+		return nil, errors.New(fmt.Sprintf("No rollout for policy %v available to update.", policyName))
+	} else {
+		persistence.ValidateRolloutStateTransition(mod, update)
+		if rm, err := json.Marshal(mod); err != nil {
+			return nil, err
+		} else if _, err := tx.Exec(ROLLOUT_UPDATE, policyName, db.PrimaryPartition(), string(rm)); err != nil {
+			return nil, err
+		}
+		glog.V(2).Infof("Succeeded writing rollout record %v", mod)
+		return mod, nil
+	}
+}
@@ -0,0 +1,207 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/cutil"
+	"strconv"
+	"time"
+)
+
+// Constants for the SQL statements that are used to manage search sessions. A search session is just a number. The Exchange
+// uses it like a key to indicate that a given policy search should return a single page of results. The Exchange keeps track of
+// the timestamp of the node that was most recently returned on a given search (keyed by the session number) so that future searches
+// with the same policy and session key will return nodes that have changed since the last one that was returned.
+//
+// The postgresql implementation uses stored procedures to manage the sessions. SQLite does not have stored procedures, so
+// the same logic is implemented by the functions in this file, each of which runs in a single transaction.
+//
+// schema:
+// policyName:          The fully qualified (org/policy-name) policy being searched
+// changedSince:        This is a linux epoch time stamp indicating that the exchange should return nodes that have changed since this time.
+// sessionToken:        This is a search session token, used to ensure that all agbots use the same session to search for nodes,
+//                      allowing the exchange to return a different page of results to each agbot.
+// sessionEnded:        Indicates that the current session is ended, so a new session can be allocated.
+// restartChangedSince: Indicates that an agbot was restarted, so this changedSince should be used when the next session is created.
+// updatingAgbot:       The UUID of the agbot that last updated this table/row.
+// updated:             The unix time when the agbot updated this table/row.
+//
+
+const SEARCH_SESSIONS_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS search_sessions (
+	policyName          TEXT    PRIMARY KEY,
+	changedSince        INTEGER NOT NULL,
+	sessionToken        INTEGER NOT NULL,
+	sessionEnded        BOOLEAN NOT NULL,
+	restartChangedSince INTEGER NOT NULL,
+	updatingAgbot       TEXT    NOT NULL,
+	updated             INTEGER DEFAULT (strftime('%s','now'))
+);`
+
+const SEARCH_SESSIONS_DUMP = `SELECT * FROM search_sessions;`
+
+const SEARCH_SESSIONS_QUERY = `SELECT changedSince, sessionToken, sessionEnded, restartChangedSince FROM search_sessions WHERE policyName = ?1;`
+
+const SEARCH_SESSIONS_INSERT = `INSERT INTO search_sessions (policyName, changedSince, sessionToken, sessionEnded, restartChangedSince, updatingAgbot)
+	VALUES (?1, 0, ?2, false, 0, ?3);`
+
+const SEARCH_SESSIONS_UPDATE_SESSION = `UPDATE search_sessions
+	SET changedSince = ?2, sessionToken = ?3, sessionEnded = false, restartChangedSince = 0, updatingAgbot = ?4, updated = strftime('%s','now')
+	WHERE policyName = ?1;`
+
+const SEARCH_SESSIONS_UPDATE_CHANGED_SINCE = `UPDATE search_sessions
+	SET changedSince = ?2, sessionEnded = true, updatingAgbot = ?3, updated = strftime('%s','now')
+	WHERE policyName = ?1;`
+
+const SEARCH_SESSIONS_RESET_CHANGED_SINCE_ACTIVE = `UPDATE search_sessions
+	SET restartChangedSince = ?1, updatingAgbot = ?2, updated = strftime('%s','now')
+	WHERE sessionEnded = false;`
+
+const SEARCH_SESSIONS_RESET_CHANGED_SINCE_ENDED = `UPDATE search_sessions
+	SET changedSince = ?1, updatingAgbot = ?2, updated = strftime('%s','now')
+	WHERE sessionEnded = true;`
+
+const SEARCH_SESSIONS_RESET_CHANGED_SINCE_FOR_POLICY = `UPDATE search_sessions
+	SET restartChangedSince = ?1, updatingAgbot = ?3, updated = strftime('%s','now')
+	WHERE policyName = ?2 AND (restartChangedSince = 0 OR restartChangedSince > ?1);
+`
+
+// The first session token allocated for a policy, and the token after which session tokens roll over to 1. These
+// are the same values used by the postgresql implementation.
+const SEARCH_SESSION_INITIAL_TOKEN = 1999999998
+const SEARCH_SESSION_MAX_TOKEN = 2000000000
+
+// Functions related to the search session table.
+
+// Get the current search session from the DB. If the current session is ended, then a new session token will
+// be allocated and stored in the DB.
+func (db *AgbotSqliteDB) ObtainSearchSession(policyName string) (string, uint64, error) {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("unable to start transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	var changedSince, token, restartChangedSince int64
+	var ended bool
+	if err := tx.QueryRow(SEARCH_SESSIONS_QUERY, policyName).Scan(&changedSince, &token, &ended, &restartChangedSince); err == sql.ErrNoRows {
+
+		// There is no session for this policy yet, so start one.
+		token = SEARCH_SESSION_INITIAL_TOKEN
+		changedSince = 0
+		if _, err := tx.Exec(SEARCH_SESSIONS_INSERT, policyName, token, db.identity); err != nil {
+			return "", 0, errors.New(fmt.Sprintf("error inserting %v search session, error: %v", policyName, err))
+		}
+
+	} else if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("error obtaining %v search session, error: %v", policyName, err))
+
+	} else if ended {
+
+		// Use the changedSince from an agbot restart if there is one, and then get a new session token. The session token
+		// is actually a number so be careful of the number rolling over.
+		if restartChangedSince != 0 {
+			changedSince = restartChangedSince
+		}
+		token += 1
+		if token > SEARCH_SESSION_MAX_TOKEN {
+			token = 1
+		}
+		if _, err := tx.Exec(SEARCH_SESSIONS_UPDATE_SESSION, policyName, changedSince, token, db.identity); err != nil {
+			return "", 0, errors.New(fmt.Sprintf("error updating %v search session, error: %v", policyName, err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, errors.New(fmt.Sprintf("unable to commit %v search session, error: %v", policyName, err))
+	}
+	return strconv.FormatInt(token, 10), uint64(changedSince), nil
+}
+
+// Update the changed since time in the DB and mark the current session as ended. This is done when a node scan has completed
+// successfully and all pages of nodes have been processed. The returned boolean indicates whether or not the session was
+// already ended. If true, it means that another agbot ended the session before the caller did, which can happen normally.
+// However, it is an indication to the calling agbot that it processing the current search session overlapping the other agbot.
+// This usually means the agbot should do one more node search, just to be sure nothing was missed.
+func (db *AgbotSqliteDB) UpdateSearchSessionChangedSince(currentChangedSince uint64, newChangedSince uint64, policyName string) (bool, error) {
+
+	glog.V(3).Infof("AgreementBot updating changedSince from %v to %v for %v search session", time.Unix(int64(currentChangedSince), 0).Format(cutil.ExchangeTimeFormat), time.Unix(int64(newChangedSince), 0).Format(cutil.ExchangeTimeFormat), policyName)
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("unable to start transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	var changedSince, token, restartChangedSince int64
+	var ended bool
+	if err := tx.QueryRow(SEARCH_SESSIONS_QUERY, policyName).Scan(&changedSince, &token, &ended, &restartChangedSince); err != nil {
+		return false, errors.New(fmt.Sprintf("error updating %v search session changedSince, error: %v", policyName, err))
+	} else if ended || uint64(changedSince) != currentChangedSince {
+		return ended, nil
+	} else if _, err := tx.Exec(SEARCH_SESSIONS_UPDATE_CHANGED_SINCE, policyName, newChangedSince, db.identity); err != nil {
+		return false, errors.New(fmt.Sprintf("error updating %v search session changedSince, error: %v", policyName, err))
+	} else if err := tx.Commit(); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to commit %v search session changedSince, error: %v", policyName, err))
+	}
+	return false, nil
+}
+
+// Update all search session with a new changed Since to account for possible lost search results when an agbot restarts.
+func (db *AgbotSqliteDB) ResetAllChangedSince(newChangedSince uint64) error {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to start transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(SEARCH_SESSIONS_RESET_CHANGED_SINCE_ACTIVE, newChangedSince, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("error resetting changed since in active search sessions, error: %v", err))
+	} else if _, err := tx.Exec(SEARCH_SESSIONS_RESET_CHANGED_SINCE_ENDED, newChangedSince, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("error resetting changed since in ended search sessions, error: %v", err))
+	}
+	return tx.Commit()
+}
+
+// Update search session for a specific policy with a new changed Since to account for possible lost search results.
+func (db *AgbotSqliteDB) ResetPolicyChangedSince(policy string, newChangedSince uint64) error {
+	if _, err := db.db.Exec(SEARCH_SESSIONS_RESET_CHANGED_SINCE_FOR_POLICY, newChangedSince, policy, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("error resetting changed since in %v search sessions, error: %v", policy, err))
+	}
+	return nil
+}
+
+type ssRecord struct {
+	pn string
+	cs int64
+	st int64
+	se bool
+	r  int64
+	ua string
+	up int64
+}
+
+func (r ssRecord) String() string {
+	return fmt.Sprintf("Policy: %v, ChangedSince: %v, SessionToken: %v, SessionEnded: %v, RestartCS: %v, Agbot: %v, Updated: %v", r.pn, r.cs, r.st, r.se, r.r, r.ua, r.up)
+}
+
+// Log the contents of the search session table.
+func (db *AgbotSqliteDB) DumpSearchSessions() error {
+	if rows, err := db.db.Query(SEARCH_SESSIONS_DUMP); err != nil {
+		return errors.New(fmt.Sprintf("error dumping search sessions, error: %v", err))
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			out := ssRecord{}
+			if err := rows.Scan(&out.pn, &out.cs, &out.st, &out.se, &out.r, &out.ua, &out.up); err != nil {
+				glog.Errorf("AgbotDB: error dumping search sessions table, error: %v", err)
+			} else {
+				glog.V(4).Infof("Search Session: %v", out)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// Constants for the SQL statements that are used to work with the execution failures of workload versions. The failures
+// of a version are counted across all of the nodes using the policy, so they are not partitioned.
+//
+// version_failures schema:
+// policy_name:      The name of the policy containing the workload.
+// version:          The workload version.
+// version_failures: The version failures object which is a JSON blob. The blob schema is defined by the VersionFailures struct in the persistence package.
+// updated:          The unix time of the last update.
+//
+
+const VERSION_FAILURE_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS version_failures (
+	policy_name TEXT NOT NULL,
+	version TEXT NOT NULL,
+	version_failures TEXT NOT NULL,
+	updated INTEGER DEFAULT (strftime('%s','now')),
+	PRIMARY KEY (policy_name, version)
+);`
+
+const ALL_VERSION_FAILURE_QUERY = `SELECT version_failures FROM version_failures;`
+const VERSION_FAILURE_QUERY = `SELECT version_failures FROM version_failures WHERE policy_name = ?1 AND version = ?2;`
+
+const VERSION_FAILURE_INSERT = `INSERT OR REPLACE INTO version_failures (policy_name, version, version_failures) VALUES (?1, ?2, ?3);`
+const VERSION_FAILURE_DELETE = `DELETE FROM version_failures WHERE policy_name = ?1 AND version = ?2;`
+
+// Record an execution failure of a workload version of a policy on a node, dropping the failures before the given time.
+func (db *AgbotSqliteDB) RecordVersionFailure(policyName string, version string, deviceId string, since uint64) (*persistence.VersionFailures, error) {
+	vf, err := persistence.NewVersionFailures(policyName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	var vfBytes []byte
+	if err := tx.QueryRow(VERSION_FAILURE_QUERY, policyName, version).Scan(&vfBytes); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return nil, errors.New(fmt.Sprintf("error scanning row for failures of version %v of policy %v, error: %v", version, policyName, err))
+	} else if err == nil {
+		if err := json.Unmarshal(vfBytes, vf); err != nil {
+			tx.Rollback()
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(vfBytes), err))
+		}
+	}
+
+	vf.AddFailure(deviceId, since)
+	if vfm, err := json.Marshal(vf); err != nil {
+		tx.Rollback()
+		return nil, err
+	} else if _, err := tx.Exec(VERSION_FAILURE_INSERT, policyName, version, string(vfm)); err != nil {
+		tx.Rollback()
+		return nil, errors.New(fmt.Sprintf("error recording failure of version %v for policy %v, error: %v", version, policyName, err))
+	}
+	glog.V(5).Infof("Succeeded recording version failure %v", vf)
+	return vf, tx.Commit()
+}
+
+func (db *AgbotSqliteDB) FindVersionFailures(filters []persistence.VFFilter) ([]persistence.VersionFailures, error) {
+	vfs := make([]persistence.VersionFailures, 0)
+
+	rows, err := db.db.Query(ALL_VERSION_FAILURE_QUERY)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for version failures, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var vfBytes []byte
+		vf := new(persistence.VersionFailures)
+		if err := rows.Scan(&vfBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(vfBytes, vf); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(vfBytes), err))
+		} else {
+			exclude := false
+			for _, filterFn := range filters {
+				if !filterFn(*vf) {
+					exclude = true
+				}
+			}
+			if !exclude {
+				vfs = append(vfs, *vf)
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	return vfs, nil
+}
+
+func (db *AgbotSqliteDB) DeleteVersionFailures(policyName string, version string) error {
+	if _, err := db.db.Exec(VERSION_FAILURE_DELETE, policyName, version); err != nil {
+		return errors.New(fmt.Sprintf("error deleting failures of version %v for policy %v, error: %v", version, policyName, err))
+	}
+	glog.V(5).Infof("Succeeded deleting failures of version %v for policy %v from database.", version, policyName)
+	return nil
+}
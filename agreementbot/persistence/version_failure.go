@@ -0,0 +1,76 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The execution failures of a workload version of a policy, across all of the nodes running it. The circuit breaker
+// judges the version by these failures. They are kept apart from the workload usage of each node, so that the failure
+// of a node is still counted after the node is rolled back to another priority. Only the failures within the failure
+// window of the circuit breaker are kept, older failures are dropped when a new failure is recorded. Like bad versions,
+// version failures apply to all of the agbots sharing the database, so they are not partitioned.
+
+type VersionFailures struct {
+	PolicyName string          `json:"policy_name"` // the name of the policy containing the workload
+	Version    string          `json:"version"`     // the workload version
+	Failures   []DeviceFailure `json:"failures"`    // the execution failures of the version, oldest first
+}
+
+// An execution failure of a workload version on a node.
+type DeviceFailure struct {
+	DeviceId string `json:"device_id"`
+	Time     uint64 `json:"time"` // time of the failure
+}
+
+func (v VersionFailures) String() string {
+	return fmt.Sprintf("PolicyName: %v, "+
+		"Version: %v, "+
+		"Failures: %v",
+		v.PolicyName, v.Version, v.Failures)
+}
+
+// Returns the nodes on which the version failed at or after the given time, each node once.
+func (v VersionFailures) FailedDevices(since uint64) []string {
+	devices := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, f := range v.Failures {
+		if f.Time >= since && !seen[f.DeviceId] {
+			seen[f.DeviceId] = true
+			devices = append(devices, f.DeviceId)
+		}
+	}
+	return devices
+}
+
+// Add a failure of the version on the node, and drop the failures before the given time.
+func (v *VersionFailures) AddFailure(deviceId string, since uint64) {
+	failures := make([]DeviceFailure, 0, len(v.Failures)+1)
+	for _, f := range v.Failures {
+		if f.Time >= since {
+			failures = append(failures, f)
+		}
+	}
+	v.Failures = append(failures, DeviceFailure{DeviceId: deviceId, Time: uint64(time.Now().Unix())})
+}
+
+// factory method for version failures w/out persistence safety:
+func NewVersionFailures(policyName string, version string) (*VersionFailures, error) {
+	if policyName == "" || version == "" {
+		return nil, errors.New("Illegal input: one of policyName or version is empty")
+	} else {
+		return &VersionFailures{
+			PolicyName: policyName,
+			Version:    version,
+			Failures:   make([]DeviceFailure, 0),
+		}, nil
+	}
+}
+
+// Filters
+func PolicyVFFilter(policyName string) VFFilter {
+	return func(v VersionFailures) bool { return v.PolicyName == policyName }
+}
+
+type VFFilter func(VersionFailures) bool
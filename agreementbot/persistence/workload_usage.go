@@ -219,4 +219,8 @@ func PWUFilter(policyName string) WUFilter {
 	return func(a WorkloadUsage) bool { return a.PolicyName == policyName }
 }
 
+func PriWUFilter(policyName string, priority int) WUFilter {
+	return func(a WorkloadUsage) bool { return a.PolicyName == policyName && a.Priority == priority }
+}
+
 type WUFilter func(WorkloadUsage) bool
@@ -92,6 +92,16 @@ func (n *PrioritizedWorkQueue) HighPriorityBufferLen() int {
 	return len(n.workQueueBufferHigh)
 }
 
+// The total amount of high priority work waiting to be dispatched, including work not yet moved from the inbound channel.
+func (n *PrioritizedWorkQueue) HighPriorityDepth() int {
+	return n.HighPriorityBufferLen() + len(n.inboundHigh)
+}
+
+// The total amount of low priority work waiting to be dispatched, including work not yet moved from the inbound channel.
+func (n *PrioritizedWorkQueue) LowPriorityDepth() int {
+	return n.LowPriorityBufferLen() + len(n.inboundLow)
+}
+
 func (n *PrioritizedWorkQueue) GetHighPriorityBufferHead() *AgreementWork {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
@@ -0,0 +1,279 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/policy"
+	"sort"
+	"time"
+)
+
+// Workload upgrades for a policy with a rollout strategy are staged. When the service version in the policy changes,
+// a rollout is recorded for the new version and the agreements using the policy are marked pending upgrade. Governance
+// then releases the pending agreements for upgrade in batches. The next batch starts only after every node in the
+// current batch has run the new version for the success window, and the pause between batches has elapsed. When a
+// node in the batch reports an execution failure, the rollout fails and no more nodes are released until a user
+// resumes it. A forced workload upgrade of a node waits for the rollout of the policy in the same way.
+
+// The outcome of the upgrade of a node in a rollout batch.
+const ROLLOUT_DEVICE_WAITING = "waiting"
+const ROLLOUT_DEVICE_UPGRADED = "upgraded"
+const ROLLOUT_DEVICE_FAILED = "failed"
+const ROLLOUT_DEVICE_SKIPPED = "skipped"
+
+// Nodes in a batch that have not made a new agreement within this many seconds are skipped by the rollout.
+const ROLLOUT_DEVICE_TIMEOUT_S = 3600
+
+// Returns the service version that new agreements using the policy will start with.
+func rolloutVersion(pol *policy.Policy) string {
+	if len(pol.Workloads) == 0 {
+		return ""
+	}
+	return pol.NextHighestPriorityWorkload(0, 0, 0).Version
+}
+
+// Returns the rollout that stages the upgrade of agreements to the new policy, or nil if the upgrade is not staged. The
+// rollout for the new service version is created if it does not exist yet. When the policy has no rollout strategy, any
+// rollout left over from an earlier version of the policy is removed so that it no longer holds back upgrades.
+func rolloutUpgrade(db persistence.AgbotDatabase, newPol *policy.Policy, policyName string) *persistence.Rollout {
+
+	if newPol.RolloutStrategy == nil {
+		if err := db.DeleteRollout(policyName); err != nil {
+			glog.Errorf(roLogString(fmt.Sprintf("unable to delete rollout for policy %v, error: %v", policyName, err)))
+		}
+		return nil
+	}
+
+	version := rolloutVersion(newPol)
+	r, err := db.FindSingleRolloutByPolicyName(policyName)
+	if err != nil {
+		glog.Errorf(roLogString(fmt.Sprintf("unable to read rollout for policy %v, error: %v", policyName, err)))
+		return nil
+	} else if r == nil || r.Version != version {
+		if r, err = db.NewRollout(policyName, version, *newPol.RolloutStrategy); err != nil {
+			glog.Errorf(roLogString(fmt.Sprintf("unable to create rollout of version %v for policy %v, error: %v", version, policyName, err)))
+			return nil
+		}
+		glog.V(3).Infof(roLogString(fmt.Sprintf("started rollout of version %v for policy %v", version, policyName)))
+	} else if r.Strategy != *newPol.RolloutStrategy {
+		if updated, err := db.UpdateRolloutStrategy(policyName, *newPol.RolloutStrategy); err != nil {
+			glog.Errorf(roLogString(fmt.Sprintf("unable to update rollout strategy for policy %v, error: %v", policyName, err)))
+		} else {
+			r = updated
+		}
+	}
+	return r
+}
+
+// Returns the rollout of the policy, or nil if the policy has no rollout or it cannot be read.
+func policyRollout(db persistence.AgbotDatabase, policyName string) *persistence.Rollout {
+	r, err := db.FindSingleRolloutByPolicyName(policyName)
+	if err != nil {
+		glog.Errorf(roLogString(fmt.Sprintf("unable to read rollout for policy %v, error: %v", policyName, err)))
+		return nil
+	}
+	return r
+}
+
+// Returns true if the rollout holds back the upgrade of the agreement, because the node is not in the current batch.
+// A nil rollout holds back nothing.
+func rolloutHolds(r *persistence.Rollout, ag *persistence.Agreement) bool {
+	return r != nil && !rolloutReleases(map[string]persistence.Rollout{r.PolicyName: *r}, ag)
+}
+
+// Returns true if the rollouts allow the pending upgrade of the agreement to start. Upgrades of policies without a
+// rollout, or whose rollout has completed, are not held back. A nil map means the rollouts could not be read, in
+// which case no upgrades are started.
+func rolloutReleases(rollouts map[string]persistence.Rollout, ag *persistence.Agreement) bool {
+	if rollouts == nil {
+		return false
+	} else if r, ok := rollouts[ag.PolicyName]; !ok || r.State == persistence.ROLLOUT_STATE_COMPLETED {
+		return true
+	} else {
+		return r.IsActive() && r.InBatch(ag.DeviceId)
+	}
+}
+
+// Returns the outcome of the upgrade of a node in the current batch, given all the agreements between the node and
+// the rollout's policy. Agreements made before the batch started are ignored, unless the upgrade of that agreement
+// is still waiting to start.
+func rolloutDeviceState(agreements []persistence.Agreement, batchStart uint64, successWindowS uint64, now uint64, isFailure func(ag *persistence.Agreement) bool) string {
+
+	upgraded := false
+	waiting := false
+	for _, ag := range agreements {
+		if ag.AgreementInceptionTime < batchStart {
+			if !ag.Archived {
+				waiting = true
+			}
+		} else if ag.Archived {
+			if isFailure(&ag) {
+				return ROLLOUT_DEVICE_FAILED
+			}
+		} else if ag.AgreementCreationTime != 0 && ag.AgreementCreationTime+successWindowS <= now {
+			upgraded = true
+		} else {
+			waiting = true
+		}
+	}
+
+	if upgraded {
+		return ROLLOUT_DEVICE_UPGRADED
+	} else if waiting || now < batchStart+ROLLOUT_DEVICE_TIMEOUT_S {
+		return ROLLOUT_DEVICE_WAITING
+	}
+	return ROLLOUT_DEVICE_SKIPPED
+}
+
+// Move each active rollout forward and return all of the rollouts, keyed by policy name. Nil is returned if the
+// rollouts cannot be read.
+func (w *AgreementBotWorker) governRollouts() map[string]persistence.Rollout {
+
+	rollouts, err := w.db.FindRollouts([]persistence.RFilter{})
+	if err != nil {
+		glog.Errorf(roLogString(fmt.Sprintf("unable to read rollouts, error: %v", err)))
+		return nil
+	}
+
+	res := make(map[string]persistence.Rollout, len(rollouts))
+	for _, r := range rollouts {
+		if r.IsActive() {
+			if updated := w.advanceRollout(r); updated != nil {
+				r = *updated
+			}
+		}
+		res[r.PolicyName] = r
+	}
+	return res
+}
+
+// Check the outcome of the current batch of the rollout and start the next batch when it is time. Returns the updated
+// rollout, or nil if the rollout did not change.
+func (w *AgreementBotWorker) advanceRollout(r persistence.Rollout) *persistence.Rollout {
+
+	now := uint64(time.Now().Unix())
+	var updated *persistence.Rollout
+	var err error
+
+	// Check on the nodes in the current batch.
+	if r.Batch != 0 && r.BatchEndTime == 0 {
+		upgraded := make([]string, 0)
+		failed := make([]string, 0)
+		skipped := make([]string, 0)
+		waiting := false
+
+		for _, deviceId := range r.BatchDevices {
+			if cutil.SliceContains(r.UpgradedDevices, deviceId) || cutil.SliceContains(r.SkippedDevices, deviceId) {
+				continue
+			}
+			switch w.rolloutDeviceState(&r, deviceId, now) {
+			case ROLLOUT_DEVICE_UPGRADED:
+				upgraded = append(upgraded, deviceId)
+			case ROLLOUT_DEVICE_FAILED:
+				failed = append(failed, deviceId)
+			case ROLLOUT_DEVICE_SKIPPED:
+				skipped = append(skipped, deviceId)
+			default:
+				waiting = true
+			}
+		}
+
+		if len(failed) != 0 {
+			reason := fmt.Sprintf("execution failed on %v after the upgrade to version %v", failed, r.Version)
+			glog.Warningf(roLogString(fmt.Sprintf("rollout for policy %v failed in batch %v, %v", r.PolicyName, r.Batch, reason)))
+			if updated, err = w.db.FailRollout(r.PolicyName, failed, reason); err != nil {
+				glog.Errorf(roLogString(fmt.Sprintf("unable to fail rollout for policy %v, error: %v", r.PolicyName, err)))
+			}
+			return updated
+		} else if len(upgraded) != 0 || len(skipped) != 0 || !waiting {
+			if updated, err = w.db.UpdateRolloutBatch(r.PolicyName, upgraded, skipped, !waiting); err != nil {
+				glog.Errorf(roLogString(fmt.Sprintf("unable to update rollout for policy %v, error: %v", r.PolicyName, err)))
+				return nil
+			}
+			r = *updated
+		}
+
+		if waiting {
+			return updated
+		}
+		glog.V(3).Infof(roLogString(fmt.Sprintf("rollout for policy %v completed batch %v", r.PolicyName, r.Batch)))
+	}
+
+	// Wait for the pause after the previous batch before starting the next one.
+	if r.Batch != 0 && now < r.BatchEndTime+uint64(r.Strategy.BatchPauseDuration().Seconds()) {
+		return updated
+	}
+
+	// The next batch is taken from the agreements that are still waiting for the upgrade. A rollout that has not
+	// started a batch yet waits for the agreements to be marked.
+	pending := w.rolloutPendingDevices(r.PolicyName)
+	if len(pending) == 0 {
+		if r.Batch != 0 {
+			glog.V(3).Infof(roLogString(fmt.Sprintf("rollout of version %v for policy %v completed", r.Version, r.PolicyName)))
+			if updated, err = w.db.CompleteRollout(r.PolicyName); err != nil {
+				glog.Errorf(roLogString(fmt.Sprintf("unable to complete rollout for policy %v, error: %v", r.PolicyName, err)))
+			}
+		}
+		return updated
+	}
+
+	total := r.TotalDevices
+	if r.Batch == 0 {
+		total = len(pending)
+	}
+	batch := pending[:r.Strategy.BatchCount(r.Batch+1, total, len(pending))]
+
+	glog.V(3).Infof(roLogString(fmt.Sprintf("rollout for policy %v starting batch %v with %v", r.PolicyName, r.Batch+1, batch)))
+	if updated, err = w.db.StartRolloutBatch(r.PolicyName, batch, total); err != nil {
+		glog.Errorf(roLogString(fmt.Sprintf("unable to start batch for rollout of policy %v, error: %v", r.PolicyName, err)))
+	}
+	return updated
+}
+
+// Returns the outcome of the upgrade of a node in the current batch of the rollout.
+func (w *AgreementBotWorker) rolloutDeviceState(r *persistence.Rollout, deviceId string, now uint64) string {
+	agreements := make([]persistence.Agreement, 0)
+	for _, agp := range policy.AllAgreementProtocols() {
+		if ags, err := w.db.FindAgreements([]persistence.AFilter{persistence.DevPolAFilter(deviceId, r.PolicyName)}, agp); err != nil {
+			glog.Errorf(roLogString(fmt.Sprintf("unable to read agreements for %v, error: %v", deviceId, err)))
+			return ROLLOUT_DEVICE_WAITING
+		} else {
+			agreements = append(agreements, ags...)
+		}
+	}
+
+	isFailure := func(ag *persistence.Agreement) bool {
+		return w.consumerPH.Get(ag.AgreementProtocol).IsTerminationReasonExecutionFailure(ag.TerminatedReason)
+	}
+
+	return rolloutDeviceState(agreements, r.BatchStartTime, uint64(r.Strategy.SuccessWindowDuration().Seconds()), now, isFailure)
+}
+
+// Returns the sorted ids of the nodes whose agreements with the policy are waiting for an upgrade.
+func (w *AgreementBotWorker) rolloutPendingDevices(policyName string) []string {
+
+	pendingFilter := func() persistence.AFilter {
+		return func(a persistence.Agreement) bool { return a.PolicyName == policyName && a.UpgradePendingTime != 0 }
+	}
+
+	devices := make([]string, 0)
+	for _, agp := range policy.AllAgreementProtocols() {
+		if agreements, err := w.db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), pendingFilter()}, agp); err != nil {
+			glog.Errorf(roLogString(fmt.Sprintf("unable to read agreements pending upgrade for policy %v, error: %v", policyName, err)))
+		} else {
+			for _, ag := range agreements {
+				if !cutil.SliceContains(devices, ag.DeviceId) {
+					devices = append(devices, ag.DeviceId)
+				}
+			}
+		}
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+var roLogString = func(v interface{}) string {
+	return fmt.Sprintf("AgreementBot Rollout: %v", v)
+}
@@ -0,0 +1,92 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+func Test_rolloutDeviceState(t *testing.T) {
+	batchStart := uint64(1000)
+	isFailure := func(ag *persistence.Agreement) bool { return ag.TerminatedReason == 1 }
+
+	old := persistence.Agreement{AgreementInceptionTime: 500, AgreementCreationTime: 500}
+	failed := persistence.Agreement{AgreementInceptionTime: 1100, Archived: true, TerminatedReason: 1}
+	cancelled := persistence.Agreement{AgreementInceptionTime: 1100, Archived: true, TerminatedReason: 2}
+	running := persistence.Agreement{AgreementInceptionTime: 1100, AgreementCreationTime: 1200}
+
+	if s := rolloutDeviceState([]persistence.Agreement{failed, running}, batchStart, 60, 2000, isFailure); s != ROLLOUT_DEVICE_FAILED {
+		t.Errorf("device should have failed, got %v", s)
+	} else if s := rolloutDeviceState([]persistence.Agreement{cancelled, running}, batchStart, 60, 2000, isFailure); s != ROLLOUT_DEVICE_UPGRADED {
+		t.Errorf("device should be upgraded, got %v", s)
+	} else if s := rolloutDeviceState([]persistence.Agreement{running}, batchStart, 900, 2000, isFailure); s != ROLLOUT_DEVICE_WAITING {
+		t.Errorf("device should be waiting for the success window, got %v", s)
+	} else if s := rolloutDeviceState([]persistence.Agreement{old}, batchStart, 60, batchStart+ROLLOUT_DEVICE_TIMEOUT_S+1, isFailure); s != ROLLOUT_DEVICE_WAITING {
+		t.Errorf("device with a pending agreement should be waiting, got %v", s)
+	} else if s := rolloutDeviceState([]persistence.Agreement{}, batchStart, 60, 2000, isFailure); s != ROLLOUT_DEVICE_WAITING {
+		t.Errorf("device without agreements should be waiting, got %v", s)
+	} else if s := rolloutDeviceState([]persistence.Agreement{cancelled}, batchStart, 60, batchStart+ROLLOUT_DEVICE_TIMEOUT_S, isFailure); s != ROLLOUT_DEVICE_SKIPPED {
+		t.Errorf("device without agreements should be skipped after the timeout, got %v", s)
+	}
+}
+
+func Test_rolloutReleases(t *testing.T) {
+	ag := &persistence.Agreement{DeviceId: "myorg/device1", PolicyName: "myorg/pol1"}
+	other := &persistence.Agreement{DeviceId: "myorg/device2", PolicyName: "myorg/pol1"}
+
+	if rolloutReleases(nil, ag) {
+		t.Errorf("upgrades should not start when the rollouts are unknown")
+	} else if !rolloutReleases(map[string]persistence.Rollout{}, ag) {
+		t.Errorf("upgrades without a rollout should start")
+	}
+
+	r, _ := persistence.NewRollout("myorg/pol1", "1.0.0", policy.RolloutStrategy{CanaryCount: 1})
+	r.BatchDevices = []string{"myorg/device1"}
+	rollouts := map[string]persistence.Rollout{"myorg/pol1": *r}
+
+	if !rolloutReleases(rollouts, ag) {
+		t.Errorf("upgrade of a device in the batch should start")
+	} else if rolloutReleases(rollouts, other) {
+		t.Errorf("upgrade of a device outside the batch should not start")
+	}
+
+	r.State = persistence.ROLLOUT_STATE_HALTED
+	rollouts["myorg/pol1"] = *r
+	if rolloutReleases(rollouts, ag) {
+		t.Errorf("upgrades should not start when the rollout is halted")
+	}
+
+	r.State = persistence.ROLLOUT_STATE_COMPLETED
+	rollouts["myorg/pol1"] = *r
+	if !rolloutReleases(rollouts, other) {
+		t.Errorf("upgrades should start when the rollout is completed")
+	}
+}
+
+func Test_rolloutHolds(t *testing.T) {
+	ag := &persistence.Agreement{DeviceId: "myorg/device1", PolicyName: "myorg/pol1"}
+	other := &persistence.Agreement{DeviceId: "myorg/device2", PolicyName: "myorg/pol1"}
+
+	if rolloutHolds(nil, ag) {
+		t.Errorf("upgrades without a rollout should not be held back")
+	}
+
+	r, _ := persistence.NewRollout("myorg/pol1", "1.0.0", policy.RolloutStrategy{CanaryCount: 1})
+	if !rolloutHolds(r, ag) {
+		t.Errorf("upgrades should be held back until the first batch starts")
+	}
+
+	r.BatchDevices = []string{"myorg/device1"}
+	if rolloutHolds(r, ag) {
+		t.Errorf("upgrade of a device in the batch should not be held back")
+	} else if !rolloutHolds(r, other) {
+		t.Errorf("upgrade of a device outside the batch should be held back")
+	}
+
+	r.State = persistence.ROLLOUT_STATE_COMPLETED
+	if rolloutHolds(r, other) {
+		t.Errorf("upgrades should not be held back when the rollout is completed")
+	}
+}
@@ -176,7 +176,7 @@ func (a *SecureAPI) listen() {
 // @Accept  json
 // @Produce json
 // @Param   checkAll     		query    bool     false        "Return the compatibility check result for all the service versions referenced in the business policy or pattern."
-// @Param   long         		query    bool     false        "Show the input which was used to come up with the result."
+// @Param   long         		query    bool     false        "Show the input which was used to come up with the result, and the evaluation of each constraint sub-expression against the property values."
 // @Param   node_id      		body     string   false        "The exchange id of the node. Mutually exclusive with node_policy."
 // @Param   node_arch    		body     string   false        "The architecture of the node."
 // @Param   node_policy  		body     externalpolicy.ExternalPolicy     false        "The node policy that will be put in the exchange. Mutually exclusive with node_id."
@@ -211,10 +211,11 @@ func (a *SecureAPI) policy_compatible(w http.ResponseWriter, r *http.Request) {
 				// do policy compatibility check
 				output, err := compcheck.PolicyCompatible(user_ec, input, (checkAll != ""), msgPrinter)
 
-				// nil out the policies in the output if 'long' is not set in the request
+				// nil out the policies and the constraint evaluation in the output if 'long' is not set in the request
 				long := r.URL.Query().Get("long")
 				if long == "" && output != nil {
 					output.Input = nil
+					output.Detail = nil
 				}
 
 				// write the output
@@ -337,6 +338,7 @@ func (a *SecureAPI) deploy_compatible(w http.ResponseWriter, r *http.Request) {
 				long := r.URL.Query().Get("long")
 				if long == "" && output != nil {
 					output.Input = nil
+					output.Detail = nil
 				}
 
 				// write the output
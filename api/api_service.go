@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
@@ -239,3 +240,48 @@ func (a *API) servicepolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// For listing and deleting the docker volumes that are created for the services.
+func (a *API) servicevolume(w http.ResponseWriter, r *http.Request) {
+
+	resource := "service/volume"
+	errorhandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		if out, err := FindServiceVolumesForOutput(a.db); err != nil {
+			errorhandler(NewSystemError(fmt.Sprintf("Error getting %v for output, error %v", resource, err)))
+		} else {
+			writeResponse(w, out, http.StatusOK)
+		}
+
+	case "DELETE":
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+		pathVars := mux.Vars(r)
+		name := pathVars["name"]
+
+		if name == "" {
+			errorhandler(NewBadRequestError(fmt.Sprintf("path variable missing on DELETE %v", resource)))
+			return
+		}
+
+		deleteVolume := func(cv *persistence.ContainerVolume) error {
+			return container.DeleteContainerVolume(a.db, a.Config, cv)
+		}
+		if errHandled := DeleteServiceVolume(errorhandler, name, deleteVolume, a.db); errHandled {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, DELETE, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -4,21 +4,23 @@ import (
 	"errors"
 	"fmt"
 	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/cutil"
 )
 
-// Get docker container metadata from the docker API for workload containers
-func GetWorkloadContainers(dockerEndpoint string, agreementId string) ([]dockerclient.APIContainers, error) {
-	if client, err := dockerclient.NewClient(dockerEndpoint); err != nil {
-		return nil, errors.New(fmt.Sprintf("unable to create docker client from %v, error %v", dockerEndpoint, err))
+// Get docker container metadata from the container runtime for workload containers
+func GetWorkloadContainers(cfg *config.HorizonConfig, agreementId string) ([]dockerclient.APIContainers, error) {
+	if client, err := containerruntime.NewAgentContainerRuntime(cfg); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create %v client from %v, error %v", cfg.GetContainerRuntime(), cfg.Edge.DockerEndpoint, err))
 	} else {
 		opts := dockerclient.ListContainersOptions{
 			All: true,
 		}
 
 		if containers, err := client.ListContainers(opts); err != nil {
-			return nil, errors.New(fmt.Sprintf("unable to list docker containers from %v, error %v", dockerEndpoint, err))
+			return nil, errors.New(fmt.Sprintf("unable to list docker containers from %v, error %v", cfg.Edge.DockerEndpoint, err))
 		} else {
 			ret := make([]dockerclient.APIContainers, 0, 10)
 
@@ -38,17 +40,17 @@ func GetWorkloadContainers(dockerEndpoint string, agreementId string) ([]dockerc
 	}
 }
 
-// Get docker container metadata from the docker API for microservice containers
-func GetMicroserviceContainer(dockerEndpoint string, mURL string, mOrg string, mVersion string, mInstanceId string) ([]dockerclient.APIContainers, error) {
-	if client, err := dockerclient.NewClient(dockerEndpoint); err != nil {
-		return nil, errors.New(fmt.Sprintf("unable to create docker client from %v, error %v", dockerEndpoint, err))
+// Get docker container metadata from the container runtime for microservice containers
+func GetMicroserviceContainer(cfg *config.HorizonConfig, mURL string, mOrg string, mVersion string, mInstanceId string) ([]dockerclient.APIContainers, error) {
+	if client, err := containerruntime.NewAgentContainerRuntime(cfg); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create %v client from %v, error %v", cfg.GetContainerRuntime(), cfg.Edge.DockerEndpoint, err))
 	} else {
 		opts := dockerclient.ListContainersOptions{
 			All: true,
 		}
 
 		if containers, err := client.ListContainers(opts); err != nil {
-			return nil, errors.New(fmt.Sprintf("unable to list docker containers from %v, error %v", dockerEndpoint, err))
+			return nil, errors.New(fmt.Sprintf("unable to list docker containers from %v, error %v", cfg.Edge.DockerEndpoint, err))
 		} else {
 			ret := make([]dockerclient.APIContainers, 0, 10)
 
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strings"
+)
+
+// The agreement states reported in the agreement metrics.
+const (
+	AGREEMENT_STATE_CREATED     = "created"
+	AGREEMENT_STATE_ACCEPTED    = "accepted"
+	AGREEMENT_STATE_FINALIZED   = "finalized"
+	AGREEMENT_STATE_EXECUTING   = "executing"
+	AGREEMENT_STATE_TERMINATING = "terminating"
+	AGREEMENT_STATE_ARCHIVED    = "archived"
+)
+
+// Returns the furthest state that the agreement has reached in its lifecycle.
+func agreementMetricState(ag *persistence.EstablishedAgreement) string {
+	if ag.Archived {
+		return AGREEMENT_STATE_ARCHIVED
+	} else if ag.AgreementTerminatedTime != 0 {
+		return AGREEMENT_STATE_TERMINATING
+	} else if ag.AgreementExecutionStartTime != 0 {
+		return AGREEMENT_STATE_EXECUTING
+	} else if ag.AgreementFinalizedTime != 0 {
+		return AGREEMENT_STATE_FINALIZED
+	} else if ag.AgreementAcceptedTime != 0 {
+		return AGREEMENT_STATE_ACCEPTED
+	}
+	return AGREEMENT_STATE_CREATED
+}
+
+// The collector for the node metrics that are read from the local database and the container runtime each time the
+// metrics are scraped. The container metrics are left out when there is no container runtime client.
+type NodeMetricsCollector struct {
+	db             *bolt.DB
+	client         containerruntime.ContainerRuntime
+	agreementsDesc *prometheus.Desc
+	restartsDesc   *prometheus.Desc
+	surfaceDesc    *prometheus.Desc
+}
+
+func NewNodeMetricsCollector(db *bolt.DB, client containerruntime.ContainerRuntime) *NodeMetricsCollector {
+	return &NodeMetricsCollector{
+		db:     db,
+		client: client,
+		agreementsDesc: prometheus.NewDesc(
+			"anax_agreements",
+			"Number of agreements on the node, by agreement protocol and state.",
+			[]string{"protocol", "state"}, nil),
+		restartsDesc: prometheus.NewDesc(
+			"anax_service_instance_restarts",
+			"Number of times a container of a service instance has been restarted, by the container runtime or by the agent for its restart policy.",
+			[]string{"instance", "service", "container"}, nil),
+		surfaceDesc: prometheus.NewDesc(
+			"anax_surfaced_errors",
+			"Number of errors currently surfaced to the exchange for this node.",
+			nil, nil),
+	}
+}
+
+func (c *NodeMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.agreementsDesc
+	ch <- c.restartsDesc
+	ch <- c.surfaceDesc
+}
+
+func (c *NodeMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	// Count the agreements in each state for each protocol.
+	for _, protocol := range policy.AllAgreementProtocols() {
+		agreements, err := persistence.FindEstablishedAgreements(c.db, protocol, []persistence.EAFilter{})
+		if err != nil {
+			glog.Errorf(apiLogString(fmt.Sprintf("unable to read %v agreements for metrics, error %v", protocol, err)))
+			continue
+		}
+
+		counts := map[string]int{
+			AGREEMENT_STATE_CREATED:     0,
+			AGREEMENT_STATE_ACCEPTED:    0,
+			AGREEMENT_STATE_FINALIZED:   0,
+			AGREEMENT_STATE_EXECUTING:   0,
+			AGREEMENT_STATE_TERMINATING: 0,
+			AGREEMENT_STATE_ARCHIVED:    0,
+		}
+		for _, ag := range agreements {
+			counts[agreementMetricState(&ag)] += 1
+		}
+		for state, n := range counts {
+			ch <- prometheus.MustNewConstMetric(c.agreementsDesc, prometheus.GaugeValue, float64(n), protocol, state)
+		}
+	}
+
+	if c.client != nil {
+		c.collectRestarts(ch)
+	}
+
+	if surfaceErrors, err := persistence.FindSurfaceErrors(c.db); err != nil {
+		glog.Errorf(apiLogString(fmt.Sprintf("unable to read surface errors for metrics, error %v", err)))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.surfaceDesc, prometheus.GaugeValue, float64(len(surfaceErrors)))
+	}
+}
+
+// Report the restarts of each service container. The container runtime counts the restarts it does for the restart
+// policy of the container, the agent keeps its own count for the containers with a deployment restart policy.
+func (c *NodeMetricsCollector) collectRestarts(ch chan<- prometheus.Metric) {
+	opts := dockerclient.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": []string{container.LABEL_PREFIX + ".service_name"}},
+	}
+	containers, err := c.client.ListContainers(opts)
+	if err != nil {
+		glog.Errorf(apiLogString(fmt.Sprintf("unable to list service containers for metrics, error %v", err)))
+		return
+	}
+
+	for _, sc := range containers {
+		inspected, err := c.client.InspectContainer(sc.ID)
+		if err != nil {
+			glog.Errorf(apiLogString(fmt.Sprintf("unable to inspect container %v for metrics, error %v", sc.Names, err)))
+			continue
+		}
+		restarts := inspected.RestartCount
+		if restart, err := persistence.FindContainerRestart(c.db, sc.ID); err != nil {
+			glog.Errorf(apiLogString(fmt.Sprintf("unable to read the restart record of container %v for metrics, error %v", sc.Names, err)))
+		} else if restart != nil {
+			restarts += restart.Restarts
+		}
+		ch <- prometheus.MustNewConstMetric(c.restartsDesc, prometheus.GaugeValue, float64(restarts),
+			sc.Labels[container.LABEL_PREFIX+".agreement_id"], sc.Labels[container.LABEL_PREFIX+".service_name"], strings.TrimPrefix(inspected.Name, "/"))
+	}
+}
+
+// The /metrics handler serves the metrics registered by the workers in the default registry along with
+// the metrics read from this API's database.
+func (a *API) metrics() http.Handler {
+	var client containerruntime.ContainerRuntime
+	if a.Config.Edge.DockerEndpoint != "" {
+		if cr, err := containerruntime.NewAgentContainerRuntime(a.Config); err != nil {
+			glog.Errorf(apiLogString(fmt.Sprintf("unable to create %v client for metrics, error %v", a.Config.GetContainerRuntime(), err)))
+		} else {
+			client = cr
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(NewNodeMetricsCollector(a.db, client))
+	return promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, reg}, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,123 @@
+// +build unit
+
+package api
+
+import (
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func Test_NodeMetricsCollector_agreements(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	// Agreement 1 is executing, agreement2 is archived, agreement3 is terminating.
+	sp := persistence.ServiceSpec{Url: "http://sensor.org", Org: "myorg"}
+	sps := []persistence.ServiceSpec{sp}
+
+	wi, _ := persistence.NewWorkloadInfo("url", "org", "version", "")
+	if _, err := persistence.NewEstablishedAgreement(db, "name1", "agreementId1", "consumerId", "{}", "Basic", 1, sps, "signature", "address", "bcType", "bcName", "bcOrg", wi); err != nil {
+		t.Errorf("error writing agreement1: %v", err)
+	} else if _, err := persistence.NewEstablishedAgreement(db, "name1", "agreementId2", "consumerId", "{}", "Basic", 1, sps, "signature", "address", "bcType", "bcName", "bcOrg", wi); err != nil {
+		t.Errorf("error writing agreement2: %v", err)
+	} else if _, err := persistence.NewEstablishedAgreement(db, "name1", "agreementId3", "consumerId", "{}", "Basic", 1, sps, "signature", "address", "bcType", "bcName", "bcOrg", wi); err != nil {
+		t.Errorf("error writing agreement3: %v", err)
+	} else if _, err := persistence.AgreementStateExecutionStarted(db, "agreementId1", "Basic"); err != nil {
+		t.Errorf("error starting agreement1: %v", err)
+	} else if _, err := persistence.ArchiveEstablishedAgreement(db, "agreementId2", "Basic"); err != nil {
+		t.Errorf("error archiving agreement2: %v", err)
+	} else if _, err := persistence.AgreementStateTerminated(db, "agreementId3", 100, "unit test termination", "Basic"); err != nil {
+		t.Errorf("error terminating agreement3: %v", err)
+	}
+
+	expected := `
+# HELP anax_agreements Number of agreements on the node, by agreement protocol and state.
+# TYPE anax_agreements gauge
+anax_agreements{protocol="Basic",state="accepted"} 0
+anax_agreements{protocol="Basic",state="archived"} 1
+anax_agreements{protocol="Basic",state="created"} 0
+anax_agreements{protocol="Basic",state="executing"} 1
+anax_agreements{protocol="Basic",state="finalized"} 0
+anax_agreements{protocol="Basic",state="terminating"} 1
+# HELP anax_surfaced_errors Number of errors currently surfaced to the exchange for this node.
+# TYPE anax_surfaced_errors gauge
+anax_surfaced_errors 0
+`
+	c := NewNodeMetricsCollector(db, nil)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "anax_agreements", "anax_surfaced_errors"); err != nil {
+		t.Errorf("unexpected agreement metrics, error: %v", err)
+	}
+
+	// Without a container runtime there are no container metrics.
+	if got := testutil.CollectAndCount(c, "anax_service_instance_restarts"); got != 0 {
+		t.Errorf("expected no restart metrics, got %v", got)
+	}
+}
+
+func Test_NodeMetricsCollector_restarts(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	client := containerruntime.NewFakeRuntime()
+	if err := client.PullImage(dockerclient.PullImageOptions{Repository: "svc", Tag: "1.0.0"}, dockerclient.AuthConfiguration{}); err != nil {
+		t.Fatalf("unexpected pull error %v", err)
+	}
+
+	// The first container is restarted twice by the container runtime, the second one three times by the agent.
+	// The third one is not a service container.
+	names := []string{"ag1-svc1", "ag1-svc2", "other"}
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		labels := map[string]string{
+			container.LABEL_PREFIX + ".service_name": strings.TrimPrefix(name, "ag1-"),
+			container.LABEL_PREFIX + ".agreement_id": "ag1",
+		}
+		if name == "other" {
+			labels = nil
+		}
+		c, err := client.CreateContainer(dockerclient.CreateContainerOptions{
+			Name:       name,
+			Config:     &dockerclient.Config{Image: "svc:1.0.0", Labels: labels},
+			HostConfig: &dockerclient.HostConfig{RestartPolicy: dockerclient.AlwaysRestart()},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating container %v", err)
+		} else if err := client.StartContainer(c.ID, nil); err != nil {
+			t.Fatalf("unexpected error starting container %v", err)
+		}
+		ids = append(ids, c.ID)
+	}
+	client.ExitContainer(ids[0], 1)
+	client.ExitContainer(ids[0], 1)
+	client.ExitContainer(ids[2], 1)
+
+	restart := persistence.NewContainerRestart(ids[1], names[1], "ag1")
+	restart.Restarts = 3
+	if err := persistence.SaveContainerRestart(db, restart); err != nil {
+		t.Errorf("error saving the restart record: %v", err)
+	}
+
+	expected := `
+# HELP anax_service_instance_restarts Number of times a container of a service instance has been restarted, by the container runtime or by the agent for its restart policy.
+# TYPE anax_service_instance_restarts gauge
+anax_service_instance_restarts{container="ag1-svc1",instance="ag1",service="svc1"} 2
+anax_service_instance_restarts{container="ag1-svc2",instance="ag1",service="svc2"} 3
+`
+	c := NewNodeMetricsCollector(db, client)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "anax_service_instance_restarts"); err != nil {
+		t.Errorf("unexpected restart metrics, error: %v", err)
+	}
+}
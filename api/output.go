@@ -100,6 +100,8 @@ type AllServices struct {
 	Config      []MicroserviceConfig                     `json:"config"`      // the service configurations
 	Instances   map[string][]*MicroserviceInstanceOutput `json:"instances"`   // the microservice instances that are running
 	Definitions map[string][]interface{}                 `json:"definitions"` // the definitions of services from the exchange
+	ImagePulls  []persistence.ImagePull                  `json:"image_pulls"` // the progress of the image pulls that have not completed
+	Readiness   []persistence.ReadinessGate              `json:"readiness"`   // the readiness gates of the services that depend on other services
 }
 
 func NewServiceOutput() *AllServices {
@@ -107,6 +109,8 @@ func NewServiceOutput() *AllServices {
 		Config:      make([]MicroserviceConfig, 0, 10),
 		Instances:   make(map[string][]*MicroserviceInstanceOutput, 0),
 		Definitions: make(map[string][]interface{}, 0),
+		ImagePulls:  make([]persistence.ImagePull, 0),
+		Readiness:   make([]persistence.ReadinessGate, 0),
 	}
 }
 
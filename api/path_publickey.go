@@ -11,8 +11,8 @@ import (
 	"github.com/golang/glog"
 
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/imagefetch"
 	"github.com/open-horizon/rsapss-tool/listkeys"
-	"github.com/open-horizon/rsapss-tool/verify"
 )
 
 func FindPublicKeyForOutput(fileName string, config *config.HorizonConfig) (string, error) {
@@ -107,7 +107,7 @@ func UploadPublicKey(filename string,
 	// uploaded file is specified on the HTTP PUT. It does not have to have the same file name used
 	// by the HTTP caller.
 
-	if _, err := verify.ValidKeyOrCert(inBytes); err != nil {
+	if _, err := imagefetch.ValidPublicKey(inBytes); err != nil {
 		return errorhandler(NewAPIUserInputError(fmt.Sprintf("provided public key or cert is not valid; error: %v", err), "trusted cert file"))
 	} else if err := os.MkdirAll(targetPath, 0644); err != nil {
 		return errorhandler(NewSystemError(fmt.Sprintf("unable to create trusted cert directory %v, error: %v", targetPath, err)))
@@ -166,7 +166,7 @@ func getPemFiles(homePath string) ([]os.FileInfo, error) {
 				fName := homePath + "/" + fileInfo.Name()
 				if pubKeyData, err := ioutil.ReadFile(fName); err != nil {
 					continue
-				} else if _, err := verify.ValidKeyOrCert(pubKeyData); err != nil {
+				} else if _, err := imagefetch.ValidPublicKey(pubKeyData); err != nil {
 					continue
 				} else {
 					res = append(res, fileInfo)
@@ -36,6 +36,18 @@ func FindServicesForOutput(pm *policy.PolicyManager,
 		return nil, errors.New(fmt.Sprintf("unable to read mservice definitions, error %v", err))
 	}
 
+	// Get the image pulls that have not completed so that we can show their progress.
+	pulls, err := persistence.FindImagePulls(db)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read image pulls, error %v", err))
+	}
+
+	// Get the readiness gates so that we can show which services are waiting for the services they depend on.
+	gates, err := persistence.FindReadinessGates(db)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read readiness gates, error %v", err))
+	}
+
 	// Setup the output map keys and a sub-map for each one
 	var archivedKey = "archived"
 	var activeKey = "active"
@@ -48,12 +60,15 @@ func FindServicesForOutput(pm *policy.PolicyManager,
 	wrap.Definitions[archivedKey] = make([]interface{}, 0, 5)
 	wrap.Definitions[activeKey] = make([]interface{}, 0, 5)
 
+	wrap.ImagePulls = pulls
+	wrap.Readiness = gates
+
 	// Iterate through each service instance from the ms database and generate the output object for each one.
 	for _, msinst := range msinsts {
 		if msinst.Archived {
 			wrap.Instances[archivedKey] = append(wrap.Instances[archivedKey], NewMicroserviceInstanceOutput(msinst, nil))
 		} else {
-			containers, err := GetMicroserviceContainer(config.Edge.DockerEndpoint, msinst.SpecRef, msinst.Org, msinst.Version, msinst.InstanceId)
+			containers, err := GetMicroserviceContainer(config, msinst.SpecRef, msinst.Org, msinst.Version, msinst.InstanceId)
 			if err != nil {
 				return nil, errors.New(fmt.Sprintf("unable to get docker container info, error %v", err))
 			}
@@ -66,7 +81,7 @@ func FindServicesForOutput(pm *policy.PolicyManager,
 		if agInst.Archived {
 			wrap.Instances[archivedKey] = append(wrap.Instances[archivedKey], NewAgreementServiceInstanceOutput(&agInst, nil))
 		} else {
-			containers, err := GetWorkloadContainers(config.Edge.DockerEndpoint, agInst.CurrentAgreementId)
+			containers, err := GetWorkloadContainers(config, agInst.CurrentAgreementId)
 			if err != nil {
 				return nil, errors.New(fmt.Sprintf("unable to get docker container info, error %v", err))
 			}
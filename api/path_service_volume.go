@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/persistence"
+)
+
+// The function that deletes a docker volume created by anax and archives its record.
+type DeleteVolumeHandler func(cv *persistence.ContainerVolume) error
+
+// get the docker volumes that anax created for the services and has not deleted yet. The volumes that are retained
+// on unregister are there after the node is unregistered.
+func FindServiceVolumesForOutput(db *bolt.DB) (map[string][]persistence.ContainerVolume, error) {
+	cvs, err := persistence.FindAllUndeletedContainerVolumes(db)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the container volumes, error %v", err)
+	}
+
+	out := make(map[string][]persistence.ContainerVolume)
+	out["volumes"] = cvs
+	return out, nil
+}
+
+// Delete the docker volume with the given name, whatever its lifecycle. A volume that a service container still uses
+// cannot be deleted.
+func DeleteServiceVolume(errorhandler ErrorHandler, name string, deleteVolume DeleteVolumeHandler, db *bolt.DB) bool {
+	cvs, err := persistence.FindContainerVolumes(db, []persistence.ContainerVolumeFilter{persistence.UnarchivedCVFilter(), persistence.NameCVFilter(name)})
+	if err != nil {
+		return errorhandler(NewSystemError(fmt.Sprintf("unable to read the container volume %v, error %v", name, err)))
+	} else if len(cvs) == 0 {
+		return errorhandler(NewNotFoundError(fmt.Sprintf("volume %v is not found, only the volumes created for the services can be deleted", name), "name"))
+	}
+
+	for _, cv := range cvs {
+		if err := deleteVolume(&cv); err == docker.ErrVolumeInUse {
+			return errorhandler(NewConflictError(fmt.Sprintf("volume %v is used by a service container, it cannot be deleted", name)))
+		} else if err != nil {
+			return errorhandler(NewSystemError(fmt.Sprintf("unable to delete volume %v, error %v", name, err)))
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+// +build unit
+
+package api
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/persistence"
+	"testing"
+)
+
+func Test_ServiceVolumes(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	cv := persistence.NewContainerVolume("mydata")
+	cv.Lifecycle = persistence.CV_LIFECYCLE_RETAIN_ON_UNREGISTER
+	if err := persistence.SaveContainerVolume(db, cv); err != nil {
+		t.Errorf("error saving container volume: %v", err)
+	}
+
+	if out, err := FindServiceVolumesForOutput(db); err != nil {
+		t.Errorf("error finding volumes: %v", err)
+	} else if len(out["volumes"]) != 1 || out["volumes"][0].Name != "mydata" {
+		t.Errorf("expecting volume mydata, have %v", out["volumes"])
+	}
+
+	var myError error
+	errorhandler := GetPassThroughErrorHandler(&myError)
+	inUse := func(cv *persistence.ContainerVolume) error { return docker.ErrVolumeInUse }
+	remove := func(cv *persistence.ContainerVolume) error { return persistence.ArchiveContainerVolumes(db, cv) }
+
+	if errHandled := DeleteServiceVolume(errorhandler, "otherdata", remove, db); !errHandled {
+		t.Errorf("expected to receive error")
+	} else if _, ok := myError.(*NotFoundError); !ok {
+		t.Errorf("expected error of type NotFound, but is %T, %v", myError, myError)
+	}
+
+	if errHandled := DeleteServiceVolume(errorhandler, "mydata", inUse, db); !errHandled {
+		t.Errorf("expected to receive error")
+	} else if _, ok := myError.(*ConflictError); !ok {
+		t.Errorf("expected error of type Conflict, but is %T, %v", myError, myError)
+	}
+
+	if errHandled := DeleteServiceVolume(errorhandler, "mydata", remove, db); errHandled {
+		t.Errorf("unexpected error %v", myError)
+	} else if out, err := FindServiceVolumesForOutput(db); err != nil || len(out["volumes"]) != 0 {
+		t.Errorf("expecting no volumes, have %v %v", out, err)
+	}
+}
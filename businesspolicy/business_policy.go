@@ -1,6 +1,7 @@
 package businesspolicy
 
 import (
+	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/externalpolicy"
@@ -13,24 +14,28 @@ const DEFAULT_MAX_AGREEMENT = 0
 
 // the business policy
 type BusinessPolicy struct {
-	Owner       string                              `json:"owner,omitempty"`
-	Label       string                              `json:"label"`
-	Description string                              `json:"description"`
-	Service     ServiceRef                          `json:"service"`
-	Properties  externalpolicy.PropertyList         `json:"properties,omitempty"`
-	Constraints externalpolicy.ConstraintExpression `json:"constraints,omitempty"`
-	UserInput   []policy.UserInput                  `json:"userInput,omitempty"`
+	Owner         string                              `json:"owner,omitempty"`
+	Label         string                              `json:"label"`
+	Description   string                              `json:"description"`
+	Service       ServiceRef                          `json:"service"`
+	Properties    externalpolicy.PropertyList         `json:"properties,omitempty"`
+	Constraints   externalpolicy.ConstraintExpression `json:"constraints,omitempty"`
+	UserInput     []policy.UserInput                  `json:"userInput,omitempty"`
+	Rollout       *policy.RolloutStrategy             `json:"rolloutStrategy,omitempty"` // how upgrades to the service are rolled out across nodes
+	SecretBinding []policy.SecretBinding              `json:"secretBinding,omitempty"`   // the provider keys of the secrets used by the service
 }
 
 func (w BusinessPolicy) String() string {
-	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Service: %v, Properties: %v, Constraints: %v, UserInput: %v",
+	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Service: %v, Properties: %v, Constraints: %v, UserInput: %v, Rollout: %v, SecretBinding: %v",
 		w.Owner,
 		w.Label,
 		w.Description,
 		w.Service,
 		w.Properties,
 		w.Constraints,
-		w.UserInput)
+		w.UserInput,
+		w.Rollout,
+		w.SecretBinding)
 }
 
 type ServiceRef struct {
@@ -67,7 +72,7 @@ func (w WorkloadPriority) String() string {
 
 type UpgradePolicy struct {
 	Lifecycle string `json:"lifecycle,omitempty"` // immediate, never, agreement
-	Time      string `json:"time,omitempty"`      // the time of the upgrade
+	Time      string `json:"time,omitempty"`      // the maintenance window in which the upgrade can be deployed
 }
 
 func (w UpgradePolicy) String() string {
@@ -136,6 +141,25 @@ func (b *BusinessPolicy) Validate() error {
 		}
 	}
 
+	// Validate the maintenance window in the upgrade policy of each service version.
+	for _, wl := range b.Service.ServiceVersions {
+		if strings.TrimSpace(wl.Upgrade.Time) == "" {
+			continue
+		} else if _, err := policy.ParseMaintenanceWindow(wl.Upgrade.Time); err != nil {
+			return errors.New(msgPrinter.Sprintf("upgradePolicy time for service version %v is not valid: %v", wl.Version, err))
+		}
+	}
+
+	// Validate the rollout strategy.
+	if err := b.Rollout.Validate(); err != nil {
+		return fmt.Errorf(msgPrinter.Sprintf("rolloutStrategy is not valid: %v", err))
+	}
+
+	// Validate the secret bindings.
+	if err := policy.ValidateSecretBindings(b.SecretBinding); err != nil {
+		return fmt.Errorf(msgPrinter.Sprintf("secretBinding is not valid: %v", err))
+	}
+
 	// Validate the Constraints expression by invoking the plugins.
 	if b != nil && len(b.Constraints) != 0 {
 		_, err := b.Constraints.Validate()
@@ -203,6 +227,15 @@ func (b *BusinessPolicy) GenPolicyFromBusinessPolicy(policyName string) (*policy
 	pol.UserInput = make([]policy.UserInput, len(b.UserInput))
 	copy(pol.UserInput, b.UserInput)
 
+	// upgrades are rolled out in batches
+	if b.Rollout != nil {
+		rs := *b.Rollout
+		pol.RolloutStrategy = &rs
+	}
+
+	// make a copy of the secret bindings
+	pol.SecretBinding = policy.CopySecretBindings(b.SecretBinding)
+
 	glog.V(3).Infof("converted %v into policy %v.", service, policyName)
 
 	return pol, nil
@@ -211,6 +244,7 @@ func (b *BusinessPolicy) GenPolicyFromBusinessPolicy(policyName string) (*policy
 func ConvertChoice(wl WorkloadChoice, url string, org string, arch string, pol *policy.Policy) {
 	newWL := policy.Workload_Factory(url, org, wl.Version, arch)
 	newWL.Priority = (*policy.Workload_Priority_Factory(wl.Priority.PriorityValue, wl.Priority.Retries, wl.Priority.RetryDurationS, wl.Priority.VerifiedDurationS))
+	newWL.UpgradeTime = wl.Upgrade.Time
 	pol.Add_Workload(newWL)
 }
 
@@ -80,6 +80,8 @@ func NewChangesWorker(name string, cfg *config.HorizonConfig, db *bolt.DB) *Chan
 
 	glog.Info(chglog(fmt.Sprintf("Starting ExchangeChanges worker")))
 
+	pollIntervalGauge.Set(float64(worker.pollInterval))
+
 	// The initial poll interval is changed dynamically by the NoWorkHandler when it detects that it can increase
 	// or decrease the polling interval.
 	worker.Start(worker, cfg.Edge.ExchangeMessagePollInterval)
@@ -348,6 +350,7 @@ func (w *ChangesWorker) postProcessChanges(changes *exchange.ExchangeChanges, in
 func (w *ChangesWorker) handleHeartbeatStateAndError(changes *exchange.ExchangeChanges, err error) bool {
 	if err != nil {
 		glog.Errorf(chglog(fmt.Sprintf("heartbeat and change retrieval failed, error %v", err)))
+		heartbeatFailures.Inc()
 
 		if strings.Contains(err.Error(), "status: 401") {
 			// If the heartbeat fails because the node entry is gone then initiate a full node quiesce.
@@ -417,6 +420,8 @@ func (w *ChangesWorker) handleHeartbeatStateAndError(changes *exchange.ExchangeC
 
 func (w *ChangesWorker) updatePollingInterval(updateType string) {
 
+	defer func() { pollIntervalGauge.Set(float64(w.pollInterval)) }()
+
 	if updateType == UPDATE_TYPE_RESET {
 		// set the polling interval to minial. This is the case where agreement negotiation started when the node needs to
 		// watch the upcoming messages more closely.
@@ -0,0 +1,21 @@
+package changes
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pollIntervalGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "anax_changes_poll_interval_seconds",
+		Help: "The current interval between polls of the exchange /changes API.",
+	})
+
+	heartbeatFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anax_heartbeat_failures_total",
+		Help: "Number of node heartbeats (calls to the exchange /changes API) that failed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pollIntervalGauge, heartbeatFailures)
+}
@@ -0,0 +1,111 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"fmt"
+	agbot "github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/policy"
+	"net/http"
+	"os"
+)
+
+type RolloutOutput struct {
+	PolicyName      string                 `json:"policy_name"`
+	Version         string                 `json:"version"`
+	Strategy        policy.RolloutStrategy `json:"strategy"`
+	State           string                 `json:"state"`
+	StateReason     string                 `json:"state_reason,omitempty"`
+	StartTime       string                 `json:"start_time"`
+	Batch           int                    `json:"batch"`
+	BatchStartTime  string                 `json:"batch_start_time"`
+	BatchEndTime    string                 `json:"batch_end_time"`
+	TotalDevices    int                    `json:"total_devices"`
+	BatchDevices    []string               `json:"batch_devices"`
+	UpgradedDevices []string               `json:"upgraded_devices"`
+	FailedDevices   []string               `json:"failed_devices"`
+	SkippedDevices  []string               `json:"skipped_devices"`
+}
+
+// create a RolloutOutput object
+func NewRolloutOutput(r agbot.Rollout) *RolloutOutput {
+	return &RolloutOutput{
+		PolicyName:      r.PolicyName,
+		Version:         r.Version,
+		Strategy:        r.Strategy,
+		State:           r.State,
+		StateReason:     r.StateReason,
+		StartTime:       cliutils.ConvertTime(r.StartTime),
+		Batch:           r.Batch,
+		BatchStartTime:  cliutils.ConvertTime(r.BatchStartTime),
+		BatchEndTime:    cliutils.ConvertTime(r.BatchEndTime),
+		TotalDevices:    r.TotalDevices,
+		BatchDevices:    r.BatchDevices,
+		UpgradedDevices: r.UpgradedDevices,
+		FailedDevices:   r.FailedDevices,
+		SkippedDevices:  r.SkippedDevices,
+	}
+}
+
+func setAgbotUrl() {
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, i18n.GetMessagePrinter().Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+}
+
+func printRollouts(rollouts interface{}) {
+	jsonBytes, err := json.MarshalIndent(rollouts, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, i18n.GetMessagePrinter().Sprintf("failed to marshal 'policy rollout' output: %v", err))
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
+
+// RolloutList displays all the rollouts, or the rollout for the given policy
+func RolloutList(org string, name string) {
+	msgPrinter := i18n.GetMessagePrinter()
+	setAgbotUrl()
+
+	if org == "" {
+		var apiOutput []agbot.Rollout
+		cliutils.HorizonGet("rollout", []int{200}, &apiOutput, false)
+
+		rollouts := make([]RolloutOutput, 0, len(apiOutput))
+		for _, r := range apiOutput {
+			rollouts = append(rollouts, *NewRolloutOutput(r))
+		}
+		printRollouts(rollouts)
+	} else if name == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("the policy name must be specified with the organization"))
+	} else {
+		var apiOutput agbot.Rollout
+		if httpCode, _ := cliutils.HorizonGet(fmt.Sprintf("rollout/%v/%v", org, name), []int{200, 400}, &apiOutput, false); httpCode == 400 {
+			cliutils.Fatal(cliutils.NOT_FOUND, msgPrinter.Sprintf("no rollout found for policy %v/%v", org, name))
+		}
+		printRollouts(NewRolloutOutput(apiOutput))
+	}
+}
+
+// RolloutHalt stops the rollout for the given policy from upgrading more nodes
+func RolloutHalt(org string, name string, reason string) {
+	rolloutAction(org, name, "halt", map[string]string{"reason": reason})
+	i18n.GetMessagePrinter().Printf("Rollout for policy %v/%v halted.", org, name)
+	i18n.GetMessagePrinter().Println()
+}
+
+// RolloutResume continues the halted or failed rollout for the given policy
+func RolloutResume(org string, name string) {
+	rolloutAction(org, name, "resume", map[string]string{})
+	i18n.GetMessagePrinter().Printf("Rollout for policy %v/%v resumed.", org, name)
+	i18n.GetMessagePrinter().Println()
+}
+
+func rolloutAction(org string, name string, action string, body interface{}) {
+	setAgbotUrl()
+
+	httpCode, respBody, _ := cliutils.HorizonPutPost(http.MethodPost, fmt.Sprintf("rollout/%v/%v/%v", org, name, action), []int{200, 400}, body, true)
+	if httpCode == 400 {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, i18n.GetMessagePrinter().Sprintf("unable to %v the rollout for policy %v/%v: %v", action, org, name, respBody))
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/imageregistry"
 	"github.com/open-horizon/rsapss-tool/sign"
 	"github.com/open-horizon/rsapss-tool/verify"
 	"golang.org/x/text/language"
@@ -302,6 +303,41 @@ func PullDockerImage(client *dockerclient.Client, domain, path, tag string) (dig
 	return
 }
 
+// ResolveDockerImageDigest asks the docker registry of the image for the digest that the tag currently refers to, without
+// pushing or pulling the image. If there is an error, it prints the error and exits.
+func ResolveDockerImageDigest(domain, path, tag string) (digest string) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if tag == "" {
+		tag = "latest"
+	}
+	var repository string // for messages later on
+	if domain == "" {
+		repository = path
+	} else {
+		repository = domain + "/" + path
+	}
+
+	msgPrinter.Printf("Resolving %v:%v...", repository, tag)
+	msgPrinter.Println()
+
+	var auth dockerclient.AuthConfiguration
+	var err error
+	loggedIn := true
+	if auth, err = GetDockerAuth(domain); err != nil {
+		loggedIn = false
+	}
+
+	if digest, err = imageregistry.NewRegistryClient(GetHTTPClient(0)).ResolveDigest(domain, path, tag, auth); err != nil {
+		if !loggedIn {
+			Fatal(CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to resolve the digest of docker image %v. Docker credentials were not found. Maybe you need to run 'docker login ...' if the image registry is private. Error: %v", repository+":"+tag, err))
+		}
+		Fatal(CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to resolve the digest of docker image %v: %v", repository+":"+tag, err))
+	}
+	return
+}
+
 // OrgAndCreds prepends the org to creds (separated by /) unless creds already has an org prepended
 func OrgAndCreds(org, creds string) string {
 	// org is the org of the resource being accessed, so if they want to use creds from a different org, the prepend that org to creds before calling this
@@ -1706,8 +1742,9 @@ func getString(v interface{}) string {
 */
 
 // This function is used in the service publish command to pull the docker image.
-// It  the image name with the digest.
-func GetNewDockerImageName(image string, dontTouchImage bool, pullImage bool) string {
+// It  the image name with the digest. When resolveDigest is true, the digest of the tag is looked up in the
+// docker registry and the image is neither pushed nor pulled.
+func GetNewDockerImageName(image string, dontTouchImage bool, pullImage bool, resolveDigest bool) string {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -1721,12 +1758,13 @@ func GetNewDockerImageName(image string, dontTouchImage bool, pullImage bool) st
 		// We are going to push images to the docker repo only if the user wants us to update the digest of the image.
 		if !dontTouchImage {
 			// Push it, get the repo digest, and modify the imagePath to use the digest.
-			client := NewDockerClient()
 			digest := ""
-			if pullImage {
-				digest = PullDockerImage(client, domain, path, tag) // this will error out if pull fails
+			if resolveDigest {
+				digest = ResolveDockerImageDigest(domain, path, tag) // this will error out if the registry does not know the tag
+			} else if pullImage {
+				digest = PullDockerImage(NewDockerClient(), domain, path, tag) // this will error out if pull fails
 			} else {
-				digest = PushDockerImage(client, domain, path, tag) // this will error out if the push fails or can't get the digest
+				digest = PushDockerImage(NewDockerClient(), domain, path, tag) // this will error out if the push fails or can't get the digest
 			}
 			if domain != "" {
 				domain = domain + "/"
@@ -125,6 +125,7 @@ func AllCompatible(org string, userPw string, nodeId string, nodeArch string, no
 	} else {
 		if !showDetail {
 			compOutput.Input = nil
+			compOutput.Detail = nil
 		}
 
 		// display the output
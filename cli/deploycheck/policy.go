@@ -22,7 +22,7 @@ func readExternalPolicyFile(filePath string, inputFileStruct *externalpolicy.Ext
 }
 
 // check if the policies are compatible
-func PolicyCompatible(org string, userPw string, nodeId string, nodeArch string, nodeType string, nodePolFile string, businessPolId string, businessPolFile string, servicePolFile string, svcDefFiles []string, checkAllSvcs bool, showDetail bool) {
+func PolicyCompatible(org string, userPw string, nodeId string, nodeArch string, nodeType string, nodePolFile string, businessPolId string, businessPolFile string, servicePolFile string, svcDefFiles []string, checkAllSvcs bool, showDetail bool, showConstraintDetail bool) {
 
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -99,6 +99,9 @@ func PolicyCompatible(org string, userPw string, nodeId string, nodeArch string,
 	} else {
 		if !showDetail {
 			compOutput.Input = nil
+			if !showConstraintDetail {
+				compOutput.Detail = nil
+			}
 		}
 
 		// display the output
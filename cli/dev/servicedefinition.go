@@ -8,6 +8,7 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/persistence"
 	"path"
 )
 
@@ -120,12 +121,49 @@ func ValidateServiceDefinition(directory string, fileName string) error {
 			if err := plugin_registry.DeploymentConfigPlugins.ValidatedByOne(sDef.Deployment, sDef.ClusterDeployment); err != nil {
 				return errors.New(msgPrinter.Sprintf("%v: deployment configuration, %v", filePath, err))
 			}
+		} else if cdep, ok := sDef.ClusterDeployment.(map[string]interface{}); ok && len(cdep) != 0 {
+			// A cluster deployment that is not signed yet
+			if err := plugin_registry.DeploymentConfigPlugins.ValidatedByOne(nil, cdep); err != nil {
+				return errors.New(msgPrinter.Sprintf("%v: cluster deployment configuration, %v", filePath, err))
+			}
 		}
 		for ix, ui := range sDef.UserInputs {
 			if (ui.Name != "" && ui.Type == "") || (ui.Name == "" && (ui.Type != "" || ui.DefaultValue != "")) {
 				return errors.New(msgPrinter.Sprintf("%v: userInput array index %v does not have name and type specified.", filePath, ix))
 			}
 		}
+		if err := validateHelmValueMappings(sDef); err != nil {
+			return errors.New(msgPrinter.Sprintf("%v: deployment configuration, %v", filePath, err))
+		}
+	}
+	return nil
+}
+
+// The chart values of a Helm deployment can only be mapped from the user input variables that the service defines.
+func validateHelmValueMappings(sDef *common.ServiceFile) error {
+	dep, ok := sDef.Deployment.(map[string]interface{})
+	if !ok || !persistence.IsHelm(dep) {
+		return nil
+	}
+
+	hd := new(persistence.HelmDeploymentConfig)
+	if err := hd.FromPersistentForm(dep); err != nil {
+		return err
+	}
+	for _, m := range hd.Values {
+		if m.UserInput == "" {
+			continue
+		}
+		found := false
+		for _, ui := range sDef.UserInputs {
+			if ui.Name == m.UserInput {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(i18n.GetMessagePrinter().Sprintf("chart value %v is mapped from user input variable %v, which is not defined in userInput", m.Name, m.UserInput))
+		}
 	}
 	return nil
 }
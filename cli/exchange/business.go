@@ -12,6 +12,8 @@ import (
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/policy"
 	"net/http"
+	"strings"
+	"time"
 )
 
 //BusinessListPolicy lists all the policies in the org or only the specified policy if one is given
@@ -136,6 +138,13 @@ func BusinessUpdatePolicy(org string, credToUse string, policyName string, fileP
 		if err != nil {
 			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal attribute input %s: %v", attribute, err))
 		}
+		for _, wl := range patch["service"].ServiceVersions {
+			if strings.TrimSpace(wl.Upgrade.Time) == "" {
+				continue
+			} else if _, err := policy.ParseMaintenanceWindow(wl.Upgrade.Time); err != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Invalid format for the upgradePolicy time of service version %v: %v", wl.Version, err))
+			}
+		}
 		msgPrinter.Printf("Updating Policy %v/%v in the Horizon Exchange and re-evaluating all agreements based on this deployment policy. Existing agreements might be cancelled and re-negotiated.", polOrg, policyName)
 		msgPrinter.Println()
 		cliutils.ExchangePutPost("Exchange", http.MethodPatch, exchUrl, "orgs/"+polOrg+"/business/policies"+cliutils.AddSlash(policyName), cliutils.OrgAndCreds(org, credToUse), []int{201}, patch, nil)
@@ -187,6 +196,18 @@ func BusinessUpdatePolicy(org string, credToUse string, policyName string, fileP
 		msgPrinter.Println()
 		msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
 		msgPrinter.Println()
+	} else if _, ok := findPatchType["rolloutStrategy"]; ok {
+		patch := make(map[string]*policy.RolloutStrategy)
+		err := json.Unmarshal([]byte(attribute), &patch)
+		if err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal attribute input %s: %v", attribute, err))
+		}
+		if err := patch["rolloutStrategy"].Validate(); err != nil {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Invalid format for rolloutStrategy: %v", err))
+		}
+		cliutils.ExchangePutPost("Exchange", http.MethodPatch, exchUrl, "orgs/"+polOrg+"/business/policies"+cliutils.AddSlash(policyName), cliutils.OrgAndCreds(org, credToUse), []int{201}, patch, nil)
+		msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
+		msgPrinter.Println()
 	} else {
 		_, ok := findPatchType["label"]
 		_, ok2 := findPatchType["description"]
@@ -202,7 +223,7 @@ func BusinessUpdatePolicy(org string, credToUse string, policyName string, fileP
 			msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
 			msgPrinter.Println()
 		} else {
-			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Deployment policy attribute to be updated is not found in the input file. Supported attributes are: label, description, service, properties, constraints, and userInput."))
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Deployment policy attribute to be updated is not found in the input file. Supported attributes are: label, description, service, properties, constraints, userInput, and rolloutStrategy."))
 		}
 	}
 }
@@ -233,6 +254,98 @@ func BusinessRemovePolicy(org string, credToUse string, policy string, force boo
 	}
 }
 
+// The output of 'hzn exchange deployment nextwindow'.
+type NextWindowOutput struct {
+	Policy          string                    `json:"policy"`
+	Version         string                    `json:"version"`
+	MaintWindow     *policy.MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+	Node            string                    `json:"node,omitempty"`
+	NodeMaintWindow *policy.MaintenanceWindow `json:"nodeMaintenanceWindow,omitempty"`
+	OpenNow         bool                      `json:"openNow"`
+	NextWindowStart string                    `json:"nextWindowStart,omitempty"`
+	NextWindowEnd   string                    `json:"nextWindowEnd,omitempty"`
+}
+
+//BusinessNextWindow displays the next maintenance window in which upgrades to the highest priority service version of the
+//deployment policy can be deployed. The window is set in the upgradePolicy time of the service version. If a node is given,
+//the maintenance window in the node's policy is taken into account too.
+func BusinessNextWindow(org string, credToUse string, policyName string, node string) {
+	cliutils.SetWhetherUsingApiKey(credToUse)
+	var polOrg string
+	polOrg, policyName = cliutils.TrimOrg(org, policyName)
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	//get the policy from Horizon Exchange
+	var policyList exchange.GetBusinessPolicyResponse
+	httpCode := cliutils.ExchangeGet("Exchange", cliutils.GetExchangeUrl(), "orgs/"+polOrg+"/business/policies"+cliutils.AddSlash(policyName), cliutils.OrgAndCreds(org, credToUse), []int{200, 404}, &policyList)
+	if httpCode == 404 || len(policyList.BusinessPolicy) == 0 {
+		cliutils.Fatal(cliutils.NOT_FOUND, msgPrinter.Sprintf("Policy %s not found in org %s", policyName, polOrg))
+	}
+
+	output := NextWindowOutput{Policy: polOrg + "/" + policyName}
+	for _, bp := range policyList.BusinessPolicy {
+		if len(bp.Service.ServiceVersions) == 0 {
+			cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("the deployment policy %v has no service versions", output.Policy))
+		}
+		pol := policy.Policy_Factory(output.Policy)
+		for _, choice := range bp.Service.ServiceVersions {
+			businesspolicy.ConvertChoice(choice, bp.Service.Name, bp.Service.Org, bp.Service.Arch, pol)
+		}
+		wl := pol.NextHighestPriorityWorkload(0, 0, 0)
+		output.Version = wl.Version
+		var err error
+		if output.MaintWindow, err = wl.UpgradeWindow(); err != nil {
+			cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("the upgradePolicy time of service version %v is not valid: %v", wl.Version, err))
+		}
+	}
+
+	// times are displayed in the time zone of the deployment policy's window, if it has one
+	loc := time.Local
+	if output.MaintWindow != nil && output.MaintWindow.TimeZone != "" {
+		if l, err := time.LoadLocation(output.MaintWindow.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	if node != "" {
+		var nodeOrg string
+		nodeOrg, node = cliutils.TrimOrg(org, node)
+		output.Node = nodeOrg + "/" + node
+
+		var nodePolicy exchange.ExchangePolicy
+		httpCode = cliutils.ExchangeGet("Exchange", cliutils.GetExchangeUrl(), "orgs/"+nodeOrg+"/nodes"+cliutils.AddSlash(node)+"/policy", cliutils.OrgAndCreds(org, credToUse), []int{200, 404}, &nodePolicy)
+		if httpCode == 200 {
+			nodeWindow, err := policy.NodeMaintenanceWindow(nodePolicy.Properties)
+			if err != nil {
+				cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("the node policy for %v has an invalid %v property: %v", output.Node, externalpolicy.PROP_NODE_MAINT_WINDOW, err))
+			}
+			output.NodeMaintWindow = nodeWindow
+		}
+	}
+
+	now := time.Now()
+	start, end, err := policy.NextCommonWindow(now, output.MaintWindow, output.NodeMaintWindow)
+	if err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to evaluate the maintenance window: %v", err))
+	}
+
+	if !start.IsZero() {
+		output.OpenNow = !start.After(now)
+		output.NextWindowStart = start.In(loc).Format(time.RFC3339)
+	}
+	if !end.IsZero() {
+		output.NextWindowEnd = end.In(loc).Format(time.RFC3339)
+	}
+
+	jsonBytes, err := json.MarshalIndent(output, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn exchange deployment nextwindow' output: %v", err))
+	}
+	fmt.Println(string(jsonBytes))
+}
+
 // Display an empty business policy template as an object.
 func BusinessNewPolicy() {
 	// get message printer
@@ -249,7 +362,10 @@ func BusinessNewPolicy() {
 		`    "serviceVersions": [  /* ` + msgPrinter.Sprintf("A list of service versions.") + ` */`,
 		`      {`,
 		`        "version": "",`,
-		`        "priority":{}`,
+		`        "priority":{},`,
+		`        "upgradePolicy": {  /* ` + msgPrinter.Sprintf("Optional. Omit to deploy upgrades to this version immediately.") + ` */`,
+		`          "time": ""        /* ` + msgPrinter.Sprintf("The maintenance window in which upgrades to this version can be deployed, e.g. 'schedule=0 2 * * 6; duration=4h; timezone=Europe/Berlin'.") + ` */`,
+		`        }`,
 		`      }`,
 		`    ]`,
 		`  },`,
@@ -275,7 +391,14 @@ func BusinessNewPolicy() {
 		`        }`,
 		`      ]`,
 		`    }`,
-		`  ]`,
+		`  ],`,
+		`  "rolloutStrategy": {  /* ` + msgPrinter.Sprintf("Optional. How service upgrades are rolled out across nodes. Omit to upgrade all nodes at once.") + ` */`,
+		`    "canaryPercent": 0,   /* ` + msgPrinter.Sprintf("The percentage of nodes upgraded in the first (canary) batch.") + ` */`,
+		`    "canaryCount": 0,     /* ` + msgPrinter.Sprintf("The minimum number of nodes upgraded in the first (canary) batch.") + ` */`,
+		`    "batchSize": 0,       /* ` + msgPrinter.Sprintf("The number of nodes upgraded in each following batch. 0 means all remaining nodes.") + ` */`,
+		`    "batchPause": "",     /* ` + msgPrinter.Sprintf("How long to wait after a successful batch before starting the next, e.g. '10m'.") + ` */`,
+		`    "successWindow": ""   /* ` + msgPrinter.Sprintf("How long the new version has to run on each node of a batch without an execution failure, e.g. '15m'.") + ` */`,
+		`  }`,
 		`}`,
 	}
 
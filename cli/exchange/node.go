@@ -10,6 +10,7 @@ import (
 	"github.com/open-horizon/anax/compcheck"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/externalpolicy"
+	_ "github.com/open-horizon/anax/externalpolicy/cel_language"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/persistence"
@@ -29,6 +30,7 @@ type ContainerStat struct {
 	Image   string `json:"image"`
 	Created int    `json:"created"`
 	State   string `json:"state"`
+	Health  string `json:"health,omitempty"`
 }
 
 type ExNodeStatusService struct {
@@ -39,6 +41,7 @@ type ExNodeStatusService struct {
 	Arch            string          `json:"arch"`
 	ContainerStatus []ContainerStat `json:"containerStatus"`
 	OperatorStatus  interface{}     `json:"operatorStatus,omitempty"`
+	Health          string          `json:"health,omitempty"`
 }
 
 type ExchangeNodeStatus struct {
@@ -424,6 +427,11 @@ func NodeAddPolicy(org string, credToUse string, node string, jsonFilePath strin
 	if err != nil {
 		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Incorrect policy format in file %s: %v", jsonFilePath, err))
 	}
+	if _, err := policy.NodeMaintenanceWindow(policyFile.Properties); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Incorrect policy format in file %s: %v", jsonFilePath, err))
+	} else if _, err := policy.NodeRequiresSignedImages(policyFile.Properties); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Incorrect policy format in file %s: %v", jsonFilePath, err))
+	}
 
 	// check node exists first
 	var nodes ExchangeNodes
@@ -67,6 +67,7 @@ type PatternInput struct {
 	Services           []ServiceReference           `json:"services,omitempty"`
 	AgreementProtocols []exchange.AgreementProtocol `json:"agreementProtocols,omitempty"`
 	UserInput          []policy.UserInput           `json:"userInput,omitempty"`
+	SecretBinding      []policy.SecretBinding       `json:"secretBinding,omitempty"`
 }
 
 // List the pattern resources for the given org.
@@ -225,7 +226,10 @@ func PatternPublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath, patN
 	if patFile.Org == "" {
 		patFile.Org = org
 	}
-	patInput := PatternInput{Label: patFile.Label, Description: patFile.Description, Public: patFile.Public, AgreementProtocols: patFile.AgreementProtocols, UserInput: patFile.UserInput}
+	if err := policy.ValidateSecretBindings(patFile.SecretBinding); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("the secretBinding in the pattern definition is not valid: %v", err))
+	}
+	patInput := PatternInput{Label: patFile.Label, Description: patFile.Description, Public: patFile.Public, AgreementProtocols: patFile.AgreementProtocols, UserInput: patFile.UserInput, SecretBinding: patFile.SecretBinding}
 
 	//issue 924: Patterns with no services are not allowed
 	if patFile.Services == nil || len(patFile.Services) == 0 {
@@ -252,6 +256,11 @@ func PatternPublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath, patN
 					patInput.Services[i].ServiceVersions[j].Priority = *patFile.Services[i].ServiceVersions[j].Priority
 				}
 				if patFile.Services[i].ServiceVersions[j].Upgrade != nil {
+					if upgradeTime := patFile.Services[i].ServiceVersions[j].Upgrade.Time; strings.TrimSpace(upgradeTime) != "" {
+						if _, err := policy.ParseMaintenanceWindow(upgradeTime); err != nil {
+							cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("the upgradePolicy time in service %d, serviceVersion number %d is not valid: %v", i+1, j+1, err))
+						}
+					}
 					patInput.Services[i].ServiceVersions[j].Upgrade = *patFile.Services[i].ServiceVersions[j].Upgrade
 				}
 				var err error
@@ -13,6 +13,7 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/externalpolicy"
+	_ "github.com/open-horizon/anax/externalpolicy/cel_language"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/persistence"
@@ -120,12 +121,14 @@ func ServiceList(credOrg, userPw, service string, namesOnly bool, filePath strin
 }
 
 // ServicePublish signs the MS def and puts it in the exchange
-func ServicePublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath string, dontTouchImage bool, pullImage bool, registryTokens []string, overwrite bool, servicePolicyFilePath string) {
+func ServicePublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath string, dontTouchImage bool, pullImage bool, resolveDigest bool, registryTokens []string, overwrite bool, servicePolicyFilePath string) {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
 	if dontTouchImage && pullImage {
 		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Flags -I and -P are mutually exclusive."))
+	} else if resolveDigest && (dontTouchImage || pullImage) {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Flag --resolve-digest is mutually exclusive with -I and -P."))
 	}
 	cliutils.SetWhetherUsingApiKey(userPw)
 
@@ -149,7 +152,7 @@ func ServicePublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath strin
 		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Error validating the input service: %v", err))
 	}
 
-	SignAndPublish(&svcFile, org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath, dontTouchImage, pullImage, registryTokens, !overwrite)
+	SignAndPublish(&svcFile, org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath, dontTouchImage, pullImage, resolveDigest, registryTokens, !overwrite)
 
 	// create service policy if servicePolicyFilePath is defined
 	if servicePolicyFilePath != "" {
@@ -163,7 +166,7 @@ func ServicePublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath strin
 }
 
 // Sign and publish the service definition. This is a function that is reusable across different hzn commands.
-func SignAndPublish(sf *common.ServiceFile, org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath string, dontTouchImage bool, pullImage bool, registryTokens []string, promptForOverwrite bool) {
+func SignAndPublish(sf *common.ServiceFile, org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath string, dontTouchImage bool, pullImage bool, resolveDigest bool, registryTokens []string, promptForOverwrite bool) {
 
 	//check for ExchangeUrl early on
 	var exchUrl = cliutils.GetExchangeUrl()
@@ -171,13 +174,13 @@ func SignAndPublish(sf *common.ServiceFile, org, userPw, jsonFilePath, keyFilePa
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
-	svcInput := exchange.ServiceDefinition{Label: sf.Label, Description: sf.Description, Public: sf.Public, Documentation: sf.Documentation, URL: sf.URL, Version: sf.Version, Arch: sf.Arch, Sharable: sf.Sharable, MatchHardware: sf.MatchHardware, RequiredServices: sf.RequiredServices, UserInputs: sf.UserInputs}
+	svcInput := exchange.ServiceDefinition{Label: sf.Label, Description: sf.Description, Public: sf.Public, Documentation: sf.Documentation, URL: sf.URL, Version: sf.Version, Arch: sf.Arch, Sharable: sf.Sharable, MatchHardware: sf.MatchHardware, RequiredServices: sf.RequiredServices, UserInputs: sf.UserInputs, Secrets: sf.Secrets}
 
 	baseDir := filepath.Dir(jsonFilePath)
 	usedPubKey := ""
 	usedPubKey_cluster := ""
-	svcInput.Deployment, svcInput.DeploymentSignature, usedPubKey = SignDeployment(sf.Deployment, sf.DeploymentSignature, baseDir, false, keyFilePath, pubKeyFilePath, dontTouchImage, pullImage)
-	svcInput.ClusterDeployment, svcInput.ClusterDeploymentSignature, usedPubKey_cluster = SignDeployment(sf.ClusterDeployment, sf.ClusterDeploymentSignature, baseDir, true, keyFilePath, pubKeyFilePath, dontTouchImage, pullImage)
+	svcInput.Deployment, svcInput.DeploymentSignature, usedPubKey = SignDeployment(sf.Deployment, sf.DeploymentSignature, baseDir, false, keyFilePath, pubKeyFilePath, dontTouchImage, pullImage, resolveDigest)
+	svcInput.ClusterDeployment, svcInput.ClusterDeploymentSignature, usedPubKey_cluster = SignDeployment(sf.ClusterDeployment, sf.ClusterDeploymentSignature, baseDir, true, keyFilePath, pubKeyFilePath, dontTouchImage, pullImage, resolveDigest)
 
 	// Create or update resource in the exchange
 	exchId := cutil.FormExchangeIdForService(svcInput.URL, svcInput.Version, svcInput.Arch)
@@ -269,7 +272,7 @@ func SignAndPublish(sf *common.ServiceFile, org, userPw, jsonFilePath, keyFilePa
 
 // The function signs the given deployment if it is not empty abd not already signed. It returns the deployment, its signature
 // and the public key whose matching private was used for signing the deployment.
-func SignDeployment(deployment interface{}, deploymentSignature string, baseDir string, isCluster bool, keyFilePath string, pubKeyFilePath string, dontTouchImage bool, pullImage bool) (string, string, string) {
+func SignDeployment(deployment interface{}, deploymentSignature string, baseDir string, isCluster bool, keyFilePath string, pubKeyFilePath string, dontTouchImage bool, pullImage bool, resolveDigest bool) (string, string, string) {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -304,6 +307,7 @@ func SignDeployment(deployment interface{}, deploymentSignature string, baseDir
 		ctx.Add("currentDir", baseDir)
 		ctx.Add("dontTouchImage", dontTouchImage)
 		ctx.Add("pullImage", pullImage)
+		ctx.Add("resolveDigest", resolveDigest)
 
 		// Allow the right plugin to sign the deployment configuration.
 		depStr, sig, err := plugin_registry.DeploymentConfigPlugins.SignByOne(dep, keyFilePath, ctx)
@@ -651,7 +655,7 @@ func SaveOpYamlToFile(sId string, clusterDeployment string, filePath string, for
 }
 
 // This function getst the operator yaml archive (in .tat.gz format) from the clusterDeployment
-// string from a service
+// string from a service. For a manifest deployment, it gets the manifest archive.
 func GetOpYamlArchiveFromClusterDepl(deploymentConfig string) []byte {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
@@ -661,7 +665,13 @@ func GetOpYamlArchiveFromClusterDepl(deploymentConfig string) []byte {
 		return nil
 	}
 
-	if kd, err := persistence.GetKubeDeployment(deploymentConfig); err != nil {
+	if md, err := persistence.GetManifestDeployment(deploymentConfig); err == nil {
+		archiveData, err := base64.StdEncoding.DecodeString(md.ManifestArchive)
+		if err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("error decoding the cluster deployment configuration: %v", err))
+		}
+		return archiveData
+	} else if kd, err := persistence.GetKubeDeployment(deploymentConfig); err != nil {
 		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("error getting kube deployment configuration: %v", err))
 	} else {
 		archiveData, err := base64.StdEncoding.DecodeString(kd.OperatorYamlArchive)
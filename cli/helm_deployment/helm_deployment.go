@@ -9,6 +9,7 @@ import (
 	"github.com/open-horizon/anax/cli/plugin_registry"
 	"github.com/open-horizon/anax/helm"
 	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/rsapss-tool/sign"
 	"path/filepath"
 )
@@ -103,11 +104,26 @@ func (p *HelmDeploymentConfigPlugin) Validate(dep interface{}, cdep interface{})
 		return true, errors.New(msgPrinter.Sprintf("release_name must have a string type value, has %T", r))
 	} else if len(ca) == 0 || len(rn) == 0 {
 		return true, errors.New(msgPrinter.Sprintf("chart_archive and release_name must be non-empty strings"))
+	} else if _, ok := dc["values"]; !ok {
+		return true, nil
+	} else if hd, err := getHelmDeploymentConfig(dc); err != nil {
+		return true, err
+	} else if err := hd.ValidateValues(); err != nil {
+		return true, errors.New(msgPrinter.Sprintf("values: %v", err))
 	} else {
 		return true, nil
 	}
 }
 
+// Convert the deployment config object of the service definition file to a Helm deployment config.
+func getHelmDeploymentConfig(dep map[string]interface{}) (*persistence.HelmDeploymentConfig, error) {
+	hd := new(persistence.HelmDeploymentConfig)
+	if err := hd.FromPersistentForm(dep); err != nil {
+		return nil, errors.New(i18n.GetMessagePrinter().Sprintf("values must be an array of chart value mappings, error: %v", err))
+	}
+	return hd, nil
+}
+
 func (p *HelmDeploymentConfigPlugin) StartTest(homeDirectory string, userInputFile string, configFiles []string, configType string, noFSS bool, userCreds string) bool {
 
 	// get message printer
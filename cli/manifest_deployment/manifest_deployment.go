@@ -0,0 +1,235 @@
+package manifest_deployment
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/cli/dev"
+	"github.com/open-horizon/anax/cli/kube_deployment"
+	"github.com/open-horizon/anax/cli/plugin_registry"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/kube_operator"
+	"github.com/open-horizon/rsapss-tool/sign"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const MANIFEST_DEPLOYMENT_CONFIG_TYPE = "manifest"
+
+func init() {
+	plugin_registry.Register(MANIFEST_DEPLOYMENT_CONFIG_TYPE, NewManifestDeploymentConfigPlugin())
+}
+
+type ManifestDeploymentConfigPlugin struct {
+}
+
+func NewManifestDeploymentConfigPlugin() plugin_registry.DeploymentConfigPlugin {
+	return new(ManifestDeploymentConfigPlugin)
+}
+
+func (p *ManifestDeploymentConfigPlugin) Sign(dep map[string]interface{}, keyFilePath string, ctx plugin_registry.PluginContext) (bool, string, string, error) {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if owned, err := p.Validate(nil, dep); !owned || err != nil {
+		return owned, "", "", err
+	}
+
+	// Grab the manifest directory or archive from the deployment config. It might be relative to the
+	// service definition file.
+	manifestPath := dep["manifestArchive"].(string)
+	if manifestPath = filepath.Clean(manifestPath); manifestPath == "." {
+		return true, "", "", errors.New(msgPrinter.Sprintf("cleaned %v resulted in an empty string.", dep["manifestArchive"].(string)))
+	}
+
+	if currentDir, ok := (ctx.Get("currentDir")).(string); !ok {
+		return true, "", "", errors.New(msgPrinter.Sprintf("plugin context must include 'currentDir' as the current directory of the service definition file"))
+	} else if !filepath.IsAbs(manifestPath) {
+		manifestPath = filepath.Join(currentDir, manifestPath)
+	}
+
+	// Get the base 64 encoding of the manifest archive, packaging the manifest directory first.
+	var b64 string
+	var err error
+	if info, serr := os.Stat(manifestPath); serr == nil && info.IsDir() {
+		b64, err = ConvertDirToB64String(manifestPath)
+	} else {
+		b64, err = kube_deployment.ConvertFileToB64String(manifestPath)
+	}
+	if err != nil {
+		return true, "", "", errors.New(msgPrinter.Sprintf("unable to read manifests %v, error %v", dep["manifestArchive"], err))
+	}
+
+	// Make sure the manifests can be rendered before they are published.
+	overlay, _ := dep["kustomizeOverlay"].(string)
+	if objs, err := kube_operator.RenderManifests(b64, overlay); err != nil {
+		return true, "", "", errors.New(msgPrinter.Sprintf("invalid manifests %v, error %v", dep["manifestArchive"], err))
+	} else {
+		msgPrinter.Printf("Found %v kubernetes objects in %v", len(objs), dep["manifestArchive"])
+		msgPrinter.Println()
+	}
+	dep["manifestArchive"] = b64
+
+	// Stringify and sign the deployment string.
+	deployment, err := json.Marshal(dep)
+	if err != nil {
+		return true, "", "", errors.New(msgPrinter.Sprintf("failed to marshal %v deployment string %v, error %v", MANIFEST_DEPLOYMENT_CONFIG_TYPE, dep, err))
+	}
+	depStr := string(deployment)
+
+	sig, err := sign.Input(keyFilePath, deployment)
+	if err != nil {
+		return true, "", "", errors.New(msgPrinter.Sprintf("problem signing %v deployment string with %s: %v", MANIFEST_DEPLOYMENT_CONFIG_TYPE, keyFilePath, err))
+	}
+
+	return true, depStr, sig, nil
+}
+
+// This function does not open the manifests to try to extract container images.
+func (p *ManifestDeploymentConfigPlugin) GetContainerImages(dep interface{}) (bool, []string, error) {
+	return false, []string{}, nil
+}
+
+// Return the default config object, which is nil in this case.
+func (p *ManifestDeploymentConfigPlugin) DefaultConfig(imageInfo interface{}) interface{} {
+	return nil
+}
+
+// Return the default cluster config object.
+func (p *ManifestDeploymentConfigPlugin) DefaultClusterConfig() interface{} {
+	return map[string]interface{}{
+		"manifestArchive":  "",
+		"kustomizeOverlay": "",
+	}
+}
+
+func (p *ManifestDeploymentConfigPlugin) Validate(dep interface{}, cdep interface{}) (bool, error) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	// If there is a native deployment config, defer to that plugin.
+	if dep != nil {
+		return false, nil
+	}
+
+	if dc, ok := cdep.(map[string]interface{}); !ok {
+		return false, nil
+	} else if m, ok := dc["manifestArchive"]; !ok {
+		return false, nil
+	} else if ma, ok := m.(string); !ok {
+		return true, errors.New(msgPrinter.Sprintf("manifestArchive must have a string type value, has %T", m))
+	} else if len(ma) == 0 {
+		return true, errors.New(msgPrinter.Sprintf("manifestArchive must be a non-empty string"))
+	} else if o, ok := dc["kustomizeOverlay"]; ok {
+		if _, ok := o.(string); !ok {
+			return true, errors.New(msgPrinter.Sprintf("kustomizeOverlay must have a string type value, has %T", o))
+		}
+	}
+	return true, nil
+}
+
+func (p *ManifestDeploymentConfigPlugin) StartTest(homeDirectory string, userInputFile string, configFiles []string, configType string, noFSS bool, userCreds string) bool {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	// Run verification before trying to start anything.
+	dev.ServiceValidate(homeDirectory, userInputFile, configFiles, configType, userCreds)
+
+	// Perform the common execution setup.
+	dir, _, _ := dev.CommonExecutionSetup(homeDirectory, userInputFile, dev.SERVICE_COMMAND, dev.SERVICE_START_COMMAND)
+
+	// Get the service definition, so that we can look at the user input variable definitions.
+	serviceDef, sderr := dev.GetServiceDefinition(dir, dev.SERVICE_DEFINITION_FILE)
+	if sderr != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, fmt.Sprintf("'%v %v' %v", dev.SERVICE_COMMAND, dev.SERVICE_START_COMMAND, sderr))
+	}
+
+	// Now that we have the service def, we can check if we own the deployment config object.
+	if owned, err := p.Validate(serviceDef.Deployment, serviceDef.ClusterDeployment); !owned || err != nil {
+		return false
+	}
+
+	cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("'%v %v' not supported for services using a %v deployment configuration", dev.SERVICE_COMMAND, dev.SERVICE_START_COMMAND, MANIFEST_DEPLOYMENT_CONFIG_TYPE))
+
+	// For the compiler
+	return true
+}
+
+func (p *ManifestDeploymentConfigPlugin) StopTest(homeDirectory string) bool {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	// Perform the common execution setup.
+	dir, _, _ := dev.CommonExecutionSetup(homeDirectory, "", dev.SERVICE_COMMAND, dev.SERVICE_START_COMMAND)
+
+	// Get the service definition, so that we can look at the user input variable definitions.
+	serviceDef, sderr := dev.GetServiceDefinition(dir, dev.SERVICE_DEFINITION_FILE)
+	if sderr != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, fmt.Sprintf("'%v %v' %v", dev.SERVICE_COMMAND, dev.SERVICE_START_COMMAND, sderr))
+	}
+
+	// Now that we have the service def, we can check if we own the deployment config object.
+	if owned, err := p.Validate(serviceDef.Deployment, serviceDef.ClusterDeployment); !owned || err != nil {
+		return false
+	}
+
+	cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("'%v %v' not supported for services using a %v deployment configuration", dev.SERVICE_COMMAND, dev.SERVICE_STOP_COMMAND, MANIFEST_DEPLOYMENT_CONFIG_TYPE))
+
+	// For the compiler
+	return true
+}
+
+// Package the files of the directory as a tar.gz archive and convert it into a base 64 encoded string. The input
+// directory is assumed to be absolute.
+func ConvertDirToB64String(dir string) (string, error) {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+
+		fileBytes, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = tarWriter.Write(fileBytes)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	} else if err := gzipWriter.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -38,7 +38,7 @@ func (p *NativeDeploymentConfigPlugin) Sign(dep map[string]interface{}, keyFileP
 
 	// Since the deployment config has been validated as ours, we can assume it is structured correctly.
 	services := dep["services"].(map[string]interface{})
-	var dontTouchImage, pullImage, ok bool
+	var dontTouchImage, pullImage, resolveDigest, ok bool
 	dontTouchImage, ok = (ctx.Get("dontTouchImage")).(bool)
 	if !ok {
 		dontTouchImage = false
@@ -47,12 +47,16 @@ func (p *NativeDeploymentConfigPlugin) Sign(dep map[string]interface{}, keyFileP
 	if !ok {
 		pullImage = false
 	}
+	resolveDigest, ok = (ctx.Get("resolveDigest")).(bool)
+	if !ok {
+		resolveDigest = false
+	}
 
 	for _, svc := range services {
 		service := svc.(map[string]interface{})
 		image := service["image"].(string)
 
-		newImage := cliutils.GetNewDockerImageName(image, dontTouchImage, pullImage)
+		newImage := cliutils.GetNewDockerImageName(image, dontTouchImage, pullImage, resolveDigest)
 		if newImage != image {
 			msgPrinter.Printf("Using '%s' in 'deployment' field instead of '%s'", newImage, image)
 			msgPrinter.Println()
@@ -143,6 +147,29 @@ func (p *NativeDeploymentConfigPlugin) Validate(dep interface{}, cdep interface{
 		if err := depConfig.CanStartStop(); err != nil {
 			return true, err
 		}
+		for serviceName, service := range depConfig.Services {
+			if err := service.ValidateResourceLimits(0); err != nil {
+				return true, errors.New(i18n.GetMessagePrinter().Sprintf("service '%s' defined under 'deployment.services' has invalid resource limits: %v", serviceName, err))
+			}
+			if service.Healthcheck != nil {
+				if err := service.Healthcheck.Validate(); err != nil {
+					return true, errors.New(i18n.GetMessagePrinter().Sprintf("service '%s' defined under 'deployment.services' has an invalid healthcheck: %v", serviceName, err))
+				}
+			}
+			if service.Readiness != nil {
+				if err := service.Readiness.Validate(); err != nil {
+					return true, errors.New(i18n.GetMessagePrinter().Sprintf("service '%s' defined under 'deployment.services' has an invalid readiness probe: %v", serviceName, err))
+				}
+			}
+			if service.RestartPolicy != nil {
+				if err := service.RestartPolicy.Validate(); err != nil {
+					return true, errors.New(i18n.GetMessagePrinter().Sprintf("service '%s' defined under 'deployment.services' has an invalid restart policy: %v", serviceName, err))
+				}
+			}
+			if err := service.ValidateVolumes(); err != nil {
+				return true, errors.New(i18n.GetMessagePrinter().Sprintf("service '%s' defined under 'deployment.services' has invalid volume options: %v", serviceName, err))
+			}
+		}
 		for k, svc := range services {
 			switch s := svc.(type) {
 			case map[string]interface{}:
@@ -159,7 +186,7 @@ func (p *NativeDeploymentConfigPlugin) Validate(dep interface{}, cdep interface{
 }
 
 // This can't be a const because a map literal isn't a const in go
-var VALID_DEPLOYMENT_FIELDS = map[string]int8{"image": 1, "privileged": 1, "cap_add": 1, "environment": 1, "devices": 1, "binds": 1, "specific_ports": 1, "command": 1, "ports": 1, "ephemeral_ports": 1, "tmpfs": 1, "network": 1}
+var VALID_DEPLOYMENT_FIELDS = map[string]int8{"image": 1, "privileged": 1, "cap_add": 1, "environment": 1, "devices": 1, "binds": 1, "specific_ports": 1, "command": 1, "ports": 1, "ephemeral_ports": 1, "tmpfs": 1, "network": 1, "cpus": 1, "cpu_shares": 1, "memory": 1, "memory_reservation": 1, "pids_limit": 1, "healthcheck": 1, "readiness": 1, "restart_policy": 1, "volumes": 1}
 
 // CheckDeploymentService verifies it has the required 'image' key, and checks for keys we don't recognize.
 // For now it only prints a warning for unrecognized keys, in case we recently added a key to anax and haven't updated hzn yet.
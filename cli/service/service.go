@@ -28,11 +28,13 @@ type APIServices struct {
 }
 
 type OurService struct {
-	Url       string                 `json:"url"`     // A URL pointing to the definition of the service
-	Org       string                 `json:"org"`     // The organization where the service is defined
-	Version   string                 `json:"version"` // The version of the service in OSGI version format
-	Arch      string                 `json:"arch"`    // The hardware architecture of the service impl
-	Variables map[string]interface{} `json:"variables"`
+	Url       string                      `json:"url"`     // A URL pointing to the definition of the service
+	Org       string                      `json:"org"`     // The organization where the service is defined
+	Version   string                      `json:"version"` // The version of the service in OSGI version format
+	Arch      string                      `json:"arch"`    // The hardware architecture of the service impl
+	Variables map[string]interface{}      `json:"variables"`
+	Images    []string                    `json:"images,omitempty"`    // The images of the running containers of the service, pinned by digest
+	Readiness []persistence.ReadinessGate `json:"readiness,omitempty"` // Whether the service is waiting for the services it depends on to be ready
 }
 
 func List() {
@@ -52,6 +54,14 @@ func List() {
 	cliutils.HorizonGet("status", []int{200}, &statusInfo, false)
 	anaxArch := (*statusInfo.Configuration).Arch
 
+	// Get the running services, to show the images their containers are running.
+	type AllServices struct {
+		Instances map[string][]api.MicroserviceInstanceOutput `json:"instances"` // The service instances that are running
+		Readiness []persistence.ReadinessGate                 `json:"readiness"` // The readiness gates of the service instances
+	}
+	var runningServices AllServices
+	cliutils.HorizonGet("service", []int{200}, &runningServices, false)
+
 	// Go thru the services and pull out interesting fields
 	services := make([]OurService, 0)
 	for _, s := range apiOutput.Config {
@@ -73,6 +83,21 @@ func List() {
 			}
 		}
 
+		for _, serviceInstance := range runningServices.Instances["active"] {
+			if serviceInstance.SpecRef != serv.Url || serviceInstance.Org != serv.Org || serviceInstance.Containers == nil {
+				continue
+			}
+			for _, container := range *serviceInstance.Containers {
+				serv.Images = append(serv.Images, container.Image)
+			}
+		}
+
+		for _, gate := range runningServices.Readiness {
+			if gate.SpecRef == serv.Url && gate.Org == serv.Org && gate.Version == serv.Version {
+				serv.Readiness = append(serv.Readiness, gate)
+			}
+		}
+
 		services = append(services, serv)
 	}
 
@@ -363,3 +388,33 @@ func Resume(applyAll bool, serviceOrg string, serviceUrl string) {
 	msgPrinter.Printf("Service resuming request successfully sent, please use 'hzn agreement' and 'docker ps' to make sure the related agreements and service containers are started. It may take a couple of minutes.")
 	msgPrinter.Println()
 }
+
+func VolumeList() {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	apiOutput := make(map[string][]persistence.ContainerVolume)
+	cliutils.HorizonGet("service/volume", []int{200}, &apiOutput, false)
+
+	// Convert to json and output
+	jsonBytes, err := json.MarshalIndent(apiOutput, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn service volume list' output: %v", err))
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
+
+func VolumeDelete(name string, force bool) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if !force {
+		cliutils.ConfirmRemove(msgPrinter.Sprintf("Are you sure you want to delete volume %v and all the data in it?", name))
+	}
+
+	if _, err := cliutils.HorizonDelete("service/volume/"+name, []int{200, 204}, []int{404, 409}, false); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, err.Error())
+	}
+	msgPrinter.Printf("Volume %v deleted.", name)
+	msgPrinter.Println()
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/open-horizon/anax/cli/dev"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/resource"
 	"io/ioutil"
@@ -94,7 +95,7 @@ func Start(cw *container.ContainerWorker, org string, configFiles []string, conf
 	return nil
 }
 
-func Stop(dc *docker.Client) error {
+func Stop(dc containerruntime.ContainerRuntime) error {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -119,7 +120,7 @@ func Stop(dc *docker.Client) error {
 // Make sure the file sync service docker images are available locally. Either they are already present in the
 // local docker repo or we need to pull them in. This function checks for an exact match of image and tag name.
 // It does not try to re-pull if the image is already local.
-func getImage(imageName string, tagName string, dc *docker.Client) error {
+func getImage(imageName string, tagName string, dc containerruntime.ContainerRuntime) error {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -164,7 +165,7 @@ func getImage(imageName string, tagName string, dc *docker.Client) error {
 }
 
 // remove image. Ignore error if image does not exist
-func removeImage(imageName string, tagName string, dc *docker.Client) error {
+func removeImage(imageName string, tagName string, dc containerruntime.ContainerRuntime) error {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -182,7 +183,7 @@ func removeImage(imageName string, tagName string, dc *docker.Client) error {
 }
 
 // Start the CSS container.
-func startCSS(dc *docker.Client, network *docker.Network) error {
+func startCSS(dc containerruntime.ContainerRuntime, network *docker.Network) error {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -380,7 +381,7 @@ func startESS(cw *container.ContainerWorker, network *docker.Network, org string
 }
 
 // Stop the container.
-func stopContainer(dc *docker.Client, name string) error {
+func stopContainer(dc containerruntime.ContainerRuntime, name string) error {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -516,7 +517,7 @@ func putFile(url string, org string, metadata *cssFileMeta, file []byte) error {
 	return nil
 }
 
-func createNetwork(client *docker.Client, name string) (*docker.Network, error) {
+func createNetwork(client containerruntime.ContainerRuntime, name string) (*docker.Network, error) {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -550,7 +551,7 @@ func createNetwork(client *docker.Client, name string) (*docker.Network, error)
 	return bridge, nil
 }
 
-func removeNetwork(client *docker.Client, name string) error {
+func removeNetwork(client containerruntime.ContainerRuntime, name string) error {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
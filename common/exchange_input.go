@@ -40,6 +40,7 @@ type PatternFile struct {
 	Services           []ServiceReferenceFile       `json:"services"`
 	AgreementProtocols []exchange.AgreementProtocol `json:"agreementProtocols,omitempty"`
 	UserInput          []policy.UserInput           `json:"userInput,omitempty"`
+	SecretBinding      []policy.SecretBinding       `json:"secretBinding,omitempty"`
 }
 
 func (p *PatternFile) GetOrg() string {
@@ -122,6 +123,7 @@ type ServiceFile struct {
 	MatchHardware              map[string]interface{}       `json:"matchHardware,omitempty"`
 	RequiredServices           []exchange.ServiceDependency `json:"requiredServices"`
 	UserInputs                 []exchange.UserInput         `json:"userInput"`
+	Secrets                    []exchange.Secret            `json:"secrets,omitempty"`
 	Deployment                 interface{}                  `json:"deployment,omitempty"` // interface{} because pre-signed services can be stringified json
 	DeploymentSignature        string                       `json:"deploymentSignature,omitempty"`
 	ClusterDeployment          interface{}                  `json:"clusterDeployment,omitempty"`
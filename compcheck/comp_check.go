@@ -9,6 +9,7 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
@@ -81,17 +82,30 @@ func (p CompCheck) String() string {
 
 // The output format for the compatibility check
 type CompCheckOutput struct {
-	Compatible bool               `json:"compatible"`
-	Reason     map[string]string  `json:"reason"` // set when not compatible
-	Input      *CompCheckResource `json:"input,omitempty"`
+	Compatible bool                       `json:"compatible"`
+	Reason     map[string]string          `json:"reason"`                      // set when not compatible
+	Detail     map[string]ConstraintCheck `json:"constraint_detail,omitempty"` // keyed by the same service ids as Reason
+	HelmValues map[string][]HelmValue     `json:"helm_values,omitempty"`       // keyed by the ids of the compatible Helm services
+	Input      *CompCheckResource         `json:"input,omitempty"`
 }
 
 func (p *CompCheckOutput) String() string {
-	return fmt.Sprintf("Compatible: %v, Reason: %v, Input: %v",
-		p.Compatible, p.Reason, p.Input)
+	return fmt.Sprintf("Compatible: %v, Reason: %v, Detail: %v, HelmValues: %v, Input: %v",
+		p.Compatible, p.Reason, p.Detail, p.HelmValues, p.Input)
 
 }
 
+// The evaluation of the constraints of the node policy and of the deployment policy (merged with the service policy)
+// against the properties of the other one, as a tree with one node per sub-expression.
+type ConstraintCheck struct {
+	NodeConstraints       *plugin_registry.ExpressionEvaluation `json:"node_constraints,omitempty"`
+	DeploymentConstraints *plugin_registry.ExpressionEvaluation `json:"deployment_constraints,omitempty"`
+}
+
+func (c ConstraintCheck) String() string {
+	return fmt.Sprintf("NodeConstraints: %v, DeploymentConstraints: %v", c.NodeConstraints, c.DeploymentConstraints)
+}
+
 func NewCompCheckOutput(compatible bool, reason map[string]string, input *CompCheckResource) *CompCheckOutput {
 	return &CompCheckOutput{
 		Compatible: compatible,
@@ -338,6 +352,16 @@ func createCompCheckOutput(pcOutput *CompCheckOutput, privOutput *CompCheckOutpu
 	}
 	ccOutput.Reason = reason
 
+	// the constraint evaluation only comes from the policy check
+	if len(pcOutput.Detail) != 0 {
+		ccOutput.Detail = map[string]ConstraintCheck{}
+		for sId := range reason {
+			if detail, ok := pcOutput.Detail[sId]; ok {
+				ccOutput.Detail[sId] = detail
+			}
+		}
+	}
+
 	// combine the input part
 	ccInput := CompCheckResource{}
 	ccInput.NodeId = uiOutput.Input.NodeId
@@ -591,3 +615,68 @@ func CheckTypeCompatibility(nodeType string, serviceDef common.AbstractServiceFi
 
 	return true, ""
 }
+
+// Check if the node has enough cpus and memory to satisfy the resource limits declared in the deployment configuration
+// of the service and of the services it depends on. The node capacity comes from the openhorizon.cpu and openhorizon.memory
+// built-in properties. If the node policy does not have these properties, the check passes because the node capacity is unknown.
+func CheckResourceCompatibility(nodePolicy *policy.Policy, serviceDef common.AbstractServiceFile, dependentSvcDefs map[string]exchange.ServiceDefinition, msgPrinter *message.Printer) (bool, string) {
+	if nodePolicy == nil {
+		return true, ""
+	}
+
+	// The dependent services run in their own containers next to the top level service, so their memory adds up.
+	cpus, mem := getResourceRequirements(serviceDef.GetDeployment())
+	for _, depDef := range dependentSvcDefs {
+		depCpus, depMem := getResourceRequirements(depDef.Deployment)
+		if depCpus > cpus {
+			cpus = depCpus
+		}
+		mem += depMem
+	}
+
+	if nodeCpus, ok := getNumericProperty(nodePolicy.Properties, externalpolicy.PROP_NODE_CPU); ok && cpus > nodeCpus {
+		return false, msgPrinter.Sprintf("Service requires %v cpus but the node property %v is %v.", cpus, externalpolicy.PROP_NODE_CPU, nodeCpus)
+	}
+	if nodeMem, ok := getNumericProperty(nodePolicy.Properties, externalpolicy.PROP_NODE_MEMORY); ok && float64(mem) > nodeMem {
+		return false, msgPrinter.Sprintf("Service requires %v MB of memory but the node property %v is %v.", mem, externalpolicy.PROP_NODE_MEMORY, nodeMem)
+	}
+
+	return true, ""
+}
+
+// Returns the cpus and memory (in MB) required by the resource limits in the given deployment configuration.
+func getResourceRequirements(deployment interface{}) (float64, int64) {
+	if common.DeploymentIsEmpty(deployment) {
+		return 0, 0
+	}
+
+	depConfig, err := common.ConvertToDeploymentConfig(deployment)
+	if err != nil || depConfig == nil {
+		// a deployment config that is not a native one does not have resource limits.
+		return 0, 0
+	}
+
+	dd := containermessage.DeploymentDescription{Services: depConfig.Services}
+	return dd.ResourceRequirements()
+}
+
+// Returns the value of the named property as a float64 if the property exists and is a number.
+func getNumericProperty(props externalpolicy.PropertyList, name string) (float64, bool) {
+	prop, err := props.GetProperty(name)
+	if err != nil {
+		return 0, false
+	}
+	switch v := prop.Value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
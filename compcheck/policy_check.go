@@ -123,6 +123,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 
 	// go through all the workloads and check if compatible or not
 	messages := map[string]string{}
+	details := map[string]ConstraintCheck{}
 	overall_compatible := false
 	for _, workload := range bPolicy.Workloads {
 
@@ -154,7 +155,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 		if input.ServicePolicy == nil {
 			if workload.Arch != "" {
 				// get service policy with built-in properties
-				if mergedServicePol, sPol, topSvcDef, sId, err := GetServicePolicyWithDefaultProperties(servicePolicyHandler, getServiceResolvedDef, getService, workload.WorkloadURL, workload.Org, workload.Version, workload.Arch, msgPrinter); err != nil {
+				if mergedServicePol, sPol, topSvcDef, depSvcDefs, sId, err := GetServicePolicyWithDefaultProperties(servicePolicyHandler, getServiceResolvedDef, getService, workload.WorkloadURL, workload.Org, workload.Version, workload.Arch, msgPrinter); err != nil {
 					return nil, err
 					// compatibility check
 				} else {
@@ -167,20 +168,25 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 					reason := ""
 					if topSvcDef != nil {
 						compatible, reason = CheckTypeCompatibility(resources.NodeType, &ServiceDefinition{workload.Org, *topSvcDef}, msgPrinter)
+						if compatible {
+							compatible, reason = CheckResourceCompatibility(nPolicy, &ServiceDefinition{workload.Org, *topSvcDef}, depSvcDefs, msgPrinter)
+						}
 					}
 					if compatible {
 						// policy compatibility check
-						compatible, reason, _, _, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
+						var consumerPol *policy.Policy
+						compatible, reason, _, consumerPol, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
 						if err1 != nil {
 							return nil, err1
 						}
+						details[sId] = EvaluatePolicyConstraints(nPolicy, consumerPol)
 					}
 					if compatible {
 						overall_compatible = true
 						if checkAllSvcs {
 							messages[sId] = msg_compatible
 						} else {
-							return NewCompCheckOutput(true, map[string]string{sId: msg_compatible}, resources), nil
+							return newPolicyCheckOutput(true, map[string]string{sId: msg_compatible}, details, resources), nil
 						}
 					} else {
 						messages[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
@@ -193,7 +199,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 					// since workload arch is empty, need to go through all the arches
 					for sId, svc := range svcMeta {
 						// get service policy with built-in properties
-						mergedServicePol, sPol, topSvcDef, _, err := GetServicePolicyWithDefaultProperties(servicePolicyHandler, getServiceResolvedDef, getService, workload.WorkloadURL, workload.Org, workload.Version, svc.Arch, msgPrinter)
+						mergedServicePol, sPol, topSvcDef, depSvcDefs, _, err := GetServicePolicyWithDefaultProperties(servicePolicyHandler, getServiceResolvedDef, getService, workload.WorkloadURL, workload.Org, workload.Version, svc.Arch, msgPrinter)
 						if err != nil {
 							return nil, err
 						} else {
@@ -206,20 +212,25 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 							reason := ""
 							if topSvcDef != nil {
 								compatible, reason = CheckTypeCompatibility(resources.NodeType, &ServiceDefinition{workload.Org, *topSvcDef}, msgPrinter)
+								if compatible {
+									compatible, reason = CheckResourceCompatibility(nPolicy, &ServiceDefinition{workload.Org, *topSvcDef}, depSvcDefs, msgPrinter)
+								}
 							}
 							if compatible {
 								// policy compatibility check
-								compatible, reason, _, _, err = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
+								var consumerPol *policy.Policy
+								compatible, reason, _, consumerPol, err = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
 								if err != nil {
 									return nil, err
 								}
+								details[sId] = EvaluatePolicyConstraints(nPolicy, consumerPol)
 							}
 							if compatible {
 								overall_compatible = true
 								if checkAllSvcs {
 									messages[sId] = msg_compatible
 								} else {
-									return NewCompCheckOutput(true, map[string]string{sId: msg_compatible}, resources), nil
+									return newPolicyCheckOutput(true, map[string]string{sId: msg_compatible}, details, resources), nil
 								}
 							} else {
 								messages[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
@@ -238,7 +249,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 			builtInSvcPol := externalpolicy.CreateServiceBuiltInPolicy(workload.WorkloadURL, workload.Org, workload.Version, workload.Arch)
 			// add built-in service properties to the service policy
 			mergedServicePol := AddDefaultPropertiesToServicePolicy(input.ServicePolicy, builtInSvcPol, msgPrinter)
-			mergedServicePol, topSvcDef, sId, err := SetServicePolicyPrivilege(getServiceResolvedDef, getService, workload, mergedServicePol, input.Service, msgPrinter)
+			mergedServicePol, topSvcDef, sId, depSvcDefs, err := SetServicePolicyPrivilege(getServiceResolvedDef, getService, workload, mergedServicePol, input.Service, msgPrinter)
 			// node type and service type check
 			var err1 error
 			compatible := true
@@ -251,13 +262,18 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 			} else {
 				if topSvcDef != nil {
 					compatible, reason = CheckTypeCompatibility(resources.NodeType, &ServiceDefinition{workload.Org, *topSvcDef}, msgPrinter)
+					if compatible {
+						compatible, reason = CheckResourceCompatibility(nPolicy, &ServiceDefinition{workload.Org, *topSvcDef}, depSvcDefs, msgPrinter)
+					}
 				}
 				if compatible {
 					// policy compatibility check
-					compatible, reason, _, _, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
+					var consumerPol *policy.Policy
+					compatible, reason, _, consumerPol, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
 					if err1 != nil {
 						return nil, err1
 					}
+					details[sId] = EvaluatePolicyConstraints(nPolicy, consumerPol)
 				}
 			}
 			if compatible {
@@ -265,7 +281,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 				if checkAllSvcs {
 					messages[sId] = msg_compatible
 				} else {
-					return NewCompCheckOutput(true, map[string]string{sId: msg_compatible}, resources), nil
+					return newPolicyCheckOutput(true, map[string]string{sId: msg_compatible}, details, resources), nil
 				}
 			} else {
 				messages[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
@@ -274,7 +290,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 	}
 
 	if messages != nil && len(messages) != 0 {
-		return NewCompCheckOutput(overall_compatible, messages, resources), nil
+		return newPolicyCheckOutput(overall_compatible, messages, details, resources), nil
 	} else {
 		// If we get here, it means that no workload is found in the bp that matches the required node arch.
 		if resources.NodeArch != "" {
@@ -332,6 +348,38 @@ func CheckPolicyCompatiblility(nodePolicy *policy.Policy, businessPolicy *policy
 	}
 }
 
+// Evaluate the constraints of the node policy against the properties of the consumer policy, and the constraints of the
+// consumer policy against the node properties, the same way policy.Are_Compatible does. The consumer policy is the
+// deployment policy merged with the service policy.
+func EvaluatePolicyConstraints(nodePolicy *policy.Policy, consumerPolicy *policy.Policy) ConstraintCheck {
+	var detail ConstraintCheck
+	if nodePolicy == nil || consumerPolicy == nil {
+		return detail
+	}
+
+	if eval, err := consumerPolicy.Constraints.Evaluate(nodePolicy.Properties); err == nil {
+		detail.DeploymentConstraints = eval
+	}
+	if eval, err := nodePolicy.Constraints.Evaluate(consumerPolicy.Properties); err == nil {
+		detail.NodeConstraints = eval
+	}
+	return detail
+}
+
+// Create the policy check output, with the constraint evaluation for the services that are in the reason map.
+func newPolicyCheckOutput(compatible bool, reason map[string]string, details map[string]ConstraintCheck, input *CompCheckResource) *CompCheckOutput {
+	output := NewCompCheckOutput(compatible, reason, input)
+	for sId := range reason {
+		if detail, ok := details[sId]; ok {
+			if output.Detail == nil {
+				output.Detail = map[string]ConstraintCheck{}
+			}
+			output.Detail[sId] = detail
+		}
+	}
+	return output
+}
+
 // add node arch property to the node policy. node arch can be empty
 func addNodeArchToPolicy(nodePolicy *policy.Policy, nodeArch string, msgPrinter *message.Printer) (*policy.Policy, error) {
 	// get default message printer if nil
@@ -602,7 +650,7 @@ func GetServicePolicy(servicePolicyHandler exchange.ServicePolicyHandler, svcUrl
 func GetServicePolicyWithDefaultProperties(servicePolicyHandler exchange.ServicePolicyHandler,
 	getServiceResolvedDef exchange.ServiceDefResolverHandler, getService exchange.ServiceHandler,
 	svcUrl string, svcOrg string, svcVersion string, svcArch string,
-	msgPrinter *message.Printer) (*externalpolicy.ExternalPolicy, *externalpolicy.ExternalPolicy, *exchange.ServiceDefinition, string, error) {
+	msgPrinter *message.Printer) (*externalpolicy.ExternalPolicy, *externalpolicy.ExternalPolicy, *exchange.ServiceDefinition, map[string]exchange.ServiceDefinition, string, error) {
 	// get default message printer if nil
 	if msgPrinter == nil {
 		msgPrinter = i18n.GetMessagePrinter()
@@ -610,23 +658,23 @@ func GetServicePolicyWithDefaultProperties(servicePolicyHandler exchange.Service
 
 	servicePol, sId, err := GetServicePolicy(servicePolicyHandler, svcUrl, svcOrg, svcVersion, svcArch, msgPrinter)
 	if err != nil {
-		return nil, nil, nil, "", err
+		return nil, nil, nil, nil, "", err
 	}
 
 	// get default service properties
 	builtInSvcPol := externalpolicy.CreateServiceBuiltInPolicy(svcUrl, svcOrg, svcVersion, svcArch)
 
 	if err != nil {
-		return nil, nil, nil, "", err
+		return nil, nil, nil, nil, "", err
 	}
 
 	// add built-in service properties to the service policy
 	merged_pol := AddDefaultPropertiesToServicePolicy(servicePol, builtInSvcPol, msgPrinter)
-	merged_pol, topSvcDef, _, err := SetServicePolicyPrivilege(getServiceResolvedDef, getService, policy.Workload{WorkloadURL: svcUrl, Org: svcOrg, Version: svcVersion, Arch: svcArch}, merged_pol, nil, msgPrinter)
+	merged_pol, topSvcDef, _, depSvcDefs, err := SetServicePolicyPrivilege(getServiceResolvedDef, getService, policy.Workload{WorkloadURL: svcUrl, Org: svcOrg, Version: svcVersion, Arch: svcArch}, merged_pol, nil, msgPrinter)
 	if err != nil {
-		return nil, nil, nil, "", err
+		return nil, nil, nil, nil, "", err
 	}
-	return merged_pol, servicePol, topSvcDef, sId, nil
+	return merged_pol, servicePol, topSvcDef, depSvcDefs, sId, nil
 }
 
 // Add service default properties to the given service policy
@@ -684,7 +732,7 @@ func MergeServicePolicyToBusinessPolicy(getServiceResolvedDef exchange.ServiceDe
 	// add built-in service properties to the service policy
 	merged_pol1 := AddDefaultPropertiesToServicePolicy(servicePol, builtInSvcPol, msgPrinter)
 	var err error
-	if merged_pol1, _, _, err = SetServicePolicyPrivilege(getServiceResolvedDef, getService, workload, merged_pol1, nil, msgPrinter); err != nil {
+	if merged_pol1, _, _, _, err = SetServicePolicyPrivilege(getServiceResolvedDef, getService, workload, merged_pol1, nil, msgPrinter); err != nil {
 		return nil, err
 	}
 
@@ -713,9 +761,10 @@ func MergeServicePolicyToBusinessPolicy(getServiceResolvedDef exchange.ServiceDe
 
 // SetServicePolicyPrivilege sets a property on the service privilege that indicates if the service uses a workload that requires privileged mode or network=host
 // This will not overwrite openhorizon.allowPrivileged=true if the service is found to not require privileged mode.
+// It also returns the top level service definition and the definitions of its dependent services.
 func SetServicePolicyPrivilege(getServiceResolvedDef exchange.ServiceDefResolverHandler, getService exchange.ServiceHandler,
 	workload policy.Workload, svcPolicy *externalpolicy.ExternalPolicy, svcDefs []common.ServiceFile,
-	msgPrinter *message.Printer) (*externalpolicy.ExternalPolicy, *exchange.ServiceDefinition, string, error) {
+	msgPrinter *message.Printer) (*externalpolicy.ExternalPolicy, *exchange.ServiceDefinition, string, map[string]exchange.ServiceDefinition, error) {
 	if msgPrinter == nil {
 		msgPrinter = i18n.GetMessagePrinter()
 	}
@@ -728,10 +777,10 @@ func SetServicePolicyPrivilege(getServiceResolvedDef exchange.ServiceDefResolver
 	if svcDefs == nil || len(svcDefs) == 0 {
 		sDefMap, topSvcDef, topSvcId, err = getServiceResolvedDef(workload.WorkloadURL, workload.Org, workload.Version, workload.Arch)
 		if err != nil {
-			return nil, nil, "", NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("Error retrieving service %v/%v %v %v and its dependents from the Exchange. %v", workload.Org, workload.WorkloadURL, workload.Version, workload.Arch, err)), COMPCHECK_EXCHANGE_ERROR)
+			return nil, nil, "", nil, NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("Error retrieving service %v/%v %v %v and its dependents from the Exchange. %v", workload.Org, workload.WorkloadURL, workload.Version, workload.Arch, err)), COMPCHECK_EXCHANGE_ERROR)
 		}
-		if sDefMap != nil {
-			svcList = sDefMap
+		for sId, sDef := range sDefMap {
+			svcList[sId] = sDef
 		}
 
 		if topSvcDef != nil {
@@ -740,7 +789,7 @@ func SetServicePolicyPrivilege(getServiceResolvedDef exchange.ServiceDefResolver
 	} else {
 		sDefMap, topSvcDef, topSvcId, err = getServiceListFromInputDefs(getServiceResolvedDef, workload, svcDefs, msgPrinter)
 		if err != nil {
-			return nil, nil, "", err
+			return nil, nil, "", nil, err
 		}
 		if topSvcDef != nil {
 			svcList[topSvcId] = *topSvcDef
@@ -749,7 +798,7 @@ func SetServicePolicyPrivilege(getServiceResolvedDef exchange.ServiceDefResolver
 
 	runtimePriv, err, _ := ServicesRequirePrivilege(&svcList, msgPrinter)
 	if err != nil {
-		return nil, nil, "", err
+		return nil, nil, "", nil, err
 	}
 
 	svcPolicy.Properties.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_SVC_PRIVILEGED, runtimePriv), true)
@@ -757,7 +806,7 @@ func SetServicePolicyPrivilege(getServiceResolvedDef exchange.ServiceDefResolver
 	if runtimePriv {
 		svcPolicy.Constraints.Add_Constraint(fmt.Sprintf("%s = %t", externalpolicy.PROP_SVC_PRIVILEGED, runtimePriv))
 	}
-	return svcPolicy, topSvcDef, topSvcId, nil
+	return svcPolicy, topSvcDef, topSvcId, sDefMap, nil
 }
 
 // Given a list of service def files for top level services and a workload,
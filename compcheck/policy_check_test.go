@@ -783,7 +783,7 @@ func Test_CheckPolicyCompatiblility(t *testing.T) {
 		t.Errorf("GetNodePolicy should have returned nil error but got: %v", err)
 	}
 
-	mergedSPol, _, _, _, err := GetServicePolicyWithDefaultProperties(getServicePolicyHandler(map[string]string{"prop5": "val5", "prop6": "val6"}, []string{"prop4 == \"some value\""}), getServiceDefResolverHandler(), getServiceHandler(), svcUrl, svcOrg, svcVersion, svcArch, msgPrinter)
+	mergedSPol, _, _, _, _, err := GetServicePolicyWithDefaultProperties(getServicePolicyHandler(map[string]string{"prop5": "val5", "prop6": "val6"}, []string{"prop4 == \"some value\""}), getServiceDefResolverHandler(), getServiceHandler(), svcUrl, svcOrg, svcVersion, svcArch, msgPrinter)
 	if err != nil {
 		t.Errorf("GetServicePolicyWithDefaultProperties should have returned nil error but got: %v", err)
 	}
@@ -969,7 +969,7 @@ func Test_GetServicePolicyWithDefaultProperties(t *testing.T) {
 	sId1 := cutil.FormExchangeIdForService(svcUrl, svcVersion, svcArch)
 	sId1 = fmt.Sprintf("%v/%v", svcOrg, sId1)
 
-	if mergedPol, sPol, sDef, sId, err := GetServicePolicyWithDefaultProperties(getServicePolicyHandler(map[string]string{"prop1": "val1", "prop2": "val2"}, []string{"prop4 == \"some value\""}), getServiceDefResolverHandler(), getServiceHandler(), svcUrl, svcOrg, svcVersion, svcArch, msgPrinter); err != nil {
+	if mergedPol, sPol, sDef, _, sId, err := GetServicePolicyWithDefaultProperties(getServicePolicyHandler(map[string]string{"prop1": "val1", "prop2": "val2"}, []string{"prop4 == \"some value\""}), getServiceDefResolverHandler(), getServiceHandler(), svcUrl, svcOrg, svcVersion, svcArch, msgPrinter); err != nil {
 		t.Errorf("GetServicePolicyWithDefaultProperties should have returned nil error but got: %v", err)
 	} else if sId != sId1 {
 		t.Errorf("The servicd id should be %v but got: %v", sId1, sId)
@@ -991,7 +991,7 @@ func Test_GetServicePolicyWithDefaultProperties(t *testing.T) {
 		t.Errorf("The service policy hould not have 1 constraints but got %v", len(sPol.Constraints))
 	}
 
-	if _, _, _, _, err := GetServicePolicyWithDefaultProperties(getServicePolicyHandler_Error(), getServiceDefResolverHandler(), getServiceHandler(), svcUrl, svcOrg, svcVersion, svcArch, msgPrinter); err == nil {
+	if _, _, _, _, _, err := GetServicePolicyWithDefaultProperties(getServicePolicyHandler_Error(), getServiceDefResolverHandler(), getServiceHandler(), svcUrl, svcOrg, svcVersion, svcArch, msgPrinter); err == nil {
 		t.Errorf("GetServicePolicyWithDefaultProperties should have returned error but got nil")
 	}
 }
@@ -1325,3 +1325,117 @@ func getServiceDefResolverHandler() exchange.ServiceDefResolverHandler {
 		return map[string]exchange.ServiceDefinition{}, service, sId, nil
 	}
 }
+
+func Test_CheckResourceCompatibility(t *testing.T) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	nodePol := policy.Policy_Factory("test node policy")
+	nodePol.Properties.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_CPU, float64(2)), false)
+	nodePol.Properties.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_MEMORY, float64(1024)), false)
+
+	sDef := exchange.ServiceDefinition{
+		URL:        "cpu",
+		Version:    "1.0.0",
+		Arch:       "amd64",
+		Deployment: `{"services":{"cpu":{"image":"cpu:1.0.0","cpus":1.5,"memory":512},"helper":{"image":"helper:1.0.0","memory":256}}}`,
+	}
+
+	if compatible, reason := CheckResourceCompatibility(nodePol, &ServiceDefinition{"mycomp", sDef}, nil, msgPrinter); !compatible {
+		t.Errorf("CheckResourceCompatibility should have returned true but got false: %v", reason)
+	}
+
+	sDef.Deployment = `{"services":{"cpu":{"image":"cpu:1.0.0","cpus":4}}}`
+	if compatible, _ := CheckResourceCompatibility(nodePol, &ServiceDefinition{"mycomp", sDef}, nil, msgPrinter); compatible {
+		t.Errorf("CheckResourceCompatibility should have returned false for too many cpus but got true")
+	}
+
+	sDef.Deployment = `{"services":{"cpu":{"image":"cpu:1.0.0","memory":768},"helper":{"image":"helper:1.0.0","memory":512}}}`
+	if compatible, _ := CheckResourceCompatibility(nodePol, &ServiceDefinition{"mycomp", sDef}, nil, msgPrinter); compatible {
+		t.Errorf("CheckResourceCompatibility should have returned false for too much memory but got true")
+	}
+
+	// no built-in properties means the node capacity is unknown
+	if compatible, reason := CheckResourceCompatibility(policy.Policy_Factory("empty node policy"), &ServiceDefinition{"mycomp", sDef}, nil, msgPrinter); !compatible {
+		t.Errorf("CheckResourceCompatibility should have returned true for a node without built-in properties but got false: %v", reason)
+	}
+
+	// the dependent services count towards the resources needed on the node
+	sDef.Deployment = `{"services":{"cpu":{"image":"cpu:1.0.0","memory":512}}}`
+	depDefs := map[string]exchange.ServiceDefinition{
+		"mycomp/dep_1.0.0_amd64": exchange.ServiceDefinition{URL: "dep", Version: "1.0.0", Arch: "amd64", Deployment: `{"services":{"dep":{"image":"dep:1.0.0","memory":256}}}`},
+	}
+	if compatible, reason := CheckResourceCompatibility(nodePol, &ServiceDefinition{"mycomp", sDef}, depDefs, msgPrinter); !compatible {
+		t.Errorf("CheckResourceCompatibility should have returned true but got false: %v", reason)
+	}
+
+	depDefs["mycomp/dep2_1.0.0_amd64"] = exchange.ServiceDefinition{URL: "dep2", Version: "1.0.0", Arch: "amd64", Deployment: `{"services":{"dep2":{"image":"dep2:1.0.0","memory_reservation":512}}}`}
+	if compatible, _ := CheckResourceCompatibility(nodePol, &ServiceDefinition{"mycomp", sDef}, depDefs, msgPrinter); compatible {
+		t.Errorf("CheckResourceCompatibility should have returned false for too much memory in the dependent services but got true")
+	}
+
+	depDefs["mycomp/dep2_1.0.0_amd64"] = exchange.ServiceDefinition{URL: "dep2", Version: "1.0.0", Arch: "amd64", Deployment: `{"services":{"dep2":{"image":"dep2:1.0.0","cpus":3}}}`}
+	if compatible, _ := CheckResourceCompatibility(nodePol, &ServiceDefinition{"mycomp", sDef}, depDefs, msgPrinter); compatible {
+		t.Errorf("CheckResourceCompatibility should have returned false for too many cpus in a dependent service but got true")
+	}
+}
+
+func Test_policyCompatible_constraint_detail(t *testing.T) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	svcUrl := "weather"
+	svcOrg := "myorg"
+	svcVersion1 := "1.0.1"
+	svcArch1 := "amd64"
+	service := businesspolicy.ServiceRef{
+		Name:            svcUrl,
+		Org:             svcOrg,
+		Arch:            svcArch1,
+		ServiceVersions: []businesspolicy.WorkloadChoice{businesspolicy.WorkloadChoice{Version: svcVersion1}},
+	}
+
+	nodePolicy := createExternalPolicy(map[string]string{"prop3": "val3", "prop4": "some value"}, []string{"prop1 == val1"})
+	servicePolicy := createExternalPolicy(map[string]string{"prop5": "val5"}, []string{})
+	businessPolicy := createBusinessPolicy(service, map[string]string{"prop1": "val1"}, []string{"prop3 == val3 && (prop4 == other || prop7 == val7)"})
+
+	input := PolicyCheck{
+		NodePolicy:     nodePolicy,
+		BusinessPolicy: businessPolicy,
+		ServicePolicy:  servicePolicy,
+	}
+	sId1 := cutil.FormExchangeIdForService(svcUrl, svcVersion1, svcArch1)
+	sId1 = fmt.Sprintf("%v/%v", svcOrg, sId1)
+
+	compOutput, err := policyCompatible(getDeviceHandler(""),
+		getNodePolicyHandler(map[string]string{}, []string{}),
+		getBusinessPolicyHandler(service, map[string]string{}, []string{}),
+		getServicePolicyHandler(map[string]string{}, []string{}),
+		getSelectedServicesHandler(nil), getServiceHandler(), getServiceDefResolverHandler(),
+		&input, true, msgPrinter)
+	if err != nil {
+		t.Fatalf("policyCompatible should have returned nil error but got: %v", err)
+	} else if compOutput.Compatible {
+		t.Fatalf("policyCompatible should have returned incompatible but got: %v", compOutput)
+	}
+
+	detail, ok := compOutput.Detail[sId1]
+	if !ok {
+		t.Fatalf("policyCompatible should have returned the constraint detail for %v but got: %v", sId1, compOutput.Detail)
+	} else if detail.NodeConstraints == nil || !detail.NodeConstraints.Satisfied {
+		t.Errorf("The node constraints should be satisfied, but got: %v", detail.NodeConstraints)
+	}
+
+	depEval := detail.DeploymentConstraints
+	if depEval == nil || depEval.Satisfied || len(depEval.Children) != 2 {
+		t.Fatalf("The deployment constraints should not be satisfied, but got: %v", depEval)
+	} else if !depEval.Children[0].Satisfied || depEval.Children[0].Properties["prop3"] != "val3" {
+		t.Errorf("The prop3 clause should be satisfied, but got: %v", depEval.Children[0])
+	} else if orEval := depEval.Children[1]; orEval.Satisfied || len(orEval.Children) != 2 {
+		t.Errorf("The parenthetical clause should not be satisfied, but got: %v", orEval)
+	} else if orEval.Children[0].Properties["prop4"] != "some value" {
+		t.Errorf("The prop4 clause should show the node property value, but got: %v", orEval.Children[0])
+	} else if v, ok := orEval.Children[1].Properties["prop7"]; !ok || v != nil {
+		t.Errorf("The prop7 clause should show an undefined property, but got: %v", orEval.Children[1])
+	}
+}
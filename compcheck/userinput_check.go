@@ -262,6 +262,7 @@ func userInputCompatible(getDeviceHandler exchange.DeviceHandler,
 	service_comp := map[string]common.AbstractServiceFile{}
 	service_incomp := map[string]common.AbstractServiceFile{}
 	svc_type_mismatch := map[string]bool{}
+	helmValues := map[string][]HelmValue{}
 	overall_compatible := true
 	all_services := []common.AbstractServiceFile{}
 
@@ -294,6 +295,11 @@ func userInputCompatible(getDeviceHandler exchange.DeviceHandler,
 							service_compatible = true
 							service_comp[sId] = sDefs[0]
 							messages[sId] = msg_compatible
+							if hv, err := helmValuesForServiceDef(sDefs[0], bpUserInput, nodeUserInput); err != nil {
+								return nil, err
+							} else if len(hv) != 0 {
+								helmValues[sId] = hv
+							}
 							if !checkAllSvcs {
 								break
 							}
@@ -329,6 +335,11 @@ func userInputCompatible(getDeviceHandler exchange.DeviceHandler,
 									service_compatible = true
 									service_comp[sId] = sDefs[0]
 									messages[sId] = msg_compatible
+									if hv, err := helmValuesForServiceDef(sDefs[0], bpUserInput, nodeUserInput); err != nil {
+										return nil, err
+									} else if len(hv) != 0 {
+										helmValues[sId] = hv
+									}
 									if !checkAllSvcs {
 										break
 									}
@@ -385,6 +396,11 @@ func userInputCompatible(getDeviceHandler exchange.DeviceHandler,
 							service_compatible = true
 							service_comp[sId] = sDefs[0]
 							messages[sId] = msg_compatible
+							if hv, err := helmValuesForServiceDef(sDefs[0], bpUserInput, nodeUserInput); err != nil {
+								return nil, err
+							} else if len(hv) != 0 {
+								helmValues[sId] = hv
+							}
 							if !checkAllSvcs {
 								break
 							}
@@ -437,7 +453,11 @@ func userInputCompatible(getDeviceHandler exchange.DeviceHandler,
 			}
 		}
 
-		return NewCompCheckOutput(overall_compatible, messages, resources), nil
+		output := NewCompCheckOutput(overall_compatible, messages, resources)
+		if len(helmValues) != 0 {
+			output.HelmValues = helmValues
+		}
+		return output, nil
 
 	} else {
 		// If we get here, it means that no workload is found in the bp/pattern that matches the required node arch.
@@ -624,28 +644,13 @@ func VerifyUserInputForSingleServiceDef(sdef common.AbstractServiceFile,
 	}
 
 	// service needs user input, find the correct elements in the array
-	var mergedUI *policy.UserInput
-	ui1, _, err := policy.FindUserInput(sdef.GetURL(), sdef.GetOrg(), sdef.GetVersion(), sdef.GetArch(), bpUserInput)
+	mergedUI, inNode, err := findServiceUserInput(sdef, bpUserInput, deviceUserInput)
 	if err != nil {
-		return false, "", sdef, NewCompCheckError(err, COMPCHECK_GENERAL_ERROR)
-	}
-	ui2, _, err := policy.FindUserInput(sdef.GetURL(), sdef.GetOrg(), sdef.GetVersion(), sdef.GetArch(), deviceUserInput)
-	if err != nil {
-		return false, "", sdef, NewCompCheckError(err, COMPCHECK_GENERAL_ERROR)
-	}
-
-	if ui1 == nil && ui2 == nil {
+		return false, "", sdef, err
+	} else if mergedUI == nil {
 		return false, msgPrinter.Sprintf("No user input found for service."), sdef, nil
 	}
 
-	if ui1 != nil && ui2 != nil {
-		mergedUI, _ = policy.MergeUserInput(*ui1, *ui2, false)
-	} else if ui1 != nil {
-		mergedUI = ui1
-	} else {
-		mergedUI = ui2
-	}
-
 	// Verify that non-default variables are present.
 	for _, ui := range sdef.GetUserInputs() {
 		found := false
@@ -661,7 +666,7 @@ func VerifyUserInputForSingleServiceDef(sdef common.AbstractServiceFile,
 
 		if !found && ui.DefaultValue == "" {
 			err_msg := msgPrinter.Sprintf("A required user input value is missing for variable %v.", ui.Name)
-			if ui2 == nil {
+			if !inNode {
 				err_msg = msgPrinter.Sprintf("%v Service %v/%v version %v arch %v is missing in the node user input.", err_msg, sdef.GetOrg(), sdef.GetURL(), sdef.GetVersion(), sdef.GetArch())
 			}
 			return false, err_msg, sdef, nil
@@ -671,6 +676,90 @@ func VerifyUserInputForSingleServiceDef(sdef common.AbstractServiceFile,
 	return true, "", sdef, nil
 }
 
+// Return the user input for the service from the deployment policy or pattern merged with the user input from the
+// node, and whether the node has user input for the service.
+func findServiceUserInput(sdef common.AbstractServiceFile, bpUserInput []policy.UserInput, deviceUserInput []policy.UserInput) (*policy.UserInput, bool, error) {
+	ui1, _, err := policy.FindUserInput(sdef.GetURL(), sdef.GetOrg(), sdef.GetVersion(), sdef.GetArch(), bpUserInput)
+	if err != nil {
+		return nil, false, NewCompCheckError(err, COMPCHECK_GENERAL_ERROR)
+	}
+	ui2, _, err := policy.FindUserInput(sdef.GetURL(), sdef.GetOrg(), sdef.GetVersion(), sdef.GetArch(), deviceUserInput)
+	if err != nil {
+		return nil, false, NewCompCheckError(err, COMPCHECK_GENERAL_ERROR)
+	}
+
+	if ui1 != nil && ui2 != nil {
+		mergedUI, _ := policy.MergeUserInput(*ui1, *ui2, false)
+		return mergedUI, true, nil
+	} else if ui1 != nil {
+		return ui1, false, nil
+	}
+	return ui2, ui2 != nil, nil
+}
+
+// A chart value of a Helm service, with the user input value it is set to. The values of node properties are only
+// known on the node.
+type HelmValue struct {
+	persistence.HelmValueMapping
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Return the chart values that the user input and the node properties set for a service deployed with Helm.
+func helmValuesForServiceDef(sdef common.AbstractServiceFile, bpUserInput []policy.UserInput, deviceUserInput []policy.UserInput) ([]HelmValue, error) {
+	hd := helmDeployment(sdef.GetDeployment())
+	if hd == nil || len(hd.Values) == 0 {
+		return nil, nil
+	}
+
+	// the user input variables, as they are passed to the service on the node
+	envVars := map[string]string{}
+	for _, ui := range sdef.GetUserInputs() {
+		if ui.DefaultValue != "" {
+			envVars[ui.Name] = ui.DefaultValue
+		}
+	}
+	if mergedUI, _, err := findServiceUserInput(sdef, bpUserInput, deviceUserInput); err != nil {
+		return nil, err
+	} else if mergedUI != nil {
+		for _, input := range mergedUI.Inputs {
+			if err := cutil.NativeToEnvVariableMap(envVars, input.Name, input.Value); err != nil {
+				return nil, NewCompCheckError(err, COMPCHECK_GENERAL_ERROR)
+			}
+		}
+	}
+
+	values := []HelmValue{}
+	for _, m := range hd.Values {
+		hv := HelmValue{HelmValueMapping: m}
+		if value, ok := envVars[m.UserInput]; ok && m.UserInput != "" {
+			if v, err := m.Convert(value); err != nil {
+				return nil, NewCompCheckError(err, COMPCHECK_VALIDATION_ERROR)
+			} else {
+				hv.Value = v
+			}
+		}
+		values = append(values, hv)
+	}
+	return values, nil
+}
+
+// Return the Helm deployment config of a service, which is an object in a service definition file and a string
+// in a service from the Exchange, or nil when the service is not deployed with Helm.
+func helmDeployment(dep interface{}) *persistence.HelmDeploymentConfig {
+	switch d := dep.(type) {
+	case string:
+		if hd, err := persistence.GetHelmDeployment(d); err == nil {
+			return hd
+		}
+	case map[string]interface{}:
+		hd := new(persistence.HelmDeploymentConfig)
+		if persistence.IsHelm(d) && hd.FromPersistentForm(d) == nil {
+			return hd
+		}
+	}
+	return nil
+}
+
 // This function makes sure that the given service matches the service specified in the business policy
 func validateServiceWithBPolicy(service common.AbstractServiceFile, bPolicy *businesspolicy.BusinessPolicy, msgPrinter *message.Printer) error {
 
@@ -123,3 +123,54 @@ func Test_CheckRedundantUserinput(t *testing.T) {
 		t.Errorf("CheckRedundantUserinput should have returned nil but got %v", err)
 	}
 }
+
+func Test_helmValuesForServiceDef(t *testing.T) {
+	s := ServiceDefinition{
+		"mycomp1",
+		exchange.ServiceDefinition{
+			URL:     "web",
+			Version: "1.0.0",
+			Arch:    "amd64",
+			UserInputs: []exchange.UserInput{
+				exchange.UserInput{Name: "REPLICAS", Type: "int", DefaultValue: "1"},
+				exchange.UserInput{Name: "HOSTS", Type: "list of strings"},
+			},
+			Deployment: `{"chart_archive":"abc","release_name":"web","values":[{"name":"replicaCount","user_input":"REPLICAS","type":"int"},{"name":"ingress.hosts","user_input":"HOSTS","type":"list of strings"},{"name":"region","node_property":"region"}]}`,
+		},
+	}
+
+	// the default value of the service and the user input from the node
+	nodeUserInput := []policy.UserInput{policy.UserInput{
+		ServiceOrgid: "mycomp1",
+		ServiceUrl:   "web",
+		Inputs:       []policy.Input{policy.Input{Name: "HOSTS", Value: []interface{}{"a.example.com", "b.example.com"}}},
+	}}
+	values, err := helmValuesForServiceDef(&s, nil, nodeUserInput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(values) != 3 {
+		t.Fatalf("expected 3 chart values, got %v", values)
+	} else if values[0].Value != int64(1) {
+		t.Errorf("expected replicaCount to be the default value 1, got %v", values[0].Value)
+	} else if hosts, ok := values[1].Value.([]interface{}); !ok || len(hosts) != 2 || hosts[1] != "b.example.com" {
+		t.Errorf("expected ingress.hosts to be the node user input, got %v", values[1].Value)
+	} else if values[2].Value != nil || values[2].NodeProperty != "region" {
+		t.Errorf("expected region to be set on the node, got %v", values[2])
+	}
+
+	// the user input of the deployment policy does not have the declared type
+	bpUserInput := []policy.UserInput{policy.UserInput{
+		ServiceOrgid: "mycomp1",
+		ServiceUrl:   "web",
+		Inputs:       []policy.Input{policy.Input{Name: "REPLICAS", Value: "many"}},
+	}}
+	if _, err := helmValuesForServiceDef(&s, bpUserInput, nodeUserInput); err == nil {
+		t.Errorf("expected an error converting the user input to an int")
+	}
+
+	// a service that is not deployed with Helm
+	s.Deployment = `{"services":{}}`
+	if values, err := helmValuesForServiceDef(&s, nil, nodeUserInput); err != nil || values != nil {
+		t.Errorf("expected no chart values, got %v, error: %v", values, err)
+	}
+}
@@ -28,7 +28,8 @@ type Config struct {
 	ServiceStorage                   string // The base storage directory where the service can write or get the data.
 	APIListen                        string
 	DBPath                           string
-	DockerEndpoint                   string
+	DockerEndpoint                   string // The endpoint of the Docker API of the container runtime.
+	ContainerRuntime                 string // The container runtime that runs the service containers, "docker" or "podman". The default is "docker".
 	DockerCredFilePath               string
 	DefaultCPUSet                    string
 	DefaultServiceRegistrationRAM    int64
@@ -39,33 +40,42 @@ type Config struct {
 	ExchangeURL                      string
 	DefaultHTTPClientTimeoutS        uint
 	PolicyPath                       string
-	ExchangeHeartbeat                int       // Seconds between heartbeats
-	ExchangeVersionCheckIntervalM    int64     // Exchange version check interval in minutes. The default is 720. This is now deprecated with the usage of /changes API which returns exchange version on every call.
-	AgreementTimeoutS                uint64    // Number of seconds to wait before declaring agreement not finalized in blockchain
-	DVPrefix                         string    // When passing agreement ids into a workload container, add this prefix to the agreement id
-	RegistrationDelayS               uint64    // The number of seconds to wait after blockchain init before registering with the exchange. This is for testing initialization ONLY.
-	ExchangeMessageTTL               int       // The number of seconds the exchange will keep this message before automatically deleting it
-	ExchangeMessageDynamicPoll       bool      // Will the runtime dynamically increase the message poll interval? Default is true. Set to false to turn off dynamic message poll interval adjustments.
-	ExchangeMessagePollInterval      int       // The number of seconds the node will wait between polls to the exchange. This is the starting value, but at runtime this interval will increase if there is no message activity to reduce load on the exchange. If ExchangeMessageDynamicPoll is false, then the value of this field will never be changed by the runtime.
-	ExchangeMessagePollMaxInterval   int       // As the runtime increases the ExchangeMessagePollInterval, this value is the maximum that value can attain.
-	ExchangeMessagePollIncrement     int       // The number of seconds to increment the ExchangeMessagePollInterval when its time to increase the poll interval.
-	UserPublicKeyPath                string    // The location to store user keys uploaded through the REST API
-	ReportDeviceStatus               bool      // whether to report the device status to the exchange or not.
-	TrustCertUpdatesFromOrg          bool      // whether to trust the certs provided by the organization on the exchange or not.
-	TrustDockerAuthFromOrg           bool      // whether to turst the docker auths provided by the organization on the exchange or not.
-	ServiceUpgradeCheckIntervalS     int64     // service upgrade check interval in seconds. The default is 300 seconds.
-	MultipleAnaxInstances            bool      // multiple anax instances running on the same machine
-	DefaultServiceRetryCount         int       // the default service retry count if retries are not specified by the policy file. The default value is 2.
-	DefaultServiceRetryDuration      uint64    // the default retry duration in seconds. The next retry cycle occurs after the duration. The default value is 600
-	DefaultNodePolicyFile            string    // the default node policy file name.
-	NodeCheckIntervalS               int       // the node check interval. The default is 15 seconds.
-	NodePolicyCheckIntervalS         int       // the node policy check interval. The default is 15 seconds.
-	FileSyncService                  FSSConfig // The config for the embedded ESS sync service.
-	SurfaceErrorTimeoutS             int       // How long surfaced errors will remain active after they're created. Default is no timeout
-	SurfaceErrorCheckIntervalS       int       // Deprecated. Used to be how often the node will check for errors that are no longer active and update the exchange. Default is 15 seconds
-	SurfaceErrorAgreementPersistentS int       // How long an agreement needs to persist before it is considered persistent and the related errors are dismisse. Default is 90 seconds
-	InitialPollingBuffer             int       // the number of seconds to wait before increasing the polling interval while there is no agreement on the node.
-	MaxAgreementPrelaunchTimeM       int64     // The maximum numbers of minutes to wait for workload to start in an agreement
+	ExchangeHeartbeat                int                 // Seconds between heartbeats
+	ExchangeVersionCheckIntervalM    int64               // Exchange version check interval in minutes. The default is 720. This is now deprecated with the usage of /changes API which returns exchange version on every call.
+	AgreementTimeoutS                uint64              // Number of seconds to wait before declaring agreement not finalized in blockchain
+	DVPrefix                         string              // When passing agreement ids into a workload container, add this prefix to the agreement id
+	RegistrationDelayS               uint64              // The number of seconds to wait after blockchain init before registering with the exchange. This is for testing initialization ONLY.
+	ExchangeMessageTTL               int                 // The number of seconds the exchange will keep this message before automatically deleting it
+	ExchangeMessageDynamicPoll       bool                // Will the runtime dynamically increase the message poll interval? Default is true. Set to false to turn off dynamic message poll interval adjustments.
+	ExchangeMessagePollInterval      int                 // The number of seconds the node will wait between polls to the exchange. This is the starting value, but at runtime this interval will increase if there is no message activity to reduce load on the exchange. If ExchangeMessageDynamicPoll is false, then the value of this field will never be changed by the runtime.
+	ExchangeMessagePollMaxInterval   int                 // As the runtime increases the ExchangeMessagePollInterval, this value is the maximum that value can attain.
+	ExchangeMessagePollIncrement     int                 // The number of seconds to increment the ExchangeMessagePollInterval when its time to increase the poll interval.
+	UserPublicKeyPath                string              // The location to store user keys uploaded through the REST API
+	ReportDeviceStatus               bool                // whether to report the device status to the exchange or not.
+	TrustCertUpdatesFromOrg          bool                // whether to trust the certs provided by the organization on the exchange or not.
+	TrustDockerAuthFromOrg           bool                // whether to turst the docker auths provided by the organization on the exchange or not.
+	ServiceUpgradeCheckIntervalS     int64               // service upgrade check interval in seconds. The default is 300 seconds. It is how often the images of newer service versions are looked for when ImagePrefetch is enabled.
+	MultipleAnaxInstances            bool                // multiple anax instances running on the same machine
+	DefaultServiceRetryCount         int                 // the default service retry count if retries are not specified by the policy file. The default value is 2.
+	DefaultServiceRetryDuration      uint64              // the default retry duration in seconds. The next retry cycle occurs after the duration. The default value is 600
+	DefaultNodePolicyFile            string              // the default node policy file name.
+	NodeCheckIntervalS               int                 // the node check interval. The default is 15 seconds.
+	NodePolicyCheckIntervalS         int                 // the node policy check interval. The default is 15 seconds.
+	FileSyncService                  FSSConfig           // The config for the embedded ESS sync service.
+	Secrets                          SecretsConfig       // The config for the service secrets bound by deployment policies and patterns.
+	ImageGC                          ImageGCConfig       // The config for the removal of unused service images and the free disk space checks.
+	ImagePrefetch                    ImagePrefetchConfig // The config for pulling the images of newer service versions ahead of an upgrade.
+	ImagePull                        ImagePullConfig     // The config for the download rate and the times of day of the image pulls.
+	Helm                             HelmConfig          // The config of the Helm client that installs the Helm charts of cluster services.
+	SurfaceErrorTimeoutS             int                 // How long surfaced errors will remain active after they're created. Default is no timeout
+	SurfaceErrorCheckIntervalS       int                 // Deprecated. Used to be how often the node will check for errors that are no longer active and update the exchange. Default is 15 seconds
+	SurfaceErrorAgreementPersistentS int                 // How long an agreement needs to persist before it is considered persistent and the related errors are dismisse. Default is 90 seconds
+	InitialPollingBuffer             int                 // the number of seconds to wait before increasing the polling interval while there is no agreement on the node.
+	MaxAgreementPrelaunchTimeM       int64               // The maximum numbers of minutes to wait for workload to start in an agreement
+	UnhealthyContainerTimeoutS       int                 // How long a container with a healthcheck in its deployment can report unhealthy before it is treated as failed. The default is 300 seconds. A negative value turns off the check.
+	DependencyReadyTimeoutS          int                 // How long a service waits for the services it depends on to be ready before it starts anyway. The default is 120 seconds.
+	DBEncryption                     bool                // Encrypt the user input, attribute and agreement records in the node database. The default is false.
+	DBKeyRotationDays                int                 // The number of days after which the database encryption key is rotated at startup. The default of 0 never rotates the key.
 
 	// these Ids could be provided in config or discovered after startup by the system
 	BlockchainAccountId        string
@@ -78,6 +88,7 @@ type AGConfig struct {
 	AgreementWorkers             int
 	DBPath                       string
 	Postgresql                   PostgresqlConfig // The Postgresql config if it is being used
+	Sqlite                       SqliteConfig     // The SQLite config if it is being used
 	PartitionStale               uint64           // Number of seconds to wait before declaring a partition to be stale (i.e. the previous owner has unexpectedly terminated).
 	ProtocolTimeoutS             uint64           // Number of seconds to wait before declaring proposal response is lost
 	AgreementTimeoutS            uint64           // Number of seconds to wait before declaring agreement not finalized in blockchain
@@ -115,6 +126,9 @@ type AGConfig struct {
 	MaxExchangeChanges           int              // The maximum number of exchange changes to request on a given call the exchange /changes API.
 	RetryLookBackWindow          uint64           // The time window (in seconds) used by the agbot to look backward in time for node changes when node agreements are retried.
 	PolicySearchOrder            bool             // When true, search policies from most recently changed to least recently changed.
+	RollbackFailureRatio         float64          // The ratio of nodes failing a workload version at which the version is marked bad and all nodes are rolled back to the previous priority. Zero turns it off.
+	RollbackMinNodes             int              // The minimum number of nodes running a workload version before its failure ratio is judged.
+	RollbackFailureWindowS       uint64           // The number of seconds that an execution failure of a workload version counts towards its failure ratio.
 }
 
 func (c *HorizonConfig) UserPublicKeyPath() string {
@@ -129,10 +143,22 @@ func (c *HorizonConfig) UserPublicKeyPath() string {
 	return c.Edge.UserPublicKeyPath
 }
 
+func (c *HorizonConfig) GetContainerRuntime() string {
+	if c.Edge.ContainerRuntime == "" {
+		return HZN_CONTAINER_RUNTIME_DEFAULT
+	} else {
+		return c.Edge.ContainerRuntime
+	}
+}
+
 func (c *HorizonConfig) IsBoltDBConfigured() bool {
 	return len(c.AgreementBot.DBPath) != 0
 }
 
+func (c *HorizonConfig) IsSqliteConfigured() bool {
+	return len(c.AgreementBot.Sqlite.File) != 0
+}
+
 func (c *HorizonConfig) IsPostgresqlConfigured() bool {
 	return (c.AgreementBot.Postgresql != (PostgresqlConfig{})) && (c.GetPartitionStale() != 0)
 }
@@ -173,6 +199,21 @@ func (c *HorizonConfig) GetAgbotPolicyOrder() bool {
 	return c.AgreementBot.PolicySearchOrder
 }
 
+func (c *HorizonConfig) GetAgbotRollbackFailureRatio() float64 {
+	return c.AgreementBot.RollbackFailureRatio
+}
+
+func (c *HorizonConfig) GetAgbotRollbackMinNodes() int {
+	return c.AgreementBot.RollbackMinNodes
+}
+
+func (c *HorizonConfig) GetAgbotRollbackFailureWindowS() uint64 {
+	if c.AgreementBot.RollbackFailureWindowS == 0 {
+		return AgbotRollbackFailureWindowS_DEFAULT
+	}
+	return c.AgreementBot.RollbackFailureWindowS
+}
+
 func getDefaultBase() string {
 	basePath := os.Getenv("HZN_VAR_BASE")
 	if basePath == "" {
@@ -246,6 +287,7 @@ func Read(file string) (*HorizonConfig, error) {
 				MaxExchangeChanges:  AgbotMaxChanges_DEFAULT,
 				RetryLookBackWindow: AgbotRetryLookBackWindow_DEFAULT,
 				PolicySearchOrder:   AgbotPolicySearchOrder_DEFAULT,
+				RollbackMinNodes:    AgbotRollbackMinNodes_DEFAULT,
 			},
 		}
 
@@ -291,6 +333,14 @@ func Read(file string) (*HorizonConfig, error) {
 			config.Edge.DefaultServiceRetryDuration = 600
 		}
 
+		if config.Edge.UnhealthyContainerTimeoutS == 0 {
+			config.Edge.UnhealthyContainerTimeoutS = 300
+		}
+
+		if config.Edge.DependencyReadyTimeoutS == 0 {
+			config.Edge.DependencyReadyTimeoutS = 120
+		}
+
 		// default InitialPollingBuffer
 		if config.Edge.InitialPollingBuffer == 0 {
 			config.Edge.InitialPollingBuffer = 120
@@ -313,6 +363,18 @@ func Read(file string) (*HorizonConfig, error) {
 			config.AgreementBot.PolicyPath = strings.TrimRight(config.AgreementBot.PolicyPath, "/") + "/"
 		}
 
+		if err := config.Edge.ImagePull.Validate(); err != nil {
+			return nil, err
+		}
+
+		if rt := config.GetContainerRuntime(); rt != "docker" && rt != "podman" {
+			return nil, fmt.Errorf("Edge.ContainerRuntime %v is not supported, it must be docker or podman", rt)
+		}
+
+		if hc := config.GetHelmClient(); hc != HELM_CLIENT_HELM2 && hc != HELM_CLIENT_HELM3 {
+			return nil, fmt.Errorf("Edge.Helm.Client %v is not supported, it must be %v or %v", hc, HELM_CLIENT_HELM2, HELM_CLIENT_HELM3)
+		}
+
 		// now make collaborators instance and assign it to member in this config
 		collaborators, err := NewCollaborators(config)
 		if err != nil {
@@ -343,6 +405,7 @@ func (con *Config) String() string {
 		", APIListen %v"+
 		", DBPath %v"+
 		", DockerEndpoint %v"+
+		", ContainerRuntime %v"+
 		", DockerCredFilePath %v"+
 		", DefaultCPUSet %v"+
 		", DefaultServiceRegistrationRAM: %v"+
@@ -372,17 +435,26 @@ func (con *Config) String() string {
 		", DefaultServiceRetryDuration: %v"+
 		", NodeCheckIntervalS: %v"+
 		", FileSyncService: {%v}"+
+		", Secrets: {%v}"+
+		", ImageGC: {%v}"+
+		", ImagePrefetch: {%v}"+
+		", ImagePull: {%v}"+
+		", Helm: {%v}"+
 		", InitialPollingBuffer: {%v}"+
+		", UnhealthyContainerTimeoutS: %v"+
+		", DependencyReadyTimeoutS: %v"+
+		", DBEncryption: %v"+
+		", DBKeyRotationDays: %v"+
 		", BlockchainAccountId: %v"+
 		", BlockchainDirectoryAddress %v",
-		con.ServiceStorage, con.APIListen, con.DBPath, con.DockerEndpoint, con.DockerCredFilePath, con.DefaultCPUSet,
+		con.ServiceStorage, con.APIListen, con.DBPath, con.DockerEndpoint, con.ContainerRuntime, con.DockerCredFilePath, con.DefaultCPUSet,
 		con.DefaultServiceRegistrationRAM, con.StaticWebContent, con.PublicKeyPath, con.TrustSystemCACerts, con.CACertsPath, con.ExchangeURL,
 		con.DefaultHTTPClientTimeoutS, con.PolicyPath, con.ExchangeHeartbeat, con.AgreementTimeoutS,
 		con.DVPrefix, con.RegistrationDelayS, con.ExchangeMessageTTL, con.ExchangeMessageDynamicPoll, con.ExchangeMessagePollInterval,
 		con.ExchangeMessagePollMaxInterval, con.ExchangeMessagePollIncrement, con.UserPublicKeyPath, con.ReportDeviceStatus,
 		con.TrustCertUpdatesFromOrg, con.TrustDockerAuthFromOrg, con.ServiceUpgradeCheckIntervalS, con.MultipleAnaxInstances,
-		con.DefaultServiceRetryCount, con.DefaultServiceRetryDuration, con.NodeCheckIntervalS, con.FileSyncService.String(),
-		con.InitialPollingBuffer, con.BlockchainAccountId, con.BlockchainDirectoryAddress)
+		con.DefaultServiceRetryCount, con.DefaultServiceRetryDuration, con.NodeCheckIntervalS, con.FileSyncService.String(), con.Secrets.String(), con.ImageGC.String(), con.ImagePrefetch.String(), con.ImagePull.String(), con.Helm.String(),
+		con.InitialPollingBuffer, con.UnhealthyContainerTimeoutS, con.DependencyReadyTimeoutS, con.DBEncryption, con.DBKeyRotationDays, con.BlockchainAccountId, con.BlockchainDirectoryAddress)
 }
 
 func (agc *AGConfig) String() string {
@@ -391,6 +463,7 @@ func (agc *AGConfig) String() string {
 		", AgreementWorkers: %v"+
 		", DBPath: %v"+
 		", Postgresql: {%v}"+
+		", Sqlite: {%v}"+
 		", PartitionStale: %v"+
 		", ProtocolTimeoutS: %v"+
 		", AgreementTimeoutS: %v"+
@@ -421,7 +494,7 @@ func (agc *AGConfig) String() string {
 		", CSSURL: %v"+
 		", CSSSSLCert: %v"+
 		", AgreementBatchSize: %v",
-		agc.TxLostDelayTolerationSeconds, agc.AgreementWorkers, agc.DBPath, agc.Postgresql.String(),
+		agc.TxLostDelayTolerationSeconds, agc.AgreementWorkers, agc.DBPath, agc.Postgresql.String(), agc.Sqlite.String(),
 		agc.PartitionStale, agc.ProtocolTimeoutS, agc.AgreementTimeoutS, agc.NoDataIntervalS, agc.ActiveAgreementsURL,
 		agc.ActiveAgreementsUser, mask, agc.PolicyPath, agc.NewContractIntervalS, agc.ProcessGovernanceIntervalS,
 		agc.IgnoreContractWithAttribs, agc.ExchangeURL, agc.ExchangeHeartbeat, agc.ExchangeId,
@@ -54,6 +54,27 @@ const HZN_FSS_CERT_FILE = "cert.pem"
 // The name of the SSL certificate key file that the ESS uses to establish an SSL listener.
 const HZN_FSS_CERT_KEY_FILE = "key.pem"
 
+// The default secret provider used to fetch the values of service secrets.
+const HZN_SECRETS_PROVIDER_DEFAULT = "file"
+
+// The relative path of the secret files read by the file secret provider. This path should be combined with the HZN_VAR_BASE_DEFAULT.
+const HZN_SECRETS_FILE_PATH = "secrets"
+
+// The default tmpfs location where anax writes the secret files of service containers.
+const HZN_SECRETS_TMPFS_PATH_DEFAULT = "/run/horizon/secrets"
+
+// The name of the file mount that a service uses to find its secret files.
+const HZN_SECRETS_MOUNT = "/run/secrets/horizon"
+
+// The default number of seconds between checks for pulled images that are no longer used.
+const HZN_IMAGE_GC_INTERVAL_S_DEFAULT = 3600
+
+// The default number of seconds that a pulled image has to be unused before it is removed.
+const HZN_IMAGE_GC_GRACE_PERIOD_S_DEFAULT = 86400
+
+// The default free disk space, in MB, below which images are not pulled and new agreements are refused.
+const HZN_MIN_FREE_DISK_MB_DEFAULT = 512
+
 // The number of seconds between polls to the CSS for updates.
 const HZN_FSS_POLLING_RATE = 60
 
@@ -92,3 +113,23 @@ const AgbotRetryLookBackWindow_DEFAULT = 3600
 
 // Policy search order
 const AgbotPolicySearchOrder_DEFAULT = true
+
+// The minimum number of nodes running a workload version before the agbot judges its failure ratio
+const AgbotRollbackMinNodes_DEFAULT = 3
+
+// The number of seconds that an execution failure of a workload version counts towards its failure ratio
+const AgbotRollbackFailureWindowS_DEFAULT = 3600
+
+// The default container runtime that runs the service containers.
+const HZN_CONTAINER_RUNTIME_DEFAULT = "docker"
+
+// The Helm clients that install the Helm charts of cluster services, and the default one.
+const HELM_CLIENT_HELM2 = "helm2"
+const HELM_CLIENT_HELM3 = "helm3"
+const HZN_HELM_CLIENT_DEFAULT = HELM_CLIENT_HELM2
+
+// The default number of seconds a Helm install or upgrade waits for the resources of the release to be ready.
+const HZN_HELM_TIMEOUT_S_DEFAULT = 300
+
+// The default number of seconds a Helm release is kept after its agreement ended for a service upgrade.
+const HZN_HELM_UPGRADE_GRACE_S_DEFAULT = 600
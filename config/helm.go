@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Configuration of the Helm client that installs the Helm charts of cluster services.
+type HelmConfig struct {
+	Client        string // The Helm client, "helm2" for the Helm 2 CLI or "helm3" for the Helm 3 Go SDK. The default is "helm2".
+	TimeoutS      int    // How long an atomic install or upgrade waits for the resources of the release to be ready. The default is 300 seconds.
+	Atomic        bool   // Wait for the resources of the release to be ready, and remove a release that failed to install or roll back an upgrade that failed. The default is false.
+	UpgradeGraceS int    // How long the release of an agreement that ended for a service upgrade is kept, so that the new version can upgrade it in place. The default is 600 seconds.
+}
+
+func (h *HelmConfig) String() string {
+	return fmt.Sprintf("Client: %v, TimeoutS: %v, Atomic: %v, UpgradeGraceS: %v", h.Client, h.TimeoutS, h.Atomic, h.UpgradeGraceS)
+}
+
+func (c *HorizonConfig) GetHelmClient() string {
+	if c.Edge.Helm.Client == "" {
+		return HZN_HELM_CLIENT_DEFAULT
+	}
+	return c.Edge.Helm.Client
+}
+
+func (c *HorizonConfig) GetHelmTimeoutS() int {
+	if c.Edge.Helm.TimeoutS <= 0 {
+		return HZN_HELM_TIMEOUT_S_DEFAULT
+	}
+	return c.Edge.Helm.TimeoutS
+}
+
+func (c *HorizonConfig) GetHelmUpgradeGraceS() int {
+	if c.Edge.Helm.UpgradeGraceS <= 0 {
+		return HZN_HELM_UPGRADE_GRACE_S_DEFAULT
+	}
+	return c.Edge.Helm.UpgradeGraceS
+}
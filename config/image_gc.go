@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Configuration for the garbage collection of the service images pulled by the agent, and for the free disk space that
+// the agent needs before it pulls images or accepts new agreements.
+type ImageGCConfig struct {
+	IntervalS     int    // How often the pulled images are checked for removal. The default is 3600 seconds. A negative value turns off the image garbage collector.
+	GracePeriodS  int    // How long a pulled image has to be unused before it is removed. The default is 86400 seconds.
+	MinFreeDiskMB int    // The free disk space below which images are not pulled and new agreements are refused. The default is 512 MB. A negative value turns off the check.
+	DiskPath      string // The path of the file system where the images are stored. The default is the docker root directory.
+}
+
+func (g *ImageGCConfig) String() string {
+	return fmt.Sprintf("IntervalS: %v, GracePeriodS: %v, MinFreeDiskMB: %v, DiskPath: %v", g.IntervalS, g.GracePeriodS, g.MinFreeDiskMB, g.DiskPath)
+}
+
+func (c *HorizonConfig) GetImageGCInterval() int {
+	if c.Edge.ImageGC.IntervalS == 0 {
+		return HZN_IMAGE_GC_INTERVAL_S_DEFAULT
+	} else {
+		return c.Edge.ImageGC.IntervalS
+	}
+}
+
+func (c *HorizonConfig) GetImageGCGracePeriod() int {
+	if c.Edge.ImageGC.GracePeriodS == 0 {
+		return HZN_IMAGE_GC_GRACE_PERIOD_S_DEFAULT
+	} else {
+		return c.Edge.ImageGC.GracePeriodS
+	}
+}
+
+// Returns the minimum free disk space in bytes, 0 means that the free disk space is not checked.
+func (c *HorizonConfig) GetMinFreeDisk() uint64 {
+	if c.Edge.ImageGC.MinFreeDiskMB == 0 {
+		return HZN_MIN_FREE_DISK_MB_DEFAULT * 1024 * 1024
+	} else if c.Edge.ImageGC.MinFreeDiskMB < 0 {
+		return 0
+	} else {
+		return uint64(c.Edge.ImageGC.MinFreeDiskMB) * 1024 * 1024
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Configuration for pulling the images of newer service versions before the services are upgraded.
+type ImagePrefetchConfig struct {
+	Enabled bool // Pull the images of newer versions of the services running on the node ahead of the upgrade. The default is false.
+	MaxKBps int  // The maximum download rate of these pulls, in KB per second, so that they leave bandwidth to the running services. The default of 0 only applies the rate of all of the image pulls.
+}
+
+func (p *ImagePrefetchConfig) String() string {
+	return fmt.Sprintf("Enabled: %v, MaxKBps: %v", p.Enabled, p.MaxKBps)
+}
+
+// Returns the maximum download rate of the pulls ahead of an upgrade in bytes per second, 0 means that only the rate of
+// all of the image pulls applies.
+func (c *HorizonConfig) GetImagePrefetchRate() int64 {
+	if c.Edge.ImagePrefetch.MaxKBps <= 0 {
+		return 0
+	}
+	return int64(c.Edge.ImagePrefetch.MaxKBps) * 1024
+}
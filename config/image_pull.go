@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Configuration for the download rate and the times of day of the image pulls, for nodes on constrained links.
+type ImagePullConfig struct {
+	MaxKBps int      // The maximum download rate of all of the image pulls together, in KB per second. The default of 0 does not limit the rate.
+	Windows []string // The times of day when images can be pulled, in the form "HH:MM-HH:MM" in the local time of the node. A window can span midnight. By default images can be pulled at any time.
+}
+
+func (p *ImagePullConfig) String() string {
+	return fmt.Sprintf("MaxKBps: %v, Windows: %v", p.MaxKBps, p.Windows)
+}
+
+// Returns the maximum download rate of the image pulls in bytes per second, 0 means that the rate is not limited.
+func (c *HorizonConfig) GetImagePullRate() int64 {
+	if c.Edge.ImagePull.MaxKBps <= 0 {
+		return 0
+	}
+	return int64(c.Edge.ImagePull.MaxKBps) * 1024
+}
+
+// Returns an error if one of the pull windows is not valid.
+func (p *ImagePullConfig) Validate() error {
+	for _, w := range p.Windows {
+		if _, _, err := parsePullWindow(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns how long to wait for a pull window to open, 0 if one is open now, and the time the open or the next window
+// closes. When there are no pull windows, images can be pulled at any time and the returned close time is the zero time.
+func (p *ImagePullConfig) PullWindow(now time.Time) (time.Duration, time.Time) {
+	var wait time.Duration
+	var end time.Time
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i, w := range p.Windows {
+		startM, endM, err := parsePullWindow(w)
+		if err != nil {
+			continue
+		}
+
+		// the start of the window, which is either open now or opens within the next day
+		start := midnight.Add(time.Duration(startM) * time.Minute)
+		if start.After(now) {
+			start = start.Add(-24 * time.Hour)
+		}
+		length := time.Duration((endM-startM+24*60)%(24*60)) * time.Minute
+		if !now.Before(start.Add(length)) {
+			start = start.Add(24 * time.Hour)
+		}
+
+		wWait := time.Duration(0)
+		if start.After(now) {
+			wWait = start.Sub(now)
+		}
+		wEnd := start.Add(length)
+
+		// prefer the window that opens first, and of the open windows the one that closes last
+		if i == 0 || wWait < wait || (wWait == wait && wEnd.After(end)) {
+			wait, end = wWait, wEnd
+		}
+	}
+	return wait, end
+}
+
+// Returns the start and the end of a pull window in minutes since midnight.
+func parsePullWindow(w string) (int, int, error) {
+	parts := strings.Split(w, "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.New(fmt.Sprintf("image pull window %v is not in the form HH:MM-HH:MM", w))
+	}
+
+	minutes := make([]int, 2)
+	for i, part := range parts {
+		if t, err := time.Parse("15:04", strings.TrimSpace(part)); err != nil {
+			return 0, 0, errors.New(fmt.Sprintf("image pull window %v is not in the form HH:MM-HH:MM, error: %v", w, err))
+		} else {
+			minutes[i] = t.Hour()*60 + t.Minute()
+		}
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, errors.New(fmt.Sprintf("image pull window %v is empty", w))
+	}
+	return minutes[0], minutes[1], nil
+}
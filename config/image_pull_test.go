@@ -0,0 +1,71 @@
+// +build unit
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_PullWindow(t *testing.T) {
+	at := func(h int, m int) time.Time {
+		return time.Date(2021, 3, 10, h, m, 0, 0, time.UTC)
+	}
+
+	p := &ImagePullConfig{}
+	if wait, end := p.PullWindow(at(12, 0)); wait != 0 || !end.IsZero() {
+		t.Errorf("pulls should not be limited without windows, got %v %v", wait, end)
+	}
+
+	p.Windows = []string{"01:00-05:00", "22:30-02:00"}
+	if err := p.Validate(); err != nil {
+		t.Errorf("windows should be valid, got %v", err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		wait time.Duration
+		end  time.Time
+	}{
+		{at(3, 0), 0, at(5, 0)},
+		{at(12, 0), 10*time.Hour + 30*time.Minute, at(2, 0).Add(24 * time.Hour)},
+		{at(23, 0), 0, at(2, 0).Add(24 * time.Hour)},
+		{at(1, 30), 0, at(5, 0)},
+		{at(0, 15), 0, at(5, 0).Add(-3 * time.Hour)},
+		{at(5, 0), 17*time.Hour + 30*time.Minute, at(2, 0).Add(24 * time.Hour)},
+	}
+	for _, test := range tests {
+		if wait, end := p.PullWindow(test.now); wait != test.wait || !end.Equal(test.end) {
+			t.Errorf("at %v expected wait %v and end %v, got %v %v", test.now, test.wait, test.end, wait, end)
+		}
+	}
+
+	for _, w := range []string{"01:00", "1-2", "25:00-01:00", "03:00-03:00"} {
+		p.Windows = []string{w}
+		if err := p.Validate(); err == nil {
+			t.Errorf("window %v should not be valid", w)
+		}
+	}
+}
+
+func Test_GetImagePullRate(t *testing.T) {
+	c := &HorizonConfig{}
+	if rate := c.GetImagePullRate(); rate != 0 {
+		t.Errorf("the rate should not be limited by default, got %v", rate)
+	}
+	c.Edge.ImagePull.MaxKBps = 64
+	if rate := c.GetImagePullRate(); rate != 64*1024 {
+		t.Errorf("expected a rate of %v bytes per second, got %v", 64*1024, rate)
+	}
+}
+
+func Test_GetImagePrefetchRate(t *testing.T) {
+	c := &HorizonConfig{}
+	if rate := c.GetImagePrefetchRate(); rate != 0 {
+		t.Errorf("the rate should not be limited by default, got %v", rate)
+	}
+	c.Edge.ImagePrefetch.MaxKBps = 16
+	if rate := c.GetImagePrefetchRate(); rate != 16*1024 {
+		t.Errorf("expected a rate of %v bytes per second, got %v", 16*1024, rate)
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// Configuration for the secrets that are bound to services by deployment policies and patterns.
+type SecretsConfig struct {
+	Provider  string // The secret provider that secret values are fetched from. The default is "file".
+	FileDir   string // The absolute location in the host filesystem of the secret files read by the file secret provider.
+	TmpfsPath string // The absolute location of a tmpfs filesystem on the host where anax writes secret files for service containers.
+}
+
+func (s *SecretsConfig) String() string {
+	return fmt.Sprintf("Provider: %v, FileDir: %v, TmpfsPath: %v", s.Provider, s.FileDir, s.TmpfsPath)
+}
+
+func (c *HorizonConfig) GetSecretProvider() string {
+	if c.Edge.Secrets.Provider == "" {
+		return HZN_SECRETS_PROVIDER_DEFAULT
+	} else {
+		return c.Edge.Secrets.Provider
+	}
+}
+
+func (c *HorizonConfig) GetSecretFileDir() string {
+	if c.Edge.Secrets.FileDir == "" {
+		return path.Join(getDefaultBase(), HZN_SECRETS_FILE_PATH)
+	} else {
+		return c.Edge.Secrets.FileDir
+	}
+}
+
+func (c *HorizonConfig) GetSecretTmpfsPath() string {
+	if c.Edge.Secrets.TmpfsPath == "" {
+		return HZN_SECRETS_TMPFS_PATH_DEFAULT
+	} else {
+		return c.Edge.Secrets.TmpfsPath
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The SQLite database is intended for small, standalone agbots that need a SQL database but do not want to
+// operate a Postgresql server. The database is a single file which is created if it does not exist.
+type SqliteConfig struct {
+	File        string // The path to the database file
+	BusyTimeout int    // Milliseconds to wait for a lock held by another connection, defaults to 5000
+}
+
+func (s SqliteConfig) GetBusyTimeout() int {
+	if s.BusyTimeout == 0 {
+		return 5000
+	}
+	return s.BusyTimeout
+}
+
+// Returns the data source name used to open the database. Transactions take the database write lock when they
+// begin so that a read followed by a write in the same transaction cannot fail with a lock upgrade error.
+func (s SqliteConfig) MakeConnectionString() string {
+	return fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_txlock=immediate", s.File, s.GetBusyTimeout())
+}
+
+func (s SqliteConfig) String() string {
+	return fmt.Sprintf("File: %v, BusyTimeout: %v", s.File, s.BusyTimeout)
+}
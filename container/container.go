@@ -13,6 +13,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/eventlog"
 	"github.com/open-horizon/anax/events"
@@ -20,6 +21,7 @@ import (
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/resource"
+	"github.com/open-horizon/anax/secrets"
 	"github.com/open-horizon/anax/worker"
 	"golang.org/x/sys/unix"
 	"io"
@@ -29,6 +31,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const LABEL_PREFIX = "openhorizon.anax"
@@ -43,6 +46,8 @@ const (
 	EL_CONT_ERROR_UNMARSHAL_DEPLOY            = "Error Unmarshalling deployment string %v, error: %v"
 	EL_CONT_ERROR_UNMARSHAL_DEPLOY_OVERRIDE   = "Error Unmarshalling deployment override string %v for agreement %v, error: %v"
 	EL_CONT_START_CONTAINER_ERROR             = "Error starting containers: %v"
+	EL_CONT_ERROR_CREATE_SECRET_FILES         = "Error creating secret files for agreement %v: %v"
+	EL_CONT_ERROR_CREATE_SECRET_FILES_FOR_SVC = "Error creating secret files for service %v: %v"
 	EL_CONT_START_CONTAINER_ERROR_FOR_AG      = "Error starting containers for agreement %v: %v"
 	EL_CONT_RESTART_CONTAINER_ERROR_FOR_AG    = "Error restarting containers for agreements %v: %v"
 	EL_CONT_CLEAN_OLD_CONTAINER_ERROR         = "Error cleaning up old containers before starting up new containers for %v. Error: %v"
@@ -51,6 +56,11 @@ const (
 	EL_CONT_TERM_UNABLE_ACCESS_STORAGE_DIR    = "anax terminating. Unable to access service storage direcotry specified in config: %v. %v"
 	EL_CONT_TERM_UNABLE_INIT_IPTABLE_CLIENT   = "anax terminating. Failed to instantiate iptables client. %v"
 	EL_CONT_TERM_UNABLE_INIT_DOCKER_CLIENT    = "anax terminating. Failed to instantiate docker client. %v"
+	EL_CONT_WAITING_FOR_DEPENDENCIES          = "Service %v is waiting for the services it depends on to be ready: %v"
+	EL_CONT_DEPENDENCIES_READY                = "The services that service %v depends on are ready."
+	EL_CONT_DEPENDENCIES_READY_TIMEOUT        = "Starting service %v, the services it depends on were not ready in time: %v"
+	EL_CONT_CONTAINER_RESTARTED               = "Restarted container %v of service %v after it exited with code %v, restart count: %v."
+	EL_CONT_SERVICE_CRASH_LOOP                = "Service %v is in a crash loop, container %v exited with code %v after %v restarts."
 )
 
 // This is does nothing useful at run time.
@@ -68,6 +78,8 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_CONT_ERROR_UNMARSHAL_DEPLOY)
 	msgPrinter.Sprintf(EL_CONT_ERROR_UNMARSHAL_DEPLOY_OVERRIDE)
 	msgPrinter.Sprintf(EL_CONT_START_CONTAINER_ERROR)
+	msgPrinter.Sprintf(EL_CONT_ERROR_CREATE_SECRET_FILES)
+	msgPrinter.Sprintf(EL_CONT_ERROR_CREATE_SECRET_FILES_FOR_SVC)
 	msgPrinter.Sprintf(EL_CONT_START_CONTAINER_ERROR_FOR_AG)
 	msgPrinter.Sprintf(EL_CONT_RESTART_CONTAINER_ERROR_FOR_AG)
 	msgPrinter.Sprintf(EL_CONT_CLEAN_OLD_CONTAINER_ERROR)
@@ -76,6 +88,11 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_CONT_TERM_UNABLE_ACCESS_STORAGE_DIR)
 	msgPrinter.Sprintf(EL_CONT_TERM_UNABLE_INIT_IPTABLE_CLIENT)
 	msgPrinter.Sprintf(EL_CONT_TERM_UNABLE_INIT_DOCKER_CLIENT)
+	msgPrinter.Sprintf(EL_CONT_WAITING_FOR_DEPENDENCIES)
+	msgPrinter.Sprintf(EL_CONT_DEPENDENCIES_READY)
+	msgPrinter.Sprintf(EL_CONT_DEPENDENCIES_READY_TIMEOUT)
+	msgPrinter.Sprintf(EL_CONT_CONTAINER_RESTARTED)
+	msgPrinter.Sprintf(EL_CONT_SERVICE_CRASH_LOOP)
 }
 
 /*
@@ -209,13 +226,14 @@ func (w *ContainerWorker) finalizeDeployment(agreementId string, deployment *con
 	// final structure
 	services := make(map[string]servicePair, 0)
 
-	var ramBytes int64
+	var ramMB, ramBytes int64
 
 	// we know that RAM is in MB
 	if ram, exists := (environmentAdditions)[config.ENVVAR_PREFIX+"RAM"]; !exists {
 		return nil, fmt.Errorf("Missing required environment var *RAM for agreement: %v", agreementId)
 	} else {
-		ramMB, err := strconv.ParseInt(ram, 10, 64)
+		var err error
+		ramMB, err = strconv.ParseInt(ram, 10, 64)
 		if err != nil {
 			return nil, err
 		}
@@ -232,6 +250,13 @@ func (w *ContainerWorker) finalizeDeployment(agreementId string, deployment *con
 			return nil, err
 		}
 
+		if err := service.ValidateResourceLimits(ramMB); err != nil {
+			return nil, fmt.Errorf("Illegal resource limits specified in deployment description for service %v: %v", serviceName, err)
+		}
+		if err := service.ValidateVolumes(); err != nil {
+			return nil, fmt.Errorf("Illegal volume options specified in deployment description for service %v: %v", serviceName, err)
+		}
+
 		// If the FSS is using a unix domain socket listener, add a filesystem binding for it.
 		if uds != "" {
 			service.Binds = append(service.Binds, fmt.Sprintf("%v:%v", uds, uds))
@@ -300,7 +325,7 @@ func (w *ContainerWorker) finalizeDeployment(agreementId string, deployment *con
 				PortBindings:    map[docker.Port][]docker.PortBinding{},
 				Links:           nil, // do not allow any
 				RestartPolicy:   docker.AlwaysRestart(),
-				Memory:          ramBytes,
+				Memory:          service.GetMemoryBytes(ramBytes),
 				MemorySwap:      0,
 				Devices:         []docker.Device{},
 				LogConfig:       logConfig,
@@ -309,6 +334,51 @@ func (w *ContainerWorker) finalizeDeployment(agreementId string, deployment *con
 			},
 		}
 
+		// Apply the per service resource limits from the deployment description. The memory limit is handled above,
+		// it falls back to the node wide default when the service does not specify one.
+		if service.Cpus != 0 {
+			serviceConfig.HostConfig.NanoCPUs = int64(service.Cpus * 1e9)
+		}
+		serviceConfig.HostConfig.CPUShares = service.CpuShares
+		serviceConfig.HostConfig.MemoryReservation = service.MemoryReservation * 1024 * 1024
+		if service.PidsLimit != 0 {
+			pidsLimit := service.PidsLimit
+			serviceConfig.HostConfig.PidsLimit = &pidsLimit
+		}
+
+		// Add the healthcheck so that docker reports the health of the container, and label the container so that it is
+		// treated as failed when it stays unhealthy.
+		if service.Healthcheck != nil {
+			if err := service.Healthcheck.Validate(); err != nil {
+				return nil, fmt.Errorf("Illegal healthcheck specified in deployment description for service %v: %v", serviceName, err)
+			}
+			serviceConfig.Config.Healthcheck = service.Healthcheck.DockerHealthConfig()
+			serviceConfig.Config.Labels[HEALTHCHECK_LABEL] = ""
+		}
+
+		// Label the container with its readiness probe, which the services that depend on it use before they start.
+		if service.Readiness != nil {
+			if err := service.Readiness.Validate(); err != nil {
+				return nil, fmt.Errorf("Illegal readiness probe specified in deployment description for service %v: %v", serviceName, err)
+			} else if probe, err := json.Marshal(service.Readiness); err != nil {
+				return nil, fmt.Errorf("Unable to marshal the readiness probe of service %v: %v", serviceName, err)
+			} else {
+				serviceConfig.Config.Labels[READINESS_PROBE_LABEL] = string(probe)
+			}
+		}
+
+		// A service with a restart policy is restarted by the agent, so the container runtime must not restart it.
+		if service.RestartPolicy != nil {
+			if err := service.RestartPolicy.Validate(); err != nil {
+				return nil, fmt.Errorf("Illegal restart policy specified in deployment description for service %v: %v", serviceName, err)
+			} else if rp, err := json.Marshal(service.RestartPolicy); err != nil {
+				return nil, fmt.Errorf("Unable to marshal the restart policy of service %v: %v", serviceName, err)
+			} else {
+				serviceConfig.Config.Labels[RESTART_POLICY_LABEL] = string(rp)
+				serviceConfig.HostConfig.RestartPolicy = docker.NeverRestart()
+			}
+		}
+
 		// Mark each container as infrastructure if the deployment description indicates infrastructure
 		if deployment.Infrastructure {
 			serviceConfig.Config.Labels[LABEL_PREFIX+".infrastructure"] = ""
@@ -434,13 +504,16 @@ func (w *ContainerWorker) finalizeDeployment(agreementId string, deployment *con
 type ContainerWorker struct {
 	worker.BaseWorker // embedded field
 	db                *bolt.DB
-	client            *docker.Client
+	client            containerruntime.ContainerRuntime
 	iptables          *iptables.IPTables
 	authMgr           *resource.AuthenticationManager
+	secretMgr         *secrets.SecretManager
 	pattern           string
+	unhealthy         *unhealthyTracker
+	readiness         *readinessTracker
 }
 
-func (cw *ContainerWorker) GetClient() *docker.Client {
+func (cw *ContainerWorker) GetClient() containerruntime.ContainerRuntime {
 	return cw.client
 }
 
@@ -448,6 +521,20 @@ func (cw *ContainerWorker) GetAuthenticationManager() *resource.AuthenticationMa
 	return cw.authMgr
 }
 
+func (cw *ContainerWorker) GetSecretManager() *secrets.SecretManager {
+	return cw.secretMgr
+}
+
+// Create the secret manager that writes service secrets into tmpfs files. The worker can still run services that
+// dont use secrets when the configured secret provider is not usable.
+func newSecretManager(config *config.HorizonConfig) *secrets.SecretManager {
+	provider, err := secrets.NewSecretProvider(config)
+	if err != nil {
+		glog.Errorf("Unable to create secret provider, services that use secrets will not start. Error: %v", err)
+	}
+	return secrets.NewSecretManager(config.GetSecretTmpfsPath(), provider)
+}
+
 func CreateCLIContainerWorker(config *config.HorizonConfig) (*ContainerWorker, error) {
 	dockerEP := "unix:///var/run/docker.sock"
 	client, derr := docker.NewClient(dockerEP)
@@ -461,7 +548,10 @@ func CreateCLIContainerWorker(config *config.HorizonConfig) (*ContainerWorker, e
 		client:     client,
 		iptables:   nil,
 		authMgr:    resource.NewAuthenticationManager(config.GetFileSyncServiceAuthPath()),
+		secretMgr:  newSecretManager(config),
 		pattern:    "",
+		unhealthy:  newUnhealthyTracker(config.Edge.UnhealthyContainerTimeoutS),
+		readiness:  newReadinessTracker(),
 	}, nil
 }
 
@@ -489,7 +579,7 @@ func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB,
 
 	var err error
 	var ipt *iptables.IPTables
-	var client *docker.Client
+	var client containerruntime.ContainerRuntime
 
 	ipt, err = iptables.New()
 	if err != nil {
@@ -502,9 +592,9 @@ func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB,
 	}
 
 	if config.Edge.DockerEndpoint != "" {
-		client, err = docker.NewClient(config.Edge.DockerEndpoint)
+		client, err = containerruntime.NewAgentContainerRuntime(config)
 		if err != nil {
-			glog.Errorf("Failed to instantiate docker Client: %v", err)
+			glog.Errorf("Failed to instantiate %v client: %v", config.GetContainerRuntime(), err)
 			eventlog.LogNodeEvent(db, persistence.SEVERITY_FATAL,
 				persistence.NewMessageMeta(EL_CONT_TERM_UNABLE_INIT_DOCKER_CLIENT, err.Error()),
 				persistence.EC_ERROR_CREATE_DOCKER_CLIENT,
@@ -513,8 +603,15 @@ func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB,
 		}
 	}
 
+	return newContainerWorker(name, config, db, am, client, ipt)
+}
+
+// Create and start the container worker with the given container runtime. The iptables client is optional, without it
+// the network isolation of the services is not set up.
+func newContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB, am *resource.AuthenticationManager, client containerruntime.ContainerRuntime, ipt *iptables.IPTables) *ContainerWorker {
+
 	pattern := ""
-	if dev != nil {
+	if dev, _ := persistence.FindExchangeDevice(db); dev != nil {
 		pattern = dev.Pattern
 	}
 
@@ -524,7 +621,10 @@ func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB,
 		client:     client,
 		iptables:   ipt,
 		authMgr:    am,
+		secretMgr:  newSecretManager(config),
 		pattern:    pattern,
+		unhealthy:  newUnhealthyTracker(config.Edge.UnhealthyContainerTimeoutS),
+		readiness:  newReadinessTracker(),
 	}
 	worker.SetDeferredDelay(15)
 
@@ -545,6 +645,7 @@ func (w *ContainerWorker) NewEvent(incoming events.Message) {
 
 		// stop the container worker for the cluster device type
 		if msg.DeviceType() == persistence.DEVICE_TYPE_CLUSTER {
+			w.Commands <- worker.NewBeginShutdownCommand()
 			w.Commands <- worker.NewTerminateCommand("cluster node")
 		}
 
@@ -611,6 +712,13 @@ func (w *ContainerWorker) NewEvent(incoming events.Message) {
 			w.Commands <- containerCmd
 		}
 
+	case *events.NodeShutdownMessage:
+		msg, _ := incoming.(*events.NodeShutdownMessage)
+		switch msg.Event().Id {
+		case events.START_UNCONFIGURE:
+			w.Commands <- worker.NewBeginShutdownCommand()
+		}
+
 	case *events.NodeShutdownCompleteMessage:
 		msg, _ := incoming.(*events.NodeShutdownCompleteMessage)
 		switch msg.Event().Id {
@@ -625,7 +733,7 @@ func (w *ContainerWorker) NewEvent(incoming events.Message) {
 	return
 }
 
-func mkBridge(client *docker.Client, name string, infrastructure bool, sharedPattern bool) (*docker.Network, error) {
+func mkBridge(client containerruntime.ContainerRuntime, name string, infrastructure bool, sharedPattern bool) (*docker.Network, error) {
 
 	// Labels on the docker network indicate attributes about the network.
 	labels := make(map[string]string)
@@ -662,7 +770,7 @@ func mkBridge(client *docker.Client, name string, infrastructure bool, sharedPat
 	return bridge, nil
 }
 
-func serviceStart(client *docker.Client,
+func serviceStart(client containerruntime.ContainerRuntime,
 	agreementId string,
 	serviceName string,
 	shareLabel string,
@@ -747,7 +855,7 @@ func serviceStart(client *docker.Client,
 	return nil
 }
 
-func serviceDestroy(client *docker.Client, agreementId string, containerId string) (bool, error) {
+func serviceDestroy(client containerruntime.ContainerRuntime, agreementId string, containerId string) (bool, error) {
 	glog.V(3).Infof("Attempting to stop container %v from agreement: %v.", containerId, agreementId)
 	err := client.KillContainer(docker.KillContainerOptions{ID: containerId})
 
@@ -763,7 +871,7 @@ func serviceDestroy(client *docker.Client, agreementId string, containerId strin
 	return true, client.RemoveContainer(docker.RemoveContainerOptions{ID: containerId, RemoveVolumes: true, Force: true})
 }
 
-func existingShared(client *docker.Client, serviceName string, servicePair *servicePair, bridgeName string, shareLabel string) (*docker.Network, *docker.APIContainers, error) {
+func existingShared(client containerruntime.ContainerRuntime, serviceName string, servicePair *servicePair, bridgeName string, shareLabel string) (*docker.Network, *docker.APIContainers, error) {
 
 	var sBridge docker.Network
 	networks, err := client.ListNetworks()
@@ -892,7 +1000,7 @@ func generatePermittedString(isolation *containermessage.NetworkIsolation, netwo
 	return fmt.Sprintf("%v%v/%v", permittedString, network.IPAddress, network.IPPrefixLen), nil
 }
 
-func processPostCreate(ipt *iptables.IPTables, client *docker.Client, agreementId string, deployment containermessage.DeploymentDescription, configureRaw []byte, hasSpecifiedEthAccount bool, containers []interface{}, fail func(container *docker.Container, name string, err error) error) error {
+func processPostCreate(ipt *iptables.IPTables, client containerruntime.ContainerRuntime, agreementId string, deployment containermessage.DeploymentDescription, configureRaw []byte, hasSpecifiedEthAccount bool, containers []interface{}, fail func(container *docker.Container, name string, err error) error) error {
 
 	if ipt != nil {
 		rules, err := ipt.List("filter", IPT_COLONUS_ISOLATED_CHAIN)
@@ -944,6 +1052,9 @@ func processPostCreate(ipt *iptables.IPTables, client *docker.Client, agreementI
 		if err != nil {
 			return fail(nil, "<unknown>", fmt.Errorf("Unable to manipulate IPTables rules in container post-creation step: Error: %v", err))
 		}
+	} else {
+		glog.V(3).Infof("No iptables available, skipping network isolation rules for agreement %v", agreementId)
+		return nil
 	}
 
 	comment := fmt.Sprintf("agreement_id=%v", agreementId)
@@ -1304,6 +1415,11 @@ func (b *ContainerWorker) ResourcesCreate(agreementId string, agreementProtocol
 
 func (b *ContainerWorker) Initialize() bool {
 	b.syncupResources()
+
+	// restart the stopped service containers that have a restart policy
+	if b.client != nil {
+		b.DispatchSubworker(CONTAINER_RESTART, b.checkRestarts, RESTART_CHECK_INTERVAL_S, true)
+	}
 	return true
 }
 
@@ -1331,6 +1447,15 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			// requeue the command
 			b.AddDeferredCommand(cmd)
 			return true
+		} else if len(ms_containers) != 0 && !b.readinessGateOpen(agreementId, persistence.NewServiceInstancePathElement(ags[0].RunningWorkload.URL, ags[0].RunningWorkload.Org, ags[0].RunningWorkload.Version), ms_containers,
+			func(severity string, meta *persistence.MessageMeta, eventCode string) {
+				eventlog.LogAgreementEvent(b.db, severity, meta, eventCode, ags[0])
+			}) {
+			glog.V(3).Infof("Workload for agreement %v is waiting for the services it depends on to be ready.", agreementId)
+
+			// requeue the command until the services it depends on are ready
+			b.AddDeferredCommand(cmd)
+			return true
 		} else {
 
 			// Now that we have a list of service containers that are part of this agreement, we need to get a list of service
@@ -1401,6 +1526,22 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 				deploymentDesc.Services[serviceName].AddFilesystemBinding(fmt.Sprintf("%v:%v:rw", dir, "/service_config"))
 			}
 
+			// Write the secrets bound to the workload into tmpfs files and mount them read-only into the workload containers.
+			if len(cmd.AgreementLaunchContext.SecretBindings) != 0 {
+				if err := b.GetSecretManager().CreateSecretFiles(agreementId, cmd.AgreementLaunchContext.SecretBindings); err != nil {
+					eventlog.LogAgreementEvent(b.db, persistence.SEVERITY_ERROR,
+						persistence.NewMessageMeta(EL_CONT_ERROR_CREATE_SECRET_FILES, agreementId, err.Error()),
+						persistence.EC_ERROR_START_CONTAINER,
+						ags[0])
+					glog.Errorf("Error creating secret files for agreement %v: %v", agreementId, err)
+					b.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, cmd.AgreementLaunchContext.AgreementProtocol, agreementId, nil)
+					return true
+				}
+				for serviceName := range deploymentDesc.Services {
+					deploymentDesc.Services[serviceName].AddFilesystemBinding(fmt.Sprintf("%v:%v:ro", b.GetSecretManager().GetSecretPath(agreementId), config.HZN_SECRETS_MOUNT))
+				}
+			}
+
 			// Each service has an identity that is based on its service defintion URL and Org. This identity is what we can use to
 			// authenticate a service to an API that is hosted by Anax.
 			serviceIdentity := cutil.FormOrgSpecUrl(cutil.NormalizeURL(ags[0].RunningWorkload.URL), ags[0].RunningWorkload.Org)
@@ -1459,6 +1600,16 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 				// Requeue the command
 				b.AddDeferredCommand(cmd)
 				return true
+			} else if len(ms_containers) != 0 && !b.readinessGateOpen(lc.Name, lc.GetServicePathElement(), ms_containers,
+				func(severity string, meta *persistence.MessageMeta, eventCode string) {
+					eventlog.LogServiceEvent2(b.db, severity, meta, eventCode,
+						"", lc.ServicePathElement.URL, lc.ServicePathElement.Org, lc.ServicePathElement.Version, "", lc.AgreementIds)
+				}) {
+				glog.V(3).Infof("Service %v is waiting for the services it depends on to be ready.", lc.Name)
+
+				// Requeue the command until the services it depends on are ready
+				b.AddDeferredCommand(cmd)
+				return true
 			} else {
 				// Get a list of service network ids to be added to this container.
 				// Now that we have a list of service containers that are direct children of this service, we need to get a list of service
@@ -1517,6 +1668,15 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			return true
 		}
 
+		// Run the images that were fetched, which the image fetcher has pinned to their digests.
+		if cmd.DeploymentDescription != nil {
+			for serviceName, service := range deploymentDesc.Services {
+				if fetched, ok := cmd.DeploymentDescription.Services[serviceName]; ok && fetched.Image != "" {
+					service.Image = fetched.Image
+				}
+			}
+		}
+
 		serviceNames := deploymentDesc.ServiceNames()
 
 		for serviceName, service := range deploymentDesc.Services {
@@ -1565,6 +1725,22 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			}
 		}
 
+		// Write the secrets bound to the service into tmpfs files and mount them read-only into the service containers.
+		if len(lc.SecretBindings) != 0 {
+			if err := b.GetSecretManager().CreateSecretFiles(lc.Name, lc.SecretBindings); err != nil {
+				eventlog.LogServiceEvent2(b.db, persistence.SEVERITY_ERROR,
+					persistence.NewMessageMeta(EL_CONT_ERROR_CREATE_SECRET_FILES_FOR_SVC, lc.Name, err.Error()),
+					persistence.EC_ERROR_START_CONTAINER,
+					"", lc.ServicePathElement.URL, lc.ServicePathElement.Org, lc.ServicePathElement.Version, "", lc.AgreementIds)
+				glog.Errorf("Error creating secret files for service %v: %v", lc.Name, err)
+				b.Messages() <- events.NewContainerMessage(events.EXECUTION_FAILED, *cmd.ContainerLaunchContext, "", "")
+				return true
+			}
+			for serviceName := range deploymentDesc.Services {
+				deploymentDesc.Services[serviceName].AddFilesystemBinding(fmt.Sprintf("%v:%v:ro", b.GetSecretManager().GetSecretPath(lc.Name), config.HZN_SECRETS_MOUNT))
+			}
+		}
+
 		// Indicate that this deployment description is part of the infrastructure
 		deploymentDesc.Infrastructure = true
 
@@ -1629,10 +1805,19 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			nd := cmd.Deployment.(*persistence.NativeDeploymentConfig)
 			serviceNames := persistence.ServiceConfigNames(&nd.Services)
 
+			now := time.Now().Unix()
 			report := func(container *docker.APIContainers, agreementId string) error {
 
 				for _, name := range serviceNames {
-					if container.Labels[LABEL_PREFIX+".service_name"] == name && container.State == "running" {
+					if container.Labels[LABEL_PREFIX+".service_name"] == name && container.State != "running" && b.restartPending(container) {
+						cMatches = append(cMatches, *container)
+						glog.V(4).Infof("Stopped container instance for agreement %v is left to its restart policy: %v", agreementId, container)
+					} else if container.Labels[LABEL_PREFIX+".service_name"] == name && container.State == "running" {
+						if b.unhealthy.unhealthyTooLong(container, now) {
+							glog.Errorf("Container %v for agreement %v has been unhealthy for more than %v seconds.", container.Names, agreementId, b.Config.Edge.UnhealthyContainerTimeoutS)
+							b.unhealthy.forget(container.ID)
+							continue
+						}
 						cMatches = append(cMatches, *container)
 						glog.V(4).Infof("Matching container instance for agreement %v: %v", agreementId, container)
 					}
@@ -1672,6 +1857,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		if err := b.ResourcesRemove(agreements); err != nil {
 			glog.Errorf("Error removing resources: %v", err)
 		}
+		b.deleteReadinessGates(agreements)
 
 		// send the event to let others know that the workload clean up has been processed
 		b.Messages() <- events.NewWorkloadMessage(events.WORKLOAD_DESTROYED, cmd.AgreementProtocol, cmd.CurrentAgreementId, nil)
@@ -1683,6 +1869,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		if err := b.ResourcesRemove([]string{cmd.Msg.ContainerName}); err != nil {
 			glog.Errorf("Error removing resources: %v", err)
 		}
+		b.deleteReadinessGates([]string{cmd.Msg.ContainerName})
 
 		// send the event to let others know that the workload clean up has been processed
 		b.Messages() <- events.NewContainerShutdownMessage(events.CONTAINER_DESTROYED, cmd.Msg.ContainerName, cmd.Msg.Org)
@@ -1701,12 +1888,19 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			glog.Errorf("Error retrieving service contianers for %v, error: %v", cmd.MsInstKey, err)
 		} else if serviceNames != nil && len(serviceNames) > 0 {
 
+			now := time.Now().Unix()
 			report := func(container *docker.APIContainers, instance_key string) error {
 
 				for _, name := range serviceNames {
 					if container.Labels[LABEL_PREFIX+".service_name"] == name {
-						if container.State != "running" {
+						if container.State != "running" && b.restartPending(container) {
+							cMatches = append(cMatches, *container)
+							glog.V(4).Infof("Stopped container instance for service instance %v is left to its restart policy: %v", instance_key, container)
+						} else if container.State != "running" {
 							glog.Errorf("Service container for %v is not in the running state.", instance_key)
+						} else if b.unhealthy.unhealthyTooLong(container, now) {
+							glog.Errorf("Service container for %v has been unhealthy for more than %v seconds.", instance_key, b.Config.Edge.UnhealthyContainerTimeoutS)
+							b.unhealthy.forget(container.ID)
 						} else {
 							cMatches = append(cMatches, *container)
 							glog.V(4).Infof("Matching container instance for service instance %v: %v", instance_key, container)
@@ -1741,6 +1935,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		if err := b.ResourcesRemove(agreements); err != nil {
 			glog.Errorf("Error removing resources: %v", err)
 		}
+		b.deleteReadinessGates(agreements)
 
 		// send the event to let others know that the microservice clean up has been processed
 		b.Messages() <- events.NewMicroserviceContainersDestroyedMessage(events.CONTAINER_DESTROYED, cmd.MsInstKey)
@@ -1749,6 +1944,9 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		if err := b.GetAuthenticationManager().RemoveAll(); err != nil {
 			glog.Errorf("Error handling node unconfig command: %v", err)
 		}
+		if err := b.GetSecretManager().RemoveAll(); err != nil {
+			glog.Errorf("Error handling node unconfig command: %v", err)
+		}
 		b.Commands <- worker.NewTerminateCommand("shutdown")
 
 	default:
@@ -1881,7 +2079,9 @@ func (b *ContainerWorker) syncupResources() {
 
 		// Fourth, run through IP routing table rules, looking for rules that are leftover from old agreements. Be aware that there
 		// could be other non-Horizon rules on this host, so we have to be careful to NOT terminate them.
-		if exists, err := b.iptables.Exists("filter", IPT_COLONUS_ISOLATED_CHAIN, "-j", "RETURN"); err != nil {
+		if b.iptables == nil {
+			glog.V(3).Infof("ContainerWorker has no iptables client, skipping the check of the isolation rules")
+		} else if exists, err := b.iptables.Exists("filter", IPT_COLONUS_ISOLATED_CHAIN, "-j", "RETURN"); err != nil {
 			fail(fmt.Sprintf("ContainerWorker unable to interrogate iptables on host. Error: %v", err))
 		} else if !exists {
 			glog.V(3).Infof(fmt.Sprintf("ContainerWorker primary redirect rule missing from %v chain.", IPT_COLONUS_ISOLATED_CHAIN))
@@ -2039,8 +2239,16 @@ func (b *ContainerWorker) ResourcesRemove(agreements []string) error {
 			glog.Errorf("Failed to remove FSS Authentication credential file for %v, error %v", agreementId, err)
 		}
 
+		// Remove the secret files.
+		if err := b.GetSecretManager().RemoveSecretFiles(agreementId); err != nil {
+			glog.Errorf("Failed to remove secret files for %v, error %v", agreementId, err)
+		}
+
 	}
 
+	// Remove the volumes that are deleted with the containers of the service.
+	b.deleteServiceVolumes(agreements)
+
 	// gather agreement networks to free
 	for _, net := range networks {
 		for _, agreementId := range agreements {
@@ -2488,6 +2696,12 @@ func (b *ContainerWorker) createDockerVolumesForContainer(serviceName string, ag
 				continue
 			}
 
+			// the lifecycle, driver and size quota of the volume from the deployment description
+			options := containermessage.VolumeOptions{}
+			if servicePair.service != nil {
+				options = servicePair.service.Volumes[vol_name]
+			}
+
 			bExists := false
 			if volumes_docker != nil {
 				for _, v_docker := range volumes_docker {
@@ -2501,11 +2715,13 @@ func (b *ContainerWorker) createDockerVolumesForContainer(serviceName string, ag
 			if !bExists {
 				// create the volume if it does not exist
 				vOption := docker.CreateVolumeOptions{
-					Name:   vol_name,
-					Driver: "local",
+					Name:       vol_name,
+					Driver:     options.GetDriver(),
+					DriverOpts: options.GetDriverOpts(),
 					Labels: map[string]string{
 						LABEL_PREFIX + ".service_name": serviceName,
 						LABEL_PREFIX + ".agreement_id": agreementId,
+						LABEL_PREFIX + ".lifecycle":    options.GetLifecycle(),
 						LABEL_PREFIX + ".owner":        "openhorizon"},
 				}
 
@@ -2514,12 +2730,15 @@ func (b *ContainerWorker) createDockerVolumesForContainer(serviceName string, ag
 				} else {
 					glog.V(3).Infof("Volume %v created for service %v.", vol_name, serviceName)
 
-					// same the volume in local db so that it can be cleaned up at unregistration time
-					// Ling todo - only save the ones that are specified by the user in binds.
-					if persistence.SaveContainerVolumeByName(b.db, vol_name); err != nil {
-						return fmt.Errorf("Failed to get save the docker volume name %v into the local db. %v", vol_name, err)
+					// save the volume in local db so that it can be cleaned up according to its lifecycle
+					cv := persistence.NewContainerVolume(vol_name)
+					setContainerVolumeOptions(cv, serviceName, agreementId, &options)
+					if err := persistence.SaveContainerVolume(b.db, cv); err != nil {
+						return fmt.Errorf("Failed to save the docker volume name %v into the local db. %v", vol_name, err)
 					}
 				}
+			} else if err := b.updateContainerVolume(vol_name, serviceName, agreementId, &options); err != nil {
+				return err
 			}
 		}
 	}
@@ -2545,8 +2764,8 @@ func DeleteLeftoverDockerVolumes(db *bolt.DB, config *config.HorizonConfig) erro
 		return nil
 	}
 
-	if client, err := docker.NewClient(config.Edge.DockerEndpoint); err != nil {
-		return fmt.Errorf("Failed to instantiate docker Client: %v", err)
+	if client, err := containerruntime.NewAgentContainerRuntime(config); err != nil {
+		return fmt.Errorf("Failed to instantiate %v client: %v", config.GetContainerRuntime(), err)
 	} else {
 		// check existing docker volumes
 		volumes_docker, err := client.ListVolumes(docker.ListVolumesOptions{})
@@ -2560,6 +2779,12 @@ func DeleteLeftoverDockerVolumes(db *bolt.DB, config *config.HorizonConfig) erro
 
 		for _, cv := range cvs {
 
+			// the volumes that are retained on unregister are only deleted from the CLI
+			if cv.GetLifecycle() == persistence.CV_LIFECYCLE_RETAIN_ON_UNREGISTER {
+				glog.V(3).Infof("Docker volume %v is retained on unregister.", cv.Name)
+				continue
+			}
+
 			// make sure the volume still exists and it has openhorizon as the owner
 			found := false
 			for _, dv := range volumes_docker {
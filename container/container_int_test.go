@@ -9,15 +9,16 @@ import (
 	"flag"
 	"fmt"
 	"github.com/boltdb/bolt"
+	"github.com/coreos/go-iptables/iptables"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/open-horizon/anax/config"
-	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/resource"
 	"io"
 	"io/ioutil"
-	"net/url"
 	"os"
 	"path"
 	"runtime"
@@ -72,15 +73,45 @@ func tConfig() *config.HorizonConfig {
 	}
 }
 
+// The tests run on the in memory container runtime, unless CONTAINER_INT_TEST_RUNTIME is set to docker or podman, to
+// run them on the container runtime at the docker endpoint of the config.
+func tRuntime(config *config.HorizonConfig) containerruntime.ContainerRuntime {
+	if runtimeType := os.Getenv("CONTAINER_INT_TEST_RUNTIME"); runtimeType != "" {
+		cr, err := containerruntime.NewContainerRuntime(runtimeType, config.Edge.DockerEndpoint)
+		if err != nil {
+			panic(err)
+		}
+		return cr
+	}
+	return containerruntime.NewFakeRuntime()
+}
+
+// Returns a container worker with the test image in its container runtime. The network isolation rules are only
+// set up on a real container runtime.
 func tWorker(config *config.HorizonConfig, db *bolt.DB) *ContainerWorker {
-	cw := NewContainerWorker("cworker", config, db)
-	cw.inAgbot = true
-	return cw
+	cr := tRuntime(config)
+	if err := cr.PullImage(docker.PullImageOptions{Repository: strings.Split(pickImage(), ":")[0], Tag: strings.Split(pickImage(), ":")[1]}, docker.AuthConfiguration{}); err != nil {
+		panic(err)
+	}
+
+	var ipt *iptables.IPTables
+	if _, fake := cr.(*containerruntime.FakeRuntime); !fake {
+		var err error
+		if ipt, err = iptables.New(); err != nil {
+			panic(err)
+		}
+	}
+
+	return newContainerWorker("cworker", config, db, resource.NewAuthenticationManager(path.Join(config.Edge.ServiceStorage, "auth")), cr, ipt)
 }
 
 func tMsg(messages chan events.Message, expectedEvent events.EventId, t *testing.T) *events.WorkloadMessage {
-	// block on this read
+	// block on this read, skipping the messages that are not about workloads, like the container sync at worker start
 	msg := <-messages
+	for _, ok := msg.(*events.WorkloadMessage); msg != nil && !ok; _, ok = msg.(*events.WorkloadMessage) {
+		t.Logf("skipping msg: %v", msg)
+		msg = <-messages
+	}
 
 	if msg == nil {
 		t.Log("Message is nil")
@@ -175,9 +206,15 @@ func tClean(t *testing.T, tName string, worker *ContainerWorker, setupVerificati
 	}
 }
 
-func tConnectivity(t *testing.T, client *docker.Client, container *docker.APIContainers) bool {
+func tConnectivity(t *testing.T, cr containerruntime.ContainerRuntime, container *docker.APIContainers) bool {
 	t.Logf("Checking connectivity of %v", container.Names)
 
+	// nothing runs in the in memory runtime, so check that the container is on a network with the container it pings
+	client, ok := cr.(*docker.Client)
+	if !ok {
+		return tNetworkConnectivity(t, cr, container)
+	}
+
 	start := time.Now().Unix()
 	// this validation mechanism is not as cool as a socket listener from the test runner, evaluate if the latter is necessary
 	// read /tmp/cping_success.stamp; wait if it's not written yet
@@ -214,6 +251,61 @@ func tConnectivity(t *testing.T, client *docker.Client, container *docker.APICon
 	return false
 }
 
+// Returns true if the host that the container pings can be reached from the container. A host that is not the name or
+// a network alias of any container, plain or qualified with the network name, is outside of the runtime, and is reachable. Otherwise the container has to be on a
+// network on which the pinged container has that name or alias.
+func tNetworkConnectivity(t *testing.T, cr containerruntime.ContainerRuntime, container *docker.APIContainers) bool {
+	detail, err := cr.InspectContainer(container.ID)
+	if err != nil {
+		t.Logf("Error inspecting container %v: %v", container.Names, err)
+		return false
+	}
+
+	fields := strings.Fields(strings.Join(detail.Config.Cmd, " "))
+	host := ""
+	for i, f := range fields {
+		if f == "-c1" && i+1 < len(fields) {
+			host = fields[i+1]
+		}
+	}
+	if host == "" || host == "localhost" {
+		return true
+	}
+
+	all, err := cr.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		t.Logf("Error listing containers: %v", err)
+		return false
+	}
+
+	known := false
+	for _, other := range all {
+		otherDetail, err := cr.InspectContainer(other.ID)
+		if err != nil {
+			continue
+		}
+		for netName, ep := range otherDetail.NetworkSettings.Networks {
+			names := append([]string{strings.TrimPrefix(otherDetail.Name, "/")}, ep.Aliases...)
+			for _, name := range names {
+				// docker dns also resolves a name qualified with the network name
+				if name != host && name+"."+netName != host {
+					continue
+				}
+				known = true
+				if _, shared := detail.NetworkSettings.Networks[netName]; shared {
+					t.Logf("Container %v reaches %v on network %v", container.Names, host, netName)
+					return true
+				}
+			}
+		}
+	}
+
+	if !known {
+		t.Logf("Container %v pings %v outside of the container runtime", container.Names, host)
+	}
+	return !known
+}
+
 func pickImage() string {
 	if runtime.GOARCH == "arm" {
 		return "armhf/alpine:3.3"
@@ -241,7 +333,7 @@ func commonPatterned(t *testing.T, db *bolt.DB, agreementId string, tFn func(wor
 	protocol := "Citizen Scientist"
 
 	wi, _ := persistence.NewWorkloadInfo("url", "org", "version", "")
-	_, err := persistence.NewEstablishedAgreement(db, "ctest fake policy", myAgreementId, "consumerId", "{}", protocol, 1, []string{}, "signature", "address", "bcType", "bcName", "bcOrg", wi)
+	_, err := persistence.NewEstablishedAgreement(db, "ctest fake policy", myAgreementId, "consumerId", "{}", protocol, 1, persistence.ServiceSpecs{}, "signature", "address", "bcType", "bcName", "bcOrg", wi)
 	if err != nil {
 		t.Error(err)
 	}
@@ -270,7 +362,7 @@ func commonPatterned(t *testing.T, db *bolt.DB, agreementId string, tFn func(wor
 	cmd := worker.NewWorkloadConfigureCommand(&deploymentDesc, &events.AgreementLaunchContext{
 		AgreementProtocol:    protocol,
 		AgreementId:          myAgreementId,
-		Configure:            *events.NewContainerConfig(url.URL{}, "", myDeployment, "", "", ""),
+		Configure:            *events.NewContainerConfig(myDeployment, "", "", "", "", "", nil),
 		ConfigureRaw:         []byte("someRawConfigureData"),
 		EnvironmentAdditions: &env,
 	})
@@ -283,7 +375,7 @@ func commonPatterned(t *testing.T, db *bolt.DB, agreementId string, tFn func(wor
 
 func Test_resourcesCreate_failLoad(t *testing.T) {
 	thisTest := func(worker *ContainerWorker, env map[string]string, agreementId string) {
-		defer tClean(t, agreementId, worker, func(container *docker.APIContainers, containerDetail *docker.Container) error { return nil }, false)
+		defer tClean(t, agreementId, worker, func(con *docker.APIContainers, containerDetail *docker.Container) error { return nil }, false)
 
 		// fire the msg off
 		tMsg(worker.Messages(), events.EXECUTION_FAILED, t)
@@ -298,7 +390,7 @@ func Test_resourcesCreate_failLoad(t *testing.T) {
 	protocol := "Citizen Scientist"
 
 	wi, _ := persistence.NewWorkloadInfo("url", "org", "version", "")
-	_, err = persistence.NewEstablishedAgreement(db, "ctest fake policy", agreementId, "consumerId", "{}", protocol, 1, []string{}, "signature", "address", "bcType", "bcName", "bcOrg", wi)
+	_, err = persistence.NewEstablishedAgreement(db, "ctest fake policy", agreementId, "consumerId", "{}", protocol, 1, persistence.ServiceSpecs{}, "signature", "address", "bcType", "bcName", "bcOrg", wi)
 	if err != nil {
 		t.Error(err)
 	}
@@ -330,8 +422,6 @@ func Test_resourcesCreate_failLoad(t *testing.T) {
 		"HZN_RAM":         "64",
 	}
 
-	dl, _ := url.Parse("https://images.bluehorizon.network/f3a39c78edf78d415ff7e634e396d8e34b1656a3.torrent")
-
 	var deploymentDesc containermessage.DeploymentDescription
 	if err := json.Unmarshal([]byte(pattern), &deploymentDesc); err != nil {
 		t.Error(err)
@@ -341,7 +431,7 @@ func Test_resourcesCreate_failLoad(t *testing.T) {
 	cmd := worker.NewWorkloadConfigureCommand(&deploymentDesc, &events.AgreementLaunchContext{
 		AgreementProtocol:    "Citizen Scientist",
 		AgreementId:          agreementId,
-		Configure:            *events.NewContainerConfig(*dl, "", pattern, "wpDdJ60JG1MvThKLMRX0eJf6/LHGUes79FDypYCOkgDAmA96BsREKpEHzl3OVM15z1vop6mpkLH5ka6vvbG0xJBYzZQl9HvyCSA7oJ/dQOqodjy2CySNWmzlFC842QXhrZO9yZxHZX0EcaPr2BdGu9p/9q17LzH9BcBYmBo7dZNqKSqkphErdqc1BOGSnjGlk/FfwnQGZM5SFz8mXa3ZW1/8yQ7w9/vvjTpcyB/X0Rv8qy0hfN0LKUfjfsZJ6O/aij0RkQ0w5ioGorGawOzQGvijs17KN8qfyVNn6QGqa03d4+e0mEQalhG9xsZKWSviSY92ifdSpBs7DohevyYMfT2mCRafP4lF2luu61Ho3pBQPEUjVEhvWch6b0FbsiH4iVcIVFTR+7SZhcv6oVwLDawvdT4aDo6Q1JhEuUrLMJhs6fb9q0cHl8SBpkPfcua33F4XDRCJoiYwTj3a8TtEKfaGmMDuIQq/5mJI8DSdCKasKDitLYFTE4z7+i2uKYlmXD1tzC2hNIWgdgAIXg0meQymWPqNIxDoo+pzTgDvv+tQ9usDRAvd+aYIDcf7IXAlAomtg7GE4v8KTCJHkM1aHVKE1ZCy0yI5uEWQoce9v8DukyZVwRTxfSX83F8Y/zfhxneSAeGkHHKO1PyFp82/fQDRyWhaSDdqO1uFPFvfbBU=", "", ""),
+		Configure:            *events.NewContainerConfig(pattern, "wpDdJ60JG1MvThKLMRX0eJf6/LHGUes79FDypYCOkgDAmA96BsREKpEHzl3OVM15z1vop6mpkLH5ka6vvbG0xJBYzZQl9HvyCSA7oJ/dQOqodjy2CySNWmzlFC842QXhrZO9yZxHZX0EcaPr2BdGu9p/9q17LzH9BcBYmBo7dZNqKSqkphErdqc1BOGSnjGlk/FfwnQGZM5SFz8mXa3ZW1/8yQ7w9/vvjTpcyB/X0Rv8qy0hfN0LKUfjfsZJ6O/aij0RkQ0w5ioGorGawOzQGvijs17KN8qfyVNn6QGqa03d4+e0mEQalhG9xsZKWSviSY92ifdSpBs7DohevyYMfT2mCRafP4lF2luu61Ho3pBQPEUjVEhvWch6b0FbsiH4iVcIVFTR+7SZhcv6oVwLDawvdT4aDo6Q1JhEuUrLMJhs6fb9q0cHl8SBpkPfcua33F4XDRCJoiYwTj3a8TtEKfaGmMDuIQq/5mJI8DSdCKasKDitLYFTE4z7+i2uKYlmXD1tzC2hNIWgdgAIXg0meQymWPqNIxDoo+pzTgDvv+tQ9usDRAvd+aYIDcf7IXAlAomtg7GE4v8KTCJHkM1aHVKE1ZCy0yI5uEWQoce9v8DukyZVwRTxfSX83F8Y/zfhxneSAeGkHHKO1PyFp82/fQDRyWhaSDdqO1uFPFvfbBU=", "", "", "", "", nil),
 		ConfigureRaw:         []byte("someRawConfigureData"),
 		EnvironmentAdditions: &env,
 	})
@@ -361,15 +451,20 @@ func Test_resourcesCreate_patterned(t *testing.T) {
 
 	thisTest := func(worker *ContainerWorker, env map[string]string, agreementId string) {
 
-		setupVerification := func(container *docker.APIContainers, containerDetail *docker.Container) error {
-			if container.Labels[container.LABEL_PREFIX+".agreement_id"] == agreementId {
+		setupVerification := func(con *docker.APIContainers, containerDetail *docker.Container) error {
+			if con.Labels[LABEL_PREFIX+".agreement_id"] == agreementId {
 
-				if _, present := container.Labels[container.LABEL_PREFIX+".service_name"]; !present {
-					return fmt.Errorf("service_name label not set on workload container: %v", container.Labels)
+				if _, present := con.Labels[LABEL_PREFIX+".service_name"]; !present {
+					return fmt.Errorf("service_name label not set on workload container: %v", con.Labels)
 				}
 
-				if containerDetail.HostConfig.CPUSetCPUs != "0-1" {
-					return fmt.Errorf("Wrong CPUSet on running container: %v. Entire HostConfig: %v", containerDetail.HostConfig.CPUSetCPUs, containerDetail.HostConfig)
+				// the worker sets the cpuset in the container config, docker moves it to the host config
+				cpuSet := containerDetail.HostConfig.CPUSetCPUs
+				if cpuSet == "" && containerDetail.Config != nil {
+					cpuSet = containerDetail.Config.CPUSet
+				}
+				if cpuSet != "0-1" {
+					return fmt.Errorf("Wrong CPUSet on running container: %v. Entire HostConfig: %v", cpuSet, containerDetail.HostConfig)
 				}
 
 				if containerDetail.HostConfig.LogConfig.Type != "syslog" || !strings.HasPrefix(containerDetail.HostConfig.LogConfig.Config["tag"], "workload-") {
@@ -385,8 +480,8 @@ func Test_resourcesCreate_patterned(t *testing.T) {
 					return fmt.Errorf("RAM not set correctly")
 				}
 
-				if !tConnectivity(t, worker.client, container) {
-					return fmt.Errorf("container connectivity test failed for %v", container.Names)
+				if !tConnectivity(t, worker.client, con) {
+					return fmt.Errorf("container connectivity test failed for %v", con.Names)
 				}
 			}
 			return nil
@@ -422,7 +517,7 @@ func Test_resourcesRemove(t *testing.T) {
 	// launch setup
 	commonPatterned(t, db, "", setup, "")
 
-	defer tClean(t, createMsg.AgreementId, w, func(container *docker.APIContainers, containerDetail *docker.Container) error { return nil }, true)
+	defer tClean(t, createMsg.AgreementId, w, func(con *docker.APIContainers, containerDetail *docker.Container) error { return nil }, true)
 
 	cmd := w.NewWorkloadShutdownCommand(createMsg.AgreementProtocol, createMsg.AgreementId, createMsg.Deployment, []string{})
 	w.Commands <- cmd
@@ -534,14 +629,14 @@ func Test_resourcesCreate_shared(t *testing.T) {
 		}
 
 		for _, con := range cons {
-			conAg := con.Labels[container.LABEL_PREFIX+".agreement_id"]
+			conAg := con.Labels[LABEL_PREFIX+".agreement_id"]
 
 			if conAg == p2AgreementId || conAg == p1AgreementId {
 
 				connectivity := tConnectivity(t, worker.client, &con)
 
 				// D isn't supposed to have connectivity
-				if con.Labels[container.LABEL_PREFIX+".service_name"] == "container-int-test-someServiceD" {
+				if con.Labels[LABEL_PREFIX+".service_name"] == "container-int-test-someServiceD" {
 					if connectivity {
 						t.Errorf("container %v isn't supposed to have connectivity but it does", con.Names)
 					}
@@ -556,8 +651,8 @@ func Test_resourcesCreate_shared(t *testing.T) {
 	commonPatterned(t, db, p1AgreementId, setup, fmt.Sprintf(pattern1, imageName, imageName, imageName))
 	commonPatterned(t, db, p2AgreementId, setupVerify, fmt.Sprintf(pattern2, imageName, imageName, imageName))
 
-	defer tClean(t, p1AgreementId, w, func(container *docker.APIContainers, containerDetail *docker.Container) error { return nil }, true)
-	defer tClean(t, p2AgreementId, w, func(container *docker.APIContainers, containerDetail *docker.Container) error { return nil }, true)
+	defer tClean(t, p1AgreementId, w, func(con *docker.APIContainers, containerDetail *docker.Container) error { return nil }, true)
+	defer tClean(t, p2AgreementId, w, func(con *docker.APIContainers, containerDetail *docker.Container) error { return nil }, true)
 
 	// do the shutdown
 	for _, createMsg := range createMsgs {
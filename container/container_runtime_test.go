@@ -0,0 +1,161 @@
+// +build unit
+
+package container
+
+import (
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"testing"
+)
+
+func testServicePair(image string, hash string) *servicePair {
+	return &servicePair{
+		service: &containermessage.Service{Image: image},
+		serviceConfig: &persistence.ServiceConfig{
+			Config: docker.Config{
+				Image: image,
+				Labels: map[string]string{
+					LABEL_PREFIX + ".service_name":                "svc",
+					LABEL_PREFIX + ".variation":                   "",
+					LABEL_PREFIX + ".deployment_description_hash": hash,
+				},
+			},
+			HostConfig: docker.HostConfig{},
+		},
+	}
+}
+
+func testFail(container *docker.Container, name string, err error) error {
+	return fmt.Errorf("%v: %v", name, err)
+}
+
+func Test_serviceStart_fakeRuntime(t *testing.T) {
+	client := containerruntime.NewFakeRuntime()
+	if err := client.PullImage(docker.PullImageOptions{Repository: "svc", Tag: "1.0.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatalf("unexpected pull error %v", err)
+	}
+
+	shared, err := mkBridge(client, "singleton-svc", false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating shared bridge %v", err)
+	} else if shared.Labels[LABEL_PREFIX+".service_pattern.shared"] != "singleton" {
+		t.Errorf("shared bridge not labeled, labels %v", shared.Labels)
+	}
+
+	agBridge, err := mkBridge(client, "ag1", false, false)
+	if err != nil {
+		t.Fatalf("unexpected error creating agreement bridge %v", err)
+	}
+
+	pair := testServicePair("svc:1.0.0", "abc")
+	pair.serviceConfig.Config.Labels[LABEL_PREFIX+".agreement_id"] = "ag1"
+	pair.serviceConfig.HostConfig.NetworkMode = "ag1"
+
+	endpoints := map[string]*docker.EndpointConfig{
+		agBridge.Name: &docker.EndpointConfig{Aliases: []string{"svc"}, NetworkID: agBridge.ID},
+	}
+	sharedEndpoints := map[string]*docker.EndpointConfig{
+		shared.Name: &docker.EndpointConfig{NetworkID: shared.ID},
+	}
+
+	postCreate := make([]interface{}, 0)
+	if err := serviceStart(client, "ag1", "svc", "", pair.serviceConfig, endpoints, sharedEndpoints, &postCreate, testFail, true); err != nil {
+		t.Fatalf("unexpected error starting service %v", err)
+	} else if len(postCreate) != 1 {
+		t.Fatalf("expected one created container, got %v", postCreate)
+	}
+
+	container := postCreate[0].(*docker.Container)
+	if c, err := client.InspectContainer(container.ID); err != nil {
+		t.Errorf("unexpected inspect error %v", err)
+	} else if !c.State.Running {
+		t.Errorf("container %v is not running", c.Name)
+	} else if c.Name != "/ag1-svc" {
+		t.Errorf("unexpected container name %v", c.Name)
+	} else if _, ok := c.NetworkSettings.Networks["ag1"]; !ok {
+		t.Errorf("container not connected to the agreement bridge, networks %v", c.NetworkSettings.Networks)
+	} else if _, ok := c.NetworkSettings.Networks["singleton-svc"]; !ok {
+		t.Errorf("container not connected to the shared bridge, networks %v", c.NetworkSettings.Networks)
+	}
+
+	// starting the same service again is reported to the caller as already existing
+	if err := serviceStart(client, "ag1", "svc", "", pair.serviceConfig, endpoints, nil, &postCreate, testFail, true); err != docker.ErrContainerAlreadyExists {
+		t.Errorf("expected already exists error, got %v", err)
+	}
+
+	if destroyed, err := serviceDestroy(client, "ag1", container.ID); err != nil {
+		t.Errorf("unexpected destroy error %v", err)
+	} else if !destroyed {
+		t.Errorf("expected container to be destroyed")
+	} else if destroyed, err := serviceDestroy(client, "ag1", container.ID); err != nil || destroyed {
+		t.Errorf("expected removed container to be skipped, got %v %v", destroyed, err)
+	}
+}
+
+func Test_existingShared_fakeRuntime(t *testing.T) {
+	client := containerruntime.NewFakeRuntime()
+	if err := client.PullImage(docker.PullImageOptions{Repository: "svc", Tag: "1.0.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatalf("unexpected pull error %v", err)
+	}
+
+	pair := testServicePair("svc:1.0.0", "abc")
+	pair.serviceConfig.Config.Labels[LABEL_PREFIX+".service_pattern.shared"] = "singleton"
+
+	// nothing exists yet
+	if net, con, err := existingShared(client, "svc", pair, "singleton-svc", "singleton"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if net != nil || con != nil {
+		t.Errorf("expected nothing shared, got %v %v", net, con)
+	}
+
+	// only the bridge exists
+	bridge, err := mkBridge(client, "singleton-svc", false, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating bridge %v", err)
+	}
+	if net, con, err := existingShared(client, "svc", pair, "singleton-svc", "singleton"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if net == nil || net.ID != bridge.ID || con != nil {
+		t.Errorf("expected only the shared bridge, got %v %v", net, con)
+	}
+
+	// the bridge and a running shared container exist
+	pair.serviceConfig.HostConfig.NetworkMode = "singleton-svc"
+	eps := map[string]*docker.EndpointConfig{
+		bridge.Name: &docker.EndpointConfig{Aliases: []string{"svc"}, NetworkID: bridge.ID},
+	}
+	postCreate := make([]interface{}, 0)
+	if err := serviceStart(client, "ag1", "svc", "singleton", pair.serviceConfig, eps, nil, &postCreate, testFail, true); err != nil {
+		t.Fatalf("unexpected error starting shared service %v", err)
+	}
+	container := postCreate[0].(*docker.Container)
+
+	if net, con, err := existingShared(client, "svc", pair, "singleton-svc", "singleton"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if net == nil || con == nil || con.ID != container.ID {
+		t.Errorf("expected the shared bridge and container, got %v %v", net, con)
+	}
+
+	// a shared container with a different deployment is not reused
+	other := testServicePair("svc:1.0.0", "def")
+	if net, con, err := existingShared(client, "svc", other, "singleton-svc", "singleton"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if net == nil || con != nil {
+		t.Errorf("expected only the shared bridge, got %v %v", net, con)
+	}
+
+	// a stopped shared container is removed
+	if err := client.KillContainer(docker.KillContainerOptions{ID: container.ID}); err != nil {
+		t.Fatalf("unexpected kill error %v", err)
+	}
+	if net, con, err := existingShared(client, "svc", pair, "singleton-svc", "singleton"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if net == nil || con != nil {
+		t.Errorf("expected only the shared bridge, got %v %v", net, con)
+	} else if _, err := client.InspectContainer(container.ID); err == nil {
+		t.Errorf("expected the stopped shared container to be removed")
+	}
+}
@@ -0,0 +1,111 @@
+package container
+
+import (
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"strings"
+)
+
+// The health states of a container that has a healthcheck. Containers without a healthcheck have no health state.
+const (
+	CONTAINER_HEALTH_STARTING  = "starting"
+	CONTAINER_HEALTH_HEALTHY   = "healthy"
+	CONTAINER_HEALTH_UNHEALTHY = "unhealthy"
+)
+
+// The label of the service containers whose deployment declared a healthcheck. Only the health of these containers is
+// acted on, the healthcheck that an image has of its own is only reported.
+const HEALTHCHECK_LABEL = LABEL_PREFIX + ".healthcheck"
+
+// Returns the health state of the container from the status string that docker reports in the container list,
+// for example "Up 5 minutes (healthy)" or "Up 10 seconds (health: starting)". An empty string is returned when
+// the container does not have a healthcheck.
+func GetContainerHealth(container *docker.APIContainers) string {
+	if container == nil {
+		return ""
+	}
+	if strings.Contains(container.Status, "(health: starting)") {
+		return CONTAINER_HEALTH_STARTING
+	} else if strings.Contains(container.Status, "(unhealthy)") {
+		return CONTAINER_HEALTH_UNHEALTHY
+	} else if strings.Contains(container.Status, "(healthy)") {
+		return CONTAINER_HEALTH_HEALTHY
+	}
+	return ""
+}
+
+// Returns the health state of the container from its inspected state. An empty string is returned when the container
+// does not have a healthcheck.
+func GetInspectedContainerHealth(container *docker.Container) string {
+	if container == nil {
+		return ""
+	}
+	switch container.State.Health.Status {
+	case CONTAINER_HEALTH_STARTING, CONTAINER_HEALTH_HEALTHY, CONTAINER_HEALTH_UNHEALTHY:
+		return container.State.Health.Status
+	}
+	return ""
+}
+
+// Combine the health of several containers into one state. Any unhealthy container makes the whole set unhealthy,
+// otherwise any starting container makes the set starting. Containers without a health state are ignored.
+func CombineContainerHealth(states []string) string {
+	health := ""
+	for _, state := range states {
+		switch state {
+		case CONTAINER_HEALTH_UNHEALTHY:
+			return CONTAINER_HEALTH_UNHEALTHY
+		case CONTAINER_HEALTH_STARTING:
+			health = CONTAINER_HEALTH_STARTING
+		case CONTAINER_HEALTH_HEALTHY:
+			if health == "" {
+				health = CONTAINER_HEALTH_HEALTHY
+			}
+		}
+	}
+	return health
+}
+
+// Keeps track of when each container was first seen unhealthy, so that a container that has been unhealthy for
+// longer than the configured window can be treated as failed. A window of 0 or less turns this off. It is only used on
+// the container worker's command thread so it does not need to be locked.
+type unhealthyTracker struct {
+	firstSeen map[string]int64
+	timeoutS  int64
+}
+
+func newUnhealthyTracker(timeoutS int) *unhealthyTracker {
+	return &unhealthyTracker{
+		firstSeen: make(map[string]int64),
+		timeoutS:  int64(timeoutS),
+	}
+}
+
+func (u *unhealthyTracker) String() string {
+	return fmt.Sprintf("Timeout: %v, Unhealthy containers: %v", u.timeoutS, u.firstSeen)
+}
+
+// Record the current health of the container and return true if the container has been unhealthy for longer
+// than the configured window. Only the containers whose deployment declared a healthcheck are checked.
+func (u *unhealthyTracker) unhealthyTooLong(container *docker.APIContainers, now int64) bool {
+	_, declared := container.Labels[HEALTHCHECK_LABEL]
+	if !declared || u.timeoutS <= 0 || GetContainerHealth(container) != CONTAINER_HEALTH_UNHEALTHY {
+		delete(u.firstSeen, container.ID)
+		return false
+	}
+
+	first, ok := u.firstSeen[container.ID]
+	if !ok {
+		u.firstSeen[container.ID] = now
+		first = now
+		glog.Warningf("Container %v is unhealthy: %v", container.Names, container.Status)
+	}
+
+	return now-first >= u.timeoutS
+}
+
+// Forget a container, used when the container is going to be removed.
+func (u *unhealthyTracker) forget(containerId string) {
+	delete(u.firstSeen, containerId)
+}
@@ -0,0 +1,102 @@
+// +build unit
+
+package container
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+	"testing"
+)
+
+func Test_GetContainerHealth(t *testing.T) {
+	tests := map[string]string{
+		"Up 5 minutes":                     "",
+		"Up 10 seconds (health: starting)": CONTAINER_HEALTH_STARTING,
+		"Up 2 minutes (healthy)":           CONTAINER_HEALTH_HEALTHY,
+		"Up 3 minutes (unhealthy)":         CONTAINER_HEALTH_UNHEALTHY,
+	}
+
+	for status, expected := range tests {
+		c := docker.APIContainers{ID: "abc", Status: status}
+		if health := GetContainerHealth(&c); health != expected {
+			t.Errorf("GetContainerHealth for status %v should return '%v' but got '%v'", status, expected, health)
+		}
+	}
+
+	if health := GetContainerHealth(nil); health != "" {
+		t.Errorf("GetContainerHealth for nil container should return empty string but got '%v'", health)
+	}
+}
+
+func Test_GetInspectedContainerHealth(t *testing.T) {
+	tests := map[string]string{
+		"":                         "",
+		"none":                     "",
+		CONTAINER_HEALTH_STARTING:  CONTAINER_HEALTH_STARTING,
+		CONTAINER_HEALTH_HEALTHY:   CONTAINER_HEALTH_HEALTHY,
+		CONTAINER_HEALTH_UNHEALTHY: CONTAINER_HEALTH_UNHEALTHY,
+	}
+
+	for status, expected := range tests {
+		c := docker.Container{ID: "abc", State: docker.State{Running: true, Health: docker.Health{Status: status}}}
+		if health := GetInspectedContainerHealth(&c); health != expected {
+			t.Errorf("GetInspectedContainerHealth for health status %v should return '%v' but got '%v'", status, expected, health)
+		}
+	}
+
+	if health := GetInspectedContainerHealth(nil); health != "" {
+		t.Errorf("GetInspectedContainerHealth for nil container should return empty string but got '%v'", health)
+	}
+}
+
+func Test_CombineContainerHealth(t *testing.T) {
+	if h := CombineContainerHealth([]string{"", ""}); h != "" {
+		t.Errorf("Expected no health state but got '%v'", h)
+	}
+	if h := CombineContainerHealth([]string{"", CONTAINER_HEALTH_HEALTHY}); h != CONTAINER_HEALTH_HEALTHY {
+		t.Errorf("Expected healthy but got '%v'", h)
+	}
+	if h := CombineContainerHealth([]string{CONTAINER_HEALTH_HEALTHY, CONTAINER_HEALTH_STARTING}); h != CONTAINER_HEALTH_STARTING {
+		t.Errorf("Expected starting but got '%v'", h)
+	}
+	if h := CombineContainerHealth([]string{CONTAINER_HEALTH_STARTING, CONTAINER_HEALTH_UNHEALTHY, CONTAINER_HEALTH_HEALTHY}); h != CONTAINER_HEALTH_UNHEALTHY {
+		t.Errorf("Expected unhealthy but got '%v'", h)
+	}
+}
+
+func Test_unhealthyTracker(t *testing.T) {
+	tracker := newUnhealthyTracker(60)
+
+	c := docker.APIContainers{ID: "abc", Names: []string{"/abc"}, Status: "Up 3 minutes (unhealthy)", Labels: map[string]string{HEALTHCHECK_LABEL: ""}}
+	if tracker.unhealthyTooLong(&c, 1000) {
+		t.Errorf("Container should not be unhealthy too long when it is first seen unhealthy")
+	} else if tracker.unhealthyTooLong(&c, 1059) {
+		t.Errorf("Container should not be unhealthy too long before the window has passed")
+	} else if !tracker.unhealthyTooLong(&c, 1060) {
+		t.Errorf("Container should be unhealthy too long after the window has passed")
+	}
+
+	// a healthy report resets the window
+	c.Status = "Up 4 minutes (healthy)"
+	if tracker.unhealthyTooLong(&c, 1100) {
+		t.Errorf("Healthy container should not be unhealthy too long")
+	}
+	c.Status = "Up 5 minutes (unhealthy)"
+	if tracker.unhealthyTooLong(&c, 1200) {
+		t.Errorf("Container should not be unhealthy too long after it was healthy")
+	}
+
+	// the healthcheck of the image itself is not acted on
+	image := docker.APIContainers{ID: "def", Names: []string{"/def"}, Status: "Up 3 minutes (unhealthy)"}
+	if tracker.unhealthyTooLong(&image, 1000) || tracker.unhealthyTooLong(&image, 2000) {
+		t.Errorf("Container without a healthcheck in its deployment should not be unhealthy too long")
+	}
+
+	// a window of 0 or less turns off the check
+	for _, timeoutS := range []int{0, -1} {
+		off := newUnhealthyTracker(timeoutS)
+		c.Status = "Up 5 minutes (unhealthy)"
+		if off.unhealthyTooLong(&c, 1000) || off.unhealthyTooLong(&c, 2000) {
+			t.Errorf("Container should not be unhealthy too long when the check is off with window %v", timeoutS)
+		}
+	}
+}
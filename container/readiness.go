@@ -0,0 +1,297 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/persistence"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The label with the readiness probe of a service container, so that the services that depend on it can check that
+// it is ready without the deployment description of the service.
+const READINESS_PROBE_LABEL = LABEL_PREFIX + ".readiness"
+
+// How long a single readiness probe can take.
+const READINESS_PROBE_TIMEOUT_S = 2
+
+// The exit code of the probe command when the container has none of the tools to run the probe.
+const READINESS_PROBE_NO_TOOLS = 127
+
+// Returns the shell command that probes the service from inside its container, with whichever of the usual tools the
+// image has. The probe runs in the network namespace of the container, so it does not depend on where the agent runs
+// or on the isolation of the service networks.
+func readinessProbeCommand(probe *containermessage.ReadinessProbe) []string {
+	script := ""
+	if probe.TCPPort != 0 {
+		script = fmt.Sprintf("if command -v nc >/dev/null 2>&1; then nc -z -w %[2]v 127.0.0.1 %[1]v; "+
+			"elif command -v bash >/dev/null 2>&1; then bash -c 'exec 3<>/dev/tcp/127.0.0.1/%[1]v'; "+
+			"else exit %[3]v; fi", probe.TCPPort, READINESS_PROBE_TIMEOUT_S, READINESS_PROBE_NO_TOOLS)
+	} else {
+		url := fmt.Sprintf("http://127.0.0.1:%v%v", probe.HTTPPort, probe.HTTPPath)
+		script = fmt.Sprintf("if command -v wget >/dev/null 2>&1; then wget -q -T %[2]v -O /dev/null '%[1]v'; "+
+			"elif command -v curl >/dev/null 2>&1; then curl -fsS -m %[2]v -o /dev/null '%[1]v'; "+
+			"else exit %[3]v; fi", url, READINESS_PROBE_TIMEOUT_S, READINESS_PROBE_NO_TOOLS)
+	}
+	return []string{"/bin/sh", "-c", script}
+}
+
+// Probe the service in the container, returns nil when it is ready. The probe is run in the container with the
+// container runtime. It is a variable so that the tests can replace it.
+var probeReadiness = func(client containerruntime.ContainerRuntime, probe *containermessage.ReadinessProbe, containerId string) error {
+	exec, err := client.CreateExec(docker.CreateExecOptions{Container: containerId, Cmd: readinessProbeCommand(probe)})
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to create the probe, error: %v", err))
+	} else if err := client.StartExec(exec.ID, docker.StartExecOptions{Detach: true}); err != nil {
+		return errors.New(fmt.Sprintf("unable to start the probe, error: %v", err))
+	}
+
+	deadline := time.Now().Add(time.Duration(READINESS_PROBE_TIMEOUT_S+1) * time.Second)
+	for {
+		if inspect, err := client.InspectExec(exec.ID); err != nil {
+			return errors.New(fmt.Sprintf("unable to read the result of the probe, error: %v", err))
+		} else if !inspect.Running {
+			if inspect.ExitCode == READINESS_PROBE_NO_TOOLS {
+				return errors.New("the container has no shell with nc, bash, wget or curl to run the probe")
+			} else if inspect.ExitCode != 0 {
+				return errors.New(fmt.Sprintf("the probe failed with exit code %v", inspect.ExitCode))
+			}
+			return nil
+		} else if time.Now().After(deadline) {
+			return errors.New("the probe did not finish in time")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Returns the readiness probe of the service container from its label, or nil if the service does not have one.
+func getReadinessProbe(container *docker.APIContainers) *containermessage.ReadinessProbe {
+	label, ok := container.Labels[READINESS_PROBE_LABEL]
+	if !ok {
+		return nil
+	}
+	probe := new(containermessage.ReadinessProbe)
+	if err := json.Unmarshal([]byte(label), probe); err != nil {
+		glog.Warningf("Unable to read the readiness probe %v of container %v: %v", label, container.Names, err)
+		return nil
+	}
+	return probe
+}
+
+// Check whether a container of a service that another service depends on is ready. The container is checked with its
+// readiness probe, after its healthcheck if it has one. The timeout counts from the given start of the wait.
+func checkDependencyReadiness(client containerruntime.ContainerRuntime, container docker.APIContainers, now int64, startTime int64, defaultTimeoutS int) persistence.DependencyReadiness {
+	probe := getReadinessProbe(&container)
+	health := GetContainerHealth(&container)
+
+	dr := persistence.DependencyReadiness{Check: persistence.READINESS_CHECK_RUNNING}
+	if len(container.Names) != 0 {
+		dr.Container = strings.TrimPrefix(container.Names[0], "/")
+	}
+	if probe != nil && probe.TCPPort != 0 {
+		dr.Check = persistence.READINESS_CHECK_TCP
+	} else if probe != nil && probe.HTTPPort != 0 {
+		dr.Check = persistence.READINESS_CHECK_HTTP
+	} else if health != "" {
+		dr.Check = persistence.READINESS_CHECK_HEALTHCHECK
+	}
+
+	var err error
+	if container.State != "running" {
+		err = errors.New(fmt.Sprintf("the container is %v", container.State))
+	} else if health != "" && health != CONTAINER_HEALTH_HEALTHY {
+		err = errors.New(fmt.Sprintf("the container is %v", health))
+	} else if dr.Check == persistence.READINESS_CHECK_TCP || dr.Check == persistence.READINESS_CHECK_HTTP {
+		err = probeReadiness(client, probe, container.ID)
+	}
+
+	if err == nil {
+		dr.Ready = true
+		return dr
+	}
+
+	dr.Message = err.Error()
+	timeoutS := defaultTimeoutS
+	if probe != nil && probe.TimeoutS != 0 {
+		timeoutS = probe.TimeoutS
+	}
+	dr.TimedOut = now-startTime >= int64(timeoutS)
+	return dr
+}
+
+// Update the readiness gate with the state of the dependency containers. The gate is open when all of them are ready,
+// and timed out when the others have not become ready within their timeout, counted from the start of the gate.
+func evaluateReadinessGate(gate *persistence.ReadinessGate, client containerruntime.ContainerRuntime, containers []docker.APIContainers, now int64, defaultTimeoutS int) {
+	gate.Dependencies = make([]persistence.DependencyReadiness, 0, len(containers))
+	gate.State = persistence.READINESS_GATE_OPEN
+	for _, container := range containers {
+		dr := checkDependencyReadiness(client, container, now, int64(gate.StartTime), defaultTimeoutS)
+		gate.Dependencies = append(gate.Dependencies, dr)
+		if dr.Ready {
+			continue
+		} else if !dr.TimedOut {
+			gate.State = persistence.READINESS_GATE_WAITING
+		} else if gate.State == persistence.READINESS_GATE_OPEN {
+			gate.State = persistence.READINESS_GATE_TIMED_OUT
+		}
+	}
+	gate.UpdateTime = uint64(now)
+}
+
+// Returns the dependency containers that are not ready, for the event log.
+func notReadyDependencies(gate *persistence.ReadinessGate) string {
+	notReady := make([]string, 0)
+	for _, dr := range gate.Dependencies {
+		if !dr.Ready {
+			notReady = append(notReady, fmt.Sprintf("%v (%v)", dr.Container, dr.Message))
+		}
+	}
+	return strings.Join(notReady, ", ")
+}
+
+// The evaluations of readiness gates that probe the dependency containers. The probes run in the background so that
+// they do not hold up the other commands of the container worker. A nil gate means that the probes are still running.
+type readinessTracker struct {
+	lock  sync.Mutex
+	gates map[string]*persistence.ReadinessGate // by instance id
+}
+
+func newReadinessTracker() *readinessTracker {
+	return &readinessTracker{
+		gates: make(map[string]*persistence.ReadinessGate),
+	}
+}
+
+func (r *readinessTracker) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return fmt.Sprintf("Readiness evaluations: %v", r.gates)
+}
+
+// Returns the gate evaluated in the background for the instance and forgets it. The second return value is false when
+// there is no evaluation for the instance, and the gate is nil when the evaluation is still running.
+func (r *readinessTracker) take(instanceId string) (*persistence.ReadinessGate, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	gate, ok := r.gates[instanceId]
+	if ok && gate != nil {
+		delete(r.gates, instanceId)
+	}
+	return gate, ok
+}
+
+// Evaluate a copy of the gate in the background.
+func (r *readinessTracker) start(gate persistence.ReadinessGate, evaluate func(gate *persistence.ReadinessGate)) {
+	r.lock.Lock()
+	r.gates[gate.InstanceId] = nil
+	r.lock.Unlock()
+
+	go func() {
+		evaluate(&gate)
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		// the evaluation is dropped if the instance was shut down in the meantime
+		if _, ok := r.gates[gate.InstanceId]; ok {
+			r.gates[gate.InstanceId] = &gate
+		}
+	}()
+}
+
+// Forget the evaluation of the instance.
+func (r *readinessTracker) remove(instanceId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.gates, instanceId)
+}
+
+// Returns true if any of the containers has a readiness probe, which takes a while to run.
+func hasReadinessProbe(containers []docker.APIContainers) bool {
+	for _, container := range containers {
+		if getReadinessProbe(&container) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the readiness gate of a service instance, which holds the service back until the containers of the services
+// it depends on are ready. When any of them has a readiness probe, the gate is evaluated in the background and the
+// result is used by the next check, so the service waits at least one more check. The state of the gate is saved so
+// that it is shown with the service, and the changes of the state are logged with the input function. Returns true
+// when the service can start.
+func (b *ContainerWorker) readinessGateOpen(instanceId string, svc *persistence.ServiceInstancePathElement, containers []docker.APIContainers, logEvent func(severity string, meta *persistence.MessageMeta, eventCode string)) bool {
+
+	evaluated, found := b.readiness.take(instanceId)
+	if found && evaluated == nil {
+		glog.V(5).Infof("Readiness gate of %v is being evaluated", instanceId)
+		return false
+	}
+
+	gate, err := persistence.FindReadinessGate(b.db, instanceId)
+	if err != nil {
+		glog.Errorf("Unable to read the readiness gate of %v, error: %v", instanceId, err)
+	}
+	prevState := ""
+	if gate != nil && !gate.IsOpen() {
+		prevState = gate.State
+	} else {
+		// A gate that was opened before is left over from an earlier start of the service, the wait starts again.
+		gate = persistence.NewReadinessGate(instanceId, svc.URL, svc.Org, svc.Version)
+	}
+
+	if evaluated != nil {
+		// the evaluation started from the gate, so it has the start of the wait
+		gate = evaluated
+	} else if hasReadinessProbe(containers) {
+		b.readiness.start(*gate, func(g *persistence.ReadinessGate) {
+			evaluateReadinessGate(g, b.client, containers, time.Now().Unix(), b.Config.Edge.DependencyReadyTimeoutS)
+		})
+		return false
+	} else {
+		evaluateReadinessGate(gate, b.client, containers, time.Now().Unix(), b.Config.Edge.DependencyReadyTimeoutS)
+	}
+
+	if err := persistence.SaveReadinessGate(b.db, gate); err != nil {
+		glog.Errorf("Unable to save the readiness gate %v, error: %v", gate, err)
+	}
+
+	if gate.State != prevState {
+		serviceName := cutil.FormOrgSpecUrl(svc.URL, svc.Org)
+		switch gate.State {
+		case persistence.READINESS_GATE_WAITING:
+			logEvent(persistence.SEVERITY_INFO,
+				persistence.NewMessageMeta(EL_CONT_WAITING_FOR_DEPENDENCIES, serviceName, notReadyDependencies(gate)),
+				persistence.EC_WAITING_FOR_DEPENDENCIES)
+		case persistence.READINESS_GATE_OPEN:
+			if prevState != "" {
+				logEvent(persistence.SEVERITY_INFO,
+					persistence.NewMessageMeta(EL_CONT_DEPENDENCIES_READY, serviceName),
+					persistence.EC_DEPENDENCIES_READY)
+			}
+		case persistence.READINESS_GATE_TIMED_OUT:
+			logEvent(persistence.SEVERITY_WARN,
+				persistence.NewMessageMeta(EL_CONT_DEPENDENCIES_READY_TIMEOUT, serviceName, notReadyDependencies(gate)),
+				persistence.EC_DEPENDENCIES_READY_TIMEOUT)
+		}
+	}
+
+	glog.V(5).Infof("Readiness gate of %v: %v", instanceId, gate)
+	return gate.IsOpen()
+}
+
+// Remove the readiness gates of the service instances that are shut down.
+func (b *ContainerWorker) deleteReadinessGates(instanceIds []string) {
+	for _, instanceId := range instanceIds {
+		b.readiness.remove(instanceId)
+		if err := persistence.DeleteReadinessGate(b.db, instanceId); err != nil {
+			glog.Errorf("Unable to delete the readiness gate of %v, error: %v", instanceId, err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// +build unit
+
+package container
+
+import (
+	"errors"
+	"github.com/boltdb/bolt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func readinessTestContainer(name string, status string, probe string, created int64) docker.APIContainers {
+	c := docker.APIContainers{
+		ID:      name,
+		Names:   []string{"/" + name},
+		State:   "running",
+		Status:  status,
+		Created: created,
+		Labels:  map[string]string{LABEL_PREFIX + ".agreement_id": "ms1"},
+	}
+	if probe != "" {
+		c.Labels[READINESS_PROBE_LABEL] = probe
+	}
+	return c
+}
+
+func Test_checkDependencyReadiness(t *testing.T) {
+	execProbe := probeReadiness
+	defer func() { probeReadiness = execProbe }()
+	probed := ""
+	probeReadiness = func(client containerruntime.ContainerRuntime, probe *containermessage.ReadinessProbe, containerId string) error {
+		probed = containerId
+		if probe.HTTPPath == "/ready" {
+			return nil
+		}
+		return errors.New("connection refused")
+	}
+
+	// a container without a healthcheck or a probe is ready when it is running
+	dr := checkDependencyReadiness(nil, readinessTestContainer("plain", "Up 5 seconds", "", 100), 105, 100, 60)
+	if !dr.Ready || dr.Check != persistence.READINESS_CHECK_RUNNING || dr.Container != "plain" {
+		t.Errorf("expected the running container to be ready, got %v", dr)
+	}
+
+	// a container is not ready until its healthcheck reports healthy
+	dr = checkDependencyReadiness(nil, readinessTestContainer("db", "Up 5 seconds (health: starting)", "", 100), 105, 100, 60)
+	if dr.Ready || dr.TimedOut || dr.Check != persistence.READINESS_CHECK_HEALTHCHECK {
+		t.Errorf("expected the starting container not to be ready, got %v", dr)
+	}
+	dr = checkDependencyReadiness(nil, readinessTestContainer("db", "Up 5 seconds (healthy)", "", 100), 105, 100, 60)
+	if !dr.Ready {
+		t.Errorf("expected the healthy container to be ready, got %v", dr)
+	}
+
+	// the probe is run in the container
+	dr = checkDependencyReadiness(nil, readinessTestContainer("web", "Up 5 seconds", `{"http_port":8080,"http_path":"/ready"}`, 100), 105, 100, 60)
+	if !dr.Ready || dr.Check != persistence.READINESS_CHECK_HTTP || probed != "web" {
+		t.Errorf("expected the probed container to be ready, got %v probed at %v", dr, probed)
+	}
+
+	// the timeout of the probe overrides the default
+	dr = checkDependencyReadiness(nil, readinessTestContainer("mq", "Up 5 seconds", `{"tcp_port":5672,"timeout":10}`, 100), 105, 100, 60)
+	if dr.Ready || dr.TimedOut || dr.Check != persistence.READINESS_CHECK_TCP || dr.Message == "" {
+		t.Errorf("expected the container not to be ready, got %v", dr)
+	}
+	dr = checkDependencyReadiness(nil, readinessTestContainer("mq", "Up 15 seconds", `{"tcp_port":5672,"timeout":10}`, 100), 110, 100, 60)
+	if dr.Ready || !dr.TimedOut {
+		t.Errorf("expected the container to have timed out, got %v", dr)
+	}
+
+	// the timeout counts from the start of the wait, not from the creation of a long running container
+	dr = checkDependencyReadiness(nil, readinessTestContainer("mq", "Up 2 hours", `{"tcp_port":5672,"timeout":10}`, 0), 105, 100, 60)
+	if dr.Ready || dr.TimedOut {
+		t.Errorf("expected the container not to have timed out, got %v", dr)
+	}
+}
+
+func Test_evaluateReadinessGate(t *testing.T) {
+	execProbe := probeReadiness
+	defer func() { probeReadiness = execProbe }()
+	probeReadiness = func(client containerruntime.ContainerRuntime, probe *containermessage.ReadinessProbe, containerId string) error {
+		return errors.New("connection refused")
+	}
+
+	gate := persistence.NewReadinessGate("ag1", "http://mycompany.com/web", "mycompany", "1.0.0")
+	gate.StartTime = 100
+	ready := readinessTestContainer("ready", "Up 5 seconds (healthy)", "", 100)
+	starting := readinessTestContainer("starting", "Up 5 seconds (health: starting)", "", 100)
+	probed := readinessTestContainer("probed", "Up 5 seconds", `{"tcp_port":5672,"timeout":30}`, 100)
+
+	evaluateReadinessGate(gate, nil, []docker.APIContainers{ready, starting, probed}, 110, 60)
+	if gate.State != persistence.READINESS_GATE_WAITING || gate.IsOpen() || len(gate.Dependencies) != 3 {
+		t.Errorf("expected the gate to be waiting, got %v", gate)
+	}
+
+	// the probed container timed out, the healthcheck is still starting
+	evaluateReadinessGate(gate, nil, []docker.APIContainers{ready, starting, probed}, 140, 60)
+	if gate.State != persistence.READINESS_GATE_WAITING {
+		t.Errorf("expected the gate to be waiting, got %v", gate)
+	}
+
+	// both timed out
+	evaluateReadinessGate(gate, nil, []docker.APIContainers{ready, starting, probed}, 160, 60)
+	if gate.State != persistence.READINESS_GATE_TIMED_OUT || !gate.IsOpen() {
+		t.Errorf("expected the gate to have timed out, got %v", gate)
+	}
+
+	starting.Status = "Up 5 seconds (healthy)"
+	evaluateReadinessGate(gate, nil, []docker.APIContainers{ready, starting}, 160, 60)
+	if gate.State != persistence.READINESS_GATE_OPEN || gate.UpdateTime != 160 {
+		t.Errorf("expected the gate to be open, got %v", gate)
+	}
+}
+
+func Test_probeReadiness(t *testing.T) {
+	client := containerruntime.NewFakeRuntime()
+	if err := client.PullImage(docker.PullImageOptions{Repository: "mq", Tag: "1.0.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatalf("unexpected pull error %v", err)
+	}
+	c, err := client.CreateContainer(docker.CreateContainerOptions{Name: "ms1-mq", Config: &docker.Config{Image: "mq:1.0.0"}})
+	if err != nil {
+		t.Fatalf("unexpected error creating container %v", err)
+	}
+	probe := &containermessage.ReadinessProbe{TCPPort: 5672}
+
+	if err := probeReadiness(client, probe, c.ID); err == nil {
+		t.Errorf("expected an error probing the stopped container")
+	} else if err := client.StartContainer(c.ID, nil); err != nil {
+		t.Fatalf("unexpected error starting container %v", err)
+	}
+
+	if err := probeReadiness(client, probe, c.ID); err != nil {
+		t.Errorf("expected the probe to succeed, got %v", err)
+	}
+	client.ExecExitCode = 1
+	if err := probeReadiness(client, probe, c.ID); err == nil {
+		t.Errorf("expected the probe to fail")
+	}
+	client.ExecExitCode = READINESS_PROBE_NO_TOOLS
+	if err := probeReadiness(client, probe, c.ID); err == nil {
+		t.Errorf("expected the probe to fail without the tools")
+	}
+}
+
+func Test_readinessGateOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "container-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "anax-ut.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error opening db %v", err)
+	}
+	defer db.Close()
+
+	client := containerruntime.NewFakeRuntime()
+	client.ExecExitCode = 1
+	if err := client.PullImage(docker.PullImageOptions{Repository: "mq", Tag: "1.0.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatalf("unexpected pull error %v", err)
+	}
+	c, err := client.CreateContainer(docker.CreateContainerOptions{
+		Name: "ms1-mq",
+		Config: &docker.Config{
+			Image:  "mq:1.0.0",
+			Labels: map[string]string{READINESS_PROBE_LABEL: `{"tcp_port":5672}`},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating container %v", err)
+	} else if err := client.StartContainer(c.ID, nil); err != nil {
+		t.Fatalf("unexpected error starting container %v", err)
+	}
+	containers, _ := client.ListContainers(docker.ListContainersOptions{})
+
+	b := &ContainerWorker{db: db, client: client, readiness: newReadinessTracker()}
+	b.Config = &config.HorizonConfig{Edge: config.Config{DependencyReadyTimeoutS: 60}}
+	svc := persistence.NewServiceInstancePathElement("http://mycompany.com/web", "mycompany", "1.0.0")
+	events := make([]string, 0)
+	logEvent := func(severity string, meta *persistence.MessageMeta, eventCode string) {
+		events = append(events, eventCode)
+	}
+
+	// waits for the evaluation of the gate in the background to finish
+	waitForEvaluation := func() {
+		for i := 0; i < 50; i++ {
+			b.readiness.lock.Lock()
+			gate := b.readiness.gates["ag1"]
+			b.readiness.lock.Unlock()
+			if gate != nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("the readiness gate was not evaluated")
+	}
+	if b.readinessGateOpen("ag1", svc, containers, logEvent) {
+		t.Errorf("expected the gate to wait for the probe")
+	}
+	waitForEvaluation()
+	if b.readinessGateOpen("ag1", svc, containers, logEvent) {
+		t.Errorf("expected the gate to wait for the container to be ready")
+	} else if gate, err := persistence.FindReadinessGate(db, "ag1"); err != nil || gate == nil || gate.State != persistence.READINESS_GATE_WAITING {
+		t.Errorf("expected the waiting gate to be saved, got %v %v", gate, err)
+	} else if len(events) != 1 || events[0] != persistence.EC_WAITING_FOR_DEPENDENCIES {
+		t.Errorf("expected the wait to be logged, got %v", events)
+	}
+
+	client.ExecExitCode = 0
+	if b.readinessGateOpen("ag1", svc, containers, logEvent) {
+		t.Errorf("expected the gate to wait for the probe")
+	}
+	waitForEvaluation()
+	if !b.readinessGateOpen("ag1", svc, containers, logEvent) {
+		t.Errorf("expected the gate to be open")
+	} else if len(events) != 2 || events[1] != persistence.EC_DEPENDENCIES_READY {
+		t.Errorf("expected the ready dependencies to be logged, got %v", events)
+	}
+
+	// the evaluation of a service instance that is shut down is dropped
+	if b.readinessGateOpen("ag1", svc, containers, logEvent) {
+		t.Errorf("expected the gate of the restarted service to wait for the probe")
+	}
+	b.deleteReadinessGates([]string{"ag1"})
+	time.Sleep(500 * time.Millisecond)
+	if _, found := b.readiness.take("ag1"); found {
+		t.Errorf("expected the evaluation to be dropped")
+	}
+}
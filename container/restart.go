@@ -0,0 +1,199 @@
+package container
+
+import (
+	"encoding/json"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/eventlog"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"strings"
+	"time"
+)
+
+// The label with the restart policy of a service container. The containers that have it are restarted by the agent
+// instead of by the container runtime.
+const RESTART_POLICY_LABEL = LABEL_PREFIX + ".restart_policy"
+
+// The name of the subworker that restarts the stopped containers, and how often it checks them.
+const CONTAINER_RESTART = "ContainerRestart"
+const RESTART_CHECK_INTERVAL_S = 10
+
+// A container that stays up this long after it was restarted has recovered, its restart count starts again from zero.
+const CONTAINER_RESTART_RESET_S = 600
+
+// The container states reported in the node status for the containers with a restart policy.
+const (
+	CONTAINER_STATE_RESTARTING = "restarting"
+	CONTAINER_STATE_CRASH_LOOP = "crash_loop"
+)
+
+// What to do with a stopped container that has a restart policy.
+const (
+	RESTART_ACTION_WAIT      = iota // the backoff has not passed yet
+	RESTART_ACTION_RESTART          // restart the container now
+	RESTART_ACTION_COMPLETED        // the container exited successfully and the policy does not restart it
+	RESTART_ACTION_EXHAUSTED        // the restarts of the policy are used up
+)
+
+// Returns the restart policy of the service container from its label, or nil if the service does not have one.
+func getRestartPolicy(container *docker.APIContainers) *containermessage.RestartPolicy {
+	label, ok := container.Labels[RESTART_POLICY_LABEL]
+	if !ok {
+		return nil
+	}
+	rp := new(containermessage.RestartPolicy)
+	if err := json.Unmarshal([]byte(label), rp); err != nil {
+		glog.Warningf("Unable to read the restart policy %v of container %v: %v", label, container.Names, err)
+		return nil
+	}
+	return rp
+}
+
+// Decide what to do with a stopped container from its restart policy, the restarts it has had so far and the state
+// the container runtime reports for it. The backoff counts from when the container stopped.
+func restartAction(rp *containermessage.RestartPolicy, restarts int, state docker.State, now time.Time) int {
+	if !rp.RestartOnExit(state.ExitCode) && rp.Policy != containermessage.RESTART_POLICY_NEVER {
+		return RESTART_ACTION_COMPLETED
+	} else if rp.Exhausted(restarts) {
+		return RESTART_ACTION_EXHAUSTED
+	} else if now.Before(state.FinishedAt.Add(time.Duration(rp.Backoff(restarts)) * time.Second)) {
+		return RESTART_ACTION_WAIT
+	}
+	return RESTART_ACTION_RESTART
+}
+
+// Returns true if the stopped container is left to the restart policy, so that the agreement or the service instance
+// it belongs to is kept. A container whose restarts are used up is not.
+func (b *ContainerWorker) restartPending(container *docker.APIContainers) bool {
+	rp := getRestartPolicy(container)
+	if rp == nil || rp.Policy == containermessage.RESTART_POLICY_NEVER {
+		return false
+	} else if restart, err := persistence.FindContainerRestart(b.db, container.ID); err != nil {
+		glog.Errorf("Unable to read the restart record of container %v, error: %v", container.Names, err)
+	} else if restart != nil && restart.CrashLoop {
+		return false
+	}
+	return true
+}
+
+// Log an event for the agreement or the service instance that the container belongs to.
+func (b *ContainerWorker) logContainerEvent(container *docker.APIContainers, severity string, meta *persistence.MessageMeta, eventCode string) {
+	instanceId := container.Labels[LABEL_PREFIX+".agreement_id"]
+	if ags, err := persistence.FindEstablishedAgreementsAllProtocols(b.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(instanceId)}); err == nil && len(ags) == 1 {
+		eventlog.LogAgreementEvent(b.db, severity, meta, eventCode, ags[0])
+	} else if msi, err := persistence.FindMicroserviceInstanceWithKey(b.db, instanceId); err == nil && msi != nil {
+		eventlog.LogServiceEvent(b.db, severity, meta, eventCode, *msi)
+	} else {
+		eventlog.LogServiceEvent2(b.db, severity, meta, eventCode, instanceId, "", "", "", "", []string{})
+	}
+}
+
+// The subworker function that restarts the stopped containers. It runs apart from the commands of the worker, so the
+// restarts are not held up while the worker is busy.
+func (b *ContainerWorker) checkRestarts() int {
+	b.restartStoppedContainers(time.Now())
+	return 0
+}
+
+// Restart the stopped containers that have a restart policy once their backoff has passed, and mark the ones whose
+// restarts are used up as being in a crash loop. The maintenance commands treat those as failed. The restart
+// records of the containers that no longer exist are removed.
+func (b *ContainerWorker) restartStoppedContainers(now time.Time) {
+
+	containers, err := b.client.ListContainers(docker.ListContainersOptions{All: true, Filters: map[string][]string{"label": []string{RESTART_POLICY_LABEL}}})
+	if err != nil {
+		glog.Errorf("Unable to get the list of containers with a restart policy: %v", err)
+		return
+	}
+
+	restarts := make(map[string]*persistence.ContainerRestart)
+	if records, err := persistence.FindContainerRestarts(b.db); err != nil {
+		glog.Errorf("Unable to read the container restart records, error: %v", err)
+		return
+	} else {
+		for ix := range records {
+			restarts[records[ix].ContainerId] = &records[ix]
+		}
+	}
+
+	for ix := range containers {
+		container := &containers[ix]
+		restart := restarts[container.ID]
+		delete(restarts, container.ID)
+
+		rp := getRestartPolicy(container)
+		if rp == nil || rp.Policy == containermessage.RESTART_POLICY_NEVER {
+			continue
+		}
+
+		name := container.ID
+		if len(container.Names) != 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		serviceName := container.Labels[LABEL_PREFIX+".service_name"]
+
+		if container.State == "running" {
+			if restart != nil && !restart.CrashLoop && now.Unix()-int64(restart.LastRestart) >= CONTAINER_RESTART_RESET_S {
+				glog.V(3).Infof("Container %v has been up since its last restart, resetting its restart count.", name)
+				if err := persistence.DeleteContainerRestart(b.db, container.ID); err != nil {
+					glog.Errorf("Unable to delete the restart record of container %v, error: %v", name, err)
+				}
+			}
+			continue
+		} else if restart != nil && (restart.CrashLoop || restart.Completed) {
+			continue
+		}
+
+		c, err := b.client.InspectContainer(container.ID)
+		if err != nil {
+			glog.Errorf("Unable to inspect the stopped container %v: %v", name, err)
+			continue
+		}
+
+		if restart == nil {
+			restart = persistence.NewContainerRestart(container.ID, name, container.Labels[LABEL_PREFIX+".agreement_id"])
+		}
+		restart.LastExitCode = c.State.ExitCode
+
+		switch restartAction(rp, restart.Restarts, c.State, now) {
+		case RESTART_ACTION_WAIT:
+			continue
+
+		case RESTART_ACTION_COMPLETED:
+			glog.V(3).Infof("Container %v exited with code %v, it is not restarted with the %v policy.", name, c.State.ExitCode, rp.Policy)
+			restart.Completed = true
+
+		case RESTART_ACTION_EXHAUSTED:
+			glog.Errorf("Container %v exited with code %v after %v restarts, it is in a crash loop.", name, c.State.ExitCode, restart.Restarts)
+			restart.CrashLoop = true
+			b.logContainerEvent(container, persistence.SEVERITY_ERROR,
+				persistence.NewMessageMeta(EL_CONT_SERVICE_CRASH_LOOP, serviceName, name, c.State.ExitCode, restart.Restarts),
+				persistence.EC_SERVICE_CRASH_LOOP)
+
+		case RESTART_ACTION_RESTART:
+			glog.Infof("Restarting container %v, it exited with code %v.", name, c.State.ExitCode)
+			restart.Restarts += 1
+			restart.LastRestart = uint64(now.Unix())
+			if err := b.client.StartContainer(container.ID, nil); err != nil {
+				glog.Errorf("Unable to restart container %v: %v", name, err)
+			} else {
+				b.logContainerEvent(container, persistence.SEVERITY_WARN,
+					persistence.NewMessageMeta(EL_CONT_CONTAINER_RESTARTED, name, serviceName, c.State.ExitCode, restart.Restarts),
+					persistence.EC_CONTAINER_RESTARTED)
+			}
+		}
+
+		if err := persistence.SaveContainerRestart(b.db, restart); err != nil {
+			glog.Errorf("Unable to save the restart record %v, error: %v", restart, err)
+		}
+	}
+
+	// The containers of the remaining records have been removed.
+	for containerId := range restarts {
+		if err := persistence.DeleteContainerRestart(b.db, containerId); err != nil {
+			glog.Errorf("Unable to delete the restart record of container %v, error: %v", containerId, err)
+		}
+	}
+}
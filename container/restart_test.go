@@ -0,0 +1,118 @@
+// +build unit
+
+package container
+
+import (
+	"github.com/boltdb/bolt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_restartAction(t *testing.T) {
+	now := time.Now()
+	failed := docker.State{Status: "exited", ExitCode: 1, FinishedAt: now.Add(-15 * time.Second)}
+	succeeded := docker.State{Status: "exited", ExitCode: 0, FinishedAt: now.Add(-15 * time.Second)}
+
+	onFailure := &containermessage.RestartPolicy{Policy: containermessage.RESTART_POLICY_ON_FAILURE, MaxRestarts: 3, BackoffS: 10}
+	always := &containermessage.RestartPolicy{Policy: containermessage.RESTART_POLICY_ALWAYS}
+	never := &containermessage.RestartPolicy{Policy: containermessage.RESTART_POLICY_NEVER}
+
+	tests := []struct {
+		name     string
+		rp       *containermessage.RestartPolicy
+		restarts int
+		state    docker.State
+		expected int
+	}{
+		{"first failure", onFailure, 0, failed, RESTART_ACTION_RESTART},
+		{"backoff doubled", onFailure, 1, failed, RESTART_ACTION_WAIT},
+		{"restarts used up", onFailure, 3, failed, RESTART_ACTION_EXHAUSTED},
+		{"successful exit", onFailure, 0, succeeded, RESTART_ACTION_COMPLETED},
+		{"always restarts successful exit", always, 5, succeeded, RESTART_ACTION_WAIT},
+		{"never", never, 0, failed, RESTART_ACTION_EXHAUSTED},
+	}
+	for _, test := range tests {
+		if action := restartAction(test.rp, test.restarts, test.state, now); action != test.expected {
+			t.Errorf("%v: expected action %v, got %v", test.name, test.expected, action)
+		}
+	}
+}
+
+func Test_restartStoppedContainers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "container-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "anax-ut.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error opening db %v", err)
+	}
+	defer db.Close()
+
+	client := containerruntime.NewFakeRuntime()
+	if err := client.PullImage(docker.PullImageOptions{Repository: "svc", Tag: "1.0.0"}, docker.AuthConfiguration{}); err != nil {
+		t.Fatalf("unexpected pull error %v", err)
+	}
+	c, err := client.CreateContainer(docker.CreateContainerOptions{
+		Name: "ms1-svc",
+		Config: &docker.Config{
+			Image: "svc:1.0.0",
+			Labels: map[string]string{
+				LABEL_PREFIX + ".service_name": "svc",
+				LABEL_PREFIX + ".agreement_id": "ms1",
+				RESTART_POLICY_LABEL:           `{"policy":"on-failure","max_restarts":1,"backoff":5}`,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating container %v", err)
+	} else if err := client.StartContainer(c.ID, nil); err != nil {
+		t.Fatalf("unexpected error starting container %v", err)
+	}
+
+	b := &ContainerWorker{db: db, client: client}
+
+	// The container failed, it is left to its restart policy and restarted after the backoff.
+	client.KillContainer(docker.KillContainerOptions{ID: c.ID})
+	containers, _ := client.ListContainers(docker.ListContainersOptions{All: true})
+	container := &containers[0]
+	if !b.restartPending(container) {
+		t.Errorf("stopped container %v should be left to its restart policy", container.Names)
+	}
+	b.restartStoppedContainers(time.Now())
+	if inspected, _ := client.InspectContainer(c.ID); inspected.State.Running {
+		t.Errorf("container %v should not be restarted before the backoff", c.Name)
+	}
+	b.restartStoppedContainers(time.Now().Add(10 * time.Second))
+	if inspected, _ := client.InspectContainer(c.ID); !inspected.State.Running {
+		t.Errorf("container %v should have been restarted", c.Name)
+	} else if restart, err := persistence.FindContainerRestart(db, c.ID); err != nil || restart == nil || restart.Restarts != 1 || restart.LastExitCode != 137 {
+		t.Errorf("wrong restart record %v %v", restart, err)
+	}
+
+	// The container fails again, its restarts are used up so it is in a crash loop and no longer pending.
+	client.KillContainer(docker.KillContainerOptions{ID: c.ID})
+	b.restartStoppedContainers(time.Now().Add(time.Hour))
+	if inspected, _ := client.InspectContainer(c.ID); inspected.State.Running {
+		t.Errorf("container %v should not be restarted after its restarts are used up", c.Name)
+	} else if restart, err := persistence.FindContainerRestart(db, c.ID); err != nil || restart == nil || !restart.CrashLoop {
+		t.Errorf("container %v should be in a crash loop, restart record %v %v", c.Name, restart, err)
+	} else if b.restartPending(container) {
+		t.Errorf("container %v in a crash loop should not be pending a restart", c.Name)
+	}
+
+	// The restart record is removed with the container.
+	client.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID})
+	b.restartStoppedContainers(time.Now())
+	if restarts, err := persistence.FindContainerRestarts(db); err != nil || len(restarts) != 0 {
+		t.Errorf("restart record should have been removed, got %v %v", restarts, err)
+	}
+}
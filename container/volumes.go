@@ -0,0 +1,84 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+)
+
+// Set the service that uses the volume and the volume options from the deployment description on the volume record.
+func setContainerVolumeOptions(cv *persistence.ContainerVolume, serviceName string, instanceId string, options *containermessage.VolumeOptions) {
+	cv.ServiceName = serviceName
+	cv.InstanceId = instanceId
+	cv.Lifecycle = options.GetLifecycle()
+	cv.Driver = options.GetDriver()
+	cv.Size = options.Size
+}
+
+// A volume created by anax for an earlier agreement or service instance is used again. Its record is moved to the new
+// one, so that the volume is deleted with it if that is its lifecycle, and takes the lifecycle of the new deployment
+// description. The volumes that were not created by anax have no record and are left alone.
+func (b *ContainerWorker) updateContainerVolume(name string, serviceName string, instanceId string, options *containermessage.VolumeOptions) error {
+	cvs, err := persistence.FindContainerVolumes(b.db, []persistence.ContainerVolumeFilter{persistence.UnarchivedCVFilter(), persistence.NameCVFilter(name)})
+	if err != nil {
+		return fmt.Errorf("Error retrieving the docker volume %v from the local db. %v", name, err)
+	}
+	for _, cv := range cvs {
+		if (cv.Driver != "" && cv.Driver != options.GetDriver()) || cv.Size != options.Size {
+			glog.Warningf("Docker volume %v keeps its driver %v and size %v, they are only set when the volume is created.", name, cv.Driver, cv.Size)
+		}
+		driver, size := cv.Driver, cv.Size
+		setContainerVolumeOptions(&cv, serviceName, instanceId, options)
+		cv.Driver, cv.Size = driver, size
+		if err := persistence.SaveContainerVolume(b.db, &cv); err != nil {
+			return fmt.Errorf("Failed to save the docker volume %v into the local db. %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Remove a docker volume created by anax and archive its record. A volume that no longer exists is only archived.
+func removeContainerVolume(client containerruntime.ContainerRuntime, db *bolt.DB, cv *persistence.ContainerVolume) error {
+	if err := client.RemoveVolume(cv.Name); err != nil && err != docker.ErrNoSuchVolume {
+		return err
+	} else if err := persistence.ArchiveContainerVolumes(db, cv); err != nil {
+		return err
+	}
+	glog.V(3).Infof("Docker volume %v is removed.", cv.Name)
+	return nil
+}
+
+// Remove the volumes with the delete lifecycle that were last used by the given agreements or service instances.
+func (b *ContainerWorker) deleteServiceVolumes(agreements []string) {
+	for _, agreementId := range agreements {
+		cvs, err := persistence.FindContainerVolumes(b.db, []persistence.ContainerVolumeFilter{persistence.UnarchivedCVFilter(), persistence.InstanceCVFilter(agreementId), persistence.LifecycleCVFilter(persistence.CV_LIFECYCLE_DELETE)})
+		if err != nil {
+			glog.Errorf("Error retrieving the docker volumes of %v from the local db. %v", agreementId, err)
+			continue
+		}
+		for _, cv := range cvs {
+			if err := removeContainerVolume(b.client, b.db, &cv); err != nil {
+				glog.Errorf("Failed to delete docker volume %v of %v. %v", cv.Name, agreementId, err)
+			}
+		}
+	}
+}
+
+// Delete a docker volume created by anax, whatever its lifecycle. The volume must not be in use.
+func DeleteContainerVolume(db *bolt.DB, config *config.HorizonConfig, cv *persistence.ContainerVolume) error {
+	if config.Edge.DockerEndpoint == "" {
+		return errors.New("Docker client cannot be initialized. Please make sure DockerEndpoint is set in the configuration file.")
+	}
+
+	if client, err := containerruntime.NewAgentContainerRuntime(config); err != nil {
+		return fmt.Errorf("Failed to instantiate %v client: %v", config.GetContainerRuntime(), err)
+	} else {
+		return removeContainerVolume(client, db, cv)
+	}
+}
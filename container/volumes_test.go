@@ -0,0 +1,94 @@
+// +build unit
+
+package container
+
+import (
+	"github.com/boltdb/bolt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/worker"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func volumeTestServicePair(binds []string, volumes map[string]containermessage.VolumeOptions) *servicePair {
+	return &servicePair{
+		service:       &containermessage.Service{Binds: binds, Volumes: volumes},
+		serviceConfig: &persistence.ServiceConfig{HostConfig: docker.HostConfig{Binds: binds}},
+	}
+}
+
+func Test_serviceVolumeLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "container-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(path.Join(dir, "anax-ut.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error opening db %v", err)
+	}
+	defer db.Close()
+
+	client := containerruntime.NewFakeRuntime()
+	b := &ContainerWorker{
+		BaseWorker: worker.NewBaseWorker("test", &config.HorizonConfig{}, nil),
+		db:         db,
+		client:     client,
+	}
+
+	volumes := map[string]containermessage.VolumeOptions{
+		"scratch": containermessage.VolumeOptions{Lifecycle: containermessage.VOLUME_LIFECYCLE_DELETE},
+		"keep":    containermessage.VolumeOptions{Lifecycle: containermessage.VOLUME_LIFECYCLE_RETAIN_ON_UNREGISTER, Driver: "mydriver", Size: "1G"},
+	}
+	pair := volumeTestServicePair([]string{"scratch:/tmp/scratch", "keep:/data", "data:/olddata", "/host/dir:/dir"}, volumes)
+	if err := b.createDockerVolumesForContainer("svc", "ag1", pair); err != nil {
+		t.Fatalf("unexpected error creating volumes %v", err)
+	}
+
+	if vols, _ := client.ListVolumes(docker.ListVolumesOptions{}); len(vols) != 3 {
+		t.Errorf("expected 3 volumes, got %v", vols)
+	} else {
+		for _, v := range vols {
+			if v.Name == "keep" && (v.Driver != "mydriver" || v.Options["size"] != "1G") {
+				t.Errorf("volume keep should have the driver and size quota, got %v", v)
+			} else if v.Name == "data" && (v.Driver != containermessage.DEFAULT_VOLUME_DRIVER || v.Labels[LABEL_PREFIX+".lifecycle"] != containermessage.VOLUME_LIFECYCLE_RETAIN_ON_UPGRADE) {
+				t.Errorf("volume data should have the default options, got %v", v)
+			}
+		}
+	}
+
+	// The volumes are used again by a new agreement, their records move to it.
+	if err := b.createDockerVolumesForContainer("svc", "ag2", pair); err != nil {
+		t.Fatalf("unexpected error creating volumes %v", err)
+	} else if cvs, _ := persistence.FindContainerVolumes(db, []persistence.ContainerVolumeFilter{persistence.InstanceCVFilter("ag2")}); len(cvs) != 3 {
+		t.Errorf("expected 3 volume records for ag2, got %v", cvs)
+	}
+
+	// Only the volume with the delete lifecycle is removed with the agreement.
+	b.deleteServiceVolumes([]string{"ag1"})
+	if vols, _ := client.ListVolumes(docker.ListVolumesOptions{}); len(vols) != 3 {
+		t.Errorf("no volume should be removed with ag1, got %v", vols)
+	}
+	b.deleteServiceVolumes([]string{"ag2"})
+	if vols, _ := client.ListVolumes(docker.ListVolumesOptions{}); len(vols) != 2 {
+		t.Errorf("volume scratch should be removed with ag2, got %v", vols)
+	} else if cvs, _ := persistence.FindAllUndeletedContainerVolumes(db); len(cvs) != 2 {
+		t.Errorf("expected 2 volume records, got %v", cvs)
+	}
+
+	// A volume of any lifecycle can be removed explicitly.
+	if cvs, _ := persistence.FindContainerVolumes(db, []persistence.ContainerVolumeFilter{persistence.NameCVFilter("keep")}); len(cvs) != 1 || cvs[0].GetLifecycle() != persistence.CV_LIFECYCLE_RETAIN_ON_UNREGISTER {
+		t.Errorf("wrong volume record for keep %v", cvs)
+	} else if err := removeContainerVolume(client, db, &cvs[0]); err != nil {
+		t.Errorf("unexpected error removing volume keep %v", err)
+	} else if cvs, _ := persistence.FindAllUndeletedContainerVolumes(db); len(cvs) != 1 || cvs[0].Name != "data" {
+		t.Errorf("only volume data should be left, got %v", cvs)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	docker "github.com/fsouza/go-dockerclient"
 	"reflect"
+	"regexp"
 	"strings"
+	"time"
 )
 
 /*
@@ -35,7 +37,10 @@ import (
  *           "HostPort":"5200:6414/tcp",
  *           "HostIP": "0.0.0.0"
  *         }
- *       ]
+ *       ],
+ *       "cpus": 0.5,
+ *       "memory": 128,
+ *       "pids_limit": 100
  *     },
  *     "service_b": {
  *       "image": "...",
@@ -112,6 +117,27 @@ func (d DeploymentDescription) ServiceNames() []string {
 	return names
 }
 
+// Returns the largest number of CPUs requested by any one service and the sum of the memory (in MB) requested
+// by all services in the deployment. Services that do not specify a limit do not contribute to the result.
+func (d DeploymentDescription) ResourceRequirements() (float64, int64) {
+	cpus := float64(0)
+	mem := int64(0)
+	for _, service := range d.Services {
+		if service == nil {
+			continue
+		}
+		if service.Cpus > cpus {
+			cpus = service.Cpus
+		}
+		if service.Memory > 0 {
+			mem += service.Memory
+		} else if service.MemoryReservation > 0 {
+			mem += service.MemoryReservation
+		}
+	}
+	return cpus, mem
+}
+
 type Pattern struct {
 	Shared map[string][]string `json:"shared"`
 }
@@ -137,20 +163,78 @@ func (p *Pattern) IsShared(tp string, serviceName string) bool {
 
 // Service Only those marked "omitempty" may be omitted
 type Service struct {
-	Image            string               `json:"image"`
-	VariationLabel   string               `json:"variation_label,omitempty"`
-	Privileged       bool                 `json:"privileged"`
-	Network          string               `json:"network"`
-	Environment      []string             `json:"environment,omitempty"`
-	CapAdd           []string             `json:"cap_add,omitempty"`
-	Command          []string             `json:"command,omitempty"`
-	Devices          []string             `json:"devices,omitempty"`
-	NetworkIsolation *NetworkIsolation    `json:"network_isolation,omitempty"` // Changed to pointer so that the hzn dev CLI doesnt generate this struct into the deployment config skeleton
-	Binds            []string             `json:"binds,omitempty"`
-	Tmpfs            map[string]string    `json:"tmpfs,omitempty"`
-	Ports            []docker.PortBinding `json:"ports,omitempty"`
-	EphemeralPorts   []Port               `json:"ephemeral_ports,omitempty"`
-	SpecificPorts    []docker.PortBinding `json:"specific_ports,omitempty"` // obselete. for backward compatibility only, new way should use ports instead.
+	Image             string                   `json:"image"`
+	VariationLabel    string                   `json:"variation_label,omitempty"`
+	Privileged        bool                     `json:"privileged"`
+	Network           string                   `json:"network"`
+	Environment       []string                 `json:"environment,omitempty"`
+	CapAdd            []string                 `json:"cap_add,omitempty"`
+	Command           []string                 `json:"command,omitempty"`
+	Devices           []string                 `json:"devices,omitempty"`
+	NetworkIsolation  *NetworkIsolation        `json:"network_isolation,omitempty"` // Changed to pointer so that the hzn dev CLI doesnt generate this struct into the deployment config skeleton
+	Binds             []string                 `json:"binds,omitempty"`
+	Tmpfs             map[string]string        `json:"tmpfs,omitempty"`
+	Ports             []docker.PortBinding     `json:"ports,omitempty"`
+	EphemeralPorts    []Port                   `json:"ephemeral_ports,omitempty"`
+	SpecificPorts     []docker.PortBinding     `json:"specific_ports,omitempty"`     // obselete. for backward compatibility only, new way should use ports instead.
+	Cpus              float64                  `json:"cpus,omitempty"`               // number of CPUs the container may use, fractions are allowed
+	CpuShares         int64                    `json:"cpu_shares,omitempty"`         // relative CPU weight
+	Memory            int64                    `json:"memory,omitempty"`             // hard memory limit in MB
+	MemoryReservation int64                    `json:"memory_reservation,omitempty"` // soft memory limit in MB
+	PidsLimit         int64                    `json:"pids_limit,omitempty"`         // maximum number of processes, -1 for unlimited
+	Healthcheck       *Healthcheck             `json:"healthcheck,omitempty"`
+	Readiness         *ReadinessProbe          `json:"readiness,omitempty"`
+	RestartPolicy     *RestartPolicy           `json:"restart_policy,omitempty"`
+	Volumes           map[string]VolumeOptions `json:"volumes,omitempty"` // options of the named volumes in binds, by volume name
+}
+
+// Verify that the resource limits specified for the service are consistent with each other. When the service does not
+// specify a hard memory limit, the memory reservation is checked against the default memory limit (in MB) that will be
+// applied to the container instead. A default of zero means the default limit is not known.
+func (s *Service) ValidateResourceLimits(defaultMemory int64) error {
+	if s.Cpus < 0 {
+		return fmt.Errorf("cpus must not be negative: %v", s.Cpus)
+	} else if s.CpuShares < 0 {
+		return fmt.Errorf("cpu_shares must not be negative: %v", s.CpuShares)
+	} else if s.Memory < 0 {
+		return fmt.Errorf("memory must not be negative: %v", s.Memory)
+	} else if s.MemoryReservation < 0 {
+		return fmt.Errorf("memory_reservation must not be negative: %v", s.MemoryReservation)
+	} else if s.Memory != 0 && s.MemoryReservation > s.Memory {
+		return fmt.Errorf("memory_reservation %v must not be larger than memory %v", s.MemoryReservation, s.Memory)
+	} else if s.Memory == 0 && defaultMemory > 0 && s.MemoryReservation > defaultMemory {
+		return fmt.Errorf("memory_reservation %v must not be larger than the default memory limit %v", s.MemoryReservation, defaultMemory)
+	} else if s.PidsLimit < -1 {
+		return fmt.Errorf("pids_limit must be -1 (unlimited) or larger: %v", s.PidsLimit)
+	}
+	return nil
+}
+
+// Returns the hard memory limit of the service in bytes, or the input default if the service does not specify one.
+func (s *Service) GetMemoryBytes(defaultBytes int64) int64 {
+	if s.Memory > 0 {
+		return s.Memory * 1024 * 1024
+	}
+	return defaultBytes
+}
+
+// Verify the options of the named volumes of the service. Each of them must be a named volume in the binds.
+func (s *Service) ValidateVolumes() error {
+	for name, options := range s.Volumes {
+		found := false
+		for _, bind := range s.Binds {
+			if strings.HasPrefix(bind, name+":") && !strings.Contains(name, "/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("volume %v is not a named volume in binds", name)
+		} else if err := options.Validate(); err != nil {
+			return fmt.Errorf("volume %v: %v", name, err)
+		}
+	}
+	return nil
 }
 
 func (s *Service) AddFilesystemBinding(bind string) {
@@ -227,6 +311,213 @@ func (s *Service) AddSpecificPortBinding(b docker.PortBinding) {
 	s.Ports = append(s.Ports, b)
 }
 
+// The docker healthcheck for a service container. The test is in the same form as the docker HEALTHCHECK instruction,
+// for example ["CMD", "curl", "-f", "http://localhost"] or ["CMD-SHELL", "curl -f http://localhost || exit 1"].
+// The durations are in seconds, zero means use the docker default.
+type Healthcheck struct {
+	Test         []string `json:"test"`
+	IntervalS    int      `json:"interval,omitempty"`
+	TimeoutS     int      `json:"timeout,omitempty"`
+	Retries      int      `json:"retries,omitempty"`
+	StartPeriodS int      `json:"start_period,omitempty"`
+}
+
+func (h Healthcheck) String() string {
+	return fmt.Sprintf("Test: %v, Interval: %v, Timeout: %v, Retries: %v, StartPeriod: %v", h.Test, h.IntervalS, h.TimeoutS, h.Retries, h.StartPeriodS)
+}
+
+func (h *Healthcheck) Validate() error {
+	if len(h.Test) == 0 {
+		return errors.New("test must not be empty")
+	}
+	switch h.Test[0] {
+	case "NONE":
+	case "CMD", "CMD-SHELL":
+		if len(h.Test) < 2 {
+			return fmt.Errorf("test %v does not have a command", h.Test)
+		}
+	default:
+		return fmt.Errorf("test must start with NONE, CMD or CMD-SHELL: %v", h.Test)
+	}
+	if h.IntervalS < 0 || h.TimeoutS < 0 || h.Retries < 0 || h.StartPeriodS < 0 {
+		return fmt.Errorf("interval, timeout, retries and start_period must not be negative: %v", h)
+	}
+	return nil
+}
+
+// Convert the healthcheck into the form used by the docker API.
+func (h *Healthcheck) DockerHealthConfig() *docker.HealthConfig {
+	return &docker.HealthConfig{
+		Test:        h.Test,
+		Interval:    time.Duration(h.IntervalS) * time.Second,
+		Timeout:     time.Duration(h.TimeoutS) * time.Second,
+		Retries:     h.Retries,
+		StartPeriod: time.Duration(h.StartPeriodS) * time.Second,
+	}
+}
+
+// How the services that depend on a service check that it is ready before they start. The probe connects to a port of
+// the service container, or gets a path from it over HTTP, on the network of the dependent services. A service
+// without a probe is ready when its healthcheck reports healthy, or when it is running if it has no healthcheck.
+// The timeout is in seconds, after it the dependent services start anyway. Zero means use the agent default.
+type ReadinessProbe struct {
+	TCPPort  int    `json:"tcp_port,omitempty"`
+	HTTPPort int    `json:"http_port,omitempty"`
+	HTTPPath string `json:"http_path,omitempty"`
+	TimeoutS int    `json:"timeout,omitempty"`
+}
+
+func (r ReadinessProbe) String() string {
+	return fmt.Sprintf("TCPPort: %v, HTTPPort: %v, HTTPPath: %v, Timeout: %v", r.TCPPort, r.HTTPPort, r.HTTPPath, r.TimeoutS)
+}
+
+func (r *ReadinessProbe) Validate() error {
+	if r.TCPPort != 0 && r.HTTPPort != 0 {
+		return fmt.Errorf("only one of tcp_port and http_port can be set: %v", r)
+	} else if r.TCPPort < 0 || r.TCPPort > 65535 || r.HTTPPort < 0 || r.HTTPPort > 65535 {
+		return fmt.Errorf("tcp_port and http_port must be between 1 and 65535: %v", r)
+	} else if r.HTTPPath != "" && r.HTTPPort == 0 {
+		return fmt.Errorf("http_path requires http_port: %v", r)
+	} else if r.HTTPPath != "" && !strings.HasPrefix(r.HTTPPath, "/") {
+		return fmt.Errorf("http_path must start with /: %v", r.HTTPPath)
+	} else if r.TimeoutS < 0 {
+		return fmt.Errorf("timeout must not be negative: %v", r.TimeoutS)
+	}
+	return nil
+}
+
+// The restart policies of a service container. The agent restarts the containers of a service that has a restart
+// policy itself, so that a container that stops does not end the agreement or the service instance.
+const (
+	RESTART_POLICY_NEVER      = "never"
+	RESTART_POLICY_ON_FAILURE = "on-failure" // restart only when the container exits with a non-zero code
+	RESTART_POLICY_ALWAYS     = "always"
+)
+
+// The defaults for the wait before the first restart and for the longest wait between restarts, in seconds.
+const (
+	DEFAULT_RESTART_BACKOFF_S     = 10
+	DEFAULT_RESTART_MAX_BACKOFF_S = 300
+)
+
+type RestartPolicy struct {
+	Policy      string `json:"policy"`
+	MaxRestarts int    `json:"max_restarts,omitempty"` // 0 means no limit
+	BackoffS    int    `json:"backoff,omitempty"`      // the wait before the first restart, doubled for each restart after it
+	MaxBackoffS int    `json:"max_backoff,omitempty"`
+}
+
+func (r RestartPolicy) String() string {
+	return fmt.Sprintf("Policy: %v, MaxRestarts: %v, Backoff: %v, MaxBackoff: %v", r.Policy, r.MaxRestarts, r.BackoffS, r.MaxBackoffS)
+}
+
+func (r *RestartPolicy) Validate() error {
+	if r.Policy != RESTART_POLICY_NEVER && r.Policy != RESTART_POLICY_ON_FAILURE && r.Policy != RESTART_POLICY_ALWAYS {
+		return fmt.Errorf("policy must be one of %v, %v or %v: %v", RESTART_POLICY_NEVER, RESTART_POLICY_ON_FAILURE, RESTART_POLICY_ALWAYS, r.Policy)
+	} else if r.MaxRestarts < 0 {
+		return fmt.Errorf("max_restarts must not be negative: %v", r.MaxRestarts)
+	} else if r.BackoffS < 0 || r.MaxBackoffS < 0 {
+		return fmt.Errorf("backoff and max_backoff must not be negative: %v", r)
+	} else if r.BackoffS != 0 && r.MaxBackoffS != 0 && r.BackoffS > r.MaxBackoffS {
+		return fmt.Errorf("backoff %v must not be larger than max_backoff %v", r.BackoffS, r.MaxBackoffS)
+	} else if r.Policy == RESTART_POLICY_NEVER && (r.MaxRestarts != 0 || r.BackoffS != 0 || r.MaxBackoffS != 0) {
+		return fmt.Errorf("max_restarts, backoff and max_backoff cannot be set with the %v policy: %v", RESTART_POLICY_NEVER, r)
+	}
+	return nil
+}
+
+// Returns true if a container that exited with the input code should be restarted.
+func (r *RestartPolicy) RestartOnExit(exitCode int) bool {
+	switch r.Policy {
+	case RESTART_POLICY_ALWAYS:
+		return true
+	case RESTART_POLICY_ON_FAILURE:
+		return exitCode != 0
+	}
+	return false
+}
+
+// Returns true if the restarts of the policy are used up after the input number of restarts.
+func (r *RestartPolicy) Exhausted(restarts int) bool {
+	return r.Policy == RESTART_POLICY_NEVER || (r.MaxRestarts != 0 && restarts >= r.MaxRestarts)
+}
+
+// Returns how many seconds to wait before restarting a container that has already been restarted the input number of
+// times. The wait doubles with each restart, up to the maximum.
+func (r *RestartPolicy) Backoff(restarts int) int {
+	backoff := r.BackoffS
+	if backoff == 0 {
+		backoff = DEFAULT_RESTART_BACKOFF_S
+	}
+	maxBackoff := r.MaxBackoffS
+	if maxBackoff == 0 {
+		maxBackoff = DEFAULT_RESTART_MAX_BACKOFF_S
+	}
+	for i := 0; i < restarts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// The lifecycle of a named volume of a service, which decides when the agent deletes the volume.
+const (
+	VOLUME_LIFECYCLE_RETAIN_ON_UPGRADE    = "retain-on-upgrade"    // kept for upgrades and new agreements, deleted when the node is unregistered
+	VOLUME_LIFECYCLE_RETAIN_ON_UNREGISTER = "retain-on-unregister" // also kept when the node is unregistered, it is deleted from the CLI
+	VOLUME_LIFECYCLE_DELETE               = "delete"               // deleted with the containers of the service
+)
+
+// The volume driver used when the deployment description does not name one. It does not support size quotas.
+const DEFAULT_VOLUME_DRIVER = "local"
+
+// A size quota is a number of bytes with an optional unit, such as 512m or 10G.
+var volumeSizeRegex = regexp.MustCompile(`^[0-9]+([kKmMgGtT][iI]?[bB]?)?$`)
+
+type VolumeOptions struct {
+	Lifecycle string `json:"lifecycle,omitempty"` // retain-on-upgrade when not set
+	Driver    string `json:"driver,omitempty"`    // local when not set
+	Size      string `json:"size,omitempty"`      // a size quota, for the drivers that support it
+}
+
+func (v VolumeOptions) String() string {
+	return fmt.Sprintf("Lifecycle: %v, Driver: %v, Size: %v", v.Lifecycle, v.Driver, v.Size)
+}
+
+func (v *VolumeOptions) Validate() error {
+	if v.Lifecycle != "" && v.Lifecycle != VOLUME_LIFECYCLE_RETAIN_ON_UPGRADE && v.Lifecycle != VOLUME_LIFECYCLE_RETAIN_ON_UNREGISTER && v.Lifecycle != VOLUME_LIFECYCLE_DELETE {
+		return fmt.Errorf("lifecycle must be one of %v, %v or %v: %v", VOLUME_LIFECYCLE_RETAIN_ON_UPGRADE, VOLUME_LIFECYCLE_RETAIN_ON_UNREGISTER, VOLUME_LIFECYCLE_DELETE, v.Lifecycle)
+	} else if v.Size != "" && !volumeSizeRegex.MatchString(v.Size) {
+		return fmt.Errorf("size must be a number with an optional unit such as 512m or 10G: %v", v.Size)
+	} else if v.Size != "" && v.GetDriver() == DEFAULT_VOLUME_DRIVER {
+		return fmt.Errorf("the %v volume driver does not support size quotas, specify a driver that does", DEFAULT_VOLUME_DRIVER)
+	}
+	return nil
+}
+
+func (v *VolumeOptions) GetLifecycle() string {
+	if v.Lifecycle == "" {
+		return VOLUME_LIFECYCLE_RETAIN_ON_UPGRADE
+	}
+	return v.Lifecycle
+}
+
+func (v *VolumeOptions) GetDriver() string {
+	if v.Driver == "" {
+		return DEFAULT_VOLUME_DRIVER
+	}
+	return v.Driver
+}
+
+// Returns the driver options that create the volume with its size quota.
+func (v *VolumeOptions) GetDriverOpts() map[string]string {
+	if v.Size == "" {
+		return nil
+	}
+	return map[string]string{"size": v.Size}
+}
+
 type Port struct {
 	LocalhostOnly   bool   `json:"localhost_only,omitempty"`
 	PortAndProtocol string `json:"port_and_protocol"`
@@ -178,3 +178,227 @@ func Test_AddSpecificPortBinding(t *testing.T) {
 		t.Errorf("Service should have 2 specific port bindings but not.")
 	}
 }
+
+func Test_ValidateResourceLimits(t *testing.T) {
+	serv := Service{
+		Image:             "an image",
+		Cpus:              0.5,
+		CpuShares:         512,
+		Memory:            256,
+		MemoryReservation: 128,
+		PidsLimit:         100,
+	}
+
+	if err := serv.ValidateResourceLimits(0); err != nil {
+		t.Errorf("ValidateResourceLimits for service %v should not have returned an error: %v", serv, err)
+	}
+
+	serv.MemoryReservation = 512
+	if err := serv.ValidateResourceLimits(0); err == nil {
+		t.Errorf("ValidateResourceLimits for service %v should have returned an error.", serv)
+	}
+
+	serv.MemoryReservation = 128
+	serv.Cpus = -1
+	if err := serv.ValidateResourceLimits(0); err == nil {
+		t.Errorf("ValidateResourceLimits for service %v should have returned an error.", serv)
+	}
+
+	serv.Cpus = 1
+	serv.PidsLimit = -2
+	if err := serv.ValidateResourceLimits(0); err == nil {
+		t.Errorf("ValidateResourceLimits for service %v should have returned an error.", serv)
+	}
+
+	if mem := serv.GetMemoryBytes(1); mem != 256*1024*1024 {
+		t.Errorf("GetMemoryBytes for service should return %v but got %v.", 256*1024*1024, mem)
+	}
+	serv.Memory = 0
+	if mem := serv.GetMemoryBytes(1); mem != 1 {
+		t.Errorf("GetMemoryBytes for service should return the default but got %v.", mem)
+	}
+
+	// without a hard limit the reservation is checked against the default memory limit
+	serv.PidsLimit = 100
+	if err := serv.ValidateResourceLimits(256); err != nil {
+		t.Errorf("ValidateResourceLimits for service %v should not have returned an error: %v", serv, err)
+	}
+	if err := serv.ValidateResourceLimits(64); err == nil {
+		t.Errorf("ValidateResourceLimits for service %v should have returned an error for a reservation larger than the default limit.", serv)
+	}
+}
+
+func Test_ResourceRequirements(t *testing.T) {
+	dd := DeploymentDescription{
+		Services: map[string]*Service{
+			"s1": &Service{Image: "image1", Cpus: 0.5, Memory: 256},
+			"s2": &Service{Image: "image2", Cpus: 2, MemoryReservation: 64},
+			"s3": &Service{Image: "image3"},
+		},
+	}
+
+	cpus, mem := dd.ResourceRequirements()
+	if cpus != 2 {
+		t.Errorf("ResourceRequirements should return 2 cpus but got %v.", cpus)
+	} else if mem != 320 {
+		t.Errorf("ResourceRequirements should return 320 MB but got %v.", mem)
+	}
+}
+
+func Test_Healthcheck(t *testing.T) {
+	hc := Healthcheck{
+		Test:         []string{"CMD-SHELL", "curl -f http://localhost || exit 1"},
+		IntervalS:    30,
+		TimeoutS:     5,
+		Retries:      3,
+		StartPeriodS: 10,
+	}
+
+	if err := hc.Validate(); err != nil {
+		t.Errorf("Validate for healthcheck %v should not have returned an error: %v", hc, err)
+	}
+
+	dhc := hc.DockerHealthConfig()
+	if dhc.Interval.Seconds() != 30 || dhc.Timeout.Seconds() != 5 || dhc.Retries != 3 || dhc.StartPeriod.Seconds() != 10 {
+		t.Errorf("DockerHealthConfig returned the wrong values: %v", dhc)
+	}
+
+	hc.Test = []string{"curl -f http://localhost"}
+	if err := hc.Validate(); err == nil {
+		t.Errorf("Validate for healthcheck %v should have returned an error.", hc)
+	}
+
+	hc.Test = []string{"CMD"}
+	if err := hc.Validate(); err == nil {
+		t.Errorf("Validate for healthcheck %v should have returned an error.", hc)
+	}
+
+	hc.Test = []string{"NONE"}
+	hc.IntervalS = -1
+	if err := hc.Validate(); err == nil {
+		t.Errorf("Validate for healthcheck %v should have returned an error.", hc)
+	}
+}
+
+func Test_ReadinessProbe(t *testing.T) {
+	valid := []ReadinessProbe{
+		ReadinessProbe{TCPPort: 5432},
+		ReadinessProbe{HTTPPort: 8080, HTTPPath: "/ready", TimeoutS: 60},
+		ReadinessProbe{TimeoutS: 30},
+	}
+	for _, probe := range valid {
+		if err := probe.Validate(); err != nil {
+			t.Errorf("Validate for readiness probe %v should not have returned an error: %v", probe, err)
+		}
+	}
+
+	invalid := []ReadinessProbe{
+		ReadinessProbe{TCPPort: 5432, HTTPPort: 8080},
+		ReadinessProbe{TCPPort: 70000},
+		ReadinessProbe{HTTPPath: "/ready"},
+		ReadinessProbe{HTTPPort: 8080, HTTPPath: "ready"},
+		ReadinessProbe{TCPPort: 5432, TimeoutS: -1},
+	}
+	for _, probe := range invalid {
+		if err := probe.Validate(); err == nil {
+			t.Errorf("Validate for readiness probe %v should have returned an error.", probe)
+		}
+	}
+}
+
+func Test_RestartPolicy(t *testing.T) {
+	valid := []RestartPolicy{
+		RestartPolicy{Policy: RESTART_POLICY_NEVER},
+		RestartPolicy{Policy: RESTART_POLICY_ON_FAILURE, MaxRestarts: 5},
+		RestartPolicy{Policy: RESTART_POLICY_ALWAYS, BackoffS: 5, MaxBackoffS: 60},
+	}
+	for _, rp := range valid {
+		if err := rp.Validate(); err != nil {
+			t.Errorf("Validate for restart policy %v should not have returned an error: %v", rp, err)
+		}
+	}
+
+	invalid := []RestartPolicy{
+		RestartPolicy{},
+		RestartPolicy{Policy: "unless-stopped"},
+		RestartPolicy{Policy: RESTART_POLICY_ALWAYS, MaxRestarts: -1},
+		RestartPolicy{Policy: RESTART_POLICY_ALWAYS, BackoffS: 60, MaxBackoffS: 5},
+		RestartPolicy{Policy: RESTART_POLICY_NEVER, MaxRestarts: 3},
+	}
+	for _, rp := range invalid {
+		if err := rp.Validate(); err == nil {
+			t.Errorf("Validate for restart policy %v should have returned an error.", rp)
+		}
+	}
+
+	onFailure := RestartPolicy{Policy: RESTART_POLICY_ON_FAILURE, MaxRestarts: 3, BackoffS: 5, MaxBackoffS: 30}
+	if onFailure.RestartOnExit(0) || !onFailure.RestartOnExit(1) {
+		t.Errorf("on-failure policy should only restart containers that fail")
+	} else if onFailure.Exhausted(2) || !onFailure.Exhausted(3) {
+		t.Errorf("on-failure policy should be exhausted after 3 restarts")
+	}
+	for restarts, expected := range []int{5, 10, 20, 30, 30} {
+		if backoff := onFailure.Backoff(restarts); backoff != expected {
+			t.Errorf("backoff after %v restarts should be %v, is %v", restarts, expected, backoff)
+		}
+	}
+
+	always := RestartPolicy{Policy: RESTART_POLICY_ALWAYS}
+	if !always.RestartOnExit(0) || always.Exhausted(100) {
+		t.Errorf("always policy without max_restarts should always restart")
+	} else if always.Backoff(0) != DEFAULT_RESTART_BACKOFF_S || always.Backoff(10) != DEFAULT_RESTART_MAX_BACKOFF_S {
+		t.Errorf("always policy should use the default backoff, got %v and %v", always.Backoff(0), always.Backoff(10))
+	}
+
+	never := RestartPolicy{Policy: RESTART_POLICY_NEVER}
+	if never.RestartOnExit(1) || !never.Exhausted(0) {
+		t.Errorf("never policy should not restart")
+	}
+}
+
+func Test_VolumeOptions(t *testing.T) {
+	valid := []VolumeOptions{
+		VolumeOptions{},
+		VolumeOptions{Lifecycle: VOLUME_LIFECYCLE_DELETE},
+		VolumeOptions{Lifecycle: VOLUME_LIFECYCLE_RETAIN_ON_UNREGISTER, Driver: "mydriver", Size: "10G"},
+		VolumeOptions{Driver: "mydriver", Size: "512mib"},
+	}
+	for _, vo := range valid {
+		if err := vo.Validate(); err != nil {
+			t.Errorf("Validate for volume options %v should not have returned an error: %v", vo, err)
+		}
+	}
+
+	invalid := []VolumeOptions{
+		VolumeOptions{Lifecycle: "forever"},
+		VolumeOptions{Driver: "mydriver", Size: "ten gigabytes"},
+		VolumeOptions{Size: "10G"},
+	}
+	for _, vo := range invalid {
+		if err := vo.Validate(); err == nil {
+			t.Errorf("Validate for volume options %v should have returned an error.", vo)
+		}
+	}
+
+	vo := VolumeOptions{}
+	if vo.GetLifecycle() != VOLUME_LIFECYCLE_RETAIN_ON_UPGRADE || vo.GetDriver() != DEFAULT_VOLUME_DRIVER || vo.GetDriverOpts() != nil {
+		t.Errorf("wrong defaults for volume options %v", vo)
+	}
+
+	s := Service{
+		Binds:   []string{"mydata:/data", "/host/dir:/dir:ro"},
+		Volumes: map[string]VolumeOptions{"mydata": VolumeOptions{Lifecycle: VOLUME_LIFECYCLE_DELETE}},
+	}
+	if err := s.ValidateVolumes(); err != nil {
+		t.Errorf("ValidateVolumes should not have returned an error: %v", err)
+	}
+	s.Volumes["/host/dir"] = VolumeOptions{}
+	if err := s.ValidateVolumes(); err == nil {
+		t.Errorf("ValidateVolumes should have returned an error for a host directory")
+	}
+	delete(s.Volumes, "/host/dir")
+	s.Volumes["otherdata"] = VolumeOptions{}
+	if err := s.ValidateVolumes(); err == nil {
+		t.Errorf("ValidateVolumes should have returned an error for a volume that is not in binds")
+	}
+}
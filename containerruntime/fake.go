@@ -0,0 +1,614 @@
+package containerruntime
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An in memory container runtime for tests. Images have to be pulled before containers can be created from them, and
+// containers are only started and stopped, nothing runs. ExitContainer stands in for a container that ends on its own.
+// The commands run in containers do nothing and end with ExecExitCode. Only the label filters of ListContainers are
+// supported.
+type FakeRuntime struct {
+	lock         sync.Mutex
+	count        int
+	images       map[string]*docker.Image       // by name
+	containers   map[string]*docker.Container   // by id
+	networks     map[string]*docker.Network     // by id
+	volumes      map[string]*docker.Volume      // by name
+	execs        map[string]*docker.ExecInspect // by id
+	PullErr      error                          // when set, returned by PullImage
+	ExecExitCode int                            // the exit code of the commands run in containers
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		images:     make(map[string]*docker.Image),
+		containers: make(map[string]*docker.Container),
+		networks:   make(map[string]*docker.Network),
+		volumes:    make(map[string]*docker.Volume),
+		execs:      make(map[string]*docker.ExecInspect),
+	}
+}
+
+// Returns a new id, the ids look like the ids of docker.
+func (f *FakeRuntime) newId() string {
+	f.count++
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("fake-%v", f.count))))
+}
+
+func (f *FakeRuntime) PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.PullErr != nil {
+		return f.PullErr
+	}
+
+	name := opts.Repository
+	if opts.Tag != "" {
+		name = name + ":" + opts.Tag
+	}
+	if _, ok := f.images[name]; !ok {
+		id := f.newId()
+		f.images[name] = &docker.Image{
+			ID:          "sha256:" + id,
+			RepoTags:    []string{name},
+			RepoDigests: []string{opts.Repository + "@sha256:" + id},
+			Created:     time.Now(),
+		}
+	}
+	if opts.OutputStream != nil {
+		opts.OutputStream.Write([]byte(fmt.Sprintf(`{"status":"Pull complete","id":"%v"}`+"\n", f.images[name].ID[7:19])))
+	}
+	return nil
+}
+
+// Loads the image of an archive in the format of docker save. The layers named by the archive manifest have to be in the
+// archive, one for each layer of the image config. The image id is the digest of the config, as in docker.
+func (f *FakeRuntime) LoadImage(opts docker.LoadImageOptions) error {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(opts.InputStream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		} else if b, err := ioutil.ReadAll(tr); err != nil {
+			return err
+		} else {
+			files[hdr.Name] = b
+		}
+	}
+
+	var manifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return fmt.Errorf("invalid archive manifest, error: %v", err)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, m := range manifest {
+		var config struct {
+			RootFS struct {
+				DiffIds []string `json:"diff_ids"`
+			} `json:"rootfs"`
+		}
+		if err := json.Unmarshal(files[m.Config], &config); err != nil {
+			return fmt.Errorf("invalid image config %v, error: %v", m.Config, err)
+		} else if len(config.RootFS.DiffIds) != len(m.Layers) {
+			return fmt.Errorf("image config %v has %v layers, the archive has %v", m.Config, len(config.RootFS.DiffIds), len(m.Layers))
+		}
+		for _, l := range m.Layers {
+			if _, ok := files[l]; !ok {
+				return fmt.Errorf("layer %v is not in the archive", l)
+			}
+		}
+
+		img := &docker.Image{
+			ID:       fmt.Sprintf("sha256:%x", sha256.Sum256(files[m.Config])),
+			RepoTags: m.RepoTags,
+			Created:  time.Now(),
+		}
+		f.images[img.ID] = img
+		for _, tag := range m.RepoTags {
+			f.images[tag] = img
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) InspectImage(name string) (*docker.Image, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if img := f.findImage(name); img != nil {
+		copy := *img
+		return &copy, nil
+	}
+	return nil, docker.ErrNoSuchImage
+}
+
+// Find an image by name, digest or id.
+func (f *FakeRuntime) findImage(name string) *docker.Image {
+	for n, img := range f.images {
+		if n == name || img.ID == name || img.ID == "sha256:"+name {
+			return img
+		}
+		for _, d := range img.RepoDigests {
+			if d == name {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) ListImages(opts docker.ListImagesOptions) ([]docker.APIImages, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	images := make([]docker.APIImages, 0)
+	for _, img := range f.images {
+		images = append(images, docker.APIImages{ID: img.ID, RepoTags: img.RepoTags, RepoDigests: img.RepoDigests, Created: img.Created.Unix()})
+	}
+	return images, nil
+}
+
+func (f *FakeRuntime) RemoveImage(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	img := f.findImage(name)
+	if img == nil {
+		return docker.ErrNoSuchImage
+	}
+	for _, c := range f.containers {
+		if c.Image == img.ID {
+			return fmt.Errorf("image %v is used by container %v", name, c.ID)
+		}
+	}
+	for n, i := range f.images {
+		if i == img {
+			delete(f.images, n)
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if opts.Config == nil {
+		return nil, fmt.Errorf("container %v has no config", opts.Name)
+	}
+	for _, c := range f.containers {
+		if c.Name == "/"+opts.Name {
+			return nil, docker.ErrContainerAlreadyExists
+		}
+	}
+	img := f.findImage(opts.Config.Image)
+	if img == nil {
+		return nil, docker.ErrNoSuchImage
+	}
+
+	config := *opts.Config
+	c := &docker.Container{
+		ID:              f.newId(),
+		Name:            "/" + opts.Name,
+		Created:         time.Now(),
+		Config:          &config,
+		Image:           img.ID,
+		NetworkSettings: &docker.NetworkSettings{Networks: make(map[string]docker.ContainerNetwork)},
+	}
+	if opts.HostConfig != nil {
+		hostConfig := *opts.HostConfig
+		c.HostConfig = &hostConfig
+	}
+	f.containers[c.ID] = c
+
+	if opts.NetworkingConfig != nil {
+		for name, ep := range opts.NetworkingConfig.EndpointsConfig {
+			if err := f.connect(name, c, ep); err != nil {
+				delete(f.containers, c.ID)
+				return nil, err
+			}
+		}
+	}
+
+	copy := *c
+	return &copy, nil
+}
+
+// Find a container by id or name.
+func (f *FakeRuntime) findContainer(id string) *docker.Container {
+	for _, c := range f.containers {
+		if c.ID == id || c.Name == "/"+id || c.Name == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) StartContainer(id string, hostConfig *docker.HostConfig) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := f.findContainer(id)
+	if c == nil {
+		return &docker.NoSuchContainer{ID: id}
+	} else if c.State.Running {
+		return &docker.ContainerAlreadyRunning{ID: id}
+	}
+	c.State = docker.State{Running: true, Status: "running", Pid: 1, StartedAt: time.Now()}
+	return nil
+}
+
+func (f *FakeRuntime) KillContainer(opts docker.KillContainerOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := f.findContainer(opts.ID)
+	if c == nil {
+		return &docker.NoSuchContainer{ID: opts.ID}
+	} else if !c.State.Running {
+		return &docker.ContainerNotRunning{ID: opts.ID}
+	}
+	c.State = docker.State{Status: "exited", ExitCode: 137, StartedAt: c.State.StartedAt, FinishedAt: time.Now()}
+	return nil
+}
+
+// Ends the running container with the exit code, as if its process had exited. Like the container runtime, the
+// container is restarted when its restart policy says so, and its restart count goes up.
+func (f *FakeRuntime) ExitContainer(id string, exitCode int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := f.findContainer(id)
+	if c == nil {
+		return &docker.NoSuchContainer{ID: id}
+	} else if !c.State.Running {
+		return &docker.ContainerNotRunning{ID: id}
+	}
+
+	restart := false
+	if c.HostConfig != nil {
+		switch rp := c.HostConfig.RestartPolicy; rp.Name {
+		case "always", "unless-stopped":
+			restart = true
+		case "on-failure":
+			restart = exitCode != 0 && (rp.MaximumRetryCount == 0 || c.RestartCount < rp.MaximumRetryCount)
+		}
+	}
+	if restart {
+		c.RestartCount += 1
+		c.State = docker.State{Running: true, Status: "running", Pid: 1, StartedAt: time.Now()}
+	} else {
+		c.State = docker.State{Status: "exited", ExitCode: exitCode, StartedAt: c.State.StartedAt, FinishedAt: time.Now()}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) RemoveContainer(opts docker.RemoveContainerOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := f.findContainer(opts.ID)
+	if c == nil {
+		return &docker.NoSuchContainer{ID: opts.ID}
+	} else if c.State.Running && !opts.Force {
+		return fmt.Errorf("container %v is running", opts.ID)
+	}
+	for _, n := range f.networks {
+		delete(n.Containers, c.ID)
+	}
+	delete(f.containers, c.ID)
+	return nil
+}
+
+func (f *FakeRuntime) InspectContainer(id string) (*docker.Container, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if c := f.findContainer(id); c != nil {
+		copy := *c
+		return &copy, nil
+	}
+	return nil, &docker.NoSuchContainer{ID: id}
+}
+
+func (f *FakeRuntime) ListContainers(opts docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	containers := make([]docker.APIContainers, 0)
+	for _, c := range f.containers {
+		if !c.State.Running && !opts.All {
+			continue
+		} else if !hasLabels(c.Config.Labels, opts.Filters["label"]) {
+			continue
+		}
+
+		state := "created"
+		if c.State.Running {
+			state = "running"
+		} else if !c.State.FinishedAt.IsZero() {
+			state = "exited"
+		}
+		networks := make(map[string]docker.ContainerNetwork)
+		for name, n := range c.NetworkSettings.Networks {
+			networks[name] = n
+		}
+		containers = append(containers, docker.APIContainers{
+			ID:       c.ID,
+			Image:    c.Config.Image,
+			Names:    []string{c.Name},
+			Created:  c.Created.Unix(),
+			State:    state,
+			Labels:   c.Config.Labels,
+			Networks: docker.NetworkList{Networks: networks},
+		})
+	}
+	return containers, nil
+}
+
+// Returns true if the labels match the label filters, which are either label names or name=value.
+func hasLabels(labels map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		if value, ok := labels[parts[0]]; !ok {
+			return false
+		} else if len(parts) == 2 && value != parts[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FakeRuntime) CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := f.findContainer(opts.Container)
+	if c == nil {
+		return nil, &docker.NoSuchContainer{ID: opts.Container}
+	} else if !c.State.Running {
+		return nil, &docker.ContainerNotRunning{ID: opts.Container}
+	}
+
+	id := f.newId()
+	f.execs[id] = &docker.ExecInspect{
+		ID:            id,
+		ContainerID:   c.ID,
+		ProcessConfig: docker.ExecProcessConfig{EntryPoint: opts.Cmd[0], Arguments: opts.Cmd[1:]},
+	}
+	return &docker.Exec{ID: id}, nil
+}
+
+func (f *FakeRuntime) StartExec(id string, opts docker.StartExecOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	e, ok := f.execs[id]
+	if !ok {
+		return &docker.NoSuchExec{ID: id}
+	}
+	e.ExitCode = f.ExecExitCode
+	return nil
+}
+
+func (f *FakeRuntime) InspectExec(id string) (*docker.ExecInspect, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	e, ok := f.execs[id]
+	if !ok {
+		return nil, &docker.NoSuchExec{ID: id}
+	}
+	inspect := *e
+	return &inspect, nil
+}
+
+func (f *FakeRuntime) CreateNetwork(opts docker.CreateNetworkOptions) (*docker.Network, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if opts.CheckDuplicate && f.findNetwork(opts.Name) != nil {
+		return nil, docker.ErrNetworkAlreadyExists
+	}
+
+	n := &docker.Network{
+		ID:         f.newId(),
+		Name:       opts.Name,
+		Driver:     opts.Driver,
+		Internal:   opts.Internal,
+		EnableIPv6: opts.EnableIPv6,
+		Labels:     opts.Labels,
+		Containers: make(map[string]docker.Endpoint),
+	}
+	f.networks[n.ID] = n
+	return f.copyNetwork(n), nil
+}
+
+// Find a network by id or name.
+func (f *FakeRuntime) findNetwork(id string) *docker.Network {
+	for _, n := range f.networks {
+		if n.ID == id || n.Name == id {
+			return n
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) copyNetwork(n *docker.Network) *docker.Network {
+	copy := *n
+	copy.Containers = make(map[string]docker.Endpoint)
+	for id, ep := range n.Containers {
+		copy.Containers[id] = ep
+	}
+	return &copy
+}
+
+func (f *FakeRuntime) ListNetworks() ([]docker.Network, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	networks := make([]docker.Network, 0)
+	for _, n := range f.networks {
+		networks = append(networks, *f.copyNetwork(n))
+	}
+	return networks, nil
+}
+
+func (f *FakeRuntime) NetworkInfo(id string) (*docker.Network, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if n := f.findNetwork(id); n != nil {
+		return f.copyNetwork(n), nil
+	}
+	return nil, &docker.NoSuchNetwork{ID: id}
+}
+
+func (f *FakeRuntime) ConnectNetwork(id string, opts docker.NetworkConnectionOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	c := f.findContainer(opts.Container)
+	if c == nil {
+		return &docker.NoSuchNetworkOrContainer{NetworkID: id, ContainerID: opts.Container}
+	}
+	return f.connect(id, c, opts.EndpointConfig)
+}
+
+func (f *FakeRuntime) connect(id string, c *docker.Container, ep *docker.EndpointConfig) error {
+	n := f.findNetwork(id)
+	if n == nil {
+		return &docker.NoSuchNetworkOrContainer{NetworkID: id, ContainerID: c.ID}
+	}
+
+	aliases := []string{}
+	if ep != nil {
+		aliases = ep.Aliases
+	}
+	n.Containers[c.ID] = docker.Endpoint{Name: strings.TrimPrefix(c.Name, "/"), ID: f.newId()}
+	c.NetworkSettings.Networks[n.Name] = docker.ContainerNetwork{NetworkID: n.ID, Aliases: aliases, IPAddress: fmt.Sprintf("10.0.%v.%v", len(f.networks), len(n.Containers)+1)}
+	return nil
+}
+
+func (f *FakeRuntime) DisconnectNetwork(id string, opts docker.NetworkConnectionOptions) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n := f.findNetwork(id)
+	c := f.findContainer(opts.Container)
+	if n == nil || c == nil {
+		return &docker.NoSuchNetworkOrContainer{NetworkID: id, ContainerID: opts.Container}
+	}
+	delete(n.Containers, c.ID)
+	delete(c.NetworkSettings.Networks, n.Name)
+	return nil
+}
+
+func (f *FakeRuntime) RemoveNetwork(id string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n := f.findNetwork(id)
+	if n == nil {
+		return &docker.NoSuchNetwork{ID: id}
+	} else if len(n.Containers) != 0 {
+		return fmt.Errorf("network %v has active endpoints", id)
+	}
+	delete(f.networks, n.ID)
+	return nil
+}
+
+func (f *FakeRuntime) CreateVolume(opts docker.CreateVolumeOptions) (*docker.Volume, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if v, ok := f.volumes[opts.Name]; ok {
+		copy := *v
+		return &copy, nil
+	}
+	v := &docker.Volume{
+		Name:       opts.Name,
+		Driver:     opts.Driver,
+		Labels:     opts.Labels,
+		Options:    opts.DriverOpts,
+		Mountpoint: "/var/lib/fake/volumes/" + opts.Name,
+		CreatedAt:  time.Now(),
+	}
+	f.volumes[v.Name] = v
+	copy := *v
+	return &copy, nil
+}
+
+func (f *FakeRuntime) ListVolumes(opts docker.ListVolumesOptions) ([]docker.Volume, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	volumes := make([]docker.Volume, 0)
+	for _, v := range f.volumes {
+		volumes = append(volumes, *v)
+	}
+	return volumes, nil
+}
+
+func (f *FakeRuntime) RemoveVolume(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.volumes[name]; !ok {
+		return docker.ErrNoSuchVolume
+	}
+	for _, c := range f.containers {
+		if c.HostConfig == nil {
+			continue
+		}
+		for _, b := range c.HostConfig.Binds {
+			if strings.HasPrefix(b, name+":") {
+				return docker.ErrVolumeInUse
+			}
+		}
+	}
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *FakeRuntime) Info() (*docker.DockerInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	running := 0
+	for _, c := range f.containers {
+		if c.State.Running {
+			running++
+		}
+	}
+	return &docker.DockerInfo{
+		Name:              "fake",
+		Containers:        len(f.containers),
+		ContainersRunning: running,
+		Images:            len(f.images),
+		DockerRootDir:     "/var/lib/fake",
+		OSType:            "linux",
+		Architecture:      "x86_64",
+	}, nil
+}
@@ -0,0 +1,67 @@
+package containerruntime
+
+import (
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/cutil"
+	"regexp"
+	"strings"
+)
+
+// The Podman runtime uses the Docker compatible API of the Podman service. Podman does not assume that images without a
+// registry come from Docker Hub, so the image names are qualified the way Docker would, otherwise the pulls of such
+// images depend on the short name settings of the node.
+type PodmanRuntime struct {
+	*docker.Client
+}
+
+// Returns the Podman runtime using the API at the endpoint, or at the default endpoint of the Podman service.
+func NewPodmanRuntime(endpoint string) (*PodmanRuntime, error) {
+	if endpoint == "" {
+		endpoint = PODMAN_ENDPOINT_DEFAULT
+	}
+	if client, err := docker.NewClient(endpoint); err != nil {
+		return nil, err
+	} else {
+		return &PodmanRuntime{Client: client}, nil
+	}
+}
+
+func (p *PodmanRuntime) PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error {
+	opts.Repository = QualifiedImageName(opts.Repository)
+	return p.Client.PullImage(opts, auth)
+}
+
+func (p *PodmanRuntime) InspectImage(name string) (*docker.Image, error) {
+	return p.Client.InspectImage(QualifiedImageName(name))
+}
+
+func (p *PodmanRuntime) RemoveImage(name string) error {
+	return p.Client.RemoveImage(QualifiedImageName(name))
+}
+
+func (p *PodmanRuntime) CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error) {
+	if opts.Config != nil {
+		config := *opts.Config
+		config.Image = QualifiedImageName(config.Image)
+		opts.Config = &config
+	}
+	return p.Client.CreateContainer(opts)
+}
+
+var imageIdRE = regexp.MustCompile(`^(sha256:)?[0-9a-f]{12,64}$`)
+
+// Returns the image name with the registry that Docker uses for it. Images without a registry are on Docker Hub, and the
+// official images there are in the library namespace. Image ids and the local images of Podman are not changed.
+func QualifiedImageName(name string) string {
+	if name == "" || imageIdRE.MatchString(name) || strings.HasPrefix(name, "localhost/") {
+		return name
+	}
+
+	domain, path, _, _ := cutil.ParseDockerImagePath(name)
+	if domain != "" {
+		return name
+	} else if !strings.Contains(path, "/") {
+		return "docker.io/library/" + name
+	}
+	return "docker.io/" + name
+}
@@ -0,0 +1,79 @@
+package containerruntime
+
+import (
+	"errors"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
+)
+
+// The container runtimes that the agent can run services with.
+const (
+	RUNTIME_DOCKER = "docker"
+	RUNTIME_PODMAN = "podman"
+)
+
+// The default endpoint of the Podman API service, when it runs as root.
+const PODMAN_ENDPOINT_DEFAULT = "unix:///run/podman/podman.sock"
+
+// The operations on images, containers, networks and volumes that the agent needs from a container runtime. The types are
+// those of the Docker API, which is also served by Podman. A docker.Client is the Docker implementation.
+type ContainerRuntime interface {
+	// images
+	PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error
+	LoadImage(opts docker.LoadImageOptions) error
+	InspectImage(name string) (*docker.Image, error)
+	ListImages(opts docker.ListImagesOptions) ([]docker.APIImages, error)
+	RemoveImage(name string) error
+
+	// containers
+	CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error)
+	StartContainer(id string, hostConfig *docker.HostConfig) error
+	KillContainer(opts docker.KillContainerOptions) error
+	RemoveContainer(opts docker.RemoveContainerOptions) error
+	InspectContainer(id string) (*docker.Container, error)
+	ListContainers(opts docker.ListContainersOptions) ([]docker.APIContainers, error)
+
+	// commands run in containers
+	CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error)
+	StartExec(id string, opts docker.StartExecOptions) error
+	InspectExec(id string) (*docker.ExecInspect, error)
+
+	// networks
+	CreateNetwork(opts docker.CreateNetworkOptions) (*docker.Network, error)
+	ListNetworks() ([]docker.Network, error)
+	NetworkInfo(id string) (*docker.Network, error)
+	ConnectNetwork(id string, opts docker.NetworkConnectionOptions) error
+	DisconnectNetwork(id string, opts docker.NetworkConnectionOptions) error
+	RemoveNetwork(id string) error
+
+	// volumes
+	CreateVolume(opts docker.CreateVolumeOptions) (*docker.Volume, error)
+	ListVolumes(opts docker.ListVolumesOptions) ([]docker.Volume, error)
+	RemoveVolume(name string) error
+
+	// the runtime itself
+	Info() (*docker.DockerInfo, error)
+}
+
+// Returns the container runtime of the given type, using the API at the endpoint.
+func NewContainerRuntime(runtimeType string, endpoint string) (ContainerRuntime, error) {
+	switch runtimeType {
+	case RUNTIME_DOCKER, "":
+		return NewDockerRuntime(endpoint)
+	case RUNTIME_PODMAN:
+		return NewPodmanRuntime(endpoint)
+	default:
+		return nil, errors.New(fmt.Sprintf("container runtime %v is not supported, it must be %v or %v", runtimeType, RUNTIME_DOCKER, RUNTIME_PODMAN))
+	}
+}
+
+// Returns the Docker runtime using the Docker API at the endpoint.
+func NewDockerRuntime(endpoint string) (ContainerRuntime, error) {
+	return docker.NewClient(endpoint)
+}
+
+// Returns the container runtime of the agent configuration, using the API at the configured docker endpoint.
+func NewAgentContainerRuntime(cfg *config.HorizonConfig) (ContainerRuntime, error) {
+	return NewContainerRuntime(cfg.GetContainerRuntime(), cfg.Edge.DockerEndpoint)
+}
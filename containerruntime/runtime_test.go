@@ -0,0 +1,180 @@
+// +build unit
+
+package containerruntime
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"testing"
+)
+
+var _ ContainerRuntime = (*docker.Client)(nil)
+var _ ContainerRuntime = (*PodmanRuntime)(nil)
+var _ ContainerRuntime = (*FakeRuntime)(nil)
+
+func Test_NewContainerRuntime(t *testing.T) {
+	if r, err := NewContainerRuntime("", "unix:///var/run/docker.sock"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if _, ok := r.(*docker.Client); !ok {
+		t.Errorf("expected a docker client, got %T", r)
+	}
+
+	if r, err := NewContainerRuntime(RUNTIME_PODMAN, ""); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if _, ok := r.(*PodmanRuntime); !ok {
+		t.Errorf("expected a podman runtime, got %T", r)
+	}
+
+	if _, err := NewContainerRuntime("rkt", ""); err == nil {
+		t.Errorf("expected an error for an unknown runtime")
+	}
+}
+
+func Test_QualifiedImageName(t *testing.T) {
+	tests := map[string]string{
+		"busybox":                                 "docker.io/library/busybox",
+		"busybox:1.31":                            "docker.io/library/busybox:1.31",
+		"openhorizon/amd64_cpu:1.2.2":             "docker.io/openhorizon/amd64_cpu:1.2.2",
+		"quay.io/openhorizon/cpu:1.2.2":           "quay.io/openhorizon/cpu:1.2.2",
+		"localhost:5000/cpu":                      "localhost:5000/cpu",
+		"localhost/cpu":                           "localhost/cpu",
+		"docker.io/library/busybox":               "docker.io/library/busybox",
+		"0123456789ab":                            "0123456789ab",
+		"sha256:0123456789abcdef0123456789abcdef": "sha256:0123456789abcdef0123456789abcdef",
+	}
+
+	for name, expected := range tests {
+		if q := QualifiedImageName(name); q != expected {
+			t.Errorf("image %v qualified to %v, expected %v", name, q, expected)
+		}
+	}
+}
+
+func Test_FakeRuntime_containers(t *testing.T) {
+	f := NewFakeRuntime()
+
+	if _, err := f.CreateContainer(docker.CreateContainerOptions{Name: "c1", Config: &docker.Config{Image: "busybox:latest"}}); err != docker.ErrNoSuchImage {
+		t.Errorf("expected missing image error, got %v", err)
+	}
+
+	if err := f.PullImage(docker.PullImageOptions{Repository: "busybox", Tag: "latest"}, docker.AuthConfiguration{}); err != nil {
+		t.Errorf("unexpected pull error %v", err)
+	}
+
+	net, err := f.CreateNetwork(docker.CreateNetworkOptions{Name: "n1", CheckDuplicate: true})
+	if err != nil {
+		t.Errorf("unexpected network error %v", err)
+	} else if _, err := f.CreateNetwork(docker.CreateNetworkOptions{Name: "n1", CheckDuplicate: true}); err != docker.ErrNetworkAlreadyExists {
+		t.Errorf("expected duplicate network error, got %v", err)
+	}
+
+	c, err := f.CreateContainer(docker.CreateContainerOptions{
+		Name:   "c1",
+		Config: &docker.Config{Image: "busybox:latest", Labels: map[string]string{"a": "b"}},
+		NetworkingConfig: &docker.NetworkingConfig{
+			EndpointsConfig: map[string]*docker.EndpointConfig{"n1": &docker.EndpointConfig{NetworkID: net.ID}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected create error %v", err)
+	} else if _, err := f.CreateContainer(docker.CreateContainerOptions{Name: "c1", Config: &docker.Config{Image: "busybox:latest"}}); err != docker.ErrContainerAlreadyExists {
+		t.Errorf("expected duplicate container error, got %v", err)
+	}
+
+	if err := f.StartContainer(c.ID, nil); err != nil {
+		t.Errorf("unexpected start error %v", err)
+	}
+
+	if cs, err := f.ListContainers(docker.ListContainersOptions{Filters: map[string][]string{"label": []string{"a=b"}}}); err != nil {
+		t.Errorf("unexpected list error %v", err)
+	} else if len(cs) != 1 || cs[0].State != "running" {
+		t.Errorf("expected one running container, got %v", cs)
+	} else if cs, _ := f.ListContainers(docker.ListContainersOptions{Filters: map[string][]string{"label": []string{"a=c"}}}); len(cs) != 0 {
+		t.Errorf("expected no containers, got %v", cs)
+	}
+
+	if err := f.RemoveNetwork(net.ID); err == nil {
+		t.Errorf("expected an error removing a network in use")
+	}
+
+	if err := f.KillContainer(docker.KillContainerOptions{ID: c.ID}); err != nil {
+		t.Errorf("unexpected kill error %v", err)
+	} else if err := f.KillContainer(docker.KillContainerOptions{ID: c.ID}); err == nil {
+		t.Errorf("expected an error killing a stopped container")
+	} else if _, ok := err.(*docker.ContainerNotRunning); !ok {
+		t.Errorf("expected container not running error, got %v", err)
+	}
+
+	if err := f.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID}); err != nil {
+		t.Errorf("unexpected remove error %v", err)
+	} else if _, err := f.InspectContainer(c.ID); err == nil {
+		t.Errorf("expected removed container to be gone")
+	} else if err := f.RemoveNetwork(net.ID); err != nil {
+		t.Errorf("unexpected network remove error %v", err)
+	}
+}
+
+func Test_FakeRuntime_ExitContainer(t *testing.T) {
+	f := NewFakeRuntime()
+	if err := f.PullImage(docker.PullImageOptions{Repository: "busybox", Tag: "latest"}, docker.AuthConfiguration{}); err != nil {
+		t.Errorf("unexpected pull error %v", err)
+	}
+
+	c, err := f.CreateContainer(docker.CreateContainerOptions{
+		Name:       "c1",
+		Config:     &docker.Config{Image: "busybox:latest"},
+		HostConfig: &docker.HostConfig{RestartPolicy: docker.RestartOnFailure(1)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected create error %v", err)
+	} else if err := f.ExitContainer(c.ID, 1); err == nil {
+		t.Errorf("expected an error ending a stopped container")
+	} else if err := f.StartContainer(c.ID, nil); err != nil {
+		t.Errorf("unexpected start error %v", err)
+	}
+
+	// the container is restarted once by its restart policy
+	if err := f.ExitContainer(c.ID, 1); err != nil {
+		t.Errorf("unexpected exit error %v", err)
+	} else if inspected, _ := f.InspectContainer(c.ID); !inspected.State.Running || inspected.RestartCount != 1 {
+		t.Errorf("expected the container to be restarted once, got %v restarts, state %v", inspected.RestartCount, inspected.State)
+	}
+	if err := f.ExitContainer(c.ID, 1); err != nil {
+		t.Errorf("unexpected exit error %v", err)
+	} else if inspected, _ := f.InspectContainer(c.ID); inspected.State.Running || inspected.State.ExitCode != 1 || inspected.RestartCount != 1 {
+		t.Errorf("expected the container to stay stopped, got %v restarts, state %v", inspected.RestartCount, inspected.State)
+	}
+}
+
+func Test_FakeRuntime_LoadImage(t *testing.T) {
+	config := []byte(`{"rootfs":{"type":"layers","diff_ids":["sha256:1111"]}}`)
+	archive := func(files map[string][]byte) *bytes.Buffer {
+		var b bytes.Buffer
+		tw := tar.NewWriter(&b)
+		for name, content := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+			tw.Write(content)
+		}
+		tw.Close()
+		return &b
+	}
+	manifest := []byte(`[{"Config":"config.json","RepoTags":["myimage:1.0"],"Layers":["layer.tar"]}]`)
+
+	f := NewFakeRuntime()
+	if err := f.LoadImage(docker.LoadImageOptions{InputStream: archive(map[string][]byte{"manifest.json": manifest, "config.json": config})}); err == nil {
+		t.Errorf("expected an error loading an archive without the layer")
+	} else if err := f.LoadImage(docker.LoadImageOptions{InputStream: archive(map[string][]byte{"manifest.json": manifest, "config.json": config, "layer.tar": []byte("layer")})}); err != nil {
+		t.Errorf("unexpected load error %v", err)
+	}
+
+	// the image id is the digest of the config
+	id := fmt.Sprintf("sha256:%x", sha256.Sum256(config))
+	if _, err := f.InspectImage(id); err != nil {
+		t.Errorf("unexpected inspect error %v", err)
+	} else if img, err := f.InspectImage("myimage:1.0"); err != nil || img.ID != id {
+		t.Errorf("expected image myimage:1.0 to have id %v, got %v %v", id, img, err)
+	}
+}
@@ -42,6 +42,7 @@ const (
 	IMAGE_FETCH_ERROR      EventId = "IMAGE_FETCH_ERROR"
 	IMAGE_FETCH_AUTH_ERROR EventId = "IMAGE_FETCH_AUTH_ERROR"
 	IMAGE_SIG_VERIF_ERROR  EventId = "IMAGE_SIG_VERIF_ERROR"
+	IMAGE_PREFETCH         EventId = "IMAGE_PREFETCH"
 
 	// container-related
 	EXECUTION_FAILED    EventId = "EXECUTION_FAILED"
@@ -75,6 +76,7 @@ const (
 	DEVICE_AGREEMENTS_SYNCED EventId = "DEVICE_AGREEMENTS_SYNCED"
 	DEVICE_CONTAINERS_SYNCED EventId = "DEVICE_CONTAINERS_SYNCED"
 	WORKLOAD_UPGRADE         EventId = "WORKLOAD_UPGRADE"
+	WORKLOAD_VERSION_BAD     EventId = "WORKLOAD_VERSION_BAD"
 	PROPOSAL_ACCEPTED        EventId = "PROPOSAL_ACCEPTED"
 
 	// Node related
@@ -148,10 +150,11 @@ type AgreementLaunchContext struct {
 	ConfigureRaw         []byte
 	EnvironmentAdditions *map[string]string // provided by platform, not but user
 	Microservices        []MicroserviceSpec // for ms split.
+	SecretBindings       map[string]string  // secret name to secret provider key, the secret values are fetched at launch.
 }
 
 func (c AgreementLaunchContext) String() string {
-	return fmt.Sprintf("AgreementProtocol: %v, AgreementId: %v, Configure: %v, EnvironmentAdditions: %v, Microservices: %v", c.AgreementProtocol, c.AgreementId, c.Configure, c.EnvironmentAdditions, c.Microservices)
+	return fmt.Sprintf("AgreementProtocol: %v, AgreementId: %v, Configure: %v, EnvironmentAdditions: %v, Microservices: %v, SecretBindings: %v", c.AgreementProtocol, c.AgreementId, c.Configure, c.EnvironmentAdditions, c.Microservices, c.SecretBindings)
 }
 
 func (c AgreementLaunchContext) ShortString() string {
@@ -233,10 +236,11 @@ type ContainerLaunchContext struct {
 	Microservices        []MicroserviceSpec                     // Service dependencies go here. Microservices (in the workload/microservice model) never have dependencies.
 	ServicePathElement   persistence.ServiceInstancePathElement // The service that we're trying to start.
 	IsRetry              bool
+	SecretBindings       map[string]string // secret name to secret provider key, the secret values are fetched at launch.
 }
 
 func (c ContainerLaunchContext) String() string {
-	return fmt.Sprintf("ContainerConfig: %v, EnvironmentAdditions: %v, Blockchain: %v, Name: %v, AgreementIds: %v, ServiceDependencies: %v, ThisService: %v, IsRetry: %v", c.Configure, c.EnvironmentAdditions, c.Blockchain, c.Name, c.AgreementIds, c.Microservices, c.ServicePathElement, c.IsRetry)
+	return fmt.Sprintf("ContainerConfig: %v, EnvironmentAdditions: %v, Blockchain: %v, Name: %v, AgreementIds: %v, ServiceDependencies: %v, ThisService: %v, IsRetry: %v, SecretBindings: %v", c.Configure, c.EnvironmentAdditions, c.Blockchain, c.Name, c.AgreementIds, c.Microservices, c.ServicePathElement, c.IsRetry, c.SecretBindings)
 }
 
 func (c ContainerLaunchContext) ShortString() string {
@@ -806,6 +810,42 @@ func NewImageFetchMessage(id EventId, deploymentDescription *containermessage.De
 	}
 }
 
+// Asks the image fetcher to pull the images of a service version that the node is likely to run soon, such as a newer
+// version of a service that is running, so that the upgrade does not have to wait for the images.
+type ImagePrefetchMessage struct {
+	event           Event
+	ServiceURL      string
+	ServiceOrg      string
+	ServiceVersion  string
+	ContainerConfig ContainerConfig
+}
+
+// fulfill interface of events.Message
+func (m *ImagePrefetchMessage) Event() Event {
+	return m.event
+}
+
+func (m *ImagePrefetchMessage) String() string {
+	return fmt.Sprintf("event: %v, service: %v/%v version %v, container config: %v", m.event, m.ServiceOrg, m.ServiceURL, m.ServiceVersion, m.ContainerConfig.ShortString())
+}
+
+func (m *ImagePrefetchMessage) ShortString() string {
+	return m.String()
+}
+
+func NewImagePrefetchMessage(id EventId, serviceURL string, serviceOrg string, serviceVersion string, containerConfig ContainerConfig) *ImagePrefetchMessage {
+
+	return &ImagePrefetchMessage{
+		event: Event{
+			Id: id,
+		},
+		ServiceURL:      serviceURL,
+		ServiceOrg:      serviceOrg,
+		ServiceVersion:  serviceVersion,
+		ContainerConfig: containerConfig,
+	}
+}
+
 // Governance messages
 type GovernanceMaintenanceMessage struct {
 	event             Event
@@ -1103,6 +1143,41 @@ func NewABApiWorkloadUpgradeMessage(id EventId, protocol string, agreementId str
 	}
 }
 
+// Sent by the agbot when a workload version of a policy failed on too many nodes and the nodes are rolled back.
+type BadWorkloadVersionMessage struct {
+	event           Event
+	PolicyName      string
+	Version         string
+	FallbackVersion string
+	Devices         int
+	FailedDevices   []string
+}
+
+func (m *BadWorkloadVersionMessage) Event() Event {
+	return m.event
+}
+
+func (m BadWorkloadVersionMessage) String() string {
+	return fmt.Sprintf("Event: %v, PolicyName: %v, Version: %v, FallbackVersion: %v, Devices: %v, FailedDevices: %v", m.event, m.PolicyName, m.Version, m.FallbackVersion, m.Devices, m.FailedDevices)
+}
+
+func (m BadWorkloadVersionMessage) ShortString() string {
+	return m.String()
+}
+
+func NewBadWorkloadVersionMessage(id EventId, policyName string, version string, fallbackVersion string, devices int, failedDevices []string) *BadWorkloadVersionMessage {
+	return &BadWorkloadVersionMessage{
+		event: Event{
+			Id: id,
+		},
+		PolicyName:      policyName,
+		Version:         version,
+		FallbackVersion: fallbackVersion,
+		Devices:         devices,
+		FailedDevices:   failedDevices,
+	}
+}
+
 // Initialization and restart messages
 type InitAgreementCancelationMessage struct {
 	event             Event
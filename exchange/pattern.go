@@ -11,24 +11,26 @@ import (
 )
 
 type Pattern struct {
-	Owner              string              `json:"owner"`
-	Label              string              `json:"label"`
-	Description        string              `json:"description"`
-	Public             bool                `json:"public"`
-	Services           []ServiceReference  `json:"services"`
-	AgreementProtocols []AgreementProtocol `json:"agreementProtocols"`
-	UserInput          []policy.UserInput  `json:"userInput,omitempty"`
+	Owner              string                 `json:"owner"`
+	Label              string                 `json:"label"`
+	Description        string                 `json:"description"`
+	Public             bool                   `json:"public"`
+	Services           []ServiceReference     `json:"services"`
+	AgreementProtocols []AgreementProtocol    `json:"agreementProtocols"`
+	UserInput          []policy.UserInput     `json:"userInput,omitempty"`
+	SecretBinding      []policy.SecretBinding `json:"secretBinding,omitempty"`
 }
 
 func (w Pattern) String() string {
-	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Public: %v, Services: %v, AgreementProtocols: %v, UserInput: %v",
+	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Public: %v, Services: %v, AgreementProtocols: %v, UserInput: %v, SecretBinding: %v",
 		w.Owner,
 		w.Label,
 		w.Description,
 		w.Public,
 		w.Services,
 		w.AgreementProtocols,
-		w.UserInput)
+		w.UserInput,
+		w.SecretBinding)
 }
 
 func (w Pattern) ShortString() string {
@@ -69,6 +71,8 @@ func (w Pattern) DeepCopy() *Pattern {
 		newPattern.UserInput = newUserInput
 	}
 
+	newPattern.SecretBinding = policy.CopySecretBindings(w.SecretBinding)
+
 	return &newPattern
 }
 
@@ -81,7 +85,7 @@ type WorkloadPriority struct {
 
 type UpgradePolicy struct {
 	Lifecycle string `json:"lifecycle,omitempty"` // immediate, never, agreement
-	Time      string `json:"time,omitempty"`      // the time of the upgrade
+	Time      string `json:"time,omitempty"`      // the maintenance window in which the upgrade can be deployed
 }
 
 type WorkloadChoice struct {
@@ -316,6 +320,7 @@ func ConvertChoice(wl WorkloadChoice, url string, org string, arch string, pol *
 	newWL.Priority = (*policy.Workload_Priority_Factory(wl.Priority.PriorityValue, wl.Priority.Retries, wl.Priority.RetryDurationS, wl.Priority.VerifiedDurationS))
 	newWL.DeploymentOverrides = wl.DeploymentOverrides
 	newWL.DeploymentOverridesSignature = wl.DeploymentOverridesSignature
+	newWL.UpgradeTime = wl.Upgrade.Time
 	pol.Add_Workload(newWL)
 }
 
@@ -377,6 +382,9 @@ func ConvertCommon(p *Pattern, patternId string, dv DataVerification, nodeh Node
 	pol.UserInput = make([]policy.UserInput, len(p.UserInput))
 	copy(pol.UserInput, p.UserInput)
 
+	// make a copy of the secret bindings
+	pol.SecretBinding = policy.CopySecretBindings(p.SecretBinding)
+
 }
 
 // Structs and types for working with pattern based exchange searches
@@ -73,6 +73,16 @@ func (ui UserInput) String() string {
 	return fmt.Sprintf("{Name: %v, :Label: %v, Type: %v, DefaultValue: %v}", ui.Name, ui.Label, ui.Type, ui.DefaultValue)
 }
 
+// A secret used by a service. The value of the secret is bound by the deployment policy or pattern.
+type Secret struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+func (s Secret) String() string {
+	return fmt.Sprintf("{Name: %v, Description: %v}", s.Name, s.Description)
+}
+
 // This is the structure of the object returned on a GET /service.
 // microservice sharing mode
 const MS_SHARING_MODE_EXCLUSIVE = "exclusive"
@@ -93,6 +103,7 @@ type ServiceDefinition struct {
 	MatchHardware              HardwareRequirement `json:"matchHardware"`
 	RequiredServices           []ServiceDependency `json:"requiredServices"`
 	UserInputs                 []UserInput         `json:"userInput"`
+	Secrets                    []Secret            `json:"secrets,omitempty"`
 	Deployment                 string              `json:"deployment"`
 	DeploymentSignature        string              `json:"deploymentSignature"`
 	ClusterDeployment          string              `json:"clusterDeployment"`          // used for cluster node type
@@ -112,13 +123,14 @@ func (s ServiceDefinition) String() string {
 		"MatchHardware: %v, "+
 		"RequiredServices: %v, "+
 		"UserInputs: %v, "+
+		"Secrets: %v, "+
 		"Deployment: %v, "+
 		"DeploymentSignature: %v, "+
 		"ClusterDeployment: %v, "+
 		"ClusterDeploymentSignature: %v, "+
 		"LastUpdated: %v",
 		s.Owner, s.Label, s.Description, s.Public, s.URL, s.Version, s.Arch, s.Sharable,
-		s.MatchHardware, s.RequiredServices, s.UserInputs,
+		s.MatchHardware, s.RequiredServices, s.UserInputs, s.Secrets,
 		s.Deployment, s.DeploymentSignature, s.ClusterDeployment, s.ClusterDeploymentSignature,
 		s.LastUpdated)
 }
@@ -153,6 +165,32 @@ func (s *ServiceDefinition) NeedsUserInput() bool {
 	return false
 }
 
+// Returns the names of the secrets used by the service.
+func (s *ServiceDefinition) GetSecretNames() []string {
+	names := []string{}
+	for _, secret := range s.Secrets {
+		names = append(names, secret.Name)
+	}
+	return names
+}
+
+// Bind the secrets of each of the services in a dependency tree to keys in the secret provider. The service definitions
+// are keyed by exchange service id, as returned by the ServiceDefResolver. The result maps the id of each service that
+// uses secrets to its bindings. An error is returned if any of the secrets is not bound.
+func ResolveDependencySecretBindings(depSvcDefs map[string]ServiceDefinition, bindings []policy.SecretBinding) (map[string]map[string]string, error) {
+	resolved := make(map[string]map[string]string)
+	for id, sDef := range depSvcDefs {
+		if names := sDef.GetSecretNames(); len(names) != 0 {
+			if sb, err := policy.ResolveSecretBindings(names, sDef.URL, GetOrg(id), sDef.Version, sDef.Arch, bindings); err != nil {
+				return nil, err
+			} else {
+				resolved[id] = sb
+			}
+		}
+	}
+	return resolved, nil
+}
+
 func (s *ServiceDefinition) PopulateDefaultUserInput(envAdds map[string]string) {
 	for _, ui := range s.UserInputs {
 		if ui.DefaultValue != "" {
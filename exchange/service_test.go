@@ -5,6 +5,7 @@ package exchange
 import (
 	"errors"
 	"flag"
+	"github.com/open-horizon/anax/policy"
 	"testing"
 )
 
@@ -30,7 +31,7 @@ func TestServiceString1(t *testing.T) {
 	str := s.String()
 	t.Log(str)
 
-	expected := `Owner: testOwner, Label: service def, Description: a test, Public: false, URL: http://test.company.com/service1, Version: 1.0.0, Arch: amd64, Sharable: singleton, MatchHardware: none, RequiredServices: [], UserInputs: [], Deployment: {"services":{}}, DeploymentSignature: xyzpdq=, ClusterDeployment: {}, ClusterDeploymentSignature: abcdef=, LastUpdated: today`
+	expected := `Owner: testOwner, Label: service def, Description: a test, Public: false, URL: http://test.company.com/service1, Version: 1.0.0, Arch: amd64, Sharable: singleton, MatchHardware: none, RequiredServices: [], UserInputs: [], Secrets: [], Deployment: {"services":{}}, DeploymentSignature: xyzpdq=, ClusterDeployment: {}, ClusterDeploymentSignature: abcdef=, LastUpdated: today`
 	if str != expected {
 		t.Errorf("String() output expected: %v", expected)
 	}
@@ -86,7 +87,7 @@ func TestServiceString2(t *testing.T) {
 	str := s.String()
 	t.Log(str)
 
-	expected := `Owner: testOwner, Label: service def, Description: a test, Public: false, URL: http://test.company.com/service1, Version: 1.0.0, Arch: amd64, Sharable: singleton, MatchHardware: {dev:/dev/dev1}, RequiredServices: [{URL: http://my.com/ms/ms1, Org: otherOrg, Version: 1.5.0, VersionRange: , Arch: amd64} {URL: http://my.com/ms/ms2, Org: otherOrg, Version: 2.7, VersionRange: , Arch: amd64}], UserInputs: [{Name: name, :Label: a ui, Type: string, DefaultValue: } {Name: name2, :Label: another ui, Type: string, DefaultValue: three}], Deployment: {"services":{}}, DeploymentSignature: xyzpdq=, ClusterDeployment: {}, ClusterDeploymentSignature: abcdef=, LastUpdated: today`
+	expected := `Owner: testOwner, Label: service def, Description: a test, Public: false, URL: http://test.company.com/service1, Version: 1.0.0, Arch: amd64, Sharable: singleton, MatchHardware: {dev:/dev/dev1}, RequiredServices: [{URL: http://my.com/ms/ms1, Org: otherOrg, Version: 1.5.0, VersionRange: , Arch: amd64} {URL: http://my.com/ms/ms2, Org: otherOrg, Version: 2.7, VersionRange: , Arch: amd64}], UserInputs: [{Name: name, :Label: a ui, Type: string, DefaultValue: } {Name: name2, :Label: another ui, Type: string, DefaultValue: three}], Secrets: [], Deployment: {"services":{}}, DeploymentSignature: xyzpdq=, ClusterDeployment: {}, ClusterDeploymentSignature: abcdef=, LastUpdated: today`
 	if str != expected {
 		t.Errorf("String() output expected: %v", expected)
 	}
@@ -397,6 +398,43 @@ func TestService_PopulateDefaultUserInput(t *testing.T) {
 
 }
 
+func TestService_ResolveDependencySecretBindings(t *testing.T) {
+
+	depSvcDefs := map[string]ServiceDefinition{
+		"otherOrg/http://my.com/ms/ms1_1.5.0_amd64": ServiceDefinition{
+			URL:     "http://my.com/ms/ms1",
+			Version: "1.5.0",
+			Arch:    "amd64",
+			Secrets: []Secret{Secret{Name: "db_password"}},
+		},
+		"otherOrg/http://my.com/ms/ms2_2.7.0_amd64": ServiceDefinition{
+			URL:     "http://my.com/ms/ms2",
+			Version: "2.7.0",
+			Arch:    "amd64",
+		},
+	}
+
+	bindings := []policy.SecretBinding{
+		policy.SecretBinding{
+			ServiceOrgid: "otherOrg",
+			ServiceUrl:   "http://my.com/ms/ms1",
+			Secrets:      []policy.BoundSecret{policy.BoundSecret{Name: "db_password", Key: "prod/db"}},
+		},
+	}
+
+	if resolved, err := ResolveDependencySecretBindings(depSvcDefs, bindings); err != nil {
+		t.Errorf("no error expected, got %v", err)
+	} else if len(resolved) != 1 {
+		t.Errorf("only the service with secrets should be bound, got %v", resolved)
+	} else if key := resolved["otherOrg/http://my.com/ms/ms1_1.5.0_amd64"]["db_password"]; key != "prod/db" {
+		t.Errorf("wrong key %v bound to the secret", key)
+	}
+
+	if _, err := ResolveDependencySecretBindings(depSvcDefs, nil); err == nil {
+		t.Errorf("error expected for a dependent service with an unbound secret")
+	}
+}
+
 func TestService_GetDeployment(t *testing.T) {
 
 	targetD := `{"services":{}}`
@@ -9,6 +9,7 @@ import (
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/externalpolicy"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
 	"io/ioutil"
 	"os"
 	"sync"
@@ -361,6 +362,11 @@ func UpdateNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB, nodePoli
 	if err := nodePolicy.ValidateAndNormalize(); err != nil {
 		return fmt.Errorf("Node policy does not validate. %v", err)
 	}
+	if _, err := policy.NodeMaintenanceWindow(nodePolicy.Properties); err != nil {
+		return fmt.Errorf("Node policy does not validate. %v", err)
+	} else if _, err := policy.NodeRequiresSignedImages(nodePolicy.Properties); err != nil {
+		return fmt.Errorf("Node policy does not validate. %v", err)
+	}
 
 	// add node's built-in properties
 	existingPol, err := persistence.FindNodePolicy(db)
@@ -421,6 +427,11 @@ func PatchNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB, patchObje
 	if err := localNodePolicy.ValidateAndNormalize(); err != nil {
 		return nil, err
 	}
+	if _, err := policy.NodeMaintenanceWindow(localNodePolicy.Properties); err != nil {
+		return nil, err
+	} else if _, err := policy.NodeRequiresSignedImages(localNodePolicy.Properties); err != nil {
+		return nil, err
+	}
 
 	// save it into the exchange and sync the local db with it.
 	if _, err := nodePutPolicyHandler(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &exchange.ExchangePolicy{ExternalPolicy: *localNodePolicy}); err != nil {
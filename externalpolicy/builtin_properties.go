@@ -11,12 +11,14 @@ import (
 // The user defined policies (business policy, node policy) need to add constraints on these properties if needed.
 const (
 	// for node policy
-	PROP_NODE_CPU         = "openhorizon.cpu"               // The number of CPUs
-	PROP_NODE_MEMORY      = "openhorizon.memory"            // The amount of memory in MBs
-	PROP_NODE_ARCH        = "openhorizon.arch"              // The hardware architecture of the node (e.g. amd64, armv6, etc)
-	PROP_NODE_HARDWAREID  = "openhorizon.hardwareId"        // The device serial number if it can be found. A generated Id otherwise.
-	PROP_NODE_PRIVILEGED  = "openhorizon.allowPrivileged"   // Property set to determine if privileged services may be run on this device. Can be set by user, default is false.
-	PROP_NODE_K8S_VERSION = "openhorizon.kubernetesVersion" // Server version of the cluster the agent is running in
+	PROP_NODE_CPU               = "openhorizon.cpu"                 // The number of CPUs
+	PROP_NODE_MEMORY            = "openhorizon.memory"              // The amount of memory in MBs
+	PROP_NODE_ARCH              = "openhorizon.arch"                // The hardware architecture of the node (e.g. amd64, armv6, etc)
+	PROP_NODE_HARDWAREID        = "openhorizon.hardwareId"          // The device serial number if it can be found. A generated Id otherwise.
+	PROP_NODE_PRIVILEGED        = "openhorizon.allowPrivileged"     // Property set to determine if privileged services may be run on this device. Can be set by user, default is false.
+	PROP_NODE_K8S_VERSION       = "openhorizon.kubernetesVersion"   // Server version of the cluster the agent is running in
+	PROP_NODE_MAINT_WINDOW      = "openhorizon.maintenanceWindow"   // When workload upgrades can be deployed to the node. Can be set by user, default is any time.
+	PROP_NODE_REQ_SIGNED_IMAGES = "openhorizon.requireSignedImages" // Property set to require the images of the services on the node to be signed by a key in the agent trust store. Can be set by user, default is false.
 
 	// for service policy
 	PROP_SVC_URL        = "openhorizon.service.url"     // The unique name of the service.
@@ -0,0 +1,110 @@
+package cel_language
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
+	"github.com/open-horizon/anax/i18n"
+	"strings"
+)
+
+// Constraints written in this language start with this prefix, which is how the plugin recognizes them, e.g.
+// "cel: openhorizon.memory / 1024 >= 2 && openhorizon.arch.startsWith(\"arm\")"
+const CEL_PREFIX = "cel:"
+
+func init() {
+	plugin_registry.Register("cel", NewCELConstraintLanguagePlugin())
+}
+
+// The CEL plugin supports a subset of the Common Expression Language, with arithmetic, functions such as
+// startsWith and size, and list membership tests over list properties. Because such expressions cannot be
+// decomposed into name/operator/value triples, the plugin evaluates them itself.
+type CELConstraintLanguagePlugin struct {
+}
+
+func NewCELConstraintLanguagePlugin() plugin_registry.ConstraintLanguagePlugin {
+	return new(CELConstraintLanguagePlugin)
+}
+
+// Claim ownership of the constraints if any of them has the CEL prefix. All of the constraints passed in one call
+// must then be written in this language. A ConstraintExpression validates each of its constraints on its own, so the
+// constraints of merged policies can mix this language with others.
+func (p *CELConstraintLanguagePlugin) Validate(dconstraints interface{}) (bool, []string, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	constraints, ok := dconstraints.([]string)
+	if !ok {
+		return false, []string{}, errors.New(msgPrinter.Sprintf("The constraint expression: %v is type %T, but is expected to be an array of strings", dconstraints, dconstraints))
+	}
+
+	owned := false
+	for _, constraint := range constraints {
+		if IsCELConstraint(constraint) {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		return false, nil, nil
+	}
+
+	validConstraints := make([]string, 0, len(constraints))
+	for _, constraint := range constraints {
+		if !IsCELConstraint(constraint) {
+			return true, nil, errors.New(msgPrinter.Sprintf("The constraint expression %v does not start with %v. Constraints in the %v language cannot be mixed with constraints in other languages.", constraint, CEL_PREFIX, "cel"))
+		} else if _, err := parse(stripPrefix(constraint)); err != nil {
+			return true, nil, errors.New(msgPrinter.Sprintf("The constraint expression %v is not valid: %v", constraint, err))
+		}
+		validConstraints = append(validConstraints, constraint)
+	}
+
+	return true, validConstraints, nil
+}
+
+// CEL expressions are evaluated as a whole by Evaluate, they are not decomposed into property expressions.
+func (p *CELConstraintLanguagePlugin) GetNextExpression(expression string) (string, string, error) {
+	return "", expression, fmt.Errorf("constraint expression %v must be evaluated as a whole", expression)
+}
+
+func (p *CELConstraintLanguagePlugin) GetNextOperator(expression string) (string, string, error) {
+	return "", expression, fmt.Errorf("constraint expression %v must be evaluated as a whole", expression)
+}
+
+// Evaluate the expression against the input properties. An expression that refers to a property which is
+// not in the input, or that cannot otherwise be evaluated, is not satisfied. Only a syntactically invalid
+// expression returns an error.
+func (p *CELConstraintLanguagePlugin) Evaluate(expression string, props []plugin_registry.PropertyValue) (*plugin_registry.ExpressionEvaluation, error) {
+	tree, err := parse(stripPrefix(expression))
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]interface{}, len(props))
+	for _, prop := range props {
+		env[prop.Name] = normalizeValue(prop.Value, prop.Type)
+	}
+
+	eval := evaluationTree(tree, env)
+	eval.Expression = strings.TrimSpace(expression)
+	if !eval.Satisfied {
+		if result, err := tree.eval(env); err == nil {
+			if _, ok := result.(bool); !ok {
+				eval.Reason = fmt.Sprintf("the expression evaluates to %v, not a boolean", formatValue(result))
+				return &eval, nil
+			}
+		}
+		eval.Reason = explain(tree, env)
+	}
+	return &eval, nil
+}
+
+// Return true if the input constraint is written in this language.
+func IsCELConstraint(constraint string) bool {
+	return strings.HasPrefix(strings.TrimSpace(constraint), CEL_PREFIX)
+}
+
+func stripPrefix(constraint string) string {
+	return strings.TrimPrefix(strings.TrimSpace(constraint), CEL_PREFIX)
+}
@@ -0,0 +1,230 @@
+// +build unit
+
+package cel_language
+
+import (
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
+	_ "github.com/open-horizon/anax/externalpolicy/text_language"
+	"strings"
+	"testing"
+)
+
+func getTestProperties() []plugin_registry.PropertyValue {
+	return []plugin_registry.PropertyValue{
+		{Name: "openhorizon.memory", Value: float64(4096), Type: "int"},
+		{Name: "openhorizon.arch", Value: "arm64", Type: "string"},
+		{Name: "cameras", Value: 2, Type: "int"},
+		{Name: "zones", Value: "east, \"west\",north", Type: externalpolicy.LIST_TYPE},
+		{Name: "gpu", Value: true, Type: "boolean"},
+		{Name: "fwVersion", Value: "2.3.1", Type: "version"},
+	}
+}
+
+func Test_Validate_Succeed(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin()
+	constraints := []string{
+		"cel: openhorizon.memory / 1024 >= 2 && openhorizon.arch.startsWith(\"arm\")",
+		"cel:size(zones) > 1 || !gpu",
+		"cel: 'west' in zones && has(cameras) && (cameras * 2 + 1) % 2 == 1",
+		"cel: versionInRange(fwVersion, \"[2.0.0,3.0.0)\") && [1, 2, 3].contains(cameras)",
+	}
+
+	if owned, validated, err := plugin.Validate(interface{}(constraints)); !owned {
+		t.Errorf("plugin should own the constraints %v", constraints)
+	} else if err != nil {
+		t.Errorf("constraints should be valid, but returned err: %v", err)
+	} else if len(validated) != len(constraints) {
+		t.Errorf("expected %v validated constraints, got %v", len(constraints), validated)
+	}
+}
+
+func Test_Validate_NotOwned(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin()
+
+	if owned, _, err := plugin.Validate(interface{}([]string{"iame2edev == true && cpu == 3"})); owned || err != nil {
+		t.Errorf("plugin should not own text constraints, owned: %v, err: %v", owned, err)
+	} else if owned, _, err := plugin.Validate(interface{}("cel: a == 1")); owned || err == nil {
+		t.Errorf("plugin should not own a non string array, owned: %v, err: %v", owned, err)
+	}
+}
+
+func Test_Validate_Failed(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin()
+	invalid := [][]string{
+		{"cel: cpu == 3", "memory >= 32"},
+		{"cel: cpu == "},
+		{"cel: (cpu == 3"},
+		{"cel: cpu.explode(3)"},
+		{"cel: startsWith(arch)"},
+		{"cel: has(1)"},
+		{"cel: name == \"unterminated"},
+		{"cel: cpu == 3 $ 4"},
+	}
+
+	for _, constraints := range invalid {
+		if owned, _, err := plugin.Validate(interface{}(constraints)); !owned {
+			t.Errorf("plugin should own the constraints %v", constraints)
+		} else if err == nil {
+			t.Errorf("constraints %v should not be valid", constraints)
+		}
+	}
+}
+
+func Test_Evaluate_Satisfied(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin().(plugin_registry.ConstraintLanguageEvaluator)
+	props := getTestProperties()
+	expressions := []string{
+		"cel: openhorizon.memory / 1024 >= 2 && openhorizon.arch.startsWith(\"arm\")",
+		"cel: size(zones) == 3 && \"west\" in zones && zones.contains(\"north\")",
+		"cel: gpu && cameras - 1 == 1",
+		"cel: !has(location) && len(openhorizon.arch) == 5",
+		"cel: versionInRange(fwVersion, \"[2.0.0,3.0.0)\")",
+		"cel: openhorizon.arch.matches(\"^arm(64)?$\") && openhorizon.arch.endsWith(\"64\")",
+		"cel: location == \"home\" || cameras >= 2",
+		"cel: int(\"7\") + double(\"0.5\") == 7.5 && string(cameras) == \"2\"",
+	}
+
+	for _, exp := range expressions {
+		if eval, err := plugin.Evaluate(exp, props); err != nil {
+			t.Errorf("expression %v returned err: %v", exp, err)
+		} else if !eval.Satisfied {
+			t.Errorf("expression %v should be satisfied, reason: %v", exp, eval.Reason)
+		}
+	}
+}
+
+func Test_Evaluate_NotSatisfied(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin().(plugin_registry.ConstraintLanguageEvaluator)
+	props := getTestProperties()
+	expressions := map[string]string{
+		"cel: openhorizon.memory / 1024 >= 8 && gpu":        "'openhorizon.memory / 1024 >= 8' is false (openhorizon.memory=4096)",
+		"cel: \"south\" in zones":                           "'\"south\" in zones' is false (zones=[\"east\", \"west\", \"north\"])",
+		"cel: location == \"home\"":                         "property location is not defined",
+		"cel: cameras > 4 || openhorizon.arch == \"amd64\"": "'cameras > 4' is false (cameras=2), and 'openhorizon.arch == \"amd64\"' is false",
+		"cel: cameras / 0 == 1":                             "division by zero",
+		"cel: cameras + 1":                                  "not a boolean",
+		"cel: openhorizon.arch < 3":                         "cannot be applied",
+	}
+
+	for exp, expectedReason := range expressions {
+		if eval, err := plugin.Evaluate(exp, props); err != nil {
+			t.Errorf("expression %v returned err: %v", exp, err)
+		} else if eval.Satisfied {
+			t.Errorf("expression %v should not be satisfied", exp)
+		} else if !strings.Contains(eval.Reason, expectedReason) {
+			t.Errorf("expression %v reason %v does not contain %v", exp, eval.Reason, expectedReason)
+		}
+	}
+
+	if _, err := plugin.Evaluate("cel: cameras ==", props); err == nil {
+		t.Errorf("invalid expression should return an error")
+	}
+}
+
+func Test_Evaluate_Tree(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin().(plugin_registry.ConstraintLanguageEvaluator)
+	props := getTestProperties()
+
+	exp := "cel: openhorizon.memory / 1024 >= 8 && gpu && (cameras > 4 || \"west\" in zones)"
+	eval, err := plugin.Evaluate(exp, props)
+	if err != nil {
+		t.Fatalf("expression %v returned err: %v", exp, err)
+	} else if eval.Satisfied || eval.Operator != "&&" || eval.Expression != exp {
+		t.Errorf("unexpected root of the evaluation tree: %v", eval)
+	} else if len(eval.Children) != 3 {
+		t.Fatalf("expected 3 children, got %v", eval.Children)
+	}
+
+	if c := eval.Children[0]; c.Satisfied || c.Operator != ">=" || c.Properties["openhorizon.memory"] != float64(4096) || c.Reason == "" {
+		t.Errorf("unexpected evaluation of the memory clause: %v", c)
+	} else if c := eval.Children[1]; !c.Satisfied || c.Properties["gpu"] != true {
+		t.Errorf("unexpected evaluation of the gpu clause: %v", c)
+	} else if c := eval.Children[2]; !c.Satisfied || c.Operator != "||" || len(c.Children) != 2 || c.Children[0].Satisfied || !c.Children[1].Satisfied {
+		t.Errorf("unexpected evaluation of the or clause: %v", c)
+	}
+
+	eval, err = plugin.Evaluate("cel: location == \"home\"", props)
+	if err != nil {
+		t.Errorf("returned err: %v", err)
+	} else if v, ok := eval.Properties["location"]; !ok || v != nil {
+		t.Errorf("undefined property should be in the evaluation with a nil value: %v", eval)
+	}
+}
+
+func Test_Evaluate_Versions(t *testing.T) {
+	plugin := NewCELConstraintLanguagePlugin().(plugin_registry.ConstraintLanguageEvaluator)
+	props := []plugin_registry.PropertyValue{{Name: "fwVersion", Value: "1.10", Type: externalpolicy.VERSION_TYPE}}
+
+	for exp, satisfied := range map[string]bool{
+		"cel: fwVersion > \"1.9\"":     true,
+		"cel: fwVersion < \"1.9\"":     false,
+		"cel: fwVersion >= \"1.10.0\"": true,
+		"cel: \"abc\" < \"abd\"":       true,
+	} {
+		if eval, err := plugin.Evaluate(exp, props); err != nil {
+			t.Errorf("expression %v returned err: %v", exp, err)
+		} else if eval.Satisfied != satisfied {
+			t.Errorf("expression %v should be %v, evaluation: %v", exp, satisfied, eval)
+		}
+	}
+}
+
+func Test_ConstraintExpression_IsSatisfiedBy(t *testing.T) {
+	props := []externalpolicy.Property{*(externalpolicy.Property_Factory("openhorizon.memory", 4096)), *(externalpolicy.Property_Factory("openhorizon.arch", "arm64")), *(externalpolicy.Property_Factory("zones", "east,west"))}
+	props[2].Type = externalpolicy.LIST_TYPE
+
+	ce := externalpolicy.ConstraintExpression{"cel: openhorizon.memory / 1024 >= 2 && openhorizon.arch.startsWith(\"arm\")", "cel: \"west\" in zones"}
+	if _, err := ce.Validate(); err != nil {
+		t.Errorf("Error: constraint %v should be valid, error %v", ce, err)
+	} else if err := ce.IsSatisfiedBy(props); err != nil {
+		t.Errorf("Error: constraint %v should be satisfied, error %v", ce, err)
+	} else if rp, err := externalpolicy.RequiredPropertyFromConstraint(&ce); err != nil {
+		t.Errorf("Error: constraint %v should be converted to a RequiredProperty, error %v", ce, err)
+	} else if err := rp.IsSatisfiedBy(props); err != nil {
+		t.Errorf("Error: required property %v should be satisfied, error %v", rp, err)
+	}
+
+	ce = externalpolicy.ConstraintExpression{"cel: openhorizon.memory >= 8192"}
+	if err := ce.IsSatisfiedBy(props); err == nil {
+		t.Errorf("Error: constraint %v should not be satisfied", ce)
+	} else if !strings.Contains(err.Error(), "'openhorizon.memory >= 8192' is false (openhorizon.memory=4096)") {
+		t.Errorf("Error: unexpected explanation %v", err)
+	}
+}
+
+// The constraints of a deployment policy merged with the constraints of a node or service policy can be written in
+// different languages.
+func Test_ConstraintExpression_MixedLanguages(t *testing.T) {
+	props := []externalpolicy.Property{*(externalpolicy.Property_Factory("openhorizon.memory", 4096)), *(externalpolicy.Property_Factory("openhorizon.arch", "arm64"))}
+
+	ce := externalpolicy.ConstraintExpression{"cel: openhorizon.memory >= 1024"}
+	ce.MergeWith(&externalpolicy.ConstraintExpression{"openhorizon.arch == arm64"})
+	if validated, err := ce.Validate(); err != nil {
+		t.Errorf("Error: constraint %v should be valid, error %v", ce, err)
+	} else if len(validated) != 2 {
+		t.Errorf("Error: expected 2 validated constraints, got %v", validated)
+	} else if err := ce.IsSatisfiedBy(props); err != nil {
+		t.Errorf("Error: constraint %v should be satisfied, error %v", ce, err)
+	}
+
+	ce = externalpolicy.ConstraintExpression{"cel: openhorizon.memory >= 1024", "openhorizon.arch == amd64"}
+	if err := ce.IsSatisfiedBy(props); err == nil {
+		t.Errorf("Error: constraint %v should not be satisfied", ce)
+	}
+
+	ce = externalpolicy.ConstraintExpression{"cel: prop5 * 2 >= 10 && prop2.startsWith(\"a\")", "prop2 == \"a b\""}
+	tprops := []externalpolicy.Property{*(externalpolicy.Property_Factory("prop2", "a b")), *(externalpolicy.Property_Factory("prop5", 4))}
+	if eval, err := ce.Evaluate(tprops); err != nil {
+		t.Errorf("Error: unable to evaluate %v: %v", ce, err)
+	} else if eval.Satisfied || len(eval.Children) != 2 || eval.Children[0].Satisfied || !eval.Children[1].Satisfied {
+		t.Errorf("Error: unexpected evaluation: %v", eval)
+	} else if c := eval.Children[0]; len(c.Children) != 2 || c.Children[0].Satisfied || !c.Children[1].Satisfied {
+		t.Errorf("Error: unexpected evaluation of the cel constraint: %v", c)
+	}
+
+	ce = externalpolicy.ConstraintExpression{"cel: openhorizon.memory >=", "openhorizon.arch == arm64"}
+	if _, err := ce.Validate(); err == nil {
+		t.Errorf("Error: constraint %v should not be valid", ce)
+	}
+}
@@ -0,0 +1,866 @@
+package cel_language
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
+	"github.com/open-horizon/anax/semanticversion"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file contains the lexer, parser and evaluator for the subset of the Common Expression Language (CEL)
+// that is supported in policy constraints. The grammar is:
+//
+// expr       = or .
+// or         = and { "||" and } .
+// and        = relation { "&&" relation } .
+// relation   = addition [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "in") addition ] .
+// addition   = multiply { ("+" | "-") multiply } .
+// multiply   = unary { ("*" | "/" | "%") unary } .
+// unary      = ("!" | "-") unary | member .
+// member     = primary { "." function "(" [ args ] ")" } .
+// primary    = number | string | "true" | "false" | property | function "(" [ args ] ")" | "[" [ args ] "]" | "(" expr ")" .
+//
+// Property names may contain dots (e.g. openhorizon.memory). When a dotted name is immediately followed by
+// "(" and its last segment is a supported function, the last segment is treated as a method call on the
+// property, so that openhorizon.arch.startsWith("arm") works as expected.
+
+// Token types produced by the lexer.
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// The multi-character operators must be listed before their single character prefixes.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+// Split an expression into tokens.
+func tokenize(expression string) ([]token, error) {
+	tokens := make([]token, 0, 10)
+	runes := []rune(expression)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		if unicode.IsSpace(r) {
+			i++
+		} else if unicode.IsDigit(r) {
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, value: string(runes[start:i]), pos: start})
+		} else if r == '"' || r == '\'' {
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at position %v", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokString, value: sb.String(), pos: start})
+		} else if unicode.IsLetter(r) || r == '_' {
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			// A trailing dot belongs to a method call, not to the name.
+			for runes[i-1] == '.' {
+				i--
+			}
+			tokens = append(tokens, token{kind: tokIdent, value: string(runes[start:i]), pos: start})
+		} else {
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokOp, value: op, pos: i})
+					i += len([]rune(op))
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c' at position %v", r, i)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// The functions that can be called, and the number of arguments each takes (including the receiver
+// when called as a method).
+var functions = map[string]int{
+	"size":           1,
+	"len":            1,
+	"has":            1,
+	"int":            1,
+	"double":         1,
+	"string":         1,
+	"startsWith":     2,
+	"endsWith":       2,
+	"contains":       2,
+	"matches":        2,
+	"versionInRange": 2,
+}
+
+// The node types in the parsed expression tree.
+type node interface {
+	eval(env map[string]interface{}) (interface{}, error)
+	String() string
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+type propertyNode struct {
+	name string
+}
+
+type listNode struct {
+	elems []node
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+type callNode struct {
+	function string
+	args     []node
+}
+
+// A recursive descent parser over the tokens of a single expression.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse an expression into an expression tree.
+func parse(expression string) (node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected '%v' at position %v", t.value, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Consume the next token if it is one of the input operators.
+func (p *parser) acceptOp(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && !(t.kind == tokIdent && t.value == "in") {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.value == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return fmt.Errorf("expected '%v' at end of expression", op)
+		}
+		return fmt.Errorf("expected '%v' at position %v, found '%v'", op, t.pos, t.value)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		var right node
+		if right, err = p.parseAnd(); err == nil {
+			left = &binaryNode{op: "||", left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseRelation()
+	for err == nil {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		var right node
+		if right, err = p.parseRelation(); err == nil {
+			left = &binaryNode{op: "&&", left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) parseRelation() (node, error) {
+	left, err := p.parseAddition()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">", "in"); ok {
+		right, err := p.parseAddition()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseAddition() (node, error) {
+	left, err := p.parseMultiply()
+	for err == nil {
+		op, ok := p.acceptOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		var right node
+		if right, err = p.parseMultiply(); err == nil {
+			left = &binaryNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) parseMultiply() (node, error) {
+	left, err := p.parseUnary()
+	for err == nil {
+		op, ok := p.acceptOp("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		var right node
+		if right, err = p.parseUnary(); err == nil {
+			left = &binaryNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parseMember()
+}
+
+func (p *parser) parseMember() (node, error) {
+	n, err := p.parsePrimary()
+	for err == nil {
+		if _, ok := p.acceptOp("."); !ok {
+			return n, nil
+		}
+		t := p.next()
+		if t.kind != tokIdent {
+			return nil, fmt.Errorf("expected a function name at position %v", t.pos)
+		}
+		n, err = p.parseCall(t, n)
+	}
+	return nil, err
+}
+
+// Parse the argument list of a function call. The receiver, if there is one, becomes the first argument.
+func (p *parser) parseCall(name token, receiver node) (node, error) {
+	argCount, ok := functions[name.value]
+	if !ok {
+		return nil, fmt.Errorf("unsupported function '%v' at position %v", name.value, name.pos)
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	args := make([]node, 0, 2)
+	if receiver != nil {
+		args = append(args, receiver)
+	}
+	argList, err := p.parseArgs(")")
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, argList...)
+	if len(args) != argCount {
+		return nil, fmt.Errorf("function '%v' at position %v expects %v argument(s), has %v", name.value, name.pos, argCount, len(args))
+	}
+	if name.value == "has" {
+		if _, ok := args[0].(*propertyNode); !ok {
+			return nil, fmt.Errorf("function 'has' at position %v expects a property name", name.pos)
+		}
+	}
+	return &callNode{function: name.value, args: args}, nil
+}
+
+// Parse a comma separated list of expressions, up to and including the closing operator.
+func (p *parser) parseArgs(closeOp string) ([]node, error) {
+	args := make([]node, 0, 2)
+	if _, ok := p.acceptOp(closeOp); ok {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if _, ok := p.acceptOp(","); !ok {
+			break
+		}
+	}
+	if err := p.expectOp(closeOp); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%v' at position %v", t.value, t.pos)
+		}
+		return &literalNode{value: f}, nil
+	case tokString:
+		return &literalNode{value: t.value}, nil
+	case tokIdent:
+		if t.value == "true" || t.value == "false" {
+			return &literalNode{value: t.value == "true"}, nil
+		} else if t.value == "in" {
+			return nil, fmt.Errorf("unexpected 'in' at position %v", t.pos)
+		} else if next := p.peek(); next.kind == tokOp && next.value == "(" {
+			// A dotted name followed by a call is a method call on the property named by the leading segments.
+			if ix := strings.LastIndex(t.value, "."); ix != -1 {
+				receiver := &propertyNode{name: t.value[:ix]}
+				return p.parseCall(token{kind: tokIdent, value: t.value[ix+1:], pos: t.pos + ix + 1}, receiver)
+			}
+			return p.parseCall(t, nil)
+		}
+		return &propertyNode{name: t.value}, nil
+	case tokOp:
+		if t.value == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		} else if t.value == "[" {
+			elems, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{elems: elems}, nil
+		}
+	case tokEOF:
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected '%v' at position %v", t.value, t.pos)
+}
+
+// ========================================================================================================
+// Evaluation of the expression tree. Numbers are always float64, lists are []interface{}.
+//
+
+// The error returned when an expression refers to a property that the other party does not have.
+type undefinedPropertyError struct {
+	name string
+}
+
+func (e undefinedPropertyError) Error() string {
+	return fmt.Sprintf("property %v is not defined", e.name)
+}
+
+func (n *literalNode) eval(env map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *literalNode) String() string {
+	if s, ok := n.value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return formatValue(n.value)
+}
+
+func (n *propertyNode) eval(env map[string]interface{}) (interface{}, error) {
+	if v, ok := env[n.name]; ok {
+		return v, nil
+	}
+	return nil, undefinedPropertyError{name: n.name}
+}
+
+func (n *propertyNode) String() string {
+	return n.name
+}
+
+func (n *listNode) eval(env map[string]interface{}) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.elems))
+	for _, e := range n.elems {
+		v, err := e.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (n *listNode) String() string {
+	elems := make([]string, 0, len(n.elems))
+	for _, e := range n.elems {
+		elems = append(elems, e.String())
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+func (n *unaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		if b, ok := v.(bool); ok {
+			return !b, nil
+		}
+	} else if f, ok := v.(float64); ok {
+		return -f, nil
+	}
+	return nil, fmt.Errorf("operator '%v' cannot be applied to %v", n.op, formatValue(v))
+}
+
+func (n *unaryNode) String() string {
+	return n.op + n.operand.String()
+}
+
+func (n *binaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	// The logical operators tolerate an error in one operand when the other operand determines the result.
+	if n.op == "&&" || n.op == "||" {
+		shortCircuit := n.op == "||"
+		var firstErr error
+		for _, operand := range []node{n.left, n.right} {
+			v, err := operand.eval(env)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("operator '%v' cannot be applied to %v", n.op, formatValue(v))
+			} else if b == shortCircuit {
+				return b, nil
+			}
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return !shortCircuit, nil
+	}
+
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "in":
+		if list, ok := right.([]interface{}); ok {
+			for _, e := range list {
+				if valuesEqual(left, e) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	case "<", "<=", ">", ">=":
+		if lf, ok := left.(float64); ok {
+			if rf, ok := right.(float64); ok {
+				return compare(n.op, lf-rf), nil
+			}
+		} else if ls, ok := left.(string); ok {
+			if rs, ok := right.(string); ok {
+				// Strings that are both versions are compared as versions, so that "1.10" > "1.9".
+				if c, err := semanticversion.CompareVersions(ls, rs); err == nil {
+					return compare(n.op, float64(c)), nil
+				}
+				return compare(n.op, float64(strings.Compare(ls, rs))), nil
+			}
+		}
+	case "+":
+		switch l := left.(type) {
+		case float64:
+			if r, ok := right.(float64); ok {
+				return l + r, nil
+			}
+		case string:
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		case []interface{}:
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+		}
+	case "-", "*", "/", "%":
+		lf, lok := left.(float64)
+		rf, rok := right.(float64)
+		if lok && rok {
+			switch n.op {
+			case "-":
+				return lf - rf, nil
+			case "*":
+				return lf * rf, nil
+			}
+			if rf == 0 {
+				return nil, fmt.Errorf("division by zero in '%v'", n.String())
+			} else if n.op == "/" {
+				return lf / rf, nil
+			}
+			return math.Mod(lf, rf), nil
+		}
+	}
+	return nil, fmt.Errorf("operator '%v' cannot be applied to %v and %v", n.op, formatValue(left), formatValue(right))
+}
+
+func (n *binaryNode) String() string {
+	return fmt.Sprintf("%v %v %v", n.left.String(), n.op, n.right.String())
+}
+
+func (n *callNode) eval(env map[string]interface{}) (interface{}, error) {
+	if n.function == "has" {
+		_, ok := env[n.args[0].(*propertyNode).name]
+		return ok, nil
+	}
+
+	args := make([]interface{}, 0, len(n.args))
+	for _, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	switch n.function {
+	case "size", "len":
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+	case "int":
+		switch v := args[0].(type) {
+		case float64:
+			return math.Trunc(v), nil
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return float64(i), nil
+			}
+		}
+	case "double":
+		switch v := args[0].(type) {
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+	case "string":
+		if s, ok := args[0].(string); ok {
+			return s, nil
+		}
+		return formatValue(args[0]), nil
+	case "contains":
+		if list, ok := args[0].([]interface{}); ok {
+			for _, e := range list {
+				if valuesEqual(e, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		fallthrough
+	case "startsWith", "endsWith", "matches", "versionInRange":
+		s, sok := args[0].(string)
+		arg, aok := args[1].(string)
+		if !sok || !aok {
+			break
+		}
+		switch n.function {
+		case "contains":
+			return strings.Contains(s, arg), nil
+		case "startsWith":
+			return strings.HasPrefix(s, arg), nil
+		case "endsWith":
+			return strings.HasSuffix(s, arg), nil
+		case "matches":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %v: %v", arg, err)
+			}
+			return re.MatchString(s), nil
+		case "versionInRange":
+			vers, err := semanticversion.Version_Expression_Factory(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version range %v: %v", arg, err)
+			}
+			return vers.Is_within_range(s)
+		}
+	}
+
+	values := make([]string, 0, len(args))
+	for _, a := range args {
+		values = append(values, formatValue(a))
+	}
+	return nil, fmt.Errorf("function '%v' cannot be applied to %v", n.function, strings.Join(values, ", "))
+}
+
+func (n *callNode) String() string {
+	args := make([]string, 0, len(n.args))
+	for _, a := range n.args {
+		args = append(args, a.String())
+	}
+	return fmt.Sprintf("%v(%v)", n.function, strings.Join(args, ", "))
+}
+
+// Return a human readable explanation of why the input node does not evaluate to true. The explanation
+// descends into logical operators so that it points at the part of the expression that failed.
+func explain(n node, env map[string]interface{}) string {
+	if b, ok := n.(*binaryNode); ok && b.op == "&&" {
+		for _, operand := range []node{b.left, b.right} {
+			if v, err := operand.eval(env); err != nil || v != true {
+				return explain(operand, env)
+			}
+		}
+	} else if ok && b.op == "||" {
+		return fmt.Sprintf("%v, and %v", explain(b.left, env), explain(b.right, env))
+	}
+
+	v, err := n.eval(env)
+	if err != nil {
+		return fmt.Sprintf("'%v' cannot be evaluated: %v", n.String(), err)
+	}
+
+	reason := fmt.Sprintf("'%v' is %v", n.String(), formatValue(v))
+	values := make([]string, 0, 2)
+	for _, name := range referencedNames(n) {
+		if v, ok := env[name]; ok {
+			values = append(values, fmt.Sprintf("%v=%v", name, formatValue(v)))
+		}
+	}
+	if len(values) != 0 {
+		reason = fmt.Sprintf("%v (%v)", reason, strings.Join(values, ", "))
+	}
+	return reason
+}
+
+// Build the evaluation tree of the input node. A chain of the same logical operator becomes a single
+// node with one child per operand.
+func evaluationTree(n node, env map[string]interface{}) plugin_registry.ExpressionEvaluation {
+	v, err := n.eval(env)
+	eval := plugin_registry.ExpressionEvaluation{
+		Expression: n.String(),
+		Satisfied:  err == nil && v == true,
+	}
+
+	switch t := n.(type) {
+	case *binaryNode:
+		eval.Operator = t.op
+		if t.op == "&&" || t.op == "||" {
+			for _, operand := range logicalOperands(t, t.op) {
+				eval.Children = append(eval.Children, evaluationTree(operand, env))
+			}
+			return eval
+		}
+	case *unaryNode:
+		eval.Operator = t.op
+	case *callNode:
+		eval.Operator = t.function
+	}
+
+	if names := referencedNames(n); len(names) != 0 {
+		eval.Properties = make(map[string]interface{}, len(names))
+		for _, name := range names {
+			eval.Properties[name] = env[name]
+		}
+	}
+	if !eval.Satisfied {
+		eval.Reason = explain(n, env)
+	}
+	return eval
+}
+
+// Return the operands of a chain of the same logical operator, e.g. a, b and c for a && b && c.
+func logicalOperands(n node, op string) []node {
+	if b, ok := n.(*binaryNode); ok && b.op == op {
+		return append(logicalOperands(b.left, op), logicalOperands(b.right, op)...)
+	}
+	return []node{n}
+}
+
+// Return the names of the properties referenced in the input node, without duplicates.
+func referencedNames(n node) []string {
+	names := make([]string, 0, 2)
+	var collect func(n node)
+	collect = func(n node) {
+		switch t := n.(type) {
+		case *propertyNode:
+			for _, name := range names {
+				if name == t.name {
+					return
+				}
+			}
+			names = append(names, t.name)
+		case *unaryNode:
+			collect(t.operand)
+		case *binaryNode:
+			collect(t.left)
+			collect(t.right)
+		case *callNode:
+			for _, a := range t.args {
+				collect(a)
+			}
+		case *listNode:
+			for _, e := range t.elems {
+				collect(e)
+			}
+		}
+	}
+	collect(n)
+	return names
+}
+
+func compare(op string, diff float64) bool {
+	switch op {
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	case ">":
+		return diff > 0
+	}
+	return diff >= 0
+}
+
+func valuesEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case string:
+		return strconv.Quote(t)
+	case []interface{}:
+		elems := make([]string, 0, len(t))
+		for _, e := range t {
+			elems = append(elems, formatValue(e))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Convert a property value into the type used by the evaluator.
+func normalizeValue(value interface{}, propType string) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case string:
+		if propType == externalpolicy.LIST_TYPE {
+			list := make([]interface{}, 0, 2)
+			for _, e := range strings.Split(v, ",") {
+				list = append(list, strings.Trim(strings.TrimSpace(e), "\"'"))
+			}
+			return list
+		}
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			list = append(list, e)
+		}
+		return list
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+package externalpolicy
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
+	"strings"
+)
+
+// The purpose of this file is to explain, rather than simply decide, whether a ConstraintExpression is
+// satisfied by a list of properties. The result is a tree with one node per sub-expression, so that a
+// failure in a long constraint can be traced to the clause and the property value that caused it.
+
+// Evaluate the constraint expression against the input properties and return the evaluation tree. The root
+// is an AND of the individual constraints in the expression. An error is returned only when the expression
+// cannot be parsed.
+func (self *ConstraintExpression) Evaluate(props []Property) (*plugin_registry.ExpressionEvaluation, error) {
+
+	root := &plugin_registry.ExpressionEvaluation{
+		Expression: strings.Join(*self, " AND "),
+		Operator:   OP_AND,
+		Satisfied:  true,
+	}
+
+	// If there is no expression at all, then there is nothing to satisify
+	if len(*self) == 0 {
+		return root, nil
+	}
+
+	// Each constraint is evaluated with its own language handler, the constraints of merged policies can be written
+	// in different languages.
+	for _, constraint := range *self {
+		var eval *plugin_registry.ExpressionEvaluation
+		if rp, err := RequiredPropertyFromConstraint(&ConstraintExpression{constraint}); err != nil {
+			return nil, err
+		} else if err := rp.IsValid(); err != nil {
+			return nil, err
+		} else {
+			topMap := make(map[string]interface{})
+			for k := range *rp {
+				topMap[k] = (*rp)[k]
+			}
+			eval = evaluateControlOp(&topMap, &props)
+			eval.Expression = constraint
+		}
+
+		root.Children = append(root.Children, *eval)
+		if !eval.Satisfied {
+			root.Satisfied = false
+			if root.Reason == "" {
+				root.Reason = eval.Reason
+			}
+		}
+	}
+
+	// A single constraint does not need the extra level in the tree.
+	if len(root.Children) == 1 {
+		return &root.Children[0], nil
+	}
+	return root, nil
+}
+
+// Build the evaluation tree of a RequiredProperty control operator. Control operators with a single element
+// are collapsed into that element, since the parser produces an AND/OR wrapper for every expression.
+func evaluateControlOp(cop *map[string]interface{}, props *[]Property) *plugin_registry.ExpressionEvaluation {
+	controlOp := getControlOperator(cop)
+	propArray := (*cop)[controlOp].([]interface{})
+
+	eval := &plugin_registry.ExpressionEvaluation{
+		Expression: displayRequiredProperty(cop),
+		Operator:   controlOp,
+		Satisfied:  controlOp != OP_OR,
+	}
+
+	for _, p := range propArray {
+		var child *plugin_registry.ExpressionEvaluation
+		if prop := isPropertyExpression(p); prop != nil {
+			child = evaluatePropertyExpression(prop, props)
+		} else if subOp := isControlOp(p); subOp != nil {
+			child = evaluateControlOp(subOp, props)
+		} else {
+			continue
+		}
+
+		if controlOp == OP_OR && child.Satisfied {
+			eval.Satisfied = true
+		} else if controlOp == OP_AND && !child.Satisfied {
+			eval.Satisfied = false
+		}
+		eval.Children = append(eval.Children, *child)
+	}
+
+	if len(eval.Children) == 1 {
+		return &eval.Children[0]
+	}
+
+	if !eval.Satisfied {
+		reasons := make([]string, 0, len(eval.Children))
+		for _, child := range eval.Children {
+			if !child.Satisfied {
+				reasons = append(reasons, child.Reason)
+				if controlOp == OP_AND {
+					break
+				}
+			}
+		}
+		eval.Reason = strings.Join(reasons, ", and ")
+	}
+	return eval
+}
+
+// Build the evaluation tree leaf for a single property expression.
+func evaluatePropertyExpression(prop *PropertyExpression, props *[]Property) *plugin_registry.ExpressionEvaluation {
+	if prop.Op == evaluated {
+		return evaluateWithLanguage(prop, props)
+	}
+
+	op := prop.Op
+	if op == "" {
+		op = doubleequalto
+	}
+
+	eval := &plugin_registry.ExpressionEvaluation{
+		Expression: fmt.Sprintf("%v %v %v", prop.Name, op, prop.Value),
+		Operator:   op,
+		Properties: map[string]interface{}{prop.Name: nil},
+		Satisfied:  propertyInArray(prop, props),
+	}
+
+	found := false
+	for _, p := range *props {
+		if p.Name == prop.Name {
+			eval.Properties[prop.Name] = p.Value
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		eval.Reason = fmt.Sprintf("property %v is not defined", prop.Name)
+	} else if !eval.Satisfied {
+		eval.Reason = fmt.Sprintf("'%v' is false (%v=%v)", eval.Expression, prop.Name, eval.Properties[prop.Name])
+	}
+	return eval
+}
+
+// Build the evaluation tree of a constraint that its language plugin evaluates itself. A constraint that cannot be
+// evaluated is not satisfied.
+func evaluateWithLanguage(prop *PropertyExpression, props *[]Property) *plugin_registry.ExpressionEvaluation {
+	expression := fmt.Sprintf("%v", prop.Value)
+	evaluator, ok := plugin_registry.ConstraintLanguagePlugins.Get(prop.Name).(plugin_registry.ConstraintLanguageEvaluator)
+	if !ok {
+		return &plugin_registry.ExpressionEvaluation{Expression: expression, Reason: fmt.Sprintf("constraint language %v cannot evaluate the expression", prop.Name)}
+	}
+
+	eval, err := evaluator.Evaluate(expression, propertyValues(*props))
+	if err != nil {
+		return &plugin_registry.ExpressionEvaluation{Expression: expression, Reason: fmt.Sprintf("the expression could not be evaluated: %v", err)}
+	}
+	return eval
+}
+
+// Convert properties to the form that is passed to constraint language plugins.
+func propertyValues(props []Property) []plugin_registry.PropertyValue {
+	pvs := make([]plugin_registry.PropertyValue, 0, len(props))
+	for _, p := range props {
+		pvs = append(pvs, plugin_registry.PropertyValue{Name: p.Name, Value: p.Value, Type: p.Type})
+	}
+	return pvs
+}
@@ -0,0 +1,67 @@
+// +build unit
+
+package externalpolicy
+
+import (
+	_ "github.com/open-horizon/anax/externalpolicy/text_language"
+	"strings"
+	"testing"
+)
+
+func Test_Evaluate_text_satisfied(t *testing.T) {
+	ce := ConstraintExpression{"prop == true && prop2 == \"a b\"", "prop5 <= 5 || prop6 == value6"}
+	props := []Property{*(Property_Factory("prop", true)), *(Property_Factory("prop2", "a b")), *(Property_Factory("prop5", 5.0))}
+
+	if eval, err := ce.Evaluate(props); err != nil {
+		t.Errorf("Error: unable to evaluate %v: %v", ce, err)
+	} else if !eval.Satisfied {
+		t.Errorf("Error: %v should be satisfied, evaluation: %v", ce, eval)
+	} else if len(eval.Children) != 2 {
+		t.Errorf("Error: expected one child per constraint, evaluation: %v", eval)
+	} else if err := ce.IsSatisfiedBy(props); err != nil {
+		t.Errorf("Error: Evaluate and IsSatisfiedBy disagree: %v", err)
+	}
+
+	// an empty expression is always satisfied
+	ce = ConstraintExpression{}
+	if eval, err := ce.Evaluate(props); err != nil || !eval.Satisfied {
+		t.Errorf("Error: empty expression should be satisfied, evaluation: %v, error: %v", eval, err)
+	}
+}
+
+func Test_Evaluate_text_not_satisfied(t *testing.T) {
+	ce := ConstraintExpression{"prop == true && (prop2 == value2 || prop3 >= 3) && prop4 == value4"}
+	props := []Property{*(Property_Factory("prop", true)), *(Property_Factory("prop2", "other")), *(Property_Factory("prop3", 1.0)), *(Property_Factory("prop4", "value4"))}
+
+	eval, err := ce.Evaluate(props)
+	if err != nil {
+		t.Fatalf("Error: unable to evaluate %v: %v", ce, err)
+	} else if eval.Satisfied || eval.Expression != ce[0] || eval.Operator != OP_AND {
+		t.Fatalf("Error: unexpected root of the evaluation tree: %v", eval)
+	} else if len(eval.Children) != 3 {
+		t.Fatalf("Error: expected 3 children, evaluation: %v", eval)
+	}
+
+	if c := eval.Children[0]; !c.Satisfied || c.Operator != "==" || c.Properties["prop"] != true {
+		t.Errorf("Error: unexpected evaluation of the first clause: %v", c)
+	}
+	if c := eval.Children[1]; c.Satisfied || c.Operator != OP_OR || len(c.Children) != 2 {
+		t.Errorf("Error: unexpected evaluation of the parenthetical clause: %v", c)
+	} else if gc := c.Children[1]; gc.Satisfied || gc.Operator != ">=" || gc.Properties["prop3"] != 1.0 {
+		t.Errorf("Error: unexpected evaluation of the prop3 clause: %v", gc)
+	} else if !strings.Contains(eval.Reason, "'prop2 == value2' is false (prop2=other)") || !strings.Contains(eval.Reason, "'prop3 >= 3' is false (prop3=1)") {
+		t.Errorf("Error: unexpected reason: %v", eval.Reason)
+	}
+	if c := eval.Children[2]; !c.Satisfied {
+		t.Errorf("Error: unexpected evaluation of the last clause: %v", c)
+	}
+
+	ce = ConstraintExpression{"prop == true", "missing == value"}
+	if eval, err := ce.Evaluate(props); err != nil {
+		t.Errorf("Error: unable to evaluate %v: %v", ce, err)
+	} else if eval.Satisfied || len(eval.Children) != 2 || eval.Reason != "property missing is not defined" {
+		t.Errorf("Error: unexpected evaluation: %v", eval)
+	} else if v, ok := eval.Children[1].Properties["missing"]; !ok || v != nil {
+		t.Errorf("Error: undefined property should have a nil value: %v", eval.Children[1])
+	}
+}
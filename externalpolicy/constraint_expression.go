@@ -9,8 +9,22 @@ import (
 // This type implements all the ConstraintLanguage Plugin methods and delegates to plugin system.
 type ConstraintExpression []string
 
+// Each constraint is validated by the language plugin that claims it, so that the constraints of merged policies
+// can be written in different languages.
 func (c *ConstraintExpression) Validate() ([]string, error) {
-	return plugin_registry.ConstraintLanguagePlugins.ValidatedByOne((*c).GetStrings())
+	if len(*c) == 0 {
+		return plugin_registry.ConstraintLanguagePlugins.ValidatedByOne((*c).GetStrings())
+	}
+
+	validConstraints := make([]string, 0, len(*c))
+	for _, constraint := range *c {
+		if validated, err := plugin_registry.ConstraintLanguagePlugins.ValidatedByOne([]string{constraint}); err != nil {
+			return nil, err
+		} else {
+			validConstraints = append(validConstraints, validated...)
+		}
+	}
+	return validConstraints, nil
 }
 
 func (c *ConstraintExpression) GetLanguageHandler() (plugin_registry.ConstraintLanguagePlugin, error) {
@@ -113,7 +127,8 @@ func (self *ConstraintExpression) GetStrings() []string {
 
 // Create a RequiredProperty Object based on the constraint expression in an external policy. The constraint expression
 // contains references to properties and provides a comparison operator and value on that property. These can be converted
-// into our internal format.
+// into our internal format. A constraint in a language that evaluates its own expressions is kept whole, in a property
+// expression that its language plugin evaluates.
 func RequiredPropertyFromConstraint(extConstraint *ConstraintExpression) (*RequiredProperty, error) {
 
 	const OP_AND = "and"
@@ -130,15 +145,22 @@ func RequiredPropertyFromConstraint(extConstraint *ConstraintExpression) (*Requi
 		return allRP, nil
 	}
 
-	for _, remainder := range *extConstraint {
-		remainder := strings.Replace(remainder, "\a", " ", -1)
+	for _, constraint := range *extConstraint {
+		remainder := strings.Replace(constraint, "\a", " ", -1)
 
-		// Get a handle to the specific language handler we will be using.
-		handler, err = extConstraint.GetLanguageHandler()
+		// Get a handle to the specific language handler we will be using. The constraints of merged policies can be
+		// written in different languages, so each constraint has its own handler.
+		handler, err = plugin_registry.ConstraintLanguagePlugins.GetLanguageHandlerByOne([]string{constraint})
 		if err != nil {
 			return nil, fmt.Errorf("unable to obtain policy constraint language handler, error %v", err)
 		}
 
+		if _, ok := handler.(plugin_registry.ConstraintLanguageEvaluator); ok {
+			language := plugin_registry.ConstraintLanguagePlugins.GetName(handler)
+			allPropArray = append(allPropArray, *PropertyExpression_Factory(language, constraint, evaluated))
+			continue
+		}
+
 		// Create a new Required Property structure and initialize it with a top level OR followed by a top level AND. This will allow us
 		// to drop expressions into the structure as they come in through the GetNextExpression function.
 
@@ -66,6 +66,10 @@ const greaterthaneq = ">="
 const notequalto = "!="
 const isin = "in"
 
+// A property expression with this operator holds a whole constraint in its value. The constraint is evaluated by the
+// constraint language plugin that the name of the property expression refers to.
+const evaluated = "evaluated"
+
 // This struct represents property value expressions to be satisfied
 type PropertyExpression struct {
 	Name  string      `json:"name"`  // The Property name
@@ -131,7 +135,11 @@ func (self *RequiredProperty) satisfied(cop *map[string]interface{}, props *[]Pr
 		propArray := (*cop)[controlOp].([]interface{})
 		for _, p := range propArray {
 			if prop := isPropertyExpression(p); prop != nil {
-				if !propertyInArray(prop, props) {
+				if prop.Op == evaluated {
+					if eval := evaluateWithLanguage(prop, props); !eval.Satisfied {
+						return errors.New(fmt.Sprintf("The constraint expression '%v' is not satisfied by the available properties %v: %v", prop.Value, displayProperties(props), eval.Reason))
+					}
+				} else if !propertyInArray(prop, props) {
 					return errors.New(fmt.Sprintf("The required property '%v %v %v' were not found in the available properties %v", prop.Name, prop.Op, prop.Value, displayProperties(props)))
 				}
 			} else if cop := isControlOp(p); cop != nil {
@@ -282,7 +290,7 @@ func controlOperators() map[string]int {
 // of the supported comparison operators.
 func comparisonOperators() map[string]int {
 	// return map[string]int {and:0, or:0, not:0}
-	return map[string]int{lessthan: 0, greaterthan: 0, doubleequalto: 0, equalto: 0, lessthaneq: 0, greaterthaneq: 0, notequalto: 0, isin: 0}
+	return map[string]int{lessthan: 0, greaterthan: 0, doubleequalto: 0, equalto: 0, lessthaneq: 0, greaterthaneq: 0, notequalto: 0, isin: 0, evaluated: 0}
 }
 
 // Return a map of comparison operators that only work on strings
@@ -412,6 +420,9 @@ func getKeys(m map[string]interface{}) []string {
 // This function compares a Property object with an array of Property objects to see if it's
 // in the array with an appropriate value.
 func propertyInArray(propexp *PropertyExpression, props *[]Property) bool {
+	if propexp.Op == evaluated {
+		return evaluateWithLanguage(propexp, props).Satisfied
+	}
 	for _, p := range *props {
 		if p.Name != propexp.Name {
 			// These are not the droids we're looking for
@@ -553,6 +564,9 @@ func displayRequiredProperty(cop *map[string]interface{}) string {
 				prop.Op = doubleequalto
 			}
 			s := fmt.Sprintf("%v%v%v", prop.Name, prop.Op, prop.Value)
+			if prop.Op == evaluated {
+				s = fmt.Sprintf("%v", prop.Value)
+			}
 			display_strings = append(display_strings, s)
 		} else if cop1 := isControlOp(p); cop1 != nil {
 			s := displayRequiredProperty(cop1)
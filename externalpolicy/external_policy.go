@@ -54,6 +54,17 @@ func (e *ExternalPolicy) ValidateAndNormalize() error {
 		}
 	}
 
+	// the maintenance window is parsed by the policy package, here it only needs to be a string
+	if e.Properties.HasProperty(PROP_NODE_MAINT_WINDOW) {
+		mwProp, err := e.Properties.GetProperty(PROP_NODE_MAINT_WINDOW)
+		if err != nil {
+			return err
+		}
+		if _, ok := mwProp.Value.(string); !ok {
+			return errors.New(msgPrinter.Sprintf("Property %s must have a string value.", PROP_NODE_MAINT_WINDOW))
+		}
+	}
+
 	// accepts string "true" or "false" for PROP_SVC_PRIVILEGED, but change them to boolean
 	if e.Properties.HasProperty(PROP_SVC_PRIVILEGED) {
 		privProp, err := e.Properties.GetProperty(PROP_SVC_PRIVILEGED)
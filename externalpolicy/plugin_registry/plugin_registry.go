@@ -12,6 +12,39 @@ type ConstraintLanguagePlugin interface {
 	GetNextOperator(expression string) (string, string, error)
 }
 
+// A property name, value and declared type, as seen by a constraint language plugin.
+type PropertyValue struct {
+	Name  string
+	Value interface{}
+	Type  string
+}
+
+// The result of evaluating a constraint expression, or one of its sub-expressions, against a list of properties.
+// Sub-expressions joined by a boolean operator are the children of a node with that operator. The properties
+// map holds the value of each property the sub-expression refers to, nil when the property is not defined.
+type ExpressionEvaluation struct {
+	Expression string                 `json:"expression"`
+	Operator   string                 `json:"operator,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Satisfied  bool                   `json:"satisfied"`
+	Reason     string                 `json:"reason,omitempty"` // set when not satisfied
+	Children   []ExpressionEvaluation `json:"children,omitempty"`
+}
+
+func (e ExpressionEvaluation) String() string {
+	return fmt.Sprintf("Expression: %v, Operator: %v, Properties: %v, Satisfied: %v, Reason: %v, Children: %v",
+		e.Expression, e.Operator, e.Properties, e.Satisfied, e.Reason, e.Children)
+}
+
+// Constraint language plugins whose expressions cannot be decomposed into simple name/operator/value
+// triples (for example, because they contain arithmetic or function calls) implement this interface
+// in addition to ConstraintLanguagePlugin. Evaluate returns the evaluation tree of the expression against
+// the input properties. When the expression is not satisfied, the Reason of the root explains which part
+// of the expression failed.
+type ConstraintLanguageEvaluator interface {
+	Evaluate(expression string, props []PropertyValue) (*ExpressionEvaluation, error)
+}
+
 // Global constraint language registry.
 type ConstraintLanguageRegistry map[string]ConstraintLanguagePlugin
 
@@ -59,6 +92,16 @@ func (d ConstraintLanguageRegistry) HasPlugin(name string) bool {
 	return false
 }
 
+// Return the name that the plugin registered itself with, or an empty string if it is not registered.
+func (d ConstraintLanguageRegistry) GetName(p ConstraintLanguagePlugin) string {
+	for name, val := range d {
+		if val == p {
+			return name
+		}
+	}
+	return ""
+}
+
 func (d ConstraintLanguageRegistry) Get(name string) ConstraintLanguagePlugin {
 	if val, ok := d[name]; ok {
 		return val
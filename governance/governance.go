@@ -179,6 +179,15 @@ func (w *GovernanceWorker) NewEvent(incoming events.Message) {
 						persistence.NewMessageMeta(EL_GOV_IMAGE_LOADED, ags[0].RunningWorkload.Org, ags[0].RunningWorkload.URL),
 						fmt.Sprintf(persistence.EC_IMAGE_LOADED),
 						ags[0])
+				} else if msg.Event().Id == events.IMAGE_SIG_VERIF_ERROR {
+					eventlog.LogAgreementEvent(
+						w.db,
+						persistence.SEVERITY_ERROR,
+						persistence.NewMessageMeta(EL_GOV_ERR_IMG_SIG_VERIF, ags[0].RunningWorkload.Org, ags[0].RunningWorkload.URL),
+						persistence.EC_ERROR_IMAGE_SIG_VERIF,
+						ags[0])
+					cmd := w.NewCleanupExecutionCommand(lc.AgreementProtocol, lc.AgreementId, reason, nil)
+					w.Commands <- cmd
 				} else {
 					eventlog.LogAgreementEvent(
 						w.db,
@@ -201,11 +210,17 @@ func (w *GovernanceWorker) NewEvent(incoming events.Message) {
 					persistence.EC_IMAGE_LOADED,
 					"", lc.ServicePathElement.URL, "", lc.ServicePathElement.Version, "", lc.AgreementIds)
 			} else {
+				meta := persistence.NewMessageMeta(EL_GOV_ERR_LOADING_IMG_FOR_SVC, lc.ServicePathElement.Org, lc.ServicePathElement.URL)
+				code := persistence.EC_ERROR_IMAGE_LOADE
+				if msg.Event().Id == events.IMAGE_SIG_VERIF_ERROR {
+					meta = persistence.NewMessageMeta(EL_GOV_ERR_IMG_SIG_VERIF_SVC, lc.ServicePathElement.Org, lc.ServicePathElement.URL)
+					code = persistence.EC_ERROR_IMAGE_SIG_VERIF
+				}
 				eventlog.LogServiceEvent2(
 					w.db,
 					persistence.SEVERITY_ERROR,
-					persistence.NewMessageMeta(EL_GOV_ERR_LOADING_IMG_FOR_SVC, lc.ServicePathElement.Org, lc.ServicePathElement.URL),
-					persistence.EC_ERROR_IMAGE_LOADE,
+					meta,
+					code,
 					"", lc.ServicePathElement.URL, "", lc.ServicePathElement.Version, "", lc.AgreementIds)
 				cmd := w.NewUpdateMicroserviceCommand(lc.Name, false, microservice.MS_IMAGE_FETCH_FAILED, microservice.DecodeReasonCode(microservice.MS_IMAGE_FETCH_FAILED))
 				w.Commands <- cmd
@@ -745,6 +760,11 @@ func (w *GovernanceWorker) Initialize() bool {
 	// Fire up the microservice governor
 	w.DispatchSubworker(MICROSERVICE_GOVERNOR, w.governMicroservices, 60, false)
 
+	// pull the images of newer service versions ahead of the upgrades
+	if w.Config.Edge.ImagePrefetch.Enabled && w.deviceType == persistence.DEVICE_TYPE_DEVICE {
+		w.DispatchSubworker(IMAGE_PREFETCH, w.prefetchServiceImages, int(w.Config.Edge.ServiceUpgradeCheckIntervalS), false)
+	}
+
 	// for the policy case update the exchange with the latest registeredServices
 	if w.devicePattern == "" {
 		w.UpdateRegisteredServicesWithAgreement()
@@ -1367,6 +1387,7 @@ func (w *GovernanceWorker) CommandHandler(command worker.Command) bool {
 
 	case *ServiceChangeCommand:
 		w.governMicroserviceVersions()
+		w.prefetchUpgradeImages()
 
 	default:
 		return false
@@ -1506,6 +1527,24 @@ func (w *GovernanceWorker) RecordReply(proposal abstractprotocol.Proposal, proto
 			sDef.PopulateDefaultUserInput(envAdds)
 		}
 
+		// The secrets used by the workload are bound to keys in the node's secret provider by the deployment policy or pattern.
+		// Only the keys are passed along, the secret values are fetched when the workload is started.
+		if secretBindings, err := policy.ResolveSecretBindings(serviceDef.GetSecretNames(), workload.WorkloadURL, workload.Org, workload.Version, workload.Arch, tcPolicy.SecretBinding); err != nil {
+			return errors.New(logString(fmt.Sprintf("unable to bind the secrets of %v/%v, error %v", workload.Org, workload.WorkloadURL, err)))
+		} else {
+			lc.SecretBindings = secretBindings
+		}
+
+		// The services the workload depends on are bound by the same policy or pattern. Their bindings are resolved again
+		// when each of them is started.
+		if len(serviceDef.RequiredServices) != 0 {
+			if depSvcDefs, _, _, err := exchange.GetHTTPServiceDefResolverHandler(w)(workload.WorkloadURL, workload.Org, workload.Version, workload.Arch); err != nil {
+				return fmt.Errorf("Received error querying exchange for the dependent services of %v/%v, error %v", workload.Org, workload.WorkloadURL, err)
+			} else if _, err := exchange.ResolveDependencySecretBindings(depSvcDefs, tcPolicy.SecretBinding); err != nil {
+				return errors.New(logString(fmt.Sprintf("unable to bind the secrets of the dependent services of %v/%v, error %v", workload.Org, workload.WorkloadURL, err)))
+			}
+		}
+
 		cutil.SetPlatformEnvvars(envAdds,
 			config.ENVVAR_PREFIX,
 			proposal.AgreementId(),
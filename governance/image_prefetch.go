@@ -0,0 +1,92 @@
+package governance
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/microservice"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/semanticversion"
+)
+
+const IMAGE_PREFETCH = "ImagePrefetch"
+
+// The image prefetch subworker.
+func (w *GovernanceWorker) prefetchServiceImages() int {
+	w.prefetchUpgradeImages()
+	return 0
+}
+
+// Look for newer versions of the services running on the node and ask the image fetch worker to pull their images, so that
+// the upgrade to a newer version only needs its containers to be restarted. The dependent services are upgraded to the
+// highest version within their upgrade version range, the top level services of the agreements are upgraded by a new
+// agreement to the highest version known to the exchange.
+func (w *GovernanceWorker) prefetchUpgradeImages() {
+	if !w.Config.Edge.ImagePrefetch.Enabled || w.deviceType != persistence.DEVICE_TYPE_DEVICE {
+		return
+	}
+
+	glog.V(3).Infof(logString(fmt.Sprintf("looking for service upgrades to prefetch images for")))
+
+	if msdefs, err := persistence.FindMicroserviceDefs(w.db, []persistence.MSFilter{persistence.UnarchivedMSFilter()}); err != nil {
+		glog.Errorf(logString(fmt.Sprintf("error getting service definitions from db. %v", err)))
+	} else {
+		for _, msdef := range msdefs {
+			if !msdef.AutoUpgrade {
+				continue
+			} else if new_msdef, err := microservice.GetUpgradeMicroserviceDef(exchange.GetHTTPServiceResolverHandler(w.limitedRetryEC), &msdef, w.db); err != nil {
+				glog.V(3).Infof(logString(fmt.Sprintf("unable to find the upgrade of service %v/%v version %v for image prefetch. %v", msdef.Org, msdef.SpecRef, msdef.Version, err)))
+			} else if new_msdef != nil && new_msdef.Version != msdef.Version {
+				deployment, deploymentSig := new_msdef.GetDeployment()
+				w.prefetchImages(new_msdef.SpecRef, new_msdef.Org, new_msdef.Version, new_msdef.Arch, deployment, deploymentSig)
+			}
+		}
+	}
+
+	if ags, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter()}); err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to retrieve agreements from database. %v", err)))
+	} else {
+		for _, ag := range ags {
+			workload := ag.RunningWorkload
+			if workload.URL == "" || workload.Org == "" || workload.Version == "" {
+				continue
+			} else if vExp, err := semanticversion.Version_Expression_Factory(workload.Version); err != nil {
+				glog.V(3).Infof(logString(fmt.Sprintf("unable to convert %v to a version expression for image prefetch. %v", workload.Version, err)))
+			} else if _, sdef, _, err := exchange.GetHTTPServiceResolverHandler(w.limitedRetryEC)(workload.URL, workload.Org, vExp.Get_expression(), workload.Arch); err != nil {
+				glog.V(3).Infof(logString(fmt.Sprintf("unable to find the highest version of service %v/%v for image prefetch. %v", workload.Org, workload.URL, err)))
+			} else if sdef == nil {
+				continue
+			} else if c, err := semanticversion.CompareVersions(sdef.GetVersion(), workload.Version); err == nil && c > 0 {
+				w.prefetchImages(workload.URL, workload.Org, sdef.GetVersion(), workload.Arch, sdef.Deployment, sdef.DeploymentSignature)
+			}
+		}
+	}
+}
+
+// Send the deployment of a service version to the image fetch worker, with the image auths of the service.
+func (w *GovernanceWorker) prefetchImages(url string, org string, version string, arch string, deployment string, deploymentSig string) {
+	if deployment == "" {
+		return
+	}
+
+	img_auths := make([]events.ImageDockerAuth, 0)
+	if w.Config.Edge.TrustDockerAuthFromOrg {
+		if ias, err := exchange.GetHTTPServiceDockerAuthsHandler(w)(url, org, version, arch); err != nil {
+			glog.V(5).Infof(logString(fmt.Sprintf("received error querying exchange for service image auths: %v/%v version %v, error %v", org, url, version, err)))
+		} else {
+			for _, iau_temp := range ias {
+				username := iau_temp.UserName
+				if username == "" {
+					username = "token"
+				}
+				img_auths = append(img_auths, events.ImageDockerAuth{Registry: iau_temp.Registry, UserName: username, Password: iau_temp.Token})
+			}
+		}
+	}
+
+	glog.V(3).Infof(logString(fmt.Sprintf("prefetching images for service %v/%v version %v", org, url, version)))
+	cc := events.NewContainerConfig(deployment, deploymentSig, "", "", "", "", img_auths)
+	w.Messages() <- events.NewImagePrefetchMessage(events.IMAGE_PREFETCH, url, org, version, *cc)
+}
@@ -33,6 +33,8 @@ const (
 	EL_GOV_IMAGE_LOADED_FOR_SVC    = "Image loaded for service %v/%v."
 	EL_GOV_ERR_LOADING_IMG         = "Error loading image for %v/%v."
 	EL_GOV_ERR_LOADING_IMG_FOR_SVC = "Error loading image for service %v/%v."
+	EL_GOV_ERR_IMG_SIG_VERIF       = "Image signature verification failed for %v/%v."
+	EL_GOV_ERR_IMG_SIG_VERIF_SVC   = "Image signature verification failed for service %v/%v."
 
 	// agreement
 	EL_GOV_START_TERM_AG_WITH_REASON    = "Start terminating agreement for %v. Termination reason: %v"
@@ -143,6 +145,8 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_GOV_IMAGE_LOADED_FOR_SVC)
 	msgPrinter.Sprintf(EL_GOV_ERR_LOADING_IMG)
 	msgPrinter.Sprintf(EL_GOV_ERR_LOADING_IMG_FOR_SVC)
+	msgPrinter.Sprintf(EL_GOV_ERR_IMG_SIG_VERIF)
+	msgPrinter.Sprintf(EL_GOV_ERR_IMG_SIG_VERIF_SVC)
 
 	// agreement
 	msgPrinter.Sprintf(EL_GOV_START_TERM_AG_WITH_REASON)
@@ -206,7 +206,14 @@ func (w *GovernanceWorker) StartMicroservice(ms_key string, agreementId string,
 				agIds = ms_instance.AssociatedAgreements
 			}
 
+			// bind the secrets used by the service, the secret values are fetched when the containers are started
+			secretBindings, err := w.GetSecretBindingsForServiceDeployment(msdef, agIds)
+			if err != nil {
+				return nil, err
+			}
+
 			lc := events.NewContainerLaunchContext(cc, &envAdds, events.BlockchainConfig{}, ms_instance.GetKey(), agIds, ms_specs, persistence.NewServiceInstancePathElement(msdef.SpecRef, msdef.Org, msdef.Version), isRetry)
+			lc.SecretBindings = secretBindings
 			w.Messages() <- events.NewLoadContainerMessage(events.LOAD_CONTAINER, lc)
 
 			return ms_instance, nil // assume there is only one workload for a microservice
@@ -223,17 +230,8 @@ func (w *GovernanceWorker) GetEnvVarsForServiceDepolyment(msdef *persistence.Mic
 
 	if agreementId != "" {
 		// this the first time this dependent service is brought up
-		ags, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(agreementId)})
-		if err != nil {
-			return nil, fmt.Errorf(logString(fmt.Sprintf("failed to retrieve agreement %v from database, error %v", agreementId, err)))
-		} else if len(ags) == 0 {
-			return nil, fmt.Errorf(logString(fmt.Sprintf("unable to find agreement %v from database.", agreementId)))
-		}
-
-		if proposal, err := w.producerPH[ags[0].AgreementProtocol].AgreementProtocolHandler("", "", "").DemarshalProposal(ags[0].Proposal); err != nil {
-			return nil, fmt.Errorf(logString(fmt.Sprintf("Error demarshalling proposal from agreement %v, %v", agreementId, err)))
-		} else if pol, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
-			return nil, fmt.Errorf(logString(fmt.Sprintf("Error demarshalling policy from proposal for agreement %v, %v", agreementId, err)))
+		if pol, err := w.getAgreementPolicy(agreementId); err != nil {
+			return nil, err
 		} else {
 			tcPolicy = pol
 		}
@@ -278,6 +276,48 @@ func (w *GovernanceWorker) GetEnvVarsForServiceDepolyment(msdef *persistence.Mic
 	return envAdds, nil
 }
 
+// Bind the secrets used by a dependent service to keys in the secret provider. The bindings come from the policy of the
+// agreement that the service is started for. For the retry case, they come from the first of the agreements the service
+// instance is associated with.
+func (w *GovernanceWorker) GetSecretBindingsForServiceDeployment(msdef *persistence.MicroserviceDefinition, agreementIds []string) (map[string]string, error) {
+
+	sDef, _, err := exchange.GetHTTPServiceHandler(w)(msdef.SpecRef, msdef.Org, msdef.Version, msdef.Arch)
+	if err != nil {
+		return nil, fmt.Errorf(logString(fmt.Sprintf("Error querying exchange for service %v/%v version %v, error %v", msdef.Org, msdef.SpecRef, msdef.Version, err)))
+	} else if sDef == nil || len(sDef.GetSecretNames()) == 0 {
+		return map[string]string{}, nil
+	}
+
+	var bindings []policy.SecretBinding
+	if len(agreementIds) != 0 {
+		if tcPolicy, err := w.getAgreementPolicy(agreementIds[0]); err != nil {
+			return nil, err
+		} else {
+			bindings = tcPolicy.SecretBinding
+		}
+	}
+
+	return policy.ResolveSecretBindings(sDef.GetSecretNames(), msdef.SpecRef, msdef.Org, msdef.Version, msdef.Arch, bindings)
+}
+
+// Returns the policy in the proposal of the agreement.
+func (w *GovernanceWorker) getAgreementPolicy(agreementId string) (*policy.Policy, error) {
+	ags, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(agreementId)})
+	if err != nil {
+		return nil, fmt.Errorf(logString(fmt.Sprintf("failed to retrieve agreement %v from database, error %v", agreementId, err)))
+	} else if len(ags) == 0 {
+		return nil, fmt.Errorf(logString(fmt.Sprintf("unable to find agreement %v from database.", agreementId)))
+	}
+
+	if proposal, err := w.producerPH[ags[0].AgreementProtocol].AgreementProtocolHandler("", "", "").DemarshalProposal(ags[0].Proposal); err != nil {
+		return nil, fmt.Errorf(logString(fmt.Sprintf("Error demarshalling proposal from agreement %v, %v", agreementId, err)))
+	} else if pol, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
+		return nil, fmt.Errorf(logString(fmt.Sprintf("Error demarshalling policy from proposal for agreement %v, %v", agreementId, err)))
+	} else {
+		return pol, nil
+	}
+}
+
 // It cleans the microservice instance and its associated agreements
 func (w *GovernanceWorker) CleanupMicroservice(spec_ref string, version string, inst_key string, ms_reason_code uint) error {
 	glog.V(5).Infof(logString(fmt.Sprintf("Deleting service instance %v", inst_key)))
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/exchangesync"
@@ -14,22 +16,27 @@ import (
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"reflect"
+	"strings"
 	"time"
 )
 
 type ContainerStatus struct {
-	Name    string `json:"name"`
-	Image   string `json:"image"`
-	Created int64  `json:"created"`
-	State   string `json:"state"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	Created  int64  `json:"created"`
+	State    string `json:"state"`
+	Health   string `json:"health,omitempty"`   // only set for containers with a healthcheck: starting, healthy or unhealthy
+	Restarts int    `json:"restarts,omitempty"` // the local restarts of a container with a restart policy
 }
 
 func (w ContainerStatus) String() string {
 	return fmt.Sprintf("Name: %v, "+
 		"Image: %v, "+
 		"Created: %v, "+
-		"State: %v",
-		w.Name, w.Image, w.Created, w.State)
+		"State: %v, "+
+		"Health: %v, "+
+		"Restarts: %v",
+		w.Name, w.Image, w.Created, w.State, w.Health, w.Restarts)
 }
 
 type WorkloadStatus struct {
@@ -40,6 +47,7 @@ type WorkloadStatus struct {
 	Arch           string            `json:"arch,omitempty"`
 	Containers     []ContainerStatus `json:"containerStatus"`
 	OperatorStatus interface{}       `json:"operatorStatus,omitempty"`
+	Health         string            `json:"health,omitempty"` // the combined health of the containers that have a healthcheck
 }
 
 func (w WorkloadStatus) String() string {
@@ -49,8 +57,18 @@ func (w WorkloadStatus) String() string {
 		"Version: %v, "+
 		"Arch: %v, "+
 		"Containers: %v"+
-		"OperatorStatus: %v",
-		w.AgreementId, w.ServiceURL, w.Org, w.Version, w.Arch, w.Containers, w.OperatorStatus)
+		"OperatorStatus: %v, "+
+		"Health: %v",
+		w.AgreementId, w.ServiceURL, w.Org, w.Version, w.Arch, w.Containers, w.OperatorStatus, w.Health)
+}
+
+// Set the combined health of the workload from the health of its containers.
+func (w *WorkloadStatus) SetHealth() {
+	states := make([]string, 0, len(w.Containers))
+	for _, c := range w.Containers {
+		states = append(states, c.Health)
+	}
+	w.Health = container.CombineContainerHealth(states)
 }
 
 type DeviceStatus struct {
@@ -90,21 +108,24 @@ func (w *GovernanceWorker) ReportDeviceStatus() int {
 	w.deviceStatus = nil
 	var device_status DeviceStatus
 
-	// get docker containers
+	// get docker containers and their health
 	containers := make([]docker.APIContainers, 0)
+	health := make(map[string]string)
 	if w.deviceType == persistence.DEVICE_TYPE_DEVICE {
-		if client, err := docker.NewClient(w.Config.Edge.DockerEndpoint); err != nil {
-			glog.Errorf(logString(fmt.Sprintf("Failed to instantiate docker Client: %v", err)))
+		if client, err := containerruntime.NewAgentContainerRuntime(w.Config); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("Failed to instantiate %v client: %v", w.Config.GetContainerRuntime(), err)))
 		} else {
 			containers, err = client.ListContainers(docker.ListContainersOptions{})
 			if err != nil {
 				glog.Errorf(logString(fmt.Sprintf("Unable to get list of running containers: %v", err)))
+			} else {
+				health = getContainerHealth(client, containers)
 			}
 		}
 	}
 
 	// get service status
-	if ms_status, err := w.getServiceStatus(containers); err != nil {
+	if ms_status, err := w.getServiceStatus(containers, health); err != nil {
 		glog.Errorf(logString(fmt.Sprintf("Error getting service container status: %v", err)))
 	} else {
 		device_status.Services = ms_status
@@ -135,17 +156,33 @@ func (w *GovernanceWorker) ReportDeviceStatus() int {
 	return 60
 }
 
+// Returns the health of the service containers that have a healthcheck, by container id. The health is taken from the
+// inspected state of the containers.
+func getContainerHealth(client containerruntime.ContainerRuntime, containers []docker.APIContainers) map[string]string {
+	health := make(map[string]string)
+	for _, c := range containers {
+		if _, ok := c.Labels[container.LABEL_PREFIX+".agreement_id"]; !ok {
+			continue
+		} else if inspected, err := client.InspectContainer(c.ID); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("Unable to inspect container %v: %v", c.Names, err)))
+		} else if h := container.GetInspectedContainerHealth(inspected); h != "" {
+			health[c.ID] = h
+		}
+	}
+	return health
+}
+
 // Find the status for all the Services.
-func (w *GovernanceWorker) getServiceStatus(containers []docker.APIContainers) ([]WorkloadStatus, error) {
+func (w *GovernanceWorker) getServiceStatus(containers []docker.APIContainers, health map[string]string) ([]WorkloadStatus, error) {
 
 	// Get all top level (agreement) services and related metadata.
-	tempWS, err := w.getWorkloadStatus(containers)
+	tempWS, err := w.getWorkloadStatus(containers, health)
 	if err != nil {
 		return nil, fmt.Errorf(logString(fmt.Sprintf("Error retrieving agreement services from database, error: %v", err)))
 	}
 
 	// Get all dependent services and related metadata.
-	tempMS, err := w.getMicroserviceStatus(containers)
+	tempMS, err := w.getMicroserviceStatus(containers, health)
 	if err != nil {
 		return nil, fmt.Errorf(logString(fmt.Sprintf("Error retrieving services from database, error: %v", err)))
 	}
@@ -170,7 +207,7 @@ func (w *GovernanceWorker) getServiceStatus(containers []docker.APIContainers) (
 }
 
 // Find the status for all the microservices
-func (w *GovernanceWorker) getMicroserviceStatus(containers []docker.APIContainers) ([]WorkloadStatus, error) {
+func (w *GovernanceWorker) getMicroserviceStatus(containers []docker.APIContainers, health map[string]string) ([]WorkloadStatus, error) {
 
 	// Filter to return all instances for a msdef
 	msdefFilter := func(msdef_id string) persistence.MIFilter {
@@ -209,15 +246,17 @@ func (w *GovernanceWorker) getMicroserviceStatus(containers []docker.APIContaine
 						deployment = msdef.ClusterDeployment
 					}
 					if deployment != "" {
-						if cstatus, err := GetContainerStatus(deployment, msi.GetKey(), true, containers); err != nil {
+						if cstatus, err := GetContainerStatus(deployment, msi.GetKey(), true, containers, health, w.Config); err != nil {
 							return nil, fmt.Errorf(logString(fmt.Sprintf("Error getting service container status for %v. %v", msdef.SpecRef, err)))
 						} else {
+							w.addRestartStatus(msi.GetKey(), cstatus)
 							msdef_status.Containers = append(msdef_status.Containers, cstatus...)
 						}
 					}
 				}
 			}
 			if len(msdef_status.Containers) > 0 {
+				msdef_status.SetHealth()
 				status = append(status, msdef_status)
 			}
 		}
@@ -227,7 +266,7 @@ func (w *GovernanceWorker) getMicroserviceStatus(containers []docker.APIContaine
 }
 
 // Find the status for all the workloads
-func (w *GovernanceWorker) getWorkloadStatus(containers []docker.APIContainers) ([]WorkloadStatus, error) {
+func (w *GovernanceWorker) getWorkloadStatus(containers []docker.APIContainers, health map[string]string) ([]WorkloadStatus, error) {
 
 	status := make([]WorkloadStatus, 0)
 
@@ -267,12 +306,14 @@ func (w *GovernanceWorker) getWorkloadStatus(containers []docker.APIContainers)
 						if deployment == "" {
 							deployment = wl.ClusterDeployment
 						}
-						cstatus, cErr := GetContainerStatus(deployment, ag.CurrentAgreementId, false, containers)
+						cstatus, cErr := GetContainerStatus(deployment, ag.CurrentAgreementId, false, containers, health, w.Config)
 						if cErr == nil {
+							w.addRestartStatus(ag.CurrentAgreementId, cstatus)
 							wl_status.Containers = append(wl_status.Containers, cstatus...)
 						} else {
 							return nil, fmt.Errorf(logString(fmt.Sprintf("Error finding workload status for %v: %v.", ag, cErr)))
 						}
+						wl_status.SetHealth()
 						status = append(status, wl_status)
 					}
 				}
@@ -283,8 +324,37 @@ func (w *GovernanceWorker) getWorkloadStatus(containers []docker.APIContainers)
 	return status, nil
 }
 
-// find container status
-func GetContainerStatus(deployment string, key string, infrastructure bool, containers []docker.APIContainers) ([]ContainerStatus, error) {
+// Add the local restarts of the containers that have a restart policy to their status. A stopped container is only
+// in the status with its service name, it is found by the name the container worker gives it.
+func (w *GovernanceWorker) addRestartStatus(key string, cstatus []ContainerStatus) {
+	restarts, err := persistence.FindContainerRestarts(w.db)
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("Error reading the container restart records: %v", err)))
+		return
+	}
+
+	for ix, cs := range cstatus {
+		name := strings.TrimPrefix(cs.Name, "/")
+		if !strings.HasPrefix(cs.Name, "/") {
+			name = key + "-" + cs.Name
+		}
+		for _, restart := range restarts {
+			if restart.Name != name {
+				continue
+			}
+			cstatus[ix].Restarts = restart.Restarts
+			if restart.CrashLoop {
+				cstatus[ix].State = container.CONTAINER_STATE_CRASH_LOOP
+			} else if cs.State != "running" && !restart.Completed {
+				cstatus[ix].State = container.CONTAINER_STATE_RESTARTING
+			}
+			break
+		}
+	}
+}
+
+// find container status, the health of the containers that have a healthcheck is given by container id
+func GetContainerStatus(deployment string, key string, infrastructure bool, containers []docker.APIContainers, health map[string]string, cfg *config.HorizonConfig) ([]ContainerStatus, error) {
 	status := make([]ContainerStatus, 0)
 
 	if deploymentDesc, err := containermessage.GetNativeDeployment(deployment); err == nil {
@@ -298,14 +368,15 @@ func GetContainerStatus(deployment string, key string, infrastructure bool, cont
 			container_status.Name = serviceName
 			container_status.Image = s_details.Image
 			container_status.State = "not started"
-			for _, container := range containers {
-				if _, ok := container.Labels[label]; ok {
-					cname := container.Names[0]
+			for _, c := range containers {
+				if _, ok := c.Labels[label]; ok {
+					cname := c.Names[0]
 					if cname == "/"+key+"-"+serviceName {
-						container_status.Name = container.Names[0]
-						container_status.Image = container.Image
-						container_status.Created = container.Created
-						container_status.State = container.State
+						container_status.Name = c.Names[0]
+						container_status.Image = c.Image
+						container_status.Created = c.Created
+						container_status.State = c.State
+						container_status.Health = health[c.ID]
 						break
 					}
 				}
@@ -317,7 +388,7 @@ func GetContainerStatus(deployment string, key string, infrastructure bool, cont
 		var container_status ContainerStatus
 		container_status.Name = fmt.Sprintf("Helm release: %v", hdc.ReleaseName)
 
-		hc := helm.NewHelmClient()
+		hc := helm.NewHelmClient(cfg)
 		releaseState := "Not Running"
 		if rs, err := hc.Status(hdc.ReleaseName); err != nil {
 			releaseState = fmt.Sprintf("Unknown, error: %v", err)
@@ -329,6 +400,23 @@ func GetContainerStatus(deployment string, key string, infrastructure bool, cont
 		}
 		container_status.State = releaseState
 		status = append(status, container_status)
+	} else if mdc, err := persistence.GetManifestDeployment(deployment); err == nil {
+		var container_status ContainerStatus
+
+		if mc, err := kube_operator.NewManifestClient(); err != nil {
+			container_status.State = fmt.Sprintf("Unknown, error: %v", err)
+			status = append(status, container_status)
+		} else if objStatuses, err := mc.Status(mdc, key); err != nil {
+			container_status.State = fmt.Sprintf("Unknown, error: %v", err)
+			status = append(status, container_status)
+		} else {
+			for _, obj := range objStatuses {
+				container_status.Name = fmt.Sprintf("%v/%v", obj.Kind, obj.Name)
+				container_status.State = obj.State
+				container_status.Created = obj.CreatedTime
+				status = append(status, container_status)
+			}
+		}
 	} else if kdc, err := persistence.GetKubeDeployment(deployment); err == nil {
 		var container_status ContainerStatus
 
@@ -348,6 +436,16 @@ func GetContainerStatus(deployment string, key string, infrastructure bool, cont
 					status = append(status, container_status)
 				}
 			}
+			// The objects that the operator does not manage, like other workloads, are listed by kind and name
+			if objStatuses, err := kc.ObjectStatus(kdc.OperatorYamlArchive, ""); err != nil {
+				container_status = ContainerStatus{State: fmt.Sprintf("Unknown, error: %v", err)}
+				status = append(status, container_status)
+			} else {
+				for _, obj := range objStatuses {
+					container_status = ContainerStatus{Name: fmt.Sprintf("%v/%v", obj.Kind, obj.Name), State: obj.State, Created: obj.CreatedTime}
+					status = append(status, container_status)
+				}
+			}
 		}
 	} else {
 		return nil, fmt.Errorf(logString(fmt.Sprintf("Error Unmarshalling deployment string %v. %v", deployment, err)))
@@ -460,7 +558,7 @@ func changeInContainerStatuses(newContainers []ContainerStatus, oldContainers []
 	for _, oldContainer := range oldContainers {
 		for _, newContainer := range newContainers {
 			if oldContainer.Name == newContainer.Name && oldContainer.Image == newContainer.Image && oldContainer.Created == newContainer.Created {
-				if oldContainer.State == newContainer.State {
+				if oldContainer.State == newContainer.State && oldContainer.Health == newContainer.Health && oldContainer.Restarts == newContainer.Restarts {
 					matches++
 				} else {
 					return true
@@ -479,7 +577,7 @@ func convertToPersistenceType(workload []WorkloadStatus) []persistence.WorkloadS
 	for _, wlStatus := range workload {
 		newPersistentWlStatus := persistence.WorkloadStatus{AgreementId: wlStatus.AgreementId,
 			ServiceURL: wlStatus.ServiceURL, Org: wlStatus.Org, Version: wlStatus.Version,
-			Arch: wlStatus.Arch, OperatorStatus: wlStatus.OperatorStatus}
+			Arch: wlStatus.Arch, OperatorStatus: wlStatus.OperatorStatus, Health: wlStatus.Health}
 		newPersistentWlStatus.Containers = converContainerStatusToPersistenceType(wlStatus.Containers)
 		persistentWls = append(persistentWls, newPersistentWlStatus)
 	}
@@ -489,7 +587,7 @@ func convertToPersistenceType(workload []WorkloadStatus) []persistence.WorkloadS
 func converContainerStatusToPersistenceType(containers []ContainerStatus) []persistence.ContainerStatus {
 	persistentCStatuses := []persistence.ContainerStatus{}
 	for _, cStatus := range containers {
-		persistentCStatuses = append(persistentCStatuses, persistence.ContainerStatus{Name: cStatus.Name, Image: cStatus.Image, Created: cStatus.Created, State: cStatus.State})
+		persistentCStatuses = append(persistentCStatuses, persistence.ContainerStatus{Name: cStatus.Name, Image: cStatus.Image, Created: cStatus.Created, State: cStatus.State, Health: cStatus.Health})
 	}
 	return persistentCStatuses
 }
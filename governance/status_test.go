@@ -64,7 +64,7 @@ func Test_GetContainerStatus(t *testing.T) {
 	// test fail with a wrong deployment string
 	deployment := "{\"services\":{\"netspeed5\":{st\":{\"image\":\"mycompany/x86/test:v1.0\"}}}"
 
-	status, err := GetContainerStatus(deployment, agreementId, false, containers)
+	status, err := GetContainerStatus(deployment, agreementId, false, containers, nil, nil)
 
 	assert.Error(t, err, "Error should be returned. ")
 
@@ -73,7 +73,16 @@ func Test_GetContainerStatus(t *testing.T) {
 	exp_status := []ContainerStatus{ContainerStatus{Name: "/aaaa-netspeed5", Image: "mycompany/x86/netspeed5:v2.5", Created: 1507728202, State: "running"},
 		{Name: "/aaaa-test", Image: "mycompany/x86/test:v1.0", Created: 1507728356, State: "running"}}
 
-	status, err = GetContainerStatus(deployment, agreementId, false, containers)
+	status, err = GetContainerStatus(deployment, agreementId, false, containers, nil, nil)
+
+	assert.Nil(t, err)
+	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
+
+	// test workload containers with a healthcheck
+	exp_status = []ContainerStatus{ContainerStatus{Name: "/aaaa-netspeed5", Image: "mycompany/x86/netspeed5:v2.5", Created: 1507728202, State: "running"},
+		{Name: "/aaaa-test", Image: "mycompany/x86/test:v1.0", Created: 1507728356, State: "running", Health: "healthy"}}
+
+	status, err = GetContainerStatus(deployment, agreementId, false, containers, map[string]string{"73f4354c98": "healthy"}, nil)
 
 	assert.Nil(t, err)
 	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
@@ -84,7 +93,7 @@ func Test_GetContainerStatus(t *testing.T) {
 	exp_status = []ContainerStatus{ContainerStatus{Name: "netspeed5", Image: "mycompany/x86/netspeed5:v2.5", Created: 0, State: "not started"},
 		{Name: "test", Image: "mycompany/x86/test:v1.0", Created: 0, State: "not started"}}
 
-	status, err = GetContainerStatus(deployment, agreementId, false, containers)
+	status, err = GetContainerStatus(deployment, agreementId, false, containers, nil, nil)
 
 	assert.Nil(t, err)
 	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
@@ -94,7 +103,7 @@ func Test_GetContainerStatus(t *testing.T) {
 	exp_status = []ContainerStatus{ContainerStatus{Name: "netspeed5", Image: "mycompany/x86/netspeed5:v2.5", Created: 0, State: "not started"},
 		{Name: "test", Image: "mycompany/x86/test:v1.0", Created: 0, State: "not started"}}
 
-	status, err = GetContainerStatus(deployment, agreementId, false, make([]docker.APIContainers, 0))
+	status, err = GetContainerStatus(deployment, agreementId, false, make([]docker.APIContainers, 0), nil, nil)
 
 	assert.Nil(t, err)
 	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
@@ -105,12 +114,30 @@ func Test_GetContainerStatus(t *testing.T) {
 	exp_status = []ContainerStatus{ContainerStatus{Name: "/bluehorizon.network-microservices-gps_2.0.3_52df00-gps", Image: "mycompany/x86/gps:2.0.6", Created: 1507728188, State: "running"}}
 	containers = []docker.APIContainers{c1, c2, c3, c4}
 
-	status, err = GetContainerStatus(deployment, key, true, containers)
+	status, err = GetContainerStatus(deployment, key, true, containers, nil, nil)
 
 	assert.Nil(t, err)
 	assert.True(t, statusArrayIsSame(exp_status, status), "The elements should be the same.")
 }
 
+func Test_WorkloadStatus_SetHealth(t *testing.T) {
+	ws := WorkloadStatus{Containers: []ContainerStatus{{Name: "c1", State: "running"}, {Name: "c2", State: "running"}}}
+	ws.SetHealth()
+	assert.Equal(t, "", ws.Health, "Containers without a healthcheck should not have a health state.")
+
+	ws.Containers[0].Health = "healthy"
+	ws.SetHealth()
+	assert.Equal(t, "healthy", ws.Health)
+
+	ws.Containers[1].Health = "starting"
+	ws.SetHealth()
+	assert.Equal(t, "starting", ws.Health)
+
+	ws.Containers[0].Health = "unhealthy"
+	ws.SetHealth()
+	assert.Equal(t, "unhealthy", ws.Health)
+}
+
 // Compare 2 ContainerStatus array contents without considering the order
 func statusArrayIsSame(a1 []ContainerStatus, a2 []ContainerStatus) bool {
 	if len(a1) != len(a2) {
@@ -1,22 +1,24 @@
 package helm
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
+	"os"
 	"os/exec"
 	"strings"
 )
 
-// This client implements our abstract helm client interface, using the Helm CLI.
+// This client implements our abstract helm client interface, using the Helm 2 CLI.
 
 type CliClient struct {
 }
 
-const INSTALL_ARGS = "install -n %v %v"
 const UNINSTALL_ARGS = "delete --purge %v"
 const STATUS_ARGS = "list -a"
 const DEPLOYED = "DEPLOYED"
+const SUPERSEDED = "SUPERSEDED"
 
 const EOL = "\x0a"
 const TAB = "\x09"
@@ -25,23 +27,43 @@ func NewCliClient() *CliClient {
 	return new(CliClient)
 }
 
-func (c *CliClient) Install(b64Package string, releaseName string) error {
+func (c *CliClient) Install(b64Package string, releaseName string, opts InstallOptions) error {
+	return c.installOrUpgrade(b64Package, []string{"install", "-n", releaseName}, opts, "install")
+}
+
+func (c *CliClient) Upgrade(b64Package string, releaseName string, opts InstallOptions) error {
+	return c.installOrUpgrade(b64Package, []string{"upgrade", releaseName}, opts, "upgrade")
+}
+
+func (c *CliClient) installOrUpgrade(b64Package string, args []string, opts InstallOptions, action string) error {
 
 	if fileName, err := ConvertB64StringToFile(b64Package); err != nil {
 		return errors.New(fmt.Sprintf("error converting Helm package to file: %v", err))
 	} else {
+		defer os.Remove(fileName)
 		glog.V(5).Infof(clilogString(fmt.Sprintf("Decoded Helm package to file: %v", fileName)))
-		args := fmt.Sprintf(INSTALL_ARGS, releaseName, fileName)
-		glog.V(5).Infof(clilogString(fmt.Sprintf("Installing Helm package: %v", args)))
-		argFields := strings.Fields(args)
-		if out, err := exec.Command("helm", argFields...).Output(); err != nil {
-			errMsg := ""
-			if exErr, ok := err.(*exec.ExitError); ok {
-				errMsg = string(exErr.Stderr)
+
+		args = append(args, fileName)
+		if valuesFile, err := WriteValuesFile(opts.Values); err != nil {
+			return errors.New(fmt.Sprintf("error writing Helm values to file: %v", err))
+		} else if valuesFile != "" {
+			defer os.Remove(valuesFile)
+			args = append(args, "--values", valuesFile)
+		}
+		// helm 2 waits for the resources of an atomic release, and takes the timeout of the wait in seconds. The atomic
+		// flag needs helm 2.13 or later.
+		if opts.Atomic {
+			args = append(args, "--atomic")
+			if opts.TimeoutS > 0 {
+				args = append(args, "--timeout", fmt.Sprintf("%v", opts.TimeoutS))
 			}
-			return errors.New(fmt.Sprintf("error installing Helm package: (%T) %v error message: %v", err, err, errMsg))
+		}
+
+		glog.V(5).Infof(clilogString(fmt.Sprintf("Running Helm %v: %v", action, args)))
+		if out, err := runHelm(args); err != nil {
+			return errors.New(fmt.Sprintf("error running Helm %v: %v", action, err))
 		} else {
-			glog.V(5).Infof(clilogString(fmt.Sprintf("Output from install: (%T) %s", out, string(out))))
+			glog.V(5).Infof(clilogString(fmt.Sprintf("Output from %v: (%T) %s", action, out, string(out))))
 		}
 	}
 
@@ -111,6 +133,65 @@ func (c *CliClient) Status(releaseName string) (*ReleaseStatus, error) {
 
 }
 
+func (c *CliClient) History(releaseName string) ([]ReleaseStatus, error) {
+	return history([]string{"history", releaseName, "--output", "json"}, releaseName)
+}
+
+func (c *CliClient) Rollback(releaseName string, revision int) error {
+	return rollback([]string{"rollback", releaseName, fmt.Sprintf("%v", revision)}, releaseName)
+}
+
+// One revision in the json output of helm history.
+type historyEntry struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	Description string `json:"description"`
+}
+
+func history(args []string, releaseName string) ([]ReleaseStatus, error) {
+	glog.V(5).Infof(clilogString(fmt.Sprintf("Listing Helm release history: %v", args)))
+	out, err := runHelm(args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error listing Helm release history: %v", err))
+	}
+
+	entries := []historyEntry{}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, errors.New(fmt.Sprintf("error reading Helm release history %s: %v", string(out), err))
+	}
+
+	revisions := make([]ReleaseStatus, 0, len(entries))
+	for _, e := range entries {
+		revisions = append(revisions, ReleaseStatus{Name: releaseName, Revision: fmt.Sprintf("%v", e.Revision), Updated: e.Updated, Status: e.Status, ChartName: e.Chart})
+	}
+	return revisions, nil
+}
+
+func rollback(args []string, releaseName string) error {
+	glog.V(5).Infof(clilogString(fmt.Sprintf("Rolling back Helm release: %v", args)))
+	if out, err := runHelm(args); err != nil {
+		return errors.New(fmt.Sprintf("error rolling back Helm release %v: %v", releaseName, err))
+	} else {
+		glog.V(5).Infof(clilogString(fmt.Sprintf("Output from rollback: (%T) %s", out, string(out))))
+	}
+	return nil
+}
+
+// Run the helm binary with the arguments, returning the standard output. The error includes the standard error.
+func runHelm(args []string) ([]byte, error) {
+	out, err := exec.Command("helm", args...).Output()
+	if err != nil {
+		errMsg := ""
+		if exErr, ok := err.(*exec.ExitError); ok {
+			errMsg = string(exErr.Stderr)
+		}
+		return out, errors.New(fmt.Sprintf("(%T) %v error message: %v", err, err, errMsg))
+	}
+	return out, nil
+}
+
 // Helm time format. Golang requires the format string to be in reference to the specific time as shown.
 // This is so that the formatter and parser can figure out what goes where in the string.
 const HelmCLIReleaseStatusTimeFormat = "Mon Jan 2 15:04:05 2006"
@@ -2,10 +2,13 @@ package helm
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 // Status object returned by our Helm client.
@@ -18,22 +21,62 @@ type ReleaseStatus struct {
 	Namespace string // The k8s namespace that the chart was deployed into
 }
 
+// The options of an install or upgrade of a release.
+type InstallOptions struct {
+	Values   map[string]interface{} // Values that override the values of the chart
+	Atomic   bool                   // Remove the release when the install fails, or roll it back when the upgrade fails
+	TimeoutS int                    // How long to wait for the resources of the release to be ready
+}
+
 // The Helm Client interface that we use, regardless of how its implemented under the covers.
 type HelmClient interface {
-	Install(b64Package string, releaseName string) error
+	Install(b64Package string, releaseName string, opts InstallOptions) error
+	Upgrade(b64Package string, releaseName string, opts InstallOptions) error
 	UnInstall(releaseName string) error
 	Status(releaseName string) (*ReleaseStatus, error)
+	History(releaseName string) ([]ReleaseStatus, error)
+	Rollback(releaseName string, revision int) error
 	ReleaseTimeFormat() string
 }
 
-func NewHelmClient() HelmClient {
+// Returns the Helm client of the agent configuration.
+func NewHelmClient(cfg *config.HorizonConfig) HelmClient {
+	if cfg != nil && cfg.GetHelmClient() == config.HELM_CLIENT_HELM3 {
+		return NewHelm3Client(cfg.GetHelmTimeoutS())
+	}
 	return NewCliClient()
 }
 
+// Returns the revision of the latest deployed release before the current revision, or 0 if there is none.
+func PreviousDeployedRevision(history []ReleaseStatus) int {
+	latest, previous := 0, 0
+	for _, rs := range history {
+		var rev int
+		if _, err := fmt.Sscanf(rs.Revision, "%d", &rev); err != nil {
+			continue
+		}
+		if rev > latest {
+			latest = rev
+		}
+	}
+	for _, rs := range history {
+		var rev int
+		if _, err := fmt.Sscanf(rs.Revision, "%d", &rev); err != nil {
+			continue
+		}
+		// superseded revisions were deployed before they were replaced
+		if rev < latest && rev > previous && (strings.EqualFold(rs.Status, DEPLOYED) || strings.EqualFold(rs.Status, SUPERSEDED)) {
+			previous = rev
+		}
+	}
+	return previous
+}
+
 // ========================================================================================
 // Utility functions that all clients will need.
 
 const TEMP_PACKAGE_PREFIX = "anax-helm-package-"
+const TEMP_VALUES_PREFIX = "anax-helm-values-"
 
 // Convert a base 64 encoded string into its original bytes and then write the bytes to a file
 // in the file system.
@@ -53,6 +96,25 @@ func ConvertB64StringToFile(b64Package string) (string, error) {
 	}
 }
 
+// Write the values to a file that can be passed to helm with --values. JSON is valid YAML, so the values are written as
+// JSON. Returns an empty file name when there are no values.
+func WriteValuesFile(values map[string]interface{}) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	if vBytes, err := json.Marshal(values); err != nil {
+		return "", err
+	} else if f, err := ioutil.TempFile("", TEMP_VALUES_PREFIX); err != nil {
+		return "", err
+	} else {
+		defer f.Close()
+		if _, err := f.Write(vBytes); err != nil {
+			return "", err
+		}
+		return f.Name(), nil
+	}
+}
+
 // Convert a Helm chart archive file into a base 64 encoded string. The input filepath is assumed to be absolute.
 func ConvertFileToB64String(filePath string) (string, error) {
 
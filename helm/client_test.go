@@ -5,8 +5,16 @@ package helm
 import (
 	"encoding/base64"
 	"flag"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -35,3 +43,142 @@ func Test_DecodeAndCreate(t *testing.T) {
 	}
 
 }
+
+func Test_PreviousDeployedRevision(t *testing.T) {
+
+	history := []ReleaseStatus{
+		{Revision: "1", Status: "SUPERSEDED"},
+		{Revision: "2", Status: "DEPLOYED"},
+		{Revision: "3", Status: "FAILED"},
+	}
+	if rev := PreviousDeployedRevision(history); rev != 2 {
+		t.Errorf("expected revision 2, got %v", rev)
+	}
+
+	history = []ReleaseStatus{
+		{Revision: "1", Status: "superseded"},
+		{Revision: "2", Status: "failed"},
+		{Revision: "3", Status: "failed"},
+	}
+	if rev := PreviousDeployedRevision(history); rev != 1 {
+		t.Errorf("expected revision 1, got %v", rev)
+	}
+
+	history = []ReleaseStatus{{Revision: "1", Status: "FAILED"}}
+	if rev := PreviousDeployedRevision(history); rev != 0 {
+		t.Errorf("expected no revision, got %v", rev)
+	}
+}
+
+func Test_WriteValuesFile(t *testing.T) {
+
+	if fileName, err := WriteValuesFile(nil); err != nil || fileName != "" {
+		t.Errorf("expected no values file, got %v, error: %v", fileName, err)
+	}
+
+	values := map[string]interface{}{"replicaCount": 2, "color": "blue"}
+	if fileName, err := WriteValuesFile(values); err != nil {
+		t.Errorf("error: %v", err)
+	} else if dat, err := ioutil.ReadFile(fileName); err != nil {
+		t.Errorf("error: %v", err)
+	} else if string(dat) != `{"color":"blue","replicaCount":2}` {
+		t.Errorf("unexpected values file: %v", string(dat))
+	}
+}
+
+func Test_Helm3Client(t *testing.T) {
+
+	// The releases are kept in memory and the resources are not sent to a cluster.
+	actionConfig := &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(format string, v ...interface{}) {},
+	}
+	c := &Helm3Client{
+		namespace: "default",
+		newConfig: func() (*action.Configuration, error) { return actionConfig, nil },
+	}
+	opts := InstallOptions{Values: map[string]interface{}{"color": "blue"}, Atomic: true, TimeoutS: 10}
+
+	if err := c.Install(testChartPackage(t, "1.0.0"), "web", opts); err != nil {
+		t.Fatalf("error installing: %v", err)
+	} else if rs, err := c.Status("web"); err != nil {
+		t.Errorf("error getting status: %v", err)
+	} else if rs.Name != "web" || rs.Revision != "1" || rs.Status != "deployed" || rs.ChartName != "web-1.0.0" || rs.Namespace != "default" {
+		t.Errorf("unexpected status: %v", rs)
+	} else if _, err := time.Parse(c.ReleaseTimeFormat(), rs.Updated); err != nil {
+		t.Errorf("unable to parse the release time %v: %v", rs.Updated, err)
+	}
+
+	// upgrade in place
+	if err := c.Upgrade(testChartPackage(t, "2.0.0"), "web", opts); err != nil {
+		t.Fatalf("error upgrading: %v", err)
+	} else if rs, err := c.Status("web"); err != nil {
+		t.Errorf("error getting status: %v", err)
+	} else if rs.Revision != "2" || rs.ChartName != "web-2.0.0" {
+		t.Errorf("unexpected status after upgrade: %v", rs)
+	}
+
+	// roll back to the revision deployed before the upgrade
+	if history, err := c.History("web"); err != nil {
+		t.Errorf("error getting history: %v", err)
+	} else if len(history) != 2 {
+		t.Errorf("expected 2 revisions, got %v", history)
+	} else if rev := PreviousDeployedRevision(history); rev != 1 {
+		t.Errorf("expected revision 1, got %v", rev)
+	} else if err := c.Rollback("web", rev); err != nil {
+		t.Errorf("error rolling back: %v", err)
+	} else if rs, err := c.Status("web"); err != nil {
+		t.Errorf("error getting status: %v", err)
+	} else if rs.Revision != "3" || rs.ChartName != "web-1.0.0" {
+		t.Errorf("unexpected status after rollback: %v", rs)
+	}
+
+	if err := c.UnInstall("web"); err != nil {
+		t.Errorf("error uninstalling: %v", err)
+	} else if _, err := c.Status("web"); err == nil {
+		t.Errorf("expected an error for the status of an uninstalled release")
+	}
+
+	if err := c.Install("not a package", "web", opts); err == nil {
+		t.Errorf("expected an error for a package that is not base64 encoded")
+	}
+}
+
+// Returns a base64 encoded chart archive with a config map.
+func testChartPackage(t *testing.T, version string) string {
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "web", Version: version},
+		Templates: []*chart.File{
+			{Name: "templates/configmap.yaml", Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  color: {{ .Values.color }}\n")},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "anax-helm-test-")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if fileName, err := chartutil.Save(chrt, dir); err != nil {
+		t.Fatalf("error saving chart: %v", err)
+	} else if b64, err := ConvertFileToB64String(fileName); err != nil {
+		t.Fatalf("error encoding chart: %v", err)
+	} else {
+		return b64
+	}
+	return ""
+}
+
+func Test_userInputValues(t *testing.T) {
+
+	envAdds := map[string]string{"HZN_AGREEMENTID": "ag1", "COLOR": "blue"}
+	values := userInputValues(&envAdds)
+	if len(values) != 1 || values["COLOR"] != "blue" {
+		t.Errorf("unexpected values: %v", values)
+	}
+	if values := userInputValues(nil); len(values) != 0 {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
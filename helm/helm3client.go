@@ -0,0 +1,193 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
+	"time"
+)
+
+// This client implements our abstract helm client interface with the Helm 3 Go SDK, so that the agent does not need
+// a helm binary. The releases are stored in secrets in the namespace of the kube config, like the Helm 3 CLI does.
+
+const HELM3_STORAGE_DRIVER = "secrets"
+
+type Helm3Client struct {
+	namespace string                                // The namespace that the releases are installed into
+	timeout   time.Duration                         // How long a rollback waits for the resources of the release to be ready
+	newConfig func() (*action.Configuration, error) // Returns the configuration of the SDK actions
+}
+
+func NewHelm3Client(timeoutS int) *Helm3Client {
+	return &Helm3Client{
+		namespace: cli.New().Namespace(),
+		timeout:   time.Duration(timeoutS) * time.Second,
+		newConfig: newHelm3Configuration,
+	}
+}
+
+// Returns an SDK configuration that talks to the cluster of the kube config of the agent.
+func newHelm3Configuration() (*action.Configuration, error) {
+	settings := cli.New()
+	actionConfig := new(action.Configuration)
+	debugLog := func(format string, v ...interface{}) {
+		glog.V(5).Infof(h3logString(fmt.Sprintf(format, v...)))
+	}
+	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), HELM3_STORAGE_DRIVER, debugLog); err != nil {
+		return nil, errors.New(fmt.Sprintf("error initializing the Helm configuration: %v", err))
+	}
+	return actionConfig, nil
+}
+
+func (c *Helm3Client) Install(b64Package string, releaseName string, opts InstallOptions) error {
+	actionConfig, err := c.newConfig()
+	if err != nil {
+		return err
+	}
+	chrt, err := loadB64Chart(b64Package)
+	if err != nil {
+		return err
+	}
+
+	install := action.NewInstall(actionConfig)
+	install.ReleaseName = releaseName
+	install.Namespace = c.namespace
+	install.Atomic = opts.Atomic
+	install.Timeout = time.Duration(opts.TimeoutS) * time.Second
+
+	glog.V(5).Infof(h3logString(fmt.Sprintf("Installing Helm release %v of chart %v %v", releaseName, chrt.Metadata.Name, chrt.Metadata.Version)))
+	if rel, err := install.Run(chrt, opts.Values); err != nil {
+		return errors.New(fmt.Sprintf("error installing Helm release %v: %v", releaseName, err))
+	} else {
+		glog.V(5).Infof(h3logString(fmt.Sprintf("Installed Helm release %v revision %v", rel.Name, rel.Version)))
+	}
+	return nil
+}
+
+func (c *Helm3Client) Upgrade(b64Package string, releaseName string, opts InstallOptions) error {
+	actionConfig, err := c.newConfig()
+	if err != nil {
+		return err
+	}
+	chrt, err := loadB64Chart(b64Package)
+	if err != nil {
+		return err
+	}
+
+	upgrade := action.NewUpgrade(actionConfig)
+	upgrade.Namespace = c.namespace
+	upgrade.Atomic = opts.Atomic
+	upgrade.Timeout = time.Duration(opts.TimeoutS) * time.Second
+
+	glog.V(5).Infof(h3logString(fmt.Sprintf("Upgrading Helm release %v to chart %v %v", releaseName, chrt.Metadata.Name, chrt.Metadata.Version)))
+	if rel, err := upgrade.Run(releaseName, chrt, opts.Values); err != nil {
+		return errors.New(fmt.Sprintf("error upgrading Helm release %v: %v", releaseName, err))
+	} else {
+		glog.V(5).Infof(h3logString(fmt.Sprintf("Upgraded Helm release %v to revision %v", rel.Name, rel.Version)))
+	}
+	return nil
+}
+
+func (c *Helm3Client) UnInstall(releaseName string) error {
+	actionConfig, err := c.newConfig()
+	if err != nil {
+		return err
+	}
+
+	glog.V(5).Infof(h3logString(fmt.Sprintf("Uninstalling Helm release %v", releaseName)))
+	if _, err := action.NewUninstall(actionConfig).Run(releaseName); err != nil {
+		return errors.New(fmt.Sprintf("error uninstalling Helm release %v: %v", releaseName, err))
+	}
+	return nil
+}
+
+func (c *Helm3Client) Status(releaseName string) (*ReleaseStatus, error) {
+	actionConfig, err := c.newConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := action.NewStatus(actionConfig).Run(releaseName)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting Helm release status of %v: %v", releaseName, err))
+	}
+	return releaseToStatus(rel), nil
+}
+
+func (c *Helm3Client) History(releaseName string) ([]ReleaseStatus, error) {
+	actionConfig, err := c.newConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	rels, err := action.NewHistory(actionConfig).Run(releaseName)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error getting Helm release history of %v: %v", releaseName, err))
+	}
+	statuses := make([]ReleaseStatus, 0, len(rels))
+	for _, rel := range rels {
+		statuses = append(statuses, *releaseToStatus(rel))
+	}
+	return statuses, nil
+}
+
+func (c *Helm3Client) Rollback(releaseName string, revision int) error {
+	actionConfig, err := c.newConfig()
+	if err != nil {
+		return err
+	}
+
+	rollback := action.NewRollback(actionConfig)
+	rollback.Version = revision
+	rollback.Wait = true
+	rollback.Timeout = c.timeout
+
+	glog.V(5).Infof(h3logString(fmt.Sprintf("Rolling back Helm release %v to revision %v", releaseName, revision)))
+	if err := rollback.Run(releaseName); err != nil {
+		return errors.New(fmt.Sprintf("error rolling back Helm release %v: %v", releaseName, err))
+	}
+	return nil
+}
+
+// The release status has the times in RFC 3339 format.
+func (c *Helm3Client) ReleaseTimeFormat() string {
+	return time.RFC3339Nano
+}
+
+// Decode the base 64 encoded chart archive and load the chart from it.
+func loadB64Chart(b64Package string) (*chart.Chart, error) {
+	if archive, err := base64.StdEncoding.DecodeString(b64Package); err != nil {
+		return nil, errors.New(fmt.Sprintf("error decoding Helm package: %v", err))
+	} else if chrt, err := loader.LoadArchive(bytes.NewReader(archive)); err != nil {
+		return nil, errors.New(fmt.Sprintf("error loading Helm chart from package: %v", err))
+	} else {
+		return chrt, nil
+	}
+}
+
+func releaseToStatus(rel *release.Release) *ReleaseStatus {
+	status := &ReleaseStatus{
+		Name:      rel.Name,
+		Revision:  fmt.Sprintf("%v", rel.Version),
+		Namespace: rel.Namespace,
+	}
+	if rel.Info != nil {
+		status.Updated = rel.Info.LastDeployed.Format(time.RFC3339Nano)
+		status.Status = rel.Info.Status.String()
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		status.ChartName = fmt.Sprintf("%v-%v", rel.Chart.Metadata.Name, rel.Chart.Metadata.Version)
+	}
+	return status
+}
+
+var h3logString = func(v interface{}) string {
+	return fmt.Sprintf("Helm 3 Client: %v", v)
+}
@@ -5,12 +5,20 @@ import (
 	"fmt"
 	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/basicprotocol"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/externalpolicy"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
+	"strings"
+	"time"
 )
 
+// How often the releases kept for a service upgrade are checked, in seconds.
+const PENDING_UNINSTALL_CHECK_INTERVAL_S = 30
+
 type HelmWorker struct {
 	worker.BaseWorker // embedded field
 	db                *bolt.DB
@@ -24,7 +32,7 @@ func NewHelmWorker(name string, config *config.HorizonConfig, db *bolt.DB) *Helm
 	}
 
 	glog.Info(hpwlog(fmt.Sprintf("Starting Helm worker")))
-	worker.Start(worker, 0)
+	worker.Start(worker, PENDING_UNINSTALL_CHECK_INTERVAL_S)
 	return worker
 }
 
@@ -114,6 +122,17 @@ func (w *HelmWorker) CommandHandler(command worker.Command) bool {
 		if !ok {
 			glog.Warningf(hpwlog(fmt.Sprintf("ignoring non-Helm deployment: %v", cmd.Deployment)))
 			return true
+		} else if w.endedForUpgrade(cmd.AgreementProtocol, cmd.CurrentAgreementId) {
+			// Keep the release for a while, so that the agreement for the new version can upgrade it in place.
+			deadline := time.Now().Add(time.Duration(w.Config.GetHelmUpgradeGraceS()) * time.Second)
+			glog.V(3).Infof(hpwlog(fmt.Sprintf("keeping Helm release %v for a service upgrade until %v", hdc.ReleaseName, deadline)))
+			pending := persistence.NewHelmPendingUninstall(hdc.ReleaseName, cmd.CurrentAgreementId, uint64(deadline.Unix()))
+			if err := persistence.SaveHelmPendingUninstall(w.db, pending); err != nil {
+				glog.Errorf(hpwlog(fmt.Sprintf("unable to save the pending uninstall of Helm release %v, uninstalling it now: %v", hdc.ReleaseName, err)))
+				if err := w.uninstallHelmPackage(hdc); err != nil {
+					glog.Errorf(hpwlog(fmt.Sprintf("failed to uninstall helm package after agreement cancellation: %v", err)))
+				}
+			}
 		} else if err := w.uninstallHelmPackage(hdc); err != nil {
 			// Since we have a Helm deployment package, uninstall it.
 			glog.Errorf(hpwlog(fmt.Sprintf("failed to uninstall helm package after agreement cancellation: %v", err)))
@@ -129,7 +148,7 @@ func (w *HelmWorker) CommandHandler(command worker.Command) bool {
 		if !ok {
 			glog.Warningf(hpwlog(fmt.Sprintf("ignoring non-Helm maintenance command: %v", cmd)))
 			return true
-		} else if err := w.releaseStatus(hdc, "DEPLOYED"); err != nil {
+		} else if err := w.releaseStatus(hdc, DEPLOYED); err != nil {
 			glog.Errorf(hpwlog(fmt.Sprintf("%v", err)))
 			// Ask governer to cancel the agreement.
 			w.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, cmd.AgreementProtocol, cmd.AgreementId, hdc)
@@ -142,6 +161,51 @@ func (w *HelmWorker) CommandHandler(command worker.Command) bool {
 
 }
 
+// Uninstall the releases that were kept for a service upgrade that did not happen. The pending uninstalls are read
+// from the db, so the releases kept before an agent restart are uninstalled too.
+func (w *HelmWorker) NoWorkHandler() {
+	pendings, err := persistence.FindHelmPendingUninstalls(w.db)
+	if err != nil {
+		glog.Errorf(hpwlog(fmt.Sprintf("unable to read the pending uninstalls of Helm releases, error: %v", err)))
+		return
+	}
+
+	now := uint64(time.Now().Unix())
+	for _, pending := range pendings {
+		if now < pending.Deadline {
+			continue
+		}
+		glog.V(3).Infof(hpwlog(fmt.Sprintf("no service upgrade took over Helm release %v", pending.ReleaseName)))
+		if err := w.uninstallHelmPackage(&persistence.HelmDeploymentConfig{ReleaseName: pending.ReleaseName}); err != nil {
+			glog.Errorf(hpwlog(fmt.Sprintf("failed to uninstall helm package kept for a service upgrade: %v", err)))
+		}
+		if err := persistence.DeleteHelmPendingUninstall(w.db, pending.ReleaseName); err != nil {
+			glog.Errorf(hpwlog(fmt.Sprintf("%v", err)))
+		}
+	}
+}
+
+// Returns true if the agreement was cancelled so that a different version of the service can be deployed.
+func (w *HelmWorker) endedForUpgrade(protocol string, agreementId string) bool {
+	protocols := policy.AllAgreementProtocols()
+	if protocol != "" {
+		protocols = []string{protocol}
+	}
+	ags, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, protocols, []persistence.EAFilter{persistence.IdEAFilter(agreementId)})
+	if err != nil {
+		glog.Errorf(hpwlog(fmt.Sprintf("unable to read agreement %v, error: %v", agreementId, err)))
+		return false
+	} else if len(ags) != 1 {
+		return false
+	}
+
+	switch ags[0].TerminatedReason {
+	case basicprotocol.CANCEL_MS_UPGRADE_REQUIRED, basicprotocol.CANCEL_MS_DOWNGRADE_REQUIRED, basicprotocol.AB_CANCEL_FORCED_UPGRADE, basicprotocol.AB_CANCEL_POLICY_CHANGED:
+		return true
+	}
+	return false
+}
+
 func (w *HelmWorker) getLaunchContext(launchContext interface{}) *events.AgreementLaunchContext {
 	switch launchContext.(type) {
 	case *events.AgreementLaunchContext:
@@ -157,8 +221,32 @@ func (w *HelmWorker) processHelmPackage(launchContext *events.AgreementLaunchCon
 
 	// TODO: Verify signature
 
-	c := NewHelmClient()
-	if err := c.Install(hd.ChartArchive, hd.ReleaseName); err != nil {
+	values, err := w.chartValues(launchContext.EnvironmentAdditions, hd)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to set the values of Helm package %v, error: %v", hd, err))
+	}
+
+	c := NewHelmClient(w.Config)
+	opts := InstallOptions{
+		Values:   values,
+		Atomic:   w.Config.Edge.Helm.Atomic,
+		TimeoutS: w.Config.GetHelmTimeoutS(),
+	}
+
+	// A release that is still there, like one kept for a service upgrade, is upgraded in place.
+	if err := persistence.DeleteHelmPendingUninstall(w.db, hd.ReleaseName); err != nil {
+		return errors.New(fmt.Sprintf("unable to take over Helm release %v kept for a service upgrade, error: %v", hd.ReleaseName, err))
+	}
+	if status, err := c.Status(hd.ReleaseName); err == nil && status != nil {
+		glog.V(3).Infof(hpwlog(fmt.Sprintf("upgrading Helm Deployment release %v from revision %v", hd.ReleaseName, status.Revision)))
+		if err := c.Upgrade(hd.ChartArchive, hd.ReleaseName, opts); err != nil {
+			// an atomic upgrade rolls itself back
+			if !opts.Atomic {
+				w.rollbackRelease(c, hd.ReleaseName)
+			}
+			return errors.New(fmt.Sprintf("unable to upgrade Helm package %v, error: %v", hd, err))
+		}
+	} else if err := c.Install(hd.ChartArchive, hd.ReleaseName, opts); err != nil {
 		return errors.New(fmt.Sprintf("unable to install Helm package %v, error: %v", hd, err))
 	}
 
@@ -167,11 +255,60 @@ func (w *HelmWorker) processHelmPackage(launchContext *events.AgreementLaunchCon
 	return nil
 }
 
+// Roll the release back to the revision that was deployed before the current one.
+func (w *HelmWorker) rollbackRelease(c HelmClient, releaseName string) {
+	if history, err := c.History(releaseName); err != nil {
+		glog.Errorf(hpwlog(fmt.Sprintf("unable to roll back Helm release %v, error: %v", releaseName, err)))
+	} else if rev := PreviousDeployedRevision(history); rev == 0 {
+		glog.Warningf(hpwlog(fmt.Sprintf("no previous revision of Helm release %v to roll back to", releaseName)))
+	} else if err := c.Rollback(releaseName, rev); err != nil {
+		glog.Errorf(hpwlog(fmt.Sprintf("unable to roll back Helm release %v to revision %v, error: %v", releaseName, rev, err)))
+	} else {
+		glog.V(3).Infof(hpwlog(fmt.Sprintf("rolled back Helm release %v to revision %v", releaseName, rev)))
+	}
+}
+
+// A chart that declares value mappings gets the values mapped from the user input of the service and the properties
+// of the node policy. Otherwise the user input overrides the chart values with the same names.
+func (w *HelmWorker) chartValues(envAdds *map[string]string, hd *persistence.HelmDeploymentConfig) (map[string]interface{}, error) {
+	if len(hd.Values) == 0 {
+		return userInputValues(envAdds), nil
+	}
+
+	userInput := map[string]string{}
+	if envAdds != nil {
+		userInput = *envAdds
+	}
+
+	var nodeProps externalpolicy.PropertyList
+	if nodePol, err := persistence.FindNodePolicy(w.db); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read the node policy, error: %v", err))
+	} else if nodePol != nil {
+		nodeProps = nodePol.Properties
+	}
+
+	return hd.ChartValues(userInput, nodeProps)
+}
+
+// The variables that the agent sets for every service are not chart values.
+func userInputValues(envAdds *map[string]string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if envAdds == nil {
+		return values
+	}
+	for name, value := range *envAdds {
+		if !strings.HasPrefix(name, config.ENVVAR_PREFIX) {
+			values[name] = value
+		}
+	}
+	return values
+}
+
 func (w *HelmWorker) uninstallHelmPackage(hd *persistence.HelmDeploymentConfig) error {
 
 	glog.V(5).Infof(hpwlog(fmt.Sprintf("begin uninstall of Helm Deployment release %v", hd.ReleaseName)))
 
-	c := NewHelmClient()
+	c := NewHelmClient(w.Config)
 	if err := c.UnInstall(hd.ReleaseName); err != nil {
 		return errors.New(fmt.Sprintf("unable to uninstall Helm package %v, error: %v", hd, err))
 	}
@@ -185,11 +322,11 @@ func (w *HelmWorker) releaseStatus(hd *persistence.HelmDeploymentConfig, desired
 
 	glog.V(5).Infof(hpwlog(fmt.Sprintf("begin listing Helm Deployment release %v", hd.ReleaseName)))
 
-	c := NewHelmClient()
+	c := NewHelmClient(w.Config)
 	status, err := c.Status(hd.ReleaseName)
 	if err != nil {
 		return errors.New(fmt.Sprintf("unable to list Helm release %v, error: %v", hd.ReleaseName, err))
-	} else if status.Status != desiredStatus {
+	} else if !strings.EqualFold(status.Status, desiredStatus) {
 		return errors.New(fmt.Sprintf("Helm release %v is not in desiredStatus %v, in %v", hd.ReleaseName, desiredStatus, status))
 	}
 
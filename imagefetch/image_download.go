@@ -0,0 +1,459 @@
+package imagefetch
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/imageregistry"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The directory in the agent database directory where the blobs of the images that the agent downloads itself are kept
+// until the images are loaded.
+const IMAGE_BLOBS_DIR = "imageblobs"
+
+// The size of the reads of a blob download, small enough for the download rate to stay even.
+const blobReadSize = 32 * 1024
+
+// A download rate limiter. It is shared by the image pulls that run at the same time, so that together they stay within
+// the rate. Each read of a download reserves the time the bytes take at the rate, and waits until that time.
+type rateLimiter struct {
+	lock sync.Mutex
+	rate int64     // bytes per second, 0 means that the rate is not limited
+	next time.Time // the time when the bytes read so far are downloaded at the rate
+}
+
+func (l *rateLimiter) setRate(rate int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.rate = rate
+}
+
+func (l *rateLimiter) limited() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.rate > 0
+}
+
+// Reserve the time that the bytes take at the rate, and return how long to wait for it.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	return l.next.Sub(now)
+}
+
+var rateSleep = time.Sleep
+
+// A reader of a download that goes through the rate limiters, it waits for the slowest of them.
+type rateLimitedReader struct {
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+func (r *rateLimitedReader) Read(b []byte) (int, error) {
+	if len(b) > blobReadSize {
+		b = b[:blobReadSize]
+	}
+	n, err := r.r.Read(b)
+
+	wait := time.Duration(0)
+	for _, l := range r.limiters {
+		if w := l.reserve(n); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		rateSleep(wait)
+	}
+	return n, err
+}
+
+// The blobs that are being downloaded, so that two pulls of images with a common layer do not write the same blob file at
+// the same time, and the blobs are not removed while a pull uses them.
+var blobLocks = struct {
+	sync.Mutex
+	held map[string]*blobLock
+}{held: make(map[string]*blobLock)}
+
+type blobLock struct {
+	sync.Mutex
+	users int
+}
+
+// Lock the blobs of the digests, in the order of the digests so that two pulls cannot wait for each other. The returned
+// function unlocks them.
+func lockBlobs(digests []string) func() {
+	sorted := make([]string, 0, len(digests))
+	seen := make(map[string]bool)
+	for _, d := range digests {
+		if !seen[d] {
+			seen[d] = true
+			sorted = append(sorted, d)
+		}
+	}
+	sort.Strings(sorted)
+
+	locks := make([]*blobLock, 0, len(sorted))
+	for _, d := range sorted {
+		blobLocks.Lock()
+		l, ok := blobLocks.held[d]
+		if !ok {
+			l = &blobLock{}
+			blobLocks.held[d] = l
+		}
+		l.users++
+		blobLocks.Unlock()
+
+		l.Lock()
+		locks = append(locks, l)
+	}
+
+	return func() {
+		for i, d := range sorted {
+			locks[i].Unlock()
+			blobLocks.Lock()
+			if locks[i].users--; locks[i].users == 0 {
+				delete(blobLocks.held, d)
+			}
+			blobLocks.Unlock()
+		}
+	}
+}
+
+func blobLocked(digest string) bool {
+	blobLocks.Lock()
+	defer blobLocks.Unlock()
+	_, ok := blobLocks.held[digest]
+	return ok
+}
+
+// Docker cannot limit the download rate of its pulls, so when the rate is limited the agent downloads the blobs of the
+// images from the registry itself, through the rate limiters, and loads the images into the container runtime. The
+// blobs are kept in a directory until the image is loaded, so a download that fails or stops at the end of a pull window
+// resumes from the bytes that were downloaded. A nil downloader, used when the rate is not limited, does nothing.
+type imageDownloader struct {
+	registry *imageregistry.RegistryClient
+	dir      string
+	limiters []*rateLimiter
+}
+
+// Returns the downloader of the images through the rate limiters, nil when none of them limits the rate.
+func newImageDownloader(cfg *config.HorizonConfig, limiters []*rateLimiter) *imageDownloader {
+	limited := false
+	for _, l := range limiters {
+		limited = limited || l.limited()
+	}
+	if !limited {
+		return nil
+	}
+
+	// the download of a blob at a limited rate can take a long time, so the http client has no overall timeout
+	timeoutS := uint(0)
+	return &imageDownloader{
+		registry: imageregistry.NewRegistryClient(cfg.Collaborators.HTTPClientFactory.NewHTTPClient(&timeoutS)),
+		dir:      path.Join(cfg.Edge.DBPath, IMAGE_BLOBS_DIR),
+		limiters: limiters,
+	}
+}
+
+// Download the image of the pull options from its registry and load it into the container runtime, unless the runtime
+// already has it. The loaded image has no name, the pull of the image that follows finds the image and only reads its
+// manifest from the registry, then it tags the image and records its digest.
+func (d *imageDownloader) download(ctx context.Context, client containerruntime.ContainerRuntime, opts docker.PullImageOptions, auth docker.AuthConfiguration, progress *pullProgress) error {
+	if d == nil {
+		return nil
+	}
+
+	domain, imagePath, _, digest := cutil.ParseDockerImagePath(opts.Repository)
+	reference := opts.Tag
+	if digest != "" {
+		reference = digest
+	}
+	registry, repo := imageregistry.RegistryRepository(domain, imagePath)
+
+	manifest, _, err := d.registry.PlatformManifest(registry, repo, reference, nodePlatform(client), auth)
+	if err != nil {
+		return fmt.Errorf("unable to get the manifest of image %v, error: %v", opts.Repository, err)
+	} else if _, err := client.InspectImage(manifest.Config.Digest); err == nil {
+		glog.V(5).Infof(ptLogString(fmt.Sprintf("image %v is already loaded", opts.Repository)))
+		return nil
+	}
+
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return fmt.Errorf("unable to create the image blob directory %v, error: %v", d.dir, err)
+	}
+
+	digests := []string{manifest.Config.Digest}
+	for _, layer := range manifest.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	unlock := lockBlobs(digests)
+	defer unlock()
+
+	if err := d.downloadBlob(ctx, registry, repo, manifest.Config, auth, nil); err != nil {
+		return err
+	}
+	for _, layer := range manifest.Layers {
+		if err := d.downloadBlob(ctx, registry, repo, layer, auth, progress); err != nil {
+			return err
+		}
+	}
+
+	if err := d.load(ctx, client, manifest); err != nil {
+		return fmt.Errorf("unable to load image %v, error: %v", opts.Repository, err)
+	} else if _, err := client.InspectImage(manifest.Config.Digest); err != nil {
+		return fmt.Errorf("image %v is not in the container runtime after it was loaded, error: %v", opts.Repository, err)
+	}
+
+	for _, digest := range digests {
+		if err := os.Remove(d.blobFile(digest)); err != nil && !os.IsNotExist(err) {
+			glog.Warningf(ptLogString(fmt.Sprintf("unable to remove blob %v, error: %v", digest, err)))
+		}
+	}
+	glog.V(3).Infof(ptLogString(fmt.Sprintf("downloaded and loaded image %v", opts.Repository)))
+	return nil
+}
+
+// Returns the name of the file of a downloaded blob.
+func (d *imageDownloader) blobFile(digest string) string {
+	return path.Join(d.dir, strings.Replace(digest, ":", "_", 1))
+}
+
+// Download a blob of an image into its file, resuming from the part of the blob that was downloaded before. The blob is
+// checked against its digest once it is downloaded. The progress of the layers of the image is recorded in the progress
+// of the pull.
+func (d *imageDownloader) downloadBlob(ctx context.Context, registry string, repo string, blob imageregistry.Descriptor, auth docker.AuthConfiguration, progress *pullProgress) error {
+	if !strings.HasPrefix(blob.Digest, "sha256:") {
+		return fmt.Errorf("blob %v does not have a sha256 digest", blob.Digest)
+	}
+
+	// docker shows the layers of a pull by the start of their digest
+	id := strings.TrimPrefix(blob.Digest, "sha256:")[:12]
+
+	fileName := d.blobFile(blob.Digest)
+	if info, err := os.Stat(fileName); err == nil {
+		if progress != nil {
+			progress.layerProgress(id, info.Size(), info.Size(), info.Size(), true)
+		}
+		return nil
+	}
+
+	partName := fileName + ".partial"
+	f, err := os.OpenFile(partName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open blob file %v, error: %v", partName, err)
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	resumed := offset
+	if offset < blob.Size {
+		body, start, err := d.registry.GetBlob(ctx, registry, repo, blob.Digest, offset, auth)
+		if err != nil {
+			return fmt.Errorf("unable to download blob %v, error: %v", blob.Digest, err)
+		}
+		defer body.Close()
+
+		// the registry sends the whole blob when it does not support range requests
+		if start != offset {
+			if err := f.Truncate(start); err != nil {
+				return err
+			} else if offset, err = f.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+			resumed = start
+		}
+		if resumed > 0 {
+			glog.V(5).Infof(ptLogString(fmt.Sprintf("resuming the download of blob %v at byte %v", blob.Digest, resumed)))
+		}
+
+		reader := &rateLimitedReader{r: body, limiters: d.limiters}
+		buf := make([]byte, blobReadSize)
+		for {
+			n, rerr := reader.Read(buf)
+			if n > 0 {
+				if _, err := f.Write(buf[:n]); err != nil {
+					return fmt.Errorf("unable to write blob file %v, error: %v", partName, err)
+				}
+				offset += int64(n)
+				if progress != nil {
+					progress.layerProgress(id, resumed, offset, blob.Size, false)
+				}
+			}
+			if rerr == io.EOF {
+				break
+			} else if rerr != nil {
+				return fmt.Errorf("download of blob %v stopped at byte %v, error: %v", blob.Digest, offset, rerr)
+			}
+		}
+	}
+
+	// a blob that does not match its digest is downloaded again from the start
+	hash := sha256.New()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	} else if _, err := io.Copy(hash, f); err != nil {
+		return err
+	} else if actual := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actual != blob.Digest {
+		os.Remove(partName)
+		return fmt.Errorf("downloaded blob has digest %v, expected %v", actual, blob.Digest)
+	} else if err := os.Rename(partName, fileName); err != nil {
+		return fmt.Errorf("unable to rename blob file %v, error: %v", partName, err)
+	}
+
+	if progress != nil {
+		progress.layerProgress(id, resumed, offset, blob.Size, true)
+	}
+	return nil
+}
+
+// The manifest of an archive in the format of docker save.
+type archiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Load the image into the container runtime from an archive in the format of docker save, made of the downloaded blobs.
+// The layers in the archive are compressed as they are in the registry, the container runtime decompresses them.
+func (d *imageDownloader) load(ctx context.Context, client containerruntime.ContainerRuntime, manifest *imageregistry.Manifest) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(d.writeArchive(pw, manifest))
+	}()
+
+	err := client.LoadImage(docker.LoadImageOptions{InputStream: pr, OutputStream: ioutil.Discard, Context: ctx})
+	pr.Close()
+	return err
+}
+
+func (d *imageDownloader) writeArchive(w io.Writer, manifest *imageregistry.Manifest) error {
+	am := archiveManifest{
+		Config:   strings.TrimPrefix(manifest.Config.Digest, "sha256:") + ".json",
+		RepoTags: []string{},
+		Layers:   []string{},
+	}
+	files := map[string]string{am.Config: manifest.Config.Digest}
+	for _, layer := range manifest.Layers {
+		name := strings.TrimPrefix(layer.Digest, "sha256:") + ".tar"
+		am.Layers = append(am.Layers, name)
+		files[name] = layer.Digest
+	}
+
+	tw := tar.NewWriter(w)
+	if b, err := json.Marshal([]archiveManifest{am}); err != nil {
+		return err
+	} else if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(b))}); err != nil {
+		return err
+	} else if _, err := tw.Write(b); err != nil {
+		return err
+	}
+
+	for name, digest := range files {
+		if err := writeArchiveFile(tw, name, d.blobFile(digest)); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil {
+		return err
+	} else if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Returns the platform of the images that the container runtime runs, from the architecture of the host that the runtime
+// reports. The architectures are named as in the OCI image spec.
+func nodePlatform(client containerruntime.ContainerRuntime) imageregistry.Platform {
+	platform := imageregistry.Platform{OS: "linux", Architecture: runtime.GOARCH}
+
+	info, err := client.Info()
+	if err != nil {
+		glog.Warningf(ptLogString(fmt.Sprintf("unable to get the architecture of the container runtime, using %v, error: %v", platform, err)))
+		return platform
+	} else if info.OSType != "" {
+		platform.OS = info.OSType
+	}
+
+	switch info.Architecture {
+	case "x86_64", "amd64":
+		platform.Architecture = "amd64"
+	case "aarch64", "arm64":
+		platform.Architecture, platform.Variant = "arm64", "v8"
+	case "armv7l":
+		platform.Architecture, platform.Variant = "arm", "v7"
+	case "armv6l":
+		platform.Architecture, platform.Variant = "arm", "v6"
+	case "i386", "i686":
+		platform.Architecture = "386"
+	case "":
+	default:
+		platform.Architecture = info.Architecture
+	}
+	return platform
+}
+
+// Remove the blobs of the downloads that have not been resumed for the grace period of the image garbage collector,
+// the pulls of their images were given up.
+func RemoveStaleBlobs(cfg *config.HorizonConfig) error {
+	dir := path.Join(cfg.Edge.DBPath, IMAGE_BLOBS_DIR)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read the image blob directory %v, error: %v", dir, err)
+	}
+
+	cutoff := time.Now().Add(-time.Duration(cfg.GetImageGCGracePeriod()) * time.Second)
+	for _, f := range files {
+		digest := strings.Replace(strings.TrimSuffix(f.Name(), ".partial"), "_", ":", 1)
+		if f.ModTime().After(cutoff) || blobLocked(digest) {
+			continue
+		} else if err := os.Remove(path.Join(dir, f.Name())); err != nil {
+			glog.Warningf(gcLogString(fmt.Sprintf("unable to remove blob file %v, error: %v", f.Name(), err)))
+		} else {
+			glog.V(3).Infof(gcLogString(fmt.Sprintf("removed blob file %v, unused since %v", f.Name(), f.ModTime())))
+		}
+	}
+	return nil
+}
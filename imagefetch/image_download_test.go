@@ -0,0 +1,241 @@
+// +build unit
+
+package imagefetch
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/imageregistry"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sha256Digest(b []byte) string {
+	hash := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// Returns a compressed image layer with a file of the given content, and the digest of the uncompressed layer.
+func makeLayer(t *testing.T, name string, content []byte) ([]byte, string) {
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+	tw.Write(content)
+	assert.Nil(t, tw.Close())
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write(layer.Bytes())
+	assert.Nil(t, gw.Close())
+	return compressed.Bytes(), sha256Digest(layer.Bytes())
+}
+
+func Test_rateLimiter(t *testing.T) {
+	l := &rateLimiter{}
+	assert.False(t, l.limited())
+	assert.Equal(t, time.Duration(0), l.reserve(1000))
+
+	// the reservations of the reads add up
+	l.setRate(1000)
+	assert.True(t, l.limited())
+	assert.InDelta(t, float64(500*time.Millisecond), float64(l.reserve(500)), float64(50*time.Millisecond))
+	assert.InDelta(t, float64(time.Second), float64(l.reserve(500)), float64(50*time.Millisecond))
+
+	// the reader waits for the slowest limiter
+	var waits []time.Duration
+	sleep := rateSleep
+	defer func() { rateSleep = sleep }()
+	rateSleep = func(d time.Duration) { waits = append(waits, d) }
+
+	r := &rateLimitedReader{r: bytes.NewReader(make([]byte, 100000)), limiters: []*rateLimiter{{rate: 1000000}, {rate: 100000}}}
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, 100000, len(b))
+	assert.InDelta(t, float64(time.Second), float64(waits[len(waits)-1]), float64(100*time.Millisecond))
+}
+
+func Test_imageDownloader_download(t *testing.T) {
+
+	content := make([]byte, 100000)
+	rand.Read(content)
+	layer1, diffId1 := makeLayer(t, "a.txt", content)
+	layer2, diffId2 := makeLayer(t, "b.txt", []byte("b"))
+	config, _ := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{diffId1, diffId2}},
+	})
+	manifest, _ := json.Marshal(imageregistry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     imageregistry.DOCKER_MANIFEST_MEDIA_TYPE,
+		Config:        imageregistry.Descriptor{Digest: sha256Digest(config), Size: int64(len(config))},
+		Layers: []imageregistry.Descriptor{
+			{Digest: sha256Digest(layer1), Size: int64(len(layer1))},
+			{Digest: sha256Digest(layer2), Size: int64(len(layer2))},
+		},
+	})
+	blobs := map[string][]byte{sha256Digest(config): config, sha256Digest(layer1): layer1, sha256Digest(layer2): layer2}
+
+	var lock sync.Mutex
+	ranges := make(map[string]string)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		digest := path.Base(r.URL.Path)
+		if r.URL.Path == "/v2/myrepo/myimage/manifests/1.0" {
+			w.Header().Set("Content-Type", imageregistry.DOCKER_MANIFEST_MEDIA_TYPE)
+			w.Write(manifest)
+		} else if blob, ok := blobs[digest]; ok && r.URL.Path == "/v2/myrepo/myimage/blobs/"+digest {
+			lock.Lock()
+			ranges[digest] = r.Header.Get("Range")
+			lock.Unlock()
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	dir, err := ioutil.TempDir("", "imgdl-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var waited time.Duration
+	sleep := rateSleep
+	defer func() { rateSleep = sleep }()
+	rateSleep = func(d time.Duration) { waited = d }
+
+	d := &imageDownloader{
+		registry: imageregistry.NewRegistryClient(server.Client()),
+		dir:      dir,
+		limiters: []*rateLimiter{{rate: 100000}},
+	}
+
+	// an earlier pull downloaded the start of the first layer
+	resumed := 40000
+	partName := d.blobFile(sha256Digest(layer1)) + ".partial"
+	assert.Nil(t, ioutil.WriteFile(partName, layer1[:resumed], 0600))
+
+	client := containerruntime.NewFakeRuntime()
+	opts := docker.PullImageOptions{Repository: u.Host + "/myrepo/myimage", Tag: "1.0"}
+	progress := newPullProgress()
+	assert.Nil(t, d.download(context.Background(), client, opts, docker.AuthConfiguration{}, progress))
+
+	// the image is loaded, with the config that was downloaded
+	img, err := client.InspectImage(sha256Digest(config))
+	assert.Nil(t, err)
+	assert.Equal(t, sha256Digest(config), img.ID)
+
+	// the download of the first layer resumed where the earlier pull stopped
+	assert.Equal(t, fmt.Sprintf("bytes=%d-", resumed), ranges[sha256Digest(layer1)])
+	assert.Equal(t, "", ranges[sha256Digest(layer2)])
+	assert.Equal(t, int64(len(layer1)-resumed+len(layer2)), progress.Bytes())
+	assert.Equal(t, 2, progress.FetchedLayers())
+	for _, l := range progress.Layers() {
+		assert.True(t, l.Complete)
+	}
+
+	// the download was limited to the rate
+	expected := time.Duration(int64(len(config)+len(layer1)-resumed+len(layer2)) * int64(time.Second) / 100000)
+	assert.InDelta(t, float64(expected), float64(waited), float64(100*time.Millisecond))
+
+	// the blobs are removed once the image is loaded
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 0, len(files))
+
+	// an image that is loaded already is not downloaded again
+	ranges = make(map[string]string)
+	assert.Nil(t, d.download(context.Background(), client, opts, docker.AuthConfiguration{}, newPullProgress()))
+	assert.Equal(t, 0, len(ranges))
+
+	// a nil downloader, used when the rate is not limited, does nothing
+	var none *imageDownloader
+	assert.Nil(t, none.download(context.Background(), client, docker.PullImageOptions{Repository: "myrepo/other"}, docker.AuthConfiguration{}, progress))
+}
+
+func Test_newImageDownloader(t *testing.T) {
+	cfg := &config.HorizonConfig{Edge: config.Config{DBPath: "/var/horizon"}}
+	assert.Nil(t, newImageDownloader(cfg, []*rateLimiter{{}}))
+}
+
+func Test_nodePlatform(t *testing.T) {
+	assert.Equal(t, imageregistry.Platform{OS: "linux", Architecture: "amd64"}, nodePlatform(containerruntime.NewFakeRuntime()))
+}
+
+func Test_RemoveStaleBlobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgdl-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.HorizonConfig{Edge: config.Config{DBPath: dir, ImageGC: config.ImageGCConfig{GracePeriodS: 3600}}}
+	blobDir := path.Join(dir, IMAGE_BLOBS_DIR)
+	assert.Nil(t, os.MkdirAll(blobDir, 0700))
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"sha256_aaaa", "sha256_bbbb.partial", "sha256_cccc.partial", "sha256_dddd"} {
+		assert.Nil(t, ioutil.WriteFile(path.Join(blobDir, name), []byte("x"), 0600))
+	}
+	assert.Nil(t, os.Chtimes(path.Join(blobDir, "sha256_aaaa"), old, old))
+	assert.Nil(t, os.Chtimes(path.Join(blobDir, "sha256_bbbb.partial"), old, old))
+	assert.Nil(t, os.Chtimes(path.Join(blobDir, "sha256_cccc.partial"), old, old))
+
+	// the blob of a running download is kept
+	unlock := lockBlobs([]string{"sha256:cccc"})
+	assert.Nil(t, RemoveStaleBlobs(cfg))
+	unlock()
+
+	files, _ := ioutil.ReadDir(blobDir)
+	names := make([]string, 0)
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"sha256_cccc.partial", "sha256_dddd"}, names)
+	assert.False(t, blobLocked("sha256:cccc"))
+}
+
+func Test_newPullLimits(t *testing.T) {
+	cfg := &config.HorizonConfig{
+		Edge: config.Config{DBPath: "/var/horizon"},
+		Collaborators: config.Collaborators{
+			HTTPClientFactory: &config.HTTPClientFactory{NewHTTPClient: func(*uint) *http.Client { return http.DefaultClient }},
+		},
+	}
+	defer pullRate.setRate(0)
+	defer prefetchRate.setRate(0)
+
+	// the downloads are not limited
+	assert.Nil(t, newPullLimits(cfg).downloader)
+	assert.Nil(t, newPullLimits(cfg, prefetchRate).downloader)
+
+	// only the prefetches are limited
+	prefetchRate.setRate(1024)
+	assert.Nil(t, newPullLimits(cfg).downloader)
+	limits := newPullLimits(cfg, prefetchRate)
+	assert.NotNil(t, limits.downloader)
+	assert.Equal(t, []*rateLimiter{prefetchRate, pullRate}, limits.downloader.limiters)
+	assert.Equal(t, path.Join("/var/horizon", IMAGE_BLOBS_DIR), limits.downloader.dir)
+
+	// all of the pulls are limited, the prefetches share the limiter of all of the pulls
+	cfg.Edge.ImagePull.MaxKBps = 64
+	limits = newPullLimits(cfg)
+	assert.NotNil(t, limits.downloader)
+	assert.Equal(t, []*rateLimiter{pullRate}, limits.downloader.limiters)
+	assert.True(t, pullRate.limited())
+}
@@ -0,0 +1,214 @@
+package imagefetch
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"golang.org/x/sys/unix"
+	"time"
+)
+
+const IMAGE_GC = "ImageGC"
+
+// The error returned when the free disk space is below the configured minimum.
+type DiskPressureError struct {
+	Path string
+	Free uint64
+	Min  uint64
+}
+
+func (e *DiskPressureError) Error() string {
+	return fmt.Sprintf("free disk space %v MB on %v is below the minimum of %v MB", e.Free/(1024*1024), e.Path, e.Min/(1024*1024))
+}
+
+// Returns the number of bytes available to unprivileged users on the file system of the path.
+func FreeDiskSpace(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// Returns a DiskPressureError if the free disk space where the images are stored is below the configured minimum. When
+// the free disk space cannot be determined, for example because the docker root directory is not visible to the agent,
+// the check is skipped.
+func CheckDiskSpace(cfg *config.HorizonConfig) error {
+	min := cfg.GetMinFreeDisk()
+	if min == 0 {
+		return nil
+	}
+
+	path := cfg.Edge.ImageGC.DiskPath
+	if path == "" && cfg.Edge.DockerEndpoint != "" {
+		if client, err := containerruntime.NewAgentContainerRuntime(cfg); err != nil {
+			glog.Warningf(gcLogString(fmt.Sprintf("unable to create %v client to find the docker root directory, error: %v", cfg.GetContainerRuntime(), err)))
+		} else if info, err := client.Info(); err != nil {
+			glog.Warningf(gcLogString(fmt.Sprintf("unable to get docker info to find the docker root directory, error: %v", err)))
+		} else {
+			path = info.DockerRootDir
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	free, err := FreeDiskSpace(path)
+	if err != nil {
+		glog.Warningf(gcLogString(fmt.Sprintf("unable to get the free disk space on %v, error: %v", path, err)))
+		return nil
+	}
+	freeDisk.Set(float64(free))
+
+	if free < min {
+		return &DiskPressureError{Path: path, Free: free, Min: min}
+	}
+	return nil
+}
+
+// The image garbage collector subworker.
+func (w *ImageFetchWorker) collectImages() int {
+	if err := CollectUnusedImages(w.Config, w.db, w.client); err != nil {
+		glog.Errorf(gcLogString(err))
+	}
+	if err := RemoveStaleBlobs(w.Config); err != nil {
+		glog.Errorf(gcLogString(err))
+	}
+	return 0
+}
+
+// Remove the images pulled by the agent that have not been used by any agreement or service for the grace period.
+func CollectUnusedImages(cfg *config.HorizonConfig, db *bolt.DB, client containerruntime.ContainerRuntime) error {
+	if client == nil || db == nil {
+		return nil
+	}
+
+	pulled, err := persistence.FindPulledImages(db)
+	if err != nil {
+		return fmt.Errorf("unable to read pulled images from the local database, error: %v", err)
+	} else if len(pulled) == 0 {
+		return nil
+	}
+
+	inUse, err := imagesInUse(db, client)
+	if err != nil {
+		return err
+	}
+
+	used, unused := selectUnusedImages(pulled, inUse, uint64(time.Now().Unix()), uint64(cfg.GetImageGCGracePeriod()))
+
+	for _, pi := range used {
+		if err := persistence.SavePulledImage(db, &pi); err != nil {
+			return fmt.Errorf("unable to save pulled image %v, error: %v", pi.Name, err)
+		}
+	}
+
+	for _, pi := range unused {
+		if err := client.RemoveImage(pi.Name); err != nil && err != docker.ErrNoSuchImage {
+			// the image may have been taken into use since the check, try again next time
+			glog.Warningf(gcLogString(fmt.Sprintf("unable to remove image %v, error: %v", pi.Name, err)))
+			continue
+		} else if err == nil {
+			imagesRemoved.Inc()
+			glog.V(3).Infof(gcLogString(fmt.Sprintf("removed image %v, unused since %v", pi.Name, time.Unix(int64(pi.LastUsedTime), 0))))
+		}
+		if err := persistence.DeletePulledImage(db, pi.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Split the pulled images into the images that are in use, with their last used time set to now, and the images that
+// have not been used for the grace period. The inUse map contains the names and the ids of the images that are in use.
+func selectUnusedImages(pulled []persistence.PulledImage, inUse map[string]bool, now uint64, gracePeriod uint64) ([]persistence.PulledImage, []persistence.PulledImage) {
+	used := make([]persistence.PulledImage, 0)
+	unused := make([]persistence.PulledImage, 0)
+
+	for _, pi := range pulled {
+		if inUse[pi.Name] || (pi.ImageId != "" && inUse[pi.ImageId]) {
+			pi.LastUsedTime = now
+			used = append(used, pi)
+		} else if now >= pi.LastUsedTime+gracePeriod {
+			unused = append(unused, pi)
+		}
+	}
+	return used, unused
+}
+
+// Returns the names and the ids of the images used by containers, by unarchived agreements and by unarchived service
+// instances.
+func imagesInUse(db *bolt.DB, client containerruntime.ContainerRuntime) (map[string]bool, error) {
+	inUse := make(map[string]bool)
+	names := make([]string, 0)
+
+	containers, err := client.ListContainers(docker.ListContainersOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list docker containers, error: %v", err)
+	}
+	for _, c := range containers {
+		names = append(names, c.Image)
+	}
+
+	agreements, err := persistence.FindEstablishedAgreementsAllProtocols(db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter()})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read agreements from the local database, error: %v", err)
+	}
+	for _, ag := range agreements {
+		for _, sc := range ag.CurrentDeployment {
+			names = append(names, sc.Config.Image)
+		}
+	}
+
+	instances, err := persistence.FindMicroserviceInstances(db, []persistence.MIFilter{persistence.UnarchivedMIFilter()})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service instances from the local database, error: %v", err)
+	}
+	for _, mi := range instances {
+		if mi.MicroserviceDefId == "" {
+			continue
+		} else if msdef, err := persistence.FindMicroserviceDefWithKey(db, mi.MicroserviceDefId); err != nil {
+			return nil, fmt.Errorf("unable to read service definition %v from the local database, error: %v", mi.MicroserviceDefId, err)
+		} else if msdef == nil || msdef.Deployment == "" {
+			continue
+		} else if dd, err := containermessage.GetNativeDeployment(msdef.Deployment); err == nil {
+			for _, svc := range dd.Services {
+				names = append(names, svc.Image)
+			}
+		}
+	}
+
+	// the images of the deployments may be tagged while the pulled images are pinned by digest, so the ids are compared too
+	for _, name := range names {
+		inUse[name] = true
+		if img, err := client.InspectImage(name); err == nil {
+			inUse[img.ID] = true
+		}
+	}
+	return inUse, nil
+}
+
+// Record the images of the deployment as pulled by the agent, so that the garbage collector can remove them later.
+func savePulledImages(db *bolt.DB, client containerruntime.ContainerRuntime, deploymentDesc *containermessage.DeploymentDescription) {
+	for _, service := range deploymentDesc.Services {
+		imageId := ""
+		if img, err := client.InspectImage(service.Image); err != nil {
+			glog.Warningf(gcLogString(fmt.Sprintf("unable to inspect pulled image %v, error: %v", service.Image, err)))
+		} else {
+			imageId = img.ID
+		}
+		if err := persistence.SavePulledImage(db, persistence.NewPulledImage(service.Image, imageId)); err != nil {
+			glog.Errorf(gcLogString(fmt.Sprintf("unable to save pulled image %v, error: %v", service.Image, err)))
+		}
+	}
+}
+
+var gcLogString = func(v interface{}) string {
+	return fmt.Sprintf("Image GC: %v", v)
+}
@@ -0,0 +1,66 @@
+// +build unit
+
+package imagefetch
+
+import (
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_selectUnusedImages(t *testing.T) {
+
+	pulled := []persistence.PulledImage{
+		persistence.PulledImage{Name: "a/running@sha256:1", ImageId: "sha256:aaa", LastUsedTime: 100},
+		persistence.PulledImage{Name: "a/pinned@sha256:2", ImageId: "sha256:bbb", LastUsedTime: 100},
+		persistence.PulledImage{Name: "a/old:1.0", ImageId: "sha256:ccc", LastUsedTime: 100},
+		persistence.PulledImage{Name: "a/recent:1.0", ImageId: "sha256:ddd", LastUsedTime: 950},
+	}
+	inUse := map[string]bool{
+		"a/running@sha256:1": true,
+		"sha256:bbb":         true,
+	}
+
+	used, unused := selectUnusedImages(pulled, inUse, 1000, 100)
+
+	// the images that are in use by name or by id get a new last used time
+	assert.Equal(t, 2, len(used))
+	for _, pi := range used {
+		assert.Equal(t, uint64(1000), pi.LastUsedTime)
+	}
+
+	// only the image that has not been used for the grace period is removed
+	assert.Equal(t, 1, len(unused))
+	assert.Equal(t, "a/old:1.0", unused[0].Name)
+}
+
+func Test_CheckDiskSpace(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "imggc-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	free, err := FreeDiskSpace(dir)
+	assert.Nil(t, err)
+	assert.True(t, free > 0)
+
+	cfg := &config.HorizonConfig{Edge: config.Config{ImageGC: config.ImageGCConfig{DiskPath: dir, MinFreeDiskMB: 1}}}
+	assert.Nil(t, CheckDiskSpace(cfg))
+
+	// more free disk space is required than any file system has
+	cfg.Edge.ImageGC.MinFreeDiskMB = 1 << 40
+	err = CheckDiskSpace(cfg)
+	assert.IsType(t, &DiskPressureError{}, err)
+
+	// the check is turned off
+	cfg.Edge.ImageGC.MinFreeDiskMB = -1
+	assert.Nil(t, CheckDiskSpace(cfg))
+
+	// the free disk space cannot be determined
+	cfg.Edge.ImageGC.MinFreeDiskMB = 1 << 40
+	cfg.Edge.ImageGC.DiskPath = dir + "/missing"
+	assert.Nil(t, CheckDiskSpace(cfg))
+}
@@ -0,0 +1,95 @@
+package imagefetch
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
+	"github.com/open-horizon/anax/events"
+	"time"
+)
+
+const (
+	IMAGE_PREFETCH      = "ImagePrefetch"
+	PREFETCH_INTERVAL_S = 15
+	PREFETCH_QUEUE_SIZE = 50
+)
+
+// The image prefetch subworker. It pulls the images of the queued service versions one at a time, so that the
+// prefetches do not compete with each other for the bandwidth of the node. The download rate of the prefetches is limited
+// by their own rate, and together with the other image pulls by the rate of all of the image pulls.
+func (w *ImageFetchWorker) prefetchImages() int {
+	for {
+		// the queued prefetches wait for the next pull window
+		if wait, _ := w.Config.Edge.ImagePull.PullWindow(time.Now()); wait > 0 {
+			return 0
+		}
+
+		select {
+		case msg := <-w.prefetches:
+			w.prefetch(msg)
+		default:
+			return 0
+		}
+	}
+}
+
+func (w *ImageFetchWorker) prefetch(msg *events.ImagePrefetchMessage) {
+	key := fmt.Sprintf("%v/%v_%v", msg.ServiceOrg, msg.ServiceURL, msg.ServiceVersion)
+	if w.prefetched[key] {
+		return
+	}
+
+	glog.V(3).Infof(pfLogString(fmt.Sprintf("prefetching images for service %v/%v version %v", msg.ServiceOrg, msg.ServiceURL, msg.ServiceVersion)))
+
+	// the deployment signature is checked before anything is pulled
+	if _, deploymentDesc, err := processDeployment(w.Config, msg.ContainerConfig); err != nil {
+		prefetches.WithLabelValues("failure").Inc()
+		glog.Errorf(pfLogString(fmt.Sprintf("unable to prefetch images for service %v/%v version %v, error: %v", msg.ServiceOrg, msg.ServiceURL, msg.ServiceVersion, err)))
+	} else if err := PrefetchImages(w.Config, w.client, w.db, deploymentDesc, msg.ContainerConfig.ImageDockerAuths); err != nil {
+		if _, ok := err.(*PullWindowError); ok {
+			// try again in the next pull window
+			select {
+			case w.prefetches <- msg:
+			default:
+			}
+			return
+		}
+		prefetches.WithLabelValues("failure").Inc()
+		glog.Warningf(pfLogString(fmt.Sprintf("unable to prefetch images for service %v/%v version %v, error: %v", msg.ServiceOrg, msg.ServiceURL, msg.ServiceVersion, err)))
+	} else {
+		prefetches.WithLabelValues("success").Inc()
+		w.prefetched[key] = true
+		glog.V(3).Infof(pfLogString(fmt.Sprintf("prefetched images for service %v/%v version %v", msg.ServiceOrg, msg.ServiceURL, msg.ServiceVersion)))
+	}
+}
+
+// The download rate limiter of the pulls ahead of an upgrade.
+var prefetchRate = &rateLimiter{}
+
+// Pull the images of a deployment ahead of the upgrade to it, at the download rate of the prefetches. The images are
+// recorded as pulled, so they are removed by the image garbage collector if the upgrade does not happen. Nothing is
+// pulled when the free disk space is low.
+func PrefetchImages(cfg *config.HorizonConfig, client containerruntime.ContainerRuntime, db *bolt.DB, deploymentDesc *containermessage.DeploymentDescription, imageDockerAuths []events.ImageDockerAuth) error {
+	if err := CheckDiskSpace(cfg); err != nil {
+		return err
+	}
+
+	sigVerifier, err := imageSignatureVerifier(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	prefetchRate.setRate(cfg.GetImagePrefetchRate())
+	if err := pullImageFromRepos(cfg.Edge, dockerAuths(cfg, db, imageDockerAuths), client, nil, deploymentDesc, sigVerifier, newPullLimits(cfg, prefetchRate), db); err != nil {
+		return err
+	}
+	savePulledImages(db, client, deploymentDesc)
+	return nil
+}
+
+var pfLogString = func(v interface{}) string {
+	return fmt.Sprintf("Image prefetch: %v", v)
+}
@@ -8,16 +8,35 @@ import (
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IMAGE_PULL_WINDOW            = "ImagePullWindow"
+	PULL_WINDOW_CHECK_INTERVAL_S = 30
 )
 
 type ImageFetchWorker struct {
 	worker.BaseWorker // embedded field
 	db                *bolt.DB
-	client            *docker.Client
+	client            containerruntime.ContainerRuntime
+	prefetches        chan *events.ImagePrefetchMessage // the prefetches waiting for the prefetch subworker
+	prefetched        map[string]bool                   // the service versions whose images have been prefetched
+	waitingLock       sync.Mutex
+	waiting           []waitingFetch // the fetches waiting for the next pull window
+}
+
+// A fetch command that waits for the next pull window.
+type waitingFetch struct {
+	cmd *FetchCommand
+	due time.Time
 }
 
 func NewImageFetchWorker(name string, config *config.HorizonConfig, db *bolt.DB) *ImageFetchWorker {
@@ -28,13 +47,13 @@ func NewImageFetchWorker(name string, config *config.HorizonConfig, db *bolt.DB)
 		return nil
 	}
 
-	var client *docker.Client
+	var client containerruntime.ContainerRuntime
 	var err error
 	if config.Edge.DockerEndpoint != "" {
-		client, err = docker.NewClient(config.Edge.DockerEndpoint)
+		client, err = containerruntime.NewAgentContainerRuntime(config)
 		if err != nil {
-			glog.Errorf("Failed to instantiate docker Client: %v", err)
-			panic("Unable to instantiate docker Client")
+			glog.Errorf("Failed to instantiate %v client: %v", config.GetContainerRuntime(), err)
+			panic("Unable to instantiate container runtime client")
 		}
 	}
 
@@ -42,12 +61,34 @@ func NewImageFetchWorker(name string, config *config.HorizonConfig, db *bolt.DB)
 		BaseWorker: worker.NewBaseWorker(name, config, nil),
 		db:         db,
 		client:     client,
+		prefetches: make(chan *events.ImagePrefetchMessage, PREFETCH_QUEUE_SIZE),
+		prefetched: make(map[string]bool),
+		waiting:    make([]waitingFetch, 0),
 	}
 
 	worker.Start(worker, 0)
 	return worker
 }
 
+func (w *ImageFetchWorker) Initialize() bool {
+
+	// remove the pulled images that are no longer used
+	if interval := w.Config.GetImageGCInterval(); interval > 0 && w.client != nil {
+		w.DispatchSubworker(IMAGE_GC, w.collectImages, interval, false)
+	}
+
+	// pull the images of newer service versions ahead of the upgrade, one service at a time
+	if w.Config.Edge.ImagePrefetch.Enabled && w.client != nil {
+		w.DispatchSubworker(IMAGE_PREFETCH, w.prefetchImages, PREFETCH_INTERVAL_S, false)
+	}
+
+	// fetch the images of the deployments that were waiting for a pull window once it opens
+	if len(w.Config.Edge.ImagePull.Windows) != 0 {
+		w.DispatchSubworker(IMAGE_PULL_WINDOW, w.requeueWaitingFetches, PULL_WINDOW_CHECK_INTERVAL_S, true)
+	}
+	return true
+}
+
 func (w *ImageFetchWorker) Messages() chan events.Message {
 	return w.BaseWorker.Manager.Messages
 }
@@ -60,6 +101,7 @@ func (w *ImageFetchWorker) NewEvent(incoming events.Message) {
 
 		// stop the container worker for the cluster device type
 		if msg.DeviceType() == persistence.DEVICE_TYPE_CLUSTER {
+			w.Commands <- worker.NewBeginShutdownCommand()
 			w.Commands <- worker.NewTerminateCommand("cluster node")
 		}
 	case *events.AgreementReachedMessage:
@@ -74,6 +116,22 @@ func (w *ImageFetchWorker) NewEvent(incoming events.Message) {
 		fCmd := w.NewFetchCommand(msg.LaunchContext())
 		w.Commands <- fCmd
 
+	case *events.ImagePrefetchMessage:
+		msg, _ := incoming.(*events.ImagePrefetchMessage)
+
+		select {
+		case w.prefetches <- msg:
+		default:
+			glog.Warningf(pfLogString(fmt.Sprintf("prefetch queue is full, dropping prefetch of %v/%v version %v", msg.ServiceOrg, msg.ServiceURL, msg.ServiceVersion)))
+		}
+
+	case *events.NodeShutdownMessage:
+		msg, _ := incoming.(*events.NodeShutdownMessage)
+		switch msg.Event().Id {
+		case events.START_UNCONFIGURE:
+			w.Commands <- worker.NewBeginShutdownCommand()
+		}
+
 	case *events.NodeShutdownCompleteMessage:
 		msg, _ := incoming.(*events.NodeShutdownCompleteMessage)
 		switch msg.Event().Id {
@@ -192,11 +250,17 @@ func processDeployment(cfg *config.HorizonConfig, containerConfig events.Contain
 	return pemFiles, &deploymentDesc, nil
 }
 
-func processFetch(cfg *config.HorizonConfig, client *docker.Client, db *bolt.DB, deploymentDesc *containermessage.DeploymentDescription, imageDockerAuths []events.ImageDockerAuth) error {
+func processFetch(cfg *config.HorizonConfig, client containerruntime.ContainerRuntime, db *bolt.DB, deploymentDesc *containermessage.DeploymentDescription, imageDockerAuths []events.ImageDockerAuth, limits pullLimits) error {
 	if client == nil {
 		return fmt.Errorf("Docker client is nil. Please make sure DockerEndpoint is set in the configuration file.")
 	}
 
+	return fetchImage(cfg, client, db, deploymentDesc, dockerAuths(cfg, db, imageDockerAuths), limits)
+}
+
+// Returns the docker auths from the exchange, if they are trusted, and from the attributes.
+func dockerAuths(cfg *config.HorizonConfig, db *bolt.DB, imageDockerAuths []events.ImageDockerAuth) map[string][]docker.AuthConfiguration {
+
 	dockerAuthConfigurations := make(map[string][]docker.AuthConfiguration, 0)
 
 	var err error
@@ -211,20 +275,65 @@ func processFetch(cfg *config.HorizonConfig, client *docker.Client, db *bolt.DB,
 		glog.Errorf("Failed to fetch authentication facts from the attributes before processing packages and / or Docker pulls: %v. Continuing anyway", err)
 	}
 
-	return fetchImage(cfg, client, db, deploymentDesc, dockerAuthConfigurations)
+	return dockerAuthConfigurations
 }
 
-func fetchImage(cfg *config.HorizonConfig, client *docker.Client, db *bolt.DB, deploymentDesc *containermessage.DeploymentDescription, dockerAuthConfigurations map[string][]docker.AuthConfiguration) error {
+func fetchImage(cfg *config.HorizonConfig, client containerruntime.ContainerRuntime, db *bolt.DB, deploymentDesc *containermessage.DeploymentDescription, dockerAuthConfigurations map[string][]docker.AuthConfiguration, limits pullLimits) error {
 
 	skipCheckFn := SkipCheckFn(client)
 	// using Docker pull (newer option, uses docker client to pull images from repos in image names in deployment description)
 	// Note: we don't want to make this a fallback option, it's a potential security vector
 	glog.V(3).Infof("Using Docker pull mechanism to retrieve and load Docker images into local registry")
 
-	fetchErr := pullImageFromRepos(cfg.Edge, dockerAuthConfigurations, client, &skipCheckFn, deploymentDesc)
+	sigVerifier, err := imageSignatureVerifier(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	// The agent does not pull images when the disk is almost full. Removing the unused images may free enough space.
+	if db != nil {
+		if err := CheckDiskSpace(cfg); err != nil {
+			glog.Warningf(gcLogString(fmt.Sprintf("%v, removing unused images", err)))
+			if err := CollectUnusedImages(cfg, db, client); err != nil {
+				glog.Errorf(gcLogString(err))
+			}
+			if err := CheckDiskSpace(cfg); err != nil {
+				return err
+			}
+		}
+	}
+
+	fetchErr := pullImageFromRepos(cfg.Edge, dockerAuthConfigurations, client, &skipCheckFn, deploymentDesc, sigVerifier, limits, db)
+	if fetchErr == nil && db != nil {
+		savePulledImages(db, client, deploymentDesc)
+	}
 	return fetchErr
 }
 
+// Returns the image signature verifier if the node policy requires signed images, nil otherwise. The public keys
+// in the trust store of the agent are used to verify the signatures.
+func imageSignatureVerifier(cfg *config.HorizonConfig, db *bolt.DB) (*ImageSignatureVerifier, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	if nodePol, err := persistence.FindNodePolicy(db); err != nil {
+		return nil, fmt.Errorf("Unable to read node policy from the local database. Error: %v", err)
+	} else if nodePol == nil {
+		return nil, nil
+	} else if required, err := policy.NodeRequiresSignedImages(nodePol.Properties); err != nil {
+		return nil, &ImageSignatureError{Msg: err.Error()}
+	} else if !required {
+		return nil, nil
+	}
+
+	keyFiles, err := cfg.Collaborators.KeyFileNamesFetcher.GetKeyFileNames(cfg.Edge.PublicKeyPath, cfg.Edge.UserPublicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the public keys in the trust store. Error: %v", err)
+	}
+	return NewImageSignatureVerifier(cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil), keyFiles), nil
+}
+
 // This function is used by external caller such as hzn command to load the container images.
 // containerConfig: it contains the deployment info and the docker auth from the exchange for the service image docker repository.
 // dockerAuthConfigurations: additional docker auths for fetching the container images from the docker repository.
@@ -234,7 +343,7 @@ func fetchImage(cfg *config.HorizonConfig, client *docker.Client, db *bolt.DB, d
 // 2) from the dockerAuthConfigurations
 // 3) from the config.DockerCredFilePath file.
 // 4) from /root/.docker/config.json if 3) is not set.
-func ProcessImageFetch(cfg *config.HorizonConfig, client *docker.Client, containerConfig *events.ContainerConfig, dockerAuthConfigurations map[string][]docker.AuthConfiguration) error {
+func ProcessImageFetch(cfg *config.HorizonConfig, client containerruntime.ContainerRuntime, containerConfig *events.ContainerConfig, dockerAuthConfigurations map[string][]docker.AuthConfiguration) error {
 
 	dockerAuthNew := make(map[string][]docker.AuthConfiguration, 0)
 
@@ -258,7 +367,7 @@ func ProcessImageFetch(cfg *config.HorizonConfig, client *docker.Client, contain
 		return fmt.Errorf("Error Unmarshalling deployment string %v, error: %v", containerConfig.Deployment, err)
 	}
 
-	return fetchImage(cfg, client, nil, &deploymentDesc, dockerAuthNew)
+	return fetchImage(cfg, client, nil, &deploymentDesc, dockerAuthNew, newPullLimits(cfg))
 }
 
 func (b *ImageFetchWorker) CommandHandler(command worker.Command) bool {
@@ -293,9 +402,26 @@ func (b *ImageFetchWorker) CommandHandler(command worker.Command) bool {
 				return true
 			}
 
-			if fetchErr := processFetch(b.Config, b.client, b.db, deploymentDesc, lc.ContainerConfig().ImageDockerAuths); fetchErr != nil {
+			// Images are only pulled in the pull windows, the fetch is done again when the next window opens.
+			wait, limits := b.pullWindowWait(lc)
+			if wait > 0 {
+				b.deferFetch(cmd, deploymentDesc, wait)
+				return true
+			}
+
+			if fetchErr := processFetch(b.Config, b.client, b.db, deploymentDesc, lc.ContainerConfig().ImageDockerAuths, limits); fetchErr != nil {
 				var id events.EventId
-				if strings.Contains(fetchErr.Error(), "Auth error") {
+				if _, ok := fetchErr.(*PullWindowError); ok {
+					// the next window might open too late for the agreements, then the fetch is done again right away
+					if wait, _ := b.pullWindowWait(lc); wait > 0 {
+						b.deferFetch(cmd, deploymentDesc, wait)
+					} else {
+						b.AddDeferredCommand(cmd)
+					}
+					return true
+				} else if _, ok := fetchErr.(*ImageSignatureError); ok {
+					id = events.IMAGE_SIG_VERIF_ERROR
+				} else if strings.Contains(fetchErr.Error(), "Auth error") {
 					id = events.IMAGE_FETCH_AUTH_ERROR
 				} else {
 					id = events.IMAGE_FETCH_ERROR
@@ -315,6 +441,101 @@ func (b *ImageFetchWorker) CommandHandler(command worker.Command) bool {
 
 }
 
+// Queue the fetch command again when the next pull window opens. The images of the deployment are shown as waiting in
+// the service status until then.
+func (b *ImageFetchWorker) deferFetch(cmd *FetchCommand, deploymentDesc *containermessage.DeploymentDescription, wait time.Duration) {
+	glog.V(3).Infof(ptLogString(fmt.Sprintf("outside of the pull windows, pulling the images of the deployment in %v", wait)))
+
+	if b.db != nil {
+		for _, service := range deploymentDesc.Services {
+			pull, err := persistence.FindImagePull(b.db, service.Image)
+			if err != nil {
+				glog.Warningf(ptLogString(err))
+				continue
+			} else if pull == nil {
+				pull = persistence.NewImagePull(service.Image)
+			}
+			pull.Status = persistence.IMAGE_PULL_STATUS_WAITING
+			if err := persistence.SaveImagePull(b.db, pull); err != nil {
+				glog.Warningf(ptLogString(err))
+			}
+		}
+	}
+
+	b.waitingLock.Lock()
+	b.waiting = append(b.waiting, waitingFetch{cmd: cmd, due: time.Now().Add(wait)})
+	b.waitingLock.Unlock()
+}
+
+// The pull window subworker. It queues the fetches that were waiting for a pull window again once the window opens. The
+// fetches are queued by the subworker, so none is queued after the worker has terminated.
+func (b *ImageFetchWorker) requeueWaitingFetches() int {
+	now := time.Now()
+	due := make([]*FetchCommand, 0)
+
+	b.waitingLock.Lock()
+	waiting := make([]waitingFetch, 0, len(b.waiting))
+	for _, wf := range b.waiting {
+		if now.Before(wf.due) {
+			waiting = append(waiting, wf)
+		} else {
+			due = append(due, wf.cmd)
+		}
+	}
+	b.waiting = waiting
+	b.waitingLock.Unlock()
+
+	for _, cmd := range due {
+		b.Commands <- cmd
+	}
+	return 0
+}
+
+// Returns how long to wait for the next pull window, and the limits of the pull when it is done now. The wait is limited
+// by the prelaunch timeout of the agreements of the launch context, they are cancelled if their services have not started
+// by then. When the next window opens too late, the images are pulled now, outside of the pull windows.
+func (b *ImageFetchWorker) pullWindowWait(lc events.LaunchContext) (time.Duration, pullLimits) {
+	now := time.Now()
+	wait, _ := b.Config.Edge.ImagePull.PullWindow(now)
+
+	if deadline := b.prelaunchDeadline(lc); wait > 0 && !deadline.IsZero() && !now.Add(wait).Before(deadline) {
+		glog.Warningf(ptLogString(fmt.Sprintf("the next pull window opens after the prelaunch timeout of the agreements at %v, pulling the images now", deadline)))
+		limits := newPullLimits(b.Config)
+		limits.deadline = time.Time{}
+		return 0, limits
+	}
+	return wait, newPullLimits(b.Config)
+}
+
+// Returns the time when the agreements of the launch context are cancelled if their services have not started, the zero
+// time when it is not known.
+func (b *ImageFetchWorker) prelaunchDeadline(lc events.LaunchContext) time.Time {
+	var deadline time.Time
+	if b.db == nil {
+		return deadline
+	}
+
+	var agreementIds []string
+	switch c := lc.(type) {
+	case *events.AgreementLaunchContext:
+		agreementIds = []string{c.AgreementId}
+	case *events.ContainerLaunchContext:
+		agreementIds = c.AgreementIds
+	}
+
+	for _, id := range agreementIds {
+		if ags, err := persistence.FindEstablishedAgreementsAllProtocols(b.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter(), persistence.IdEAFilter(id)}); err != nil {
+			glog.Warningf(ptLogString(fmt.Sprintf("unable to read agreement %v, error: %v", id, err)))
+		} else if len(ags) != 0 && ags[0].AgreementAcceptedTime != 0 {
+			d := time.Unix(int64(ags[0].AgreementAcceptedTime)+b.Config.Edge.MaxAgreementPrelaunchTimeM*60, 0)
+			if deadline.IsZero() || d.Before(deadline) {
+				deadline = d
+			}
+		}
+	}
+	return deadline
+}
+
 type FetchCommand struct {
 	LaunchContext interface{}
 }
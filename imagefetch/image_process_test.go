@@ -4,11 +4,14 @@ package imagefetch
 
 import (
 	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/worker"
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_AppendDockerAuth(t *testing.T) {
@@ -198,3 +201,22 @@ func Test_authExchange(t *testing.T) {
 	assert.Equal(t, 4, len(dockerAuthConfigurations["myrepo2.com"]), "The docker auth array should have 4 items.")
 
 }
+
+func Test_requeueWaitingFetches(t *testing.T) {
+	w := &ImageFetchWorker{
+		BaseWorker: worker.NewBaseWorker("test", &config.HorizonConfig{}, nil),
+		waiting:    make([]waitingFetch, 0),
+	}
+
+	dueCmd := w.NewFetchCommand(&events.AgreementLaunchContext{AgreementId: "ag1"})
+	laterCmd := w.NewFetchCommand(&events.AgreementLaunchContext{AgreementId: "ag2"})
+	w.waiting = append(w.waiting, waitingFetch{cmd: dueCmd, due: time.Now().Add(-time.Second)})
+	w.waiting = append(w.waiting, waitingFetch{cmd: laterCmd, due: time.Now().Add(time.Hour)})
+
+	w.requeueWaitingFetches()
+
+	assert.Equal(t, 1, len(w.Commands), "only the fetch whose pull window opened should be queued")
+	assert.Equal(t, dueCmd, <-w.Commands)
+	assert.Equal(t, 1, len(w.waiting))
+	assert.Equal(t, laterCmd, w.waiting[0].cmd)
+}
@@ -0,0 +1,196 @@
+package imagefetch
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/imageregistry"
+	"github.com/open-horizon/rsapss-tool/verify"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Image signatures use the format of cosign. The signatures of an image are stored in the same repository as the image,
+// in an OCI manifest tagged with the digest of the image. Each layer of the manifest is a simple signing payload naming
+// the image digest, and the signature of the payload is in an annotation of the layer.
+const (
+	COSIGN_SIGNATURE_ANNOTATION = "dev.cosignproject.cosign/signature"
+	COSIGN_PAYLOAD_MEDIA_TYPE   = "application/vnd.dev.cosign.simplesigning.v1+json"
+	COSIGN_SIGNATURE_TYPE       = "cosign container image signature"
+)
+
+// The error returned when an image signature cannot be verified, so that it can be reported as IMAGE_SIG_VERIF_ERROR.
+type ImageSignatureError struct {
+	Image string
+	Msg   string
+}
+
+func (e *ImageSignatureError) Error() string {
+	return fmt.Sprintf("Signature verification failed for image %v: %v", e.Image, e.Msg)
+}
+
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// Returns the tag of the manifest holding the signatures of the image with the input digest.
+func CosignSignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// The signature verifier checks the image signatures stored in the registry against the public keys in the trust store
+// of the agent.
+type ImageSignatureVerifier struct {
+	registry *imageregistry.RegistryClient
+	keyFiles []string
+}
+
+func NewImageSignatureVerifier(httpClient *http.Client, keyFiles []string) *ImageSignatureVerifier {
+	return &ImageSignatureVerifier{
+		registry: imageregistry.NewRegistryClient(httpClient),
+		keyFiles: keyFiles,
+	}
+}
+
+// Verify that the image with the input digest has a signature made by one of the trusted keys. The domain and path are
+// the parts of the image name returned by cutil.ParseDockerImagePath.
+func (v *ImageSignatureVerifier) Verify(image string, domain string, path string, digest string, auth docker.AuthConfiguration) error {
+
+	if len(v.keyFiles) == 0 {
+		return &ImageSignatureError{Image: image, Msg: "there are no public keys in the agent trust store"}
+	}
+
+	registry, repo := imageregistry.RegistryRepository(domain, path)
+	manifestBytes, _, err := v.registry.Get(registry, repo, "manifests/"+CosignSignatureTag(digest), []string{imageregistry.OCI_MANIFEST_MEDIA_TYPE, imageregistry.DOCKER_MANIFEST_MEDIA_TYPE}, auth)
+	if err != nil {
+		return &ImageSignatureError{Image: image, Msg: fmt.Sprintf("unable to get signatures for digest %v, error: %v", digest, err)}
+	}
+
+	var manifest imageregistry.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return &ImageSignatureError{Image: image, Msg: fmt.Sprintf("unable to demarshal signature manifest, error: %v", err)}
+	}
+
+	for _, layer := range manifest.Layers {
+		sig, ok := layer.Annotations[COSIGN_SIGNATURE_ANNOTATION]
+		if layer.MediaType != COSIGN_PAYLOAD_MEDIA_TYPE || !ok {
+			continue
+		}
+
+		payload, _, err := v.registry.Get(registry, repo, "blobs/"+layer.Digest, nil, auth)
+		if err != nil {
+			glog.Warningf(imLogString(fmt.Sprintf("unable to get signature payload %v for image %v, error: %v", layer.Digest, image, err)))
+			continue
+		} else if err := imageregistry.CheckBlobDigest(payload, layer.Digest); err != nil {
+			glog.Warningf(imLogString(fmt.Sprintf("signature payload for image %v is not valid, error: %v", image, err)))
+			continue
+		}
+
+		if keyFile, err := VerifySignedPayload(payload, sig, digest, v.keyFiles); err != nil {
+			glog.V(3).Infof(imLogString(fmt.Sprintf("signature in layer %v of image %v not verified: %v", layer.Digest, image, err)))
+		} else {
+			glog.V(3).Infof(imLogString(fmt.Sprintf("signature of image %v digest %v verified with key %v", image, digest, keyFile)))
+			return nil
+		}
+	}
+
+	return &ImageSignatureError{Image: image, Msg: fmt.Sprintf("no signature of digest %v was made by a trusted key", digest)}
+}
+
+// Verify that the payload names the image digest and that the signature of the payload was made by one of the keys.
+// ECDSA keys are supported, as created by cosign generate-key-pair, and so are RSA keys, with PKCS #1 v1.5 signatures
+// as created by cosign, or with PSS signatures as created by hzn. Returns the name of the key file that verified the
+// signature.
+func VerifySignedPayload(payload []byte, signature string, digest string, keyFiles []string) (string, error) {
+
+	var ssp simpleSigningPayload
+	if err := json.Unmarshal(payload, &ssp); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to demarshal signature payload, error: %v", err))
+	} else if ssp.Critical.Type != COSIGN_SIGNATURE_TYPE {
+		return "", errors.New(fmt.Sprintf("signature payload has type %v", ssp.Critical.Type))
+	} else if ssp.Critical.Image.DockerManifestDigest != digest {
+		return "", errors.New(fmt.Sprintf("signature payload is for digest %v", ssp.Critical.Image.DockerManifestDigest))
+	}
+
+	sigBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to decode signature, error: %v", err))
+	}
+
+	hash := sha256.Sum256(payload)
+	for _, keyFile := range keyFiles {
+		if keyBytes, err := ioutil.ReadFile(keyFile); err != nil {
+			glog.Warningf(imLogString(fmt.Sprintf("unable to read trusted key %v, error: %v", keyFile, err)))
+		} else if key, err := ValidPublicKey(keyBytes); err != nil {
+			glog.Warningf(imLogString(fmt.Sprintf("trusted key %v is not valid, error: %v", keyFile, err)))
+		} else if verifyHash(key, hash[:], sigBytes) {
+			return keyFile, nil
+		}
+	}
+	return "", errors.New("signature not made by a trusted key")
+}
+
+// Returns the public key in the PEM encoded key or x509 certificate. PKIX public keys can be RSA or ECDSA keys, the
+// keys in certificates must be RSA keys. RSA keys and certificates are checked the same way as the keys that verify
+// deployment signatures.
+func ValidPublicKey(keyOrCert []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(keyOrCert)
+	if block == nil {
+		return nil, errors.New("unable to find PEM block in the provided public key or cert")
+	}
+
+	var key interface{}
+	cert := false
+	if certs, err := x509.ParseCertificates(block.Bytes); err == nil && len(certs) == 1 {
+		key = certs[0].PublicKey
+		cert = true
+	} else if pkixKey, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		key = pkixKey
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		if cert {
+			return nil, errors.New("ECDSA keys are only supported as PKIX public keys, not in certificates")
+		}
+		return key, nil
+	case *rsa.PublicKey, nil:
+		return verify.ValidKeyOrCert(keyOrCert)
+	default:
+		return nil, errors.New(fmt.Sprintf("public key type %T is not supported", key))
+	}
+}
+
+// Returns true if the signature of the SHA-256 hash was made by the key.
+func verifyHash(key crypto.PublicKey, hash []byte, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, sig) == nil || rsa.VerifyPSS(k, crypto.SHA256, hash, sig, nil) == nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, hash, sig)
+	}
+	return false
+}
+
+var imLogString = func(v interface{}) string {
+	return fmt.Sprintf("Image signature: %v", v)
+}
@@ -0,0 +1,237 @@
+// +build unit
+
+package imagefetch
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/imageregistry"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// Write the public key into a PEM file in the directory and return the file name.
+func writePublicKey(t *testing.T, dir string, name string, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.Nil(t, err)
+	fileName := path.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644))
+	return fileName
+}
+
+func signPayload(t *testing.T, key *rsa.PrivateKey, payload []byte) string {
+	hash := sha256.Sum256(payload)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	assert.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func testPayload(digest string) []byte {
+	var ssp simpleSigningPayload
+	ssp.Critical.Identity.DockerReference = "myrepo/myimage"
+	ssp.Critical.Image.DockerManifestDigest = digest
+	ssp.Critical.Type = COSIGN_SIGNATURE_TYPE
+	payload, _ := json.Marshal(ssp)
+	return payload
+}
+
+// A registry holding a signature manifest for testImageDigest. It requires a bearer token, as docker hub does.
+func newTestRegistry(t *testing.T, payload []byte, sig string) *httptest.Server {
+	hash := sha256.Sum256(payload)
+	payloadDigest := "sha256:" + hex.EncodeToString(hash[:])
+	manifest, _ := json.Marshal(imageregistry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     imageregistry.OCI_MANIFEST_MEDIA_TYPE,
+		Layers: []imageregistry.Descriptor{
+			imageregistry.Descriptor{
+				MediaType:   COSIGN_PAYLOAD_MEDIA_TYPE,
+				Digest:      payloadDigest,
+				Size:        int64(len(payload)),
+				Annotations: map[string]string{COSIGN_SIGNATURE_ANNOTATION: sig},
+			},
+		},
+	})
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pw, ok := r.BasicAuth(); !ok || user != "user" || pw != "pw" || r.URL.Query().Get("scope") != "repository:myrepo/myimage:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token":"abc"}`))
+			return
+		} else if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("Www-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/myrepo/myimage/manifests/" + CosignSignatureTag(testImageDigest):
+			w.Header().Set("Content-Type", imageregistry.OCI_MANIFEST_MEDIA_TYPE)
+			w.Write(manifest)
+		case "/v2/myrepo/myimage/blobs/" + payloadDigest:
+			w.Write(payload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func Test_ImageSignatureVerifier(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "imgsig-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	trusted := writePublicKey(t, dir, "trusted.pem", &signingKey.PublicKey)
+	untrusted := writePublicKey(t, dir, "untrusted.pem", &otherKey.PublicKey)
+
+	payload := testPayload(testImageDigest)
+	server := newTestRegistry(t, payload, signPayload(t, signingKey, payload))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	domain := u.Host
+	image := domain + "/myrepo/myimage:1.0"
+	auth := docker.AuthConfiguration{Username: "user", Password: "pw"}
+
+	// the signature is made by a trusted key
+	v := NewImageSignatureVerifier(server.Client(), []string{untrusted, trusted})
+	assert.Nil(t, v.Verify(image, domain, "myrepo/myimage", testImageDigest, auth))
+
+	// the signature is not made by a trusted key
+	v = NewImageSignatureVerifier(server.Client(), []string{untrusted})
+	err = v.Verify(image, domain, "myrepo/myimage", testImageDigest, auth)
+	assert.NotNil(t, err)
+	assert.IsType(t, &ImageSignatureError{}, err)
+
+	// the image has no signature
+	v = NewImageSignatureVerifier(server.Client(), []string{trusted})
+	err = v.Verify(image, domain, "myrepo/myimage", "sha256:ffff", auth)
+	assert.IsType(t, &ImageSignatureError{}, err)
+
+	// the registry credentials are wrong
+	err = v.Verify(image, domain, "myrepo/myimage", testImageDigest, docker.AuthConfiguration{Username: "user", Password: "bad"})
+	assert.IsType(t, &ImageSignatureError{}, err)
+
+	// there are no trusted keys
+	v = NewImageSignatureVerifier(server.Client(), []string{})
+	err = v.Verify(image, domain, "myrepo/myimage", testImageDigest, auth)
+	assert.IsType(t, &ImageSignatureError{}, err)
+}
+
+func Test_VerifySignedPayload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "imgsig-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keyFile := writePublicKey(t, dir, "key.pem", &key.PublicKey)
+
+	payload := testPayload(testImageDigest)
+	sig := signPayload(t, key, payload)
+
+	kf, err := VerifySignedPayload(payload, sig, testImageDigest, []string{keyFile})
+	assert.Nil(t, err)
+	assert.Equal(t, keyFile, kf)
+
+	// PSS signatures made with hzn keys are accepted too
+	hash := sha256.Sum256(payload)
+	pssSig, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, hash[:], nil)
+	assert.Nil(t, err)
+	_, err = VerifySignedPayload(payload, base64.StdEncoding.EncodeToString(pssSig), testImageDigest, []string{keyFile})
+	assert.Nil(t, err)
+
+	// a valid signature for another image digest
+	_, err = VerifySignedPayload(payload, sig, "sha256:ffff", []string{keyFile})
+	assert.NotNil(t, err)
+
+	// a payload that was changed after signing
+	other := testPayload("sha256:ffff")
+	_, err = VerifySignedPayload(other, sig, "sha256:ffff", []string{keyFile})
+	assert.NotNil(t, err)
+
+	// ECDSA P-256 signatures made with the keys of cosign generate-key-pair
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	ecKeyFile := writePublicKey(t, dir, "cosign.pub", &ecKey.PublicKey)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, hash[:])
+	assert.Nil(t, err)
+
+	kf, err = VerifySignedPayload(payload, base64.StdEncoding.EncodeToString(ecSig), testImageDigest, []string{keyFile, ecKeyFile})
+	assert.Nil(t, err)
+	assert.Equal(t, ecKeyFile, kf)
+
+	// the RSA signature is not made by the ECDSA key, and the ECDSA signature is not made by the RSA key
+	_, err = VerifySignedPayload(payload, sig, testImageDigest, []string{ecKeyFile})
+	assert.NotNil(t, err)
+	_, err = VerifySignedPayload(payload, base64.StdEncoding.EncodeToString(ecSig), testImageDigest, []string{keyFile})
+	assert.NotNil(t, err)
+
+	// an ECDSA signature of a changed payload
+	_, err = VerifySignedPayload(other, base64.StdEncoding.EncodeToString(ecSig), "sha256:ffff", []string{ecKeyFile})
+	assert.NotNil(t, err)
+}
+
+func Test_ValidPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	for _, pub := range []crypto.PublicKey{&rsaKey.PublicKey, &ecKey.PublicKey} {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		assert.Nil(t, err)
+		key, err := ValidPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		assert.Nil(t, err)
+		assert.Equal(t, pub, key)
+	}
+
+	// the validity of ECDSA keys in certificates is not checked, so they are not accepted
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &ecKey.PublicKey, ecKey)
+	assert.Nil(t, err)
+	_, err = ValidPublicKey(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	assert.NotNil(t, err)
+
+	_, err = ValidPublicKey([]byte("not a key"))
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,8 @@
 package imagefetch
 
 import (
+	"context"
+	"github.com/boltdb/bolt"
 	docker "github.com/fsouza/go-dockerclient"
 	"strings"
 
@@ -8,6 +10,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/containerruntime"
 	"github.com/open-horizon/anax/cutil"
 	"os"
 	"time"
@@ -65,7 +68,35 @@ func authDockerFile(config config.Config, authConfigs map[string][]docker.AuthCo
 	return nil
 }
 
-func pullImageFromRepos(config config.Config, authConfigs map[string][]docker.AuthConfiguration, client *docker.Client, skipPartFetchFn *func(repotag string) (bool, error), deploymentDesc *containermessage.DeploymentDescription) error {
+// The limits on the image pulls. The zero value does not limit the pulls.
+type pullLimits struct {
+	deadline   time.Time        // the time the pull window closes, the zero time means that there is no pull window
+	downloader *imageDownloader // downloads the images at a limited rate, nil when the download rate is not limited
+}
+
+// The download rate limiter of all of the image pulls together.
+var pullRate = &rateLimiter{}
+
+// Returns the limits on the image pulls from the configuration, starting now. The downloads of the pulls go through the
+// given rate limiters, and through the rate limiter of all of the image pulls.
+func newPullLimits(cfg *config.HorizonConfig, limiters ...*rateLimiter) pullLimits {
+	_, deadline := cfg.Edge.ImagePull.PullWindow(time.Now())
+	pullRate.setRate(cfg.GetImagePullRate())
+	return pullLimits{deadline: deadline, downloader: newImageDownloader(cfg, append(limiters, pullRate))}
+}
+
+// The error returned when an image pull is stopped because the pull window closed. The pull resumes in the next window.
+type PullWindowError struct {
+	Image string
+}
+
+func (e *PullWindowError) Error() string {
+	return fmt.Sprintf("the pull window closed before image %v was pulled", e.Image)
+}
+
+// When sigVerifier is not nil, the signature of each image is verified after the image is pulled. When db is not nil, the
+// progress of each pull is saved in it.
+func pullImageFromRepos(config config.Config, authConfigs map[string][]docker.AuthConfiguration, client containerruntime.ContainerRuntime, skipPartFetchFn *func(repotag string) (bool, error), deploymentDesc *containermessage.DeploymentDescription, sigVerifier *ImageSignatureVerifier, limits pullLimits, db *bolt.DB) error {
 
 	// append docker auth from docker file
 	authDockerFile(config, authConfigs)
@@ -116,15 +147,22 @@ func pullImageFromRepos(config config.Config, authConfigs map[string][]docker.Au
 			}
 		}
 
+		pullStart := time.Now()
+		tracker := newPullTracker(db, service.Image)
 		var err error
+		var pullAuth docker.AuthConfiguration
 		if domain == "" {
-			err = pullSingleImageFromRepo(client, opts, docker.AuthConfiguration{})
+			err = pullSingleImageFromRepo(client, opts, docker.AuthConfiguration{}, limits, tracker)
 		} else if auth_array, ok := authConfigs[domain]; !ok {
-			err = pullSingleImageFromRepo(client, opts, docker.AuthConfiguration{})
+			err = pullSingleImageFromRepo(client, opts, docker.AuthConfiguration{}, limits, tracker)
 		} else {
 			for i, auth := range auth_array {
-				err = pullSingleImageFromRepo(client, opts, auth)
+				err = pullSingleImageFromRepo(client, opts, auth, limits, tracker)
+				if _, ok := err.(*PullWindowError); ok {
+					break
+				}
 				if err == nil {
+					pullAuth = auth
 					break
 				} else if i < len(auth_array)-1 {
 					glog.V(5).Infof("Docker image pull(s) failed for service %v docker image %v with auth name %v. Error: %v. Try next auth.", name, service.Image, auth.Username, err)
@@ -132,27 +170,83 @@ func pullImageFromRepos(config config.Config, authConfigs map[string][]docker.Au
 			}
 		}
 		if err != nil {
+			tracker.stopped(err)
+			pullDuration.WithLabelValues("failure").Observe(time.Since(pullStart).Seconds())
 			glog.Errorf("Docker image pull(s) failed for docker image %v. Error: %v.", service.Image, err)
 			return err
 		} else {
+			tracker.done()
+			pullDuration.WithLabelValues("success").Observe(time.Since(pullStart).Seconds())
 			glog.V(3).Infof("Succeeded fetching image %v for service %v", service.Image, name)
 		}
+
+		// Pin the service to the digest that was pulled, so that its containers run the image that was pulled (and verified)
+		// even if the tag is moved to another image in the meantime.
+		if digest == "" {
+			if digest, err = pulledImageDigest(client, service.Image, domain, path); err != nil {
+				glog.Warningf("Unable to pin docker image %v for service %v to a digest, the image tag will be used. Error: %v", service.Image, name, err)
+			} else {
+				pinned := PinnedImageName(domain, path, digest)
+				glog.V(3).Infof("Pinned docker image %v for service %v to %v", service.Image, name, pinned)
+				service.Image = pinned
+			}
+		}
+
+		if sigVerifier == nil {
+			continue
+		} else if digest == "" {
+			return &ImageSignatureError{Image: service.Image, Msg: "the registry digest of the image is not known"}
+		} else if err := sigVerifier.Verify(service.Image, domain, path, digest, pullAuth); err != nil {
+			glog.Errorf("Docker image %v for service %v is not trusted. Error: %v", service.Image, name, err)
+			return err
+		}
 	}
 
 	return nil
 }
 
 //  This function try maxPullAttempts times to pull the image from the repo. It exits out imediately if there is auth error.
-func pullSingleImageFromRepo(client *docker.Client, opts docker.PullImageOptions, auth docker.AuthConfiguration) error {
+//  Docker keeps the layers that a failed attempt downloaded completely, so the next attempt does not download them again.
+//  When the download rate is limited, the agent downloads the image itself before the pull, keeping the partly downloaded
+//  layers as well. An attempt that downloaded a layer does not count against the maximum attempts. The pull stops when the
+//  pull window closes.
+func pullSingleImageFromRepo(client containerruntime.ContainerRuntime, opts docker.PullImageOptions, auth docker.AuthConfiguration, limits pullLimits, tracker *pullTracker) error {
 	glog.V(5).Infof("Pulling image %v with auth name %v.", opts, auth.Username)
 
 	var pullAttempts int
 
 	for pullAttempts <= maxPullAttempts {
-		if err := client.PullImage(opts, auth); err == nil {
+		// Count the bytes downloaded by this attempt from the docker progress stream.
+		progress := newPullProgress()
+		opts.OutputStream = progress
+		opts.RawJSONStream = true
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if !limits.deadline.IsZero() {
+			ctx, cancel = context.WithDeadline(context.Background(), limits.deadline)
+		}
+		opts.Context = ctx
+
+		attemptDone := tracker.track(progress)
+		err := limits.downloader.download(ctx, client, opts, auth, progress)
+		if err == nil {
+			err = client.PullImage(opts, auth)
+		}
+		cancel()
+		attemptDone(err)
+		pullBytes.Add(float64(progress.Bytes()))
+
+		if err == nil {
 			return nil
+		} else if !limits.deadline.IsZero() && !time.Now().Before(limits.deadline) {
+			glog.V(3).Infof("Stopped pulling image %v at the end of the pull window. Error: %v", opts.Repository, err)
+			return &PullWindowError{Image: opts.Repository}
 		} else {
 			pullAttempts++
+			if n := progress.FetchedLayers(); n > 0 {
+				glog.V(5).Infof("Pull attempt of image %v downloaded %v layers, docker keeps them for the next attempt.", opts.Repository, n)
+				pullAttempts = 1
+			}
 
 			// no need to try more times if it is auth error
 			switch err.(type) {
@@ -186,7 +280,37 @@ func pullSingleImageFromRepo(client *docker.Client, opts docker.PullImageOptions
 	return nil
 }
 
-func listImages(client *docker.Client) ([]docker.APIImages, error) {
+// Returns the name of an image that refers to it by digest.
+func PinnedImageName(domain string, path string, digest string) string {
+	if domain == "" {
+		return path + "@" + digest
+	}
+	return domain + "/" + path + "@" + digest
+}
+
+// Returns the registry digest of a pulled image.
+func pulledImageDigest(client containerruntime.ContainerRuntime, image string, domain string, path string) (string, error) {
+	name := path
+	if domain != "" {
+		name = domain + "/" + path
+	}
+
+	if img, err := client.InspectImage(image); err != nil {
+		return "", fmt.Errorf("unable to inspect image, error: %v", err)
+	} else {
+		// podman names the images of docker hub with the registry
+		for _, n := range []string{name, containerruntime.QualifiedImageName(name)} {
+			for _, repoDigest := range img.RepoDigests {
+				if strings.HasPrefix(repoDigest, n+"@") {
+					return strings.TrimPrefix(repoDigest, n+"@"), nil
+				}
+			}
+		}
+		return "", fmt.Errorf("no registry digest found for image in %v", img.RepoDigests)
+	}
+}
+
+func listImages(client containerruntime.ContainerRuntime) ([]docker.APIImages, error) {
 
 	if images, err := client.ListImages(docker.ListImagesOptions{
 		All: true,
@@ -198,7 +322,7 @@ func listImages(client *docker.Client) ([]docker.APIImages, error) {
 }
 
 // TODO: user needs to use image IDs instead of repotags to avoid overwriting or otherwise mistaken handling because of name collisions
-func SkipCheckFn(client *docker.Client) func(repotag string) (bool, error) {
+func SkipCheckFn(client containerruntime.ContainerRuntime) func(repotag string) (bool, error) {
 
 	return func(repotag string) (bool, error) {
 		repotagParts := strings.Split(repotag, ":")
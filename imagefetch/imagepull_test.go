@@ -61,3 +61,44 @@ func Test_authDockerFile(t *testing.T) {
 	assert.Equal(t, 1, len(dockerAuthConfigurations["myrepo3.com"]), "The docker auth array should have 1 items.")
 
 }
+
+func Test_pullProgress(t *testing.T) {
+	p := newPullProgress()
+
+	// Messages can be split across writes.
+	stream := `{"status":"Pulling fs layer","id":"a1"}
+{"status":"Downloading","progressDetail":{"current":100,"total":300},"id":"a1"}
+{"status":"Downloading","progressDetail":{"current":50,"total":50},"id":"b2"}
+{"status":"Download complete","id":"a1"}
+{"status":"Downloading","progressDetail":{"current":10,"total":20},"id":"c3"}
+{"status":"Pull complete","id":"a1"}
+`
+	p.Write([]byte(stream[:70]))
+	p.Write([]byte(stream[70:]))
+
+	assert.Equal(t, int64(360), p.Bytes(), "should count the completed layers at their full size")
+}
+
+func Test_pullProgress_Layers(t *testing.T) {
+	p := newPullProgress()
+
+	p.Write([]byte(`{"status":"Already exists","id":"a1"}
+{"status":"Downloading","progressDetail":{"current":100,"total":300},"id":"b2"}
+{"status":"Downloading","progressDetail":{"current":50,"total":50},"id":"c3"}
+{"status":"Download complete","id":"c3"}
+`))
+
+	layers := p.Layers()
+	assert.Equal(t, 3, len(layers))
+	assert.True(t, layers["a1"].Complete, "a layer docker already has should be complete")
+	assert.False(t, layers["b2"].Complete)
+	assert.Equal(t, int64(100), layers["b2"].Downloaded)
+	assert.True(t, layers["c3"].Complete)
+	assert.Equal(t, int64(50), layers["c3"].Total)
+	assert.Equal(t, 1, p.FetchedLayers(), "only the layer downloaded by this pull should be counted")
+}
+
+func Test_PinnedImageName(t *testing.T) {
+	assert.Equal(t, "myrepo/myimage@"+testImageDigest, PinnedImageName("", "myrepo/myimage", testImageDigest))
+	assert.Equal(t, "myregistry.com:5000/a/b@"+testImageDigest, PinnedImageName("myregistry.com:5000", "a/b", testImageDigest))
+}
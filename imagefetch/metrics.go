@@ -0,0 +1,161 @@
+package imagefetch
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+var (
+	pullDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "anax_image_pull_duration_seconds",
+		Help:    "Time taken to pull a container image, including retries.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"result"})
+
+	pullBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anax_image_pull_bytes_total",
+		Help: "Number of image layer bytes downloaded from container registries.",
+	})
+
+	imagesRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anax_image_gc_removed_total",
+		Help: "Number of unused images removed by the image garbage collector.",
+	})
+
+	prefetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "anax_image_prefetch_total",
+		Help: "Number of service versions whose images were pulled ahead of an upgrade.",
+	}, []string{"result"})
+
+	freeDisk = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "anax_image_disk_free_bytes",
+		Help: "Free disk space on the file system where the images are stored, as of the last check.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pullDuration, pullBytes, imagesRemoved, prefetches, freeDisk)
+}
+
+// A progress message from the docker image pull JSON stream.
+type pullProgressMessage struct {
+	Id             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+// An io.Writer for the raw docker pull JSON stream that keeps track of the number of bytes downloaded for each layer.
+type pullProgress struct {
+	lock       sync.Mutex
+	partial    []byte
+	downloaded map[string]int64 // the bytes downloaded so far for each layer
+	totals     map[string]int64 // the size of each layer, when docker reports it
+	complete   map[string]bool  // the layers that are downloaded, or that docker already has
+	resumed    map[string]int64 // the bytes of each layer that an earlier pull downloaded, for the layers the agent downloads
+	fetched    int              // the number of layers downloaded completely by this pull
+}
+
+func newPullProgress() *pullProgress {
+	return &pullProgress{
+		downloaded: make(map[string]int64),
+		totals:     make(map[string]int64),
+		complete:   make(map[string]bool),
+		resumed:    make(map[string]int64),
+	}
+}
+
+func (p *pullProgress) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// The stream is a sequence of newline separated JSON messages, which might be split across writes.
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		var msg pullProgressMessage
+		if err := json.Unmarshal(bytes.TrimSpace(p.partial[:i]), &msg); err == nil && msg.Id != "" {
+			switch msg.Status {
+			case "Downloading":
+				p.downloaded[msg.Id] = msg.ProgressDetail.Current
+				if msg.ProgressDetail.Total > 0 {
+					p.totals[msg.Id] = msg.ProgressDetail.Total
+				}
+			case "Download complete":
+				if total, ok := p.totals[msg.Id]; ok {
+					p.downloaded[msg.Id] = total
+				}
+				if !p.complete[msg.Id] {
+					p.fetched++
+				}
+				p.complete[msg.Id] = true
+			case "Pull complete", "Already exists":
+				p.complete[msg.Id] = true
+			}
+		}
+		p.partial = p.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+// Record the progress of a layer that the agent downloads itself, rather than docker. The download of the layer resumed
+// from the bytes that an earlier pull downloaded.
+func (p *pullProgress) layerProgress(id string, resumed int64, downloaded int64, total int64, complete bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.resumed[id] = resumed
+	p.downloaded[id] = downloaded
+	p.totals[id] = total
+	if complete && !p.complete[id] {
+		if downloaded > resumed {
+			p.fetched++
+		}
+		p.complete[id] = true
+	}
+}
+
+// The total number of bytes downloaded by this pull across all layers.
+func (p *pullProgress) Bytes() int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	total := int64(0)
+	for id, d := range p.downloaded {
+		total += d - p.resumed[id]
+	}
+	return total
+}
+
+// The number of layers that this pull downloaded completely. Docker keeps these layers when the pull fails, a layer that
+// was only partly downloaded is downloaded again from the start by the next pull.
+func (p *pullProgress) FetchedLayers() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.fetched
+}
+
+// The progress of each layer seen so far.
+func (p *pullProgress) Layers() map[string]persistence.LayerProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	layers := make(map[string]persistence.LayerProgress)
+	for id := range p.complete {
+		layers[id] = persistence.LayerProgress{Downloaded: p.downloaded[id], Total: p.totals[id], Complete: true}
+	}
+	for id, d := range p.downloaded {
+		if !p.complete[id] {
+			layers[id] = persistence.LayerProgress{Downloaded: d, Total: p.totals[id]}
+		}
+	}
+	return layers
+}
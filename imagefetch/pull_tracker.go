@@ -0,0 +1,127 @@
+package imagefetch
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/persistence"
+	"sync"
+	"time"
+)
+
+// How often the progress of a running pull is saved.
+const pullProgressSaveIntervalS = 5
+
+// Keeps the progress of the pull of an image in the local database, so that it can be shown in the service status. The
+// progress is only for display, the layers that were downloaded are kept by docker, or in the blob directory when the
+// agent downloads them itself. A nil tracker, used when there is no database, does nothing.
+type pullTracker struct {
+	lock sync.Mutex
+	db   *bolt.DB
+	pull *persistence.ImagePull
+}
+
+// Returns the tracker of the pull of the image. The progress of an earlier pull that did not complete is kept, so that
+// the status shows the layers that docker already has.
+func newPullTracker(db *bolt.DB, image string) *pullTracker {
+	if db == nil {
+		return nil
+	}
+
+	pull, err := persistence.FindImagePull(db, image)
+	if err != nil {
+		glog.Warningf(ptLogString(fmt.Sprintf("unable to read the progress of the pull of image %v, error: %v", image, err)))
+	}
+	if pull == nil {
+		pull = persistence.NewImagePull(image)
+	}
+	pull.Status = persistence.IMAGE_PULL_STATUS_PULLING
+	pull.LastError = ""
+
+	t := &pullTracker{db: db, pull: pull}
+	t.save()
+	return t
+}
+
+// Save the progress of the pull attempt every few seconds until the returned function is called with the result of the
+// attempt.
+func (t *pullTracker) track(progress *pullProgress) func(error) {
+	if t == nil {
+		return func(error) {}
+	}
+
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(pullProgressSaveIntervalS * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.update(progress)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func(err error) {
+		close(done)
+		<-stopped
+
+		t.lock.Lock()
+		t.pull.Attempts++
+		if err != nil {
+			t.pull.LastError = err.Error()
+		}
+		t.lock.Unlock()
+		t.update(progress)
+	}
+}
+
+func (t *pullTracker) update(progress *pullProgress) {
+	t.lock.Lock()
+	t.pull.UpdateLayers(progress.Layers())
+	t.lock.Unlock()
+	t.save()
+}
+
+// The pull completed, its progress is no longer needed.
+func (t *pullTracker) done() {
+	if t == nil {
+		return
+	}
+	if err := persistence.DeleteImagePull(t.db, t.pull.Image); err != nil {
+		glog.Warningf(ptLogString(err))
+	}
+}
+
+// The pull did not complete, it is either waiting for the next pull window or it failed.
+func (t *pullTracker) stopped(err error) {
+	if t == nil {
+		return
+	}
+
+	t.lock.Lock()
+	if _, ok := err.(*PullWindowError); ok {
+		t.pull.Status = persistence.IMAGE_PULL_STATUS_WAITING
+	} else {
+		t.pull.Status = persistence.IMAGE_PULL_STATUS_FAILED
+		t.pull.LastError = err.Error()
+	}
+	t.lock.Unlock()
+	t.save()
+}
+
+func (t *pullTracker) save() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := persistence.SaveImagePull(t.db, t.pull); err != nil {
+		glog.Warningf(ptLogString(fmt.Sprintf("unable to save the progress of the pull of image %v, error: %v", t.pull.Image, err)))
+	}
+}
+
+var ptLogString = func(v interface{}) string {
+	return fmt.Sprintf("Image pull: %v", v)
+}
@@ -0,0 +1,322 @@
+// Package imageregistry is a client of the docker registry HTTP API. It is shared by the agent and the hzn CLI, so it
+// must not depend on the agent workers or persistence.
+package imageregistry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	docker "github.com/fsouza/go-dockerclient"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	OCI_MANIFEST_MEDIA_TYPE         = "application/vnd.oci.image.manifest.v1+json"
+	OCI_INDEX_MEDIA_TYPE            = "application/vnd.oci.image.index.v1+json"
+	DOCKER_MANIFEST_MEDIA_TYPE      = "application/vnd.docker.distribution.manifest.v2+json"
+	DOCKER_MANIFEST_LIST_MEDIA_TYPE = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	DOCKER_HUB_REGISTRY = "registry-1.docker.io"
+)
+
+// A client of the docker registry HTTP API, used to read image manifests and blobs without going through the docker
+// daemon.
+type RegistryClient struct {
+	httpClient *http.Client
+}
+
+func NewRegistryClient(httpClient *http.Client) *RegistryClient {
+	return &RegistryClient{
+		httpClient: httpClient,
+	}
+}
+
+// A manifest of the registry API. An image manifest has the config and the layers of an image, a manifest list or an
+// OCI index has the manifests of each platform of a multi-arch image.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+	Manifests     []Descriptor `json:"manifests,omitempty"`
+}
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+// The platform of an image, in the terms of the OCI image spec.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p Platform) String() string {
+	if p.Variant == "" {
+		return p.OS + "/" + p.Architecture
+	}
+	return p.OS + "/" + p.Architecture + "/" + p.Variant
+}
+
+// Returns the digest of the manifest of the platform in a manifest list, or "" if there is none. When the platform has a
+// variant, a manifest of the same variant is preferred, a manifest without a variant is taken otherwise.
+func (m *Manifest) platformDigest(platform Platform) string {
+	digest := ""
+	for _, d := range m.Manifests {
+		if d.Platform == nil || d.Platform.OS != platform.OS || d.Platform.Architecture != platform.Architecture {
+			continue
+		} else if d.Platform.Variant == platform.Variant {
+			return d.Digest
+		} else if d.Platform.Variant == "" && digest == "" {
+			digest = d.Digest
+		}
+	}
+	return digest
+}
+
+// Returns the registry host and the repository of an image in the registry.
+func RegistryRepository(domain string, path string) (string, string) {
+	if domain == "" || domain == "docker.io" || domain == "index.docker.io" {
+		if !strings.Contains(path, "/") {
+			path = "library/" + path
+		}
+		return DOCKER_HUB_REGISTRY, path
+	}
+	return domain, path
+}
+
+func CheckBlobDigest(blob []byte, digest string) error {
+	hash := sha256.Sum256(blob)
+	if actual := "sha256:" + hex.EncodeToString(hash[:]); actual != digest {
+		return errors.New(fmt.Sprintf("blob has digest %v, expected %v", actual, digest))
+	}
+	return nil
+}
+
+// Get a resource of a repository from the registry API, returning the body and the headers of the response.
+func (rc *RegistryClient) Get(registry string, repo string, resource string, accept []string, auth docker.AuthConfiguration) ([]byte, http.Header, error) {
+	header := make(http.Header)
+	if len(accept) != 0 {
+		header.Set("Accept", strings.Join(accept, ", "))
+	}
+
+	resp, err := rc.get(context.Background(), registry, repo, resource, header, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.New(fmt.Sprintf("GET %v returned %v", resp.Request.URL, resp.Status))
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	return body, resp.Header, err
+}
+
+// Returns the body of a blob of a repository from the registry API, starting at the offset, and the offset the body
+// starts at. That is 0 when the registry does not support range requests and returns the whole blob. The caller has to
+// close the body.
+func (rc *RegistryClient) GetBlob(ctx context.Context, registry string, repo string, digest string, offset int64, auth docker.AuthConfiguration) (io.ReadCloser, int64, error) {
+	header := make(http.Header)
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := rc.get(ctx, registry, repo, "blobs/"+digest, header, auth)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, 0, nil
+	case http.StatusPartialContent:
+		return resp.Body, offset, nil
+	default:
+		resp.Body.Close()
+		return nil, 0, errors.New(fmt.Sprintf("GET %v returned %v", resp.Request.URL, resp.Status))
+	}
+}
+
+// Send a GET request for a resource of a repository to the registry API. A registry that requires a token returns 401
+// with a challenge naming the token service. The token is fetched using the docker credentials for the registry, and the
+// request is retried with the token.
+func (rc *RegistryClient) get(ctx context.Context, registry string, repo string, resource string, header http.Header, auth docker.AuthConfiguration) (*http.Response, error) {
+
+	resourceUrl := fmt.Sprintf("https://%v/v2/%v/%v", registry, repo, resource)
+	resp, err := rc.doGet(ctx, resourceUrl, header, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+
+		if authorization, err := rc.authorization(challenge, repo, auth); err != nil {
+			return nil, err
+		} else if resp, err = rc.doGet(ctx, resourceUrl, header, authorization); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// Returns the manifest of the image for the platform and the digest of the manifest. The reference is a tag or a digest
+// of the image. When it refers to a manifest list or an OCI index, the manifest of the platform in the list is returned.
+func (rc *RegistryClient) PlatformManifest(registry string, repo string, reference string, platform Platform, auth docker.AuthConfiguration) (*Manifest, string, error) {
+	accept := []string{OCI_INDEX_MEDIA_TYPE, DOCKER_MANIFEST_LIST_MEDIA_TYPE, OCI_MANIFEST_MEDIA_TYPE, DOCKER_MANIFEST_MEDIA_TYPE}
+
+	for {
+		body, header, err := rc.Get(registry, repo, "manifests/"+reference, accept, auth)
+		if err != nil {
+			return nil, "", err
+		}
+
+		var manifest Manifest
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return nil, "", errors.New(fmt.Sprintf("unable to demarshal manifest %v, error: %v", reference, err))
+		}
+		if manifest.MediaType == "" {
+			manifest.MediaType = header.Get("Content-Type")
+		}
+
+		hash := sha256.Sum256(body)
+		digest := "sha256:" + hex.EncodeToString(hash[:])
+		if strings.HasPrefix(reference, "sha256:") && reference != digest {
+			return nil, "", errors.New(fmt.Sprintf("registry returned a manifest with digest %v for %v", digest, reference))
+		}
+
+		if manifest.MediaType != OCI_INDEX_MEDIA_TYPE && manifest.MediaType != DOCKER_MANIFEST_LIST_MEDIA_TYPE {
+			return &manifest, digest, nil
+		} else if reference = manifest.platformDigest(platform); reference == "" {
+			return nil, "", errors.New(fmt.Sprintf("manifest list %v has no image for platform %v", digest, platform))
+		}
+		accept = []string{OCI_MANIFEST_MEDIA_TYPE, DOCKER_MANIFEST_MEDIA_TYPE}
+	}
+}
+
+// Returns the digest of the manifest that the tag of an image points to in the registry. For a multi-arch image this is
+// the digest of the manifest list, so that each node pulls the image for its own architecture. The domain and path
+// are the parts of the image name returned by cutil.ParseDockerImagePath.
+func (rc *RegistryClient) ResolveDigest(domain string, path string, tag string, auth docker.AuthConfiguration) (string, error) {
+	if tag == "" {
+		tag = "latest"
+	}
+
+	registry, repo := RegistryRepository(domain, path)
+	manifest, header, err := rc.Get(registry, repo, "manifests/"+tag, []string{OCI_INDEX_MEDIA_TYPE, DOCKER_MANIFEST_LIST_MEDIA_TYPE, OCI_MANIFEST_MEDIA_TYPE, DOCKER_MANIFEST_MEDIA_TYPE}, auth)
+	if err != nil {
+		return "", err
+	}
+
+	// The registry computes the digest over the manifest it returned, so the header can be checked against the body.
+	hash := sha256.Sum256(manifest)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+	if headerDigest := header.Get("Docker-Content-Digest"); headerDigest != "" && headerDigest != digest {
+		return "", errors.New(fmt.Sprintf("registry returned digest %v for a manifest with digest %v", headerDigest, digest))
+	}
+	return digest, nil
+}
+
+func (rc *RegistryClient) doGet(ctx context.Context, resourceUrl string, header http.Header, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, resourceUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return rc.httpClient.Do(req)
+}
+
+// Returns the Authorization header answering the challenge of the registry.
+func (rc *RegistryClient) authorization(challenge string, repo string, auth docker.AuthConfiguration) (string, error) {
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if auth.Username == "" {
+			return "", errors.New("registry requires credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password)), nil
+
+	case "bearer":
+		if params["realm"] == "" {
+			return "", errors.New(fmt.Sprintf("registry token challenge has no realm: %v", challenge))
+		}
+		tokenUrl, err := url.Parse(params["realm"])
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("registry token realm %v is not valid, error: %v", params["realm"], err))
+		}
+		query := tokenUrl.Query()
+		if params["service"] != "" {
+			query.Set("service", params["service"])
+		}
+		query.Set("scope", fmt.Sprintf("repository:%v:pull", repo))
+		tokenUrl.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, tokenUrl.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if auth.Username != "" {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+		resp, err := rc.httpClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", errors.New(fmt.Sprintf("registry token request returned %v", resp.Status))
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", errors.New(fmt.Sprintf("unable to demarshal registry token, error: %v", err))
+		} else if token.Token != "" {
+			return "Bearer " + token.Token, nil
+		} else if token.AccessToken != "" {
+			return "Bearer " + token.AccessToken, nil
+		}
+		return "", errors.New("registry token response has no token")
+
+	default:
+		return "", errors.New(fmt.Sprintf("registry authentication challenge %v is not supported", challenge))
+	}
+}
+
+// Split a WWW-Authenticate challenge such as: Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) == 2 {
+		for _, param := range strings.Split(parts[1], ",") {
+			if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 {
+				params[strings.ToLower(kv[0])] = strings.Trim(kv[1], "\"")
+			}
+		}
+	}
+	return parts[0], params
+}
@@ -0,0 +1,180 @@
+// +build unit
+
+package imageregistry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func Test_ResolveDigest(t *testing.T) {
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`)
+	hash := sha256.Sum256(manifest)
+	manifestDigest := "sha256:" + hex.EncodeToString(hash[:])
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/myrepo/myimage/manifests/latest", "/v2/myrepo/myimage/manifests/1.0":
+			w.Header().Set("Content-Type", OCI_MANIFEST_MEDIA_TYPE)
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.Write(manifest)
+		case "/v2/myrepo/myimage/manifests/bad":
+			w.Header().Set("Docker-Content-Digest", testImageDigest)
+			w.Write(manifest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	rc := NewRegistryClient(server.Client())
+
+	digest, err := rc.ResolveDigest(u.Host, "myrepo/myimage", "1.0", docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, manifestDigest, digest)
+
+	// the default tag is latest
+	digest, err = rc.ResolveDigest(u.Host, "myrepo/myimage", "", docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, manifestDigest, digest)
+
+	// the registry returned a manifest that does not match its digest
+	_, err = rc.ResolveDigest(u.Host, "myrepo/myimage", "bad", docker.AuthConfiguration{})
+	assert.NotNil(t, err)
+
+	// the tag does not exist
+	_, err = rc.ResolveDigest(u.Host, "myrepo/myimage", "2.0", docker.AuthConfiguration{})
+	assert.NotNil(t, err)
+}
+
+func Test_RegistryRepository(t *testing.T) {
+
+	registry, repo := RegistryRepository("", "ubuntu")
+	assert.Equal(t, DOCKER_HUB_REGISTRY, registry)
+	assert.Equal(t, "library/ubuntu", repo)
+
+	registry, repo = RegistryRepository("", "openhorizon/anax")
+	assert.Equal(t, DOCKER_HUB_REGISTRY, registry)
+	assert.Equal(t, "openhorizon/anax", repo)
+
+	registry, repo = RegistryRepository("myregistry.com:5000", "a/b")
+	assert.Equal(t, "myregistry.com:5000", registry)
+	assert.Equal(t, "a/b", repo)
+}
+
+func Test_PlatformManifest(t *testing.T) {
+
+	amd64 := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"digest":"sha256:aaaa"},"layers":[{"digest":"sha256:bbbb","size":10}]}`)
+	amd64Hash := sha256.Sum256(amd64)
+	amd64Digest := "sha256:" + hex.EncodeToString(amd64Hash[:])
+	arm64 := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"digest":"sha256:cccc"},"layers":[]}`)
+	arm64Hash := sha256.Sum256(arm64)
+	arm64Digest := "sha256:" + hex.EncodeToString(arm64Hash[:])
+	list := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[` +
+		`{"digest":"` + arm64Digest + `","platform":{"architecture":"arm64","os":"linux","variant":"v8"}},` +
+		`{"digest":"` + amd64Digest + `","platform":{"architecture":"amd64","os":"linux"}}]}`)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/myrepo/myimage/manifests/1.0":
+			w.Write(list)
+		case "/v2/myrepo/myimage/manifests/" + amd64Digest:
+			w.Write(amd64)
+		case "/v2/myrepo/myimage/manifests/" + arm64Digest:
+			w.Write(arm64)
+		case "/v2/myrepo/myimage/manifests/" + testImageDigest:
+			w.Write(amd64)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	rc := NewRegistryClient(server.Client())
+
+	// the manifest of the platform is taken from the manifest list
+	manifest, digest, err := rc.PlatformManifest(u.Host, "myrepo/myimage", "1.0", Platform{OS: "linux", Architecture: "amd64"}, docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, amd64Digest, digest)
+	assert.Equal(t, "sha256:aaaa", manifest.Config.Digest)
+	assert.Equal(t, []Descriptor{{Digest: "sha256:bbbb", Size: 10}}, manifest.Layers)
+
+	manifest, digest, err = rc.PlatformManifest(u.Host, "myrepo/myimage", "1.0", Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, arm64Digest, digest)
+	assert.Equal(t, "sha256:cccc", manifest.Config.Digest)
+
+	// an image manifest is returned as it is
+	_, digest, err = rc.PlatformManifest(u.Host, "myrepo/myimage", amd64Digest, Platform{OS: "linux", Architecture: "arm64"}, docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, amd64Digest, digest)
+
+	// there is no image for the platform
+	_, _, err = rc.PlatformManifest(u.Host, "myrepo/myimage", "1.0", Platform{OS: "linux", Architecture: "s390x"}, docker.AuthConfiguration{})
+	assert.NotNil(t, err)
+
+	// the registry returned a manifest that does not match the digest
+	_, _, err = rc.PlatformManifest(u.Host, "myrepo/myimage", testImageDigest, Platform{OS: "linux", Architecture: "amd64"}, docker.AuthConfiguration{})
+	assert.NotNil(t, err)
+}
+
+func Test_GetBlob(t *testing.T) {
+
+	blob := []byte("0123456789")
+	ranges := true
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/myrepo/myimage/blobs/"+testImageDigest {
+			w.WriteHeader(http.StatusNotFound)
+		} else if !ranges {
+			w.Write(blob)
+		} else {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	rc := NewRegistryClient(server.Client())
+
+	body, start, err := rc.GetBlob(context.Background(), u.Host, "myrepo/myimage", testImageDigest, 0, docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), start)
+	b, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, blob, b)
+
+	// the download resumes at the offset
+	body, start, err = rc.GetBlob(context.Background(), u.Host, "myrepo/myimage", testImageDigest, 4, docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), start)
+	b, _ = ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, blob[4:], b)
+
+	// a registry without range requests returns the whole blob
+	ranges = false
+	body, start, err = rc.GetBlob(context.Background(), u.Host, "myrepo/myimage", testImageDigest, 4, docker.AuthConfiguration{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), start)
+	b, _ = ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, blob, b)
+
+	_, _, err = rc.GetBlob(context.Background(), u.Host, "myrepo/otherimage", testImageDigest, 0, docker.AuthConfiguration{})
+	assert.NotNil(t, err)
+}
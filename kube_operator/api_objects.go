@@ -15,7 +15,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sort"
 	"time"
 )
 
@@ -29,9 +31,20 @@ type APIObjectInterface interface {
 // Sort a slice of k8s api objects by kind of object
 // Returns a map of object type names to api object interfaces types, the namespace to be used for the operator, and an error if one occurs
 // Also verifies that all objects are named so they can be found and uninstalled
-func sortAPIObjects(allObjects []APIObjects, customResource *unstructured.Unstructured, envVarMap map[string]string, agreementId string) (map[string][]APIObjectInterface, string, error) {
+// The objects without a typed handler are kept as unstructured objects, in the order they are installed
+func sortAPIObjects(allObjects []APIObjects, customResource *unstructured.Unstructured, envVarMap map[string]string, secretMap map[string][]byte, agreementId string) (map[string][]APIObjectInterface, string, error) {
 	namespace := ""
 	objMap := map[string][]APIObjectInterface{}
+
+	// The operator CRD is the one that defines the operator custom resource, the other CRDs are installed like any other object
+	numCRDs := 0
+	for _, obj := range allObjects {
+		if obj.Type.Kind == K8S_CRD_TYPE {
+			numCRDs++
+		}
+	}
+	clients := &dynamicClients{}
+
 	for _, obj := range allObjects {
 		switch obj.Type.Kind {
 		case K8S_NAMESPACE_TYPE:
@@ -83,7 +96,7 @@ func sortAPIObjects(allObjects []APIObjects, customResource *unstructured.Unstru
 						return objMap, namespace, fmt.Errorf(kwlog(fmt.Sprintf("Error: multiple namespaces specified in operator: %s and %s", namespace, typedDeployment.ObjectMeta.Namespace)))
 					}
 				}
-				newDeployment := DeploymentAppsV1{DeploymentObject: typedDeployment, EnvVarMap: envVarMap, AgreementId: agreementId}
+				newDeployment := DeploymentAppsV1{DeploymentObject: typedDeployment, EnvVarMap: envVarMap, SecretMap: secretMap, AgreementId: agreementId}
 				if newDeployment.Name() != "" {
 					glog.V(4).Infof(kwlog(fmt.Sprintf("Found kubernetes deployment object %s.", newDeployment.Name())))
 					objMap[K8S_DEPLOYMENT_TYPE] = append(objMap[K8S_DEPLOYMENT_TYPE], newDeployment)
@@ -106,7 +119,7 @@ func sortAPIObjects(allObjects []APIObjects, customResource *unstructured.Unstru
 				return objMap, namespace, fmt.Errorf(kwlog(fmt.Sprintf("Error: service account object has unrecognized type %T: %v", obj.Object, obj.Object)))
 			}
 		case K8S_CRD_TYPE:
-			if typedCRD, ok := obj.Object.(*crdv1beta1.CustomResourceDefinition); ok {
+			if typedCRD, ok := obj.Object.(*crdv1beta1.CustomResourceDefinition); ok && (numCRDs == 1 || definesKind(typedCRD.Spec.Group, typedCRD.Spec.Names.Kind, customResource)) {
 				newCustomResource := CustomResourceV1Beta1{CustomResourceDefinitionObject: typedCRD, CustomResourceObject: customResource}
 				if newCustomResource.Name() != "" {
 					glog.V(4).Infof(kwlog(fmt.Sprintf("Found kubernetes custom resource definition object %s.", newCustomResource.Name())))
@@ -114,12 +127,15 @@ func sortAPIObjects(allObjects []APIObjects, customResource *unstructured.Unstru
 				} else {
 					return objMap, namespace, fmt.Errorf(kwlog(fmt.Sprintf("Error: custom resource definition object must have a name in its metadata section.")))
 				}
-			} else if typedCRD, ok := obj.Object.(*crdv1.CustomResourceDefinition); ok {
+			} else if typedCRD, ok := obj.Object.(*crdv1.CustomResourceDefinition); ok && (numCRDs == 1 || definesKind(typedCRD.Spec.Group, typedCRD.Spec.Names.Kind, customResource)) {
 				objMap[K8S_CRD_TYPE] = append(objMap[K8S_CRD_TYPE], CustomResourceV1{CustomResourceDefinitionObject: typedCRD, CustomResourceObject: customResource})
-			} else {
-				return objMap, namespace, fmt.Errorf(kwlog(fmt.Sprintf("Error: custom resource definition object has unrecognized type %T: %v", obj.Object, obj.Object)))
+			} else if err := addUnstructuredObject(objMap, obj, clients); err != nil {
+				return objMap, namespace, err
+			}
+		default:
+			if err := addUnstructuredObject(objMap, obj, clients); err != nil {
+				return objMap, namespace, err
 			}
-
 		}
 
 	}
@@ -127,9 +143,139 @@ func sortAPIObjects(allObjects []APIObjects, customResource *unstructured.Unstru
 		namespace = ANAX_NAMESPACE
 	}
 
+	// Namespaces and CRDs first, then the objects that workloads use, then the workloads and at last the custom resources
+	others := objMap[K8S_UNSTRUCTURED_TYPE]
+	sort.SliceStable(others, func(i, j int) bool {
+		return kindRank(others[i].(UnstructuredObject).Object.GetKind()) < kindRank(others[j].(UnstructuredObject).Object.GetKind())
+	})
+
 	return objMap, namespace, nil
 }
 
+// definesKind returns true if the custom resource has the group and kind that the CRD defines
+func definesKind(group string, kind string, customResource *unstructured.Unstructured) bool {
+	if customResource == nil {
+		return false
+	}
+	gvk := customResource.GroupVersionKind()
+	return gvk.Group == group && gvk.Kind == kind
+}
+
+// addUnstructuredObject adds an object of a kind that has no typed handler to the unstructured objects of the map
+func addUnstructuredObject(objMap map[string][]APIObjectInterface, obj APIObjects, clients *dynamicClients) error {
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	newObj := UnstructuredObject{Object: u, clients: clients}
+	if newObj.Name() == "" {
+		return fmt.Errorf(kwlog(fmt.Sprintf("Error: %v object must have a name in its metadata section.", obj.Type.Kind)))
+	}
+	glog.V(4).Infof(kwlog(fmt.Sprintf("Found kubernetes %v object %s.", obj.Type.Kind, newObj.Name())))
+	objMap[K8S_UNSTRUCTURED_TYPE] = append(objMap[K8S_UNSTRUCTURED_TYPE], newObj)
+	return nil
+}
+
+// toUnstructured converts a typed object to an unstructured object that can be applied with the dynamic client
+func toUnstructured(obj APIObjects) (*unstructured.Unstructured, error) {
+	if u, ok := obj.Object.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf(kwlog(fmt.Sprintf("Error: unable to convert %v object: %v", obj.Type.Kind, err)))
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(*obj.Type)
+
+	// these are set by the cluster
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u, nil
+}
+
+// splitUnstructuredObjects returns the unstructured objects that are installed before the operator deployment, like
+// CRDs, config maps and cluster roles, and the ones that are installed after it, like other workloads and custom resources
+func splitUnstructuredObjects(objs []APIObjectInterface) ([]APIObjectInterface, []APIObjectInterface) {
+	for i, obj := range objs {
+		if kindRank(obj.(UnstructuredObject).Object.GetKind()) > kindRank(K8S_DEPLOYMENT_TYPE) {
+			return objs[:i], objs[i:]
+		}
+	}
+	return objs, nil
+}
+
+//----------------Any other kind----------------
+
+// The dynamic client and rest mapper are created when they are first used, and shared by the objects of a deployment
+type dynamicClients struct {
+	client *ManifestClient
+}
+
+func (d *dynamicClients) get(c KubeClient) (*ManifestClient, error) {
+	if d.client == nil {
+		mc, err := newManifestClient(c)
+		if err != nil {
+			return nil, err
+		}
+		d.client = mc
+	}
+	return d.client, nil
+}
+
+// UnstructuredObject is an object of any kind, which is applied with the dynamic client. Namespaced objects are put in
+// the operator namespace.
+type UnstructuredObject struct {
+	Object  *unstructured.Unstructured
+	clients *dynamicClients
+}
+
+func (u UnstructuredObject) Install(c KubeClient, namespace string) error {
+	mc, err := u.clients.get(c)
+	if err != nil {
+		return err
+	}
+	if err := mc.apply(u.Object, namespace); err != nil {
+		return err
+	}
+
+	// the custom resources of a CRD can only be created once the cluster serves the new kind
+	if u.Object.GetKind() == K8S_CRD_TYPE {
+		return mc.waitForReady(u.Object, namespace, CRD_READY_TIMEOUT_S)
+	}
+	return nil
+}
+
+func (u UnstructuredObject) Uninstall(c KubeClient, namespace string) {
+	mc, err := u.clients.get(c)
+	if err != nil {
+		glog.Errorf(kwlog(fmt.Sprintf("Error: unable to get a kubernetes dynamic client for uninstalling %v %v: %v", u.Object.GetKind(), u.Name(), err)))
+		return
+	}
+	ri, err := mc.resourceFor(u.Object, namespace)
+	if err != nil {
+		glog.Errorf(kwlog(fmt.Sprintf("unable to delete %v %s. Error: %v", u.Object.GetKind(), u.Name(), err)))
+		return
+	}
+	glog.V(3).Infof(kwlog(fmt.Sprintf("deleting %v %v", u.Object.GetKind(), u.Name())))
+	if err := ri.Delete(u.Name(), &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		glog.Errorf(kwlog(fmt.Sprintf("unable to delete %v %s. Error: %v", u.Object.GetKind(), u.Name(), err)))
+	}
+}
+
+// Status returns the ObjectStatus of the object, which tells whether it is ready for the kinds that have a readiness check
+func (u UnstructuredObject) Status(c KubeClient, namespace string) (interface{}, error) {
+	mc, err := u.clients.get(c)
+	if err != nil {
+		return nil, err
+	}
+	return mc.objectStatus(u.Object, namespace)
+}
+
+func (u UnstructuredObject) Name() string {
+	return u.Object.GetName()
+}
+
 //----------------Namespace----------------
 
 type NamespaceCoreV1 struct {
@@ -271,14 +417,24 @@ func (sa ServiceAccountCoreV1) Name() string {
 }
 
 //----------------Deployment----------------
-// The deployment object includes the environment variable config map
+// The deployment object includes the environment variable config map and the service secrets
 
 type DeploymentAppsV1 struct {
 	DeploymentObject *appsv1.Deployment
 	EnvVarMap        map[string]string
+	SecretMap        map[string][]byte
 	AgreementId      string
 }
 
+// The secret values are left out so that they are never logged.
+func (d DeploymentAppsV1) String() string {
+	secretNames := []string{}
+	for name := range d.SecretMap {
+		secretNames = append(secretNames, name)
+	}
+	return fmt.Sprintf("DeploymentObject: %v, EnvVarMap: %v, SecretMap: %v, AgreementId: %v", d.DeploymentObject, d.EnvVarMap, secretNames, d.AgreementId)
+}
+
 func (d DeploymentAppsV1) Install(c KubeClient, namespace string) error {
 	glog.V(3).Infof(kwlog(fmt.Sprintf("creating deployment %v", d)))
 
@@ -297,10 +453,27 @@ func (d DeploymentAppsV1) Install(c KubeClient, namespace string) error {
 
 	// Let the operator know about the config map
 	dWithEnv := addConfigMapVarToDeploymentObject(*d.DeploymentObject, mapName)
+
+	// Create the secret holding the service secrets and mount it into the operator.
+	if len(d.SecretMap) != 0 {
+		secretName, err := c.CreateSecret(d.SecretMap, d.AgreementId, namespace)
+		if err != nil {
+			return err
+		}
+		dWithEnv = addSecretToDeploymentObject(dWithEnv, secretName)
+	}
+
 	_, err = c.Client.AppsV1().Deployments(namespace).Create(&dWithEnv)
 	if err != nil && errors.IsAlreadyExists(err) {
 		d.Uninstall(c, namespace)
-		mapName, err = c.CreateConfigMap(envAdds, d.AgreementId, namespace)
+		if _, err = c.CreateConfigMap(envAdds, d.AgreementId, namespace); err != nil {
+			return err
+		}
+		if len(d.SecretMap) != 0 {
+			if _, err = c.CreateSecret(d.SecretMap, d.AgreementId, namespace); err != nil {
+				return err
+			}
+		}
 		_, err = c.Client.AppsV1().Deployments(namespace).Create(&dWithEnv)
 	}
 	if err != nil {
@@ -323,6 +496,14 @@ func (d DeploymentAppsV1) Uninstall(c KubeClient, namespace string) {
 	if err != nil {
 		glog.Errorf(kwlog(fmt.Sprintf("unable to delete config map %s. Error: %v", configMapName, err)))
 	}
+
+	secretName := fmt.Sprintf("%s-%s", HZN_SECRETS, d.AgreementId)
+	glog.V(3).Infof(kwlog(fmt.Sprintf("deleting secret %v", secretName)))
+	// Delete the agreement secret, there is none if the service does not use secrets
+	err = c.Client.CoreV1().Secrets(namespace).Delete(secretName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		glog.Errorf(kwlog(fmt.Sprintf("unable to delete secret %s. Error: %v", secretName, err)))
+	}
 }
 
 // Status will be the status of the operator pod
@@ -0,0 +1,217 @@
+// +build unit
+
+package kube_operator
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+const testOperatorCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+
+const testOtherCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.other.com
+spec:
+  group: other.com
+  names:
+    kind: Gadget
+    plural: gadgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+
+const testOperatorCR = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: my-widget
+  annotations:
+    openhorizon.anax/operator: "true"
+spec:
+  sizes:
+  - 1
+  - 2
+`
+
+const testOtherCR = `apiVersion: other.com/v1
+kind: Gadget
+metadata:
+  name: my-gadget
+`
+
+const testOperatorDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: widget-operator
+spec:
+  selector:
+    matchLabels:
+      name: widget-operator
+  template:
+    metadata:
+      labels:
+        name: widget-operator
+    spec:
+      containers:
+      - name: operator
+        image: widget-operator:1.0
+`
+
+const testConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: widget-config
+data:
+  color: blue
+`
+
+const testStatefulSet = `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: widget-db
+spec:
+  serviceName: widget-db
+  selector:
+    matchLabels:
+      app: widget-db
+  template:
+    metadata:
+      labels:
+        app: widget-db
+    spec:
+      containers:
+      - name: db
+        image: postgres:13
+`
+
+func unstructuredNames(objs []APIObjectInterface) []string {
+	names := []string{}
+	for _, obj := range objs {
+		u := obj.(UnstructuredObject).Object
+		names = append(names, u.GetKind()+"/"+u.GetName())
+	}
+	return names
+}
+
+func Test_processDeployment_otherKinds(t *testing.T) {
+	archive := testArchive(t, map[string]string{
+		"crd.yaml":        testOperatorCRD,
+		"cr.yaml":         testOperatorCR,
+		"deployment.yaml": testOperatorDeployment,
+		"other.yaml":      testStatefulSet + "---\n" + testConfigMap + "---\n" + testOtherCR + "---\n" + testOtherCRD + "---\n" + testService,
+	})
+
+	objMap, namespace, err := processDeployment(archive, map[string]string{}, nil, "ag1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if namespace != ANAX_NAMESPACE {
+		t.Errorf("expected namespace %v, got %v", ANAX_NAMESPACE, namespace)
+	}
+
+	if len(objMap[K8S_CRD_TYPE]) != 1 || objMap[K8S_CRD_TYPE][0].Name() != "widgets.example.com" {
+		t.Fatalf("expected the operator CRD, got %v", objMap[K8S_CRD_TYPE])
+	} else if cr := objMap[K8S_CRD_TYPE][0].(CustomResourceV1).CustomResourceObject; cr.GetName() != "my-widget" {
+		t.Errorf("expected the operator custom resource, got %v", cr.GetName())
+	} else if sizes, _, _ := unstructured.NestedSlice(cr.Object, "spec", "sizes"); len(sizes) != 2 {
+		t.Errorf("expected 2 sizes in the custom resource, got %v", sizes)
+	}
+	if len(objMap[K8S_DEPLOYMENT_TYPE]) != 1 {
+		t.Errorf("expected the operator deployment, got %v", objMap[K8S_DEPLOYMENT_TYPE])
+	}
+
+	// The other objects are in the order they are installed
+	pre, post := splitUnstructuredObjects(objMap[K8S_UNSTRUCTURED_TYPE])
+	expectedPre := []string{"CustomResourceDefinition/gadgets.other.com", "ConfigMap/widget-config", "Service/web"}
+	expectedPost := []string{"StatefulSet/widget-db", "Gadget/my-gadget"}
+	if names := unstructuredNames(pre); len(names) != len(expectedPre) {
+		t.Fatalf("expected %v before the operator, got %v", expectedPre, names)
+	} else {
+		for i := range names {
+			if names[i] != expectedPre[i] {
+				t.Errorf("expected %v before the operator, got %v", expectedPre, names)
+			}
+		}
+	}
+	if names := unstructuredNames(post); len(names) != len(expectedPost) {
+		t.Fatalf("expected %v after the operator, got %v", expectedPost, names)
+	} else {
+		for i := range names {
+			if names[i] != expectedPost[i] {
+				t.Errorf("expected %v after the operator, got %v", expectedPost, names)
+			}
+		}
+	}
+
+	// Converted objects only have the fields the cluster accepts
+	for _, obj := range objMap[K8S_UNSTRUCTURED_TYPE] {
+		u := obj.(UnstructuredObject).Object
+		if _, found, _ := unstructured.NestedFieldNoCopy(u.Object, "status"); found {
+			t.Errorf("expected no status in %v %v", u.GetKind(), u.GetName())
+		} else if u.GetAPIVersion() == "" {
+			t.Errorf("expected an apiVersion in %v %v", u.GetKind(), u.GetName())
+		}
+	}
+}
+
+func Test_processDeployment_customResources(t *testing.T) {
+	// A custom resource of a kind that no CRD of the deployment defines is not the operator custom resource
+	archive := testArchive(t, map[string]string{
+		"crd.yaml":        testOperatorCRD,
+		"deployment.yaml": testOperatorDeployment,
+		"cr.yaml":         testOtherCR,
+	})
+	objMap, _, err := processDeployment(archive, map[string]string{}, nil, "ag1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if cr := objMap[K8S_CRD_TYPE][0].(CustomResourceV1).CustomResourceObject; cr.GetName() != "my-gadget" {
+		t.Errorf("expected the only custom resource to be the operator custom resource, got %v", cr.GetName())
+	}
+
+	// Custom resources of two CRDs of the deployment, without the operator annotation
+	archive = testArchive(t, map[string]string{
+		"crd.yaml":        testOperatorCRD + "---\n" + testOtherCRD,
+		"deployment.yaml": testOperatorDeployment,
+		"cr.yaml":         testOtherCR + "---\n" + testOtherCR,
+	})
+	if _, _, err := processDeployment(archive, map[string]string{}, nil, "ag1"); err == nil {
+		t.Errorf("expected an error when the operator custom resource is not annotated")
+	}
+
+	// No custom resource
+	archive = testArchive(t, map[string]string{
+		"crd.yaml":        testOperatorCRD,
+		"deployment.yaml": testOperatorDeployment,
+	})
+	if _, _, err := processDeployment(archive, map[string]string{}, nil, "ag1"); err == nil {
+		t.Errorf("expected an error for a deployment without a custom resource")
+	}
+}
+
+func Test_objectState_crd(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{"kind": K8S_CRD_TYPE}}
+	if state := objectState(crd); state == MANIFEST_STATE_READY {
+		t.Errorf("expected a CRD without conditions not to be ready")
+	}
+	unstructured.SetNestedSlice(crd.Object, []interface{}{map[string]interface{}{"type": "Established", "status": "True"}}, "status", "conditions")
+	if state := objectState(crd); state != MANIFEST_STATE_READY {
+		t.Errorf("expected an established CRD to be ready, got %v", state)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
 	yaml "gopkg.in/yaml.v2"
 	"io"
@@ -14,15 +15,17 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1scheme "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	v1beta1scheme "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	dynamic "k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
-	"reflect"
 	"strings"
 )
 
@@ -32,6 +35,10 @@ const (
 	HZN_ENV_VARS = "hzn-env-vars"
 	// Variable that contains the name of the config map
 	HZN_ENV_KEY = "HZN_ENV_VARS"
+	// Name for the secret holding the service secrets. Only characters allowed: [a-z] "." and "-"
+	HZN_SECRETS = "hzn-secrets"
+	// Variable that contains the name of the secret
+	HZN_SECRETS_KEY = "HZN_SECRETS"
 
 	K8S_ROLE_TYPE           = "Role"
 	K8S_ROLEBINDING_TYPE    = "RoleBinding"
@@ -39,6 +46,14 @@ const (
 	K8S_SERVICEACCOUNT_TYPE = "ServiceAccount"
 	K8S_CRD_TYPE            = "CustomResourceDefinition"
 	K8S_NAMESPACE_TYPE      = "Namespace"
+	// Key of the objects of any other kind, which are installed with the dynamic client
+	K8S_UNSTRUCTURED_TYPE = "Unstructured"
+
+	// Annotation that marks the operator custom resource when there are several custom resources of the CRDs in the deployment
+	OPERATOR_CR_ANNOTATION = "openhorizon.anax/operator"
+
+	// Seconds to wait for a CRD to be established before its custom resources are created
+	CRD_READY_TIMEOUT_S = 60
 )
 
 // Intermediate state for the objects used for k8s api objects that haven't had their exact type asserted yet
@@ -90,8 +105,8 @@ func NewDynamicKubeClient() (dynamic.Interface, error) {
 }
 
 // Install creates the objects specified in the operator deployment in the cluster and creates the custom resource to start the operator
-func (c KubeClient) Install(tar string, envVars map[string]string, agId string) error {
-	apiObjMap, namespace, err := processDeployment(tar, envVars, agId)
+func (c KubeClient) Install(tar string, envVars map[string]string, secretValues map[string][]byte, agId string) error {
+	apiObjMap, namespace, err := processDeployment(tar, envVars, secretValues, agId)
 	if err != nil {
 		return err
 	}
@@ -106,6 +121,15 @@ func (c KubeClient) Install(tar string, envVars map[string]string, agId string)
 		nsDef.Install(c, namespace)
 	}
 
+	// Create the objects the operator might need, like other CRDs, config maps, services and cluster roles
+	preObjs, postObjs := splitUnstructuredObjects(apiObjMap[K8S_UNSTRUCTURED_TYPE])
+	for _, obj := range preObjs {
+		err = obj.Install(c, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create the role types in the cluster
 	for _, roleDef := range apiObjMap[K8S_ROLE_TYPE] {
 		err = roleDef.Install(c, namespace)
@@ -134,6 +158,13 @@ func (c KubeClient) Install(tar string, envVars map[string]string, agId string)
 			return err
 		}
 	}
+	// Create the other workloads and the custom resources of the other CRDs
+	for _, obj := range postObjs {
+		err = obj.Install(c, namespace)
+		if err != nil {
+			return err
+		}
+	}
 
 	for _, crd := range apiObjMap[K8S_CRD_TYPE] {
 		err := crd.Install(c, namespace)
@@ -149,7 +180,7 @@ func (c KubeClient) Install(tar string, envVars map[string]string, agId string)
 
 // Install creates the objects specified in the operator deployment in the cluster and creates the custom resource to start the operator
 func (c KubeClient) Uninstall(tar string, agId string) error {
-	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, agId)
+	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, nil, agId)
 	if err != nil {
 		return err
 	}
@@ -158,6 +189,12 @@ func (c KubeClient) Uninstall(tar string, agId string) error {
 		crd.Uninstall(c, namespace)
 	}
 
+	// Delete the objects of other kinds in the reverse order they were created
+	preObjs, postObjs := splitUnstructuredObjects(apiObjMap[K8S_UNSTRUCTURED_TYPE])
+	for i := len(postObjs) - 1; i >= 0; i-- {
+		postObjs[i].Uninstall(c, namespace)
+	}
+
 	// Delete the deployment types in the cluster
 	for _, dep := range apiObjMap[K8S_DEPLOYMENT_TYPE] {
 		dep.Uninstall(c, namespace)
@@ -174,6 +211,9 @@ func (c KubeClient) Uninstall(tar string, agId string) error {
 	for _, roleDef := range apiObjMap[K8S_ROLE_TYPE] {
 		roleDef.Uninstall(c, namespace)
 	}
+	for i := len(preObjs) - 1; i >= 0; i-- {
+		preObjs[i].Uninstall(c, namespace)
+	}
 	for _, namespaceDef := range apiObjMap[K8S_NAMESPACE_TYPE] {
 		namespaceDef.Uninstall(c, namespace)
 	}
@@ -181,8 +221,27 @@ func (c KubeClient) Uninstall(tar string, agId string) error {
 	glog.V(3).Infof(kwlog(fmt.Sprintf("Completed removal of all operator objects from the cluster.")))
 	return nil
 }
+
+// ObjectStatus returns the state of the objects of the operator deployment that are not handled by the operator itself,
+// like other workloads and custom resources of other CRDs
+func (c KubeClient) ObjectStatus(tar string, agId string) ([]ObjectStatus, error) {
+	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, nil, agId)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []ObjectStatus{}
+	for _, obj := range apiObjMap[K8S_UNSTRUCTURED_TYPE] {
+		status, err := obj.Status(c, namespace)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status.(ObjectStatus))
+	}
+	return statuses, nil
+}
 func (c KubeClient) OperatorStatus(tar string, agId string) (interface{}, error) {
-	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, agId)
+	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, nil, agId)
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +257,7 @@ func (c KubeClient) OperatorStatus(tar string, agId string) (interface{}, error)
 	return status, nil
 }
 func (c KubeClient) Status(tar string, agId string) ([]ContainerStatus, error) {
-	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, agId)
+	apiObjMap, namespace, err := processDeployment(tar, map[string]string{}, nil, agId)
 	if err != nil {
 		return nil, err
 	}
@@ -239,7 +298,7 @@ func (c KubeClient) Status(tar string, agId string) ([]ContainerStatus, error) {
 }
 
 // processDeployment takes the deployment string and converts it to a map with the k8s objects, the namespace to be used, and an error if one occurs
-func processDeployment(tar string, envVars map[string]string, agId string) (map[string][]APIObjectInterface, string, error) {
+func processDeployment(tar string, envVars map[string]string, secretValues map[string][]byte, agId string) (map[string][]APIObjectInterface, string, error) {
 	// Read the yaml files from the commpressed tar files
 	yamls, err := getYamlFromTarGz(tar)
 	if err != nil {
@@ -252,17 +311,71 @@ func processDeployment(tar string, envVars map[string]string, agId string) (map[
 		return nil, "", err
 	}
 
-	if len(customResources) != 1 {
-		return nil, "", fmt.Errorf(kwlog(fmt.Sprintf("Expected one custom resource in deployment. Got %d", len(customResources))))
+	unstructCrs := []*unstructured.Unstructured{}
+	for _, cr := range customResources {
+		unstructCr, err := unstructuredObjectFromYaml(cr)
+		if err != nil {
+			return nil, "", err
+		}
+		unstructCrs = append(unstructCrs, unstructCr)
 	}
 
-	unstructCr, err := unstructuredObjectFromYaml(customResources[0])
+	// The other custom resources are installed like any other object
+	operatorCr, otherCrs, err := findOperatorCustomResource(k8sObjs, unstructCrs)
 	if err != nil {
 		return nil, "", err
 	}
+	for _, cr := range otherCrs {
+		gvk := cr.GroupVersionKind()
+		k8sObjs = append(k8sObjs, APIObjects{Type: &gvk, Object: cr})
+	}
 
 	// Sort the k8s api objects by kind
-	return sortAPIObjects(k8sObjs, unstructCr, envVars, agId)
+	return sortAPIObjects(k8sObjs, operatorCr, envVars, secretValues, agId)
+}
+
+// findOperatorCustomResource returns the custom resource that starts the operator and the other custom resources. The
+// operator custom resource is the only one, the only one with a kind that is defined by a CRD of the deployment, or the
+// one of those that has the operator annotation.
+func findOperatorCustomResource(k8sObjs []APIObjects, customResources []*unstructured.Unstructured) (*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+	if len(customResources) == 1 {
+		return customResources[0], nil, nil
+	}
+
+	operatorCrs := []*unstructured.Unstructured{}
+	otherCrs := []*unstructured.Unstructured{}
+	for _, cr := range customResources {
+		defined := false
+		for _, obj := range k8sObjs {
+			if typedCRD, ok := obj.Object.(*v1beta1scheme.CustomResourceDefinition); ok {
+				defined = defined || definesKind(typedCRD.Spec.Group, typedCRD.Spec.Names.Kind, cr)
+			} else if typedCRD, ok := obj.Object.(*v1scheme.CustomResourceDefinition); ok {
+				defined = defined || definesKind(typedCRD.Spec.Group, typedCRD.Spec.Names.Kind, cr)
+			}
+		}
+		if defined {
+			operatorCrs = append(operatorCrs, cr)
+		} else {
+			otherCrs = append(otherCrs, cr)
+		}
+	}
+
+	if len(operatorCrs) > 1 {
+		annotated := []*unstructured.Unstructured{}
+		for _, cr := range operatorCrs {
+			if cr.GetAnnotations()[OPERATOR_CR_ANNOTATION] == "true" {
+				annotated = append(annotated, cr)
+			} else {
+				otherCrs = append(otherCrs, cr)
+			}
+		}
+		operatorCrs = annotated
+	}
+
+	if len(operatorCrs) != 1 {
+		return nil, nil, fmt.Errorf(kwlog(fmt.Sprintf("Expected one custom resource of a CRD in the deployment, or one with the %v annotation. Got %d", OPERATOR_CR_ANNOTATION, len(operatorCrs))))
+	}
+	return operatorCrs[0], otherCrs, nil
 }
 
 // CreateConfigMap will create a config map with the provided environment variable map
@@ -275,6 +388,20 @@ func (c KubeClient) CreateConfigMap(envVars map[string]string, agId string, name
 	return res.ObjectMeta.Name, nil
 }
 
+// CreateSecret will create a secret holding the service secret values, replacing the secret left over from an earlier install
+func (c KubeClient) CreateSecret(secretValues map[string][]byte, agId string, namespace string) (string, error) {
+	secretName := fmt.Sprintf("%s-%s", HZN_SECRETS, agId)
+	if err := c.Client.CoreV1().Secrets(namespace).Delete(secretName, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return "", fmt.Errorf("Error: failed to delete old secret for %s: %v", agId, err)
+	}
+	hznSecret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName}, Type: corev1.SecretTypeOpaque, Data: secretValues}
+	res, err := c.Client.CoreV1().Secrets(namespace).Create(&hznSecret)
+	if err != nil {
+		return "", fmt.Errorf("Error: failed to create secret for %s: %v", agId, err)
+	}
+	return res.ObjectMeta.Name, nil
+}
+
 func unstructuredObjectFromYaml(crStr YamlFile) (*unstructured.Unstructured, error) {
 	cr := make(map[string]interface{})
 	err := yaml.UnmarshalStrict([]byte(crStr.Body), &cr)
@@ -282,11 +409,32 @@ func unstructuredObjectFromYaml(crStr YamlFile) (*unstructured.Unstructured, err
 		return nil, fmt.Errorf(kwlog(fmt.Sprintf("Error unmarshaling custom resource in deployment. %v", err)))
 	}
 
-	newCr := makeAllKeysStrings(cr).(map[string]interface{})
+	// convert through json, so that the values have the types of the objects of the api server
+	newCr := make(map[string]interface{})
+	if jsonBytes, err := utilyaml.ToJSON([]byte(crStr.Body)); err != nil {
+		return nil, fmt.Errorf(kwlog(fmt.Sprintf("Error converting custom resource in deployment. %v", err)))
+	} else if err := utiljson.Unmarshal(jsonBytes, &newCr); err != nil {
+		return nil, fmt.Errorf(kwlog(fmt.Sprintf("Error converting custom resource in deployment. %v", err)))
+	}
 	unstructCr := unstructured.Unstructured{Object: newCr}
 	return &unstructCr, nil
 }
 
+// mount the secret into each container of the deployment and add a reference to it so the operator can pass it on
+func addSecretToDeploymentObject(deployment appsv1.Deployment, secretName string) appsv1.Deployment {
+	readOnlyMode := int32(0400)
+	secretVolume := corev1.Volume{Name: HZN_SECRETS, VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secretName, DefaultMode: &readOnlyMode}}}
+	deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, secretVolume)
+
+	hznSecretVar := corev1.EnvVar{Name: HZN_SECRETS_KEY, Value: secretName}
+	secretMount := corev1.VolumeMount{Name: HZN_SECRETS, MountPath: config.HZN_SECRETS_MOUNT, ReadOnly: true}
+	for i := range deployment.Spec.Template.Spec.Containers {
+		deployment.Spec.Template.Spec.Containers[i].Env = append(deployment.Spec.Template.Spec.Containers[i].Env, hznSecretVar)
+		deployment.Spec.Template.Spec.Containers[i].VolumeMounts = append(deployment.Spec.Template.Spec.Containers[i].VolumeMounts, secretMount)
+	}
+	return deployment
+}
+
 // add a reference to the envvar config map to the deployment
 func addConfigMapVarToDeploymentObject(deployment appsv1.Deployment, configMapName string) appsv1.Deployment {
 	hznEnvVar := corev1.EnvVar{Name: HZN_ENV_KEY, Value: configMapName}
@@ -299,30 +447,6 @@ func addConfigMapVarToDeploymentObject(deployment appsv1.Deployment, configMapNa
 	return deployment
 }
 
-// recursively go over the given interface to ensure any map keys are strings
-func makeAllKeysStrings(unmarshYaml interface{}) interface{} {
-	if reflect.ValueOf(unmarshYaml).Kind() == reflect.Map {
-		retMap := make(map[string]interface{})
-		if interfKeyMap, ok := unmarshYaml.(map[interface{}]interface{}); ok {
-			for key, value := range interfKeyMap {
-				retMap[fmt.Sprintf("%v", key)] = makeAllKeysStrings(value)
-			}
-		} else {
-			for key, value := range unmarshYaml.(map[string]interface{}) {
-				retMap[key] = makeAllKeysStrings(value)
-			}
-		}
-		return retMap
-	} else if reflect.ValueOf(unmarshYaml).Kind() == reflect.Slice {
-		correctedSlice := make([]interface{}, len(unmarshYaml.([]interface{})))
-		for _, elem := range unmarshYaml.([]interface{}) {
-			correctedSlice = append(correctedSlice, makeAllKeysStrings(elem))
-		}
-		return correctedSlice
-	}
-	return unmarshYaml
-}
-
 // Convert the given yaml files into k8s api objects
 func getK8sObjectFromYaml(yamlFiles []YamlFile, sch *runtime.Scheme) ([]APIObjects, []YamlFile, error) {
 	retObjects := []APIObjects{}
@@ -357,18 +481,14 @@ func getK8sObjectFromYaml(yamlFiles []YamlFile, sch *runtime.Scheme) ([]APIObjec
 		obj, gvk, err := decode([]byte(fileStr.Body), nil, nil)
 
 		if err != nil {
+			// If the object can not be recognized, return the yaml file
 			customResources = append(customResources, fileStr)
 		} else {
-			// If the object can not be recognized, return the yaml file
 			newObj := APIObjects{Type: gvk, Object: obj}
 			retObjects = append(retObjects, newObj)
 		}
 	}
 
-	if len(customResources) > 1 {
-		return retObjects, customResources, fmt.Errorf(kwlog(fmt.Sprintf("Error: kubernetes object not in recognized scheme.")))
-	}
-
 	return retObjects, customResources, nil
 }
 
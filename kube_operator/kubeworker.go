@@ -7,6 +7,7 @@ import (
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/secrets"
 	"github.com/open-horizon/anax/worker"
 )
 
@@ -82,9 +83,20 @@ func (w *KubeWorker) CommandHandler(command worker.Command) bool {
 				return true
 			}
 
-			// Check the deployment to check if it is a kube deployment
+			// Check the deployment to check if it is a manifest or a kube deployment
 			deploymentConfig := lc.ContainerConfig().ClusterDeployment
-			if kd, err := persistence.GetKubeDeployment(deploymentConfig); err != nil {
+			if md, err := persistence.GetManifestDeployment(deploymentConfig); err == nil {
+				if _, err := persistence.AgreementDeploymentStarted(w.db, lc.AgreementId, lc.AgreementProtocol, md); err != nil {
+					glog.Errorf(kwlog(fmt.Sprintf("received error updating database deployment state, %v", err)))
+					w.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, lc.AgreementProtocol, lc.AgreementId, md)
+				} else if err := w.processManifests(lc, md); err != nil {
+					glog.Errorf(kwlog(fmt.Sprintf("failed to apply manifests after agreement negotiation: %v", err)))
+					w.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, lc.AgreementProtocol, lc.AgreementId, md)
+				} else {
+					w.Messages() <- events.NewWorkloadMessage(events.EXECUTION_BEGUN, lc.AgreementProtocol, lc.AgreementId, md)
+				}
+				return true
+			} else if kd, err := persistence.GetKubeDeployment(deploymentConfig); err != nil {
 				glog.Errorf(kwlog(fmt.Sprintf("error getting kube deployment configuration: %v", err)))
 				return true
 			} else if _, err := persistence.AgreementDeploymentStarted(w.db, lc.AgreementId, lc.AgreementProtocol, kd); err != nil {
@@ -103,6 +115,14 @@ func (w *KubeWorker) CommandHandler(command worker.Command) bool {
 		cmd := command.(*UnInstallCommand)
 		glog.V(3).Infof(kwlog(fmt.Sprintf("uninstalling %v", cmd.Deployment)))
 
+		if mdc, ok := cmd.Deployment.(*persistence.ManifestDeploymentConfig); ok {
+			if err := w.uninstallManifests(mdc, cmd.CurrentAgreementId); err != nil {
+				glog.Errorf(kwlog(fmt.Sprintf("failed to remove manifests %v: %v", cmd.Deployment, err)))
+			}
+			w.Messages() <- events.NewWorkloadMessage(events.WORKLOAD_DESTROYED, cmd.AgreementProtocol, cmd.CurrentAgreementId, mdc)
+			return true
+		}
+
 		kdc, ok := cmd.Deployment.(*persistence.KubeDeploymentConfig)
 		if !ok {
 			glog.Warningf(kwlog(fmt.Sprintf("ignoring non-Kube cancelation command %v", cmd)))
@@ -116,6 +136,14 @@ func (w *KubeWorker) CommandHandler(command worker.Command) bool {
 		cmd := command.(*MaintenanceCommand)
 		glog.V(3).Infof(kwlog(fmt.Sprintf("recieved maintenance command %v", cmd)))
 
+		if mdc, ok := cmd.Deployment.(*persistence.ManifestDeploymentConfig); ok {
+			if err := w.manifestStatus(mdc, cmd.AgreementId); err != nil {
+				glog.Errorf(kwlog(fmt.Sprintf("%v", err)))
+				w.Messages() <- events.NewWorkloadMessage(events.EXECUTION_FAILED, cmd.AgreementProtocol, cmd.AgreementId, mdc)
+			}
+			return true
+		}
+
 		kdc, ok := cmd.Deployment.(*persistence.KubeDeploymentConfig)
 		if !ok {
 			glog.Warningf(kwlog(fmt.Sprintf("ignoring non-Kube maintenence command: %v", cmd)))
@@ -144,7 +172,18 @@ func (w *KubeWorker) processKubeOperator(lc *events.AgreementLaunchContext, kd *
 	if err != nil {
 		return err
 	}
-	err = client.Install(kd.OperatorYamlArchive, *(lc.EnvironmentAdditions), lc.AgreementId)
+	// Fetch the values of the secrets bound to the service, they are handed to the operator in a kubernetes secret.
+	secretValues := map[string][]byte{}
+	if len(lc.SecretBindings) != 0 {
+		provider, err := secrets.NewSecretProvider(w.Config)
+		if err != nil {
+			return err
+		}
+		if secretValues, err = secrets.GetSecretValues(provider, lc.SecretBindings); err != nil {
+			return err
+		}
+	}
+	err = client.Install(kd.OperatorYamlArchive, *(lc.EnvironmentAdditions), secretValues, lc.AgreementId)
 	if err != nil {
 		return err
 	}
@@ -180,6 +219,69 @@ func (w *KubeWorker) operatorStatus(kd *persistence.KubeDeploymentConfig, intend
 			retErrorStr = fmt.Sprintf("%s %s", retErrorStr, fmt.Sprintf("Container %s has status %s.", container.Name, container.State))
 		}
 	}
+
+	// The other objects of the deployment have failed when they were removed from the cluster or have failed
+	objStatuses, err := client.ObjectStatus(kd.OperatorYamlArchive, agId)
+	if err != nil {
+		return err
+	}
+	for _, status := range objStatuses {
+		if status.State == MANIFEST_STATE_MISSING || status.State == MANIFEST_STATE_FAILED {
+			retErrorStr = fmt.Sprintf("%s %s", retErrorStr, fmt.Sprintf("%s %s is %s.", status.Kind, status.Name, status.State))
+		}
+	}
+	if retErrorStr != "" {
+		return fmt.Errorf(retErrorStr)
+	}
+	return nil
+}
+
+func (w *KubeWorker) processManifests(lc *events.AgreementLaunchContext, md *persistence.ManifestDeploymentConfig) error {
+	glog.V(3).Infof(kwlog(fmt.Sprintf("begin install of manifest deployment %s", lc.AgreementId)))
+	client, err := NewManifestClient()
+	if err != nil {
+		return err
+	}
+	// Fetch the values of the secrets bound to the service, they are handed to the service in a kubernetes secret.
+	secretValues := map[string][]byte{}
+	if len(lc.SecretBindings) != 0 {
+		provider, err := secrets.NewSecretProvider(w.Config)
+		if err != nil {
+			return err
+		}
+		if secretValues, err = secrets.GetSecretValues(provider, lc.SecretBindings); err != nil {
+			return err
+		}
+	}
+	return client.Install(md, *(lc.EnvironmentAdditions), secretValues, lc.AgreementId)
+}
+
+func (w *KubeWorker) uninstallManifests(md *persistence.ManifestDeploymentConfig, agId string) error {
+	glog.V(3).Infof(kwlog(fmt.Sprintf("begin uninstall of manifest deployment %s", agId)))
+	client, err := NewManifestClient()
+	if err != nil {
+		return err
+	}
+	return client.Uninstall(md, agId)
+}
+
+// The manifest deployment has failed when one of its objects was removed from the cluster or has failed.
+func (w *KubeWorker) manifestStatus(md *persistence.ManifestDeploymentConfig, agId string) error {
+	glog.V(5).Infof(kwlog(fmt.Sprintf("begin listing manifest status %v", md.ToString())))
+	client, err := NewManifestClient()
+	if err != nil {
+		return err
+	}
+	statuses, err := client.Status(md, agId)
+	if err != nil {
+		return err
+	}
+	retErrorStr := ""
+	for _, status := range statuses {
+		if status.State == MANIFEST_STATE_MISSING || status.State == MANIFEST_STATE_FAILED {
+			retErrorStr = fmt.Sprintf("%s %s", retErrorStr, fmt.Sprintf("%s %s is %s.", status.Kind, status.Name, status.State))
+		}
+	}
 	if retErrorStr != "" {
 		return fmt.Errorf(retErrorStr)
 	}
@@ -0,0 +1,477 @@
+package kube_operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"path"
+	"sort"
+	"strings"
+)
+
+// The names of the kustomization file, in the order kustomize looks for them.
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// The deepest nesting of kustomizations that are used as resources of other kustomizations.
+const maxKustomizeDepth = 10
+
+// The subset of the kustomization file that the agent supports.
+type kustomization struct {
+	Resources             []string          `json:"resources"`
+	Bases                 []string          `json:"bases"`
+	NamePrefix            string            `json:"namePrefix"`
+	NameSuffix            string            `json:"nameSuffix"`
+	CommonLabels          map[string]string `json:"commonLabels"`
+	CommonAnnotations     map[string]string `json:"commonAnnotations"`
+	Images                []kustomizeImage  `json:"images"`
+	PatchesStrategicMerge []string          `json:"patchesStrategicMerge"`
+}
+
+type kustomizeImage struct {
+	Name    string `json:"name"`
+	NewName string `json:"newName"`
+	NewTag  string `json:"newTag"`
+	Digest  string `json:"digest"`
+}
+
+// Returns the path of the kustomization file in the directory, or an empty string if there is none.
+func findKustomization(files map[string]string, dir string) string {
+	for _, name := range kustomizationFileNames {
+		if p := path.Join(dir, name); files[p] != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// Build the objects of the kustomization in the directory of the archive files, the way 'kustomize build' would.
+func kustomize(files map[string]string, dir string, depth int) ([]*unstructured.Unstructured, error) {
+	if depth > maxKustomizeDepth {
+		return nil, fmt.Errorf("kustomizations are nested more than %v deep at %v", maxKustomizeDepth, dir)
+	}
+
+	kFile := findKustomization(files, dir)
+	if kFile == "" {
+		return nil, fmt.Errorf("no kustomization file found in directory %v of the manifest archive", dir)
+	}
+
+	var k kustomization
+	if jBytes, err := utilyaml.ToJSON([]byte(files[kFile])); err != nil {
+		return nil, fmt.Errorf("unable to read %v: %v", kFile, err)
+	} else if err := json.Unmarshal(jBytes, &k); err != nil {
+		return nil, fmt.Errorf("unable to read %v: %v", kFile, err)
+	}
+
+	// Load the resources, which are either files or directories with a kustomization.
+	objs := []*unstructured.Unstructured{}
+	for _, res := range append(k.Bases, k.Resources...) {
+		resPath := path.Join(dir, res)
+		if body, ok := files[resPath]; ok {
+			if resObjs, err := decodeManifests(resPath, body); err != nil {
+				return nil, err
+			} else {
+				objs = append(objs, resObjs...)
+			}
+		} else if findKustomization(files, resPath) != "" {
+			if resObjs, err := kustomize(files, resPath, depth+1); err != nil {
+				return nil, err
+			} else {
+				objs = append(objs, resObjs...)
+			}
+		} else {
+			return nil, fmt.Errorf("resource %v of %v is not in the manifest archive", res, kFile)
+		}
+	}
+
+	// Patch the objects with the same kind and name as the patch.
+	for _, patchFile := range k.PatchesStrategicMerge {
+		patchPath := path.Join(dir, patchFile)
+		body, ok := files[patchPath]
+		if !ok {
+			return nil, fmt.Errorf("patch %v of %v is not in the manifest archive", patchFile, kFile)
+		}
+		patches, err := decodeManifests(patchPath, body)
+		if err != nil {
+			return nil, err
+		}
+		for _, patch := range patches {
+			patched := false
+			for _, obj := range objs {
+				if obj.GetKind() == patch.GetKind() && obj.GetName() == patch.GetName() {
+					if err := strategicMerge(obj, patch); err != nil {
+						return nil, fmt.Errorf("unable to apply patch %v to %v %v: %v", patchFile, obj.GetKind(), obj.GetName(), err)
+					}
+					patched = true
+				}
+			}
+			if !patched {
+				return nil, fmt.Errorf("patch %v does not match any %v named %v", patchFile, patch.GetKind(), patch.GetName())
+			}
+		}
+	}
+
+	renamed := nameMap{}
+	for _, obj := range objs {
+		for _, img := range k.Images {
+			setImages(obj.Object, img)
+		}
+		if len(k.CommonLabels) != 0 {
+			addCommonLabels(obj, k.CommonLabels)
+		}
+		if len(k.CommonAnnotations) != 0 {
+			addCommonAnnotations(obj, k.CommonAnnotations)
+		}
+		if obj.GetKind() != K8S_NAMESPACE_TYPE && obj.GetKind() != K8S_CRD_TYPE && (k.NamePrefix != "" || k.NameSuffix != "") {
+			renamed.add(obj.GetKind(), obj.GetName(), k.NamePrefix+obj.GetName()+k.NameSuffix)
+			obj.SetName(k.NamePrefix + obj.GetName() + k.NameSuffix)
+		}
+	}
+
+	// Objects that refer to a renamed object by name have to use its new name.
+	if len(renamed) != 0 {
+		for _, obj := range objs {
+			renamed.updateReferences(obj)
+		}
+	}
+
+	return objs, nil
+}
+
+// Merge the patch into the object with a strategic merge patch, which uses the patch strategy of the fields of the
+// kubernetes type of the object. Lists of containers, for example, are merged by the container name. Objects of kinds
+// that the agent does not know, like custom resources, have no patch strategy and get a JSON merge patch, as they
+// would with kustomize.
+func strategicMerge(obj *unstructured.Unstructured, patch *unstructured.Unstructured) error {
+	typed, err := scheme.Scheme.New(obj.GroupVersionKind())
+	if err != nil {
+		obj.Object = mergePatch(obj.Object, patch.Object).(map[string]interface{})
+		return nil
+	}
+
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(typed)
+	if err != nil {
+		return err
+	}
+	merged, err := strategicpatch.StrategicMergeMapPatchUsingLookupPatchMeta(obj.Object, patch.Object, patchMeta)
+	if err != nil {
+		return err
+	}
+	obj.Object = merged
+	return nil
+}
+
+// Merge the patch into the object, the way a JSON merge patch does. Lists in the patch replace the lists of the object,
+// and null values remove the field.
+func mergePatch(obj interface{}, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	objMap, ok := obj.(map[string]interface{})
+	if !ok {
+		objMap = map[string]interface{}{}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(objMap, key)
+		} else {
+			objMap[key] = mergePatch(objMap[key], value)
+		}
+	}
+	return objMap
+}
+
+// The new names of the objects renamed by a name prefix or suffix, by kind and old name.
+type nameMap map[string]map[string]string
+
+func (n nameMap) add(kind string, oldName string, newName string) {
+	if n[kind] == nil {
+		n[kind] = map[string]string{}
+	}
+	n[kind][oldName] = newName
+}
+
+// Replace the name in the field of the object with the new name, when the field names a renamed object of the kind.
+func (n nameMap) rename(m map[string]interface{}, kind string, fields ...string) {
+	if name, found, _ := unstructured.NestedString(m, fields...); found {
+		if newName, ok := n[kind][name]; ok {
+			unstructured.SetNestedField(m, newName, fields...)
+		}
+	}
+}
+
+// Call the function on every object of the list in the field.
+func forEachMap(m map[string]interface{}, field string, fn func(map[string]interface{})) {
+	if list, ok := m[field].([]interface{}); ok {
+		for _, e := range list {
+			if em, ok := e.(map[string]interface{}); ok {
+				fn(em)
+			}
+		}
+	}
+}
+
+// Update the references of the object to renamed objects. These are the references that kustomize updates for the
+// built-in kinds: the config maps, secrets, service accounts and persistent volume claims used by pods, the roles and
+// service accounts of role bindings, the service of a stateful set, the services and secrets of an ingress, the target
+// of a horizontal pod autoscaler and the volume of a persistent volume claim.
+func (n nameMap) updateReferences(obj *unstructured.Unstructured) {
+	o := obj.Object
+	if spec, ok := podSpec(obj); ok {
+		n.updatePodSpecReferences(spec)
+	}
+
+	switch obj.GetKind() {
+	case "StatefulSet":
+		n.rename(o, "Service", "spec", "serviceName")
+	case "RoleBinding", "ClusterRoleBinding":
+		if roleKind, _, _ := unstructured.NestedString(o, "roleRef", "kind"); roleKind != "" {
+			n.rename(o, roleKind, "roleRef", "name")
+		}
+		forEachMap(o, "subjects", func(subject map[string]interface{}) {
+			if subject["kind"] == "ServiceAccount" {
+				n.rename(subject, "ServiceAccount", "name")
+			}
+		})
+	case "ServiceAccount":
+		forEachMap(o, "secrets", func(s map[string]interface{}) { n.rename(s, "Secret", "name") })
+		forEachMap(o, "imagePullSecrets", func(s map[string]interface{}) { n.rename(s, "Secret", "name") })
+	case "Ingress":
+		spec, ok := nestedMapNoCopy(o, "spec")
+		if !ok {
+			return
+		}
+		n.updateBackendReferences(spec, "backend")
+		n.updateBackendReferences(spec, "defaultBackend")
+		forEachMap(spec, "tls", func(tls map[string]interface{}) { n.rename(tls, "Secret", "secretName") })
+		forEachMap(spec, "rules", func(rule map[string]interface{}) {
+			if http, ok := rule["http"].(map[string]interface{}); ok {
+				forEachMap(http, "paths", func(p map[string]interface{}) { n.updateBackendReferences(p, "backend") })
+			}
+		})
+	case "HorizontalPodAutoscaler":
+		if targetKind, _, _ := unstructured.NestedString(o, "spec", "scaleTargetRef", "kind"); targetKind != "" {
+			n.rename(o, targetKind, "spec", "scaleTargetRef", "name")
+		}
+	case "PersistentVolumeClaim":
+		n.rename(o, "PersistentVolume", "spec", "volumeName")
+	}
+}
+
+// Update the service of an ingress backend, in the extensions/v1beta1 and in the networking.k8s.io/v1 format.
+func (n nameMap) updateBackendReferences(m map[string]interface{}, field string) {
+	if backend, ok := m[field].(map[string]interface{}); ok {
+		n.rename(backend, "Service", "serviceName")
+		n.rename(backend, "Service", "service", "name")
+	}
+}
+
+func (n nameMap) updatePodSpecReferences(spec map[string]interface{}) {
+	n.rename(spec, "ServiceAccount", "serviceAccountName")
+	n.rename(spec, "ServiceAccount", "serviceAccount")
+	forEachMap(spec, "imagePullSecrets", func(s map[string]interface{}) { n.rename(s, "Secret", "name") })
+
+	forEachMap(spec, "volumes", func(v map[string]interface{}) {
+		n.rename(v, "ConfigMap", "configMap", "name")
+		n.rename(v, "Secret", "secret", "secretName")
+		n.rename(v, "PersistentVolumeClaim", "persistentVolumeClaim", "claimName")
+		if projected, ok := v["projected"].(map[string]interface{}); ok {
+			forEachMap(projected, "sources", func(src map[string]interface{}) {
+				n.rename(src, "ConfigMap", "configMap", "name")
+				n.rename(src, "Secret", "secret", "name")
+			})
+		}
+	})
+
+	for _, field := range []string{"containers", "initContainers"} {
+		forEachMap(spec, field, func(c map[string]interface{}) {
+			forEachMap(c, "envFrom", func(e map[string]interface{}) {
+				n.rename(e, "ConfigMap", "configMapRef", "name")
+				n.rename(e, "Secret", "secretRef", "name")
+			})
+			forEachMap(c, "env", func(e map[string]interface{}) {
+				n.rename(e, "ConfigMap", "valueFrom", "configMapKeyRef", "name")
+				n.rename(e, "Secret", "valueFrom", "secretKeyRef", "name")
+			})
+		})
+	}
+}
+
+// Returns the pod spec of the object, which is the spec of a pod, the spec of the pod template of a workload, or the
+// spec of the pod template of the job template of a cron job.
+func podSpec(obj *unstructured.Unstructured) (map[string]interface{}, bool) {
+	var fields []string
+	switch obj.GetKind() {
+	case "Pod":
+		fields = []string{"spec"}
+	case "CronJob":
+		fields = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		fields = []string{"spec", "template", "spec"}
+	}
+
+	return nestedMapNoCopy(obj.Object, fields...)
+}
+
+// Returns the map in the nested field, without copying it, so that it can be changed in place.
+func nestedMapNoCopy(m map[string]interface{}, fields ...string) (map[string]interface{}, bool) {
+	for _, field := range fields {
+		next, ok := m[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	return m, true
+}
+
+// Replace the image of every container that uses the image name.
+func setImages(obj interface{}, img kustomizeImage) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range o {
+			if containers, ok := value.([]interface{}); ok && (key == "containers" || key == "initContainers") {
+				for _, c := range containers {
+					if container, ok := c.(map[string]interface{}); ok {
+						if image, ok := container["image"].(string); ok {
+							container["image"] = replaceImage(image, img)
+						}
+					}
+				}
+			} else {
+				setImages(value, img)
+			}
+		}
+	case []interface{}:
+		for _, value := range o {
+			setImages(value, img)
+		}
+	}
+}
+
+// Returns the image with the name, tag and digest of the kustomization image, when the image has its name.
+func replaceImage(image string, img kustomizeImage) string {
+	name, ref := image, ""
+	if i := strings.Index(name, "@"); i != -1 {
+		name, ref = image[:i], image[i:]
+	} else if i := strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i:], "/") {
+		name, ref = image[:i], image[i:]
+	}
+	if name != img.Name {
+		return image
+	}
+
+	if img.NewName != "" {
+		name = img.NewName
+	}
+	if img.Digest != "" {
+		ref = "@" + img.Digest
+	} else if img.NewTag != "" {
+		ref = ":" + img.NewTag
+	}
+	return name + ref
+}
+
+// Add the labels to the object, and to the selectors and pod templates of workloads and services.
+func addCommonLabels(obj *unstructured.Unstructured, labels map[string]string) {
+	obj.SetLabels(mergeStringMaps(obj.GetLabels(), labels))
+
+	if obj.GetKind() == "Service" {
+		selector, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector")
+		unstructured.SetNestedStringMap(obj.Object, mergeStringMaps(selector, labels), "spec", "selector")
+	} else if _, found, _ := unstructured.NestedMap(obj.Object, "spec", "template"); found {
+		if obj.GetKind() != "Job" {
+			matchLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+			unstructured.SetNestedStringMap(obj.Object, mergeStringMaps(matchLabels, labels), "spec", "selector", "matchLabels")
+		}
+		templateLabels, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "labels")
+		unstructured.SetNestedStringMap(obj.Object, mergeStringMaps(templateLabels, labels), "spec", "template", "metadata", "labels")
+	}
+}
+
+// Add the annotations to the object, and to the pod template of workloads.
+func addCommonAnnotations(obj *unstructured.Unstructured, annotations map[string]string) {
+	obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), annotations))
+
+	if _, found, _ := unstructured.NestedMap(obj.Object, "spec", "template"); found {
+		templateAnnotations, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "annotations")
+		unstructured.SetNestedStringMap(obj.Object, mergeStringMaps(templateAnnotations, annotations), "spec", "template", "metadata", "annotations")
+	}
+}
+
+func mergeStringMaps(m map[string]string, add map[string]string) map[string]string {
+	ret := make(map[string]string, len(m)+len(add))
+	for k, v := range m {
+		ret[k] = v
+	}
+	for k, v := range add {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Decode the yaml or json documents of a manifest file into kubernetes objects.
+func decodeManifests(fileName string, body string) ([]*unstructured.Unstructured, error) {
+	objs := []*unstructured.Unstructured{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(body), 4096)
+	for {
+		// decode to json first, so that whole numbers become int64 like in the objects of the api server
+		var raw json.RawMessage
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to decode %v: %v", fileName, err)
+		} else if err := utiljson.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("unable to decode %v: %v", fileName, err)
+		} else if len(obj) == 0 {
+			continue
+		}
+
+		u := &unstructured.Unstructured{Object: obj}
+		if u.GetAPIVersion() == "" || u.GetKind() == "" {
+			return nil, fmt.Errorf("object in %v must have an apiVersion and a kind", fileName)
+		} else if u.GetName() == "" {
+			return nil, fmt.Errorf("%v object in %v must have a name in its metadata section", u.GetKind(), fileName)
+		}
+		objs = append(objs, u)
+	}
+	return objs, nil
+}
+
+// Returns the objects of the manifest files, which are all the yaml and json files of the archive in the order of their
+// names, or the objects that the kustomization in the overlay directory builds. The kustomization at the top of the
+// archive is used when there is no overlay.
+func renderManifests(files map[string]string, overlay string) ([]*unstructured.Unstructured, error) {
+	if overlay != "" {
+		return kustomize(files, path.Clean(overlay), 0)
+	} else if findKustomization(files, ".") != "" {
+		return kustomize(files, ".", 0)
+	}
+
+	names := []string{}
+	for name, _ := range files {
+		if ext := path.Ext(name); ext == ".yaml" || ext == ".yml" || ext == ".json" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	objs := []*unstructured.Unstructured{}
+	for _, name := range names {
+		if fileObjs, err := decodeManifests(name, files[name]); err != nil {
+			return nil, err
+		} else {
+			objs = append(objs, fileObjs...)
+		}
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("the manifest archive has no kubernetes objects")
+	}
+	return objs, nil
+}
@@ -0,0 +1,379 @@
+package kube_operator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/persistence"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	dynamic "k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Prefix of the namespace that the manifests of an agreement are applied in
+	MANIFEST_NAMESPACE_PREFIX = "hzn-"
+	// Field manager of the server-side apply of the manifests
+	MANIFEST_FIELD_MANAGER = "openhorizon-agent"
+	// Label on every object that is applied for an agreement
+	MANIFEST_AGREEMENT_LABEL = "openhorizon.anax/agreement_id"
+
+	MANIFEST_STATE_READY   = "Ready"
+	MANIFEST_STATE_CREATED = "Created"
+	MANIFEST_STATE_MISSING = "Missing"
+	MANIFEST_STATE_FAILED  = "Failed"
+)
+
+// The order in which the kinds of objects are applied. Kinds that are not listed, like custom resources, are applied
+// after these in the order of the manifests. The objects are removed in the reverse order.
+var manifestKindOrder = []string{
+	K8S_NAMESPACE_TYPE,
+	K8S_CRD_TYPE,
+	"ResourceQuota",
+	"LimitRange",
+	K8S_SERVICEACCOUNT_TYPE,
+	"Secret",
+	"ConfigMap",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	K8S_ROLE_TYPE,
+	K8S_ROLEBINDING_TYPE,
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicaSet",
+	K8S_DEPLOYMENT_TYPE,
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+}
+
+// Client that applies plain kubernetes manifests with server-side apply
+type ManifestClient struct {
+	KubeClient
+	Dynamic dynamic.Interface
+	Mapper  *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// ObjectStatus is the state of one of the objects of a manifest deployment
+type ObjectStatus struct {
+	Kind        string
+	Name        string
+	Namespace   string
+	State       string
+	CreatedTime int64
+}
+
+func NewManifestClient() (*ManifestClient, error) {
+	kc, err := NewKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	return newManifestClient(*kc)
+}
+
+// newManifestClient returns a client with a dynamic client and a cached rest mapper next to the kube client
+func newManifestClient(kc KubeClient) (*ManifestClient, error) {
+	dc, err := NewDynamicKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kc.Client.Discovery()))
+	return &ManifestClient{KubeClient: kc, Dynamic: dc, Mapper: mapper}, nil
+}
+
+// ManifestNamespace returns the namespace that the manifests of the agreement are applied in
+func ManifestNamespace(agId string) string {
+	// namespace names are at most 63 characters
+	if len(agId) > 63-len(MANIFEST_NAMESPACE_PREFIX) {
+		agId = agId[:63-len(MANIFEST_NAMESPACE_PREFIX)]
+	}
+	return MANIFEST_NAMESPACE_PREFIX + strings.ToLower(agId)
+}
+
+// RenderManifests returns the objects of the manifests in the base64 encoded tar.gz archive, in the order they are applied
+func RenderManifests(archive string, overlay string) ([]*unstructured.Unstructured, error) {
+	yamls, err := getYamlFromTarGz(archive)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the manifest archive: %v", err)
+	}
+
+	files := make(map[string]string, len(yamls))
+	for _, y := range yamls {
+		files[path.Clean(strings.TrimPrefix(y.Header.Name, "./"))] = y.Body
+	}
+
+	objs, err := renderManifests(files, overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(objs, func(i, j int) bool {
+		return kindRank(objs[i].GetKind()) < kindRank(objs[j].GetKind())
+	})
+	return objs, nil
+}
+
+func kindRank(kind string) int {
+	for i, k := range manifestKindOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(manifestKindOrder)
+}
+
+// processManifests returns the objects of the deployment labeled with the agreement id, preceded by the agreement namespace, and the namespace
+func processManifests(md *persistence.ManifestDeploymentConfig, agId string) ([]*unstructured.Unstructured, string, error) {
+	objs, err := RenderManifests(md.ManifestArchive, md.KustomizeOverlay)
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace := ManifestNamespace(agId)
+	nsObj := &unstructured.Unstructured{}
+	nsObj.SetAPIVersion("v1")
+	nsObj.SetKind(K8S_NAMESPACE_TYPE)
+	nsObj.SetName(namespace)
+
+	objs = append([]*unstructured.Unstructured{nsObj}, objs...)
+	for _, obj := range objs {
+		obj.SetLabels(mergeStringMaps(obj.GetLabels(), map[string]string{MANIFEST_AGREEMENT_LABEL: agId}))
+	}
+	return objs, namespace, nil
+}
+
+// Install applies the objects of the manifest deployment in the agreement namespace. The environment variables are passed
+// to the service in the hzn-env-vars config map and the secrets in the hzn-secrets secret of the namespace.
+func (c ManifestClient) Install(md *persistence.ManifestDeploymentConfig, envVars map[string]string, secretValues map[string][]byte, agId string) error {
+	objs, namespace, err := processManifests(md, agId)
+	if err != nil {
+		return err
+	}
+
+	// The namespace goes first, then the config map and secret so that the workloads can use them.
+	if err := c.apply(objs[0], namespace); err != nil {
+		return err
+	}
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetName(HZN_ENV_VARS)
+	configMap.SetLabels(map[string]string{MANIFEST_AGREEMENT_LABEL: agId})
+	data := make(map[string]interface{}, len(envVars))
+	for k, v := range envVars {
+		data[k] = v
+	}
+	configMap.Object["data"] = data
+	if err := c.apply(configMap, namespace); err != nil {
+		return err
+	}
+
+	if len(secretValues) != 0 {
+		secret := &unstructured.Unstructured{}
+		secret.SetAPIVersion("v1")
+		secret.SetKind("Secret")
+		secret.SetName(HZN_SECRETS)
+		secret.SetLabels(map[string]string{MANIFEST_AGREEMENT_LABEL: agId})
+		secretData := make(map[string]interface{}, len(secretValues))
+		for k, v := range secretValues {
+			secretData[k] = base64.StdEncoding.EncodeToString(v)
+		}
+		secret.Object["data"] = secretData
+		secret.Object["type"] = "Opaque"
+		if err := c.apply(secret, namespace); err != nil {
+			return err
+		}
+	}
+
+	for _, obj := range objs[1:] {
+		if err := c.apply(obj, namespace); err != nil {
+			return err
+		}
+	}
+
+	glog.V(3).Infof(kwlog(fmt.Sprintf("all %v manifest objects applied in namespace %v", len(objs), namespace)))
+	return nil
+}
+
+// Uninstall deletes the objects of the manifest deployment in the reverse order they were applied, and then the agreement
+// namespace with everything left in it.
+func (c ManifestClient) Uninstall(md *persistence.ManifestDeploymentConfig, agId string) error {
+	objs, namespace, err := processManifests(md, agId)
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for i := len(objs) - 1; i >= 0; i-- {
+		obj := objs[i]
+		ri, err := c.resourceFor(obj, namespace)
+		if err == nil {
+			glog.V(3).Infof(kwlog(fmt.Sprintf("deleting %v %v", obj.GetKind(), obj.GetName())))
+			err = ri.Delete(obj.GetName(), &metav1.DeleteOptions{})
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			glog.Errorf(kwlog(fmt.Sprintf("unable to delete %v %v. Error: %v", obj.GetKind(), obj.GetName(), err)))
+			failed = append(failed, fmt.Sprintf("%v %v", obj.GetKind(), obj.GetName()))
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("unable to delete %v", strings.Join(failed, ", "))
+	}
+	glog.V(3).Infof(kwlog(fmt.Sprintf("Completed removal of all manifest objects of namespace %v from the cluster.", namespace)))
+	return nil
+}
+
+// Status returns the state of every object of the manifest deployment
+func (c ManifestClient) Status(md *persistence.ManifestDeploymentConfig, agId string) ([]ObjectStatus, error) {
+	objs, namespace, err := processManifests(md, agId)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []ObjectStatus{}
+	for _, obj := range objs {
+		status, err := c.objectStatus(obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// objectStatus returns the state of the object in the cluster, which is missing when the object does not exist
+func (c ManifestClient) objectStatus(obj *unstructured.Unstructured, namespace string) (ObjectStatus, error) {
+	status := ObjectStatus{Kind: obj.GetKind(), Name: obj.GetName(), State: MANIFEST_STATE_MISSING}
+	ri, err := c.resourceFor(obj, namespace)
+	if err != nil {
+		return status, err
+	}
+	if current, err := ri.Get(obj.GetName(), metav1.GetOptions{}); err == nil {
+		status.Namespace = current.GetNamespace()
+		status.State = objectState(current)
+		status.CreatedTime = current.GetCreationTimestamp().Unix()
+	} else if !errors.IsNotFound(err) {
+		return status, fmt.Errorf(kwlog(fmt.Sprintf("Error getting the status of %v %v: %v", obj.GetKind(), obj.GetName(), err)))
+	}
+	return status, nil
+}
+
+// waitForReady waits until the object is ready, for at most the timeout in seconds
+func (c ManifestClient) waitForReady(obj *unstructured.Unstructured, namespace string, timeout int) error {
+	for i := 0; ; i++ {
+		status, err := c.objectStatus(obj, namespace)
+		if err != nil {
+			return err
+		} else if status.State == MANIFEST_STATE_READY {
+			return nil
+		} else if i >= timeout {
+			return fmt.Errorf(kwlog(fmt.Sprintf("Error: %v %v is not ready after %v seconds, it is %v", obj.GetKind(), obj.GetName(), timeout, status.State)))
+		}
+		glog.V(5).Infof(kwlog(fmt.Sprintf("waiting for %v %v to be ready, it is %v", obj.GetKind(), obj.GetName(), status.State)))
+		time.Sleep(time.Second)
+	}
+}
+
+// apply creates or updates the object with a server-side apply. Namespaced objects are put in the agreement namespace.
+func (c ManifestClient) apply(obj *unstructured.Unstructured, namespace string) error {
+	ri, err := c.resourceFor(obj, namespace)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf(kwlog(fmt.Sprintf("Error marshaling %v %v: %v", obj.GetKind(), obj.GetName(), err)))
+	}
+
+	glog.V(3).Infof(kwlog(fmt.Sprintf("applying %v %v", obj.GetKind(), obj.GetName())))
+	force := true
+	if _, err := ri.Patch(obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: MANIFEST_FIELD_MANAGER, Force: &force}); err != nil {
+		return fmt.Errorf(kwlog(fmt.Sprintf("Error applying %v %v: %v", obj.GetKind(), obj.GetName(), err)))
+	}
+	return nil
+}
+
+// resourceFor returns the dynamic client of the kind of the object. The namespace of namespaced objects is set to the
+// agreement namespace.
+func (c ManifestClient) resourceFor(obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// the kind might be defined by a CRD that was just applied
+		c.Mapper.Reset()
+		mapping, err = c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(kwlog(fmt.Sprintf("Error finding the resource of %v %v: %v", obj.GetKind(), obj.GetName(), err)))
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		obj.SetNamespace(namespace)
+		return c.Dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return c.Dynamic.Resource(mapping.Resource), nil
+}
+
+// objectState returns whether a workload or a CRD is ready, or the phase of pods and volume claims. Other objects are just created.
+func objectState(obj *unstructured.Unstructured) string {
+	switch obj.GetKind() {
+	case K8S_DEPLOYMENT_TYPE, "StatefulSet", "ReplicaSet":
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+		if ready >= replicas {
+			return MANIFEST_STATE_READY
+		}
+		return fmt.Sprintf("Progressing, %v of %v replicas ready", ready, replicas)
+	case "DaemonSet":
+		desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+		ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberReady")
+		if ready >= desired {
+			return MANIFEST_STATE_READY
+		}
+		return fmt.Sprintf("Progressing, %v of %v pods ready", ready, desired)
+	case "Job":
+		if succeeded, _, _ := unstructured.NestedInt64(obj.Object, "status", "succeeded"); succeeded > 0 {
+			return "Complete"
+		}
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, c := range conditions {
+			if cond, ok := c.(map[string]interface{}); ok && cond["type"] == "Failed" && cond["status"] == "True" {
+				return MANIFEST_STATE_FAILED
+			}
+		}
+		return "Running"
+	case K8S_CRD_TYPE:
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, c := range conditions {
+			if cond, ok := c.(map[string]interface{}); ok && cond["type"] == "Established" && cond["status"] == "True" {
+				return MANIFEST_STATE_READY
+			}
+		}
+		return "Establishing"
+	case "Pod", "PersistentVolumeClaim":
+		if phase, found, _ := unstructured.NestedString(obj.Object, "status", "phase"); found {
+			return phase
+		}
+	}
+	return MANIFEST_STATE_CREATED
+}
@@ -0,0 +1,277 @@
+// +build unit
+
+package kube_operator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"github.com/open-horizon/anax/persistence"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+// Returns the base64 encoded tar.gz archive of the files.
+func testArchive(t *testing.T, files map[string]string) string {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		} else if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.19
+`
+
+const testService = `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+  ports:
+  - port: 80
+`
+
+func Test_RenderManifests_plain(t *testing.T) {
+	archive := testArchive(t, map[string]string{
+		"./app/deployment.yaml": testDeployment,
+		"app/service.yaml":      testService + "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web-config\ndata:\n  a: b\n",
+		"README.md":             "not a manifest",
+	})
+
+	objs, err := RenderManifests(archive, "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if len(objs) != 3 {
+		t.Fatalf("expected 3 objects, got %v", len(objs))
+	}
+
+	// config maps go before services, services before deployments
+	for i, kind := range []string{"ConfigMap", "Service", "Deployment"} {
+		if objs[i].GetKind() != kind {
+			t.Errorf("expected %v at %v, got %v", kind, i, objs[i].GetKind())
+		}
+	}
+}
+
+func Test_RenderManifests_errors(t *testing.T) {
+	if _, err := RenderManifests(testArchive(t, map[string]string{"a.yaml": "kind: ConfigMap\nmetadata:\n  name: x\n"}), ""); err == nil {
+		t.Errorf("expected an error for an object without an apiVersion")
+	} else if _, err := RenderManifests(testArchive(t, map[string]string{"a.yaml": "apiVersion: v1\nkind: ConfigMap\n"}), ""); err == nil {
+		t.Errorf("expected an error for an object without a name")
+	} else if _, err := RenderManifests(testArchive(t, map[string]string{"README.md": "nothing"}), ""); err == nil {
+		t.Errorf("expected an error for an archive without objects")
+	} else if _, err := RenderManifests(testArchive(t, map[string]string{"a.yaml": testService}), "overlays/prod"); err == nil {
+		t.Errorf("expected an error for a missing overlay")
+	}
+}
+
+func Test_RenderManifests_kustomize(t *testing.T) {
+	archive := testArchive(t, map[string]string{
+		"base/kustomization.yaml": "resources:\n- deployment.yaml\n- service.yaml\n",
+		"base/deployment.yaml":    testDeployment,
+		"base/service.yaml":       testService,
+		"overlays/prod/kustomization.yaml": `resources:
+- ../../base
+namePrefix: prod-
+commonLabels:
+  env: prod
+commonAnnotations:
+  owner: team
+images:
+- name: nginx
+  newTag: "1.20"
+patchesStrategicMerge:
+- replicas.yaml
+`,
+		"overlays/prod/replicas.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 5\n",
+	})
+
+	objs, err := RenderManifests(archive, "overlays/prod/")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if len(objs) != 2 {
+		t.Fatalf("expected 2 objects, got %v", len(objs))
+	}
+
+	svc, dep := objs[0], objs[1]
+	if svc.GetName() != "prod-web" || dep.GetName() != "prod-web" {
+		t.Errorf("expected prefixed names, got %v and %v", svc.GetName(), dep.GetName())
+	}
+	if svc.GetLabels()["env"] != "prod" || dep.GetAnnotations()["owner"] != "team" {
+		t.Errorf("expected common labels and annotations, got %v and %v", svc.GetLabels(), dep.GetAnnotations())
+	}
+	if selector, _, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector"); selector["env"] != "prod" || selector["app"] != "web" {
+		t.Errorf("expected the service selector to have the common labels, got %v", selector)
+	}
+	if labels, _, _ := unstructured.NestedStringMap(dep.Object, "spec", "template", "metadata", "labels"); labels["env"] != "prod" {
+		t.Errorf("expected the pod template to have the common labels, got %v", labels)
+	}
+	if replicas, _, _ := unstructured.NestedInt64(dep.Object, "spec", "replicas"); replicas != 5 {
+		t.Errorf("expected the patched replicas, got %v", replicas)
+	}
+	containers, _, _ := unstructured.NestedSlice(dep.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 1 || containers[0].(map[string]interface{})["image"] != "nginx:1.20" {
+		t.Errorf("expected the image tag to be replaced, got %v", containers)
+	}
+}
+
+func Test_RenderManifests_kustomize_patchesAndReferences(t *testing.T) {
+	archive := testArchive(t, map[string]string{
+		"kustomization.yaml": `resources:
+- deployment.yaml
+- config.yaml
+nameSuffix: -v2
+patchesStrategicMerge:
+- env.yaml
+`,
+		"deployment.yaml": testDeployment + `        envFrom:
+        - configMapRef:
+            name: web-config
+      - name: sidecar
+        image: busybox
+      volumes:
+      - name: config
+        configMap:
+          name: web-config
+      - name: other
+        configMap:
+          name: not-in-archive
+`,
+		"config.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web-config\ndata:\n  a: b\n",
+		"env.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        env:
+        - name: MODE
+          value: prod
+`,
+	})
+
+	objs, err := RenderManifests(archive, "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if len(objs) != 2 {
+		t.Fatalf("expected 2 objects, got %v", len(objs))
+	}
+
+	cm, dep := objs[0], objs[1]
+	if cm.GetName() != "web-config-v2" || dep.GetName() != "web-v2" {
+		t.Errorf("expected suffixed names, got %v and %v", cm.GetName(), dep.GetName())
+	}
+
+	// The patch is merged into the web container, the other container is kept.
+	containers, _, _ := unstructured.NestedSlice(dep.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 2 {
+		t.Fatalf("expected the patch to keep both containers, got %v", containers)
+	}
+	web := &unstructured.Unstructured{Object: containers[0].(map[string]interface{})}
+	if image, _, _ := unstructured.NestedString(web.Object, "image"); image != "nginx:1.19" {
+		t.Errorf("expected the patch to keep the image, got %v", web.Object)
+	} else if env, _, _ := unstructured.NestedSlice(web.Object, "env"); len(env) != 1 {
+		t.Errorf("expected the patched env, got %v", web.Object)
+	} else if envFrom, _, _ := unstructured.NestedSlice(web.Object, "envFrom"); len(envFrom) != 1 || envFrom[0].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"] != "web-config-v2" {
+		t.Errorf("expected the config map reference to be renamed, got %v", envFrom)
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(dep.Object, "spec", "template", "spec", "volumes")
+	if len(volumes) != 2 {
+		t.Fatalf("expected 2 volumes, got %v", volumes)
+	} else if name, _, _ := unstructured.NestedString(volumes[0].(map[string]interface{}), "configMap", "name"); name != "web-config-v2" {
+		t.Errorf("expected the config map volume to be renamed, got %v", name)
+	} else if name, _, _ := unstructured.NestedString(volumes[1].(map[string]interface{}), "configMap", "name"); name != "not-in-archive" {
+		t.Errorf("expected a reference to an object outside the kustomization to be kept, got %v", name)
+	}
+}
+
+func Test_replaceImage(t *testing.T) {
+	tests := []struct {
+		image    string
+		img      kustomizeImage
+		expected string
+	}{
+		{"nginx", kustomizeImage{Name: "nginx", NewTag: "1.20"}, "nginx:1.20"},
+		{"nginx:1.19", kustomizeImage{Name: "nginx", NewName: "my.registry:5000/nginx"}, "my.registry:5000/nginx:1.19"},
+		{"my.registry:5000/nginx:1.19", kustomizeImage{Name: "my.registry:5000/nginx", Digest: "sha256:abc"}, "my.registry:5000/nginx@sha256:abc"},
+		{"redis:6", kustomizeImage{Name: "nginx", NewTag: "1.20"}, "redis:6"},
+	}
+
+	for _, test := range tests {
+		if image := replaceImage(test.image, test.img); image != test.expected {
+			t.Errorf("image %v with %v is %v, expected %v", test.image, test.img, image, test.expected)
+		}
+	}
+}
+
+func Test_processManifests(t *testing.T) {
+	agId := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	md := &persistence.ManifestDeploymentConfig{ManifestArchive: testArchive(t, map[string]string{"svc.yaml": testService})}
+
+	objs, namespace, err := processManifests(md, agId)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if len(namespace) > 63 || namespace != ManifestNamespace(agId) {
+		t.Errorf("unexpected namespace %v", namespace)
+	} else if len(objs) != 2 || objs[0].GetKind() != K8S_NAMESPACE_TYPE || objs[0].GetName() != namespace {
+		t.Errorf("expected the namespace first, got %v", objs)
+	}
+
+	for _, obj := range objs {
+		if obj.GetLabels()[MANIFEST_AGREEMENT_LABEL] != agId {
+			t.Errorf("%v %v is not labeled with the agreement id", obj.GetKind(), obj.GetName())
+		}
+	}
+}
+
+func Test_objectState(t *testing.T) {
+	dep := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":   "Deployment",
+		"spec":   map[string]interface{}{"replicas": int64(2)},
+		"status": map[string]interface{}{"readyReplicas": int64(1)},
+	}}
+	if state := objectState(dep); state == MANIFEST_STATE_READY {
+		t.Errorf("expected a deployment with 1 of 2 replicas to be progressing")
+	}
+	unstructured.SetNestedField(dep.Object, int64(2), "status", "readyReplicas")
+	if state := objectState(dep); state != MANIFEST_STATE_READY {
+		t.Errorf("expected a ready deployment, got %v", state)
+	}
+
+	cm := &unstructured.Unstructured{Object: map[string]interface{}{"kind": "ConfigMap"}}
+	if state := objectState(cm); state != MANIFEST_STATE_CREATED {
+		t.Errorf("expected a created config map, got %v", state)
+	}
+}
@@ -10,11 +10,13 @@ import (
 	agbotPersistence "github.com/open-horizon/anax/agreementbot/persistence"
 	_ "github.com/open-horizon/anax/agreementbot/persistence/bolt"
 	_ "github.com/open-horizon/anax/agreementbot/persistence/postgresql"
+	_ "github.com/open-horizon/anax/agreementbot/persistence/sqlite"
 	"github.com/open-horizon/anax/api"
 	"github.com/open-horizon/anax/changes"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/exchange"
+	_ "github.com/open-horizon/anax/externalpolicy/cel_language"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"github.com/open-horizon/anax/governance"
 	"github.com/open-horizon/anax/i18n"
@@ -80,6 +82,11 @@ func main() {
 			panic(err)
 		}
 		db = edgeDB
+
+		// Encrypt the sensitive records in the database, or decrypt them if encryption was turned off.
+		if err := persistence.InitDBEncryption(db, cfg.Edge.DBPath, cfg.Edge.DBEncryption, cfg.Edge.DBKeyRotationDays); err != nil {
+			panic(err)
+		}
 	}
 
 	// open Agreement Bot DB if necessary
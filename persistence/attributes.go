@@ -249,9 +249,10 @@ func FindAttributeByKey(db *bolt.DB, id string) (*Attribute, error) {
 		bucket = tx.Bucket([]byte(ATTRIBUTES))
 		if bucket != nil {
 
-			v := bucket.Get([]byte(id))
-			if v != nil {
-				var err error
+			v, err := openRecord(ATTRIBUTES, []byte(id), bucket.Get([]byte(id)))
+			if err != nil {
+				return err
+			} else if v != nil {
 				attr, err = HydrateConcreteAttribute(v)
 				if err != nil {
 					return err
@@ -293,6 +294,10 @@ func FindApplicableAttributes(db *bolt.DB, serviceUrl string, org string) ([]Att
 		}
 
 		return bucket.ForEach(func(k, v []byte) error {
+			v, err := openRecord(ATTRIBUTES, k, v)
+			if err != nil {
+				return err
+			}
 			attr, err := HydrateConcreteAttribute(v)
 			if err != nil {
 				return err
@@ -514,6 +519,9 @@ func SaveOrUpdateAttribute(db *bolt.DB, attr Attribute, id string, permitPartial
 		if err != nil {
 			return fmt.Errorf("Failed to serialize attribute: %v. Error: %v", ret, err)
 		}
+		if serial, err = sealRecord(ATTRIBUTES, []byte(id), serial); err != nil {
+			return fmt.Errorf("Failed to encrypt attribute %v. Error: %v", id, err)
+		}
 		return bucket.Put([]byte(id), serial)
 	})
 
@@ -0,0 +1,125 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// container restart table name
+const CONTAINER_RESTARTS = "container_restarts"
+
+// The restarts of a service container that has a restart policy. The agent restarts the container itself, so that the
+// agreement or the service instance that the container belongs to is kept. The record is removed with the container.
+type ContainerRestart struct {
+	ContainerId  string `json:"container_id"` // the primary key
+	Name         string `json:"name"`
+	InstanceId   string `json:"instance_id"` // the agreement id or the service instance key
+	Restarts     int    `json:"restarts"`
+	LastExitCode int    `json:"last_exit_code"`
+	LastRestart  uint64 `json:"last_restart"`
+	Completed    bool   `json:"completed,omitempty"`  // exited successfully and the policy does not restart it
+	CrashLoop    bool   `json:"crash_loop,omitempty"` // stopped again after the restarts of the policy were used up
+}
+
+func NewContainerRestart(containerId string, name string, instanceId string) *ContainerRestart {
+	return &ContainerRestart{
+		ContainerId: containerId,
+		Name:        name,
+		InstanceId:  instanceId,
+	}
+}
+
+func (r ContainerRestart) String() string {
+	return fmt.Sprintf("ContainerId: %v, "+
+		"Name: %v, "+
+		"InstanceId: %v, "+
+		"Restarts: %v, "+
+		"LastExitCode: %v, "+
+		"LastRestart: %v, "+
+		"Completed: %v, "+
+		"CrashLoop: %v",
+		r.ContainerId, r.Name, r.InstanceId, r.Restarts, r.LastExitCode, r.LastRestart, r.Completed, r.CrashLoop)
+}
+
+// save the container restart record into db, replacing the record with the same container id.
+func SaveContainerRestart(db *bolt.DB, restart *ContainerRestart) error {
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		if bucket, err := tx.CreateBucketIfNotExists([]byte(CONTAINER_RESTARTS)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(*restart); err != nil {
+			return fmt.Errorf("Failed to serialize the container restart object: %v. Error: %v", *restart, err)
+		} else {
+			return bucket.Put([]byte(restart.ContainerId), serial)
+		}
+	})
+
+	return writeErr
+}
+
+// delete the restart record of the given container from the db.
+func DeleteContainerRestart(db *bolt.DB, containerId string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(CONTAINER_RESTARTS)); bucket == nil {
+			return nil
+		} else if err := bucket.Delete([]byte(containerId)); err != nil {
+			return fmt.Errorf("Unable to delete container restart %v: %v", containerId, err)
+		}
+		return nil
+	})
+}
+
+// find the restart record of the given container in the db, returns nil if there is none.
+func FindContainerRestart(db *bolt.DB, containerId string) (*ContainerRestart, error) {
+	var restart *ContainerRestart
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(CONTAINER_RESTARTS)); b != nil {
+			if v := b.Get([]byte(containerId)); v != nil {
+				var r ContainerRestart
+				if err := json.Unmarshal(v, &r); err != nil {
+					return fmt.Errorf("Unable to deserialize ContainerRestart db record: %v. Error: %v", v, err)
+				}
+				restart = &r
+			}
+		}
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return restart, nil
+	}
+}
+
+// find all the container restart records in the db.
+func FindContainerRestarts(db *bolt.DB) ([]ContainerRestart, error) {
+	restarts := make([]ContainerRestart, 0)
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+
+		if b := tx.Bucket([]byte(CONTAINER_RESTARTS)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+
+				var r ContainerRestart
+
+				if err := json.Unmarshal(v, &r); err != nil {
+					glog.Errorf("Unable to deserialize ContainerRestart db record: %v. Error: %v", v, err)
+				} else {
+					restarts = append(restarts, r)
+				}
+				return nil
+			})
+		}
+
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return restarts, nil
+	}
+}
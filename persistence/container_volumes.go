@@ -12,11 +12,24 @@ import (
 // container volume table name
 const CONTAINER_VOLUMES = "container_volumes"
 
+// The lifecycle of a container volume, which decides when it is deleted. The records saved before the lifecycle was
+// added have none, those volumes are retained on upgrade.
+const (
+	CV_LIFECYCLE_RETAIN_ON_UPGRADE    = "retain-on-upgrade"
+	CV_LIFECYCLE_RETAIN_ON_UNREGISTER = "retain-on-unregister"
+	CV_LIFECYCLE_DELETE               = "delete"
+)
+
 type ContainerVolume struct {
 	RecordId     string `json:"record_id"` // unique primary key for records
 	Name         string `json:"name"`
 	CreationTime uint64 `json:"creation_time"`
 	ArchiveTime  uint64 `json:"archive_time"`
+	ServiceName  string `json:"service_name,omitempty"` // the service in the deployment description that uses the volume
+	InstanceId   string `json:"instance_id,omitempty"`  // the agreement id or the service instance key that last used the volume
+	Lifecycle    string `json:"lifecycle,omitempty"`
+	Driver       string `json:"driver,omitempty"`
+	Size         string `json:"size,omitempty"` // the size quota
 }
 
 func NewContainerVolume(name string) *ContainerVolume {
@@ -31,8 +44,21 @@ func (w ContainerVolume) String() string {
 	return fmt.Sprintf("RecordId: %v, "+
 		"Name: %v, "+
 		"CreationTime: %v, "+
-		"ArchiveTime: %v",
-		w.RecordId, w.Name, w.CreationTime, w.ArchiveTime)
+		"ArchiveTime: %v, "+
+		"ServiceName: %v, "+
+		"InstanceId: %v, "+
+		"Lifecycle: %v, "+
+		"Driver: %v, "+
+		"Size: %v",
+		w.RecordId, w.Name, w.CreationTime, w.ArchiveTime, w.ServiceName, w.InstanceId, w.Lifecycle, w.Driver, w.Size)
+}
+
+// Returns the lifecycle of the volume, the volumes without one are retained on upgrade.
+func (w ContainerVolume) GetLifecycle() string {
+	if w.Lifecycle == "" {
+		return CV_LIFECYCLE_RETAIN_ON_UPGRADE
+	}
+	return w.Lifecycle
 }
 
 func (w ContainerVolume) ShortString() string {
@@ -98,6 +124,16 @@ func UnarchivedCVFilter() ContainerVolumeFilter {
 	return func(c ContainerVolume) bool { return c.ArchiveTime == 0 }
 }
 
+// filter on the agreement id or service instance key
+func InstanceCVFilter(instanceId string) ContainerVolumeFilter {
+	return func(c ContainerVolume) bool { return c.InstanceId == instanceId }
+}
+
+// filter on lifecycle
+func LifecycleCVFilter(lifecycle string) ContainerVolumeFilter {
+	return func(c ContainerVolume) bool { return c.GetLifecycle() == lifecycle }
+}
+
 // filter on name
 func NameCVFilter(name string) ContainerVolumeFilter {
 	return func(c ContainerVolume) bool { return c.Name == name }
@@ -0,0 +1,363 @@
+package persistence
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// The records in the sensitive buckets of the node database hold user input values, registry credentials and deployment
+// configs. When encryption is enabled, these records are sealed with AES-GCM before they are written to the database.
+// The encryption keys are derived from random key material held in a key store file next to the database. The newest
+// key in the store is used to seal records, older keys are kept until no record sealed with them remains.
+
+// The name of the key store file in the database directory.
+const DB_KEYSTORE_FILE = "anax.db.keys"
+
+// Sealed records start with this prefix. JSON records never start with a NUL byte, so plaintext and sealed records can
+// live side by side in a bucket.
+var sealedRecordPrefix = []byte("\x00HZNENC1")
+
+// Returns true if the records in the bucket are sealed when encryption is enabled.
+func IsSensitiveBucket(name string) bool {
+	return name == ATTRIBUTES || name == NODE_USERINPUT || strings.HasPrefix(name, E_AGREEMENTS+"-")
+}
+
+// A key in the key store. The encryption key is derived from the key material.
+type DBKey struct {
+	Id       string `json:"id"`
+	Material []byte `json:"material"`
+	Created  int64  `json:"created"`
+}
+
+func (k DBKey) String() string {
+	return fmt.Sprintf("Id: %v, Created: %v", k.Id, k.Created)
+}
+
+// The key store is a file holding the keys, oldest first.
+type DBKeyStore struct {
+	Keys []DBKey `json:"keys"`
+	path string
+}
+
+func (s DBKeyStore) String() string {
+	return fmt.Sprintf("Path: %v, Keys: %v", s.path, s.Keys)
+}
+
+// Read the key store from the file, or create a key store with a single new key if the file does not exist.
+func LoadDBKeyStore(fileName string) (*DBKeyStore, error) {
+	ks := &DBKeyStore{path: fileName}
+	if content, err := ioutil.ReadFile(fileName); os.IsNotExist(err) {
+		if _, err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+		glog.V(3).Infof(dbeLogString(fmt.Sprintf("created key store %v", fileName)))
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read key store %v, error: %v", fileName, err))
+	} else if err := json.Unmarshal(content, ks); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to demarshal key store %v, error: %v", fileName, err))
+	} else if len(ks.Keys) == 0 {
+		return nil, errors.New(fmt.Sprintf("key store %v has no keys", fileName))
+	}
+	return ks, nil
+}
+
+// Returns the key used to seal new records.
+func (s *DBKeyStore) CurrentKey() *DBKey {
+	if len(s.Keys) == 0 {
+		return nil
+	}
+	return &s.Keys[len(s.Keys)-1]
+}
+
+// Returns true if the current key is older than the input number of days. Zero days means the key is never rotated.
+func (s *DBKeyStore) RotationDue(days int, now time.Time) bool {
+	current := s.CurrentKey()
+	if days <= 0 || current == nil {
+		return false
+	}
+	return now.Sub(time.Unix(current.Created, 0)) >= time.Duration(days)*24*time.Hour
+}
+
+// Add a new key to the store and make it the current key. Records sealed with the older keys can still be opened.
+func (s *DBKeyStore) Rotate() (*DBKey, error) {
+	material := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, material); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to generate key material, error: %v", err))
+	}
+	id := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to generate key id, error: %v", err))
+	}
+
+	s.Keys = append(s.Keys, DBKey{Id: hex.EncodeToString(id), Material: material, Created: time.Now().Unix()})
+	if err := s.save(); err != nil {
+		s.Keys = s.Keys[:len(s.Keys)-1]
+		return nil, err
+	}
+	return s.CurrentKey(), nil
+}
+
+// Remove all keys except the current key. Call this only after every record has been sealed with the current key.
+func (s *DBKeyStore) PruneOldKeys() error {
+	if len(s.Keys) <= 1 {
+		return nil
+	}
+	old := s.Keys
+	s.Keys = []DBKey{*s.CurrentKey()}
+	if err := s.save(); err != nil {
+		s.Keys = old
+		return err
+	}
+	return nil
+}
+
+// Write the key store file, replacing the old file only once the new one is complete.
+func (s *DBKeyStore) save() error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to marshal key store, error: %v", err))
+	}
+	tmpFile := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return errors.New(fmt.Sprintf("unable to write key store %v, error: %v", tmpFile, err))
+	} else if err := os.Rename(tmpFile, s.path); err != nil {
+		return errors.New(fmt.Sprintf("unable to replace key store %v, error: %v", s.path, err))
+	}
+	return nil
+}
+
+// The DB cipher seals and opens records. When sealing is off, the cipher only opens records, so that records sealed
+// before encryption was turned off can still be read.
+type DBCipher struct {
+	aeads   map[string]cipher.AEAD
+	current string
+	seal    bool
+}
+
+func NewDBCipher(ks *DBKeyStore, seal bool) (*DBCipher, error) {
+	c := &DBCipher{aeads: make(map[string]cipher.AEAD), seal: seal}
+	for _, k := range ks.Keys {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, k.Material, nil, []byte("anax-bolt-"+k.Id)), key); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to derive key %v, error: %v", k.Id, err))
+		} else if block, err := aes.NewCipher(key); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to create cipher for key %v, error: %v", k.Id, err))
+		} else if aead, err := cipher.NewGCM(block); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to create GCM for key %v, error: %v", k.Id, err))
+		} else {
+			c.aeads[k.Id] = aead
+		}
+	}
+	if current := ks.CurrentKey(); current != nil {
+		c.current = current.Id
+	}
+	return c, nil
+}
+
+// Returns true if records are sealed with the current key.
+func (c *DBCipher) Sealing() bool {
+	return c.seal && c.current != ""
+}
+
+// Seal a record. The bucket and key of the record are authenticated with it, so a sealed record cannot be moved to
+// another key.
+func (c *DBCipher) Seal(bucket string, key []byte, record []byte) ([]byte, error) {
+	aead := c.aeads[c.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to generate nonce, error: %v", err))
+	}
+
+	sealed := append([]byte{}, sealedRecordPrefix...)
+	sealed = append(sealed, byte(len(c.current)))
+	sealed = append(sealed, c.current...)
+	sealed = append(sealed, nonce...)
+	return aead.Seal(sealed, nonce, record, recordAD(bucket, key)), nil
+}
+
+// Open a sealed record.
+func (c *DBCipher) Open(bucket string, key []byte, sealed []byte) ([]byte, error) {
+	keyId, rest, err := splitSealedRecord(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := c.aeads[keyId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("record %v in bucket %v is sealed with unknown key %v", string(key), bucket, keyId))
+	} else if len(rest) < aead.NonceSize() {
+		return nil, errors.New(fmt.Sprintf("record %v in bucket %v is truncated", string(key), bucket))
+	}
+	record, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], recordAD(bucket, key))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to open record %v in bucket %v, error: %v", string(key), bucket, err))
+	}
+	return record, nil
+}
+
+// Returns the id of the key that sealed the record, or an empty string for a plaintext record.
+func SealedRecordKeyId(record []byte) string {
+	if keyId, _, err := splitSealedRecord(record); err == nil {
+		return keyId
+	}
+	return ""
+}
+
+func IsSealedRecord(record []byte) bool {
+	return bytes.HasPrefix(record, sealedRecordPrefix)
+}
+
+func splitSealedRecord(sealed []byte) (string, []byte, error) {
+	if !IsSealedRecord(sealed) {
+		return "", nil, errors.New("record is not sealed")
+	}
+	rest := sealed[len(sealedRecordPrefix):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return "", nil, errors.New("sealed record is truncated")
+	}
+	return string(rest[1 : 1+int(rest[0])]), rest[1+int(rest[0]):], nil
+}
+
+func recordAD(bucket string, key []byte) []byte {
+	return []byte(bucket + "/" + string(key))
+}
+
+// The cipher used by the persistence functions, nil when the node database has no key store.
+var dbCipher *DBCipher
+
+func SetDBCipher(c *DBCipher) {
+	dbCipher = c
+}
+
+// Seal a record before it is written to a sensitive bucket, when encryption is enabled.
+func sealRecord(bucket string, key []byte, record []byte) ([]byte, error) {
+	if dbCipher == nil || !dbCipher.Sealing() {
+		return record, nil
+	}
+	return dbCipher.Seal(bucket, key, record)
+}
+
+// Open a record read from a sensitive bucket. Plaintext records are returned as they are.
+func openRecord(bucket string, key []byte, record []byte) ([]byte, error) {
+	if record == nil || !IsSealedRecord(record) {
+		return record, nil
+	} else if dbCipher == nil {
+		return nil, errors.New(fmt.Sprintf("record %v in bucket %v is encrypted but there is no database key store", string(key), bucket))
+	}
+	return dbCipher.Open(bucket, key, record)
+}
+
+// Rewrite the records in the sensitive buckets so that they match the cipher, sealing plaintext records and records
+// sealed with an older key, or opening sealed records when encryption has been turned off. This is how existing
+// records are encrypted when an upgraded agent starts with encryption enabled.
+func MigrateDBEncryption(db *bolt.DB) (int, error) {
+	if dbCipher == nil {
+		return 0, nil
+	}
+
+	count := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if !IsSensitiveBucket(string(name)) {
+				return nil
+			}
+
+			// Collect the changes first, bolt does not allow a bucket to be modified while iterating over it.
+			updates := make(map[string][]byte)
+			if err := b.ForEach(func(k, v []byte) error {
+				if v == nil {
+					return nil
+				}
+				keyId := SealedRecordKeyId(v)
+				if (dbCipher.Sealing() && keyId == dbCipher.current) || (!dbCipher.Sealing() && keyId == "") {
+					return nil
+				}
+				record, err := openRecord(string(name), k, v)
+				if err != nil {
+					return err
+				}
+				if record, err = sealRecord(string(name), k, record); err != nil {
+					return err
+				}
+				updates[string(k)] = record
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for k, v := range updates {
+				if err := b.Put([]byte(k), v); err != nil {
+					return errors.New(fmt.Sprintf("unable to rewrite record %v in bucket %v, error: %v", k, string(name), err))
+				}
+			}
+			count += len(updates)
+			return nil
+		})
+	})
+	return count, err
+}
+
+// Set up the encryption of the sensitive records in the node database and bring the existing records in line with it.
+// The key store is created when encryption is enabled. When encryption is disabled, an existing key store is still used
+// to open the records sealed earlier so that they can be rewritten as plaintext. The current key is rotated once it is
+// older than rotationDays, after which the records are sealed with the new key and the old keys are removed.
+func InitDBEncryption(db *bolt.DB, dbPath string, enabled bool, rotationDays int) error {
+	if db == nil {
+		return nil
+	}
+
+	keyStoreFile := path.Join(dbPath, DB_KEYSTORE_FILE)
+	if _, err := os.Stat(keyStoreFile); os.IsNotExist(err) && !enabled {
+		return nil
+	}
+
+	ks, err := LoadDBKeyStore(keyStoreFile)
+	if err != nil {
+		return err
+	}
+
+	if enabled && ks.RotationDue(rotationDays, time.Now()) {
+		if key, err := ks.Rotate(); err != nil {
+			return err
+		} else {
+			glog.V(3).Infof(dbeLogString(fmt.Sprintf("rotated database key, new key is %v", key.Id)))
+		}
+	}
+
+	c, err := NewDBCipher(ks, enabled)
+	if err != nil {
+		return err
+	}
+	SetDBCipher(c)
+
+	if count, err := MigrateDBEncryption(db); err != nil {
+		return errors.New(fmt.Sprintf("unable to migrate database records, error: %v", err))
+	} else if count != 0 {
+		glog.V(3).Infof(dbeLogString(fmt.Sprintf("rewrote %v database records, encryption enabled: %v", count, enabled)))
+	}
+
+	// Every record is now sealed with the current key, or is plaintext, so the older keys are no longer needed.
+	if enabled {
+		return ks.PruneOldKeys()
+	}
+	return nil
+}
+
+var dbeLogString = func(v interface{}) string {
+	return fmt.Sprintf("DB Encryption: %v", v)
+}
@@ -0,0 +1,213 @@
+// +build unit
+
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/policy"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+const testSecretValue = "registry-pa55word"
+
+func testUserInput() []policy.UserInput {
+	return []policy.UserInput{
+		policy.UserInput{
+			ServiceOrgid: "myorg",
+			ServiceUrl:   "myservice",
+			Inputs:       []policy.Input{policy.Input{Name: "password", Value: testSecretValue}},
+		},
+	}
+}
+
+// Return the raw user input record as it is stored in the database.
+func getRawUserInput(t *testing.T, db *bolt.DB) []byte {
+	var raw []byte
+	if err := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(NODE_USERINPUT)); b != nil {
+			raw = append(raw, b.Get([]byte(NODE_USERINPUT))...)
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("failed to read raw user input, error %v", err)
+	}
+	return raw
+}
+
+func checkUserInput(t *testing.T, db *bolt.DB) {
+	if ui, err := FindNodeUserInput(db); err != nil {
+		t.Errorf("failed to find node user input, error %v", err)
+	} else if len(ui) != 1 || len(ui[0].Inputs) != 1 || ui[0].Inputs[0].Value != testSecretValue {
+		t.Errorf("incorrect node user input: %v", ui)
+	}
+}
+
+// Without encryption, the records are stored in plaintext and no key store is created.
+func Test_DBEncryption_Plaintext(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+	defer SetDBCipher(nil)
+
+	if err := InitDBEncryption(db, dir, false, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if _, err := os.Stat(path.Join(dir, DB_KEYSTORE_FILE)); !os.IsNotExist(err) {
+		t.Errorf("key store should not exist, error %v", err)
+	} else if err := SaveNodeUserInput(db, testUserInput()); err != nil {
+		t.Errorf("failed to save node user input, error %v", err)
+	} else if raw := getRawUserInput(t, db); IsSealedRecord(raw) || !bytes.Contains(raw, []byte(testSecretValue)) {
+		t.Errorf("record should be plaintext: %v", string(raw))
+	}
+
+	checkUserInput(t, db)
+}
+
+// With encryption, the records are sealed in the database and opened when they are read.
+func Test_DBEncryption_Encrypted(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+	defer SetDBCipher(nil)
+
+	if err := InitDBEncryption(db, dir, true, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if fi, err := os.Stat(path.Join(dir, DB_KEYSTORE_FILE)); err != nil {
+		t.Errorf("key store should exist, error %v", err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("key store should have mode 0600, has %v", fi.Mode().Perm())
+	} else if err := SaveNodeUserInput(db, testUserInput()); err != nil {
+		t.Errorf("failed to save node user input, error %v", err)
+	} else if raw := getRawUserInput(t, db); !IsSealedRecord(raw) || bytes.Contains(raw, []byte(testSecretValue)) {
+		t.Errorf("record should be sealed: %v", string(raw))
+	}
+
+	checkUserInput(t, db)
+
+	// Agreements are sealed too, and can be updated and read back.
+	wi, _ := NewWorkloadInfo("myservice", "myorg", "1.0.0", "amd64")
+	if _, err := NewEstablishedAgreement(db, "ag1", "agid1", "consumer1", "{}", "Basic", 1, ServiceSpecs{}, "sig", "address", "", "", "", wi); err != nil {
+		t.Errorf("failed to create agreement, error %v", err)
+	} else if _, err := AgreementStateAccepted(db, "agid1", "Basic"); err != nil {
+		t.Errorf("failed to update agreement, error %v", err)
+	} else if ags, err := FindEstablishedAgreements(db, "Basic", []EAFilter{IdEAFilter("agid1")}); err != nil {
+		t.Errorf("failed to find agreement, error %v", err)
+	} else if len(ags) != 1 || ags[0].AgreementAcceptedTime == 0 {
+		t.Errorf("incorrect agreements: %v", ags)
+	}
+
+	// A sealed record with no key store cannot be read.
+	SetDBCipher(nil)
+	if _, err := FindNodeUserInput(db); err == nil {
+		t.Errorf("reading a sealed record without a key should fail")
+	}
+}
+
+// A sealed record is bound to its bucket and key.
+func Test_DBCipher_RecordMoved(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "utdbe-")
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	if ks, err := LoadDBKeyStore(path.Join(dir, DB_KEYSTORE_FILE)); err != nil {
+		t.Errorf("failed to create key store, error %v", err)
+	} else if c, err := NewDBCipher(ks, true); err != nil {
+		t.Errorf("failed to create cipher, error %v", err)
+	} else if sealed, err := c.Seal(ATTRIBUTES, []byte("a1"), []byte("value")); err != nil {
+		t.Errorf("failed to seal record, error %v", err)
+	} else if SealedRecordKeyId(sealed) != ks.CurrentKey().Id {
+		t.Errorf("record should be sealed with key %v", ks.CurrentKey().Id)
+	} else if record, err := c.Open(ATTRIBUTES, []byte("a1"), sealed); err != nil || string(record) != "value" {
+		t.Errorf("failed to open record: %v, error %v", string(record), err)
+	} else if _, err := c.Open(ATTRIBUTES, []byte("a2"), sealed); err == nil {
+		t.Errorf("opening a record under another key should fail")
+	} else if _, err := c.Open(NODE_USERINPUT, []byte("a1"), sealed); err == nil {
+		t.Errorf("opening a record in another bucket should fail")
+	}
+}
+
+// Records written before encryption was enabled are sealed at startup, and opened again when it is disabled.
+func Test_DBEncryption_Migration(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+	defer SetDBCipher(nil)
+
+	SetDBCipher(nil)
+	if err := SaveNodeUserInput(db, testUserInput()); err != nil {
+		t.Errorf("failed to save node user input, error %v", err)
+	}
+
+	if err := InitDBEncryption(db, dir, true, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if raw := getRawUserInput(t, db); !IsSealedRecord(raw) {
+		t.Errorf("record should be sealed: %v", string(raw))
+	}
+	checkUserInput(t, db)
+
+	if err := InitDBEncryption(db, dir, false, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if raw := getRawUserInput(t, db); IsSealedRecord(raw) {
+		t.Errorf("record should be plaintext: %v", string(raw))
+	}
+	checkUserInput(t, db)
+}
+
+// An expired key is replaced at startup, the records are sealed with the new key and the old key is removed.
+func Test_DBEncryption_Rotation(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+	defer SetDBCipher(nil)
+
+	keyStoreFile := path.Join(dir, DB_KEYSTORE_FILE)
+	if err := InitDBEncryption(db, dir, true, 30); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if err := SaveNodeUserInput(db, testUserInput()); err != nil {
+		t.Errorf("failed to save node user input, error %v", err)
+	}
+
+	// Age the key so that it is due for rotation.
+	ks, err := LoadDBKeyStore(keyStoreFile)
+	if err != nil {
+		t.Errorf("failed to load key store, error %v", err)
+	}
+	oldKeyId := ks.CurrentKey().Id
+	ks.Keys[0].Created = time.Now().Add(-31 * 24 * time.Hour).Unix()
+	if content, err := json.Marshal(ks); err != nil {
+		t.Errorf("failed to marshal key store, error %v", err)
+	} else if err := ioutil.WriteFile(keyStoreFile, content, 0600); err != nil {
+		t.Errorf("failed to write key store, error %v", err)
+	}
+
+	if err := InitDBEncryption(db, dir, true, 30); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if ks, err := LoadDBKeyStore(keyStoreFile); err != nil {
+		t.Errorf("failed to load key store, error %v", err)
+	} else if len(ks.Keys) != 1 || ks.CurrentKey().Id == oldKeyId {
+		t.Errorf("key should have been rotated: %v", ks)
+	} else if keyId := SealedRecordKeyId(getRawUserInput(t, db)); keyId != ks.CurrentKey().Id {
+		t.Errorf("record should be sealed with key %v, is sealed with %v", ks.CurrentKey().Id, keyId)
+	}
+	checkUserInput(t, db)
+}
@@ -124,6 +124,8 @@ const (
 
 	EC_IMAGE_LOADED                       = "image_loaded"
 	EC_ERROR_IMAGE_LOADE                  = "error_image_load"
+	EC_ERROR_IMAGE_SIG_VERIF              = "error_image_signature_verification"
+	EC_ERROR_DISK_PRESSURE                = "error_disk_pressure"
 	EC_ERROR_AGREEMENT_VERIFICATION       = "error_in_agreement_verification"
 	EC_ERROR_DELETE_AGREEMENT_IN_EXCHANGE = "error_delete_agreement_in_exchange"
 
@@ -138,6 +140,13 @@ const (
 	EC_COMPLETE_DEPENDENT_SERVICE          = "complete_dependent_service"
 	EC_REMOVE_OLD_DEPENDENT_SERVICE_FAILED = "remove_old_dependent_service_failed"
 
+	EC_WAITING_FOR_DEPENDENCIES   = "waiting_for_dependencies"
+	EC_DEPENDENCIES_READY         = "dependencies_ready"
+	EC_DEPENDENCIES_READY_TIMEOUT = "dependencies_ready_timeout"
+
+	EC_CONTAINER_RESTARTED = "container_restarted"
+	EC_SERVICE_CRASH_LOOP  = "service_crash_loop"
+
 	EC_START_RETRY_DEPENDENT_SERVICE       = "start_retry_dependent_service"
 	EC_ERROR_START_RETRY_DEPENDENT_SERVICE = "error_start_retry_dependent_service"
 	EC_DEPENDENT_SERVICE_RETRY_FAILED      = "dependent_service_retry_failed"
@@ -4,14 +4,160 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/open-horizon/anax/externalpolicy"
+	"strconv"
+	"strings"
 )
 
 // The structure of the json string in the deployment field of a service definition when the
 // service is deployed via Helm to a Kubernetes cluster.
 
 type HelmDeploymentConfig struct {
-	ChartArchive string `json:"chart_archive"` // base64 encoded binary of helm package tar file
-	ReleaseName  string `json:"release_name"`
+	ChartArchive string             `json:"chart_archive"` // base64 encoded binary of helm package tar file
+	ReleaseName  string             `json:"release_name"`
+	Values       []HelmValueMapping `json:"values,omitempty"` // chart values set from the user input and node properties
+}
+
+// The types a chart value can be converted to, named like the types of service user input variables.
+const (
+	HELM_VALUE_TYPE_STRING  = "string"
+	HELM_VALUE_TYPE_INT     = "int"
+	HELM_VALUE_TYPE_FLOAT   = "float"
+	HELM_VALUE_TYPE_BOOLEAN = "boolean"
+	HELM_VALUE_TYPE_LIST    = "list of strings"
+)
+
+// A chart value that is set from a user input variable of the service or from a property of the node policy.
+// The name is the path of the value in the chart, with nested keys separated by dots, e.g. image.tag.
+type HelmValueMapping struct {
+	Name         string `json:"name"`
+	UserInput    string `json:"user_input,omitempty"`
+	NodeProperty string `json:"node_property,omitempty"`
+	Type         string `json:"type,omitempty"` // defaults to string
+}
+
+func (m HelmValueMapping) String() string {
+	return fmt.Sprintf("Name: %v, UserInput: %v, NodeProperty: %v, Type: %v", m.Name, m.UserInput, m.NodeProperty, m.Type)
+}
+
+func (m HelmValueMapping) Validate() error {
+	if m.Name == "" {
+		return errors.New(fmt.Sprintf("chart value mapping %v must have a name", m))
+	}
+	for _, key := range strings.Split(m.Name, ".") {
+		if key == "" {
+			return errors.New(fmt.Sprintf("chart value name %v has an empty key", m.Name))
+		}
+	}
+	if (m.UserInput == "") == (m.NodeProperty == "") {
+		return errors.New(fmt.Sprintf("chart value %v must be set from either a user input variable or a node property", m.Name))
+	}
+	switch m.Type {
+	case "", HELM_VALUE_TYPE_STRING, HELM_VALUE_TYPE_INT, HELM_VALUE_TYPE_FLOAT, HELM_VALUE_TYPE_BOOLEAN, "bool", HELM_VALUE_TYPE_LIST:
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("chart value %v has type %v, must be one of %v, %v, %v, %v or %v", m.Name, m.Type, HELM_VALUE_TYPE_STRING, HELM_VALUE_TYPE_INT, HELM_VALUE_TYPE_FLOAT, HELM_VALUE_TYPE_BOOLEAN, HELM_VALUE_TYPE_LIST))
+	}
+}
+
+// Convert the string form of a user input variable or node property to the type of the chart value. The items of
+// a list are separated by spaces in user input and by commas in node properties.
+func (m HelmValueMapping) Convert(value string) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch m.Type {
+	case HELM_VALUE_TYPE_INT:
+		v, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case HELM_VALUE_TYPE_FLOAT:
+		v, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case HELM_VALUE_TYPE_BOOLEAN, "bool":
+		v, err = strconv.ParseBool(strings.TrimSpace(value))
+	case HELM_VALUE_TYPE_LIST:
+		list := []interface{}{}
+		items := strings.Fields(value)
+		if m.NodeProperty != "" {
+			items = strings.Split(value, ",")
+		}
+		for _, item := range items {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v = list
+	default:
+		v = value
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to convert %v to the %v type of chart value %v, error: %v", value, m.Type, m.Name, err))
+	}
+	return v, nil
+}
+
+// Verify the chart value mappings. Each chart value can only be set once, and a value cannot be both a leaf and
+// the parent of other values.
+func (h HelmDeploymentConfig) ValidateValues() error {
+	names := map[string]bool{}
+	for _, m := range h.Values {
+		if err := m.Validate(); err != nil {
+			return err
+		} else if names[m.Name] {
+			return errors.New(fmt.Sprintf("chart value %v is mapped more than once", m.Name))
+		}
+		names[m.Name] = true
+	}
+	for name := range names {
+		keys := strings.Split(name, ".")
+		for i := 1; i < len(keys); i++ {
+			if parent := strings.Join(keys[:i], "."); names[parent] {
+				return errors.New(fmt.Sprintf("chart value %v is also the parent of chart value %v", parent, name))
+			}
+		}
+	}
+	return nil
+}
+
+// Return the chart values that the mappings set from the user input variables of the service, given as the
+// environment variables of the service, and from the node properties. A value whose user input variable or node
+// property is not set keeps the default of the chart.
+func (h HelmDeploymentConfig) ChartValues(userInput map[string]string, nodeProps externalpolicy.PropertyList) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, m := range h.Values {
+		var value string
+		if m.UserInput != "" {
+			if v, ok := userInput[m.UserInput]; !ok {
+				continue
+			} else {
+				value = v
+			}
+		} else if prop, err := nodeProps.GetProperty(m.NodeProperty); err != nil {
+			continue
+		} else if f, ok := prop.Value.(float64); ok {
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		} else {
+			value = fmt.Sprintf("%v", prop.Value)
+		}
+
+		if v, err := m.Convert(value); err != nil {
+			return nil, err
+		} else {
+			SetChartValue(values, m.Name, v)
+		}
+	}
+	return values, nil
+}
+
+// Set a chart value given the dotted path of its name, creating the maps of the parent keys.
+func SetChartValue(values map[string]interface{}, name string, value interface{}) {
+	keys := strings.Split(name, ".")
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := values[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			values[key] = child
+		}
+		values = child
+	}
+	values[keys[len(keys)-1]] = value
 }
 
 func NewHelmDeployment(chartArchive string, releaseName string) *HelmDeploymentConfig {
@@ -5,6 +5,7 @@ package persistence
 import (
 	"encoding/json"
 	"flag"
+	"github.com/open-horizon/anax/externalpolicy"
 	"testing"
 )
 
@@ -71,3 +72,90 @@ func Test_PersistToFrom(t *testing.T) {
 	}
 
 }
+
+func Test_HelmValidateValues(t *testing.T) {
+
+	hd := HelmDeploymentConfig{
+		ChartArchive: "1234567890",
+		ReleaseName:  "test",
+		Values: []HelmValueMapping{
+			HelmValueMapping{Name: "image.tag", UserInput: "TAG"},
+			HelmValueMapping{Name: "replicaCount", UserInput: "REPLICAS", Type: HELM_VALUE_TYPE_INT},
+			HelmValueMapping{Name: "region", NodeProperty: "region"},
+		},
+	}
+	if err := hd.ValidateValues(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []HelmValueMapping{
+		HelmValueMapping{Name: "image..tag", UserInput: "TAG"},
+		HelmValueMapping{Name: "image.tag"},
+		HelmValueMapping{Name: "image.tag", UserInput: "TAG", NodeProperty: "tag"},
+		HelmValueMapping{Name: "image.tag", UserInput: "TAG", Type: "map"},
+		HelmValueMapping{Name: "replicaCount", UserInput: "COUNT"},
+		HelmValueMapping{Name: "image", UserInput: "IMAGE"},
+	}
+	for _, m := range invalid {
+		hd.Values = []HelmValueMapping{HelmValueMapping{Name: "image.tag", UserInput: "TAG2"}, HelmValueMapping{Name: "replicaCount", UserInput: "REPLICAS"}, m}
+		if m.Name == "image.tag" {
+			hd.Values = hd.Values[1:]
+		}
+		if err := hd.ValidateValues(); err == nil {
+			t.Errorf("expected an error for chart value mapping %v", m)
+		}
+	}
+
+}
+
+func Test_HelmChartValues(t *testing.T) {
+
+	hd := HelmDeploymentConfig{
+		ChartArchive: "1234567890",
+		ReleaseName:  "test",
+		Values: []HelmValueMapping{
+			HelmValueMapping{Name: "image.tag", UserInput: "TAG"},
+			HelmValueMapping{Name: "image.pullPolicy", UserInput: "PULL_POLICY"},
+			HelmValueMapping{Name: "replicaCount", UserInput: "REPLICAS", Type: HELM_VALUE_TYPE_INT},
+			HelmValueMapping{Name: "ingress.hosts", UserInput: "HOSTS", Type: HELM_VALUE_TYPE_LIST},
+			HelmValueMapping{Name: "node.region", NodeProperty: "region"},
+			HelmValueMapping{Name: "node.zones", NodeProperty: "zones", Type: HELM_VALUE_TYPE_LIST},
+			HelmValueMapping{Name: "node.memory", NodeProperty: "memory", Type: HELM_VALUE_TYPE_FLOAT},
+			HelmValueMapping{Name: "node.gpu", NodeProperty: "gpu", Type: HELM_VALUE_TYPE_BOOLEAN},
+		},
+	}
+
+	userInput := map[string]string{"TAG": "1.2", "REPLICAS": "3", "HOSTS": "a.example.com b.example.com"}
+	nodeProps := externalpolicy.PropertyList{
+		*externalpolicy.Property_Factory("region", "us-east"),
+		*externalpolicy.Property_Factory("zones", "z1, z2"),
+		*externalpolicy.Property_Factory("memory", float64(1024)),
+		*externalpolicy.Property_Factory("gpu", true),
+	}
+
+	values, err := hd.ChartValues(userInput, nodeProps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	image, _ := values["image"].(map[string]interface{})
+	node, _ := values["node"].(map[string]interface{})
+	if image["tag"] != "1.2" {
+		t.Errorf("expected image.tag 1.2, got %v", values)
+	} else if _, ok := image["pullPolicy"]; ok {
+		t.Errorf("expected image.pullPolicy to keep the chart default, got %v", image["pullPolicy"])
+	} else if values["replicaCount"] != int64(3) {
+		t.Errorf("expected replicaCount 3, got %v", values["replicaCount"])
+	} else if hosts, ok := values["ingress"].(map[string]interface{})["hosts"].([]interface{}); !ok || len(hosts) != 2 {
+		t.Errorf("expected 2 ingress hosts, got %v", values["ingress"])
+	} else if node["region"] != "us-east" || node["memory"] != float64(1024) || node["gpu"] != true {
+		t.Errorf("unexpected node values %v", node)
+	} else if zones, ok := node["zones"].([]interface{}); !ok || len(zones) != 2 || zones[1] != "z2" {
+		t.Errorf("expected zones z1 and z2, got %v", node["zones"])
+	}
+
+	userInput["REPLICAS"] = "three"
+	if _, err := hd.ChartValues(userInput, nodeProps); err == nil {
+		t.Errorf("expected an error for a user input that is not an int")
+	}
+
+}
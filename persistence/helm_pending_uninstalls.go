@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// helm pending uninstall table name
+const HELM_PENDING_UNINSTALLS = "helm_pending_uninstalls"
+
+// A Helm release of an agreement that ended for a service upgrade. The release is kept until the deadline so that the
+// agreement for the new version of the service can upgrade it in place, and it is uninstalled when that does not happen.
+// The record is kept in the db so that the release is still uninstalled after the agent restarts.
+type HelmPendingUninstall struct {
+	ReleaseName string `json:"release_name"` // the primary key
+	AgreementId string `json:"agreement_id"` // the agreement that ended
+	Deadline    uint64 `json:"deadline"`     // seconds since the epoch
+}
+
+func NewHelmPendingUninstall(releaseName string, agreementId string, deadline uint64) *HelmPendingUninstall {
+	return &HelmPendingUninstall{
+		ReleaseName: releaseName,
+		AgreementId: agreementId,
+		Deadline:    deadline,
+	}
+}
+
+func (p HelmPendingUninstall) String() string {
+	return fmt.Sprintf("ReleaseName: %v, "+
+		"AgreementId: %v, "+
+		"Deadline: %v",
+		p.ReleaseName, p.AgreementId, p.Deadline)
+}
+
+// save the pending uninstall record into db, replacing the record with the same release name.
+func SaveHelmPendingUninstall(db *bolt.DB, pending *HelmPendingUninstall) error {
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		if bucket, err := tx.CreateBucketIfNotExists([]byte(HELM_PENDING_UNINSTALLS)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(*pending); err != nil {
+			return fmt.Errorf("Failed to serialize the helm pending uninstall object: %v. Error: %v", *pending, err)
+		} else {
+			return bucket.Put([]byte(pending.ReleaseName), serial)
+		}
+	})
+
+	return writeErr
+}
+
+// delete the pending uninstall record of the given release from the db.
+func DeleteHelmPendingUninstall(db *bolt.DB, releaseName string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(HELM_PENDING_UNINSTALLS)); bucket == nil {
+			return nil
+		} else if err := bucket.Delete([]byte(releaseName)); err != nil {
+			return fmt.Errorf("Unable to delete helm pending uninstall %v: %v", releaseName, err)
+		}
+		return nil
+	})
+}
+
+// find all the pending uninstall records in the db.
+func FindHelmPendingUninstalls(db *bolt.DB) ([]HelmPendingUninstall, error) {
+	pendings := make([]HelmPendingUninstall, 0)
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+
+		if b := tx.Bucket([]byte(HELM_PENDING_UNINSTALLS)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+
+				var p HelmPendingUninstall
+
+				if err := json.Unmarshal(v, &p); err != nil {
+					glog.Errorf("Unable to deserialize HelmPendingUninstall db record: %v. Error: %v", v, err)
+				} else {
+					pendings = append(pendings, p)
+				}
+				return nil
+			})
+		}
+
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return pendings, nil
+	}
+}
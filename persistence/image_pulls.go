@@ -0,0 +1,178 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"time"
+)
+
+// image pull table name
+const IMAGE_PULLS = "image_pulls"
+
+// The status of an image pull that has not completed.
+const (
+	IMAGE_PULL_STATUS_PULLING = "pulling"
+	IMAGE_PULL_STATUS_WAITING = "waiting" // waiting for the next pull window
+	IMAGE_PULL_STATUS_FAILED  = "failed"
+)
+
+// The download progress of an image layer.
+type LayerProgress struct {
+	Downloaded int64 `json:"downloaded"`
+	Total      int64 `json:"total"`
+	Complete   bool  `json:"complete"`
+}
+
+// The progress of an image pull that has not completed, shown in the service status. A retry of the pull does not
+// download the layers that were downloaded completely again, and when the download rate is limited it resumes the layers
+// that were partly downloaded. The record is removed once the image is pulled.
+type ImagePull struct {
+	Image           string                   `json:"image"` // the image name in the deployment, it is the primary key
+	Status          string                   `json:"status"`
+	Layers          map[string]LayerProgress `json:"layers"`
+	DownloadedBytes int64                    `json:"downloaded_bytes"`
+	TotalBytes      int64                    `json:"total_bytes"` // the size of the layers that docker reported a size for
+	Attempts        int                      `json:"attempts"`
+	LastError       string                   `json:"last_error,omitempty"`
+	StartTime       uint64                   `json:"start_time"`
+	UpdateTime      uint64                   `json:"update_time"`
+}
+
+func NewImagePull(image string) *ImagePull {
+	now := uint64(time.Now().Unix())
+	return &ImagePull{
+		Image:      image,
+		Status:     IMAGE_PULL_STATUS_PULLING,
+		Layers:     make(map[string]LayerProgress),
+		StartTime:  now,
+		UpdateTime: now,
+	}
+}
+
+func (p ImagePull) String() string {
+	return fmt.Sprintf("Image: %v, "+
+		"Status: %v, "+
+		"Layers: %v, "+
+		"DownloadedBytes: %v, "+
+		"TotalBytes: %v, "+
+		"Attempts: %v, "+
+		"LastError: %v, "+
+		"StartTime: %v, "+
+		"UpdateTime: %v",
+		p.Image, p.Status, len(p.Layers), p.DownloadedBytes, p.TotalBytes, p.Attempts, p.LastError, p.StartTime, p.UpdateTime)
+}
+
+// Returns the number of layers that were downloaded completely.
+func (p *ImagePull) CompleteLayers() int {
+	n := 0
+	for _, l := range p.Layers {
+		if l.Complete {
+			n++
+		}
+	}
+	return n
+}
+
+// Update the progress of the layers, a layer that was downloaded completely stays complete.
+func (p *ImagePull) UpdateLayers(layers map[string]LayerProgress) {
+	if p.Layers == nil {
+		p.Layers = make(map[string]LayerProgress)
+	}
+	for id, l := range layers {
+		if prev, ok := p.Layers[id]; ok && prev.Complete {
+			continue
+		}
+		p.Layers[id] = l
+	}
+
+	p.DownloadedBytes = 0
+	p.TotalBytes = 0
+	for _, l := range p.Layers {
+		p.DownloadedBytes += l.Downloaded
+		p.TotalBytes += l.Total
+	}
+	p.UpdateTime = uint64(time.Now().Unix())
+}
+
+// save the image pull record into db, replacing the record with the same image.
+func SaveImagePull(db *bolt.DB, image_pull *ImagePull) error {
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		if bucket, err := tx.CreateBucketIfNotExists([]byte(IMAGE_PULLS)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(*image_pull); err != nil {
+			return fmt.Errorf("Failed to serialize the image pull object: %v. Error: %v", *image_pull, err)
+		} else {
+			return bucket.Put([]byte(image_pull.Image), serial)
+		}
+	})
+
+	return writeErr
+}
+
+// delete the image pull record of the given image from the db.
+func DeleteImagePull(db *bolt.DB, image string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(IMAGE_PULLS)); bucket == nil {
+			return nil
+		} else if err := bucket.Delete([]byte(image)); err != nil {
+			return fmt.Errorf("Unable to delete image pull %v: %v", image, err)
+		}
+		return nil
+	})
+}
+
+// find the image pull record of the given image in the db, returns nil if there is none.
+func FindImagePull(db *bolt.DB, image string) (*ImagePull, error) {
+	var pull *ImagePull
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(IMAGE_PULLS)); b != nil {
+			if v := b.Get([]byte(image)); v != nil {
+				var p ImagePull
+				if err := json.Unmarshal(v, &p); err != nil {
+					return fmt.Errorf("Unable to deserialize ImagePull db record: %v. Error: %v", v, err)
+				}
+				pull = &p
+			}
+		}
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return pull, nil
+	}
+}
+
+// find all the image pull records in the db.
+func FindImagePulls(db *bolt.DB) ([]ImagePull, error) {
+	pulls := make([]ImagePull, 0)
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+
+		if b := tx.Bucket([]byte(IMAGE_PULLS)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+
+				var p ImagePull
+
+				if err := json.Unmarshal(v, &p); err != nil {
+					glog.Errorf("Unable to deserialize ImagePull db record: %v. Error: %v", v, err)
+				} else {
+					pulls = append(pulls, p)
+				}
+				return nil
+			})
+		}
+
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return pulls, nil
+	}
+}
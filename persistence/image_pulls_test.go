@@ -0,0 +1,44 @@
+// +build unit
+
+package persistence
+
+import (
+	"testing"
+)
+
+func Test_ImagePull_save_update(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Errorf("Error setting up UT DB: %v", err)
+	}
+	defer cleanTestDir(dir)
+
+	pull := NewImagePull("myrepo.com/myimage:1.0.0")
+	pull.UpdateLayers(map[string]LayerProgress{
+		"a1": LayerProgress{Downloaded: 300, Total: 300, Complete: true},
+		"b2": LayerProgress{Downloaded: 50, Total: 200},
+	})
+	if err := SaveImagePull(db, pull); err != nil {
+		t.Errorf("Error saving image pull: %v", err)
+	}
+
+	// a later attempt reports the downloaded layer as already existing, without its size
+	if saved, err := FindImagePull(db, pull.Image); err != nil || saved == nil {
+		t.Errorf("Error finding image pull: %v %v", saved, err)
+	} else {
+		saved.UpdateLayers(map[string]LayerProgress{
+			"a1": LayerProgress{Complete: true},
+			"b2": LayerProgress{Downloaded: 150, Total: 200},
+		})
+		if saved.CompleteLayers() != 1 || saved.DownloadedBytes != 450 || saved.TotalBytes != 500 {
+			t.Errorf("Wrong progress after update: %v", saved)
+		}
+	}
+
+	if err := DeleteImagePull(db, pull.Image); err != nil {
+		t.Errorf("Error deleting image pull: %v", err)
+	} else if pulls, err := FindImagePulls(db); err != nil || len(pulls) != 0 {
+		t.Errorf("Image pull should have been deleted, got %v %v", pulls, err)
+	}
+}
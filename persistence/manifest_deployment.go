@@ -0,0 +1,69 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+)
+
+// The structure of the json string in the clusterDeployment field of a service definition when the
+// service is a plain set of Kubernetes manifests, optionally with a Kustomize overlay.
+type ManifestDeploymentConfig struct {
+	ManifestArchive  string `json:"manifestArchive"`            // base64 encoded tar.gz of the manifest files
+	KustomizeOverlay string `json:"kustomizeOverlay,omitempty"` // the directory of the kustomization in the archive
+}
+
+func (m *ManifestDeploymentConfig) ToString() string {
+	if m != nil {
+		return fmt.Sprintf("ManifestArchive: %v, KustomizeOverlay: %v", cutil.TruncateDisplayString(m.ManifestArchive, 20), m.KustomizeOverlay)
+	}
+	return ""
+}
+
+// Given a deployment string, unmarshal it as a ManifestDeployment object. It might not be a ManifestDeployment, so
+// we have to verify what was just unmarshalled.
+func GetManifestDeployment(deployStr string) (*ManifestDeploymentConfig, error) {
+	md := new(ManifestDeploymentConfig)
+	err := json.Unmarshal([]byte(deployStr), md)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling deployment config as ManifestDeployment: %v", err)
+	} else if md.ManifestArchive == "" {
+		return nil, fmt.Errorf("required field 'manifestArchive' is missing in the deployment string.")
+	}
+	return md, nil
+}
+
+func (m *ManifestDeploymentConfig) FromPersistentForm(pf map[string]interface{}) error {
+	// Marshal to JSON form so that we can unmarshal as a ManifestDeploymentConfig.
+	if jBytes, err := json.Marshal(pf); err != nil {
+		return fmt.Errorf("error marshalling manifest persistent deployment: %v, error: %v", m, err)
+	} else if err := json.Unmarshal(jBytes, m); err != nil {
+		return fmt.Errorf("error unmarshalling manifest persistent deployment: %v, error: %v", string(jBytes), err)
+	}
+	return nil
+}
+
+func (m *ManifestDeploymentConfig) ToPersistentForm() (map[string]interface{}, error) {
+	pf := make(map[string]interface{})
+
+	// Marshal to JSON form so that we can unmarshal as a map[string]interface{}.
+	if jBytes, err := json.Marshal(m); err != nil {
+		return pf, fmt.Errorf("error marshalling manifest deployment: %v, error: %v", m, err)
+	} else if err := json.Unmarshal(jBytes, &pf); err != nil {
+		return pf, fmt.Errorf("error unmarshalling manifest deployment: %v, error: %v", string(jBytes), err)
+	}
+
+	return pf, nil
+}
+
+func (m *ManifestDeploymentConfig) IsNative() bool {
+	return false
+}
+
+// Check if the deployment is a manifest deployment or not
+func IsManifest(dep map[string]interface{}) bool {
+	if _, ok := dep["manifestArchive"]; ok {
+		return true
+	}
+	return false
+}
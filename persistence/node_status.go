@@ -16,13 +16,16 @@ type WorkloadStatus struct {
 	Arch           string            `json:"arch,omitempty"`
 	Containers     []ContainerStatus `json:"containerStatus"`
 	OperatorStatus interface{}       `json:"operatorStatus,omitempty"`
+	Health         string            `json:"health,omitempty"`
 }
 
 type ContainerStatus struct {
-	Name    string `json:"name"`
-	Image   string `json:"image"`
-	Created int64  `json:"created"`
-	State   string `json:"state"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	Created  int64  `json:"created"`
+	State    string `json:"state"`
+	Health   string `json:"health,omitempty"`
+	Restarts int    `json:"restarts,omitempty"`
 }
 
 // FindNodeStatus returns the node status currently in the local db
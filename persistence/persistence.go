@@ -178,6 +178,8 @@ func NewEstablishedAgreement(db *bolt.DB, name string, agreementId string, consu
 			return err
 		} else if bytes, err := json.Marshal(newAg); err != nil {
 			return fmt.Errorf("Unable to marshal new record: %v", err)
+		} else if bytes, err = sealRecord(E_AGREEMENTS+"-"+protocol, []byte(agreementId), bytes); err != nil {
+			return fmt.Errorf("Unable to encrypt new record: %v", err)
 		} else if err := b.Put([]byte(agreementId), []byte(bytes)); err != nil {
 			return fmt.Errorf("Unable to persist agreement: %v", err)
 		}
@@ -197,13 +199,19 @@ func (a *EstablishedAgreement) GetDeploymentConfig() DeploymentConfig {
 		nd.Services = a.CurrentDeployment
 		return nd
 
-		// The extended deployment config must be in use, so return it. It could be kube or helm.
+		// The extended deployment config must be in use, so return it. It could be kube, manifest or helm.
 	} else if IsKube(a.ExtendedDeployment) {
 		cd := new(KubeDeploymentConfig)
 		if err := cd.FromPersistentForm(a.ExtendedDeployment); err != nil {
 			glog.Errorf("Unable to convert kube deployment %v to persistent form, error %v", a.ExtendedDeployment, err)
 		}
 		return cd
+	} else if IsManifest(a.ExtendedDeployment) {
+		md := new(ManifestDeploymentConfig)
+		if err := md.FromPersistentForm(a.ExtendedDeployment); err != nil {
+			glog.Errorf("Unable to convert manifest deployment %v to persistent form, error %v", a.ExtendedDeployment, err)
+		}
+		return md
 	} else if IsHelm(a.ExtendedDeployment) {
 		hd := new(HelmDeploymentConfig)
 		if err := hd.FromPersistentForm(a.ExtendedDeployment); err != nil {
@@ -391,10 +399,11 @@ func persistUpdatedAgreement(db *bolt.DB, dbAgreementId string, protocol string,
 		if b, err := tx.CreateBucketIfNotExists([]byte(E_AGREEMENTS + "-" + protocol)); err != nil {
 			return err
 		} else {
-			current := b.Get([]byte(dbAgreementId))
 			var mod EstablishedAgreement
 
-			if current == nil {
+			if current, err := openRecord(E_AGREEMENTS+"-"+protocol, []byte(dbAgreementId), b.Get([]byte(dbAgreementId))); err != nil {
+				return err
+			} else if current == nil {
 				return fmt.Errorf("No agreement with given id available to update: %v", dbAgreementId)
 			} else if err := json.Unmarshal(current, &mod); err != nil {
 				return fmt.Errorf("Failed to unmarshal agreement DB data: %v. Error: %v", string(current), err)
@@ -467,6 +476,8 @@ func persistUpdatedAgreement(db *bolt.DB, dbAgreementId string, protocol string,
 
 				if serialized, err := json.Marshal(mod); err != nil {
 					return fmt.Errorf("Failed to serialize contract record: %v. Error: %v", mod, err)
+				} else if serialized, err = sealRecord(E_AGREEMENTS+"-"+protocol, []byte(dbAgreementId), serialized); err != nil {
+					return fmt.Errorf("Failed to encrypt contract record with key: %v. Error: %v", dbAgreementId, err)
 				} else if err := b.Put([]byte(dbAgreementId), serialized); err != nil {
 					return fmt.Errorf("Failed to write contract record with key: %v. Error: %v", dbAgreementId, err)
 				} else {
@@ -505,7 +516,9 @@ func FindEstablishedAgreements(db *bolt.DB, protocol string, filters []EAFilter)
 
 				var e EstablishedAgreement
 
-				if err := json.Unmarshal(v, &e); err != nil {
+				if v, err := openRecord(E_AGREEMENTS+"-"+protocol, k, v); err != nil {
+					glog.Errorf("Unable to read db record %v: %v", string(k), err)
+				} else if err := json.Unmarshal(v, &e); err != nil {
 					glog.Errorf("Unable to deserialize db record to EstablishedAgreement: %v", v)
 				} else {
 					// this might be agreement from the old EstablishedAgreement structure where SensorUrl was used.
@@ -0,0 +1,96 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"time"
+)
+
+// pulled image table name
+const PULLED_IMAGES = "pulled_images"
+
+// A service image pulled by the agent. The image garbage collector removes the image once it has not been used by any
+// agreement or service for the grace period.
+type PulledImage struct {
+	Name         string `json:"name"`     // the image name used for the pull, it is the primary key
+	ImageId      string `json:"image_id"` // the docker id of the image
+	PullTime     uint64 `json:"pull_time"`
+	LastUsedTime uint64 `json:"last_used_time"`
+}
+
+func NewPulledImage(name string, imageId string) *PulledImage {
+	now := uint64(time.Now().Unix())
+	return &PulledImage{
+		Name:         name,
+		ImageId:      imageId,
+		PullTime:     now,
+		LastUsedTime: now,
+	}
+}
+
+func (p PulledImage) String() string {
+	return fmt.Sprintf("Name: %v, "+
+		"ImageId: %v, "+
+		"PullTime: %v, "+
+		"LastUsedTime: %v",
+		p.Name, p.ImageId, p.PullTime, p.LastUsedTime)
+}
+
+// save the pulled image record into db, replacing the record with the same name.
+func SavePulledImage(db *bolt.DB, pulled_image *PulledImage) error {
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		if bucket, err := tx.CreateBucketIfNotExists([]byte(PULLED_IMAGES)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(*pulled_image); err != nil {
+			return fmt.Errorf("Failed to serialize the pulled image object: %v. Error: %v", *pulled_image, err)
+		} else {
+			return bucket.Put([]byte(pulled_image.Name), serial)
+		}
+	})
+
+	return writeErr
+}
+
+// delete the pulled image record with the given name from the db.
+func DeletePulledImage(db *bolt.DB, name string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(PULLED_IMAGES)); bucket == nil {
+			return nil
+		} else if err := bucket.Delete([]byte(name)); err != nil {
+			return fmt.Errorf("Unable to delete pulled image %v: %v", name, err)
+		}
+		return nil
+	})
+}
+
+// find all the pulled image records in the db.
+func FindPulledImages(db *bolt.DB) ([]PulledImage, error) {
+	pis := make([]PulledImage, 0)
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+
+		if b := tx.Bucket([]byte(PULLED_IMAGES)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+
+				var pi PulledImage
+
+				if err := json.Unmarshal(v, &pi); err != nil {
+					glog.Errorf("Unable to deserialize PulledImage db record: %v. Error: %v", v, err)
+				} else {
+					pis = append(pis, pi)
+				}
+				return nil
+			})
+		}
+
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return pis, nil
+	}
+}
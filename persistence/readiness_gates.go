@@ -0,0 +1,165 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"time"
+)
+
+// readiness gate table name
+const READINESS_GATES = "readiness_gates"
+
+// The state of a readiness gate. A service starts when its gate is open or timed out.
+const (
+	READINESS_GATE_WAITING   = "waiting"
+	READINESS_GATE_OPEN      = "open"
+	READINESS_GATE_TIMED_OUT = "timed_out" // opened because a dependency was not ready in time
+)
+
+// How the readiness of a dependency container is checked.
+const (
+	READINESS_CHECK_RUNNING     = "running" // the container has neither a readiness probe nor a healthcheck
+	READINESS_CHECK_HEALTHCHECK = "healthcheck"
+	READINESS_CHECK_TCP         = "tcp"
+	READINESS_CHECK_HTTP        = "http"
+)
+
+// The readiness of one container of a service that the gated service depends on.
+type DependencyReadiness struct {
+	Container string `json:"container"`
+	Check     string `json:"check"`
+	Ready     bool   `json:"ready"`
+	TimedOut  bool   `json:"timed_out,omitempty"`
+	Message   string `json:"message,omitempty"` // why the container is not ready
+}
+
+func (d DependencyReadiness) String() string {
+	return fmt.Sprintf("Container: %v, Check: %v, Ready: %v, TimedOut: %v, Message: %v", d.Container, d.Check, d.Ready, d.TimedOut, d.Message)
+}
+
+// The readiness gate of a service instance, which holds the service back until the services it depends on are ready.
+// The record is removed with the containers of the service instance.
+type ReadinessGate struct {
+	InstanceId   string                `json:"instance_id"` // the agreement id or the service instance key, it is the primary key
+	SpecRef      string                `json:"ref_url"`
+	Org          string                `json:"organization"`
+	Version      string                `json:"version"`
+	State        string                `json:"state"`
+	Dependencies []DependencyReadiness `json:"dependencies"`
+	StartTime    uint64                `json:"start_time"`
+	UpdateTime   uint64                `json:"update_time"`
+}
+
+func NewReadinessGate(instanceId string, specRef string, org string, version string) *ReadinessGate {
+	now := uint64(time.Now().Unix())
+	return &ReadinessGate{
+		InstanceId:   instanceId,
+		SpecRef:      specRef,
+		Org:          org,
+		Version:      version,
+		State:        READINESS_GATE_WAITING,
+		Dependencies: make([]DependencyReadiness, 0),
+		StartTime:    now,
+		UpdateTime:   now,
+	}
+}
+
+func (g ReadinessGate) String() string {
+	return fmt.Sprintf("InstanceId: %v, "+
+		"SpecRef: %v, "+
+		"Org: %v, "+
+		"Version: %v, "+
+		"State: %v, "+
+		"Dependencies: %v, "+
+		"StartTime: %v, "+
+		"UpdateTime: %v",
+		g.InstanceId, g.SpecRef, g.Org, g.Version, g.State, g.Dependencies, g.StartTime, g.UpdateTime)
+}
+
+// Returns true if the service can start.
+func (g *ReadinessGate) IsOpen() bool {
+	return g.State == READINESS_GATE_OPEN || g.State == READINESS_GATE_TIMED_OUT
+}
+
+// save the readiness gate record into db, replacing the record with the same instance id.
+func SaveReadinessGate(db *bolt.DB, gate *ReadinessGate) error {
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		if bucket, err := tx.CreateBucketIfNotExists([]byte(READINESS_GATES)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(*gate); err != nil {
+			return fmt.Errorf("Failed to serialize the readiness gate object: %v. Error: %v", *gate, err)
+		} else {
+			return bucket.Put([]byte(gate.InstanceId), serial)
+		}
+	})
+
+	return writeErr
+}
+
+// delete the readiness gate record of the given service instance from the db.
+func DeleteReadinessGate(db *bolt.DB, instanceId string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(READINESS_GATES)); bucket == nil {
+			return nil
+		} else if err := bucket.Delete([]byte(instanceId)); err != nil {
+			return fmt.Errorf("Unable to delete readiness gate %v: %v", instanceId, err)
+		}
+		return nil
+	})
+}
+
+// find the readiness gate record of the given service instance in the db, returns nil if there is none.
+func FindReadinessGate(db *bolt.DB, instanceId string) (*ReadinessGate, error) {
+	var gate *ReadinessGate
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(READINESS_GATES)); b != nil {
+			if v := b.Get([]byte(instanceId)); v != nil {
+				var g ReadinessGate
+				if err := json.Unmarshal(v, &g); err != nil {
+					return fmt.Errorf("Unable to deserialize ReadinessGate db record: %v. Error: %v", v, err)
+				}
+				gate = &g
+			}
+		}
+		return nil
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return gate, nil
+	}
+}
+
+// find all the readiness gate records in the db.
+func FindReadinessGates(db *bolt.DB) ([]ReadinessGate, error) {
+	gates := make([]ReadinessGate, 0)
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+
+		if b := tx.Bucket([]byte(READINESS_GATES)); b != nil {
+			b.ForEach(func(k, v []byte) error {
+
+				var g ReadinessGate
+
+				if err := json.Unmarshal(v, &g); err != nil {
+					glog.Errorf("Unable to deserialize ReadinessGate db record: %v. Error: %v", v, err)
+				} else {
+					gates = append(gates, g)
+				}
+				return nil
+			})
+		}
+
+		return nil // end the transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	} else {
+		return gates, nil
+	}
+}
@@ -0,0 +1,38 @@
+// +build unit
+
+package persistence
+
+import (
+	"testing"
+)
+
+func Test_ReadinessGate_save_find(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Errorf("Error setting up UT DB: %v", err)
+	}
+	defer cleanTestDir(dir)
+
+	gate := NewReadinessGate("ag1", "http://mycompany.com/web", "mycompany", "1.0.0")
+	gate.Dependencies = append(gate.Dependencies, DependencyReadiness{Container: "db", Check: READINESS_CHECK_HEALTHCHECK, Message: "the container is starting"})
+	if err := SaveReadinessGate(db, gate); err != nil {
+		t.Errorf("Error saving readiness gate: %v", err)
+	}
+
+	if saved, err := FindReadinessGate(db, "ag1"); err != nil || saved == nil {
+		t.Errorf("Error finding readiness gate: %v %v", saved, err)
+	} else if saved.IsOpen() || len(saved.Dependencies) != 1 || saved.Dependencies[0].Container != "db" {
+		t.Errorf("Wrong readiness gate: %v", saved)
+	}
+
+	if missing, err := FindReadinessGate(db, "ag2"); err != nil || missing != nil {
+		t.Errorf("There should be no readiness gate for ag2, got %v %v", missing, err)
+	}
+
+	if err := DeleteReadinessGate(db, "ag1"); err != nil {
+		t.Errorf("Error deleting readiness gate: %v", err)
+	} else if gates, err := FindReadinessGates(db); err != nil || len(gates) != 0 {
+		t.Errorf("Readiness gate should have been deleted, got %v %v", gates, err)
+	}
+}
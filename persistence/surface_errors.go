@@ -119,6 +119,8 @@ func NewErrorLog(db *bolt.DB, eventLog EventLog) bool {
 func getErrorTypeList() []string {
 	return []string{
 		EC_ERROR_IMAGE_LOADE,
+		EC_ERROR_IMAGE_SIG_VERIF,
+		EC_ERROR_DISK_PRESSURE,
 		EC_ERROR_IN_DEPLOYMENT_CONFIG,
 		EC_ERROR_START_CONTAINER,
 		EC_CANCEL_AGREEMENT_EXECUTION_TIMEOUT,
@@ -127,6 +129,7 @@ func getErrorTypeList() []string {
 		EC_ERROR_START_SERVICE,
 		EC_ERROR_START_DEPENDENT_SERVICE,
 		EC_DEPENDENT_SERVICE_FAILED,
+		EC_SERVICE_CRASH_LOOP,
 	}
 
 }
@@ -20,7 +20,10 @@ func FindNodeUserInput(db *bolt.DB) ([]policy.UserInput, error) {
 		if b := tx.Bucket([]byte(NODE_USERINPUT)); b != nil {
 			return b.ForEach(func(k, v []byte) error {
 
-				if err := json.Unmarshal(v, &userInput); err != nil {
+				v, err := openRecord(NODE_USERINPUT, k, v)
+				if err != nil {
+					return err
+				} else if err := json.Unmarshal(v, &userInput); err != nil {
 					return fmt.Errorf("Unable to deserialize node user input record: %v", v)
 				}
 
@@ -49,6 +52,8 @@ func SaveNodeUserInput(db *bolt.DB, userInput []policy.UserInput) error {
 
 		if serial, err := json.Marshal(userInput); err != nil {
 			return fmt.Errorf("Failed to serialize node user input: %v. Error: %v", userInput, err)
+		} else if serial, err = sealRecord(NODE_USERINPUT, []byte(NODE_USERINPUT), serial); err != nil {
+			return fmt.Errorf("Failed to encrypt node user input. Error: %v", err)
 		} else {
 			return b.Put([]byte(NODE_USERINPUT), serial)
 		}
@@ -0,0 +1,286 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/robfig/cron/v3"
+	"strings"
+	"time"
+)
+
+// The purpose of this file is to abstract the operations on the maintenance window type. A maintenance window
+// limits when workload upgrades can disrupt a node. The window is open either on a cron-like schedule, where each
+// scheduled start opens the window for the given duration, or within a list of fixed time ranges. Times are
+// interpreted in the window's time zone, which defaults to UTC. A window with neither a schedule nor any ranges
+// is always open.
+
+type MaintenanceWindow struct {
+	Schedule string      `json:"schedule,omitempty"` // A cron expression (minute hour day-of-month month day-of-week) for the start of each window
+	Duration string      `json:"duration,omitempty"` // How long each scheduled window stays open, e.g. 2h or 90m
+	Ranges   []TimeRange `json:"ranges,omitempty"`   // Fixed time ranges in which the window is open
+	TimeZone string      `json:"timezone,omitempty"` // The IANA time zone name used for the schedule and ranges
+}
+
+type TimeRange struct {
+	Start string `json:"start"` // RFC3339, or 2006-01-02T15:04 in the window's time zone
+	End   string `json:"end"`
+}
+
+// The layouts accepted for the start and end of a time range that has no explicit offset.
+var timeRangeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+func (w *MaintenanceWindow) String() string {
+	if w == nil {
+		return "none"
+	}
+	return fmt.Sprintf("Schedule: %v, Duration: %v, Ranges: %v, TimeZone: %v", w.Schedule, w.Duration, w.Ranges, w.TimeZone)
+}
+
+// A nil or empty window places no restriction on upgrades.
+func (w *MaintenanceWindow) IsEmpty() bool {
+	return w == nil || (w.Schedule == "" && len(w.Ranges) == 0)
+}
+
+func (w *MaintenanceWindow) location() (*time.Location, error) {
+	if w.TimeZone == "" {
+		return time.UTC, nil
+	} else if loc, err := time.LoadLocation(w.TimeZone); err != nil {
+		return nil, errors.New(fmt.Sprintf("maintenance window time zone %v is not valid, error: %v", w.TimeZone, err))
+	} else {
+		return loc, nil
+	}
+}
+
+func (w *MaintenanceWindow) duration() (time.Duration, error) {
+	if d, err := time.ParseDuration(w.Duration); err != nil {
+		return 0, errors.New(fmt.Sprintf("maintenance window duration %v is not valid, error: %v", w.Duration, err))
+	} else if d <= 0 {
+		return 0, errors.New(fmt.Sprintf("maintenance window duration %v must be greater than zero", w.Duration))
+	} else {
+		return d, nil
+	}
+}
+
+func parseRangeTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeRangeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("maintenance window time %v is not valid, use RFC3339 or YYYY-MM-DDThh:mm", s))
+}
+
+// Returns an error if the window cannot be interpreted.
+func (w *MaintenanceWindow) Validate() error {
+	if w == nil {
+		return nil
+	}
+
+	loc, err := w.location()
+	if err != nil {
+		return err
+	}
+
+	if w.Schedule != "" {
+		if _, err := scheduleParser.Parse(w.Schedule); err != nil {
+			return errors.New(fmt.Sprintf("maintenance window schedule %v is not valid, error: %v", w.Schedule, err))
+		} else if _, err := w.duration(); err != nil {
+			return err
+		}
+	} else if w.Duration != "" {
+		return errors.New(fmt.Sprintf("maintenance window duration %v is only valid with a schedule", w.Duration))
+	}
+
+	for _, r := range w.Ranges {
+		if start, err := parseRangeTime(r.Start, loc); err != nil {
+			return err
+		} else if end, err := parseRangeTime(r.End, loc); err != nil {
+			return err
+		} else if !end.After(start) {
+			return errors.New(fmt.Sprintf("maintenance window range %v to %v must end after it starts", r.Start, r.End))
+		}
+	}
+	return nil
+}
+
+// Returns the start and end of the window that is open at time t, or of the next window to open after t. Zero
+// times are returned when the window will never open again.
+func (w *MaintenanceWindow) NextWindow(t time.Time) (time.Time, time.Time, error) {
+	var start, end time.Time
+	if w.IsEmpty() {
+		return start, end, nil
+	}
+
+	loc, err := w.location()
+	if err != nil {
+		return start, end, err
+	}
+
+	// Keep the window that is open at t or the earliest one that opens after t.
+	consider := func(s time.Time, e time.Time) {
+		if e.After(t) && (start.IsZero() || s.Before(start)) {
+			start, end = s, e
+		}
+	}
+
+	for _, r := range w.Ranges {
+		if s, err := parseRangeTime(r.Start, loc); err != nil {
+			return time.Time{}, time.Time{}, err
+		} else if e, err := parseRangeTime(r.End, loc); err != nil {
+			return time.Time{}, time.Time{}, err
+		} else {
+			consider(s.In(loc), e.In(loc))
+		}
+	}
+
+	if w.Schedule != "" {
+		sched, err := scheduleParser.Parse(w.Schedule)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New(fmt.Sprintf("maintenance window schedule %v is not valid, error: %v", w.Schedule, err))
+		}
+		d, err := w.duration()
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		// The first scheduled start after t-d is the start of the window that is open at t, if there is one.
+		s := sched.Next(t.In(loc).Add(-d))
+		if !s.IsZero() {
+			consider(s, s.Add(d))
+		}
+	}
+
+	return start, end, nil
+}
+
+// Returns true if the window is open at time t.
+func (w *MaintenanceWindow) IsOpen(t time.Time) (bool, error) {
+	if w.IsEmpty() {
+		return true, nil
+	} else if start, _, err := w.NextWindow(t); err != nil {
+		return false, err
+	} else {
+		return !start.IsZero() && !start.After(t), nil
+	}
+}
+
+// The layouts accepted for a maintenance window given as a time of day, and how long such a window stays open.
+var timeOfDayLayouts = []string{"15:04", "15.04", "3:04PM", "3.04PM", "3:04 PM", "3.04 PM", "3PM"}
+
+const TIME_OF_DAY_WINDOW_DURATION = "1h"
+
+// Parse a maintenance window from a string. The string is either the JSON form of the window or a list of
+// semicolon separated key=value pairs, for example "schedule=0 2 * * 6; duration=4h; timezone=Europe/Berlin".
+// Fixed ranges use the range key, with the start and end separated by a slash, and can be repeated. A plain
+// time of day, for example "01:00AM", is a window that opens at that time every day in UTC and stays open for
+// an hour.
+func ParseMaintenanceWindow(s string) (*MaintenanceWindow, error) {
+	w := new(MaintenanceWindow)
+
+	s = strings.TrimSpace(s)
+	if t, ok := parseTimeOfDay(s); ok {
+		w.Schedule = fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour())
+		w.Duration = TIME_OF_DAY_WINDOW_DURATION
+	} else if strings.HasPrefix(s, "{") {
+		if err := json.Unmarshal([]byte(s), w); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to demarshal maintenance window %v, error: %v", s, err))
+		}
+	} else {
+		for _, field := range strings.Split(s, ";") {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, errors.New(fmt.Sprintf("maintenance window field %v is not of the form key=value", field))
+			}
+			key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			switch key {
+			case "schedule":
+				w.Schedule = value
+			case "duration":
+				w.Duration = value
+			case "timezone":
+				w.TimeZone = value
+			case "range":
+				if se := strings.SplitN(value, "/", 2); len(se) != 2 {
+					return nil, errors.New(fmt.Sprintf("maintenance window range %v is not of the form start/end", value))
+				} else {
+					w.Ranges = append(w.Ranges, TimeRange{Start: strings.TrimSpace(se[0]), End: strings.TrimSpace(se[1])})
+				}
+			default:
+				return nil, errors.New(fmt.Sprintf("maintenance window field %v is not supported", key))
+			}
+		}
+	}
+
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func parseTimeOfDay(s string) (time.Time, bool) {
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.Parse(layout, strings.ToUpper(s)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// The maximum number of windows examined when looking for a time at which several windows are open together.
+const MAX_COMMON_WINDOW_SEARCH = 1000
+
+// Returns the start and end of the next period, at or after time t, in which all of the input windows are open. A
+// zero end means that the period never ends, which is the case when none of the windows restrict upgrades. Zero
+// times are returned when no such period can be found.
+func NextCommonWindow(t time.Time, windows ...*MaintenanceWindow) (time.Time, time.Time, error) {
+	for i := 0; i < MAX_COMMON_WINDOW_SEARCH; i++ {
+		start, end := t, time.Time{}
+		for _, w := range windows {
+			if w.IsEmpty() {
+				continue
+			} else if s, e, err := w.NextWindow(t); err != nil {
+				return time.Time{}, time.Time{}, err
+			} else if s.IsZero() {
+				return time.Time{}, time.Time{}, nil
+			} else {
+				if s.After(start) {
+					start = s
+				}
+				if end.IsZero() || e.Before(end) {
+					end = e
+				}
+			}
+		}
+
+		if end.IsZero() || start.Before(end) {
+			return start, end, nil
+		}
+
+		// The windows do not overlap yet, look again from the latest window start.
+		t = start
+	}
+	return time.Time{}, time.Time{}, nil
+}
+
+// Returns the maintenance window that a node has set in its policy properties, or nil if the node has not set one.
+func NodeMaintenanceWindow(props externalpolicy.PropertyList) (*MaintenanceWindow, error) {
+	if !props.HasProperty(externalpolicy.PROP_NODE_MAINT_WINDOW) {
+		return nil, nil
+	} else if prop, err := props.GetProperty(externalpolicy.PROP_NODE_MAINT_WINDOW); err != nil {
+		return nil, err
+	} else if s, ok := prop.Value.(string); !ok {
+		return nil, errors.New(fmt.Sprintf("property %v must have a string value, is %T", externalpolicy.PROP_NODE_MAINT_WINDOW, prop.Value))
+	} else {
+		return ParseMaintenanceWindow(s)
+	}
+}
@@ -0,0 +1,182 @@
+// +build unit
+
+package policy
+
+import (
+	"github.com/open-horizon/anax/externalpolicy"
+	"testing"
+	"time"
+)
+
+func Test_MaintenanceWindow_empty(t *testing.T) {
+	var w *MaintenanceWindow
+	if open, err := w.IsOpen(time.Now()); err != nil || !open {
+		t.Errorf("nil window should always be open, got %v %v", open, err)
+	}
+
+	w = new(MaintenanceWindow)
+	if open, err := w.IsOpen(time.Now()); err != nil || !open {
+		t.Errorf("empty window should always be open, got %v %v", open, err)
+	}
+}
+
+func Test_MaintenanceWindow_schedule(t *testing.T) {
+	// Saturdays from 02:00 to 06:00 in Berlin.
+	w := &MaintenanceWindow{Schedule: "0 2 * * 6", Duration: "4h", TimeZone: "Europe/Berlin"}
+	if err := w.Validate(); err != nil {
+		t.Fatalf("window should be valid, error: %v", err)
+	}
+
+	loc, _ := time.LoadLocation("Europe/Berlin")
+
+	// Saturday 2021-06-05 at 03:00 is inside the window.
+	if open, err := w.IsOpen(time.Date(2021, 6, 5, 3, 0, 0, 0, loc)); err != nil || !open {
+		t.Errorf("window should be open, got %v %v", open, err)
+	}
+
+	// Saturday 2021-06-05 at 01:00 UTC is 03:00 in Berlin.
+	if open, err := w.IsOpen(time.Date(2021, 6, 5, 1, 0, 0, 0, time.UTC)); err != nil || !open {
+		t.Errorf("window should be open, got %v %v", open, err)
+	}
+
+	// The window closes at 06:00.
+	if open, err := w.IsOpen(time.Date(2021, 6, 5, 6, 0, 0, 0, loc)); err != nil || open {
+		t.Errorf("window should be closed, got %v %v", open, err)
+	}
+
+	// Friday is outside the window, and the next window starts on Saturday.
+	friday := time.Date(2021, 6, 4, 12, 0, 0, 0, loc)
+	if open, err := w.IsOpen(friday); err != nil || open {
+		t.Errorf("window should be closed, got %v %v", open, err)
+	}
+
+	start, end, err := w.NextWindow(friday)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !start.Equal(time.Date(2021, 6, 5, 2, 0, 0, 0, loc)) {
+		t.Errorf("wrong window start %v", start)
+	} else if !end.Equal(time.Date(2021, 6, 5, 6, 0, 0, 0, loc)) {
+		t.Errorf("wrong window end %v", end)
+	}
+}
+
+func Test_MaintenanceWindow_ranges(t *testing.T) {
+	w := &MaintenanceWindow{Ranges: []TimeRange{
+		{Start: "2021-06-10T22:00", End: "2021-06-11T02:00"},
+		{Start: "2021-06-01T00:00:00Z", End: "2021-06-02T00:00:00Z"},
+	}}
+	if err := w.Validate(); err != nil {
+		t.Fatalf("window should be valid, error: %v", err)
+	}
+
+	if open, err := w.IsOpen(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)); err != nil || !open {
+		t.Errorf("window should be open, got %v %v", open, err)
+	}
+	if open, err := w.IsOpen(time.Date(2021, 6, 5, 12, 0, 0, 0, time.UTC)); err != nil || open {
+		t.Errorf("window should be closed, got %v %v", open, err)
+	}
+
+	if start, _, err := w.NextWindow(time.Date(2021, 6, 5, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !start.Equal(time.Date(2021, 6, 10, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong window start %v", start)
+	}
+
+	// After the last range the window never opens again.
+	if start, end, err := w.NextWindow(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !start.IsZero() || !end.IsZero() {
+		t.Errorf("expected no window, got %v %v", start, end)
+	}
+}
+
+func Test_MaintenanceWindow_Validate_errors(t *testing.T) {
+	invalid := []*MaintenanceWindow{
+		{Schedule: "0 2 * * 6"},
+		{Schedule: "0 2 * * 6", Duration: "-1h"},
+		{Schedule: "not a schedule", Duration: "1h"},
+		{Duration: "1h"},
+		{Schedule: "0 2 * * 6", Duration: "1h", TimeZone: "Nowhere/Special"},
+		{Ranges: []TimeRange{{Start: "yesterday", End: "2021-06-01T00:00"}}},
+		{Ranges: []TimeRange{{Start: "2021-06-02T00:00", End: "2021-06-01T00:00"}}},
+	}
+
+	for _, w := range invalid {
+		if err := w.Validate(); err == nil {
+			t.Errorf("window %v should not be valid", w)
+		}
+	}
+}
+
+func Test_ParseMaintenanceWindow(t *testing.T) {
+	if w, err := ParseMaintenanceWindow("schedule=30 1 * * *; duration=90m; timezone=America/New_York; range=2021-06-01T00:00/2021-06-02T00:00"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if w.Schedule != "30 1 * * *" || w.Duration != "90m" || w.TimeZone != "America/New_York" || len(w.Ranges) != 1 {
+		t.Errorf("window was not parsed correctly: %v", w)
+	}
+
+	if w, err := ParseMaintenanceWindow(`{"schedule":"@daily","duration":"1h"}`); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if w.Schedule != "@daily" || w.Duration != "1h" {
+		t.Errorf("window was not parsed correctly: %v", w)
+	}
+
+	for s, schedule := range map[string]string{"01.00AM": "0 1 * * *", "1:30pm": "30 13 * * *", "23:15": "15 23 * * *"} {
+		if w, err := ParseMaintenanceWindow(s); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else if w.Schedule != schedule || w.Duration != TIME_OF_DAY_WINDOW_DURATION {
+			t.Errorf("time of day %v was not parsed correctly: %v", s, w)
+		}
+	}
+
+	for _, s := range []string{"schedule", "when=always", "25:00", "range=2021-06-01T00:00", "schedule=0 2 * * 6"} {
+		if _, err := ParseMaintenanceWindow(s); err == nil {
+			t.Errorf("%v should not parse", s)
+		}
+	}
+}
+
+func Test_NextCommonWindow(t *testing.T) {
+	now := time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)
+
+	// With no restrictions the window is open now and never closes.
+	if start, end, err := NextCommonWindow(now, nil, &MaintenanceWindow{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !start.Equal(now) || !end.IsZero() {
+		t.Errorf("expected an unbounded window starting now, got %v %v", start, end)
+	}
+
+	// Daily from 01:00 to 05:00 and daily from 04:00 to 08:00 overlap from 04:00 to 05:00.
+	w1 := &MaintenanceWindow{Schedule: "0 1 * * *", Duration: "4h"}
+	w2 := &MaintenanceWindow{Schedule: "0 4 * * *", Duration: "4h"}
+	if start, end, err := NextCommonWindow(now, w1, w2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !start.Equal(time.Date(2021, 6, 5, 4, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2021, 6, 5, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong common window %v %v", start, end)
+	}
+
+	// Windows that never overlap.
+	w3 := &MaintenanceWindow{Ranges: []TimeRange{{Start: "2021-06-05T10:00", End: "2021-06-05T11:00"}}}
+	if start, end, err := NextCommonWindow(now, w1, w3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !start.IsZero() || !end.IsZero() {
+		t.Errorf("expected no common window, got %v %v", start, end)
+	}
+}
+
+func Test_NodeMaintenanceWindow(t *testing.T) {
+	props := externalpolicy.PropertyList{}
+	if w, err := NodeMaintenanceWindow(props); err != nil || w != nil {
+		t.Errorf("expected no window, got %v %v", w, err)
+	}
+
+	props.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_MAINT_WINDOW, "schedule=0 2 * * 6; duration=4h"), false)
+	if w, err := NodeMaintenanceWindow(props); err != nil || w == nil || w.Schedule != "0 2 * * 6" {
+		t.Errorf("expected a window, got %v %v", w, err)
+	}
+
+	props.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_MAINT_WINDOW, true), true)
+	if _, err := NodeMaintenanceWindow(props); err == nil {
+		t.Errorf("expected an error for a non-string window")
+	}
+}
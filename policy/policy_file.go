@@ -69,6 +69,8 @@ type Policy struct {
 	HAGroup            HighAvailabilityGroup               `json:"ha_group,omitempty"`         // Version 2.0
 	NodeH              NodeHealth                          `json:"nodeHealth,omitempty"`       // Version 2.0
 	UserInput          []UserInput                         `json:"userInput,omitempty"`
+	RolloutStrategy    *RolloutStrategy                    `json:"rolloutStrategy,omitempty"` // How workload upgrades are rolled out across nodes
+	SecretBinding      []SecretBinding                     `json:"secretBinding,omitempty"`   // The provider keys of the secrets used by the services
 }
 
 // These functions are used to create Policy objects. You can create the base object
@@ -118,6 +120,13 @@ func (self *Policy) DeepCopy() *Policy {
 		newPolicy.UserInput = append(newPolicy.UserInput, newUI)
 	}
 
+	if self.RolloutStrategy != nil {
+		rs := *self.RolloutStrategy
+		newPolicy.RolloutStrategy = &rs
+	}
+
+	newPolicy.SecretBinding = CopySecretBindings(self.SecretBinding)
+
 	return newPolicy
 }
 
@@ -347,6 +356,9 @@ func Create_Terms_And_Conditions(producer_policy *Policy, consumer_policy *Polic
 			copy(merged_pol.UserInput, consumer_policy.UserInput)
 		}
 
+		// the secret bindings are also in the pattern and business policy.
+		merged_pol.SecretBinding = CopySecretBindings(consumer_policy.SecretBinding)
+
 		return merged_pol, nil
 	}
 }
@@ -364,6 +376,7 @@ func MergePolicyWithExternalPolicy(pol *Policy, extPol *externalpolicy.ExternalP
 			merged_pol.UserInput = make([]UserInput, len(pol.UserInput))
 			copy(merged_pol.UserInput, pol.UserInput)
 		}
+		merged_pol.SecretBinding = CopySecretBindings(pol.SecretBinding)
 
 		merged_pol.Properties.MergeWith(&(extPol.Properties), false)
 		merged_pol.Constraints.MergeWith(&(extPol.Constraints))
@@ -481,6 +494,7 @@ func (self *Policy) String() string {
 	res += fmt.Sprintf("Constraints: %v\n", self.Constraints)
 	res += fmt.Sprintf("Data Verification: %v\n", self.DataVerify)
 	res += fmt.Sprintf("Node Health: %v\n", self.NodeH)
+	res += fmt.Sprintf("Rollout Strategy: %v\n", self.RolloutStrategy)
 
 	return res
 }
@@ -599,6 +613,18 @@ func (self *Policy) NextHighestPriorityWorkload(currentPriority int, retryCount
 	}
 }
 
+// Returns the workload with the next lower priority (numerically the next larger priority value) than the input
+// priority, or nil if there is no lower priority workload.
+func (self *Policy) NextLowerPriorityWorkload(currentPriority int) *Workload {
+	var next *Workload
+	for ix, wl := range self.Workloads {
+		if wl.Priority.PriorityValue > currentPriority && (next == nil || wl.Priority.PriorityValue < next.Priority.PriorityValue) {
+			next = &self.Workloads[ix]
+		}
+	}
+	return next
+}
+
 func (p *Policy) MinimumProtocolVersion(name string, other *Policy, maxSupportedVersion int) int {
 	pv := maxSupportedVersion
 	if prodAGP := p.AgreementProtocols.FindByName(name); prodAGP == nil { // This should never happen
@@ -300,6 +300,9 @@ func (self *PolicyManager) hasPolicy(org string, matchPolicy *Policy) (bool, err
 		} else if !UserInputArrayIsSame(pol.UserInput, matchPolicy.UserInput) {
 			errString = fmt.Sprintf("UserInput %v mismatch with %v", pol.UserInput, matchPolicy.UserInput)
 			continue
+		} else if !SecretBindingArrayIsSame(pol.SecretBinding, matchPolicy.SecretBinding) {
+			errString = fmt.Sprintf("SecretBinding %v mismatch with %v", pol.SecretBinding, matchPolicy.SecretBinding)
+			continue
 		} else {
 			errString = ""
 			break
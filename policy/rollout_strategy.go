@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The purpose of this file is to abstract the operations on the rollout strategy type. A rollout strategy controls
+// how a new service version is moved onto the nodes that are already running the service. Instead of upgrading every
+// node at once, the nodes are upgraded in batches. The first batch is a canary batch, sized by a percentage of the
+// nodes or a number of nodes, and each following batch contains BatchSize nodes. A batch succeeds when every node
+// in the batch has run the new version for the success window without an execution failure. The next batch starts
+// once the pause after the previous batch has elapsed.
+
+type RolloutStrategy struct {
+	CanaryPercent int    `json:"canaryPercent,omitempty"` // The percentage of nodes upgraded in the first (canary) batch
+	CanaryCount   int    `json:"canaryCount,omitempty"`   // The minimum number of nodes upgraded in the first (canary) batch
+	BatchSize     int    `json:"batchSize,omitempty"`     // The number of nodes upgraded in each batch after the canary, zero means all remaining nodes
+	BatchPause    string `json:"batchPause,omitempty"`    // How long to wait after a successful batch before starting the next, e.g. 10m
+	SuccessWindow string `json:"successWindow,omitempty"` // How long the new version has to run on a node without an execution failure, e.g. 15m
+}
+
+func (s *RolloutStrategy) String() string {
+	if s == nil {
+		return "none"
+	}
+	return fmt.Sprintf("CanaryPercent: %v, CanaryCount: %v, BatchSize: %v, BatchPause: %v, SuccessWindow: %v", s.CanaryPercent, s.CanaryCount, s.BatchSize, s.BatchPause, s.SuccessWindow)
+}
+
+func parseRolloutDuration(name string, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	} else if d, err := time.ParseDuration(s); err != nil {
+		return 0, errors.New(fmt.Sprintf("rollout strategy %v %v is not valid, error: %v", name, s, err))
+	} else if d < 0 {
+		return 0, errors.New(fmt.Sprintf("rollout strategy %v %v must not be negative", name, s))
+	} else {
+		return d, nil
+	}
+}
+
+// Returns an error if the strategy cannot be interpreted.
+func (s *RolloutStrategy) Validate() error {
+	if s == nil {
+		return nil
+	}
+
+	if s.CanaryPercent < 0 || s.CanaryPercent > 100 {
+		return errors.New(fmt.Sprintf("rollout strategy canaryPercent %v must be between 0 and 100", s.CanaryPercent))
+	} else if s.CanaryCount < 0 {
+		return errors.New(fmt.Sprintf("rollout strategy canaryCount %v must not be negative", s.CanaryCount))
+	} else if s.BatchSize < 0 {
+		return errors.New(fmt.Sprintf("rollout strategy batchSize %v must not be negative", s.BatchSize))
+	} else if _, err := parseRolloutDuration("batchPause", s.BatchPause); err != nil {
+		return err
+	} else if _, err := parseRolloutDuration("successWindow", s.SuccessWindow); err != nil {
+		return err
+	}
+	return nil
+}
+
+// The pause between batches. Invalid durations are treated as no pause.
+func (s *RolloutStrategy) BatchPauseDuration() time.Duration {
+	d, _ := parseRolloutDuration("batchPause", s.BatchPause)
+	return d
+}
+
+// How long a node has to run the new version to be considered upgraded. Invalid durations are treated as zero.
+func (s *RolloutStrategy) SuccessWindowDuration() time.Duration {
+	d, _ := parseRolloutDuration("successWindow", s.SuccessWindow)
+	return d
+}
+
+// Returns the number of nodes in the next batch, given the batch number (starting at 1 for the canary batch), the
+// total number of nodes in the rollout and the number of nodes that have not been upgraded yet. When the strategy
+// has no canary, the first batch is sized like any other batch.
+func (s *RolloutStrategy) BatchCount(batch int, total int, remaining int) int {
+	size := 0
+	if batch == 1 && (s.CanaryPercent != 0 || s.CanaryCount != 0) {
+		size = (total*s.CanaryPercent + 99) / 100
+		if size < s.CanaryCount {
+			size = s.CanaryCount
+		}
+	} else {
+		size = s.BatchSize
+	}
+
+	if size <= 0 || size > remaining {
+		size = remaining
+	}
+	return size
+}
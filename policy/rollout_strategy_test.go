@@ -0,0 +1,61 @@
+// +build unit
+
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_RolloutStrategy_validate(t *testing.T) {
+	var s *RolloutStrategy
+	if err := s.Validate(); err != nil {
+		t.Errorf("nil strategy should be valid, error: %v", err)
+	}
+
+	s = &RolloutStrategy{CanaryPercent: 10, CanaryCount: 2, BatchSize: 5, BatchPause: "10m", SuccessWindow: "15m"}
+	if err := s.Validate(); err != nil {
+		t.Errorf("strategy should be valid, error: %v", err)
+	} else if s.BatchPauseDuration() != 10*time.Minute {
+		t.Errorf("wrong batch pause %v", s.BatchPauseDuration())
+	} else if s.SuccessWindowDuration() != 15*time.Minute {
+		t.Errorf("wrong success window %v", s.SuccessWindowDuration())
+	}
+
+	bad := []RolloutStrategy{
+		{CanaryPercent: -1},
+		{CanaryPercent: 101},
+		{CanaryCount: -1},
+		{BatchSize: -1},
+		{BatchPause: "ten minutes"},
+		{SuccessWindow: "-5m"},
+	}
+	for _, b := range bad {
+		if err := b.Validate(); err == nil {
+			t.Errorf("strategy %v should not be valid", b.String())
+		}
+	}
+}
+
+func Test_RolloutStrategy_batch_count(t *testing.T) {
+	s := &RolloutStrategy{CanaryPercent: 10, BatchSize: 5}
+	if c := s.BatchCount(1, 25, 25); c != 3 {
+		t.Errorf("canary batch should round up to 3 nodes, got %v", c)
+	} else if c := s.BatchCount(2, 25, 22); c != 5 {
+		t.Errorf("second batch should have 5 nodes, got %v", c)
+	} else if c := s.BatchCount(6, 25, 2); c != 2 {
+		t.Errorf("last batch should have the 2 remaining nodes, got %v", c)
+	}
+
+	s = &RolloutStrategy{CanaryPercent: 10, CanaryCount: 4}
+	if c := s.BatchCount(1, 25, 25); c != 4 {
+		t.Errorf("canary batch should have at least 4 nodes, got %v", c)
+	} else if c := s.BatchCount(2, 25, 21); c != 21 {
+		t.Errorf("without a batch size the second batch should have all remaining nodes, got %v", c)
+	}
+
+	s = &RolloutStrategy{BatchSize: 3}
+	if c := s.BatchCount(1, 10, 10); c != 3 {
+		t.Errorf("without a canary the first batch should have 3 nodes, got %v", c)
+	}
+}
@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/semanticversion"
+	"reflect"
+)
+
+// A bound secret maps a secret declared by a service to the key of a secret in the node's secret provider. Only the key
+// is ever stored in a policy, pattern or agreement, the secret value is fetched by the agent on the node.
+type BoundSecret struct {
+	Name string `json:"name"` // the name of the secret in the service definition
+	Key  string `json:"key"`  // the key of the secret in the secret provider
+}
+
+func (s BoundSecret) String() string {
+	return fmt.Sprintf("Name: %v, Key: %v", s.Name, s.Key)
+}
+
+// The secret bindings of a service, in a deployment policy or pattern.
+type SecretBinding struct {
+	ServiceOrgid        string        `json:"serviceOrgid"`
+	ServiceUrl          string        `json:"serviceUrl"`
+	ServiceArch         string        `json:"serviceArch,omitempty"`         // empty string means it applies to all arches
+	ServiceVersionRange string        `json:"serviceVersionRange,omitempty"` // version range such as [0.0.0,INFINITY). empty string means it applies to all versions
+	Secrets             []BoundSecret `json:"secrets"`
+}
+
+func (s SecretBinding) String() string {
+	return fmt.Sprintf("ServiceOrgid: %v, "+
+		"ServiceUrl: %v, "+
+		"ServiceArch: %v, "+
+		"ServiceVersionRange: %v, "+
+		"Secrets: %v",
+		s.ServiceOrgid, s.ServiceUrl, s.ServiceArch, s.ServiceVersionRange, s.Secrets)
+}
+
+func (s SecretBinding) Copy() SecretBinding {
+	newSB := s
+	newSB.Secrets = make([]BoundSecret, len(s.Secrets))
+	copy(newSB.Secrets, s.Secrets)
+	return newSB
+}
+
+// Returns the provider key bound to the secret name, or an empty string if the secret is not bound.
+func (s SecretBinding) GetKey(name string) string {
+	for _, bs := range s.Secrets {
+		if bs.Name == name {
+			return bs.Key
+		}
+	}
+	return ""
+}
+
+func (s SecretBinding) Validate() error {
+	if s.ServiceOrgid == "" || s.ServiceUrl == "" {
+		return errors.New(fmt.Sprintf("serviceOrgid and serviceUrl must be specified in secret binding %v", s))
+	}
+	if s.ServiceVersionRange != "" {
+		if _, err := semanticversion.Version_Expression_Factory(s.ServiceVersionRange); err != nil {
+			return errors.New(fmt.Sprintf("serviceVersionRange %v in secret binding for %v/%v is not valid, error: %v", s.ServiceVersionRange, s.ServiceOrgid, s.ServiceUrl, err))
+		}
+	}
+	names := make(map[string]bool)
+	for _, bs := range s.Secrets {
+		if bs.Name == "" || bs.Key == "" {
+			return errors.New(fmt.Sprintf("name and key must be specified for each secret in secret binding for %v/%v", s.ServiceOrgid, s.ServiceUrl))
+		} else if names[bs.Name] {
+			return errors.New(fmt.Sprintf("secret %v is bound more than once in secret binding for %v/%v", bs.Name, s.ServiceOrgid, s.ServiceUrl))
+		}
+		names[bs.Name] = true
+	}
+	return nil
+}
+
+// Validate a list of secret bindings.
+func ValidateSecretBindings(bindings []SecretBinding) error {
+	for _, sb := range bindings {
+		if err := sb.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Make a copy of a list of secret bindings.
+func CopySecretBindings(bindings []SecretBinding) []SecretBinding {
+	if bindings == nil {
+		return nil
+	}
+	newBindings := make([]SecretBinding, 0, len(bindings))
+	for _, sb := range bindings {
+		newBindings = append(newBindings, sb.Copy())
+	}
+	return newBindings
+}
+
+// Compare two lists of secret bindings.
+func SecretBindingArrayIsSame(bindings1 []SecretBinding, bindings2 []SecretBinding) bool {
+	if len(bindings1) == 0 && len(bindings2) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(bindings1, bindings2)
+}
+
+// Get the secret binding that fits the given service spec.
+// if arch is an empty string, it means any arch.
+// if service version is an empty string, it means any version is ok.
+func FindSecretBinding(svcName, svcOrg, svcVersion, svcArch string, bindings []SecretBinding) (*SecretBinding, error) {
+	for _, sb := range bindings {
+		if sb.ServiceOrgid != svcOrg || sb.ServiceUrl != svcName || (sb.ServiceArch != svcArch && sb.ServiceArch != "" && svcArch != "") {
+			continue
+		}
+
+		if svcVersion != "" && sb.ServiceVersionRange != "" {
+			if vExp, err := semanticversion.Version_Expression_Factory(sb.ServiceVersionRange); err != nil {
+				return nil, fmt.Errorf("Wrong version string %v specified in secret binding for service %v/%v %v %v, error %v", sb.ServiceVersionRange, svcOrg, svcName, svcVersion, svcArch, err)
+			} else if inRange, err := vExp.Is_within_range(svcVersion); err != nil {
+				return nil, fmt.Errorf("Error checking version range %v in secret binding for service %v/%v %v %v . %v", vExp, svcOrg, svcName, svcVersion, svcArch, err)
+			} else if !inRange {
+				continue
+			}
+		}
+
+		sb_tmp := sb.Copy()
+		return &sb_tmp, nil
+	}
+
+	return nil, nil
+}
+
+// Bind each of the secret names declared by a service to a key in the secret provider. The result maps secret name to
+// provider key. An error is returned if any of the secrets is not bound.
+func ResolveSecretBindings(secretNames []string, svcName, svcOrg, svcVersion, svcArch string, bindings []SecretBinding) (map[string]string, error) {
+	resolved := make(map[string]string)
+	if len(secretNames) == 0 {
+		return resolved, nil
+	}
+
+	sb, err := FindSecretBinding(svcName, svcOrg, svcVersion, svcArch, bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range secretNames {
+		key := ""
+		if sb != nil {
+			key = sb.GetKey(name)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("Secret %v of service %v/%v %v is not bound to a secret in the deployment policy or pattern", name, svcOrg, svcName, svcVersion)
+		}
+		resolved[name] = key
+	}
+	return resolved, nil
+}
@@ -0,0 +1,76 @@
+// +build unit
+
+package policy
+
+import (
+	"testing"
+)
+
+func Test_SecretBinding_validate(t *testing.T) {
+	sb := SecretBinding{ServiceOrgid: "myorg", ServiceUrl: "mysvc", ServiceVersionRange: "[1.0.0,2.0.0)", Secrets: []BoundSecret{{Name: "db_password", Key: "prod/db"}}}
+	if err := sb.Validate(); err != nil {
+		t.Errorf("binding should be valid, error: %v", err)
+	}
+
+	bad := []SecretBinding{
+		{ServiceUrl: "mysvc"},
+		{ServiceOrgid: "myorg", ServiceUrl: "mysvc", ServiceVersionRange: "not a range"},
+		{ServiceOrgid: "myorg", ServiceUrl: "mysvc", Secrets: []BoundSecret{{Name: "db_password"}}},
+		{ServiceOrgid: "myorg", ServiceUrl: "mysvc", Secrets: []BoundSecret{{Name: "a", Key: "k1"}, {Name: "a", Key: "k2"}}},
+	}
+	for _, b := range bad {
+		if err := b.Validate(); err == nil {
+			t.Errorf("binding %v should not be valid", b)
+		}
+	}
+}
+
+func Test_ResolveSecretBindings(t *testing.T) {
+	bindings := []SecretBinding{
+		{ServiceOrgid: "myorg", ServiceUrl: "mysvc", ServiceVersionRange: "[2.0.0,INFINITY)", Secrets: []BoundSecret{{Name: "db_password", Key: "v2/db"}}},
+		{ServiceOrgid: "myorg", ServiceUrl: "mysvc", ServiceArch: "amd64", Secrets: []BoundSecret{{Name: "db_password", Key: "v1/db"}, {Name: "api_token", Key: "v1/token"}}},
+	}
+
+	if resolved, err := ResolveSecretBindings([]string{}, "mysvc", "myorg", "1.0.0", "amd64", nil); err != nil {
+		t.Errorf("no error expected, got %v", err)
+	} else if len(resolved) != 0 {
+		t.Errorf("no bindings expected, got %v", resolved)
+	}
+
+	if resolved, err := ResolveSecretBindings([]string{"db_password", "api_token"}, "mysvc", "myorg", "1.0.0", "amd64", bindings); err != nil {
+		t.Errorf("no error expected, got %v", err)
+	} else if resolved["db_password"] != "v1/db" || resolved["api_token"] != "v1/token" {
+		t.Errorf("wrong bindings %v", resolved)
+	}
+
+	if resolved, err := ResolveSecretBindings([]string{"db_password"}, "mysvc", "myorg", "2.1.0", "amd64", bindings); err != nil {
+		t.Errorf("no error expected, got %v", err)
+	} else if resolved["db_password"] != "v2/db" {
+		t.Errorf("wrong bindings %v", resolved)
+	}
+
+	if _, err := ResolveSecretBindings([]string{"db_password", "api_token"}, "mysvc", "myorg", "2.1.0", "amd64", bindings); err == nil {
+		t.Errorf("error expected for unbound secret")
+	}
+
+	if _, err := ResolveSecretBindings([]string{"db_password"}, "mysvc", "myorg", "1.0.0", "arm", bindings); err == nil {
+		t.Errorf("error expected for a service arch without a binding")
+	}
+}
+
+func Test_SecretBindingArrayIsSame(t *testing.T) {
+	b1 := []SecretBinding{{ServiceOrgid: "myorg", ServiceUrl: "mysvc", Secrets: []BoundSecret{{Name: "a", Key: "k1"}}}}
+	b2 := CopySecretBindings(b1)
+	if !SecretBindingArrayIsSame(b1, b2) {
+		t.Errorf("copied bindings should be the same")
+	} else if !SecretBindingArrayIsSame(nil, []SecretBinding{}) {
+		t.Errorf("empty bindings should be the same")
+	}
+
+	b2[0].Secrets[0].Key = "k2"
+	if SecretBindingArrayIsSame(b1, b2) {
+		t.Errorf("bindings with different keys should not be the same")
+	} else if b1[0].Secrets[0].Key != "k1" {
+		t.Errorf("copy should not share secrets with the original")
+	}
+}
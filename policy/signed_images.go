@@ -0,0 +1,22 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy"
+)
+
+// Returns true if the node policy properties require the images of the services on the node to be signed.
+func NodeRequiresSignedImages(props externalpolicy.PropertyList) (bool, error) {
+	if !props.HasProperty(externalpolicy.PROP_NODE_REQ_SIGNED_IMAGES) {
+		return false, nil
+	} else if prop, err := props.GetProperty(externalpolicy.PROP_NODE_REQ_SIGNED_IMAGES); err != nil {
+		return false, err
+	} else if b, ok := prop.Value.(bool); ok {
+		return b, nil
+	} else if s, ok := prop.Value.(string); ok && (s == "true" || s == "false") {
+		return s == "true", nil
+	} else {
+		return false, errors.New(fmt.Sprintf("property %v must have a boolean value, is %v", externalpolicy.PROP_NODE_REQ_SIGNED_IMAGES, prop.Value))
+	}
+}
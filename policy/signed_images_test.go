@@ -0,0 +1,31 @@
+// +build unit
+
+package policy
+
+import (
+	"github.com/open-horizon/anax/externalpolicy"
+	"testing"
+)
+
+func Test_NodeRequiresSignedImages(t *testing.T) {
+
+	props := new(externalpolicy.PropertyList)
+	if required, err := NodeRequiresSignedImages(*props); err != nil || required {
+		t.Errorf("signed images should not be required without the property, got %v %v", required, err)
+	}
+
+	props.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_REQ_SIGNED_IMAGES, true), true)
+	if required, err := NodeRequiresSignedImages(*props); err != nil || !required {
+		t.Errorf("signed images should be required, got %v %v", required, err)
+	}
+
+	props.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_REQ_SIGNED_IMAGES, "false"), true)
+	if required, err := NodeRequiresSignedImages(*props); err != nil || required {
+		t.Errorf("signed images should not be required, got %v %v", required, err)
+	}
+
+	props.Add_Property(externalpolicy.Property_Factory(externalpolicy.PROP_NODE_REQ_SIGNED_IMAGES, "yes"), true)
+	if _, err := NodeRequiresSignedImages(*props); err == nil {
+		t.Errorf("a value that is not a boolean should be rejected")
+	}
+}
@@ -1,12 +1,17 @@
 package policy
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/rsapss-tool/verify"
 	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"strings"
 )
 
 type WorkloadList []Workload
@@ -68,6 +73,7 @@ type Workload struct {
 	Arch                         string           `json:"arch,omitempty"`                           // Added with MS split, refers to the hardware architecture of the workload definition
 	DeploymentOverrides          string           `json:"deployment_overrides,omitempty"`           // Added with MS split, env var overrides for the workload
 	DeploymentOverridesSignature string           `json:"deployment_overrides_signature,omitempty"` // Added with MS split, signature of env var overrides
+	UpgradeTime                  string           `json:"upgrade_time,omitempty"`                   // The maintenance window in which upgrades to this workload can be deployed
 }
 
 func (w Workload) String() string {
@@ -83,10 +89,11 @@ func (w Workload) String() string {
 		"Version: %v, "+
 		"Arch: %v, "+
 		"Deployment Overrides: %v, "+
-		"Deployment Overrides Signature: %v",
+		"Deployment Overrides Signature: %v, "+
+		"Upgrade Time: %v",
 		w.Priority, w.Deployment, w.DeploymentSignature, w.DeploymentUserInfo, w.WorkloadPassword,
 		w.ClusterDeployment, w.ClusterDeploymentSignature,
-		w.WorkloadURL, w.Org, w.Version, w.Arch, w.DeploymentOverrides, w.DeploymentOverridesSignature)
+		w.WorkloadURL, w.Org, w.Version, w.Arch, w.DeploymentOverrides, w.DeploymentOverridesSignature, w.UpgradeTime)
 }
 
 func (w Workload) ShortString() string {
@@ -162,6 +169,7 @@ func (w *Workload) Obscure(agreementId string, defaultPW string) error {
 }
 
 func (w Workload) HasValidSignature(keyFileNames []string) error {
+	keyFileNames = deploymentKeyFiles(keyFileNames)
 	glog.V(3).Infof("Verifying workload signature with keys (bare or wrapped in x509 cert): %v", keyFileNames)
 
 	if w.Deployment != "" {
@@ -195,9 +203,48 @@ func (w Workload) HasValidSignature(keyFileNames []string) error {
 	}
 }
 
+// Returns the key files that can verify deployment signatures. Deployment signatures are made with RSA keys, but the
+// trust store can also hold the ECDSA keys that verify image signatures, so the files with keys of other types are left
+// out. Files that cannot be parsed are kept so that the verification reports them.
+func deploymentKeyFiles(keyFileNames []string) []string {
+	res := make([]string, 0, len(keyFileNames))
+	for _, keyFileName := range keyFileNames {
+		if key := readPublicKey(keyFileName); key == nil {
+			res = append(res, keyFileName)
+		} else if _, ok := key.(*rsa.PublicKey); ok {
+			res = append(res, keyFileName)
+		} else {
+			glog.V(5).Infof("Skipping key file %v for deployment signatures, the key is a %T", keyFileName, key)
+		}
+	}
+	return res
+}
+
+// Returns the public key in the PEM encoded key or x509 certificate file, or nil if the file cannot be parsed.
+func readPublicKey(keyFileName string) interface{} {
+	if keyBytes, err := ioutil.ReadFile(keyFileName); err != nil {
+		return nil
+	} else if block, _ := pem.Decode(keyBytes); block == nil {
+		return nil
+	} else if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		return cert.PublicKey
+	} else if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key
+	}
+	return nil
+}
+
 func (w Workload) HasEmptyPriority() bool {
 	if w.Priority.PriorityValue == 0 && w.Priority.Retries == 0 && w.Priority.RetryDurationS == 0 {
 		return true
 	}
 	return false
 }
+
+// Returns the maintenance window set in the upgrade time of the workload, or nil if upgrades can be deployed at any time.
+func (w Workload) UpgradeWindow() (*MaintenanceWindow, error) {
+	if strings.TrimSpace(w.UpgradeTime) == "" {
+		return nil, nil
+	}
+	return ParseMaintenanceWindow(w.UpgradeTime)
+}
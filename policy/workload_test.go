@@ -5,6 +5,8 @@ package policy
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	crand "crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -13,8 +15,11 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"path"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -230,6 +235,34 @@ func Test_workload_signature_invalid(t *testing.T) {
 	}
 }
 
+func Test_deploymentKeyFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "policytestkeys-")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory, error %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, _ := rsa.GenerateKey(crand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	keyFiles := []string{}
+	for name, pub := range map[string]interface{}{"rsa.pem": &rsaKey.PublicKey, "ecdsa.pem": &ecKey.PublicKey} {
+		pubKeyBytes, _ := x509.MarshalPKIXPublicKey(pub)
+		keyFile := path.Join(dir, name)
+		if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyBytes}), 0600); err != nil {
+			t.Fatalf("Could not write public key file %v, error %v\n", keyFile, err)
+		}
+		keyFiles = append(keyFiles, keyFile)
+	}
+	missing := path.Join(dir, "missing.pem")
+	keyFiles = append(keyFiles, missing)
+
+	// The ECDSA key is left out, the file that cannot be read is kept so that the verification reports it.
+	if files := deploymentKeyFiles(keyFiles); len(files) != 2 || files[len(files)-1] != missing || path.Base(files[0]) != "rsa.pem" {
+		t.Errorf("Expected the RSA key file and the missing file, got %v", files)
+	}
+}
+
 func Test_nexthighestpriority_workload1(t *testing.T) {
 
 	wl1 := `{"priority":{"priority_value":3,"retries":2,"retry_durations":5},"deployment":"3","deployment_signature":"1","deployment_user_info":"d","workload_password":"mysecret"}`
@@ -400,3 +433,21 @@ func create_Workload(jsonString string, t *testing.T) *Workload {
 		return wl
 	}
 }
+
+func Test_nextlowerpriority_workload(t *testing.T) {
+
+	pf_created := Policy_Factory("test creation")
+	for _, p := range []int{5, 1, 3} {
+		pf_created.Workloads = append(pf_created.Workloads, Workload{Version: strconv.Itoa(p) + ".0.0", Priority: *Workload_Priority_Factory(p, 1, 60, 0)})
+	}
+
+	if wl := pf_created.NextLowerPriorityWorkload(0); wl == nil || wl.Version != "1.0.0" {
+		t.Errorf("expected priority 1 workload, returned %v", wl)
+	} else if wl := pf_created.NextLowerPriorityWorkload(1); wl == nil || wl.Version != "3.0.0" {
+		t.Errorf("expected priority 3 workload, returned %v", wl)
+	} else if wl := pf_created.NextLowerPriorityWorkload(3); wl == nil || wl.Version != "5.0.0" {
+		t.Errorf("expected priority 5 workload, returned %v", wl)
+	} else if wl := pf_created.NextLowerPriorityWorkload(5); wl != nil {
+		t.Errorf("expected no workload, returned %v", wl)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/imagefetch"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
@@ -26,6 +27,7 @@ const (
 	EL_PROD_NODE_REJECTED_PROPOSAL_MSG = "Node received Proposal message using agreement %v for service %v/%v from the agbot %v."
 	EL_PROD_NODE_REJECTED_PROPOSAL     = "Node rejected the proposal for service %v/%v."
 	EL_PROD_ERR_HANDLE_PROPOSAL        = "Error handling proposal for service %v/%v. Error: %v"
+	EL_PROD_DISK_PRESSURE_IGNORE       = "Not enough disk space to run service %v/%v, ignoring proposal: %v"
 )
 
 // This is does nothing useful at run time.
@@ -42,6 +44,7 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_PROD_NODE_REJECTED_PROPOSAL_MSG)
 	msgPrinter.Sprintf(EL_PROD_NODE_REJECTED_PROPOSAL)
 	msgPrinter.Sprintf(EL_PROD_ERR_HANDLE_PROPOSAL)
+	msgPrinter.Sprintf(EL_PROD_DISK_PRESSURE_IGNORE)
 }
 
 func CreateProducerPH(name string, cfg *config.HorizonConfig, db *bolt.DB, pm *policy.PolicyManager, ec exchange.ExchangeContext) ProducerProtocolHandler {
@@ -258,6 +261,19 @@ func (w *BaseProducerProtocolHandler) HandleProposal(ph abstractprotocol.Protoco
 			glog.Errorf(BPPHlogString(w.Name(), "pattern name matching failed, ignoring proposal"))
 			err_log_event = "Pattern name matching failed, ignoring proposal"
 			handled = true
+		} else if err := w.checkDiskSpace(dev); err != nil {
+			glog.Errorf(BPPHlogString(w.Name(), fmt.Sprintf("%v, ignoring proposal: %v", err, proposal.ShortString())))
+			eventlog.LogAgreementEvent2(
+				w.db,
+				persistence.SEVERITY_ERROR,
+				persistence.NewMessageMeta(EL_PROD_DISK_PRESSURE_IGNORE, worg, wls, err.Error()),
+				persistence.EC_ERROR_DISK_PRESSURE,
+				proposal.AgreementId(),
+				persistence.WorkloadInfo{URL: wls, Org: worg, Version: wversion, Arch: warch},
+				ConvertToServiceSpecs(tcPolicy.APISpecs),
+				proposal.ConsumerId(),
+				proposal.Protocol())
+			handled = true
 		} else if ag, found, err := w.FindAgreementWithSameWorkload(ph, tcPolicy.Header.Name); err != nil {
 			glog.Errorf(BPPHlogString(w.Name(), fmt.Sprintf("error finding agreement with TsAndCs name '%v', error %v", tcPolicy.Header.Name, err)))
 			err_log_event = fmt.Sprintf("Error finding agreement with TsAndCs (Terms And Conditions) name '%v', error %v", tcPolicy.Header.Name, err)
@@ -324,6 +340,16 @@ func (w *BaseProducerProtocolHandler) HandleProposal(ph abstractprotocol.Protoco
 	return handled, nil, nil
 }
 
+// Returns an error if the free disk space of a device node is too low to pull the images of a new agreement. The
+// proposal is ignored so that the agbot makes it again later, when the images that are no longer used may have been
+// removed.
+func (w *BaseProducerProtocolHandler) checkDiskSpace(dev *persistence.ExchangeDevice) error {
+	if dev.GetNodeType() != persistence.DEVICE_TYPE_DEVICE {
+		return nil
+	}
+	return imagefetch.CheckDiskSpace(w.config)
+}
+
 // This function gets the pattern and workload's signing keys and save them to anax
 func (w *BaseProducerProtocolHandler) saveSigningKeys(pol *policy.Policy) error {
 	// do nothing if the config does not allow using the certs from the org on the exchange
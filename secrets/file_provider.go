@@ -0,0 +1,50 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// The file secret provider is a local stand-in for a real secret store. Each secret is a file in the configured
+// directory, the key of the secret is the path of the file relative to that directory.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func NewFileSecretProvider(dir string) *FileSecretProvider {
+	return &FileSecretProvider{
+		Dir: dir,
+	}
+}
+
+func (f FileSecretProvider) String() string {
+	return fmt.Sprintf("File Secret Provider: "+
+		"Dir: %v", f.Dir)
+}
+
+func (f *FileSecretProvider) Name() string {
+	return SECRET_PROVIDER_FILE
+}
+
+// Read the secret file. The key is not allowed to refer to a file outside of the provider's directory.
+func (f *FileSecretProvider) GetSecret(key string) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("secret key is empty")
+	} else if filepath.IsAbs(key) {
+		return nil, errors.New(fmt.Sprintf("secret key %v must be a relative path", key))
+	}
+
+	cleanKey := filepath.Clean(key)
+	if cleanKey == ".." || strings.HasPrefix(cleanKey, ".."+string(filepath.Separator)) {
+		return nil, errors.New(fmt.Sprintf("secret key %v is outside of the secret directory", key))
+	}
+
+	value, err := ioutil.ReadFile(filepath.Join(f.Dir, cleanKey))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read secret %v, error: %v", key, err))
+	}
+	return value, nil
+}
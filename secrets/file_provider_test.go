@@ -0,0 +1,41 @@
+// +build unit
+
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_FileSecretProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "prod"), 0700); err != nil {
+		t.Fatalf("unable to create dir, error: %v", err)
+	} else if err := ioutil.WriteFile(filepath.Join(dir, "prod", "db"), []byte("s3cret"), 0600); err != nil {
+		t.Fatalf("unable to write secret, error: %v", err)
+	}
+
+	p := NewFileSecretProvider(dir)
+	if p.Name() != SECRET_PROVIDER_FILE {
+		t.Errorf("wrong provider name %v", p.Name())
+	}
+
+	if value, err := p.GetSecret("prod/db"); err != nil {
+		t.Errorf("no error expected, got %v", err)
+	} else if string(value) != "s3cret" {
+		t.Errorf("wrong secret value")
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../db", "prod/../../db", "missing"} {
+		if _, err := p.GetSecret(key); err == nil {
+			t.Errorf("error expected for key %v", key)
+		}
+	}
+}
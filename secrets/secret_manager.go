@@ -0,0 +1,117 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// The secret manager writes the secrets bound to a service into files on a tmpfs filesystem in the host, so that the
+// secret values never touch the disk. The files for each service live in a directory named by a key, usually the
+// agreement id, which is mounted read-only into the service containers.
+type SecretManager struct {
+	TmpfsPath string
+	Provider  SecretProvider
+}
+
+func NewSecretManager(tmpfsPath string, provider SecretProvider) *SecretManager {
+	return &SecretManager{
+		TmpfsPath: tmpfsPath,
+		Provider:  provider,
+	}
+}
+
+func (s SecretManager) String() string {
+	return fmt.Sprintf("Secret Manager: "+
+		"TmpfsPath: %v", s.TmpfsPath)
+}
+
+func (s *SecretManager) GetSecretPath(key string) string {
+	return path.Join(s.TmpfsPath, key)
+}
+
+// Fetch the bound secrets from the provider and write each one into a file named by the secret name. The bindings are
+// keyed by secret name, the values are the keys of the secrets in the provider.
+func (s *SecretManager) CreateSecretFiles(key string, bindings map[string]string) error {
+	if s.Provider == nil {
+		return errors.New("no secret provider is configured")
+	}
+
+	for name := range bindings {
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return errors.New(fmt.Sprintf("secret name %v is not a valid file name", name))
+		}
+	}
+
+	// The secret values must never touch the disk.
+	if err := os.MkdirAll(s.TmpfsPath, 0700); err != nil {
+		return errors.New(fmt.Sprintf("unable to create directory path %v for secrets, error: %v", s.TmpfsPath, err))
+	} else if tmpfs, err := isTmpfs(s.TmpfsPath); err != nil {
+		return errors.New(fmt.Sprintf("unable to check the filesystem type of %v, error: %v", s.TmpfsPath, err))
+	} else if !tmpfs {
+		return errors.New(fmt.Sprintf("%v is not a tmpfs filesystem, secret files cannot be written to it", s.TmpfsPath))
+	}
+
+	values, err := GetSecretValues(s.Provider, bindings)
+	if err != nil {
+		return err
+	}
+
+	dir := s.GetSecretPath(key)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.New(fmt.Sprintf("unable to create directory path %v for secrets, error: %v", dir, err))
+	}
+
+	for name, value := range values {
+		fileName := path.Join(dir, name)
+		if err := ioutil.WriteFile(fileName, value, 0400); err != nil {
+			return errors.New(fmt.Sprintf("unable to write secret file %v, error: %v", fileName, err))
+		}
+	}
+
+	glog.V(5).Infof(secretLogString(fmt.Sprintf("Created secret files %v for %v.", secretNames(bindings), key)))
+
+	return nil
+}
+
+// Remove the secret files written for the key.
+func (s *SecretManager) RemoveSecretFiles(key string) error {
+	if err := os.RemoveAll(s.GetSecretPath(key)); err != nil {
+		return errors.New(fmt.Sprintf("unable to remove secret files for %v, error: %v", key, err))
+	}
+	return nil
+}
+
+// Remove all secret files, used when the node is unconfigured.
+func (s *SecretManager) RemoveAll() error {
+	if err := os.RemoveAll(s.TmpfsPath); err != nil {
+		return errors.New(fmt.Sprintf("unable to remove secret files in %v, error: %v", s.TmpfsPath, err))
+	}
+	return nil
+}
+
+// The filesystem type of tmpfs, as returned by statfs.
+const TMPFS_MAGIC = 0x01021994
+
+// Returns true if the path is on a tmpfs filesystem. It is a variable so that tests can replace it.
+var isTmpfs = func(path string) (bool, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return false, err
+	}
+	return stat.Type == TMPFS_MAGIC, nil
+}
+
+// Returns the names of the bound secrets, for logging.
+func secretNames(bindings map[string]string) []string {
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	return names
+}
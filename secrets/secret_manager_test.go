@@ -0,0 +1,79 @@
+// +build unit
+
+package secrets
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testProvider map[string]string
+
+func (p testProvider) Name() string {
+	return "test"
+}
+
+func (p testProvider) GetSecret(key string) ([]byte, error) {
+	if value, ok := p[key]; ok {
+		return []byte(value), nil
+	}
+	return nil, errors.New("not found")
+}
+
+func Test_SecretManager_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmpfs")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the temp dir is usually not on tmpfs
+	realIsTmpfs := isTmpfs
+	defer func() { isTmpfs = realIsTmpfs }()
+	isTmpfs = func(path string) (bool, error) { return true, nil }
+
+	sm := NewSecretManager(dir, testProvider{"prod/db": "s3cret", "prod/token": "t0ken"})
+
+	if err := sm.CreateSecretFiles("ag1", map[string]string{"db_password": "prod/db", "api_token": "prod/token"}); err != nil {
+		t.Fatalf("no error expected, got %v", err)
+	}
+
+	fileName := filepath.Join(sm.GetSecretPath("ag1"), "db_password")
+	if value, err := ioutil.ReadFile(fileName); err != nil {
+		t.Errorf("unable to read secret file, error: %v", err)
+	} else if string(value) != "s3cret" {
+		t.Errorf("wrong secret value")
+	} else if info, err := os.Stat(fileName); err != nil {
+		t.Errorf("unable to stat secret file, error: %v", err)
+	} else if info.Mode().Perm() != 0400 {
+		t.Errorf("wrong secret file mode %v", info.Mode())
+	}
+
+	if err := sm.CreateSecretFiles("ag2", map[string]string{"db_password": "prod/missing"}); err == nil {
+		t.Errorf("error expected for missing secret")
+	} else if err := sm.CreateSecretFiles("ag2", map[string]string{"../db_password": "prod/db"}); err == nil {
+		t.Errorf("error expected for bad secret name")
+	} else if _, err := os.Stat(sm.GetSecretPath("ag2")); !os.IsNotExist(err) {
+		t.Errorf("no secret files should be written for a failed create")
+	}
+
+	if err := sm.RemoveSecretFiles("ag1"); err != nil {
+		t.Errorf("no error expected, got %v", err)
+	} else if _, err := os.Stat(sm.GetSecretPath("ag1")); !os.IsNotExist(err) {
+		t.Errorf("secret files should be removed")
+	}
+
+	if err := NewSecretManager(dir, nil).CreateSecretFiles("ag3", map[string]string{"db_password": "prod/db"}); err == nil {
+		t.Errorf("error expected without a provider")
+	}
+
+	isTmpfs = func(path string) (bool, error) { return false, nil }
+	if err := sm.CreateSecretFiles("ag4", map[string]string{"db_password": "prod/db"}); err == nil {
+		t.Errorf("error expected when the secrets path is not tmpfs")
+	} else if _, err := os.Stat(sm.GetSecretPath("ag4")); !os.IsNotExist(err) {
+		t.Errorf("no secret files should be written outside of tmpfs")
+	}
+}
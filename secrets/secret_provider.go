@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/config"
+)
+
+// A secret provider is the source of the values of the secrets that are bound to services. Deployment policies and
+// patterns only ever refer to a secret by the key it has in the provider, the value itself stays on the node.
+type SecretProvider interface {
+	Name() string
+	GetSecret(key string) ([]byte, error)
+}
+
+// The secret providers that anax knows about.
+const SECRET_PROVIDER_FILE = "file"
+
+// Create the secret provider configured for this node.
+func NewSecretProvider(cfg *config.HorizonConfig) (SecretProvider, error) {
+	switch cfg.GetSecretProvider() {
+	case SECRET_PROVIDER_FILE:
+		return NewFileSecretProvider(cfg.GetSecretFileDir()), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported secret provider %v", cfg.GetSecretProvider()))
+	}
+}
+
+// Fetch the value of each bound secret from the provider. The input map is keyed by the secret name that the service
+// uses, the values are the keys of the secrets in the provider.
+func GetSecretValues(provider SecretProvider, bindings map[string]string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	for name, key := range bindings {
+		if value, err := provider.GetSecret(key); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to get secret %v from %v secret provider, error: %v", name, provider.Name(), err))
+		} else {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+var secretLogString = func(v interface{}) string {
+	return fmt.Sprintf("Secret Manager: %v", v)
+}
@@ -316,6 +316,7 @@ func (w *BaseWorker) internalCommandhandler(worker Worker, command Command) bool
 func (w *BaseWorker) Start(worker Worker, noWorkInterval int) {
 
 	w.SetNoWorkInterval(noWorkInterval)
+	workerMetrics.AddWorker(w)
 
 	go func() {
 
@@ -364,7 +365,9 @@ func (w *BaseWorker) Start(worker Worker, noWorkInterval int) {
 				case <-time.After(time.Duration(waitTime) * time.Second):
 					// Call the no work to do handler if it was requested.
 					if w.GetNoWorkInterval() != 0 {
+						start := time.Now()
 						worker.NoWorkHandler()
+						workerMetrics.ObserveNoWork(w.GetName(), time.Since(start))
 					}
 
 					// Requeue any deferred commands that have been accumulating.
@@ -584,6 +587,7 @@ func (workers *MessageHandlerRegistry) ProcessEventMessages() {
 			case msg := <-messageStream:
 				glog.V(3).Infof(mdLogString(fmt.Sprintf("Handling Message (%T): %v\n", msg, msg.ShortString())))
 				glog.V(5).Infof(mdLogString(fmt.Sprintf("Handling Message (%T): %v\n", msg, msg)))
+				eventsProcessed.WithLabelValues(string(msg.Event().Id)).Inc()
 
 				// Push outbound messages into each worker.
 				if successMsg, err := eventHandler(msg, workers); err != nil {
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Prometheus metrics that every worker built on the BaseWorker framework contributes. They are registered with the
+// default prometheus registry so that any process hosting workers (the agent or the agbot) exposes them from its
+// /metrics API.
+
+var workerMetrics = NewWorkerMetricsCollector()
+
+// The number of event messages dispatched to the workers, by event id.
+var eventsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "anax_events_processed_total",
+	Help: "Number of event messages dispatched to the workers.",
+}, []string{"event"})
+
+func init() {
+	prometheus.MustRegister(workerMetrics, eventsProcessed)
+}
+
+func GetWorkerMetricsCollector() *WorkerMetricsCollector {
+	return workerMetrics
+}
+
+// The collector tracks the started workers so that their command queue length can be read at scrape time, and
+// keeps a histogram of the time each worker spends in its NoWorkHandler.
+type WorkerMetricsCollector struct {
+	workers      map[string]*BaseWorker
+	workersLock  sync.Mutex
+	queueLenDesc *prometheus.Desc
+	noWorkTime   *prometheus.HistogramVec
+}
+
+func NewWorkerMetricsCollector() *WorkerMetricsCollector {
+	return &WorkerMetricsCollector{
+		workers: make(map[string]*BaseWorker),
+		queueLenDesc: prometheus.NewDesc(
+			"anax_worker_command_queue_length",
+			"Number of commands waiting in the worker's command queue.",
+			[]string{"worker"}, nil),
+		noWorkTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "anax_worker_nowork_handler_duration_seconds",
+			Help:    "Time spent by the worker in its NoWorkHandler.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"worker"}),
+	}
+}
+
+// Add a worker to the set of workers whose command queue is reported.
+func (c *WorkerMetricsCollector) AddWorker(w *BaseWorker) {
+	c.workersLock.Lock()
+	defer c.workersLock.Unlock()
+
+	c.workers[w.GetName()] = w
+}
+
+// Record the time a worker spent in its NoWorkHandler.
+func (c *WorkerMetricsCollector) ObserveNoWork(name string, d time.Duration) {
+	c.noWorkTime.WithLabelValues(name).Observe(d.Seconds())
+}
+
+func (c *WorkerMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueLenDesc
+	c.noWorkTime.Describe(ch)
+}
+
+func (c *WorkerMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.workersLock.Lock()
+	for name, w := range c.workers {
+		ch <- prometheus.MustNewConstMetric(c.queueLenDesc, prometheus.GaugeValue, float64(len(w.Commands)), name)
+	}
+	c.workersLock.Unlock()
+
+	c.noWorkTime.Collect(ch)
+}
@@ -0,0 +1,34 @@
+// +build unit
+
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_WorkerMetricsCollector(t *testing.T) {
+	c := NewWorkerMetricsCollector()
+
+	w := &BaseWorker{Name: "metricsworker", Commands: make(chan Command, 10)}
+	w.Commands <- NewBeginShutdownCommand()
+	w.Commands <- NewBeginShutdownCommand()
+	c.AddWorker(w)
+
+	c.ObserveNoWork(w.GetName(), 2*time.Millisecond)
+
+	expected := `
+# HELP anax_worker_command_queue_length Number of commands waiting in the worker's command queue.
+# TYPE anax_worker_command_queue_length gauge
+anax_worker_command_queue_length{worker="metricsworker"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "anax_worker_command_queue_length"); err != nil {
+		t.Errorf("unexpected command queue metric, error: %v", err)
+	}
+
+	if n := testutil.CollectAndCount(c, "anax_worker_nowork_handler_duration_seconds"); n != 1 {
+		t.Errorf("expected 1 nowork handler histogram, got %v", n)
+	}
+}